@@ -1,12 +1,14 @@
 package assumerole
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rishichirchi/cloudloom/common"
 	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/tenants"
 )
 
 type ARNRequest struct{
@@ -25,11 +27,20 @@ func SetupCloudTrailHandler(c *gin.Context) {
 		return
 	}
 
-	common.ARNNumber = req.RoleARN
-
-	service := services.NewCloudTrailService()
+	tenant := &tenants.Tenant{
+		AccountID:  tenants.AccountFromRoleARN(req.RoleARN),
+		RoleArn:    req.RoleARN,
+		ExternalID: common.ExternalID,
+	}
 
-	err := service.SetupCloudTrail(c.Request.Context())
+	err := services.OnboardTenant(c.Request.Context(), tenant)
+	if errors.Is(err, tenants.ErrSetupInProgress) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   err.Error(),
+			"success": false,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   err.Error(),
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	auditsvc "github.com/rishichirchi/cloudloom/services/audit"
+)
+
+const (
+	defaultRecordLimit = 200
+	maxRecordLimit     = 1000
+)
+
+// requireTrail resolves the remediation audit trail, writing an error response if it is missing
+func requireTrail(c *gin.Context) (*auditsvc.Trail, bool) {
+	trail := auditsvc.DefaultTrail()
+	if trail == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the remediation audit trail is not initialized", "success": false})
+		return nil, false
+	}
+	return trail, true
+}
+
+// timeRange reads an RFC3339 ?from= and ?to= range, writing an error response if either is
+// malformed
+func timeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	for param, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param), "success": false})
+				return time.Time{}, time.Time{}, false
+			}
+			*dst = t
+		}
+	}
+	return from, to, true
+}
+
+// ListRequestsHandler returns the tenant's most recent state-changing API requests
+func ListRequestsHandler(c *gin.Context) {
+	l := auditsvc.Default()
+	if l == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the audit log is not initialized", "success": false})
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+	entries, err := l.List(c.Request.Context(), common.TenantID(c), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "count": len(entries), "success": true})
+}
+
+// ListRemediationRecordsHandler returns the tenant's remediation audit records in chain order,
+// optionally for one ?remediationId= or ?findingId= and an RFC3339 from/to range
+func ListRemediationRecordsHandler(c *gin.Context) {
+	trail, ok := requireTrail(c)
+	if !ok {
+		return
+	}
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultRecordLimit)), 10, 64)
+	if err != nil || limit <= 0 || limit > maxRecordLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxRecordLimit), "success": false})
+		return
+	}
+	records, err := trail.List(c.Request.Context(), auditsvc.TrailFilter{
+		TenantID:      common.TenantID(c),
+		RemediationID: c.Query("remediationId"),
+		FindingID:     c.Query("findingId"),
+		From:          from,
+		To:            to,
+		Limit:         limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "count": len(records), "success": true})
+}
+
+// GetRemediationRecordHandler returns one remediation audit record
+func GetRemediationRecordHandler(c *gin.Context) {
+	trail, ok := requireTrail(c)
+	if !ok {
+		return
+	}
+
+	record, err := trail.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if errors.Is(err, auditsvc.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"record": record, "success": true})
+}
+
+// VerifyRemediationTrailHandler recomputes the hashes of the tenant's whole remediation audit
+// trail and reports the first record that was changed, removed or inserted
+func VerifyRemediationTrailHandler(c *gin.Context) {
+	trail, ok := requireTrail(c)
+	if !ok {
+		return
+	}
+
+	verification, err := trail.Verify(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"verification": verification, "success": true})
+}
+
+// ExportRemediationEvidenceHandler downloads the tenant's remediation audit records over an
+// RFC3339 from/to range, with the verification of the chain, as ?format=csv (the default) or
+// ?format=pdf for auditors
+func ExportRemediationEvidenceHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or pdf", "success": false})
+		return
+	}
+	from, to, ok := timeRange(c)
+	if !ok {
+		return
+	}
+
+	evidence, err := services.RemediationEvidence(c.Request.Context(), common.TenantID(c), from, to)
+	if errors.Is(err, services.ErrRemediationsUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	filename := fmt.Sprintf("remediation-evidence-%s-%s.%s", evidence.TenantID, evidence.GeneratedAt.UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Chain-Valid", strconv.FormatBool(evidence.Verification.Valid))
+	if format == "pdf" {
+		c.Data(http.StatusOK, "application/pdf", evidence.PDF())
+		return
+	}
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	if err := evidence.WriteCSV(c.Writer); err != nil {
+		// The response has started, so the error can only be logged
+		log.Printf("[Audit] Warning: failed to write evidence export of tenant %s: %v", evidence.TenantID, err)
+	}
+}
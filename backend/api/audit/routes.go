@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// SetupAuditRoutes sets up the routes over the API audit log and the hash-chained remediation
+// audit trail
+func SetupAuditRoutes(router common.Router) {
+	router.GET("/requests", "entries", ListRequestsHandler)
+	router.GET("/remediations", "records", ListRemediationRecordsHandler)
+	router.GET("/remediations/verify", "verification", VerifyRemediationTrailHandler)
+	router.Raw(http.MethodGet, "/remediations/export", ExportRemediationEvidenceHandler)
+	router.GET("/remediations/:id", "record", GetRemediationRecordHandler)
+}
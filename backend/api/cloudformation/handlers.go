@@ -9,13 +9,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/rishichirchi/cloudloom/common"
 )
 
 // DownloadCloudFormationTemplate provides the template as a downloadable YAML file
 func DownloadCloudFormationTemplate(ctx *gin.Context) {
 	var request CloudFormationRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !common.BindJSON(ctx, &request) {
 		return
 	}
 
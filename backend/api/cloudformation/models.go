@@ -1,7 +1,9 @@
 package cloudformation
 
+import "github.com/rishichirchi/cloudloom/services/tenants"
+
 type CloudFormationRequest struct {
-	AccessTier string `json:"accessTier"`
+	AccessTier string `json:"accessTier" binding:"required,oneof=CloudLoomNotificationTier CloudLoomSuggestFixTier CloudLoomAutoApplyFixTier"`
 }
 
 type CloudFormationResponse struct {
@@ -13,8 +15,9 @@ type CloudFormationResponse struct {
 
 
 
+// The access tiers, each with its own template, as stored on the tenant set up with it
 const (
-	CloudLoomNotificationTier = "CloudLoomNotificationTier"
-	CloudLoomAutoApplyFixTier = "CloudLoomAutoApplyFixTier"
-	CloudLoomSuggestFixTier   = "CloudLoomSuggestFixTier"
+	CloudLoomNotificationTier = string(tenants.TierNotification)
+	CloudLoomAutoApplyFixTier = string(tenants.TierAutoApplyFix)
+	CloudLoomSuggestFixTier   = string(tenants.TierSuggestFix)
 )
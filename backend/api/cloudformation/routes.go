@@ -1,7 +1,11 @@
 package cloudformation
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
 
-func CloudFormationRoutes(router *gin.RouterGroup) {
-	router.POST("/download-template", DownloadCloudFormationTemplate)
-}
\ No newline at end of file
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+func CloudFormationRoutes(router common.Router) {
+	router.Raw(http.MethodPost, "/download-template", DownloadCloudFormationTemplate)
+}
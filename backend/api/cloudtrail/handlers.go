@@ -0,0 +1,80 @@
+package cloudtrail
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// GetIntegrityHandler validates the tenant's CloudTrail log files against their digest files
+// over an RFC3339 from/to range, by default the last 24 hours, and reports tampered or
+// missing files. The range may span at most seven days.
+func GetIntegrityHandler(c *gin.Context) {
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	for param, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param), "success": false})
+				return
+			}
+			*dst = t
+		}
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: log files were not validated", "demo": true, "success": true})
+		return
+	}
+
+	service, err := services.NewTrailIntegrityService(c.Request.Context(), common.TenantID(c))
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	report, err := service.Validate(c.Request.Context(), from, to)
+	if errors.Is(err, services.ErrInvalidIntegrityRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to validate log files: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"integrity": report, "success": true})
+}
+
+// EnableIntegrityHandler turns on log file validation for the tenant's trail, for accounts
+// set up before setup enabled it
+func EnableIntegrityHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: log file validation was not changed", "demo": true, "success": true})
+		return
+	}
+
+	service, err := services.NewTrailIntegrityService(c.Request.Context(), common.TenantID(c))
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err := service.EnableValidation(c.Request.Context()); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log file validation enabled; the first digest file arrives within an hour", "success": true})
+}
@@ -0,0 +1,9 @@
+package cloudtrail
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupCloudTrailRoutes sets up the routes for checking the tenant's trail
+func SetupCloudTrailRoutes(router common.Router) {
+	router.GET("/integrity", "integrity", GetIntegrityHandler)
+	router.POST("/integrity/enable", "", EnableIntegrityHandler)
+}
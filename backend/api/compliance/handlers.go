@@ -0,0 +1,155 @@
+package compliance
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/tagpolicy"
+)
+
+// GetSummaryHandler returns the compliance score of the snapshot named by ?snapshotId=, or of
+// the latest one, per rule, per resource type and overall, with the overall score of up to
+// ?points= earlier snapshots as a trend
+func GetSummaryHandler(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	points, _ := strconv.Atoi(c.Query("points"))
+	summary, err := services.SummarizeCompliance(c.Request.Context(), common.TenantID(c), c.Query("snapshotId"), points)
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.Header("X-Snapshot-ID", summary.Snapshot.ID)
+	c.JSON(http.StatusOK, gin.H{"summary": summary, "success": true})
+}
+
+// requireTagPolicies resolves the tag policy store and tenant, writing an error response if
+// either is missing
+func requireTagPolicies(c *gin.Context) (*tagpolicy.Store, string, bool) {
+	store := tagpolicy.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "tag policies are not initialized", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	return store, tenantID, true
+}
+
+// GetTagComplianceHandler evaluates the tenant's tag policy against the snapshot named by
+// ?snapshotId=, or the latest one, and lists the violations, optionally only those of
+// ?key= or ?resourceType=
+func GetTagComplianceHandler(c *gin.Context) {
+	_, tenantID, ok := requireTagPolicies(c)
+	if !ok {
+		return
+	}
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	result, err := services.EvaluateTagCompliance(c.Request.Context(), tenantID, c.Query("snapshotId"))
+	if errors.Is(err, tagpolicy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no tag policy is defined", "success": false})
+		return
+	}
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	key, resourceType := c.Query("key"), c.Query("resourceType")
+	if key != "" || resourceType != "" {
+		filtered := []services.TagViolation{}
+		for _, violation := range result.Violations {
+			if (key == "" || violation.Key == key) && (resourceType == "" || violation.ResourceType == resourceType) {
+				filtered = append(filtered, violation)
+			}
+		}
+		result.Violations = filtered
+	}
+	c.Header("X-Snapshot-ID", result.Snapshot.ID)
+	c.JSON(http.StatusOK, gin.H{"tags": result, "success": true})
+}
+
+// GetTagPolicyHandler returns the tenant's tag policy
+func GetTagPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireTagPolicies(c)
+	if !ok {
+		return
+	}
+
+	policy, err := store.Get(c.Request.Context(), tenantID)
+	if errors.Is(err, tagpolicy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "success": true})
+}
+
+// PutTagPolicyHandler replaces the tenant's tag policy. It applies to the next inventory scan
+// and to tag compliance requests from now on.
+func PutTagPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireTagPolicies(c)
+	if !ok {
+		return
+	}
+
+	var policy tagpolicy.Policy
+	if !common.BindJSON(c, &policy) {
+		return
+	}
+	err := store.Put(c.Request.Context(), tenantID, &policy)
+	if errors.Is(err, tagpolicy.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "success": true})
+}
+
+// DeleteTagPolicyHandler removes the tenant's tag policy; the next scan resolves its findings
+func DeleteTagPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireTagPolicies(c)
+	if !ok {
+		return
+	}
+
+	err := store.Delete(c.Request.Context(), tenantID)
+	if errors.Is(err, tagpolicy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
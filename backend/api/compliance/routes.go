@@ -0,0 +1,12 @@
+package compliance
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupComplianceRoutes sets up the routes over the compliance of the tenant's inventory
+func SetupComplianceRoutes(router common.Router) {
+	router.GET("/summary", "summary", GetSummaryHandler)
+	router.GET("/tags", "tags", GetTagComplianceHandler)
+	router.GET("/tags/policy", "policy", GetTagPolicyHandler)
+	router.PUT("/tags/policy", "policy", PutTagPolicyHandler)
+	router.DELETE("/tags/policy", "", DeleteTagPolicyHandler)
+}
@@ -1,37 +1,185 @@
 package configure
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rishichirchi/cloudloom/common"
 	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/accountconfig"
+	"github.com/rishichirchi/cloudloom/services/eventsubscriptions"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/orgonboarding"
+	"github.com/rishichirchi/cloudloom/services/pollers"
+	"github.com/rishichirchi/cloudloom/services/tenants"
 )
 
 type RoleARNRequest struct {
-	ARNNumber      string `json:"arnNumber"`
+	ARNNumber      string `json:"arnNumber" binding:"required,awsrolearn"`
 	ExternalID     *string `json:"externalId"`
-	GithubRepoLink *string `json:"githubRepoLink"`
+	Region         *string `json:"region" binding:"omitempty,awsregion"`
+	Regions        []string `json:"regions" binding:"omitempty,dive,awsregion"`
+	GithubRepoLink *string `json:"githubRepoLink" binding:"omitempty,url"`
+	// AllRegions monitors every region enabled in the account instead of Regions
+	AllRegions bool `json:"allRegions" binding:"excluded_with=Regions"`
+	// KMSKeyArn encrypts the account's logs with an existing customer managed key in the home
+	// region; CreateKMSKey has setup create one instead
+	KMSKeyArn    string `json:"kmsKeyArn" binding:"omitempty,kmskeyarn"`
+	CreateKMSKey bool   `json:"createKmsKey"`
+	// RetentionDays expires the account's CloudTrail and AWS Config logs; unset keeps them
+	RetentionDays int `json:"retentionDays" binding:"omitempty,min=1,max=3653"`
+	// ReplicationRegion replicates the account's log bucket to a bucket in another region
+	ReplicationRegion string `json:"replicationRegion" binding:"omitempty,awsregion,excluded_with=ExistingTrailArn ExistingBucketName"`
+	// ExistingTrailArn and ExistingBucketName have setup reuse the customer's own multi-region
+	// trail and log bucket instead of creating them
+	ExistingTrailArn   string `json:"existingTrailArn" binding:"omitempty,startswith=arn:aws:cloudtrail:"`
+	ExistingBucketName string `json:"existingBucketName" binding:"omitempty,min=3,max=63"`
+	// S3DataEvents, LambdaDataEvents and Insights make the trail record more than management events
+	S3DataEvents     bool `json:"s3DataEvents"`
+	LambdaDataEvents bool `json:"lambdaDataEvents"`
+	Insights         bool `json:"insights"`
+	// NotificationEndpoints are email addresses and HTTPS URLs to subscribe to the account's
+	// notification topic
+	NotificationEndpoints []string `json:"notificationEndpoints" binding:"omitempty,max=10"`
+	// AccessTier is the tier of the template the role was deployed with; unset is auto-apply fix
+	AccessTier string `json:"accessTier" binding:"omitempty,oneof=CloudLoomNotificationTier CloudLoomSuggestFixTier CloudLoomAutoApplyFixTier"`
+	// FifoQueue has the account's events processed in order within each region
+	FifoQueue bool `json:"fifoQueue"`
 }
 
-// SetupCloudTrailHandler handles the HTTP request for CloudTrail setup
+// tenant returns the tenant the request onboards, keyed by the role's account ID
+func (r RoleARNRequest) tenant() *tenants.Tenant {
+	tenant := &tenants.Tenant{
+		AccountID:             tenants.AccountFromRoleARN(r.ARNNumber),
+		RoleArn:               r.ARNNumber,
+		ExternalID:            common.ExternalID,
+		Regions:               r.Regions,
+		AllRegions:            r.AllRegions,
+		KMSKeyArn:             r.KMSKeyArn,
+		CreateKMSKey:          r.CreateKMSKey,
+		LogRetentionDays:      r.RetentionDays,
+		ReplicationRegion:     r.ReplicationRegion,
+		ExistingTrailArn:      r.ExistingTrailArn,
+		ExistingBucketName:    r.ExistingBucketName,
+		AccessTier:            tenants.AccessTier(r.AccessTier),
+		NotificationEndpoints: r.NotificationEndpoints,
+		FifoQueue:             r.FifoQueue,
+		TrailEvents: tenants.TrailEvents{
+			S3DataEvents:     r.S3DataEvents,
+			LambdaDataEvents: r.LambdaDataEvents,
+			Insights:         r.Insights,
+		},
+	}
+	if r.ExternalID != nil && *r.ExternalID != "" {
+		tenant.ExternalID = *r.ExternalID
+	}
+	if r.Region != nil {
+		tenant.Region = *r.Region
+	}
+	return tenant
+}
+
+// SetupCloudTrailHandler handles the HTTP request for CloudTrail setup. The account is
+// registered as a tenant keyed by the role's account ID, so several accounts can be set up
+// at the same time; it responds 409 while the same account is still being set up.
+// Setup runs as a background job: the response is 202 with the job's status URL, which
+// reports each step as it completes. With ?dryRun=true nothing is changed and the response is
+// the plan of what setup would create or modify. A setup that failed resumes from the step it
+// failed at; ?force=true runs every step again.
 func SetupCloudTrailHandler(c *gin.Context) {
 	var request RoleARNRequest
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if err := services.ValidateNotificationEndpoints(request.NotificationEndpoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS resources were created", "demo": true, "success": true})
 		return
 	}
 
-	common.ARNNumber = request.ARNNumber
+	tenant := request.tenant()
 
-	arn := fmt.Sprintf("ARN number: %s\nExternal ID: %s", common.ARNNumber, common.ExternalID)
+	arn := fmt.Sprintf("ARN number: %s\nExternal ID: %s", tenant.RoleArn, tenant.ExternalID)
 	fmt.Printf("Received ARN request: %s\n", arn)
 
-	service := services.NewCloudTrailService()
+	// A dry run only reads the account, so it runs inline and registers nothing
+	if c.Query("dryRun") == "true" {
+		plan, err := services.PlanTenantSetup(c.Request.Context(), tenant)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to plan setup: %v", err), "success": false})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"plan": plan, "success": true})
+		return
+	}
+
+	if c.Query("force") == "true" {
+		err := services.ResetSetupCheckpoint(c.Request.Context(), tenant.AccountID)
+		if errors.Is(err, tenants.ErrSetupInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+	}
+
+	// Setup takes minutes, so run it as a job when the job subsystem is available
+	if jobsvc.Default() != nil {
+		job, err := services.EnqueueAccountSetup(c.Request.Context(), tenant)
+		if errors.Is(err, tenants.ErrSetupInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
 
-	err := service.SetupCloudTrail(c.Request.Context())
+		statusURL := fmt.Sprintf("/api/v1/configure/jobs/%s", job.ID.Hex())
+		c.Header("Location", statusURL)
+		c.JSON(http.StatusAccepted, gin.H{
+			"jobId":     job.ID.Hex(),
+			"accountId": tenant.AccountID,
+			"status":    job.Status,
+			"statusUrl": statusURL,
+			"success":   true,
+		})
+		return
+	}
+
+	err := services.OnboardTenant(c.Request.Context(), tenant)
+	var missingErr *services.MissingPermissionsError
+	if errors.As(err, &missingErr) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":              err.Error(),
+			"missingPermissions": missingErr.Missing,
+			"success":            false,
+		})
+		return
+	}
+	var regionsErr *services.RegionsNotEnabledError
+	if errors.As(err, &regionsErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":           err.Error(),
+			"disabledRegions": regionsErr.Regions,
+			"success":         false,
+		})
+		return
+	}
+	if errors.Is(err, tenants.ErrSetupInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   err.Error(),
@@ -41,7 +189,711 @@ func SetupCloudTrailHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "CloudTrail and Auto Apply Fix setup completed successfully",
+		"message": fmt.Sprintf("CloudTrail setup for the %s tier completed successfully", tenant.Tier()),
+		"tenant":  tenant,
 		"success": true,
 	})
 }
+
+// ValidatePermissionsHandler simulates every permission setup needs against the role in the
+// request and reports each as passed or failed, without changing anything in the account
+func ValidatePermissionsHandler(c *gin.Context) {
+	var request RoleARNRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: permissions were not checked", "demo": true, "success": true})
+		return
+	}
+
+	report, err := services.ValidateTenantPermissions(c.Request.Context(), request.tenant())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to validate permissions: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"validation": report, "success": true})
+}
+
+// OrgOnboardingRequest onboards the member accounts of the caller's AWS organization
+type OrgOnboardingRequest struct {
+	// Mode is "setup" (default) to set every member account up, or "stage" to only register them
+	Mode           string   `json:"mode" binding:"omitempty,oneof=setup stage"`
+	MemberRoleName string   `json:"memberRoleName"`
+	ExternalID     *string  `json:"externalId"`
+	Region         string   `json:"region" binding:"omitempty,awsregion"`
+	Regions        []string `json:"regions" binding:"omitempty,dive,awsregion"`
+}
+
+// OnboardOrganizationHandler lists the member accounts of the organization the caller's role
+// manages and starts setup in each of them through the member role, or only stages them.
+// It responds 202 with the onboarding, whose progress is at /configure/organization/onboardings/:id.
+func OnboardOrganizationHandler(c *gin.Context) {
+	var request OrgOnboardingRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no accounts were onboarded", "demo": true, "success": true})
+		return
+	}
+
+	opts := services.OrgOnboardingOptions{
+		Mode:           orgonboarding.Mode(request.Mode),
+		MemberRoleName: request.MemberRoleName,
+		ExternalID:     common.ExternalID,
+		Region:         request.Region,
+		Regions:        request.Regions,
+		RequestedBy:    common.UserID(c),
+	}
+	if request.ExternalID != nil && *request.ExternalID != "" {
+		opts.ExternalID = *request.ExternalID
+	}
+
+	service, err := services.NewOrganizationsService(c.Request.Context(), common.TenantID(c))
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	onboarding, err := service.Onboard(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to onboard organization: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"onboarding": onboarding, "success": true})
+}
+
+// ListOrgOnboardingsHandler returns the caller's organization onboardings, newest first
+func ListOrgOnboardingsHandler(c *gin.Context) {
+	store := orgonboarding.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "organization onboarding is not initialized", "success": false})
+		return
+	}
+
+	list, err := store.List(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"onboardings": list, "success": true})
+}
+
+// GetOrgOnboardingHandler returns an organization onboarding with the status of each member
+// account and a count of accounts per status
+func GetOrgOnboardingHandler(c *gin.Context) {
+	progress, err := services.GetOrgOnboardingProgress(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if errors.Is(err, orgonboarding.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"progress": progress, "success": true})
+}
+
+// GetSetupJobHandler returns an account setup job with the progress of each setup step.
+// Only the tenant being set up can see its job.
+func GetSetupJobHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	job, err := manager.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && (job.Type != services.JobTypeAccountSetup || (common.TenantID(c) != "" && job.TenantID != common.TenantID(c))) {
+		err = jobsvc.ErrNotFound
+	}
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "success": true})
+}
+
+// GetTenantHandler returns the calling tenant's onboarding record and setup status
+func GetTenantHandler(c *gin.Context) {
+	manager := tenants.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "tenant manager is not initialized", "success": false})
+		return
+	}
+
+	tenant, err := manager.Get(c.Request.Context(), common.TenantID(c))
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenant": tenant, "success": true})
+}
+
+// ListTenantsHandler returns every onboarded account and its setup status
+func ListTenantsHandler(c *gin.Context) {
+	manager := tenants.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "tenant manager is not initialized", "success": false})
+		return
+	}
+
+	list, err := manager.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": list, "success": true})
+}
+
+// TeardownHandler removes every resource setup created in the tenant's account and reports
+// what was removed or skipped. ?retainLogs=true keeps the CloudTrail log bucket. It responds
+// 409 while the account is being set up, and 207 when some resources could not be removed.
+func TeardownHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS resources were removed", "demo": true, "success": true})
+		return
+	}
+
+	tenantID := common.TenantID(c)
+	if manager := tenants.Default(); manager != nil {
+		tenant, err := manager.Get(c.Request.Context(), tenantID)
+		if err != nil && !errors.Is(err, tenants.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		if tenant != nil && tenant.SetupActive() {
+			c.JSON(http.StatusConflict, gin.H{"error": tenants.ErrSetupInProgress.Error(), "success": false})
+			return
+		}
+	}
+
+	opts := services.TeardownOptions{RetainLogs: c.Query("retainLogs") == "true"}
+	service, err := services.NewTeardownService(c.Request.Context(), tenantID)
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	report, err := service.Teardown(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Teardown failed: %v", err), "success": false})
+		return
+	}
+
+	status := http.StatusOK
+	if !report.Complete {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"teardown": report, "success": report.Complete})
+}
+
+// LogRetentionRequest sets how long the account's CloudTrail and AWS Config logs are kept
+type LogRetentionRequest struct {
+	// RetentionDays of 0 keeps logs indefinitely
+	RetentionDays *int `json:"retentionDays" binding:"required,min=0,max=3653"`
+}
+
+// UpdateLogRetentionHandler changes the lifecycle of the tenant's log bucket and the retention
+// of its log group, and keeps the new retention for later setups
+func UpdateLogRetentionHandler(c *gin.Context) {
+	var request LogRetentionRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: log retention was not changed", "demo": true, "success": true})
+		return
+	}
+
+	retention, err := services.UpdateLogRetention(c.Request.Context(), common.TenantID(c), *request.RetentionDays)
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to update log retention: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"retention": retention, "success": true})
+}
+
+// MonitoredRegionsRequest sets the regions the account's events are collected from
+type MonitoredRegionsRequest struct {
+	Regions []string `json:"regions" binding:"omitempty,dive,awsregion"`
+	// AllRegions monitors every region enabled in the account instead of Regions
+	AllRegions bool `json:"allRegions" binding:"excluded_with=Regions"`
+}
+
+// UpdateMonitoredRegionsHandler creates EventBridge rules in regions added to the tenant's
+// monitored regions and deletes them from regions removed, without running setup again
+func UpdateMonitoredRegionsHandler(c *gin.Context) {
+	var request MonitoredRegionsRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: monitored regions were not changed", "demo": true, "success": true})
+		return
+	}
+
+	regions, err := services.UpdateMonitoredRegions(c.Request.Context(), common.TenantID(c), request.Regions, request.AllRegions)
+	if errors.Is(err, tenants.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	var regionsErr *services.RegionsNotEnabledError
+	if errors.As(err, &regionsErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "disabledRegions": regionsErr.Regions, "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to update monitored regions: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"regions": regions, "success": true})
+}
+
+// EventSubscriptionRequest sets the events the account's EventBridge rules send CloudLoom
+type EventSubscriptionRequest struct {
+	Services       []string `json:"services" binding:"omitempty,dive,required"`
+	EventNames     []string `json:"eventNames" binding:"omitempty,dive,required"`
+	FindingSources []string `json:"findingSources" binding:"omitempty,dive,oneof=securityhub guardduty config"`
+	MinSeverity    string   `json:"minSeverity" binding:"omitempty,oneof=informational low medium high critical"`
+	Regions        []string `json:"regions" binding:"omitempty,dive,awsregion"`
+}
+
+// GetEventSubscriptionHandler returns the tenant's event subscription and the EventBridge
+// pattern built from it
+func GetEventSubscriptionHandler(c *gin.Context) {
+	subscription, err := services.GetEventSubscription(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load event subscription: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscription": subscription, "success": true})
+}
+
+// PutEventSubscriptionHandler saves the tenant's event subscription and updates the pattern of
+// its EventBridge rules in every monitored region
+func PutEventSubscriptionHandler(c *gin.Context) {
+	var request EventSubscriptionRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+	updateEventSubscription(c, &eventsubscriptions.Subscription{
+		Services:       request.Services,
+		EventNames:     request.EventNames,
+		FindingSources: request.FindingSources,
+		MinSeverity:    request.MinSeverity,
+		Regions:        request.Regions,
+	})
+}
+
+// DeleteEventSubscriptionHandler returns the tenant to the default event subscription and
+// updates its EventBridge rules to match
+func DeleteEventSubscriptionHandler(c *gin.Context) {
+	updateEventSubscription(c, nil)
+}
+
+func updateEventSubscription(c *gin.Context, subscription *eventsubscriptions.Subscription) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: the event subscription was not changed", "demo": true, "success": true})
+		return
+	}
+
+	update, err := services.UpdateEventSubscription(c.Request.Context(), common.TenantID(c), subscription)
+	if errors.Is(err, eventsubscriptions.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to update event subscription: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscription": update, "success": true})
+}
+
+// GetSetupStatusHandler checks against AWS whether each component setup created in the
+// tenant's account is still working, and returns their health
+func GetSetupStatusHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS account to check", "demo": true, "success": true})
+		return
+	}
+
+	status, err := services.GetSetupStatus(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to check setup status: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "success": true})
+}
+
+// GetRolePolicyAuditHandler reports every role CloudLoom created in the tenant's account that
+// is granted more than it needs
+func GetRolePolicyAuditHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS account to audit", "demo": true, "success": true})
+		return
+	}
+
+	audit, err := services.AuditRolePolicies(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to audit role policies: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"audit": audit, "success": true})
+}
+
+// GetDesiredStateHandler returns the tenant's desired account configuration and the outcome
+// of its last reconciliation
+func GetDesiredStateHandler(c *gin.Context) {
+	store := accountconfig.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "account configuration store is not initialized", "success": false})
+		return
+	}
+
+	state, err := store.Get(c.Request.Context(), common.TenantID(c))
+	if errors.Is(err, accountconfig.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"state": state, "success": true})
+}
+
+// PutDesiredStateHandler replaces the tenant's desired regions, Config rules, notification
+// channels and recorder settings and reconciles the account to match. Calling it again with the same spec is a no-op.
+// It responds 207 when some items could not be reconciled.
+func PutDesiredStateHandler(c *gin.Context) {
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	var spec accountconfig.Spec
+	if !common.BindJSON(c, &spec) {
+		return
+	}
+
+	state, err := services.ApplyAccountConfig(c.Request.Context(), tenantID, spec)
+	if errors.Is(err, accountconfig.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	status := http.StatusOK
+	if !state.Converged {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"state": state, "success": state.Converged})
+}
+
+// GetRecorderHandler returns the resource types and recording frequency the tenant's AWS Config
+// recorder is set to record. An empty recorder means every supported type is recorded.
+func GetRecorderHandler(c *gin.Context) {
+	store := accountconfig.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "account configuration store is not initialized", "success": false})
+		return
+	}
+
+	recorder := &accountconfig.Recorder{}
+	state, err := store.Get(c.Request.Context(), common.TenantID(c))
+	if err != nil && !errors.Is(err, accountconfig.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if state != nil && state.Spec.Recorder != nil {
+		recorder = state.Spec.Recorder
+	}
+	c.JSON(http.StatusOK, gin.H{"recorder": recorder, "success": true})
+}
+
+// PutRecorderHandler sets the resource types the AWS Config recorder includes or excludes, and
+// its recording frequency, then reconciles the recorder in every desired region. The rest of
+// the tenant's desired state is kept as it is.
+func PutRecorderHandler(c *gin.Context) {
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+	store := accountconfig.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "account configuration store is not initialized", "success": false})
+		return
+	}
+
+	var recorder accountconfig.Recorder
+	if !common.BindJSON(c, &recorder) {
+		return
+	}
+
+	var spec accountconfig.Spec
+	state, err := store.Get(c.Request.Context(), tenantID)
+	if err == nil {
+		spec = state.Spec
+	} else if !errors.Is(err, accountconfig.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	spec.Recorder = &recorder
+
+	state, err = services.ApplyAccountConfig(c.Request.Context(), tenantID, spec)
+	if errors.Is(err, accountconfig.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	status := http.StatusOK
+	if !state.Converged {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"state": state, "success": state.Converged})
+}
+
+// SubscriptionRequest subscribes an endpoint to the tenant's notification topic
+type SubscriptionRequest struct {
+	// Endpoint is an email address or an HTTPS URL
+	Endpoint string `json:"endpoint" binding:"required"`
+}
+
+// ListSubscriptionsHandler returns the endpoints subscribed to the tenant's notification topic
+func ListSubscriptionsHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"subscriptions": []services.NotificationSubscription{}, "demo": true, "success": true})
+		return
+	}
+
+	subscriptions, err := services.ListNotificationSubscriptions(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to list subscriptions: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions, "success": true})
+}
+
+// CreateSubscriptionHandler subscribes an email address or HTTPS URL to the tenant's
+// notification topic. The endpoint receives a confirmation request and gets nothing until it
+// confirms.
+func CreateSubscriptionHandler(c *gin.Context) {
+	var request SubscriptionRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: nothing was subscribed", "demo": true, "success": true})
+		return
+	}
+
+	subscription, err := services.SubscribeNotificationEndpoint(c.Request.Context(), common.TenantID(c), request.Endpoint)
+	if errors.Is(err, services.ErrInvalidEndpoint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to subscribe: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"subscription": subscription, "success": true})
+}
+
+// DeleteSubscriptionHandler removes a confirmed subscription from the tenant's notification
+// topic. The subscription ARN is passed as ?arn= since it contains colons.
+func DeleteSubscriptionHandler(c *gin.Context) {
+	arn := c.Query("arn")
+	if arn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "arn is required", "success": false})
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: nothing was unsubscribed", "demo": true, "success": true})
+		return
+	}
+
+	err := services.UnsubscribeNotificationEndpoint(c.Request.Context(), common.TenantID(c), arn)
+	if errors.Is(err, services.ErrSubscriptionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to unsubscribe: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// configRuleError writes the response for a Config rule manager error
+func configRuleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidConfigRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrConfigRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrConfigRuleExists), errors.Is(err, services.ErrConfigRuleNotManaged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to manage Config rules: %v", err), "success": false})
+	}
+}
+
+// configRuleManager returns the tenant's Config rule manager, or writes the response if
+// there is no account to manage
+func configRuleManager(c *gin.Context) (*services.ConfigRuleManager, bool) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS account to manage Config rules in", "demo": true, "success": true})
+		return nil, false
+	}
+	manager, err := services.ConfigRuleManagerFor(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		configRuleError(c, err)
+		return nil, false
+	}
+	return manager, true
+}
+
+// GetConfigRuleCatalogHandler lists the AWS managed Config rules tenants can create, with the
+// parameters each accepts
+func GetConfigRuleCatalogHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"catalog": services.ManagedRuleCatalog(), "success": true})
+}
+
+// ListConfigRulesHandler lists the Config rules in the tenant's account
+func ListConfigRulesHandler(c *gin.Context) {
+	manager, ok := configRuleManager(c)
+	if !ok {
+		return
+	}
+	rules, err := manager.List(c.Request.Context())
+	if err != nil {
+		configRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "success": true})
+}
+
+// CreateConfigRuleHandler creates a Config rule from the managed rule catalog
+func CreateConfigRuleHandler(c *gin.Context) {
+	var spec services.ConfigRuleSpec
+	if !common.BindJSON(c, &spec) {
+		return
+	}
+	manager, ok := configRuleManager(c)
+	if !ok {
+		return
+	}
+	rule, err := manager.Create(c.Request.Context(), spec)
+	if err != nil {
+		configRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rule": rule, "success": true})
+}
+
+// UpdateConfigRuleHandler replaces the source, parameters and schedule of a Config rule
+// CloudLoom created
+func UpdateConfigRuleHandler(c *gin.Context) {
+	var spec services.ConfigRuleSpec
+	if !common.BindJSON(c, &spec) {
+		return
+	}
+	spec.Name = c.Param("name")
+	manager, ok := configRuleManager(c)
+	if !ok {
+		return
+	}
+	rule, err := manager.Update(c.Request.Context(), spec)
+	if err != nil {
+		configRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rule": rule, "success": true})
+}
+
+// DeleteConfigRuleHandler deletes a Config rule CloudLoom created
+func DeleteConfigRuleHandler(c *gin.Context) {
+	manager, ok := configRuleManager(c)
+	if !ok {
+		return
+	}
+	if err := manager.Delete(c.Request.Context(), c.Param("name")); err != nil {
+		configRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetPollerHandler reports whether an SQS poller runs for the tenant's event queue on this server
+func GetPollerHandler(c *gin.Context) {
+	poller, running := pollers.Default().Get(common.TenantID(c))
+	if !running {
+		c.JSON(http.StatusOK, gin.H{"running": false, "success": true})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"running": true, "poller": poller, "success": true})
+}
+
+// ListPollersHandler lists the SQS pollers running on this server for every tenant
+func ListPollersHandler(c *gin.Context) {
+	running := pollers.Default().List()
+	c.JSON(http.StatusOK, gin.H{"pollers": running, "count": len(running), "success": true})
+}
+
+// StopPollerHandler stops the tenant's SQS poller once it finishes the messages in hand
+func StopPollerHandler(c *gin.Context) {
+	stopped := pollers.Default().Stop(common.TenantID(c))
+	c.JSON(http.StatusOK, gin.H{"stopped": stopped, "success": true})
+}
+
+// RestartPollerHandler replaces the tenant's SQS poller with one using fresh credentials, or
+// starts one if none runs
+func RestartPollerHandler(c *gin.Context) {
+	poller, err := services.RestartPolling(c.Request.Context(), common.TenantID(c))
+	switch {
+	case errors.Is(err, services.ErrDemoMode), errors.Is(err, pollers.ErrShuttingDown):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrNoEventQueue):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to restart polling: %v", err), "success": false})
+	default:
+		c.JSON(http.StatusOK, gin.H{"poller": poller, "success": true})
+	}
+}
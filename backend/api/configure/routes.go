@@ -1,7 +1,38 @@
 package configure
 
-import "github.com/gin-gonic/gin"
+import "github.com/rishichirchi/cloudloom/common"
 
-func SetupConfigureRoutes(router *gin.RouterGroup) {
-	router.POST("/setup-cloudtrail", SetupCloudTrailHandler)
+func SetupConfigureRoutes(router common.Router) {
+	router.POST("/setup-cloudtrail", "", SetupCloudTrailHandler)
+	router.POST("/validate", "validation", ValidatePermissionsHandler)
+	router.GET("/jobs/:id", "job", GetSetupJobHandler)
+	router.GET("/tenant", "tenant", GetTenantHandler)
+	router.GET("/tenants", "tenants", common.RequireAdminToken(), ListTenantsHandler)
+	router.DELETE("/teardown", "teardown", common.RequireAdminToken(), TeardownHandler)
+	router.PUT("/log-retention", "retention", UpdateLogRetentionHandler)
+	router.PUT("/regions", "regions", UpdateMonitoredRegionsHandler)
+	router.GET("/event-subscriptions", "subscription", GetEventSubscriptionHandler)
+	router.PUT("/event-subscriptions", "subscription", PutEventSubscriptionHandler)
+	router.DELETE("/event-subscriptions", "subscription", DeleteEventSubscriptionHandler)
+	router.GET("/status", "status", GetSetupStatusHandler)
+	router.GET("/poller", "", GetPollerHandler)
+	router.GET("/pollers", "pollers", common.RequireAdminToken(), ListPollersHandler)
+	router.POST("/poller/stop", "", common.RequireAdminToken(), StopPollerHandler)
+	router.POST("/poller/restart", "poller", common.RequireAdminToken(), RestartPollerHandler)
+	router.GET("/role-policies", "audit", GetRolePolicyAuditHandler)
+	router.GET("/notifications/subscriptions", "subscriptions", ListSubscriptionsHandler)
+	router.POST("/notifications/subscriptions", "subscription", CreateSubscriptionHandler)
+	router.DELETE("/notifications/subscriptions", "", DeleteSubscriptionHandler)
+	router.GET("/desired-state", "state", GetDesiredStateHandler)
+	router.PUT("/desired-state", "state", PutDesiredStateHandler)
+	router.GET("/recorder", "recorder", GetRecorderHandler)
+	router.PUT("/recorder", "state", PutRecorderHandler)
+	router.GET("/config-rules/catalog", "catalog", GetConfigRuleCatalogHandler)
+	router.GET("/config-rules", "rules", ListConfigRulesHandler)
+	router.POST("/config-rules", "rule", CreateConfigRuleHandler)
+	router.PUT("/config-rules/:name", "rule", UpdateConfigRuleHandler)
+	router.DELETE("/config-rules/:name", "", DeleteConfigRuleHandler)
+	router.POST("/organization/onboard", "onboarding", OnboardOrganizationHandler)
+	router.GET("/organization/onboardings", "onboardings", ListOrgOnboardingsHandler)
+	router.GET("/organization/onboardings/:id", "progress", GetOrgOnboardingHandler)
 }
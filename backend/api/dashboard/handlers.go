@@ -0,0 +1,144 @@
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/api/infrastructure"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/cache"
+	findingsvc "github.com/rishichirchi/cloudloom/services/findings"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// recentFixesLimit is the number of recently resolved findings shown on the dashboard
+const recentFixesLimit = 10
+
+// InventoryStats are the dashboard numbers derived from one inventory scan
+type InventoryStats struct {
+	SnapshotID      string         `json:"snapshotId"`
+	ScannedAt       *time.Time     `json:"scannedAt,omitempty"`
+	TotalResources  int            `json:"totalResources"`
+	ResourcesByType map[string]int `json:"resourcesByType"`
+	// ComplianceScore is the percentage of compliant AWS Config evaluations, or nil when nothing was evaluated
+	ComplianceScore   *float64 `json:"complianceScore"`
+	CompliantCount    int      `json:"compliantCount"`
+	NonCompliantCount int      `json:"nonCompliantCount"`
+}
+
+// Response is everything the dashboard renders, in a single payload
+type Response struct {
+	OpenFindingsBySeverity map[string]int64                      `json:"openFindingsBySeverity"`
+	OpenFindings           int64                                 `json:"openFindings"`
+	Inventory              *InventoryStats                       `json:"inventory"`
+	RecentFixes            []findingsvc.Finding                  `json:"recentFixes"`
+	AccountHealth          *infrastructure.AccountHealthResponse `json:"accountHealth"`
+	GeneratedAt            time.Time                             `json:"generatedAt"`
+}
+
+// inventoryStats loads the stats of the tenant's latest inventory scan, computing them once
+// per snapshot since decoding the scan result is the expensive part of the dashboard
+func inventoryStats(ctx context.Context, tenantID string) (*InventoryStats, bool, error) {
+	manager := jobsvc.Default()
+	latest, err := manager.Latest(ctx, services.JobTypeInventoryScan, tenantID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	stats := &InventoryStats{}
+	key := cache.TenantKey(tenantID, latest.ID.Hex(), "dashboard-inventory")
+	if cache.GetJSON(ctx, key, stats) {
+		return stats, true, nil
+	}
+
+	var inventory services.ResourceInventory
+	if err := manager.DecodeResult(ctx, latest.ID.Hex(), &inventory); err != nil {
+		return nil, false, err
+	}
+	stats.SnapshotID = latest.ID.Hex()
+	stats.ScannedAt = latest.FinishedAt
+	stats.TotalResources = inventory.ResourceSummary.TotalResources
+	stats.ResourcesByType = inventory.ResourceSummary.ResourcesByType
+	if stats.ResourcesByType == nil {
+		stats.ResourcesByType = map[string]int{}
+	}
+	for _, rule := range inventory.ComplianceRules {
+		for _, eval := range rule.EvaluationResults {
+			switch eval.ComplianceType {
+			case "COMPLIANT":
+				stats.CompliantCount++
+			case "NON_COMPLIANT":
+				stats.NonCompliantCount++
+			}
+		}
+	}
+	if evaluated := stats.CompliantCount + stats.NonCompliantCount; evaluated > 0 {
+		score := float64(stats.CompliantCount) * 100 / float64(evaluated)
+		stats.ComplianceScore = &score
+	}
+
+	cache.SetJSON(ctx, key, stats)
+	return stats, false, nil
+}
+
+// GetDashboardHandler returns the tenant's dashboard numbers in one call: open findings by
+// severity, compliance score and resources by type from the latest scan, recently fixed
+// findings and account health
+func GetDashboardHandler(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+	store := findingsvc.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "findings store is not initialized", "success": false})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	response := Response{GeneratedAt: time.Now()}
+
+	inventory, hit, err := inventoryStats(ctx, tenantID)
+	if err != nil && !errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	response.Inventory = inventory
+
+	if response.OpenFindingsBySeverity, err = store.CountOpenBySeverity(ctx, tenantID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	for _, count := range response.OpenFindingsBySeverity {
+		response.OpenFindings += count
+	}
+
+	if response.RecentFixes, err = store.RecentlyResolved(ctx, tenantID, recentFixesLimit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	health, healthHit, err := infrastructure.BuildAccountHealth(ctx, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	response.AccountHealth = health
+
+	if hit && healthHit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.JSON(http.StatusOK, gin.H{"dashboard": response, "success": true})
+}
@@ -0,0 +1,8 @@
+package dashboard
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupDashboardRoutes sets up the dashboard summary route
+func SetupDashboardRoutes(router common.Router) {
+	router.GET("", "dashboard", GetDashboardHandler)
+}
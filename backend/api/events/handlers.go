@@ -0,0 +1,185 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/deadletters"
+	"github.com/rishichirchi/cloudloom/services/events"
+)
+
+// batchRequest selects the events or dead letters to replay or redrive
+type batchRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// writeBatchResult responds 200 when every item succeeded, 207 Multi-Status on partial failure,
+// and an error status when the batch could not run at all
+func writeBatchResult(c *gin.Context, result *services.EventBatchResult, err error) {
+	switch {
+	case errors.Is(err, services.ErrDemoMode):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"succeeded":      result.Succeeded,
+		"failed":         result.Failed,
+		"succeededCount": len(result.Succeeded),
+		"failedCount":    len(result.Failed),
+		"success":        len(result.Failed) == 0,
+	})
+}
+
+func requireEventStore(c *gin.Context) *events.Store {
+	store := events.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event store is not initialized", "success": false})
+	}
+	return store
+}
+
+// ListEventsHandler lists the tenant's stored events, most recent first, optionally filtered
+// by source, detailType, processing status and a from/to range of RFC3339 event times
+func ListEventsHandler(c *gin.Context) {
+	store := requireEventStore(c)
+	if store == nil {
+		return
+	}
+
+	filter := events.Filter{
+		TenantID:   common.TenantID(c),
+		Source:     c.Query("source"),
+		DetailType: c.Query("detailType"),
+		Status:     events.ProcessingStatus(c.Query("status")),
+	}
+	if filter.Status != "" && filter.Status != events.ProcessingSucceeded && filter.Status != events.ProcessingFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be succeeded or failed", "success": false})
+		return
+	}
+	for param, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param), "success": false})
+				return
+			}
+			*dst = t
+		}
+	}
+
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	result, err := store.List(c.Request.Context(), filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": result, "count": len(result), "success": true})
+}
+
+// GetEventHandler returns one stored event with its message body as received
+func GetEventHandler(c *gin.Context) {
+	store := requireEventStore(c)
+	if store == nil {
+		return
+	}
+
+	event, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if errors.Is(err, events.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event": event, "success": true})
+}
+
+// ReplayEventsHandler runs selected stored events through the event handlers again
+func ReplayEventsHandler(c *gin.Context) {
+	var req batchRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	result, err := services.ReplayEvents(c.Request.Context(), common.TenantID(c), req.IDs)
+	writeBatchResult(c, result, err)
+}
+
+// ListDeadLettersHandler lists the messages the tenant's queue dead-lettered, optionally only
+// those of a ?status= of pending or redriven
+func ListDeadLettersHandler(c *gin.Context) {
+	store := deadletters.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "dead letter store is not initialized", "success": false})
+		return
+	}
+
+	status := deadletters.Status(c.Query("status"))
+	if status != "" && status != deadletters.StatusPending && status != deadletters.StatusRedriven {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending or redriven", "success": false})
+		return
+	}
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	letters, err := store.List(c.Request.Context(), deadletters.ListFilter{
+		TenantID: common.TenantID(c),
+		Status:   status,
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deadLetters": letters, "count": len(letters), "success": true})
+}
+
+// RedriveDeadLettersHandler sends selected dead letters back to the tenant's queue
+func RedriveDeadLettersHandler(c *gin.Context) {
+	var req batchRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	result, err := services.RedriveDeadLetters(c.Request.Context(), common.TenantID(c), req.IDs)
+	writeBatchResult(c, result, err)
+}
+
+// GetRuleHealthHandler checks that each of the tenant's EventBridge rules still exists, is
+// enabled, targets the CloudLoom queue and is admitted by the queue policy. Drifted rules are
+// recorded as findings.
+func GetRuleHealthHandler(c *gin.Context) {
+	writeRuleHealth(c, false)
+}
+
+// HealRulesHandler checks the tenant's EventBridge rules like GetRuleHealthHandler and puts
+// drifted ones back as setup created them
+func HealRulesHandler(c *gin.Context) {
+	writeRuleHealth(c, true)
+}
+
+func writeRuleHealth(c *gin.Context, heal bool) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no AWS account to check", "demo": true, "success": true})
+		return
+	}
+	health, err := services.CheckRuleHealth(c.Request.Context(), common.TenantID(c), heal)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to check EventBridge rules: %v", err), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"health": health, "success": true})
+}
@@ -0,0 +1,14 @@
+package events
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupEventRoutes sets up the routes of the events received on the tenant's queue
+func SetupEventRoutes(router common.Router) {
+	router.GET("", "events", ListEventsHandler)
+	router.POST("/replay", "", common.RequireAdminToken(), ReplayEventsHandler)
+	router.GET("/dead-letters", "deadLetters", ListDeadLettersHandler)
+	router.POST("/dead-letters/redrive", "", common.RequireAdminToken(), RedriveDeadLettersHandler)
+	router.GET("/health", "health", GetRuleHealthHandler)
+	router.POST("/health/heal", "health", common.RequireAdminToken(), HealRulesHandler)
+	router.GET("/:id", "event", GetEventHandler)
+}
@@ -0,0 +1,341 @@
+package exports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/events"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
+	flushEvery      = 100
+)
+
+// maxStreamItems is the hard cap on items in a single streamed export (EXPORT_MAX_ITEMS)
+var maxStreamItems = exportCapFromEnv()
+
+func exportCapFromEnv() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("EXPORT_MAX_ITEMS"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 100000
+}
+
+// cursorSource opens a cursor over the items of an export starting at skip.
+// A limit of 0 means no limit.
+type cursorSource func(ctx context.Context, skip, limit int64) (*mongo.Cursor, error)
+
+// itemDecoder decodes the item under the cursor into the value written to the export
+type itemDecoder func(cursor *mongo.Cursor) (interface{}, error)
+
+// decodeDocument exports items as they are stored
+func decodeDocument(cursor *mongo.Cursor) (interface{}, error) {
+	var item bson.M
+	err := cursor.Decode(&item)
+	return item, err
+}
+
+// serveExport streams the export as chunked NDJSON, or returns a single page with a
+// Link header when the client asks for pagination (?limit=, ?offset= or ?stream=false)
+func serveExport(c *gin.Context, name string, source cursorSource, decode itemDecoder) {
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer", "success": false})
+		return
+	}
+
+	_, paged := c.GetQuery("limit")
+	if c.Query("stream") == "false" {
+		paged = true
+	}
+	if paged {
+		servePage(c, source, decode, offset)
+		return
+	}
+	streamExport(c, name, source, decode, offset)
+}
+
+// servePage returns one page of items and links to the next page
+func servePage(c *gin.Context, source cursorSource, decode itemDecoder, offset int64) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer", "success": false})
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	ctx := c.Request.Context()
+	// Fetch one extra item to find out whether there is a next page
+	cursor, err := source(ctx, offset, limit+1)
+	if err != nil {
+		writeSourceError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	items := []interface{}{}
+	for cursor.Next(ctx) {
+		item, err := decode(cursor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		items = append(items, item)
+	}
+	if err := cursor.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	if int64(len(items)) > limit {
+		items = items[:limit]
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", pageURL(c, offset+limit, limit)))
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		c.Writer.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"prev\"", pageURL(c, prev, limit)))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items), "offset": offset, "success": true})
+}
+
+// streamExport writes items as newline-delimited JSON, flushing as it goes so the
+// export is never held in memory. If the hard cap is reached, the last line links to the rest.
+func streamExport(c *gin.Context, name string, source cursorSource, decode itemDecoder, offset int64) {
+	ctx := c.Request.Context()
+	cursor, err := source(ctx, offset, maxStreamItems+1)
+	if err != nil {
+		writeSourceError(c, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	filename := fmt.Sprintf("%s-%s.ndjson", name, time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Export-Max-Items", strconv.FormatInt(maxStreamItems, 10))
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	var written int64
+	for cursor.Next(ctx) {
+		if written == maxStreamItems {
+			encoder.Encode(gin.H{
+				"truncated": true,
+				"maxItems":  maxStreamItems,
+				"next":      pageURL(c, offset+written, maxPageSize),
+			})
+			log.Printf("[Export] %s export truncated at %d items", name, maxStreamItems)
+			break
+		}
+
+		item, err := decode(cursor)
+		if err != nil {
+			log.Printf("[Export] Warning: failed to decode %s item: %v", name, err)
+			continue
+		}
+		if err := encoder.Encode(item); err != nil {
+			// Client went away
+			log.Printf("[Export] %s export aborted after %d items: %v", name, written, err)
+			return
+		}
+		written++
+		if written%flushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("[Export] %s export stopped after %d items: %v", name, written, err)
+	}
+	c.Writer.Flush()
+}
+
+// pageURL returns the current request URL with offset and limit replaced
+func pageURL(c *gin.Context, offset, limit int64) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("offset", strconv.FormatInt(offset, 10))
+	query.Set("limit", strconv.FormatInt(limit, 10))
+	query.Del("stream")
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+func writeSourceError(c *gin.Context, err error) {
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+}
+
+// snapshotJob resolves the inventory scan to export: ?snapshotId= or the tenant's latest scan
+func snapshotJob(c *gin.Context) (*jobsvc.Job, error) {
+	manager := jobsvc.Default()
+	tenantID := common.TenantID(c)
+
+	snapshotID := c.Query("snapshotId")
+	if snapshotID == "" {
+		return manager.Latest(c.Request.Context(), services.JobTypeInventoryScan, tenantID)
+	}
+
+	job, err := manager.Get(c.Request.Context(), snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Type != services.JobTypeInventoryScan || job.TenantID != tenantID || job.Status != jobsvc.StatusSucceeded {
+		return nil, jobsvc.ErrNotFound
+	}
+	return job, nil
+}
+
+// exportScanField exports the elements of one array in an inventory scan result, reduced to
+// the ?fields= selection if given. Scan results are stored with lowercased keys, so each
+// element is decoded into T and exported with the same field names as /inventory/export.
+// Only T's top-level JSON fields may be selected.
+func exportScanField[T any](c *gin.Context, name, field string) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	fields := common.Fields(c)
+	columns := exportColumns[T]()
+	for _, f := range fields {
+		if !columns[f] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown field %q", f), "success": false})
+			return
+		}
+	}
+
+	job, err := snapshotJob(c)
+	if err != nil {
+		writeSourceError(c, err)
+		return
+	}
+	c.Header("X-Snapshot-ID", job.ID.Hex())
+
+	serveExport(c, name, func(ctx context.Context, skip, limit int64) (*mongo.Cursor, error) {
+		return jobsvc.Default().ResultItems(ctx, job.ID.Hex(), field, skip, limit, nil)
+	}, func(cursor *mongo.Cursor) (interface{}, error) {
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		return selectFields(item, fields)
+	})
+}
+
+// exportColumns returns the top-level JSON field names of T
+func exportColumns[T any]() map[string]bool {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	columns := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		columns[name] = true
+	}
+	return columns
+}
+
+// selectFields reduces item to the given top-level JSON fields, or returns it unchanged when
+// fields is empty
+func selectFields(item interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return item, nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := row[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// ExportInventoryHandler exports every resource of an inventory scan
+func ExportInventoryHandler(c *gin.Context) {
+	exportScanField[services.ConfigurationItem](c, "inventory", "resources")
+}
+
+// ExportComplianceReportHandler exports the compliance rules and evaluation results of an inventory scan
+func ExportComplianceReportHandler(c *gin.Context) {
+	exportScanField[services.ComplianceRule](c, "compliance-report", "compliancerules")
+}
+
+// ExportWAFReportHandler exports the WAF web ACL and Shield Advanced coverage of every
+// internet-facing resource in an inventory scan
+func ExportWAFReportHandler(c *gin.Context) {
+	exportScanField[services.EdgeProtection](c, "waf-report", "edgeprotection")
+}
+
+// ExportPublicExposureHandler exports the internet-reachable APIs of an inventory scan with
+// their unauthenticated routes, open resource policies and logging status
+func ExportPublicExposureHandler(c *gin.Context) {
+	exportScanField[services.ExposedEndpoint](c, "public-exposure", "publicexposure")
+}
+
+// ExportEventsHandler exports the tenant's stored CloudTrail events, optionally filtered
+// by source and an RFC3339 from/to time range
+func ExportEventsHandler(c *gin.Context) {
+	store := events.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event store is not initialized", "success": false})
+		return
+	}
+
+	filter := events.Filter{TenantID: common.TenantID(c), Source: c.Query("source")}
+	for param, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param), "success": false})
+				return
+			}
+			*dst = t
+		}
+	}
+
+	serveExport(c, "events", func(ctx context.Context, skip, limit int64) (*mongo.Cursor, error) {
+		return store.Cursor(ctx, filter, skip, limit)
+	}, decodeDocument)
+}
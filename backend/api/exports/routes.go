@@ -0,0 +1,16 @@
+package exports
+
+import (
+	"net/http"
+
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// SetupExportRoutes sets up the streamed/paginated export routes
+func SetupExportRoutes(router common.Router) {
+	router.Raw(http.MethodGet, "/inventory", ExportInventoryHandler)
+	router.Raw(http.MethodGet, "/compliance-report", ExportComplianceReportHandler)
+	router.Raw(http.MethodGet, "/waf-report", ExportWAFReportHandler)
+	router.Raw(http.MethodGet, "/public-exposure", ExportPublicExposureHandler)
+	router.Raw(http.MethodGet, "/events", ExportEventsHandler)
+}
@@ -0,0 +1,442 @@
+package findings
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	findingsvc "github.com/rishichirchi/cloudloom/services/findings"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+type bulkStatusRequest struct {
+	FindingIDs []string `json:"findingIds" binding:"required,min=1,max=1000"`
+	Status     string   `json:"status" binding:"required,oneof=open acknowledged resolved suppressed"`
+	Reason     string   `json:"reason"`
+}
+
+type bulkSuppressRequest struct {
+	FindingIDs []string   `json:"findingIds" binding:"required,min=1,max=1000"`
+	Reason     string     `json:"reason" binding:"required"`
+	Until      *time.Time `json:"until"`
+}
+
+// transitionRequest moves a finding to a new status. Suppressing needs a justification and
+// lasts until suppressedUntil, or until someone reopens the finding when it is left out.
+type transitionRequest struct {
+	Status          string     `json:"status" binding:"required,oneof=open acknowledged resolved suppressed"`
+	Justification   string     `json:"justification"`
+	SuppressedUntil *time.Time `json:"suppressedUntil"`
+}
+
+type assignRequest struct {
+	Assignee string `json:"assignee"`
+}
+
+type bulkExclusionRequest struct {
+	Resources []findingsvc.Exclusion `json:"resources" binding:"required,min=1,max=1000,dive"`
+}
+
+type bulkExclusionDeleteRequest struct {
+	ResourceIDs []string `json:"resourceIds" binding:"required,min=1,max=1000"`
+}
+
+func requireStore(c *gin.Context) *findingsvc.Store {
+	store := findingsvc.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "findings store is not initialized", "success": false})
+	}
+	return store
+}
+
+// writeBulkResult responds 200 when every item succeeded and 207 Multi-Status on partial failure
+func writeBulkResult(c *gin.Context, result *findingsvc.BulkResult) {
+	status := http.StatusOK
+	if len(result.Failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"succeeded":      result.Succeeded,
+		"failed":         result.Failed,
+		"succeededCount": len(result.Succeeded),
+		"failedCount":    len(result.Failed),
+		"success":        len(result.Failed) == 0,
+	})
+}
+
+// ListFindingsHandler lists the tenant's findings, optionally filtered by status, severity,
+// source, resource and assignee and reduced to the ?fields= selection
+func ListFindingsHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	includeExcluded, _ := strconv.ParseBool(c.Query("includeExcluded"))
+	result, err := store.List(c.Request.Context(), findingsvc.ListFilter{
+		TenantID:        common.TenantID(c),
+		Status:          findingsvc.Status(c.Query("status")),
+		Severity:        strings.ToLower(c.Query("severity")),
+		Source:          c.Query("source"),
+		ResourceID:      c.Query("resourceId"),
+		Assignee:        c.Query("assignee"),
+		IncludeExcluded: includeExcluded,
+		Limit:           limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	selected, err := common.SelectFields(result, common.Fields(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"findings": selected, "count": len(result), "success": true})
+}
+
+// GetFindingHandler returns one of the tenant's findings
+func GetFindingHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	finding, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		findingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"finding": finding, "success": true})
+}
+
+// TransitionFindingHandler moves a finding to a new status, recording who moved it
+func TransitionFindingHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req transitionRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	finding, err := store.Transition(c.Request.Context(), common.TenantID(c), c.Param("id"), findingsvc.StatusUpdate{
+		Status:          findingsvc.Status(req.Status),
+		Reason:          req.Justification,
+		SuppressedUntil: req.SuppressedUntil,
+	}, common.UserID(c))
+	if err != nil {
+		findingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"finding": finding, "success": true})
+}
+
+// AssignFindingHandler sets who is working on a finding; an empty assignee unassigns it
+func AssignFindingHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req assignRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	finding, err := store.Assign(c.Request.Context(), common.TenantID(c), c.Param("id"), req.Assignee)
+	if err != nil {
+		findingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"finding": finding, "success": true})
+}
+
+// findingError writes the response for an error changing a single finding
+func findingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, findingsvc.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, findingsvc.ErrInvalid), errors.Is(err, findingsvc.ErrInvalidTransition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, findingsvc.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
+
+// BulkUpdateStatusHandler sets the status of many findings at once
+func BulkUpdateStatusHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req bulkStatusRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	result, err := store.BulkUpdateStatus(c.Request.Context(), common.TenantID(c), req.FindingIDs, findingsvc.StatusUpdate{
+		Status: findingsvc.Status(req.Status),
+		Reason: req.Reason,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	writeBulkResult(c, result)
+}
+
+// BulkSuppressHandler suppresses many findings at once, optionally until a given time
+func BulkSuppressHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req bulkSuppressRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+	if req.Until != nil && req.Until.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future", "success": false})
+		return
+	}
+
+	result, err := store.BulkUpdateStatus(c.Request.Context(), common.TenantID(c), req.FindingIDs, findingsvc.StatusUpdate{
+		Status:          findingsvc.StatusSuppressed,
+		Reason:          req.Reason,
+		SuppressedUntil: req.Until,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	writeBulkResult(c, result)
+}
+
+// ListExclusionsHandler returns the tenant's resource exclusion list
+func ListExclusionsHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	exclusions, err := store.ListExclusions(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exclusions": exclusions, "count": len(exclusions), "success": true})
+}
+
+// BulkAddExclusionsHandler adds many resources to the exclusion list at once
+func BulkAddExclusionsHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req bulkExclusionRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	result, err := store.AddExclusions(c.Request.Context(), common.TenantID(c), req.Resources)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	writeBulkResult(c, result)
+}
+
+// BulkRemoveExclusionsHandler removes many resources from the exclusion list at once
+func BulkRemoveExclusionsHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+
+	var req bulkExclusionDeleteRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	result, err := store.RemoveExclusions(c.Request.Context(), common.TenantID(c), req.ResourceIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	writeBulkResult(c, result)
+}
+
+// streamPingInterval keeps idle connections open through proxies and detects dead clients
+const streamPingInterval = 30 * time.Second
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || common.IsAllowedOrigin(origin)
+	},
+}
+
+// StreamFindingsHandler upgrades to a WebSocket and pushes the tenant's new findings and
+// status changes as JSON messages until the client disconnects. Browsers pass the tenant
+// as the tenantId query parameter.
+func StreamFindingsHandler(c *gin.Context) {
+	store := requireStore(c)
+	if store == nil {
+		return
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	changes, unsubscribe := store.Changes().Subscribe(tenantID, 64)
+	defer unsubscribe()
+	log.Printf("[Findings] Stream opened for tenant %s", tenantID)
+
+	// The client sends nothing, but reading is required to process pongs and close frames
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamPingInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			log.Printf("[Findings] Stream closed for tenant %s", tenantID)
+			return
+		case change := <-changes:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(change); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GetExposureHandler lists the publicly exposed resources of the snapshot named by
+// ?snapshotId=, or of the latest one, optionally only those of ?severity= or ?kind=
+func GetExposureHandler(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	report, err := services.AnalyzeExposure(c.Request.Context(), common.TenantID(c), c.Query("snapshotId"))
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	severity, kind := c.Query("severity"), c.Query("kind")
+	if severity != "" || kind != "" {
+		filtered := []services.ExposureFinding{}
+		for _, finding := range report.Findings {
+			if (severity == "" || finding.Severity == severity) && (kind == "" || finding.Kind == kind) {
+				filtered = append(filtered, finding)
+			}
+		}
+		report.Findings = filtered
+	}
+	c.Header("X-Snapshot-ID", report.Snapshot.ID)
+	c.JSON(http.StatusOK, gin.H{"exposure": report, "count": len(report.Findings), "success": true})
+}
+
+// GetUnusedHandler reports likely wasteful resources in the latest inventory snapshot, or the
+// one given as ?snapshotId=. ?snapshotAgeDays= and ?inactiveDays= change how old a snapshot and
+// how long an IAM user's inactivity must be to be reported; ?kind= filters the findings.
+func GetUnusedHandler(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	analyzer := services.NewUnusedAnalyzer()
+	for param, dst := range map[string]*time.Duration{"snapshotAgeDays": &analyzer.StaleSnapshotAge, "inactiveDays": &analyzer.InactiveUserAge} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a positive integer", "success": false})
+			return
+		}
+		*dst = time.Duration(days) * 24 * time.Hour
+	}
+
+	report, err := services.AnalyzeUnused(c.Request.Context(), common.TenantID(c), c.Query("snapshotId"), analyzer)
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	if kind := c.Query("kind"); kind != "" {
+		filtered := []services.UnusedResource{}
+		for _, finding := range report.Findings {
+			if finding.Kind == kind {
+				filtered = append(filtered, finding)
+			}
+		}
+		report.Findings = filtered
+	}
+	c.Header("X-Snapshot-ID", report.Snapshot.ID)
+	c.JSON(http.StatusOK, gin.H{"unused": report, "count": len(report.Findings), "success": true})
+}
+
+// EnableSecurityHubHandler enables Security Hub in the tenant's account, after which the
+// findings it imports are recorded alongside CloudLoom's own and listed with ?source=securityhub
+func EnableSecurityHubHandler(c *gin.Context) {
+	if err := services.EnableSecurityHub(c.Request.Context(), common.TenantID(c)); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Security Hub is enabled", "success": true})
+}
@@ -0,0 +1,26 @@
+package findings
+
+import (
+	"net/http"
+
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// SetupFindingRoutes sets up the findings triage and bulk operation routes
+func SetupFindingRoutes(router common.Router) {
+	router.GET("", "findings", ListFindingsHandler)
+	router.Raw(http.MethodGet, "/stream", StreamFindingsHandler)
+	router.GET("/exposure", "exposure", GetExposureHandler)
+	router.GET("/unused", "unused", GetUnusedHandler)
+	router.POST("/bulk/status", "", BulkUpdateStatusHandler)
+	router.POST("/bulk/suppress", "", BulkSuppressHandler)
+	router.POST("/securityhub/enable", "", EnableSecurityHubHandler)
+
+	router.GET("/exclusions", "exclusions", ListExclusionsHandler)
+	router.POST("/exclusions/bulk", "", BulkAddExclusionsHandler)
+	router.POST("/exclusions/bulk-delete", "", BulkRemoveExclusionsHandler)
+
+	router.GET("/:id", "finding", GetFindingHandler)
+	router.PATCH("/:id/status", "finding", TransitionFindingHandler)
+	router.PATCH("/:id/assignee", "finding", AssignFindingHandler)
+}
@@ -0,0 +1,37 @@
+package graphql
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// QueryHandler executes a GraphQL query against the tenant's inventory, findings and compliance data
+func QueryHandler(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	var req graphqlRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	// Errors are reported in the response body per the GraphQL over HTTP convention
+	ctx := withState(c.Request.Context(), tenantID)
+	c.JSON(http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
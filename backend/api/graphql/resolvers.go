@@ -0,0 +1,505 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/rishichirchi/cloudloom/services"
+	findingsvc "github.com/rishichirchi/cloudloom/services/findings"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+type stateKey struct{}
+
+// requestState loads the tenant's latest snapshot at most once per query and indexes it for
+// the nested resolvers
+type requestState struct {
+	tenantID string
+
+	once        sync.Once
+	err         error
+	job         *jobsvc.Job
+	inventory   *services.ResourceInventory
+	byID        map[string]*services.ConfigurationItem
+	evaluations map[string][]*evaluationResolver
+
+	iacOnce sync.Once
+	iac     map[string]services.TerraformMapping
+}
+
+func withState(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, stateKey{}, &requestState{tenantID: tenantID})
+}
+
+func stateFrom(ctx context.Context) *requestState {
+	return ctx.Value(stateKey{}).(*requestState)
+}
+
+// snapshot returns the latest inventory, or nil if the tenant has never been scanned
+func (s *requestState) snapshot(ctx context.Context) (*services.ResourceInventory, error) {
+	s.once.Do(func() {
+		var inventory services.ResourceInventory
+		job, err := jobsvc.Default().LatestResult(ctx, services.JobTypeInventoryScan, s.tenantID, &inventory)
+		if errors.Is(err, jobsvc.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		s.job, s.inventory = job, &inventory
+		s.byID = make(map[string]*services.ConfigurationItem, len(inventory.Resources))
+		for i := range inventory.Resources {
+			s.byID[inventory.Resources[i].ResourceID] = &inventory.Resources[i]
+		}
+		s.evaluations = make(map[string][]*evaluationResolver)
+		for _, rule := range inventory.ComplianceRules {
+			for i := range rule.EvaluationResults {
+				eval := &evaluationResolver{ruleName: rule.ConfigRuleName, eval: &rule.EvaluationResults[i]}
+				s.evaluations[eval.eval.ResourceID] = append(s.evaluations[eval.eval.ResourceID], eval)
+			}
+		}
+	})
+	return s.inventory, s.err
+}
+
+// resource resolves a resource ID in the latest snapshot, returning nil if it is not present
+func (s *requestState) resource(ctx context.Context, id string) (*resourceResolver, error) {
+	if _, err := s.snapshot(ctx); err != nil {
+		return nil, err
+	}
+	item, ok := s.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	return &resourceResolver{item: item}, nil
+}
+
+// terraform returns the Terraform mappings, or none if no state file is available
+func (s *requestState) terraform() map[string]services.TerraformMapping {
+	s.iacOnce.Do(func() {
+		s.iac, _ = services.LoadTerraformMappings(services.TerraformStatePath)
+	})
+	return s.iac
+}
+
+func formatTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func pageBounds(first, offset *int32, total int) (int, int) {
+	start, size := 0, 100
+	if offset != nil && *offset > 0 {
+		start = int(*offset)
+	}
+	if first != nil && *first > 0 && *first <= 500 {
+		size = int(*first)
+	}
+	start = min(start, total)
+	return start, min(start+size, total)
+}
+
+type count struct {
+	Key   string
+	Count int32
+}
+
+func counts(m map[string]int) []*count {
+	result := make([]*count, 0, len(m))
+	for k, v := range m {
+		result = append(result, &count{Key: k, Count: int32(v)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+// queryResolver resolves the root Query type
+type queryResolver struct{}
+
+func (q *queryResolver) Inventory(ctx context.Context) (*inventoryResolver, error) {
+	state := stateFrom(ctx)
+	inventory, err := state.snapshot(ctx)
+	if err != nil || inventory == nil {
+		return nil, err
+	}
+	return &inventoryResolver{job: state.job, inventory: inventory}, nil
+}
+
+type resourcesArgs struct {
+	Type   *string
+	Region *string
+	First  *int32
+	Offset *int32
+}
+
+func (q *queryResolver) Resources(ctx context.Context, args resourcesArgs) ([]*resourceResolver, error) {
+	inventory, err := stateFrom(ctx).snapshot(ctx)
+	if err != nil || inventory == nil {
+		return []*resourceResolver{}, err
+	}
+
+	matched := []*resourceResolver{}
+	for i := range inventory.Resources {
+		item := &inventory.Resources[i]
+		if args.Type != nil && item.ResourceType != *args.Type {
+			continue
+		}
+		if args.Region != nil && item.Region != *args.Region {
+			continue
+		}
+		matched = append(matched, &resourceResolver{item: item})
+	}
+	start, end := pageBounds(args.First, args.Offset, len(matched))
+	return matched[start:end], nil
+}
+
+func (q *queryResolver) Resource(ctx context.Context, args struct{ ID graphqlgo.ID }) (*resourceResolver, error) {
+	return stateFrom(ctx).resource(ctx, string(args.ID))
+}
+
+type findingsArgs struct {
+	Status     *string
+	ResourceID *graphqlgo.ID
+	First      *int32
+}
+
+func (q *queryResolver) Findings(ctx context.Context, args findingsArgs) ([]*findingResolver, error) {
+	filter := findingsvc.ListFilter{TenantID: stateFrom(ctx).tenantID}
+	if args.Status != nil {
+		filter.Status = findingsvc.Status(*args.Status)
+	}
+	if args.ResourceID != nil {
+		filter.ResourceID = string(*args.ResourceID)
+	}
+	if args.First != nil {
+		filter.Limit = int64(*args.First)
+	}
+	return listFindings(ctx, filter)
+}
+
+func listFindings(ctx context.Context, filter findingsvc.ListFilter) ([]*findingResolver, error) {
+	store := findingsvc.Default()
+	if store == nil {
+		return nil, errors.New("findings store is not initialized")
+	}
+	found, err := store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*findingResolver, len(found))
+	for i := range found {
+		result[i] = &findingResolver{finding: &found[i]}
+	}
+	return result, nil
+}
+
+type inventoryResolver struct {
+	job       *jobsvc.Job
+	inventory *services.ResourceInventory
+}
+
+func (r *inventoryResolver) ScanID() graphqlgo.ID {
+	return graphqlgo.ID(r.job.ID.Hex())
+}
+
+func (r *inventoryResolver) ScannedAt() *string {
+	if r.job.FinishedAt == nil {
+		return nil
+	}
+	return formatTime(*r.job.FinishedAt)
+}
+
+func (r *inventoryResolver) TotalResources() int32 {
+	return int32(r.inventory.ResourceSummary.TotalResources)
+}
+
+func (r *inventoryResolver) ResourcesByType() []*count {
+	return counts(r.inventory.ResourceSummary.ResourcesByType)
+}
+
+func (r *inventoryResolver) ResourcesByRegion() []*count {
+	return counts(r.inventory.ResourceSummary.ResourcesByRegion)
+}
+
+func (r *inventoryResolver) ComplianceStatus() []*count {
+	return counts(r.inventory.ResourceSummary.ComplianceStatus)
+}
+
+func (r *inventoryResolver) ComplianceRules() []*complianceRuleResolver {
+	result := make([]*complianceRuleResolver, len(r.inventory.ComplianceRules))
+	for i := range r.inventory.ComplianceRules {
+		result[i] = &complianceRuleResolver{rule: &r.inventory.ComplianceRules[i]}
+	}
+	return result
+}
+
+type resourceResolver struct {
+	item *services.ConfigurationItem
+}
+
+func (r *resourceResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(r.item.ResourceID)
+}
+
+func (r *resourceResolver) Type() string {
+	return r.item.ResourceType
+}
+
+func (r *resourceResolver) Name() *string {
+	return optional(r.item.ResourceName)
+}
+
+func (r *resourceResolver) Region() *string {
+	return optional(r.item.Region)
+}
+
+func (r *resourceResolver) AvailabilityZone() *string {
+	return optional(r.item.AvailabilityZone)
+}
+
+func (r *resourceResolver) ComplianceStatus() *string {
+	return optional(r.item.ComplianceStatus)
+}
+
+func (r *resourceResolver) Tags() []*tag {
+	result := make([]*tag, 0, len(r.item.Tags))
+	for k, v := range r.item.Tags {
+		result = append(result, &tag{Key: k, Value: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+func (r *resourceResolver) Relationships() []*relationshipResolver {
+	result := make([]*relationshipResolver, len(r.item.Relationships))
+	for i := range r.item.Relationships {
+		result[i] = &relationshipResolver{rel: &r.item.Relationships[i]}
+	}
+	return result
+}
+
+func (r *resourceResolver) Compliance(ctx context.Context) ([]*evaluationResolver, error) {
+	state := stateFrom(ctx)
+	if _, err := state.snapshot(ctx); err != nil {
+		return nil, err
+	}
+	if evals := state.evaluations[r.item.ResourceID]; evals != nil {
+		return evals, nil
+	}
+	return []*evaluationResolver{}, nil
+}
+
+func (r *resourceResolver) Findings(ctx context.Context, args struct{ Status *string }) ([]*findingResolver, error) {
+	filter := findingsvc.ListFilter{TenantID: stateFrom(ctx).tenantID, ResourceID: r.item.ResourceID}
+	if args.Status != nil {
+		filter.Status = findingsvc.Status(*args.Status)
+	}
+	return listFindings(ctx, filter)
+}
+
+func (r *resourceResolver) Iac(ctx context.Context) *iacResolver {
+	mappings := stateFrom(ctx).terraform()
+	for _, key := range []string{r.item.ResourceID, r.item.ResourceName} {
+		if mapping, ok := mappings[key]; ok && key != "" {
+			return &iacResolver{mapping: mapping}
+		}
+	}
+	return nil
+}
+
+type relationshipResolver struct {
+	rel *services.Relationship
+}
+
+func (r *relationshipResolver) Name() string {
+	return r.rel.RelationshipName
+}
+
+func (r *relationshipResolver) ResourceID() graphqlgo.ID {
+	return graphqlgo.ID(r.rel.ResourceID)
+}
+
+func (r *relationshipResolver) ResourceType() string {
+	return r.rel.ResourceType
+}
+
+func (r *relationshipResolver) ResourceName() *string {
+	return optional(r.rel.ResourceName)
+}
+
+func (r *relationshipResolver) Resource(ctx context.Context) (*resourceResolver, error) {
+	return stateFrom(ctx).resource(ctx, r.rel.ResourceID)
+}
+
+type complianceRuleResolver struct {
+	rule *services.ComplianceRule
+}
+
+func (r *complianceRuleResolver) Name() string {
+	return r.rule.ConfigRuleName
+}
+
+func (r *complianceRuleResolver) ComplianceType() string {
+	return r.rule.ComplianceType
+}
+
+func (r *complianceRuleResolver) Source() *string {
+	return optional(r.rule.Source)
+}
+
+func (r *complianceRuleResolver) ResourceType() *string {
+	return optional(r.rule.ResourceType)
+}
+
+func (r *complianceRuleResolver) Evaluations() []*evaluationResolver {
+	result := make([]*evaluationResolver, len(r.rule.EvaluationResults))
+	for i := range r.rule.EvaluationResults {
+		result[i] = &evaluationResolver{ruleName: r.rule.ConfigRuleName, eval: &r.rule.EvaluationResults[i]}
+	}
+	return result
+}
+
+type evaluationResolver struct {
+	ruleName string
+	eval     *services.EvaluationResult
+}
+
+func (r *evaluationResolver) RuleName() string {
+	return r.ruleName
+}
+
+func (r *evaluationResolver) ResourceID() graphqlgo.ID {
+	return graphqlgo.ID(r.eval.ResourceID)
+}
+
+func (r *evaluationResolver) ResourceType() string {
+	return r.eval.ResourceType
+}
+
+func (r *evaluationResolver) ComplianceType() string {
+	return r.eval.ComplianceType
+}
+
+func (r *evaluationResolver) Annotation() *string {
+	return optional(r.eval.Annotation)
+}
+
+func (r *evaluationResolver) RecordedAt() *string {
+	return formatTime(r.eval.ResultRecordedTime)
+}
+
+func (r *evaluationResolver) Resource(ctx context.Context) (*resourceResolver, error) {
+	return stateFrom(ctx).resource(ctx, r.eval.ResourceID)
+}
+
+type findingResolver struct {
+	finding *findingsvc.Finding
+}
+
+func (r *findingResolver) ID() graphqlgo.ID {
+	return graphqlgo.ID(r.finding.ID.Hex())
+}
+
+func (r *findingResolver) Status() string {
+	return string(r.finding.Status)
+}
+
+func (r *findingResolver) Severity() string {
+	return r.finding.Severity
+}
+
+func (r *findingResolver) Title() string {
+	return r.finding.Title
+}
+
+func (r *findingResolver) Description() *string {
+	return optional(r.finding.Description)
+}
+
+func (r *findingResolver) Remediation() *string {
+	return optional(r.finding.Remediation)
+}
+
+func (r *findingResolver) Source() string {
+	return r.finding.Source
+}
+
+func (r *findingResolver) RuleID() string {
+	return r.finding.RuleID
+}
+
+func (r *findingResolver) ResourceID() graphqlgo.ID {
+	return graphqlgo.ID(r.finding.ResourceID)
+}
+
+func (r *findingResolver) ResourceType() string {
+	return r.finding.ResourceType
+}
+
+func (r *findingResolver) FirstSeenAt() string {
+	return r.finding.FirstSeenAt.Format(time.RFC3339)
+}
+
+func (r *findingResolver) LastSeenAt() string {
+	return r.finding.LastSeenAt.Format(time.RFC3339)
+}
+
+func (r *findingResolver) StatusReason() *string {
+	return optional(r.finding.StatusReason)
+}
+
+func (r *findingResolver) SuppressedUntil() *string {
+	if r.finding.SuppressedUntil == nil {
+		return nil
+	}
+	return formatTime(*r.finding.SuppressedUntil)
+}
+
+func (r *findingResolver) Assignee() *string {
+	return optional(r.finding.Assignee)
+}
+
+func (r *findingResolver) Resource(ctx context.Context) (*resourceResolver, error) {
+	return stateFrom(ctx).resource(ctx, r.finding.ResourceID)
+}
+
+type iacResolver struct {
+	mapping services.TerraformMapping
+}
+
+func (r *iacResolver) Address() string {
+	return r.mapping.Address
+}
+
+func (r *iacResolver) Module() *string {
+	return optional(r.mapping.Module)
+}
+
+func (r *iacResolver) Type() string {
+	return r.mapping.Type
+}
+
+func (r *iacResolver) Name() string {
+	return r.mapping.Name
+}
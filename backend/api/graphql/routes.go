@@ -0,0 +1,12 @@
+package graphql
+
+import (
+	"net/http"
+
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// SetupGraphQLRoutes sets up the GraphQL endpoint, which keeps its own response format
+func SetupGraphQLRoutes(router common.Router) {
+	router.Raw(http.MethodPost, "", QueryHandler)
+}
@@ -0,0 +1,111 @@
+package graphql
+
+import graphqlgo "github.com/graph-gophers/graphql-go"
+
+// schemaSDL describes the tenant-scoped graph of the latest inventory snapshot, its compliance
+// evaluations, findings and Terraform mappings
+const schemaSDL = `
+schema {
+	query: Query
+}
+
+type Query {
+	inventory: Inventory
+	resources(type: String, region: String, first: Int = 100, offset: Int = 0): [Resource!]!
+	resource(id: ID!): Resource
+	findings(status: String, resourceId: ID, first: Int = 100): [Finding!]!
+}
+
+type Inventory {
+	scanId: ID!
+	scannedAt: String
+	totalResources: Int!
+	resourcesByType: [Count!]!
+	resourcesByRegion: [Count!]!
+	complianceStatus: [Count!]!
+	complianceRules: [ComplianceRule!]!
+}
+
+type Count {
+	key: String!
+	count: Int!
+}
+
+type Resource {
+	id: ID!
+	type: String!
+	name: String
+	region: String
+	availabilityZone: String
+	complianceStatus: String
+	tags: [Tag!]!
+	relationships: [Relationship!]!
+	compliance: [ComplianceEvaluation!]!
+	findings(status: String): [Finding!]!
+	iac: IaCMapping
+}
+
+type Tag {
+	key: String!
+	value: String!
+}
+
+type Relationship {
+	name: String!
+	resourceId: ID!
+	resourceType: String!
+	resourceName: String
+	resource: Resource
+}
+
+type ComplianceRule {
+	name: String!
+	complianceType: String!
+	source: String
+	resourceType: String
+	evaluations: [ComplianceEvaluation!]!
+}
+
+type ComplianceEvaluation {
+	ruleName: String!
+	resourceId: ID!
+	resourceType: String!
+	complianceType: String!
+	annotation: String
+	recordedAt: String
+	resource: Resource
+}
+
+type Finding {
+	id: ID!
+	status: String!
+	severity: String!
+	title: String!
+	description: String
+	remediation: String
+	source: String!
+	ruleId: String!
+	resourceId: ID!
+	resourceType: String!
+	firstSeenAt: String!
+	lastSeenAt: String!
+	statusReason: String
+	suppressedUntil: String
+	assignee: String
+	resource: Resource
+}
+
+type IaCMapping {
+	address: String!
+	module: String
+	type: String!
+	name: String!
+}
+`
+
+// maxQueryDepth stops clients from following relationships indefinitely
+const maxQueryDepth = 10
+
+var schema = graphqlgo.MustParseSchema(schemaSDL, &queryResolver{},
+	graphqlgo.MaxDepth(maxQueryDepth),
+	graphqlgo.UseFieldResolvers())
@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services"
+)
+
+// demoDiagrams renders Mermaid infrastructure and security diagrams from the demo inventory,
+// standing in for the AI agent when DEMO_MODE is set
+func demoDiagrams(tenantID string) (string, string) {
+	inventory := services.DemoInventory(tenantID, time.Now())
+
+	nodeIDs := map[string]string{}
+	nodeID := func(resourceID string) string {
+		if id, ok := nodeIDs[resourceID]; ok {
+			return id
+		}
+		id := fmt.Sprintf("n%d", len(nodeIDs)+1)
+		nodeIDs[resourceID] = id
+		return id
+	}
+
+	byRegion := map[string][]services.ConfigurationItem{}
+	for _, item := range inventory.Resources {
+		byRegion[item.Region] = append(byRegion[item.Region], item)
+	}
+	regions := make([]string, 0, len(byRegion))
+	for region := range byRegion {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var infra strings.Builder
+	infra.WriteString("graph TD\n")
+	for _, region := range regions {
+		fmt.Fprintf(&infra, "    subgraph %s[\"%s\"]\n", strings.ReplaceAll(region, "-", "_"), region)
+		for _, item := range byRegion[region] {
+			fmt.Fprintf(&infra, "        %s[\"%s<br/>%s\"]\n", nodeID(item.ResourceID), shortType(item.ResourceType), item.ResourceName)
+		}
+		infra.WriteString("    end\n")
+	}
+	for _, item := range inventory.Resources {
+		for _, rel := range item.Relationships {
+			fmt.Fprintf(&infra, "    %s --> %s\n", nodeID(item.ResourceID), nodeID(rel.ResourceID))
+		}
+	}
+
+	var security strings.Builder
+	security.WriteString("graph LR\n")
+	for _, rule := range inventory.ComplianceRules {
+		for _, eval := range rule.EvaluationResults {
+			if eval.ComplianceType != "NON_COMPLIANT" {
+				continue
+			}
+			fmt.Fprintf(&security, "    %s[\"%s\"] -. %s .-> %s_rule{{\"%s\"}}\n",
+				nodeID(eval.ResourceID), eval.ResourceID, eval.Annotation,
+				strings.ReplaceAll(rule.ConfigRuleName, "-", "_"), rule.ConfigRuleName)
+		}
+	}
+	return infra.String(), security.String()
+}
+
+// shortType turns AWS::EC2::Instance into EC2 Instance
+func shortType(resourceType string) string {
+	return strings.Join(strings.Split(strings.TrimPrefix(resourceType, "AWS::"), "::"), " ")
+}
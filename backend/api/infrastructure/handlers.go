@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,13 +13,54 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/api/jobs"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/cache"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/queuemonitor"
 )
 
+// Job types for the infrastructure operations that run in the background
+const (
+	JobTypeInfrastructureData    = "infrastructure_data"
+	JobTypeInfrastructureDiagram = "infrastructure_diagram"
+	JobTypeMermaidDiagram        = "mermaid_diagram"
+)
+
+// RegisterJobHandlers registers the infrastructure background jobs
+func RegisterJobHandlers(m *jobsvc.Manager) {
+	// The AI agent is slow to recover, so diagram builds back off longer than the default
+	diagramPolicy := jobsvc.RetryPolicy{MaxAttempts: 2, InitialBackoff: 2 * time.Minute, MaxBackoff: 10 * time.Minute, Multiplier: 2}
+
+	m.Register(JobTypeInfrastructureData, runInfrastructureDataJob)
+	m.RegisterWithPolicy(JobTypeInfrastructureDiagram, runInfrastructureDiagramJob, diagramPolicy)
+	m.RegisterWithPolicy(JobTypeMermaidDiagram, runMermaidDiagramJob, diagramPolicy)
+}
+
+// GetLiveInfrastructureData enqueues the Steampipe data export and returns the job ID
 func GetLiveInfrastructureData(c *gin.Context) {
+	jobs.EnqueueJob(c, JobTypeInfrastructureData, nil)
+}
+
+// StartInventoryScan enqueues a comprehensive AWS Config inventory scan
+func StartInventoryScan(c *gin.Context) {
+	jobs.EnqueueJob(c, services.JobTypeInventoryScan, nil)
+}
+
+func runInfrastructureDataJob(ctx context.Context, job *jobsvc.Job) (interface{}, error) {
+	if services.DemoModeEnabled() {
+		data, err := json.Marshal(services.DemoInventory(job.TenantID, time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"data": string(data)}, nil
+	}
+
 	log.Println("Executing Steampipe data export script...")
 
 	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "/bin/sh", "./infra/live-aws-infra/generate_infra_data.sh")
@@ -26,16 +69,14 @@ func GetLiveInfrastructureData(c *gin.Context) {
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			log.Printf("Script execution timed out after 5 minutes")
-			c.JSON(408, gin.H{"error": "Script execution timed out"})
-			return
+			return nil, fmt.Errorf("script execution timed out")
 		}
 		log.Printf("Script execution failed. Output:\n%s", string(output))
-		c.JSON(500, gin.H{"error": "Failed to retrieve infrastructure data"})
-		return
+		return nil, fmt.Errorf("failed to retrieve infrastructure data: %w", err)
 	}
 
 	log.Printf("Script executed successfully. Output:\n%s", string(output))
-	c.JSON(200, gin.H{"data": string(output)})
+	return gin.H{"data": string(output)}, nil
 }
 
 type InfrastructureInput struct {
@@ -61,60 +102,37 @@ type MermaidDiagramResponse struct {
 	Error                 string `json:"error,omitempty"`
 }
 
+// GenerateInfrastructureDiagram enqueues an AI diagram build and returns the job ID
 func GenerateInfrastructureDiagram(c *gin.Context) {
-	log.Println("Generating infrastructure diagram...")
-
-	// Read infrastructure data from the generated file
-	infraData, err := ioutil.ReadFile("infrastructure_data.json")
-	if err != nil {
-		log.Printf("Failed to read infrastructure_data.json: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to read infrastructure data"})
-		return
-	}
-
-	// Read terraform state data
-	terraformData, err := ioutil.ReadFile("infra/iac/terraform.tfstate")
-	if err != nil {
-		log.Printf("Failed to read terraform.tfstate: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to read terraform state"})
-		return
-	}
+	jobs.EnqueueJob(c, JobTypeInfrastructureDiagram, nil)
+}
 
-	// Parse JSON data
-	var infraJSON map[string]interface{}
-	if err := json.Unmarshal(infraData, &infraJSON); err != nil {
-		log.Printf("Failed to parse infrastructure JSON: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to parse infrastructure data"})
-		return
+func runInfrastructureDiagramJob(ctx context.Context, job *jobsvc.Job) (interface{}, error) {
+	if services.DemoModeEnabled() {
+		infra, security := demoDiagrams(job.TenantID)
+		return DiagramResponse{InfrastructureDiagram: infra, SecurityDiagram: security, AgentOutput: "demo mode: generated from synthetic inventory", Status: "success"}, nil
 	}
 
-	var terraformJSON map[string]interface{}
-	if err := json.Unmarshal(terraformData, &terraformJSON); err != nil {
-		log.Printf("Failed to parse terraform JSON: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to parse terraform state"})
-		return
-	}
+	log.Println("Generating infrastructure diagram...")
 
-	// Prepare request payload for the Python agent
-	requestPayload := InfrastructureInput{
-		InfrastructureData: infraJSON,
-		TerraformState:     terraformJSON,
+	requestPayload, err := loadInfrastructureInput()
+	if err != nil {
+		// Missing or malformed input files won't fix themselves on retry
+		return nil, jobsvc.Permanent(err)
 	}
 
 	jsonPayload, err := json.Marshal(requestPayload)
 	if err != nil {
 		log.Printf("Failed to marshal request payload: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to prepare request data"})
-		return
+		return nil, fmt.Errorf("failed to prepare request data: %w", err)
 	}
 
 	// Make HTTP request to Python agent
 	agentURL := "http://localhost:8001/generate_infrastructure_diagram/"
-	req, err := http.NewRequest("POST", agentURL, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", agentURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		log.Printf("Failed to create request: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to create agent request"})
-		return
+		return nil, fmt.Errorf("failed to create agent request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -123,8 +141,7 @@ func GenerateInfrastructureDiagram(c *gin.Context) {
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Failed to call Python agent: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to connect to AI agent"})
-		return
+		return nil, fmt.Errorf("failed to connect to AI agent: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -132,38 +149,78 @@ func GenerateInfrastructureDiagram(c *gin.Context) {
 	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Failed to read agent response: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to read agent response"})
-		return
+		return nil, fmt.Errorf("failed to read agent response: %w", err)
 	}
 
 	// Parse response
 	var diagramResponse DiagramResponse
 	if err := json.Unmarshal(responseBody, &diagramResponse); err != nil {
 		log.Printf("Failed to parse agent response: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to parse agent response"})
-		return
+		return nil, fmt.Errorf("failed to parse agent response: %w", err)
 	}
 
 	if resp.StatusCode != 200 {
 		log.Printf("Agent returned error: %s", diagramResponse.Error)
-		c.JSON(resp.StatusCode, gin.H{"error": diagramResponse.Error})
-		return
+		return nil, fmt.Errorf("agent returned status %d: %s", resp.StatusCode, diagramResponse.Error)
 	}
 
 	log.Println("Infrastructure diagram generated successfully")
-	c.JSON(200, diagramResponse)
+	return diagramResponse, nil
+}
+
+// loadInfrastructureInput reads the exported infrastructure data and terraform state from disk
+func loadInfrastructureInput() (*InfrastructureInput, error) {
+	// Read infrastructure data from the generated file
+	infraData, err := ioutil.ReadFile("infrastructure_data.json")
+	if err != nil {
+		log.Printf("Failed to read infrastructure_data.json: %v", err)
+		return nil, fmt.Errorf("failed to read infrastructure data: %w", err)
+	}
+
+	// Read terraform state data
+	terraformData, err := ioutil.ReadFile("infra/iac/terraform.tfstate")
+	if err != nil {
+		log.Printf("Failed to read terraform.tfstate: %v", err)
+		return nil, fmt.Errorf("failed to read terraform state: %w", err)
+	}
+
+	// Parse JSON data
+	var infraJSON map[string]interface{}
+	if err := json.Unmarshal(infraData, &infraJSON); err != nil {
+		log.Printf("Failed to parse infrastructure JSON: %v", err)
+		return nil, fmt.Errorf("failed to parse infrastructure data: %w", err)
+	}
+
+	var terraformJSON map[string]interface{}
+	if err := json.Unmarshal(terraformData, &terraformJSON); err != nil {
+		log.Printf("Failed to parse terraform JSON: %v", err)
+		return nil, fmt.Errorf("failed to parse terraform state: %w", err)
+	}
+
+	return &InfrastructureInput{
+		InfrastructureData: infraJSON,
+		TerraformState:     terraformJSON,
+	}, nil
 }
 
-// GetMermaidDiagramCode returns clean Mermaid code ready for direct use
+// GetMermaidDiagramCode enqueues a Mermaid diagram build; the job result holds clean Mermaid code ready for direct use
 func GetMermaidDiagramCode(c *gin.Context) {
+	jobs.EnqueueJob(c, JobTypeMermaidDiagram, nil)
+}
+
+func runMermaidDiagramJob(ctx context.Context, job *jobsvc.Job) (interface{}, error) {
+	if services.DemoModeEnabled() {
+		infra, security := demoDiagrams(job.TenantID)
+		return MermaidDiagramResponse{MermaidCode: infra, SecurityMermaidCode: security, DiagramType: "infrastructure", Status: "success", GeneratedFiles: []string{}}, nil
+	}
+
 	log.Println("Retrieving clean Mermaid diagram code...")
 
 	// First, trigger the diagram generation
-	err := triggerDiagramGeneration()
+	err := triggerDiagramGeneration(ctx)
 	if err != nil {
 		log.Printf("Failed to generate diagrams: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to generate diagrams"})
-		return
+		return nil, fmt.Errorf("failed to generate diagrams: %w", err)
 	}
 
 	// Read the generated Mermaid files directly from disk
@@ -187,8 +244,7 @@ func GetMermaidDiagramCode(c *gin.Context) {
 	}
 
 	if mermaidCode == "" {
-		c.JSON(500, gin.H{"error": "No valid Mermaid diagrams were generated"})
-		return
+		return nil, fmt.Errorf("no valid Mermaid diagrams were generated")
 	}
 
 	response := MermaidDiagramResponse{
@@ -200,11 +256,11 @@ func GetMermaidDiagramCode(c *gin.Context) {
 	}
 
 	log.Printf("Successfully retrieved clean Mermaid code (%d chars)", len(mermaidCode))
-	c.JSON(200, response)
+	return response, nil
 }
 
 // Helper function to trigger diagram generation
-func triggerDiagramGeneration() error {
+func triggerDiagramGeneration(ctx context.Context) error {
 	// Read infrastructure data
 	infraData, err := ioutil.ReadFile("infrastructure_data.json")
 	if err != nil {
@@ -234,7 +290,7 @@ func triggerDiagramGeneration() error {
 	}
 
 	for _, endpoint := range endpoints {
-		req, _ := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonPayload))
+		req, _ := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonPayload))
 		req.Header.Set("Content-Type", "application/json")
 
 		client := &http.Client{Timeout: 10 * time.Minute}
@@ -298,3 +354,178 @@ func cleanMermaidCode(input string) string {
 	
 	return finalContent
 }
+
+// InventorySummaryResponse is the dashboard view of the latest inventory scan
+type InventorySummaryResponse struct {
+	SnapshotID  string                   `json:"snapshotId"`
+	ScannedAt   *time.Time               `json:"scannedAt,omitempty"`
+	Summary     services.ResourceSummary `json:"summary"`
+	LastUpdated time.Time                `json:"lastUpdated"`
+}
+
+// AccountHealthResponse combines the latest scan's compliance picture with live pipeline state
+type AccountHealthResponse struct {
+	AccountID        string               `json:"accountId"`
+	SnapshotID       string               `json:"snapshotId,omitempty"`
+	LastScanAt       *time.Time           `json:"lastScanAt,omitempty"`
+	TotalResources   int                  `json:"totalResources"`
+	ComplianceStatus map[string]int       `json:"complianceStatus"`
+	QueueAlerts      []queuemonitor.Alert `json:"queueAlerts"`
+	DeadLetteredJobs int                  `json:"deadLetteredJobs"`
+}
+
+// latestCached loads a value derived from the tenant's latest successful job of jobType,
+// serving it from the cache keyed by that job's ID and computing it with build on a miss
+func latestCached(ctx context.Context, tenantID, jobType, name string, out interface{}, build func(job *jobsvc.Job) error) (*jobsvc.Job, bool, error) {
+	latest, err := jobsvc.Default().Latest(ctx, jobType, tenantID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := cache.TenantKey(tenantID, latest.ID.Hex(), name)
+	if cache.GetJSON(ctx, key, out) {
+		return latest, true, nil
+	}
+	if err := build(latest); err != nil {
+		return nil, false, err
+	}
+	cache.SetJSON(ctx, key, out)
+	return latest, false, nil
+}
+
+func setCacheHeader(c *gin.Context, hit bool) {
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+}
+
+// GetInventorySummary returns the resource summary of the tenant's latest inventory scan
+func GetInventorySummary(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	var response InventorySummaryResponse
+	_, hit, err := latestCached(c.Request.Context(), common.TenantID(c), services.JobTypeInventoryScan, "inventory-summary", &response, func(job *jobsvc.Job) error {
+		var inventory services.ResourceInventory
+		if err := jobsvc.Default().DecodeResult(c.Request.Context(), job.ID.Hex(), &inventory); err != nil {
+			return err
+		}
+		response = InventorySummaryResponse{
+			SnapshotID:  job.ID.Hex(),
+			ScannedAt:   job.FinishedAt,
+			Summary:     inventory.ResourceSummary,
+			LastUpdated: inventory.LastUpdated,
+		}
+		return nil
+	})
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	setCacheHeader(c, hit)
+	c.JSON(http.StatusOK, gin.H{"inventory": response, "success": true})
+}
+
+// GetLatestMermaidDiagram returns the most recently generated Mermaid diagrams
+func GetLatestMermaidDiagram(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	var diagram MermaidDiagramResponse
+	job, hit, err := latestCached(c.Request.Context(), common.TenantID(c), JobTypeMermaidDiagram, "mermaid-diagram", &diagram, func(job *jobsvc.Job) error {
+		return jobsvc.Default().DecodeResult(c.Request.Context(), job.ID.Hex(), &diagram)
+	})
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no diagram has been generated yet", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	setCacheHeader(c, hit)
+	c.JSON(http.StatusOK, gin.H{"diagram": diagram, "snapshotId": job.ID.Hex(), "generatedAt": job.FinishedAt, "success": true})
+}
+
+// BuildAccountHealth summarizes compliance from the tenant's latest scan alongside live queue
+// alerts and dead-lettered jobs, reporting whether the scan-derived part came from the cache
+func BuildAccountHealth(ctx context.Context, tenantID string) (*AccountHealthResponse, bool, error) {
+	manager := jobsvc.Default()
+	health := &AccountHealthResponse{
+		AccountID:        tenantID,
+		ComplianceStatus: map[string]int{},
+	}
+
+	// The scan-derived part is expensive to decode, so it is cached per snapshot
+	_, hit, err := latestCached(ctx, tenantID, services.JobTypeInventoryScan, "account-health", health, func(job *jobsvc.Job) error {
+		var inventory services.ResourceInventory
+		if err := manager.DecodeResult(ctx, job.ID.Hex(), &inventory); err != nil {
+			return err
+		}
+		health.SnapshotID = job.ID.Hex()
+		health.LastScanAt = job.FinishedAt
+		health.TotalResources = inventory.ResourceSummary.TotalResources
+		if inventory.ResourceSummary.ComplianceStatus != nil {
+			health.ComplianceStatus = inventory.ResourceSummary.ComplianceStatus
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, jobsvc.ErrNotFound) {
+		return nil, false, err
+	}
+
+	health.QueueAlerts = []queuemonitor.Alert{}
+	for _, alert := range queuemonitor.Default().ActiveAlerts() {
+		if tenantID == "" || alert.AccountID == tenantID {
+			health.QueueAlerts = append(health.QueueAlerts, alert)
+		}
+	}
+
+	deadLettered := true
+	failed, err := manager.List(ctx, jobsvc.ListFilter{TenantID: tenantID, DeadLettered: &deadLettered, Limit: 1000})
+	if err != nil {
+		return nil, false, err
+	}
+	health.DeadLetteredJobs = len(failed)
+	return health, hit, nil
+}
+
+// GetAccountHealth summarizes compliance from the latest scan alongside live queue alerts and dead-lettered jobs
+func GetAccountHealth(c *gin.Context) {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	health, hit, err := BuildAccountHealth(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	setCacheHeader(c, hit)
+	c.JSON(http.StatusOK, gin.H{"health": health, "success": true})
+}
+
+// InvalidateCacheOnNewSnapshot drops a tenant's cached dashboard reads whenever a
+// new inventory scan or diagram completes
+func InvalidateCacheOnNewSnapshot(m *jobsvc.Manager) {
+	m.OnSuccess(func(ctx context.Context, job *jobsvc.Job) {
+		switch job.Type {
+		case services.JobTypeInventoryScan, JobTypeMermaidDiagram, JobTypeInfrastructureDiagram:
+			cache.InvalidateTenant(ctx, job.TenantID)
+		}
+	})
+}
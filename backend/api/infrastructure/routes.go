@@ -1,12 +1,14 @@
 package infrastructure
 
-import (
-	"github.com/gin-gonic/gin"
-)
+import "github.com/rishichirchi/cloudloom/common"
 
 // SetupInfrastructureRoutes sets up the infrastructure-related routes
-func SetupInfrastructureRoutes(router *gin.RouterGroup) {
-	router.POST("/get-live-infrastructure-data", GetLiveInfrastructureData)
-	router.POST("/generate-infrastructure-diagram", GenerateInfrastructureDiagram)
-	router.GET("/get-mermaid-diagram-code", GetMermaidDiagramCode)
+func SetupInfrastructureRoutes(router common.Router) {
+	router.POST("/get-live-infrastructure-data", "", GetLiveInfrastructureData)
+	router.POST("/generate-infrastructure-diagram", "", GenerateInfrastructureDiagram)
+	router.GET("/get-mermaid-diagram-code", "", GetMermaidDiagramCode)
+	router.POST("/inventory-scan", "", StartInventoryScan)
+	router.GET("/summary", "inventory", GetInventorySummary)
+	router.GET("/diagram", "", GetLatestMermaidDiagram)
+	router.GET("/account-health", "health", GetAccountHealth)
 }
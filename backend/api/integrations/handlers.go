@@ -0,0 +1,93 @@
+package integrations
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+)
+
+// credentialsRequest carries integration credentials such as a Slack webhook URL, Jira API token,
+// ServiceNow login or SIEM endpoint token. Values are write-only and never returned by the API.
+type credentialsRequest struct {
+	Credentials map[string]string `json:"credentials" binding:"required"`
+}
+
+// requireStore resolves the secret store, tenant and integration, writing an error response if any is missing
+func requireStore(c *gin.Context) (secrets.Store, string, bool) {
+	store := secrets.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "secret storage is not configured", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	if integration := c.Param("integration"); integration != "" && !secrets.IsIntegration(integration) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown integration: " + integration, "success": false})
+		return nil, "", false
+	}
+	return store, tenantID, true
+}
+
+// ListIntegrationsHandler reports which integrations have stored credentials for the tenant
+func ListIntegrationsHandler(c *gin.Context) {
+	store, tenantID, ok := requireStore(c)
+	if !ok {
+		return
+	}
+
+	configured := make(map[string]bool, len(secrets.Integrations))
+	for _, integration := range secrets.Integrations {
+		_, err := store.Get(c.Request.Context(), secrets.TenantName(tenantID, integration))
+		if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		configured[integration] = err == nil
+	}
+	c.JSON(http.StatusOK, gin.H{"integrations": configured, "success": true})
+}
+
+// PutCredentialsHandler stores or rotates an integration's credentials for the tenant
+func PutCredentialsHandler(c *gin.Context) {
+	store, tenantID, ok := requireStore(c)
+	if !ok {
+		return
+	}
+
+	var req credentialsRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	name := secrets.TenantName(tenantID, c.Param("integration"))
+	if err := secrets.PutJSON(c.Request.Context(), store, name, req.Credentials); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Credentials stored", "success": true})
+}
+
+// DeleteCredentialsHandler removes an integration's credentials for the tenant
+func DeleteCredentialsHandler(c *gin.Context) {
+	store, tenantID, ok := requireStore(c)
+	if !ok {
+		return
+	}
+
+	err := store.Delete(c.Request.Context(), secrets.TenantName(tenantID, c.Param("integration")))
+	if errors.Is(err, secrets.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Credentials deleted", "success": true})
+}
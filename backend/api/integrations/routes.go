@@ -0,0 +1,16 @@
+package integrations
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupIntegrationRoutes sets up the per-tenant integration credential and ticketing routes
+func SetupIntegrationRoutes(router common.Router) {
+	router.GET("", "integrations", ListIntegrationsHandler)
+	router.PUT("/:integration/credentials", "", PutCredentialsHandler)
+	router.DELETE("/:integration/credentials", "", DeleteCredentialsHandler)
+
+	router.GET("/ticketing", "ticketing", GetTicketingHandler)
+	router.PUT("/ticketing", "ticketing", PutTicketingHandler)
+	router.DELETE("/ticketing", "", DeleteTicketingHandler)
+	router.GET("/ticketing/tickets", "tickets", ListTicketsHandler)
+	router.POST("/ticketing/sync", "job", SyncTicketsHandler)
+}
@@ -0,0 +1,129 @@
+package integrations
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/ticketing"
+)
+
+// TicketingRequest replaces the tenant's ticketing settings: the provider tickets are raised
+// in, the lowest severity that is ticketed and where in the provider tickets go. The provider's
+// credentials are stored separately, under /integrations/:integration/credentials.
+type TicketingRequest struct {
+	Provider    string `json:"provider" binding:"required,oneof=jira servicenow"`
+	MinSeverity string `json:"minSeverity"`
+	// Enabled defaults to true
+	Enabled    *bool                         `json:"enabled"`
+	Jira       *ticketing.JiraSettings       `json:"jira"`
+	ServiceNow *ticketing.ServiceNowSettings `json:"serviceNow"`
+}
+
+// GetTicketingHandler returns the tenant's ticketing settings and the outcome of the last sync
+func GetTicketingHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"ticketing": nil, "providers": ticketing.Providers, "demo": true, "success": true})
+		return
+	}
+
+	settings, err := services.GetTicketingSettings(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		ticketingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticketing": settings, "providers": ticketing.Providers, "success": true})
+}
+
+// PutTicketingHandler replaces the tenant's ticketing settings and, when ticketing is enabled,
+// returns the sync job that tickets the findings already above the threshold
+func PutTicketingHandler(c *gin.Context) {
+	var request TicketingRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: ticketing was not configured", "demo": true, "success": true})
+		return
+	}
+
+	settings, job, err := services.PutTicketingSettings(c.Request.Context(), common.TenantID(c), &ticketing.Settings{
+		Provider:    request.Provider,
+		MinSeverity: request.MinSeverity,
+		Enabled:     request.Enabled == nil || *request.Enabled,
+		Jira:        request.Jira,
+		ServiceNow:  request.ServiceNow,
+	})
+	if err != nil {
+		ticketingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticketing": settings, "job": job, "success": true})
+}
+
+// DeleteTicketingHandler stops raising and syncing tickets for the tenant's findings
+func DeleteTicketingHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: ticketing was not changed", "demo": true, "success": true})
+		return
+	}
+
+	if err := services.DeleteTicketingSettings(c.Request.Context(), common.TenantID(c)); err != nil {
+		ticketingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ticketing disabled", "success": true})
+}
+
+// ListTicketsHandler returns the tickets raised for the tenant's findings, optionally only
+// those of one finding (?findingId=) or in one state (?state=open|closed)
+func ListTicketsHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"tickets": []ticketing.Ticket{}, "demo": true, "success": true})
+		return
+	}
+
+	tickets, err := services.ListTickets(c.Request.Context(), ticketing.ListFilter{
+		TenantID:  common.TenantID(c),
+		FindingID: c.Query("findingId"),
+		State:     c.Query("state"),
+		Limit:     500,
+	})
+	if err != nil {
+		ticketingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tickets": tickets, "success": true})
+}
+
+// SyncTicketsHandler queues a ticket sync for the tenant without waiting for the next scheduled one
+func SyncTicketsHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no tickets were synced", "demo": true, "success": true})
+		return
+	}
+
+	job, err := services.SyncTickets(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		ticketingError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "success": true})
+}
+
+// ticketingError writes the response for a ticketing error
+func ticketingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ticketing.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, ticketing.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrTicketingUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
@@ -0,0 +1,466 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/api/jobs"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/cache"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// requireJobs writes an error response if the job subsystem, where inventory snapshots are
+// stored, is not initialized
+func requireJobs(c *gin.Context) bool {
+	if jobsvc.Default() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return false
+	}
+	return true
+}
+
+// resolveSnapshot resolves the snapshot named by ?snapshotId=, or the latest one, which with
+// ?refresh=true may be served from the inventory cache or scanned first, as
+// services.ResolveInventorySnapshot decides. Responses computed from a snapshot never change,
+// so they are tagged with an ETag of the snapshot and query, and a request whose If-None-Match
+// already has it is answered 304 Not Modified. It writes the response and returns false if
+// there is nothing more to send.
+func resolveSnapshot(c *gin.Context) (*services.InventorySnapshot, string, bool) {
+	if !requireJobs(c) {
+		return nil, "", false
+	}
+	refresh, _ := strconv.ParseBool(c.Query("refresh"))
+	snapshot, freshness, err := services.ResolveInventorySnapshot(c.Request.Context(), common.TenantID(c), c.Query("snapshotId"), refresh)
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return nil, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return nil, "", false
+	}
+
+	etag := snapshotETag(c, snapshot)
+	c.Header("X-Snapshot-ID", snapshot.ID)
+	c.Header("X-Snapshot-Freshness", freshness)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return nil, "", false
+	}
+	return snapshot, etag, true
+}
+
+// snapshotETag tags a response by the snapshot it is computed from and the request's path and
+// query, less ?refresh= which does not change what a given snapshot yields
+func snapshotETag(c *gin.Context, snapshot *services.InventorySnapshot) string {
+	query := c.Request.URL.Query()
+	query.Del("refresh")
+	sum := sha256.Sum256([]byte(snapshot.ID + "\n" + c.Request.URL.Path + "?" + query.Encode()))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing weakly as
+// RFC 9110 requires for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSnapshot answers a read of a snapshot with {key: value, "success": true}, value being
+// what build computes from the snapshot's inventory. Values are cached by the snapshot and
+// ETag, so repeated polls of an unchanged snapshot do not load its inventory again.
+// jobs.ErrNotFound from build is answered 404.
+func serveSnapshot(c *gin.Context, key string, build func(snapshot *services.InventorySnapshot, inventory *services.ResourceInventory) (interface{}, error)) {
+	snapshot, etag, ok := resolveSnapshot(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	cacheKey := cache.TenantKey(common.TenantID(c), snapshot.ID, "inventory:"+strings.Trim(etag, `"`))
+	var cached json.RawMessage
+	if cache.GetJSON(ctx, cacheKey, &cached) {
+		c.Header("X-Cache", "HIT")
+		c.JSON(http.StatusOK, gin.H{key: cached, "success": true})
+		return
+	}
+
+	_, inventory, err := services.LoadInventory(ctx, common.TenantID(c), snapshot.ID, false)
+	var value interface{}
+	if err == nil {
+		value, err = build(snapshot, inventory)
+	}
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	cache.SetJSON(ctx, cacheKey, value)
+	c.Header("X-Cache", "MISS")
+	c.JSON(http.StatusOK, gin.H{key: value, "success": true})
+}
+
+// ListResourcesHandler lists the resources of a snapshot, filtered by ?type=, ?region=,
+// ?complianceStatus= and any number of ?tag=key or ?tag=key=value, paged by ?limit= and ?offset=
+func ListResourcesHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	filter := services.ResourceFilter{
+		Type:             c.Query("type"),
+		Region:           c.Query("region"),
+		Tags:             c.QueryArray("tag"),
+		ComplianceStatus: c.Query("complianceStatus"),
+		Offset:           offset,
+		Limit:            limit,
+	}
+	serveSnapshot(c, "resources", func(snapshot *services.InventorySnapshot, inventory *services.ResourceInventory) (interface{}, error) {
+		return services.QueryResources(snapshot, inventory, filter), nil
+	})
+}
+
+// GetResourceHandler returns a resource of a snapshot with its full configuration,
+// relationships and compliance evaluations. A path ending in /history is served by
+// ResourceConfigHistoryHandler instead.
+func GetResourceHandler(c *gin.Context) {
+	if _, ok := strings.CutSuffix(c.Param("id"), "/history"); ok {
+		common.SetDataKey(c, "history")
+		ResourceConfigHistoryHandler(c)
+		return
+	}
+
+	serveSnapshot(c, "resource", func(snapshot *services.InventorySnapshot, inventory *services.ResourceInventory) (interface{}, error) {
+		return services.GetResourceDetail(snapshot, inventory, strings.TrimPrefix(c.Param("id"), "/"))
+	})
+}
+
+// GetSummaryHandler returns the resource summary of a snapshot
+func GetSummaryHandler(c *gin.Context) {
+	serveSnapshot(c, "summary", func(snapshot *services.InventorySnapshot, inventory *services.ResourceInventory) (interface{}, error) {
+		return services.SummarizeInventory(snapshot, inventory), nil
+	})
+}
+
+// ListSnapshotsHandler lists the tenant's inventory snapshots, newest first, up to ?limit=
+func ListSnapshotsHandler(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	snapshots, err := services.ListInventorySnapshots(c.Request.Context(), common.TenantID(c), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots, "success": true})
+}
+
+// DiffSnapshotsHandler lists the resources added, removed and changed in a snapshot since
+// the snapshot given as ?against=, or since the one before it
+func DiffSnapshotsHandler(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	diff, err := services.DiffInventorySnapshots(c.Request.Context(), common.TenantID(c), c.Param("id"), c.Query("against"))
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"diff": diff, "success": true})
+}
+
+// SyncHandler starts an inventory scan that applies the configuration changes AWS Config
+// delivered to S3 since the latest snapshot, and responds with the job to poll
+func SyncHandler(c *gin.Context) {
+	jobs.EnqueueJob(c, services.JobTypeInventoryScan, map[string]interface{}{"mode": services.InventoryScanModeSync})
+}
+
+// ResourceHistoryHandler lists the configuration changes recorded for a resource by inventory
+// syncs, newest first, optionally narrowed by ?type= and limited by ?limit=
+func ResourceHistoryHandler(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	history, err := services.ResourceHistory(c.Request.Context(), common.TenantID(c), c.Query("type"), strings.TrimPrefix(c.Param("id"), "/"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history, "success": true})
+}
+
+// ResourceConfigHistoryHandler returns the configuration timeline AWS Config recorded for
+// /resources/{id}/history, newest first, with the changes each item made to the one before
+// it. ?type= and ?region= default to those of the resource in the latest snapshot; an RFC3339
+// from/to range bounds the timeline and ?limit= caps it.
+func ResourceConfigHistoryHandler(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+
+	resourceID, _ := strings.CutSuffix(strings.TrimPrefix(c.Param("id"), "/"), "/history")
+	opts := services.ConfigHistoryOptions{ResourceType: c.Query("type"), Region: c.Query("region")}
+	opts.Limit, _ = strconv.Atoi(c.Query("limit"))
+	for param, dst := range map[string]**time.Time{"from": &opts.Since, "to": &opts.Until} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC3339 timestamp", "success": false})
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	timeline, err := services.ResourceConfigHistory(c.Request.Context(), common.TenantID(c), resourceID, opts)
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": timeline, "success": true})
+}
+
+// queryRequest is an AWS Config advanced query and the page of its results to return, or
+// structured filters selecting whole resources
+type queryRequest struct {
+	Expression string `json:"expression"`
+	Limit      int    `json:"limit" binding:"min=0,max=100"`
+	NextToken  string `json:"nextToken"`
+
+	ResourceTypes []string `json:"resourceTypes"`
+	Regions       []string `json:"regions"`
+	// Tags are "key" or "key=value"
+	Tags             []string `json:"tags"`
+	ComplianceStatus string   `json:"complianceStatus"`
+}
+
+// hasFilters reports whether the request selects resources by structured filters
+func (r queryRequest) hasFilters() bool {
+	return len(r.ResourceTypes) > 0 || len(r.Regions) > 0 || len(r.Tags) > 0 || r.ComplianceStatus != ""
+}
+
+// QueryHandler runs an AWS Config advanced query (SELECT ... WHERE ...) against the tenant's
+// account and returns a page of its rows with the type of each selected field. Queries may
+// only name configuration item fields and use the keywords and operators
+// services.ValidateConfigQuery allows; others are answered 400. Pass the returned nextToken
+// for the next page. Instead of an expression, resourceTypes, regions, tags and
+// complianceStatus select every resource matching all of them.
+func QueryHandler(c *gin.Context) {
+	var req queryRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+	if (req.Expression == "") == !req.hasFilters() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "give either an expression or filters", "success": false})
+		return
+	}
+
+	if req.hasFilters() {
+		resources, err := services.FindTenantResources(c.Request.Context(), common.TenantID(c), services.ResourceQuery{
+			ResourceTypes:    req.ResourceTypes,
+			Regions:          req.Regions,
+			Tags:             req.Tags,
+			ComplianceStatus: req.ComplianceStatus,
+		})
+		if errors.Is(err, services.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"result": gin.H{"resources": resources, "count": len(resources)}, "success": true})
+		return
+	}
+
+	result, err := services.RunConfigQuery(c.Request.Context(), common.TenantID(c), services.ConfigQuery{
+		Expression: req.Expression,
+		Limit:      req.Limit,
+		NextToken:  req.NextToken,
+	})
+	if errors.Is(err, services.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result, "success": true})
+}
+
+// exportFlushEvery is how many resources an export writes between flushes to the client
+const exportFlushEvery = 100
+
+// defaultExportColumns are the CSV columns of an export without ?fields=
+var defaultExportColumns = []string{
+	"resourceId", "resourceType", "resourceName", "awsRegion", "accountId", "availabilityZone",
+	"configurationItemStatus", "complianceStatus", "resourceCreationTime", "tags",
+}
+
+// ExportResourcesHandler streams the resources of the snapshot named by ?snapshotId=, or of the
+// latest one, as NDJSON or, with ?format=csv, as CSV. Resources are filtered as by
+// ListResourcesHandler and reduced to the top-level ?fields= given; CSV cells of nested fields
+// hold their JSON. Resources are read from the store as the client consumes them, so a slow
+// client slows the export rather than buffering it.
+func ExportResourcesHandler(c *gin.Context) {
+	if !requireJobs(c) {
+		return
+	}
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ndjson or csv", "success": false})
+		return
+	}
+
+	ctx := c.Request.Context()
+	snapshot, err := services.GetInventorySnapshot(ctx, common.TenantID(c), c.Query("snapshotId"))
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no completed inventory scan", "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	fields := common.Fields(c)
+	if format == "csv" && len(fields) == 0 {
+		fields = defaultExportColumns
+	}
+	filter := services.ResourceFilter{
+		Type:             c.Query("type"),
+		Region:           c.Query("region"),
+		Tags:             c.QueryArray("tag"),
+		ComplianceStatus: c.Query("complianceStatus"),
+	}
+
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("inventory-%s.%s", snapshot.ID, format)))
+	c.Header("X-Snapshot-ID", snapshot.ID)
+	c.Status(http.StatusOK)
+
+	var write func(item *services.ConfigurationItem) error
+	var flush func() error
+	if format == "csv" {
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(fields); err != nil {
+			return
+		}
+		write = func(item *services.ConfigurationItem) error {
+			row, err := resourceRow(item)
+			if err != nil {
+				return err
+			}
+			record := make([]string, len(fields))
+			for i, field := range fields {
+				record[i] = csvCell(row[field])
+			}
+			return writer.Write(record)
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		encoder := json.NewEncoder(c.Writer)
+		write = func(item *services.ConfigurationItem) error {
+			if len(fields) == 0 {
+				return encoder.Encode(item)
+			}
+			row, err := resourceRow(item)
+			if err != nil {
+				return err
+			}
+			selected := make(map[string]json.RawMessage, len(fields))
+			for _, field := range fields {
+				if value, ok := row[field]; ok {
+					selected[field] = value
+				}
+			}
+			return encoder.Encode(selected)
+		}
+		flush = func() error { return nil }
+	}
+
+	written := 0
+	err = services.EachResource(ctx, snapshot, filter, func(item *services.ConfigurationItem) error {
+		if err := write(item); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// The response has started, so the client can only tell from the export ending early
+		log.Printf("[Export] Inventory export of snapshot %s stopped after %d resources: %v", snapshot.ID, written, err)
+	}
+	flush()
+	c.Writer.Flush()
+}
+
+// resourceRow returns a resource's top-level JSON fields
+func resourceRow(item *services.ConfigurationItem) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// csvCell renders a JSON value as a CSV cell: strings as they are, null as empty and anything
+// else as its JSON
+func csvCell(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	return string(value)
+}
@@ -0,0 +1,22 @@
+package inventory
+
+import (
+	"net/http"
+
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// SetupInventoryRoutes sets up the routes over the tenant's stored inventory snapshots
+func SetupInventoryRoutes(router common.Router) {
+	router.GET("/resources", "resources", ListResourcesHandler)
+	// Resource IDs may contain slashes, so the ID is the rest of the path, and
+	// /resources/{id}/history is dispatched by GetResourceHandler
+	router.GET("/resources/*id", "resource", GetResourceHandler)
+	router.Raw(http.MethodGet, "/export", ExportResourcesHandler)
+	router.POST("/query", "result", QueryHandler)
+	router.GET("/summary", "summary", GetSummaryHandler)
+	router.GET("/snapshots", "snapshots", ListSnapshotsHandler)
+	router.GET("/snapshots/:id/diff", "diff", DiffSnapshotsHandler)
+	router.POST("/sync", "", SyncHandler)
+	router.GET("/history/*id", "history", ResourceHistoryHandler)
+}
@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	jobsvc "github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// GetJobHandler returns the status and, once finished, the result of a job
+func GetJobHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	job, err := manager.Get(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, jobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "success": true})
+}
+
+// ListJobsHandler lists recent jobs, optionally filtered by type, status and
+// deadLettered. Failed jobs include their error and per-attempt error history.
+func ListJobsHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+	filter := jobsvc.ListFilter{
+		Type:     c.Query("type"),
+		TenantID: common.TenantID(c),
+		Status:   jobsvc.Status(c.Query("status")),
+		Limit:    limit,
+	}
+	if raw := c.Query("deadLettered"); raw != "" {
+		deadLettered, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "deadLettered must be true or false", "success": false})
+			return
+		}
+		filter.DeadLettered = &deadLettered
+	}
+
+	jobs, err := manager.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "count": len(jobs), "success": true})
+}
+
+// EnqueueJob enqueues a job for the requesting tenant and responds with 202 Accepted
+// and the URL the client can poll for the result
+func EnqueueJob(c *gin.Context, jobType string, payload map[string]interface{}) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	job, err := manager.Enqueue(c.Request.Context(), jobType, common.TenantID(c), payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	statusURL := fmt.Sprintf("/api/v1/jobs/%s", job.ID.Hex())
+	c.Header("Location", statusURL)
+	c.JSON(http.StatusAccepted, gin.H{
+		"jobId":     job.ID.Hex(),
+		"type":      job.Type,
+		"status":    job.Status,
+		"statusUrl": statusURL,
+		"success":   true,
+	})
+}
+
+// RetryJobHandler re-queues a failed job so an operator can re-run it after fixing the cause
+func RetryJobHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	job, err := manager.Retry(c.Request.Context(), c.Param("id"))
+	switch {
+	case errors.Is(err, jobsvc.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	case errors.Is(err, jobsvc.ErrNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "success": true})
+}
+
+// retryPolicyView is the JSON form of a retry policy, with durations in seconds
+type retryPolicyView struct {
+	MaxAttempts           int     `json:"maxAttempts" binding:"min=1"`
+	InitialBackoffSeconds float64 `json:"initialBackoffSeconds" binding:"min=0"`
+	MaxBackoffSeconds     float64 `json:"maxBackoffSeconds" binding:"min=0"`
+	Multiplier            float64 `json:"multiplier" binding:"min=0"`
+}
+
+func toPolicyView(p jobsvc.RetryPolicy) retryPolicyView {
+	return retryPolicyView{
+		MaxAttempts:           p.MaxAttempts,
+		InitialBackoffSeconds: p.InitialBackoff.Seconds(),
+		MaxBackoffSeconds:     p.MaxBackoff.Seconds(),
+		Multiplier:            p.Multiplier,
+	}
+}
+
+// ListRetryPoliciesHandler returns the retry policy of every job type
+func ListRetryPoliciesHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	policies := make(map[string]retryPolicyView)
+	for jobType, policy := range manager.Policies() {
+		policies[jobType] = toPolicyView(policy)
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "success": true})
+}
+
+// UpdateRetryPolicyHandler changes the retry policy of a job type
+func UpdateRetryPolicyHandler(c *gin.Context) {
+	manager := jobsvc.Default()
+	if manager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "job subsystem is not initialized", "success": false})
+		return
+	}
+
+	var view retryPolicyView
+	if !common.BindJSON(c, &view) {
+		return
+	}
+
+	policy := jobsvc.RetryPolicy{
+		MaxAttempts:    view.MaxAttempts,
+		InitialBackoff: time.Duration(view.InitialBackoffSeconds * float64(time.Second)),
+		MaxBackoff:     time.Duration(view.MaxBackoffSeconds * float64(time.Second)),
+		Multiplier:     view.Multiplier,
+	}
+	if err := manager.SetPolicy(c.Param("type"), policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"type": c.Param("type"), "policy": toPolicyView(policy), "success": true})
+}
@@ -0,0 +1,12 @@
+package jobs
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupJobRoutes sets up the background job status routes
+func SetupJobRoutes(router common.Router) {
+	router.GET("", "jobs", ListJobsHandler)
+	router.GET("/policies", "policies", ListRetryPoliciesHandler)
+	router.PUT("/policies/:type", "", UpdateRetryPolicyHandler)
+	router.GET("/:id", "job", GetJobHandler)
+	router.POST("/:id/retry", "job", RetryJobHandler)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/queuemonitor"
+)
+
+// GetQueueMetricsHandler returns depth and processing-lag metrics for every polled queue
+func GetQueueMetricsHandler(c *gin.Context) {
+	monitor := queuemonitor.Default()
+
+	c.JSON(http.StatusOK, gin.H{
+		"queues":            monitor.Snapshot(),
+		"alerts":            monitor.ActiveAlerts(),
+		"thresholds":        monitor.Thresholds(),
+		"lowPriorityPaused": monitor.IsBackedUp(),
+		"success":           true,
+	})
+}
+
+// UpdateQueueThresholdsHandler changes the depth and lag alert thresholds at runtime
+func UpdateQueueThresholdsHandler(c *gin.Context) {
+	var thresholds queuemonitor.Thresholds
+	if !common.BindJSON(c, &thresholds) {
+		return
+	}
+
+	if thresholds.MaxDepth < 0 || thresholds.MaxLagSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "thresholds must not be negative",
+			"success": false,
+		})
+		return
+	}
+
+	queuemonitor.Default().SetThresholds(thresholds)
+
+	c.JSON(http.StatusOK, gin.H{
+		"thresholds": thresholds,
+		"success":    true,
+	})
+}
+
+// GetBufferMetricsHandler returns the number of deliveries waiting in the overflow buffer per sink
+func GetBufferMetricsHandler(c *gin.Context) {
+	buf := buffer.Default()
+	if buf == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "delivery buffer is not initialized",
+			"success": false,
+		})
+		return
+	}
+
+	stats, err := buf.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   err.Error(),
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sinks":   stats,
+		"success": true,
+	})
+}
+
+// GetEventMetricsHandler returns how many queue events each handler processed and failed, and
+// how many no handler took or could not be parsed
+func GetEventMetricsHandler(c *gin.Context) {
+	stats := eventpipeline.Default().Stats()
+
+	c.JSON(http.StatusOK, gin.H{
+		"handlers":  stats.Handlers,
+		"unmatched": stats.Unmatched,
+		"malformed": stats.Malformed,
+		"success":   true,
+	})
+}
@@ -0,0 +1,11 @@
+package metrics
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupMetricsRoutes sets up the pipeline metrics routes
+func SetupMetricsRoutes(router common.Router) {
+	router.GET("/queues", "", GetQueueMetricsHandler)
+	router.PUT("/queues/thresholds", "thresholds", UpdateQueueThresholdsHandler)
+	router.GET("/buffer", "sinks", GetBufferMetricsHandler)
+	router.GET("/events", "", GetEventMetricsHandler)
+}
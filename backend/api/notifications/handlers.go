@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/notificationtargets"
+)
+
+// TargetRequest adds a fan-out destination: the ARN of an SNS topic in a monitored region, or
+// an HTTPS URL subscribed to the tenant's notification topic
+type TargetRequest struct {
+	Type        notificationtargets.Type `json:"type" binding:"required,oneof=sns https"`
+	Destination string                   `json:"destination" binding:"required"`
+	Description string                   `json:"description"`
+}
+
+// ListTargetsHandler returns the tenant's fan-out destinations
+func ListTargetsHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"targets": []notificationtargets.Target{}, "demo": true, "success": true})
+		return
+	}
+
+	targets, err := services.ListNotificationTargets(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		targetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": targets, "success": true})
+}
+
+// CreateTargetHandler fans the tenant's events out to another destination. A topic's policy
+// must let events.amazonaws.com publish; an HTTPS endpoint gets nothing until it confirms the
+// subscription.
+func CreateTargetHandler(c *gin.Context) {
+	var request TargetRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no target was added", "demo": true, "success": true})
+		return
+	}
+
+	target, err := services.AddNotificationTarget(c.Request.Context(), common.TenantID(c), &notificationtargets.Target{
+		Type:        request.Type,
+		Destination: request.Destination,
+		Description: request.Description,
+	})
+	if err != nil {
+		targetError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"target": target, "success": true})
+}
+
+// DeleteTargetHandler stops fanning the tenant's events out to a destination
+func DeleteTargetHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no target was removed", "demo": true, "success": true})
+		return
+	}
+
+	if err := services.RemoveNotificationTarget(c.Request.Context(), common.TenantID(c), c.Param("id")); err != nil {
+		targetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// targetError writes the response for a notification target error
+func targetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, notificationtargets.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, notificationtargets.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, notificationtargets.ErrExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrNotificationTargetsUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to manage notification targets: %v", err), "success": false})
+	}
+}
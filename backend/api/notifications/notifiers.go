@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/notifiers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotifierRequest creates or replaces a Slack or Teams notifier. The webhook URL is write-only;
+// updates keep the current one when it is left out.
+type NotifierRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Type       string `json:"type" binding:"omitempty,oneof=slack teams"`
+	WebhookURL string `json:"webhookUrl"`
+	// Events are the events posted, all of them when none are given
+	Events []string `json:"events"`
+	// MinSeverity is the lowest severity of the findings posted, high by default
+	MinSeverity string `json:"minSeverity"`
+	// Enabled defaults to true; it only applies to updates
+	Enabled *bool `json:"enabled"`
+}
+
+// ListNotifiersHandler returns the tenant's notifiers
+func ListNotifiersHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"notifiers": []notifiers.Notifier{}, "events": notifiers.Events, "demo": true, "success": true})
+		return
+	}
+
+	registered, err := services.ListNotifiers(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifiers": registered, "events": notifiers.Events, "success": true})
+}
+
+// CreateNotifierHandler adds a notifier posting to a Slack or Teams incoming webhook
+func CreateNotifierHandler(c *gin.Context) {
+	var request NotifierRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+	if request.Type == "" || request.WebhookURL == "" {
+		notifierError(c, fmt.Errorf("%w: type and webhookUrl are required", notifiers.ErrInvalid))
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no notifier was added", "demo": true, "success": true})
+		return
+	}
+
+	notifier, err := services.CreateNotifier(c.Request.Context(), common.TenantID(c), &notifiers.Notifier{
+		Name:        request.Name,
+		Type:        notifiers.Type(request.Type),
+		Events:      request.Events,
+		MinSeverity: request.MinSeverity,
+	}, request.WebhookURL)
+	if err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"notifier": notifier, "success": true})
+}
+
+// GetNotifierHandler returns one of the tenant's notifiers with the outcome of its last message
+func GetNotifierHandler(c *gin.Context) {
+	store := notifiers.Default()
+	if store == nil {
+		notifierError(c, services.ErrNotifiersUnavailable)
+		return
+	}
+	notifier, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifier": notifier, "success": true})
+}
+
+// UpdateNotifierHandler replaces the name, events and severity threshold of a notifier,
+// enables or disables it, and replaces its webhook URL when one is given. Its type cannot
+// change.
+func UpdateNotifierHandler(c *gin.Context) {
+	var request NotifierRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		notifierError(c, notifiers.ErrNotFound)
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no notifier was changed", "demo": true, "success": true})
+		return
+	}
+
+	notifier, err := services.UpdateNotifier(c.Request.Context(), common.TenantID(c), &notifiers.Notifier{
+		ID:          id,
+		Name:        request.Name,
+		Events:      request.Events,
+		MinSeverity: request.MinSeverity,
+		Enabled:     request.Enabled == nil || *request.Enabled,
+	}, request.WebhookURL)
+	if err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifier": notifier, "success": true})
+}
+
+// DeleteNotifierHandler stops posting messages to a notifier
+func DeleteNotifierHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no notifier was removed", "demo": true, "success": true})
+		return
+	}
+
+	if err := services.DeleteNotifier(c.Request.Context(), common.TenantID(c), c.Param("id")); err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// TestNotifierHandler queues a test message to a notifier and returns the delivery job
+func TestNotifierHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no message was sent", "demo": true, "success": true})
+		return
+	}
+
+	job, err := services.TestNotifier(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		notifierError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "success": true})
+}
+
+// notifierError writes the response for a notifier error
+func notifierError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, notifiers.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, notifiers.ErrExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrNotifiersUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, notifiers.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
@@ -0,0 +1,27 @@
+package notifications
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupNotificationRoutes sets up the routes of the destinations the tenant's events are fanned
+// out to besides CloudLoom's queue, of the webhooks remediation events are posted to, and of the
+// Slack and Teams channels findings, remediations and setup failures are posted to
+func SetupNotificationRoutes(router common.Router) {
+	router.GET("/targets", "targets", ListTargetsHandler)
+	router.POST("/targets", "target", CreateTargetHandler)
+	router.DELETE("/targets/:id", "", DeleteTargetHandler)
+
+	router.GET("/webhooks", "webhooks", ListWebhooksHandler)
+	router.POST("/webhooks", "webhook", CreateWebhookHandler)
+	router.GET("/webhooks/:id", "webhook", GetWebhookHandler)
+	router.PUT("/webhooks/:id", "webhook", UpdateWebhookHandler)
+	router.DELETE("/webhooks/:id", "", DeleteWebhookHandler)
+	router.POST("/webhooks/:id/rotate-secret", "secret", RotateWebhookSecretHandler)
+	router.POST("/webhooks/:id/ping", "job", PingWebhookHandler)
+
+	router.GET("/notifiers", "notifiers", ListNotifiersHandler)
+	router.POST("/notifiers", "notifier", CreateNotifierHandler)
+	router.GET("/notifiers/:id", "notifier", GetNotifierHandler)
+	router.PUT("/notifiers/:id", "notifier", UpdateNotifierHandler)
+	router.DELETE("/notifiers/:id", "", DeleteNotifierHandler)
+	router.POST("/notifiers/:id/test", "job", TestNotifierHandler)
+}
@@ -0,0 +1,169 @@
+package notifications
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookRequest creates or replaces a webhook: an HTTPS URL and the remediation events posted
+// to it, all of them when none are given
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	// Enabled defaults to true; it only applies to updates
+	Enabled *bool `json:"enabled"`
+}
+
+// ListWebhooksHandler returns the tenant's webhooks
+func ListWebhooksHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"webhooks": []webhooks.Webhook{}, "events": webhooks.Events, "demo": true, "success": true})
+		return
+	}
+
+	registered, err := services.ListWebhooks(c.Request.Context(), common.TenantID(c))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": registered, "events": webhooks.Events, "success": true})
+}
+
+// CreateWebhookHandler adds a webhook and returns its signing secret, the only time it is shown
+func CreateWebhookHandler(c *gin.Context) {
+	var request WebhookRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no webhook was added", "demo": true, "success": true})
+		return
+	}
+
+	webhook, secret, err := services.CreateWebhook(c.Request.Context(), common.TenantID(c), &webhooks.Webhook{
+		URL:         request.URL,
+		Events:      request.Events,
+		Description: request.Description,
+	})
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"webhook": webhook, "secret": secret, "success": true})
+}
+
+// GetWebhookHandler returns one of the tenant's webhooks with the outcome of its last delivery
+func GetWebhookHandler(c *gin.Context) {
+	store := webhooks.Default()
+	if store == nil {
+		webhookError(c, services.ErrWebhooksUnavailable)
+		return
+	}
+	webhook, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook, "success": true})
+}
+
+// UpdateWebhookHandler replaces the URL, events and description of a webhook, and enables or
+// disables it
+func UpdateWebhookHandler(c *gin.Context) {
+	var request WebhookRequest
+	if !common.BindJSON(c, &request) {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		webhookError(c, webhooks.ErrNotFound)
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no webhook was changed", "demo": true, "success": true})
+		return
+	}
+
+	enabled := request.Enabled == nil || *request.Enabled
+	webhook, err := services.UpdateWebhook(c.Request.Context(), common.TenantID(c), &webhooks.Webhook{
+		ID:          id,
+		URL:         request.URL,
+		Events:      request.Events,
+		Description: request.Description,
+		Enabled:     enabled,
+	})
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook, "success": true})
+}
+
+// DeleteWebhookHandler stops posting events to a webhook
+func DeleteWebhookHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no webhook was removed", "demo": true, "success": true})
+		return
+	}
+
+	if err := services.DeleteWebhook(c.Request.Context(), common.TenantID(c), c.Param("id")); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RotateWebhookSecretHandler replaces a webhook's signing secret and returns the new one
+func RotateWebhookSecretHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no secret was rotated", "demo": true, "success": true})
+		return
+	}
+
+	secret, err := services.RotateWebhookSecret(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "success": true})
+}
+
+// PingWebhookHandler queues a signed ping to a webhook and returns the delivery job
+func PingWebhookHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no ping was sent", "demo": true, "success": true})
+		return
+	}
+
+	job, err := services.PingWebhook(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "success": true})
+}
+
+// webhookError writes the response for a webhook error
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, webhooks.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, webhooks.ErrExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrWebhooksUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
@@ -0,0 +1,88 @@
+package remediation
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/guardrails"
+)
+
+// requireGuardrails resolves the guardrail store and tenant, writing an error response if
+// either is missing
+func requireGuardrails(c *gin.Context) (*guardrails.Store, string, bool) {
+	store := guardrails.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "guardrails are not initialized", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	return store, tenantID, true
+}
+
+// GetGuardrailsHandler returns the tenant's remediation guardrails
+func GetGuardrailsHandler(c *gin.Context) {
+	store, tenantID, ok := requireGuardrails(c)
+	if !ok {
+		return
+	}
+
+	policy, err := store.Get(c.Request.Context(), tenantID)
+	if errors.Is(err, guardrails.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"guardrails": policy, "success": true})
+}
+
+// PutGuardrailsHandler replaces the tenant's remediation guardrails. They apply to every
+// remediation started without approval from now on; approved remediations are not held back.
+func PutGuardrailsHandler(c *gin.Context) {
+	store, tenantID, ok := requireGuardrails(c)
+	if !ok {
+		return
+	}
+
+	var policy guardrails.Guardrails
+	if !common.BindJSON(c, &policy) {
+		return
+	}
+	err := store.Put(c.Request.Context(), tenantID, &policy)
+	if errors.Is(err, guardrails.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"guardrails": policy, "success": true})
+}
+
+// DeleteGuardrailsHandler removes the tenant's remediation guardrails
+func DeleteGuardrailsHandler(c *gin.Context) {
+	store, tenantID, ok := requireGuardrails(c)
+	if !ok {
+		return
+	}
+
+	err := store.Delete(c.Request.Context(), tenantID)
+	if errors.Is(err, guardrails.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,333 @@
+package remediation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/keyrotation"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// keyRotationRequest is the body accepted when starting an access key rotation
+type keyRotationRequest struct {
+	UserName              string `json:"userName" binding:"required"`
+	AccessKeyID           string `json:"accessKeyId"`
+	FindingID             string `json:"findingId"`
+	StoreInSecretsManager bool   `json:"storeInSecretsManager"`
+	// GracePeriodHours defaults to services.DefaultKeyRotationGracePeriod
+	GracePeriodHours int `json:"gracePeriodHours" binding:"min=0,max=720"`
+}
+
+// requireTenant resolves the rotation store and tenant, writing an error response if either is missing
+func requireTenant(c *gin.Context) (*keyrotation.Store, string, bool) {
+	store := keyrotation.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "access key rotation is not initialized", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	return store, tenantID, true
+}
+
+func writeRotationError(c *gin.Context, err error) {
+	var missingErr *services.MissingPermissionsError
+	switch {
+	case errors.As(err, &missingErr):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "missingPermissions": missingErr.Missing, "success": false})
+	case errors.Is(err, services.ErrFixesNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, keyrotation.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, keyrotation.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, keyrotation.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrDemoMode):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
+
+// ListKeyRotationsHandler lists the tenant's access key rotations, optionally for one ?userName=
+func ListKeyRotationsHandler(c *gin.Context) {
+	store, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	rotations, err := store.List(c.Request.Context(), tenantID, c.Query("userName"))
+	if err != nil {
+		writeRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rotations": rotations, "count": len(rotations), "success": true})
+}
+
+// GetKeyRotationHandler returns one access key rotation
+func GetKeyRotationHandler(c *gin.Context) {
+	store, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	rotation, err := store.Get(c.Request.Context(), tenantID, c.Param("id"))
+	if err != nil {
+		writeRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rotation": rotation, "success": true})
+}
+
+// StartKeyRotationHandler creates a new access key for a flagged IAM user and schedules the
+// old key's deactivation. The new secret is in the response only when it was not stored in
+// the customer's Secrets Manager, and it is never shown again.
+func StartKeyRotationHandler(c *gin.Context) {
+	_, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req keyRotationRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	rotation, newKey, err := services.StartKeyRotation(c.Request.Context(), tenantID, services.KeyRotationRequest{
+		UserName:              req.UserName,
+		AccessKeyID:           req.AccessKeyID,
+		FindingID:             req.FindingID,
+		StoreInSecretsManager: req.StoreInSecretsManager,
+		GracePeriod:           time.Duration(req.GracePeriodHours) * time.Hour,
+		RequestedBy:           common.UserID(c),
+	})
+	if err != nil {
+		writeRotationError(c, err)
+		return
+	}
+
+	response := gin.H{"rotation": rotation, "success": true}
+	if newKey != nil {
+		response["newAccessKey"] = newKey
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ConfirmKeyRotationHandler deletes the deactivated old key once the new key is known to work
+func ConfirmKeyRotationHandler(c *gin.Context) {
+	_, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	rotation, err := services.ConfirmKeyRotation(c.Request.Context(), tenantID, c.Param("id"), common.UserID(c))
+	if err != nil {
+		writeRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rotation": rotation, "success": true})
+}
+
+// runRemediationRequest is the body accepted when remediating a finding on demand
+type runRemediationRequest struct {
+	FindingID string `json:"findingId" binding:"required"`
+}
+
+// rejectRemediationRequest is the body accepted when rejecting a proposed remediation
+type rejectRemediationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+func writeRemediationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, findings.ErrNotFound), errors.Is(err, remediations.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrNoRemediationAction), errors.Is(err, services.ErrRollbackUnavailable), errors.Is(err, services.ErrGuardrailViolation):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrInvalidRemediation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrConfirmationRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrRemediationActive), errors.Is(err, remediations.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrRemediationsUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+	default:
+		writeRotationError(c, err)
+	}
+}
+
+// ListActionsHandler lists the remediation actions and the finding types each one fixes
+func ListActionsHandler(c *gin.Context) {
+	actions := services.DefaultRemediationEngine().Actions()
+	c.JSON(http.StatusOK, gin.H{"actions": actions, "count": len(actions), "success": true})
+}
+
+// ListRemediationsHandler returns the tenant's remediation log, newest first, optionally for
+// one ?findingId=, ?action= or ?status=
+func ListRemediationsHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"remediations": []remediations.Remediation{}, "count": 0, "demo": true, "success": true})
+		return
+	}
+	store := remediations.Default()
+	if store == nil {
+		writeRemediationError(c, services.ErrRemediationsUnavailable)
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+	list, err := store.List(c.Request.Context(), remediations.ListFilter{
+		TenantID:  common.TenantID(c),
+		FindingID: c.Query("findingId"),
+		Action:    c.Query("action"),
+		Status:    remediations.Status(c.Query("status")),
+		Limit:     limit,
+	})
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediations": list, "count": len(list), "success": true})
+}
+
+// GetRemediationHandler returns one entry of the remediation log
+func GetRemediationHandler(c *gin.Context) {
+	store := remediations.Default()
+	if store == nil {
+		writeRemediationError(c, services.ErrRemediationsUnavailable)
+		return
+	}
+
+	remediation, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediation": remediation, "success": true})
+}
+
+// PreviewRemediationHandler is a dry run of the remediation action for a finding: the diff,
+// the API calls with their parameters, the affected ARNs and whether the change can be undone,
+// without changing anything
+func PreviewRemediationHandler(c *gin.Context) {
+	var req runRemediationRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was previewed", "demo": true, "success": true})
+		return
+	}
+
+	preview, err := services.PreviewFinding(c.Request.Context(), common.TenantID(c), req.FindingID)
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preview": preview, "success": true})
+}
+
+// RunRemediationHandler applies the remediation action for a finding's type now. Irreversible
+// actions need ?confirm=true. A failed action is still logged and returned, with its error, as
+// the remediation.
+func RunRemediationHandler(c *gin.Context) {
+	var req runRemediationRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was applied", "demo": true, "success": true})
+		return
+	}
+
+	confirmed, _ := strconv.ParseBool(c.Query("confirm"))
+	remediation, err := services.RemediateFinding(c.Request.Context(), common.TenantID(c), req.FindingID, common.UserID(c), confirmed)
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"remediation": remediation, "success": true})
+}
+
+// ApproveRemediationHandler approves a pending remediation so it can be executed
+func ApproveRemediationHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was approved", "demo": true, "success": true})
+		return
+	}
+
+	remediation, err := services.DefaultRemediationEngine().Review(c.Request.Context(), common.TenantID(c), c.Param("id"), true, common.UserID(c), "")
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediation": remediation, "success": true})
+}
+
+// RejectRemediationHandler rejects a pending remediation with the reviewer's reason
+func RejectRemediationHandler(c *gin.Context) {
+	var req rejectRemediationRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was rejected", "demo": true, "success": true})
+		return
+	}
+
+	remediation, err := services.DefaultRemediationEngine().Review(c.Request.Context(), common.TenantID(c), c.Param("id"), false, common.UserID(c), req.Reason)
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediation": remediation, "success": true})
+}
+
+// ExecuteRemediationHandler applies an approved remediation. Irreversible actions need
+// ?confirm=true. A failed action is still logged and returned, with its error, as the
+// remediation.
+func ExecuteRemediationHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was executed", "demo": true, "success": true})
+		return
+	}
+
+	confirmed, _ := strconv.ParseBool(c.Query("confirm"))
+	remediation, err := services.DefaultRemediationEngine().Execute(c.Request.Context(), common.TenantID(c), c.Param("id"), common.UserID(c), confirmed)
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediation": remediation, "success": true})
+}
+
+// RollbackRemediationHandler restores the state a succeeded remediation captured before it
+// changed the resource. A failed rollback is still returned, with its error, as the
+// remediation.
+func RollbackRemediationHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no remediation was rolled back", "demo": true, "success": true})
+		return
+	}
+
+	remediation, err := services.DefaultRemediationEngine().Rollback(c.Request.Context(), common.TenantID(c), c.Param("id"), common.UserID(c))
+	if err != nil {
+		writeRemediationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remediation": remediation, "success": true})
+}
@@ -0,0 +1,168 @@
+package remediation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/playbooks"
+)
+
+func writePlaybookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, playbooks.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, playbooks.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, playbooks.ErrExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, services.ErrPlaybookMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "success": false})
+	default:
+		writeRemediationError(c, err)
+	}
+}
+
+// requirePlaybooks resolves the playbook store, writing an error response if it is missing
+func requirePlaybooks(c *gin.Context) (*playbooks.Store, bool) {
+	store := playbooks.Default()
+	if store == nil {
+		writeRemediationError(c, services.ErrRemediationsUnavailable)
+		return nil, false
+	}
+	return store, true
+}
+
+// readPlaybookSource reads a playbook's YAML from the request body, writing an error response
+// if it is empty or too large
+func readPlaybookSource(c *gin.Context) ([]byte, bool) {
+	source, err := io.ReadAll(io.LimitReader(c.Request.Body, playbooks.MaxSourceSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read playbook: " + err.Error(), "success": false})
+		return nil, false
+	}
+	if len(source) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a YAML playbook is required as the request body", "success": false})
+		return nil, false
+	}
+	if len(source) > playbooks.MaxSourceSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("playbooks are limited to %d bytes", playbooks.MaxSourceSize), "success": false})
+		return nil, false
+	}
+	return source, true
+}
+
+// ListPlaybooksHandler lists the tenant's playbooks in the order they are tried, optionally
+// only the ?enabled=true ones
+func ListPlaybooksHandler(c *gin.Context) {
+	store, ok := requirePlaybooks(c)
+	if !ok {
+		return
+	}
+
+	list, err := store.List(c.Request.Context(), common.TenantID(c), c.Query("enabled") == "true")
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbooks": list, "count": len(list), "success": true})
+}
+
+// GetPlaybookHandler returns one of the tenant's playbooks with its YAML
+func GetPlaybookHandler(c *gin.Context) {
+	store, ok := requirePlaybooks(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := store.Get(c.Request.Context(), common.TenantID(c), c.Param("id"))
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbook": playbook, "success": true})
+}
+
+// ValidatePlaybookHandler parses and checks a YAML playbook without saving it
+func ValidatePlaybookHandler(c *gin.Context) {
+	source, ok := readPlaybookSource(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := services.ParsePlaybook(source)
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbook": playbook, "success": true})
+}
+
+// CreatePlaybookHandler stores a new YAML playbook for the tenant
+func CreatePlaybookHandler(c *gin.Context) {
+	source, ok := readPlaybookSource(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := services.SavePlaybook(c.Request.Context(), common.TenantID(c), "", source)
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"playbook": playbook, "success": true})
+}
+
+// UpdatePlaybookHandler replaces one of the tenant's playbooks with new YAML
+func UpdatePlaybookHandler(c *gin.Context) {
+	source, ok := readPlaybookSource(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := services.SavePlaybook(c.Request.Context(), common.TenantID(c), c.Param("id"), source)
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"playbook": playbook, "success": true})
+}
+
+// DeletePlaybookHandler removes one of the tenant's playbooks
+func DeletePlaybookHandler(c *gin.Context) {
+	store, ok := requirePlaybooks(c)
+	if !ok {
+		return
+	}
+
+	if err := store.Delete(c.Request.Context(), common.TenantID(c), c.Param("id")); err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Playbook deleted", "success": true})
+}
+
+// RunPlaybookHandler runs one of the tenant's playbooks for a finding it matches and returns
+// what each step did
+func RunPlaybookHandler(c *gin.Context) {
+	if services.DemoModeEnabled() {
+		c.JSON(http.StatusOK, gin.H{"message": "Demo mode: no playbook was run", "demo": true, "success": true})
+		return
+	}
+
+	var req runRemediationRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	run, err := services.RunPlaybook(c.Request.Context(), common.TenantID(c), c.Param("id"), req.FindingID, common.UserID(c))
+	if err != nil {
+		writePlaybookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"run": run, "success": true})
+}
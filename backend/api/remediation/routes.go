@@ -0,0 +1,42 @@
+package remediation
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupRemediationRoutes sets up the remediation playbook routes
+func SetupRemediationRoutes(router common.Router) {
+	router.GET("/access-key-rotations", "rotations", ListKeyRotationsHandler)
+	router.POST("/access-key-rotations", "", common.RequireAdminToken(), StartKeyRotationHandler)
+	router.GET("/access-key-rotations/:id", "rotation", GetKeyRotationHandler)
+	router.POST("/access-key-rotations/:id/confirm", "rotation", common.RequireAdminToken(), ConfirmKeyRotationHandler)
+
+	router.GET("/actions", "actions", ListActionsHandler)
+	router.GET("/guardrails", "guardrails", GetGuardrailsHandler)
+	router.PUT("/guardrails", "guardrails", common.RequireAdminToken(), PutGuardrailsHandler)
+	router.DELETE("/guardrails", "", common.RequireAdminToken(), DeleteGuardrailsHandler)
+	router.GET("/log", "remediations", ListRemediationsHandler)
+	router.GET("/log/:id", "remediation", GetRemediationHandler)
+	router.POST("/dry-run", "preview", PreviewRemediationHandler)
+	router.POST("/run", "remediation", common.RequireAdminToken(), RunRemediationHandler)
+}
+
+// SetupPlaybookRoutes sets up the routes to manage and run the tenant's YAML playbooks
+func SetupPlaybookRoutes(router common.Router) {
+	router.GET("", "playbooks", ListPlaybooksHandler)
+	router.POST("", "playbook", common.RequireAdminToken(), CreatePlaybookHandler)
+	router.POST("/validate", "playbook", ValidatePlaybookHandler)
+	router.GET("/:id", "playbook", GetPlaybookHandler)
+	router.PUT("/:id", "playbook", common.RequireAdminToken(), UpdatePlaybookHandler)
+	router.DELETE("/:id", "", common.RequireAdminToken(), DeletePlaybookHandler)
+	router.POST("/:id/run", "run", common.RequireAdminToken(), RunPlaybookHandler)
+}
+
+// SetupRemediationQueueRoutes sets up the routes to review, execute and roll back remediations.
+// ?status=pending lists the fixes waiting for approval.
+func SetupRemediationQueueRoutes(router common.Router) {
+	router.GET("", "remediations", ListRemediationsHandler)
+	router.GET("/:id", "remediation", GetRemediationHandler)
+	router.POST("/:id/approve", "remediation", common.RequireAdminToken(), ApproveRemediationHandler)
+	router.POST("/:id/reject", "remediation", common.RequireAdminToken(), RejectRemediationHandler)
+	router.POST("/:id/execute", "remediation", common.RequireAdminToken(), ExecuteRemediationHandler)
+	router.POST("/:id/rollback", "remediation", common.RequireAdminToken(), RollbackRemediationHandler)
+}
@@ -0,0 +1,174 @@
+package schedules
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/scheduler"
+)
+
+// scheduleRequest is the body accepted when creating or updating a schedule
+type scheduleRequest struct {
+	Name          string                 `json:"name" binding:"required"`
+	JobType       string                 `json:"jobType" binding:"required"`
+	Cron          string                 `json:"cron" binding:"required"`
+	Timezone      string                 `json:"timezone"`
+	Payload       map[string]interface{} `json:"payload"`
+	Enabled       *bool                  `json:"enabled"`
+	JitterSeconds int                    `json:"jitterSeconds" binding:"min=0"`
+	AllowOverlap  bool                   `json:"allowOverlap"`
+}
+
+func (r scheduleRequest) toSchedule(tenantID string) *scheduler.Schedule {
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+	return &scheduler.Schedule{
+		TenantID:      tenantID,
+		Name:          r.Name,
+		JobType:       r.JobType,
+		Cron:          r.Cron,
+		Timezone:      r.Timezone,
+		Payload:       r.Payload,
+		Enabled:       enabled,
+		JitterSeconds: r.JitterSeconds,
+		AllowOverlap:  r.AllowOverlap,
+	}
+}
+
+// requireTenant resolves the scheduler and tenant, writing an error response if either is missing
+func requireTenant(c *gin.Context) (*scheduler.Scheduler, string, bool) {
+	s := scheduler.Default()
+	if s == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scheduler is not initialized", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	return s, tenantID, true
+}
+
+func writeScheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, scheduler.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
+
+// ListSchedulesHandler lists the tenant's schedules
+func ListSchedulesHandler(c *gin.Context) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	schedules, err := s.List(c.Request.Context(), tenantID)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "count": len(schedules), "success": true})
+}
+
+// CreateScheduleHandler creates a schedule for the tenant
+func CreateScheduleHandler(c *gin.Context) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req scheduleRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	schedule := req.toSchedule(tenantID)
+	if err := s.Create(c.Request.Context(), schedule); err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"schedule": schedule, "success": true})
+}
+
+// GetScheduleHandler returns a single schedule
+func GetScheduleHandler(c *gin.Context) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := s.Get(c.Request.Context(), tenantID, c.Param("id"))
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule, "success": true})
+}
+
+// UpdateScheduleHandler replaces a schedule's settings and recomputes its next run
+func UpdateScheduleHandler(c *gin.Context) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req scheduleRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	schedule, err := s.Update(c.Request.Context(), tenantID, c.Param("id"), req.toSchedule(tenantID))
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule, "success": true})
+}
+
+// PauseScheduleHandler stops a schedule from running until it is resumed
+func PauseScheduleHandler(c *gin.Context) {
+	setEnabled(c, false)
+}
+
+// ResumeScheduleHandler resumes a paused schedule from its next occurrence
+func ResumeScheduleHandler(c *gin.Context) {
+	setEnabled(c, true)
+}
+
+func setEnabled(c *gin.Context, enabled bool) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := s.SetEnabled(c.Request.Context(), tenantID, c.Param("id"), enabled)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule, "success": true})
+}
+
+// DeleteScheduleHandler deletes a schedule
+func DeleteScheduleHandler(c *gin.Context) {
+	s, tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := s.Delete(c.Request.Context(), tenantID, c.Param("id")); err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted", "success": true})
+}
@@ -0,0 +1,14 @@
+package schedules
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupScheduleRoutes sets up the per-tenant schedule CRUD routes
+func SetupScheduleRoutes(router common.Router) {
+	router.GET("", "schedules", ListSchedulesHandler)
+	router.POST("", "schedule", CreateScheduleHandler)
+	router.GET("/:id", "schedule", GetScheduleHandler)
+	router.PUT("/:id", "schedule", UpdateScheduleHandler)
+	router.POST("/:id/pause", "schedule", PauseScheduleHandler)
+	router.POST("/:id/resume", "schedule", ResumeScheduleHandler)
+	router.DELETE("/:id", "", DeleteScheduleHandler)
+}
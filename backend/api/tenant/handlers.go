@@ -0,0 +1,180 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/api/jobs"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/retention"
+	"github.com/rishichirchi/cloudloom/services/tenantdata"
+)
+
+type exportRequest struct {
+	Bucket   string   `json:"bucket" binding:"required"`
+	Prefix   string   `json:"prefix"`
+	Region   string   `json:"region" binding:"omitempty,awsregion"`
+	Format   string   `json:"format" binding:"omitempty,oneof=json parquet"`
+	Datasets []string `json:"datasets"`
+}
+
+// StartTenantExportHandler enqueues a full export of the tenant's findings, inventory
+// snapshots, events and audit logs to the customer's S3 bucket
+func StartTenantExportHandler(c *gin.Context) {
+	if common.TenantID(c) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	var req exportRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"bucket":   req.Bucket,
+		"prefix":   req.Prefix,
+		"region":   req.Region,
+		"format":   req.Format,
+		"datasets": req.Datasets,
+	}
+	opts := services.TenantExportOptions(payload)
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	jobs.EnqueueJob(c, services.JobTypeTenantExport, payload)
+}
+
+type retentionRequest struct {
+	Days map[string]int `json:"days" binding:"required,min=1,dive,min=0"`
+}
+
+// requireRetention resolves the policy store and tenant, writing an error response if either is missing
+func requireRetention(c *gin.Context) (*retention.Store, string, bool) {
+	store := retention.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "retention policies are not initialized", "success": false})
+		return nil, "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", false
+	}
+	return store, tenantID, true
+}
+
+// GetRetentionPolicyHandler returns the tenant's effective retention period per dataset
+func GetRetentionPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireRetention(c)
+	if !ok {
+		return
+	}
+
+	policy, err := store.Get(c.Request.Context(), tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "defaults": retention.DefaultDays, "success": true})
+}
+
+// UpdateRetentionPolicyHandler overrides the retention period of the given datasets
+func UpdateRetentionPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireRetention(c)
+	if !ok {
+		return
+	}
+
+	var req retentionRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	policy, err := store.Update(c.Request.Context(), tenantID, req.Days)
+	if errors.Is(err, retention.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "success": true})
+}
+
+// ResetRetentionPolicyHandler restores the default retention periods for the tenant
+func ResetRetentionPolicyHandler(c *gin.Context) {
+	store, tenantID, ok := requireRetention(c)
+	if !ok {
+		return
+	}
+
+	if err := store.Reset(c.Request.Context(), tenantID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Retention policy reset to defaults", "success": true})
+}
+
+// RunRetentionHandler enqueues an immediate retention pass for the tenant
+func RunRetentionHandler(c *gin.Context) {
+	if _, _, ok := requireRetention(c); !ok {
+		return
+	}
+	jobs.EnqueueJob(c, services.JobTypeRetention, nil)
+}
+
+type purgeRequest struct {
+	// ConfirmTenantID must repeat the tenant being purged to guard against a mis-scoped request
+	ConfirmTenantID string `json:"confirmTenantId" binding:"required"`
+}
+
+// PurgeTenantHandler deletes or anonymizes all stored data for the tenant and returns a signed deletion report
+func PurgeTenantHandler(c *gin.Context) {
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return
+	}
+
+	var req purgeRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+	if req.ConfirmTenantID != tenantID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirmTenantId does not match the tenant being purged", "success": false})
+		return
+	}
+
+	report, err := tenantdata.Purge(c.Request.Context(), config.MongoDB, tenantID)
+	if errors.Is(err, tenantdata.ErrSigningKeyMissing) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletionReport": report, "success": true})
+}
+
+// VerifyDeletionReportHandler checks that a deletion report was issued by this service and not altered
+func VerifyDeletionReportHandler(c *gin.Context) {
+	var signed tenantdata.SignedDeletionReport
+	if !common.BindJSON(c, &signed) {
+		return
+	}
+
+	valid, err := tenantdata.VerifyReport(&signed)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": valid, "success": true})
+}
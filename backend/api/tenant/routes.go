@@ -0,0 +1,16 @@
+package tenant
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupTenantRoutes sets up the tenant data management routes
+func SetupTenantRoutes(router common.Router) {
+	router.POST("/export", "", StartTenantExportHandler)
+
+	router.GET("/retention", "", GetRetentionPolicyHandler)
+	router.PUT("/retention", "policy", UpdateRetentionPolicyHandler)
+	router.DELETE("/retention", "", ResetRetentionPolicyHandler)
+	router.POST("/retention/run", "", RunRetentionHandler)
+
+	router.POST("/purge", "deletionReport", common.RequireAdminToken(), PurgeTenantHandler)
+	router.POST("/purge/verify", "", VerifyDeletionReportHandler)
+}
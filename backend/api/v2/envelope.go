@@ -0,0 +1,144 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// Envelope is the shape of every v2 JSON response. Data is null on failure and error is
+// null on success; meta is always an object.
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Error *Error      `json:"error"`
+	Meta  Meta        `json:"meta"`
+}
+
+// Error describes why a request failed
+type Error struct {
+	// Code is the snake_case HTTP status text, e.g. "not_found"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields lists per-field validation failures, as produced by common.BindJSON
+	Fields json.RawMessage `json:"fields,omitempty"`
+}
+
+// Meta carries list counts and pagination links
+type Meta struct {
+	Count  json.RawMessage `json:"count,omitempty"`
+	Offset json.RawMessage `json:"offset,omitempty"`
+	Next   string          `json:"next,omitempty"`
+	Prev   string          `json:"prev,omitempty"`
+}
+
+// metaFields are the v1 response fields that move into meta
+var metaFields = []string{"count", "offset"}
+
+// bufferedWriter holds back the body a v1 handler writes so it can be re-shaped.
+// The status code is only recorded by gin until the first write, so it is not sent either.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Enveloped runs the rest of the chain (a v1 handler) and rewrites its JSON response into
+// an Envelope. dataKey names the v1 field holding the payload, unless the handler picked
+// another with common.SetDataKey; when empty, every field except success, error and the
+// meta fields becomes the payload. Responses that are not a JSON object are passed through
+// unchanged.
+func Enveloped(routeDataKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: original}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = original
+		dataKey := common.DataKey(c, routeDataKey)
+
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(buffered.body.Bytes(), &body); err != nil {
+			original.Write(buffered.body.Bytes())
+			return
+		}
+
+		status := buffered.Status()
+		envelope := Envelope{Meta: Meta{Count: body["count"], Offset: body["offset"]}}
+		for _, link := range original.Header().Values("Link") {
+			target, rel := parseLink(link)
+			switch rel {
+			case "next":
+				envelope.Meta.Next = target
+			case "prev":
+				envelope.Meta.Prev = target
+			}
+		}
+
+		if status >= http.StatusBadRequest {
+			envelope.Error = &Error{Code: errorCode(status), Message: errorMessage(body["error"], status), Fields: body["fields"]}
+		} else if dataKey != "" {
+			envelope.Data = body[dataKey]
+		} else {
+			delete(body, "success")
+			delete(body, "error")
+			for _, field := range metaFields {
+				delete(body, field)
+			}
+			envelope.Data = body
+		}
+
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			original.WriteHeader(http.StatusInternalServerError)
+			original.Write([]byte(`{"data":null,"error":{"code":"internal_server_error","message":"failed to encode response"},"meta":{}}`))
+			return
+		}
+		original.Header().Set("Content-Type", "application/json; charset=utf-8")
+		original.WriteHeader(status)
+		original.Write(data)
+	}
+}
+
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// errorMessage extracts the v1 "error" field, which is usually a string
+func errorMessage(raw json.RawMessage, status int) string {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil && message != "" {
+		return message
+	}
+	if len(raw) > 0 {
+		return string(raw)
+	}
+	return http.StatusText(status)
+}
+
+// parseLink splits a single `<url>; rel="name"` Link header value
+func parseLink(value string) (string, string) {
+	parts := strings.Split(value, ";")
+	target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "rel=") {
+			return target, strings.Trim(strings.TrimPrefix(param, "rel="), `"`)
+		}
+	}
+	return target, ""
+}
@@ -0,0 +1,141 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	viewsvc "github.com/rishichirchi/cloudloom/services/views"
+)
+
+// viewRequest is the body accepted when creating or updating a saved view
+type viewRequest struct {
+	Name   string            `json:"name" binding:"required"`
+	Target string            `json:"target" binding:"required,oneof=findings inventory"`
+	Params map[string]string `json:"params"`
+	Shared bool              `json:"shared"`
+}
+
+func (r viewRequest) toDefinition() viewsvc.Definition {
+	return viewsvc.Definition{Name: r.Name, Target: r.Target, Params: r.Params, Shared: r.Shared}
+}
+
+// requireScope resolves the view store, tenant and user, writing an error response if any is missing
+func requireScope(c *gin.Context) (*viewsvc.Store, string, string, bool) {
+	store := viewsvc.Default()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "saved views are not initialized", "success": false})
+		return nil, "", "", false
+	}
+	tenantID := common.TenantID(c)
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID is required", "success": false})
+		return nil, "", "", false
+	}
+	userID := common.UserID(c)
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required (" + common.UserHeader + " header)", "success": false})
+		return nil, "", "", false
+	}
+	return store, tenantID, userID, true
+}
+
+func writeViewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, viewsvc.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, viewsvc.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, viewsvc.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "success": false})
+	case errors.Is(err, viewsvc.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+	}
+}
+
+// ListViewsHandler lists the user's own views and those shared in the tenant, optionally for one ?target=
+func ListViewsHandler(c *gin.Context) {
+	store, tenantID, userID, ok := requireScope(c)
+	if !ok {
+		return
+	}
+
+	views, err := store.List(c.Request.Context(), tenantID, userID, c.Query("target"))
+	if err != nil {
+		writeViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"views": views, "count": len(views), "success": true})
+}
+
+// CreateViewHandler saves a named filter for the user, shared with the tenant if requested
+func CreateViewHandler(c *gin.Context) {
+	store, tenantID, userID, ok := requireScope(c)
+	if !ok {
+		return
+	}
+
+	var req viewRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	view, err := store.Create(c.Request.Context(), tenantID, userID, req.toDefinition())
+	if err != nil {
+		writeViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"view": view, "success": true})
+}
+
+// GetViewHandler returns a single view
+func GetViewHandler(c *gin.Context) {
+	store, tenantID, userID, ok := requireScope(c)
+	if !ok {
+		return
+	}
+
+	view, err := store.Get(c.Request.Context(), tenantID, userID, c.Param("id"))
+	if err != nil {
+		writeViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"view": view, "success": true})
+}
+
+// UpdateViewHandler replaces the definition of one of the user's views
+func UpdateViewHandler(c *gin.Context) {
+	store, tenantID, userID, ok := requireScope(c)
+	if !ok {
+		return
+	}
+
+	var req viewRequest
+	if !common.BindJSON(c, &req) {
+		return
+	}
+
+	view, err := store.Update(c.Request.Context(), tenantID, userID, c.Param("id"), req.toDefinition())
+	if err != nil {
+		writeViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"view": view, "success": true})
+}
+
+// DeleteViewHandler deletes one of the user's views
+func DeleteViewHandler(c *gin.Context) {
+	store, tenantID, userID, ok := requireScope(c)
+	if !ok {
+		return
+	}
+
+	if err := store.Delete(c.Request.Context(), tenantID, userID, c.Param("id")); err != nil {
+		writeViewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "View deleted", "success": true})
+}
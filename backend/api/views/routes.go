@@ -0,0 +1,12 @@
+package views
+
+import "github.com/rishichirchi/cloudloom/common"
+
+// SetupViewRoutes sets up the saved filter and view CRUD routes
+func SetupViewRoutes(router common.Router) {
+	router.GET("", "views", ListViewsHandler)
+	router.POST("", "view", CreateViewHandler)
+	router.GET("/:id", "view", GetViewHandler)
+	router.PUT("/:id", "view", UpdateViewHandler)
+	router.DELETE("/:id", "", DeleteViewHandler)
+}
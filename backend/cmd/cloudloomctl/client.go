@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client calls the CloudLoom HTTP API on behalf of one tenant
+type client struct {
+	baseURL  string
+	tenantID string
+	token    string
+	http     *http.Client
+}
+
+// apiError is the error body returned by the API
+type apiError struct {
+	Error  string `json:"error"`
+	Fields []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"fields"`
+}
+
+func (e apiError) String() string {
+	details := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		details = append(details, f.Field+" "+f.Message)
+	}
+	if len(details) == 0 {
+		return e.Error
+	}
+	return e.Error + ": " + strings.Join(details, "; ")
+}
+
+func newClient(baseURL, tenantID, token string) *client {
+	return &client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		tenantID: tenantID,
+		token:    token,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// do sends a request and returns the response if it has a 2xx status. The caller closes the body.
+func (c *client) do(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tenantID != "" {
+		req.Header.Set("X-Tenant-ID", c.tenantID)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var apiErr apiError
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s (HTTP %d)", method, path, apiErr, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON response into out, if out is not nil
+func (c *client) call(method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.do(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// job is the subset of a background job the CLI reports on
+type job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error"`
+	Attempts   int             `json:"attempts"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// waitForJob polls a job until it finishes or the timeout passes
+func (c *client) waitForJob(id string, timeout time.Duration) (*job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var resp struct {
+			Job job `json:"job"`
+		}
+		if err := c.call(http.MethodGet, "/jobs/"+id, nil, nil, &resp); err != nil {
+			return nil, err
+		}
+		switch resp.Job.Status {
+		case "succeeded", "failed":
+			return &resp.Job, nil
+		}
+		if time.Now().After(deadline) {
+			return &resp.Job, fmt.Errorf("job %s still %s after %s", id, resp.Job.Status, timeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cli dispatches subcommands and formats their output
+type cli struct {
+	client *client
+	json   bool
+}
+
+func (c *cli) run(command string, args []string) error {
+	switch command {
+	case "onboard":
+		return c.onboard(args)
+	case "scan":
+		return c.scan(args)
+	case "summary":
+		return c.summary(args)
+	case "findings":
+		return c.findings(args)
+	case "fixes":
+		return c.fixes(args)
+	case "jobs":
+		return c.jobs(args)
+	case "report":
+		return c.report(args)
+	}
+	return fmt.Errorf("unknown command %q (run cloudloomctl -h for usage)", command)
+}
+
+// print writes v as indented JSON, or calls table when table output was requested
+func (c *cli) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	if c.json || table == nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func (c *cli) requireTenant() error {
+	if c.client.tenantID == "" {
+		return errors.New("a tenant is required: pass -tenant or set CLOUDLOOM_TENANT_ID")
+	}
+	return nil
+}
+
+func (c *cli) onboard(args []string) error {
+	fs := flag.NewFlagSet("onboard", flag.ExitOnError)
+	roleARN := fs.String("role-arn", "", "ARN of the CloudLoom role created in the account (required)")
+	externalID := fs.String("external-id", "", "external ID the role trusts")
+	repo := fs.String("github-repo", "", "GitHub repository holding the account's infrastructure code")
+	region := fs.String("region", "", "home region for the account's CloudLoom resources (default ap-south-1)")
+	regions := fs.String("regions", "", "comma-separated regions to collect events from (default the home region and us-east-1)")
+	allRegions := fs.Bool("all-regions", false, "collect events from every region enabled in the account")
+	wait := fs.Bool("wait", false, "wait for setup to finish and fail if it fails")
+	timeout := fs.Duration("timeout", 30*time.Minute, "how long -wait waits")
+	dryRun := fs.Bool("dry-run", false, "show what setup would create or modify without changing anything")
+	kmsKey := fs.String("kms-key-arn", "", "customer managed KMS key to encrypt the account's logs with")
+	createKMSKey := fs.Bool("create-kms-key", false, "create a KMS key to encrypt the account's logs with")
+	s3DataEvents := fs.Bool("s3-data-events", false, "record S3 object-level API calls")
+	lambdaDataEvents := fs.Bool("lambda-data-events", false, "record Lambda function invocations")
+	insights := fs.Bool("insights", false, "enable CloudTrail Insights on API call and error rates")
+	retentionDays := fs.Int("retention-days", 0, "days to keep the account's CloudTrail and AWS Config logs (default forever)")
+	notify := fs.String("notify", "", "comma-separated email addresses and HTTPS URLs to send the account's notifications to")
+	replicationRegion := fs.String("replication-region", "", "region to replicate the account's log bucket to for disaster recovery")
+	existingTrail := fs.String("existing-trail-arn", "", "ARN of a multi-region trail of the customer's to reuse instead of creating one")
+	existingBucket := fs.String("existing-bucket", "", "log bucket of the customer's to deliver logs to instead of creating one")
+	force := fs.Bool("force", false, "run every setup step again instead of resuming a failed setup")
+	fs.Parse(args)
+	if *roleARN == "" {
+		return errors.New("-role-arn is required")
+	}
+
+	body := map[string]interface{}{"arnNumber": *roleARN}
+	if *externalID != "" {
+		body["externalId"] = *externalID
+	}
+	if *repo != "" {
+		body["githubRepoLink"] = *repo
+	}
+	if *region != "" {
+		body["region"] = *region
+	}
+	if *regions != "" {
+		body["regions"] = strings.Split(*regions, ",")
+	}
+	if *allRegions {
+		body["allRegions"] = true
+	}
+	if *kmsKey != "" {
+		body["kmsKeyArn"] = *kmsKey
+	}
+	if *createKMSKey {
+		body["createKmsKey"] = true
+	}
+	if *retentionDays > 0 {
+		body["retentionDays"] = *retentionDays
+	}
+	if *notify != "" {
+		body["notificationEndpoints"] = strings.Split(*notify, ",")
+	}
+	if *replicationRegion != "" {
+		body["replicationRegion"] = *replicationRegion
+	}
+	if *existingTrail != "" {
+		body["existingTrailArn"] = *existingTrail
+	}
+	if *existingBucket != "" {
+		body["existingBucketName"] = *existingBucket
+	}
+	if *s3DataEvents {
+		body["s3DataEvents"] = true
+	}
+	if *lambdaDataEvents {
+		body["lambdaDataEvents"] = true
+	}
+	if *insights {
+		body["insights"] = true
+	}
+
+	if *dryRun {
+		var resp struct {
+			Plan struct {
+				Changes []struct {
+					Kind   string `json:"kind"`
+					Name   string `json:"name"`
+					Region string `json:"region"`
+					Action string `json:"action"`
+					Detail string `json:"detail"`
+				} `json:"changes"`
+				MissingPermissions []struct {
+					Action   string `json:"action"`
+					Resource string `json:"resource"`
+				} `json:"missingPermissions"`
+				DisabledRegions []string `json:"disabledRegions"`
+			} `json:"plan"`
+		}
+		if err := c.client.call(http.MethodPost, "/configure/setup-cloudtrail", url.Values{"dryRun": {"true"}}, body, &resp); err != nil {
+			return err
+		}
+		return c.print(resp.Plan, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ACTION\tKIND\tNAME\tREGION\tDETAIL")
+			for _, change := range resp.Plan.Changes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Action, change.Kind, change.Name, change.Region, change.Detail)
+			}
+			for _, missing := range resp.Plan.MissingPermissions {
+				fmt.Fprintf(w, "missing permission\t%s\t%s\t\t\n", missing.Action, missing.Resource)
+			}
+			for _, region := range resp.Plan.DisabledRegions {
+				fmt.Fprintf(w, "region not enabled\t\t%s\t\t\n", region)
+			}
+		})
+	}
+
+	var resp struct {
+		Message string `json:"message"`
+		JobID   string `json:"jobId"`
+	}
+	var query url.Values
+	if *force {
+		query = url.Values{"force": {"true"}}
+	}
+	if err := c.client.call(http.MethodPost, "/configure/setup-cloudtrail", query, body, &resp); err != nil {
+		return err
+	}
+	if resp.JobID == "" {
+		fmt.Println(resp.Message)
+		return nil
+	}
+	if !*wait {
+		fmt.Printf("Setup queued as job %s\n", resp.JobID)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting for setup job %s...\n", resp.JobID)
+	finished, err := c.client.waitForJob(resp.JobID, *timeout)
+	if err != nil {
+		return err
+	}
+	if finished.Status == "failed" {
+		return fmt.Errorf("setup job %s failed: %s", finished.ID, finished.Error)
+	}
+	fmt.Fprintf(os.Stderr, "Setup job %s succeeded\n", finished.ID)
+	return nil
+}
+
+func (c *cli) scan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	wait := fs.Bool("wait", false, "wait for the scan to finish and fail if it fails")
+	timeout := fs.Duration("timeout", 30*time.Minute, "how long -wait waits")
+	fs.Parse(args)
+	if err := c.requireTenant(); err != nil {
+		return err
+	}
+
+	var started struct {
+		JobID  string `json:"jobId"`
+		Status string `json:"status"`
+	}
+	if err := c.client.call(http.MethodPost, "/infrastructure/inventory-scan", nil, nil, &started); err != nil {
+		return err
+	}
+	if !*wait {
+		return c.print(started, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "Scan queued as job %s\n", started.JobID)
+		})
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting for scan job %s...\n", started.JobID)
+	finished, err := c.client.waitForJob(started.JobID, *timeout)
+	if err != nil {
+		return err
+	}
+	if finished.Status == "failed" {
+		return fmt.Errorf("scan job %s failed: %s", finished.ID, finished.Error)
+	}
+	fmt.Fprintf(os.Stderr, "Scan job %s succeeded\n", finished.ID)
+	return nil
+}
+
+func (c *cli) summary(args []string) error {
+	if err := c.requireTenant(); err != nil {
+		return err
+	}
+	var resp map[string]interface{}
+	if err := c.client.call(http.MethodGet, "/infrastructure/summary", nil, nil, &resp); err != nil {
+		return err
+	}
+	return c.print(resp, nil)
+}
+
+// finding is the subset of a finding shown by the CLI
+type finding struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	Severity     string    `json:"severity"`
+	RuleID       string    `json:"ruleId"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Title        string    `json:"title"`
+	LastSeenAt   time.Time `json:"lastSeenAt"`
+}
+
+func (c *cli) findings(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cloudloomctl findings <list|status|suppress> [flags]")
+	}
+	if err := c.requireTenant(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("findings list", flag.ExitOnError)
+		status := fs.String("status", "", "only findings with this status")
+		resource := fs.String("resource", "", "only findings on this resource ID")
+		limit := fs.Int("limit", 100, "maximum number of findings")
+		failOn := fs.Bool("fail-if-any", false, "exit non-zero if any findings match (for CI gates)")
+		fs.Parse(args[1:])
+
+		query := url.Values{"limit": {strconv.Itoa(*limit)}}
+		if *status != "" {
+			query.Set("status", *status)
+		}
+		if *resource != "" {
+			query.Set("resourceId", *resource)
+		}
+		var resp struct {
+			Findings []finding `json:"findings"`
+		}
+		if err := c.client.call(http.MethodGet, "/findings", query, nil, &resp); err != nil {
+			return err
+		}
+		err := c.print(resp.Findings, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ID\tSTATUS\tSEVERITY\tRULE\tRESOURCE\tLAST SEEN")
+			for _, f := range resp.Findings {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s/%s\t%s\n", f.ID, f.Status, f.Severity, f.RuleID,
+					f.ResourceType, f.ResourceID, f.LastSeenAt.Format(time.RFC3339))
+			}
+		})
+		if err == nil && *failOn && len(resp.Findings) > 0 {
+			return fmt.Errorf("%d findings match", len(resp.Findings))
+		}
+		return err
+
+	case "status":
+		fs := flag.NewFlagSet("findings status", flag.ExitOnError)
+		status := fs.String("status", "", "new status: open, acknowledged or resolved (required)")
+		reason := fs.String("reason", "", "reason recorded with the change")
+		fs.Parse(args[1:])
+		if *status == "" || fs.NArg() == 0 {
+			return errors.New("usage: cloudloomctl findings status -status <status> [-reason text] <finding-id>...")
+		}
+		body := map[string]interface{}{"findingIds": fs.Args(), "status": *status, "reason": *reason}
+		return c.bulk("/findings/bulk/status", body)
+
+	case "suppress":
+		fs := flag.NewFlagSet("findings suppress", flag.ExitOnError)
+		reason := fs.String("reason", "", "why the findings are suppressed (required)")
+		until := fs.String("until", "", "RFC 3339 time the suppression ends (default: indefinitely)")
+		fs.Parse(args[1:])
+		if *reason == "" || fs.NArg() == 0 {
+			return errors.New("usage: cloudloomctl findings suppress -reason text [-until time] <finding-id>...")
+		}
+		body := map[string]interface{}{"findingIds": fs.Args(), "reason": *reason}
+		if *until != "" {
+			t, err := time.Parse(time.RFC3339, *until)
+			if err != nil {
+				return fmt.Errorf("invalid -until: %w", err)
+			}
+			body["until"] = t
+		}
+		return c.bulk("/findings/bulk/suppress", body)
+	}
+	return fmt.Errorf("unknown findings command %q", args[0])
+}
+
+// bulk runs a bulk findings operation and fails if any item was not applied
+func (c *cli) bulk(path string, body interface{}) error {
+	var resp struct {
+		Succeeded []string `json:"succeeded"`
+		Failed    []struct {
+			ID    string `json:"id"`
+			Error string `json:"error"`
+		} `json:"failed"`
+	}
+	if err := c.client.call(http.MethodPost, path, nil, body, &resp); err != nil {
+		return err
+	}
+	err := c.print(resp, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Updated %d findings\n", len(resp.Succeeded))
+		for _, failure := range resp.Failed {
+			fmt.Fprintf(w, "FAILED\t%s\t%s\n", failure.ID, failure.Error)
+		}
+	})
+	if err == nil && len(resp.Failed) > 0 {
+		return fmt.Errorf("%d findings were not updated", len(resp.Failed))
+	}
+	return err
+}
+
+// remediation is the subset of a proposed fix the CLI lists
+type remediation struct {
+	ID           string    `json:"id"`
+	FindingID    string    `json:"findingId"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (c *cli) fixes(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cloudloomctl fixes <list|approve> [flags]")
+	}
+	if err := c.requireTenant(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("fixes list", flag.ExitOnError)
+		status := fs.String("status", "pending", "only fixes with this status (empty for all)")
+		limit := fs.Int("limit", 100, "maximum number of fixes")
+		fs.Parse(args[1:])
+
+		query := url.Values{"limit": {strconv.Itoa(*limit)}}
+		if *status != "" {
+			query.Set("status", *status)
+		}
+		var resp struct {
+			Remediations []remediation `json:"remediations"`
+		}
+		if err := c.client.call(http.MethodGet, "/remediations", query, nil, &resp); err != nil {
+			return err
+		}
+		return c.print(resp.Remediations, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ID\tSTATUS\tACTION\tRESOURCE\tFINDING\tCREATED")
+			for _, r := range resp.Remediations {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\t%s\n", r.ID, r.Status, r.Action,
+					r.ResourceType, r.ResourceID, r.FindingID, r.CreatedAt.Format(time.RFC3339))
+			}
+		})
+
+	case "approve":
+		if len(args) < 2 {
+			return errors.New("usage: cloudloomctl fixes approve <remediation-id>...")
+		}
+		var approved []remediation
+		var failed int
+		for _, id := range args[1:] {
+			var resp struct {
+				Remediation remediation `json:"remediation"`
+			}
+			if err := c.client.call(http.MethodPost, "/remediations/"+url.PathEscape(id)+"/approve", nil, nil, &resp); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to approve %s: %v\n", id, err)
+				failed++
+				continue
+			}
+			approved = append(approved, resp.Remediation)
+		}
+		err := c.print(approved, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "Approved %d fixes\n", len(approved))
+			for _, r := range approved {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\n", r.ID, r.Status, r.Action, r.ResourceType, r.ResourceID)
+			}
+		})
+		if err == nil && failed > 0 {
+			return fmt.Errorf("%d fixes were not approved", failed)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown fixes command %q", args[0])
+}
+
+func (c *cli) jobs(args []string) error {
+	if len(args) != 2 || args[0] != "get" {
+		return errors.New("usage: cloudloomctl jobs get <job-id>")
+	}
+	var resp struct {
+		Job job `json:"job"`
+	}
+	if err := c.client.call(http.MethodGet, "/jobs/"+args[1], nil, nil, &resp); err != nil {
+		return err
+	}
+	return c.print(resp.Job, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ID\t%s\nTYPE\t%s\nSTATUS\t%s\nATTEMPTS\t%d\nCREATED\t%s\n",
+			resp.Job.ID, resp.Job.Type, resp.Job.Status, resp.Job.Attempts, resp.Job.CreatedAt.Format(time.RFC3339))
+		if resp.Job.Error != "" {
+			fmt.Fprintf(w, "ERROR\t%s\n", resp.Job.Error)
+		}
+	})
+}
+
+// reports maps report names to their export endpoints
+var reports = map[string]string{
+	"inventory":  "/exports/inventory",
+	"compliance": "/exports/compliance-report",
+	"events":     "/exports/events",
+	"waf":        "/exports/waf-report",
+	"exposure":   "/exports/public-exposure",
+}
+
+func (c *cli) report(args []string) error {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	kind := fs.String("type", "inventory", "report to download: "+strings.Join(names, ", "))
+	out := fs.String("out", "", "file to write the NDJSON report to (default: stdout)")
+	from := fs.String("from", "", "events only: RFC 3339 start time")
+	fs.Parse(args)
+	if err := c.requireTenant(); err != nil {
+		return err
+	}
+
+	path, ok := reports[*kind]
+	if !ok {
+		return fmt.Errorf("unknown report type %q", *kind)
+	}
+	query := url.Values{}
+	if *from != "" {
+		query.Set("from", *from)
+	}
+
+	resp, err := c.client.do(http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	written, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download report: %w", err)
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d bytes to %s\n", written, *out)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Command cloudloomctl drives the CloudLoom API from scripts and CI pipelines.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `cloudloomctl talks to the CloudLoom API.
+
+Usage:
+  cloudloomctl [global flags] <command> [flags]
+
+Commands:
+  onboard            Connect an AWS account through its CloudLoom role
+  scan               Run an inventory scan (use -wait in CI)
+  summary            Show the latest inventory summary
+  findings list      List findings
+  findings status    Set the status of findings (e.g. acknowledged, resolved)
+  findings suppress  Suppress findings until a date
+  fixes list         List proposed fixes (pending approval by default)
+  fixes approve      Approve proposed fixes (needs an admin token)
+  jobs get           Show a background job
+  report             Download an inventory, compliance, WAF, exposure or events report
+
+Global flags (also read from CLOUDLOOM_API_URL, CLOUDLOOM_TENANT_ID, CLOUDLOOM_TOKEN):
+`
+
+func main() {
+	global := flag.NewFlagSet("cloudloomctl", flag.ExitOnError)
+	apiURL := global.String("api", envOr("CLOUDLOOM_API_URL", "http://localhost:5000/api/v1"), "API base URL")
+	tenantID := global.String("tenant", os.Getenv("CLOUDLOOM_TENANT_ID"), "tenant (AWS account) ID")
+	token := global.String("token", os.Getenv("CLOUDLOOM_TOKEN"), "bearer token for admin endpoints")
+	output := global.String("o", "table", "output format: table or json")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+
+	cli := &cli{client: newClient(*apiURL, *tenantID, *token), json: *output == "json"}
+	if err := cli.run(args[0], args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,60 @@
+// Command e2e runs the CloudLoom setup, scan and remediation flow against LocalStack
+// (or moto) with misconfiguration fixtures, exiting non-zero when any step fails.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/harness"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", envOr("CLOUDLOOM_E2E_ENDPOINT", harness.DefaultEndpoint), "AWS emulator endpoint")
+	fixtures := flag.String("fixtures", "", "comma-separated fixtures to seed (default all: "+strings.Join(harness.FixtureNames(), ", ")+")")
+	keep := flag.Bool("keep", false, "leave seeded fixtures in place after the run")
+	withMongo := flag.Bool("mongo", true, "store the scan and findings in MongoDB (MONGO_URI)")
+	timeout := flag.Duration("timeout", 10*time.Minute, "overall time limit")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *withMongo {
+		config.InitMongo()
+		findings.Init(config.MongoDB)
+		jobs.Init(config.MongoDB, 1)
+	}
+
+	opts := harness.Options{Endpoint: *endpoint, Keep: *keep}
+	if *fixtures != "" {
+		opts.Fixtures = strings.Split(*fixtures, ",")
+	}
+	h, err := harness.New(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	report := h.Run(ctx)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdminToken rejects requests that do not carry the ADMIN_API_TOKEN as a bearer token.
+// Destructive endpoints are disabled entirely when the token is not configured.
+func RequireAdminToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := os.Getenv("ADMIN_API_TOKEN")
+		if expected == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "admin API is not configured", "success": false})
+			return
+		}
+
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing admin token", "success": false})
+			return
+		}
+		c.Next()
+	}
+}
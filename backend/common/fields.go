@@ -0,0 +1,52 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fields returns the comma-separated ?fields= selection of a list request, or nil when the
+// client wants full objects
+func Fields(c *gin.Context) []string {
+	var fields []string
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// SelectFields reduces each element of items to the given top-level JSON fields plus "id".
+// Unknown fields are ignored, and items are returned unchanged when fields is empty.
+func SelectFields(items interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, field := range fields {
+		keep[field] = true
+	}
+	selected := make([]map[string]json.RawMessage, len(rows))
+	for i, row := range rows {
+		selected[i] = make(map[string]json.RawMessage, len(keep))
+		for key, value := range row {
+			if keep[key] {
+				selected[i][key] = value
+			}
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,15 @@
+package common
+
+// AllowedOrigins are the frontend origins permitted to call the API from a browser,
+// for both CORS requests and WebSocket upgrades
+var AllowedOrigins = []string{"http://localhost:3000", "http://localhost:3001", "https://your-frontend-domain.com"}
+
+// IsAllowedOrigin reports whether origin is one of AllowedOrigins
+func IsAllowedOrigin(origin string) bool {
+	for _, allowed := range AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for a customer-supplied URL that points, or connects, to an
+// address inside CloudLoom's network
+var ErrBlockedAddress = errors.New("address is not publicly routable")
+
+// IsBlockedAddress reports whether requests to customer-supplied URLs may not reach ip: a
+// loopback, private, link-local or unspecified address. It is a variable so tests can post to
+// local servers.
+var IsBlockedAddress = func(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// CheckPublicHost rejects a URL host that is a blocked IP address or a localhost name. Other
+// names are checked when connecting, by PublicHTTPClient.
+func CheckPublicHost(host string) error {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && IsBlockedAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// publicOnly is a dialer Control hook that refuses to connect to blocked addresses, so a name
+// that resolves to one is not reached either
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || IsBlockedAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// PublicHTTPClient returns a client for customer-supplied URLs that only connects to publicly
+// routable addresses. It does not use a proxy, since the proxy's address would be checked
+// instead of the destination's.
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnly,
+	}).DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
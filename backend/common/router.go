@@ -0,0 +1,78 @@
+package common
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dataKeyContext is the context key a handler stores its response's data key under
+const dataKeyContext = "cloudloom.dataKey"
+
+// Router registers an API package's routes on one version's route group, so /api/v1 and
+// /api/v2 are built from the same table. Each route names the field of its JSON response
+// that holds the payload; a version that wraps responses uses it to find the data.
+type Router struct {
+	group *gin.RouterGroup
+	wrap  func(dataKey string) gin.HandlerFunc
+}
+
+// NewRouter returns a Router for the group. wrap, if set, runs ahead of every route that is
+// not raw and is given the route's data key.
+func NewRouter(group *gin.RouterGroup, wrap func(dataKey string) gin.HandlerFunc) Router {
+	return Router{group: group, wrap: wrap}
+}
+
+// Handle registers a route whose payload is the response's dataKey field. An empty dataKey
+// means the payload is every field of the response.
+func (r Router) Handle(method, path, dataKey string, handlers ...gin.HandlerFunc) {
+	if r.wrap != nil {
+		handlers = append([]gin.HandlerFunc{r.wrap(dataKey)}, handlers...)
+	}
+	r.group.Handle(method, path, handlers...)
+}
+
+// Raw registers a route whose response is streamed or has a format of its own, such as file
+// exports, WebSockets and GraphQL. It is served the same in every version.
+func (r Router) Raw(method, path string, handlers ...gin.HandlerFunc) {
+	r.group.Handle(method, path, handlers...)
+}
+
+// GET registers a GET route, see Handle
+func (r Router) GET(path, dataKey string, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodGet, path, dataKey, handlers...)
+}
+
+// POST registers a POST route, see Handle
+func (r Router) POST(path, dataKey string, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPost, path, dataKey, handlers...)
+}
+
+// PUT registers a PUT route, see Handle
+func (r Router) PUT(path, dataKey string, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPut, path, dataKey, handlers...)
+}
+
+// PATCH registers a PATCH route, see Handle
+func (r Router) PATCH(path, dataKey string, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodPatch, path, dataKey, handlers...)
+}
+
+// DELETE registers a DELETE route, see Handle
+func (r Router) DELETE(path, dataKey string, handlers ...gin.HandlerFunc) {
+	r.Handle(http.MethodDelete, path, dataKey, handlers...)
+}
+
+// SetDataKey overrides the route's data key for this response, for handlers whose response
+// shape depends on the request
+func SetDataKey(c *gin.Context, dataKey string) {
+	c.Set(dataKeyContext, dataKey)
+}
+
+// DataKey returns the data key a handler set with SetDataKey, or fallback
+func DataKey(c *gin.Context, fallback string) string {
+	if dataKey, ok := c.Get(dataKeyContext); ok {
+		return dataKey.(string)
+	}
+	return fallback
+}
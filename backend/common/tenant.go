@@ -0,0 +1,23 @@
+package common
+
+import "github.com/gin-gonic/gin"
+
+// TenantHeader carries the customer AWS account ID that a request is scoped to
+const TenantHeader = "X-Tenant-ID"
+
+// TenantID returns the tenant a request is scoped to, from the X-Tenant-ID
+// header or the tenantId query parameter
+func TenantID(c *gin.Context) string {
+	if tenantID := c.GetHeader(TenantHeader); tenantID != "" {
+		return tenantID
+	}
+	return c.Query("tenantId")
+}
+
+// UserHeader identifies the user within the tenant that a request is made by
+const UserHeader = "X-User-ID"
+
+// UserID returns the user a request is made by, from the X-User-ID header
+func UserID(c *gin.Context) string {
+	return c.GetHeader(UserHeader)
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	roleARNPattern   = regexp.MustCompile(`^arn:aws(-[a-z]+)*:iam::\d{12}:role/[\w+=,.@/-]{1,512}$`)
+	awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d$`)
+	kmsKeyARNPattern = regexp.MustCompile(`^arn:aws(-[a-z]+)*:kms:[a-z0-9-]+:\d{12}:key/[a-zA-Z0-9-]+$`)
+)
+
+// IsRoleARN reports whether s is an IAM role ARN
+func IsRoleARN(s string) bool {
+	return roleARNPattern.MatchString(s)
+}
+
+// IsAWSRegion reports whether s looks like an AWS region code, e.g. ap-south-1
+func IsAWSRegion(s string) bool {
+	return awsRegionPattern.MatchString(s)
+}
+
+// IsKMSKeyARN reports whether s is the ARN of a KMS key, not of an alias
+func IsKMSKeyARN(s string) bool {
+	return kmsKeyARNPattern.MatchString(s)
+}
+
+// FieldError describes why one field of a request body was rejected
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "resources[2].resourceId"
+	Field string `json:"field"`
+	// Rule is the validation rule that failed, e.g. "required" or "awsregion"
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// RegisterValidators adds CloudLoom's custom binding rules (awsrolearn, awsregion,
+// kmskeyarn) and makes validation errors name fields by their JSON names
+func RegisterValidators() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	v.RegisterValidation("awsrolearn", func(fl validator.FieldLevel) bool {
+		return IsRoleARN(fl.Field().String())
+	})
+	v.RegisterValidation("awsregion", func(fl validator.FieldLevel) bool {
+		return IsAWSRegion(fl.Field().String())
+	})
+	v.RegisterValidation("kmskeyarn", func(fl validator.FieldLevel) bool {
+		return IsKMSKeyARN(fl.Field().String())
+	})
+}
+
+// BindJSON binds the request body into obj. On failure it responds 400 with a field-level
+// breakdown under "fields" and returns false.
+func BindJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "request validation failed", "fields": FieldErrors(err), "success": false})
+	return false
+}
+
+// FieldErrors converts a binding error into per-field errors
+func FieldErrors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fe.Namespace()),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: ruleMessage(fe),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: fmt.Sprintf("must be of type %s, got %s", jsonType(typeErr.Type), typeErr.Value),
+		}}
+	}
+	return []FieldError{{Field: "", Rule: "json", Message: err.Error()}}
+}
+
+// fieldPath drops the struct name validator puts in front of the JSON path
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "awsrolearn":
+		return "must be an IAM role ARN (arn:aws:iam::<account-id>:role/<name>)"
+	case "awsregion":
+		return "must be an AWS region code such as us-east-1"
+	case "kmskeyarn":
+		return "must be a KMS key ARN (arn:aws:kms:<region>:<account-id>:key/<key-id>)"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "email":
+		return "must be an email address"
+	case "url":
+		return "must be a URL"
+	default:
+		return fmt.Sprintf("failed the '%s' rule", fe.Tag())
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return t.String()
+}
@@ -11,7 +11,10 @@ import (
 var AWSConfig aws.Config
 
 func InitAWS() {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("ap-south-1"))
+	ctx, cancel := WithAWSTimeout(context.Background())
+	defer cancel()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("ap-south-1"), config.WithAPIOptions(AWSAPIOptions()))
 	if err != nil {
 		panic("unable to load SDK config, " + err.Error())
 	}
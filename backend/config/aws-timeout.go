@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// AWSCallTimeout bounds every individual AWS SDK operation, including each paginator page.
+// Override with AWS_CALL_TIMEOUT_SECONDS.
+var AWSCallTimeout = awsCallTimeoutFromEnv()
+
+func awsCallTimeoutFromEnv() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("AWS_CALL_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// WithOperationTimeout returns an API option that gives each SDK operation its own deadline,
+// so a hung call fails instead of stalling the caller. Retries of the operation share the deadline.
+func WithOperationTimeout(timeout time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CloudLoomOperationTimeout",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
+
+// AWSAPIOptions returns the API options applied to every AWS config the backend loads
+func AWSAPIOptions() []func(*middleware.Stack) error {
+	return []func(*middleware.Stack) error{WithOperationTimeout(AWSCallTimeout)}
+}
+
+// WithAWSTimeout bounds work that is not a single SDK operation, such as loading credentials
+func WithAWSTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, AWSCallTimeout)
+}
+
+// SleepContext waits for d or until ctx is cancelled, returning ctx.Err() in the latter case
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -28,7 +28,10 @@ func InitMongo() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	// Decode untyped sub-documents (e.g. job results) as maps so they serialize cleanly to JSON
+	clientOptions := options.Client().ApplyURI(mongoURI).SetBSONOptions(&options.BSONOptions{
+		DefaultDocumentM: true,
+	})
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
@@ -42,4 +45,10 @@ func InitMongo() {
 	MongoClient = client
 	MongoDB = client.Database(dbName)
 	fmt.Println("✅ Connected to MongoDB successfully")
+
+	schemaCtx, schemaCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer schemaCancel()
+	if err := EnsureSchema(schemaCtx, MongoDB); err != nil {
+		log.Printf("[Mongo] Warning: %v", err)
+	}
 }
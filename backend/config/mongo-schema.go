@@ -0,0 +1,191 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDB collections used by the backend
+const (
+	CollectionJobs                = "jobs"
+	CollectionSchedules           = "schedules"
+	CollectionDeliveryBuffer      = "delivery_buffer"
+	CollectionEvents              = "events"
+	CollectionFindings            = "findings"
+	CollectionExclusions          = "exclusions"
+	CollectionAuditLogs           = "audit_logs"
+	CollectionRemediationAudit    = "remediation_audit"
+	CollectionRetention           = "retention_policies"
+	CollectionSecrets             = "secrets"
+	CollectionSavedViews          = "saved_views"
+	CollectionAccountConfig       = "account_config"
+	CollectionKeyRotations        = "access_key_rotations"
+	CollectionRemediations        = "remediations"
+	CollectionTenants             = "tenants"
+	CollectionOrgOnboardings      = "org_onboardings"
+	CollectionResourceHistory     = "resource_history"
+	CollectionTagPolicies         = "tag_policies"
+	CollectionCacheEntries        = "cache_entries"
+	CollectionDeadLetters         = "dead_letters"
+	CollectionEventSubscriptions  = "event_subscriptions"
+	CollectionNotificationTargets = "notification_targets"
+	CollectionPlaybooks           = "playbooks"
+	CollectionGuardrails          = "guardrails"
+	CollectionWebhooks            = "webhooks"
+	CollectionTicketingSettings   = "ticketing_settings"
+	CollectionTickets             = "tickets"
+	CollectionNotifiers           = "notifiers"
+)
+
+// collectionIndexes lists the indexes every collection needs. Index names are explicit so
+// changing a definition shows up as a conflict at startup instead of silently duplicating.
+var collectionIndexes = map[string][]mongo.IndexModel{
+	CollectionJobs: {
+		// Worker claim: queued jobs that are due, earliest first
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextRunAt", Value: 1}}, Options: options.Index().SetName("status_nextRunAt")},
+		// Latest successful job (snapshot) per tenant and type
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "finishedAt", Value: -1}}, Options: options.Index().SetName("type_tenant_status_finishedAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("tenant_createdAt")},
+	},
+	CollectionSchedules: {
+		{Keys: bson.D{{Key: "enabled", Value: 1}, {Key: "nextRunAt", Value: 1}}, Options: options.Index().SetName("enabled_nextRunAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: 1}}, Options: options.Index().SetName("tenant_createdAt")},
+	},
+	CollectionDeliveryBuffer: {
+		{Keys: bson.D{{Key: "nextAttemptAt", Value: 1}, {Key: "createdAt", Value: 1}}, Options: options.Index().SetName("nextAttemptAt_createdAt")},
+		{Keys: bson.D{{Key: "sink", Value: 1}, {Key: "destination", Value: 1}, {Key: "createdAt", Value: 1}}, Options: options.Index().SetName("sink_destination_createdAt")},
+	},
+	CollectionEvents: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "eventId", Value: 1}}, Options: options.Index().SetName("tenant_eventId").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "eventTime", Value: 1}}, Options: options.Index().SetName("tenant_eventTime")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "source", Value: 1}, {Key: "eventTime", Value: 1}}, Options: options.Index().SetName("tenant_source_eventTime")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "processing.status", Value: 1}, {Key: "eventTime", Value: 1}}, Options: options.Index().SetName("tenant_processingStatus_eventTime")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "detailType", Value: 1}, {Key: "region", Value: 1}, {Key: "eventTime", Value: 1}}, Options: options.Index().SetName("tenant_detailType_region_eventTime")},
+	},
+	CollectionFindings: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "fingerprint", Value: 1}}, Options: options.Index().SetName("tenant_fingerprint").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "lastSeenAt", Value: -1}}, Options: options.Index().SetName("tenant_status_lastSeenAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "resourceId", Value: 1}}, Options: options.Index().SetName("tenant_resourceId")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "severity", Value: 1}, {Key: "lastSeenAt", Value: -1}}, Options: options.Index().SetName("tenant_severity_lastSeenAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "source", Value: 1}, {Key: "lastSeenAt", Value: 1}}, Options: options.Index().SetName("tenant_source_lastSeenAt")},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "suppressedUntil", Value: 1}}, Options: options.Index().SetName("status_suppressedUntil")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "assignee", Value: 1}, {Key: "lastSeenAt", Value: -1}}, Options: options.Index().SetName("tenant_assignee_lastSeenAt")},
+	},
+	CollectionExclusions: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "resourceId", Value: 1}}, Options: options.Index().SetName("tenant_resourceId").SetUnique(true)},
+	},
+	CollectionAuditLogs: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "timestamp", Value: -1}}, Options: options.Index().SetName("tenant_timestamp")},
+	},
+	CollectionRemediationAudit: {
+		// One record per position in the tenant's chain, so concurrent appends cannot fork it
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "sequence", Value: 1}}, Options: options.Index().SetName("tenant_sequence").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "remediationId", Value: 1}}, Options: options.Index().SetName("tenant_remediationId")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "occurredAt", Value: 1}}, Options: options.Index().SetName("tenant_occurredAt")},
+	},
+	CollectionRetention: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionSavedViews: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "ownerId", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetName("tenant_owner_name").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "shared", Value: 1}}, Options: options.Index().SetName("tenant_shared")},
+	},
+	CollectionAccountConfig: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionKeyRotations: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("tenant_createdAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "userName", Value: 1}, {Key: "status", Value: 1}}, Options: options.Index().SetName("tenant_user_status")},
+	},
+	CollectionRemediations: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("tenant_createdAt")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "fingerprint", Value: 1}, {Key: "status", Value: 1}}, Options: options.Index().SetName("tenant_fingerprint_status")},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "startedAt", Value: -1}}, Options: options.Index().SetName("tenant_startedAt")},
+	},
+	CollectionTenants: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionOrgOnboardings: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("tenant_createdAt")},
+	},
+	CollectionResourceHistory: {
+		// One entry per configuration state, so re-reading a delivery file records nothing new
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "resourceType", Value: 1}, {Key: "resourceId", Value: 1}, {Key: "stateId", Value: 1}}, Options: options.Index().SetName("tenant_resource_stateId").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "resourceId", Value: 1}, {Key: "capturedAt", Value: -1}}, Options: options.Index().SetName("tenant_resourceId_capturedAt")},
+	},
+	CollectionTagPolicies: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionCacheEntries: {
+		// Entries expire once expiresAt passes; entries without one are kept until deleted
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0)},
+	},
+	CollectionEventSubscriptions: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionNotificationTargets: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "destination", Value: 1}}, Options: options.Index().SetName("tenant_destination").SetUnique(true)},
+	},
+	CollectionPlaybooks: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetName("tenant_name").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "enabled", Value: 1}, {Key: "priority", Value: 1}}, Options: options.Index().SetName("tenant_enabled_priority")},
+	},
+	CollectionGuardrails: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionWebhooks: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "url", Value: 1}}, Options: options.Index().SetName("tenant_url").SetUnique(true)},
+	},
+	CollectionNotifiers: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetName("tenant_name").SetUnique(true)},
+	},
+	CollectionTicketingSettings: {
+		{Keys: bson.D{{Key: "tenantId", Value: 1}}, Options: options.Index().SetName("tenantId").SetUnique(true)},
+	},
+	CollectionTickets: {
+		// A finding has at most one open ticket; a reopened finding gets a new one
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "findingId", Value: 1}}, Options: options.Index().SetName("tenant_findingId_open").SetUnique(true).SetPartialFilterExpression(bson.M{"state": "open"})},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "state", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("tenant_state_createdAt")},
+	},
+	CollectionDeadLetters: {
+		// A dead-letter queue may deliver a message again if deleting it failed
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "messageId", Value: 1}}, Options: options.Index().SetName("tenant_messageId").SetUnique(true)},
+		{Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "status", Value: 1}, {Key: "deadLetteredAt", Value: -1}}, Options: options.Index().SetName("tenant_status_deadLetteredAt")},
+	},
+}
+
+// RegisterIndexes adds indexes a package needs on a collection, creating the collection with
+// the others. Packages call it from init, so the indexes are known before EnsureSchema runs.
+func RegisterIndexes(collection string, indexes ...mongo.IndexModel) {
+	collectionIndexes[collection] = append(collectionIndexes[collection], indexes...)
+}
+
+// EnsureSchema creates every collection and its indexes. It is idempotent and runs at startup.
+func EnsureSchema(ctx context.Context, db *mongo.Database) error {
+	existing, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+	present := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		present[name] = true
+	}
+
+	for name, indexes := range collectionIndexes {
+		if !present[name] {
+			if err := db.CreateCollection(ctx, name); err != nil {
+				return fmt.Errorf("failed to create collection %s: %w", name, err)
+			}
+		}
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", name, err)
+		}
+	}
+	log.Printf("[Mongo] ✅ Schema ensured for %d collections", len(collectionIndexes))
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrWaitTimeout is returned when a waited-for condition does not hold before the timeout
+var ErrWaitTimeout = errors.New("timed out waiting for condition")
+
+// Waiter polls a condition with exponential backoff and jitter, for resources that take an
+// unknown time to become usable, such as new IAM roles
+type Waiter struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Timeout      time.Duration
+}
+
+// Wait calls ready until it reports true or returns an error, the timeout passes or ctx is
+// cancelled. Each delay doubles up to MaxDelay and is jittered down by up to half, so
+// concurrent waiters do not poll in lockstep.
+func (w Waiter) Wait(ctx context.Context, ready func(context.Context) (bool, error)) error {
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	delay := w.InitialDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		ok, err := ready(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		jittered := delay/2 + rand.N(delay/2+1)
+		if err := SleepContext(ctx, jittered); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %d attempts", ErrWaitTimeout, attempt)
+			}
+			return err
+		}
+		if delay *= 2; w.MaxDelay > 0 && delay > w.MaxDelay {
+			delay = w.MaxDelay
+		}
+	}
+}
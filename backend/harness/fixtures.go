@@ -0,0 +1,230 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fixturePrefix names every seeded resource so runs can be told apart and cleaned up
+const fixturePrefix = "cloudloom-e2e"
+
+// Expectation is a resource a fixture expects the inventory scan to report
+type Expectation struct {
+	// ResourceType is the AWS Config resource type, or PolicyResourceType for a
+	// customer-managed IAM policy reported in the inventory's policies
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+}
+
+// PolicyResourceType marks expectations matched against inventory policies by name
+const PolicyResourceType = "AWS::IAM::Policy"
+
+// Fixture seeds one common misconfiguration into the emulated account
+type Fixture struct {
+	Name        string
+	Description string
+	// Seed creates the misconfigured resources and returns what the scan should find
+	Seed func(ctx context.Context, cfg aws.Config) ([]Expectation, error)
+	// Cleanup removes the resources again; errors for missing resources are ignored
+	Cleanup func(ctx context.Context, cfg aws.Config) error
+}
+
+// Fixtures are the built-in misconfigurations keyed by name
+var Fixtures = map[string]Fixture{
+	"public-s3-bucket": {
+		Name:        "public-s3-bucket",
+		Description: "S3 bucket with no public access block and a bucket policy granting s3:GetObject to everyone",
+		Seed:        seedPublicBucket,
+		Cleanup:     cleanupPublicBucket,
+	},
+	"iam-user-without-mfa": {
+		Name:        "iam-user-without-mfa",
+		Description: "IAM user with a console password and no MFA device",
+		Seed:        seedUserWithoutMFA,
+		Cleanup:     cleanupUserWithoutMFA,
+	},
+	"iam-admin-policy": {
+		Name:        "iam-admin-policy",
+		Description: "Customer-managed IAM policy allowing every action on every resource",
+		Seed:        seedAdminPolicy,
+		Cleanup:     cleanupAdminPolicy,
+	},
+	"public-sqs-queue": {
+		Name:        "public-sqs-queue",
+		Description: "SQS queue whose policy lets any principal send messages",
+		Seed:        seedPublicQueue,
+		Cleanup:     cleanupPublicQueue,
+	},
+}
+
+// FixtureNames returns the names of the built-in fixtures in sorted order
+func FixtureNames() []string {
+	names := make([]string, 0, len(Fixtures))
+	for name := range Fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup resolves fixture names, returning every fixture when names is empty
+func Lookup(names []string) ([]Fixture, error) {
+	if len(names) == 0 {
+		names = FixtureNames()
+	}
+	result := make([]Fixture, 0, len(names))
+	for _, name := range names {
+		fixture, ok := Fixtures[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown fixture %q", name)
+		}
+		result = append(result, fixture)
+	}
+	return result, nil
+}
+
+var (
+	publicBucketName = fixturePrefix + "-public-bucket"
+	noMFAUserName    = fixturePrefix + "-no-mfa-user"
+	adminPolicyName  = fixturePrefix + "-admin-policy"
+	publicQueueName  = fixturePrefix + "-public-queue"
+)
+
+const adminPolicyDocument = `{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*"}]
+}`
+
+func seedPublicBucket(ctx context.Context, cfg aws.Config) ([]Expectation, error) {
+	client := s3.NewFromConfig(cfg)
+	input := &s3.CreateBucketInput{Bucket: aws.String(publicBucketName)}
+	if cfg.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(cfg.Region),
+		}
+	}
+	if _, err := client.CreateBucket(ctx, input); err != nil {
+		var owned *s3types.BucketAlreadyOwnedByYou
+		if !errors.As(err, &owned) {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	}
+
+	if _, err := client.DeletePublicAccessBlock(ctx, &s3.DeletePublicAccessBlockInput{Bucket: aws.String(publicBucketName)}); err != nil {
+		return nil, fmt.Errorf("failed to remove public access block: %w", err)
+	}
+	policy := fmt.Sprintf(`{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::%s/*"}]
+}`, publicBucketName)
+	if _, err := client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(publicBucketName),
+		Policy: aws.String(policy),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to put bucket policy: %w", err)
+	}
+
+	return []Expectation{{ResourceType: "AWS::S3::Bucket", ResourceID: publicBucketName}}, nil
+}
+
+func cleanupPublicBucket(ctx context.Context, cfg aws.Config) error {
+	_, err := s3.NewFromConfig(cfg).DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(publicBucketName)})
+	var missing *s3types.NoSuchBucket
+	if err != nil && !errors.As(err, &missing) {
+		return fmt.Errorf("failed to delete bucket: %w", err)
+	}
+	return nil
+}
+
+func seedUserWithoutMFA(ctx context.Context, cfg aws.Config) ([]Expectation, error) {
+	client := iam.NewFromConfig(cfg)
+	user, err := client.CreateUser(ctx, &iam.CreateUserInput{UserName: aws.String(noMFAUserName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if _, err := client.CreateLoginProfile(ctx, &iam.CreateLoginProfileInput{
+		UserName: aws.String(noMFAUserName),
+		Password: aws.String("CloudLoom-e2e-Passw0rd!"),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create login profile: %w", err)
+	}
+
+	return []Expectation{{ResourceType: "AWS::IAM::User", ResourceID: aws.ToString(user.User.UserId)}}, nil
+}
+
+func cleanupUserWithoutMFA(ctx context.Context, cfg aws.Config) error {
+	client := iam.NewFromConfig(cfg)
+	client.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{UserName: aws.String(noMFAUserName)})
+	if _, err := client.DeleteUser(ctx, &iam.DeleteUserInput{UserName: aws.String(noMFAUserName)}); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+func seedAdminPolicy(ctx context.Context, cfg aws.Config) ([]Expectation, error) {
+	if _, err := iam.NewFromConfig(cfg).CreatePolicy(ctx, &iam.CreatePolicyInput{
+		PolicyName:     aws.String(adminPolicyName),
+		PolicyDocument: aws.String(adminPolicyDocument),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create policy: %w", err)
+	}
+	return []Expectation{{ResourceType: PolicyResourceType, ResourceID: adminPolicyName}}, nil
+}
+
+func cleanupAdminPolicy(ctx context.Context, cfg aws.Config) error {
+	client := iam.NewFromConfig(cfg)
+	identity, err := callerAccount(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	arn := fmt.Sprintf("arn:aws:iam::%s:policy/%s", identity, adminPolicyName)
+	if _, err := client.DeletePolicy(ctx, &iam.DeletePolicyInput{PolicyArn: aws.String(arn)}); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete policy: %w", err)
+	}
+	return nil
+}
+
+func seedPublicQueue(ctx context.Context, cfg aws.Config) ([]Expectation, error) {
+	client := sqs.NewFromConfig(cfg)
+	queue, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(publicQueueName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue: %w", err)
+	}
+	policy := `{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": "*", "Action": "sqs:SendMessage", "Resource": "*"}]
+}`
+	if _, err := client.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   queue.QueueUrl,
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): policy},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set queue policy: %w", err)
+	}
+
+	return []Expectation{{ResourceType: "AWS::SQS::Queue", ResourceID: aws.ToString(queue.QueueUrl)}}, nil
+}
+
+func cleanupPublicQueue(ctx context.Context, cfg aws.Config) error {
+	client := sqs.NewFromConfig(cfg)
+	queue, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(publicQueueName)})
+	if err != nil {
+		var missing *sqstypes.QueueDoesNotExist
+		if errors.As(err, &missing) {
+			return nil
+		}
+		return fmt.Errorf("failed to look up queue: %w", err)
+	}
+	if _, err := client.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: queue.QueueUrl}); err != nil {
+		return fmt.Errorf("failed to delete queue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Package harness drives the CloudLoom setup, scan and remediation flow end to end against
+// an emulated AWS account such as LocalStack or moto, seeded with misconfiguration fixtures.
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/rishichirchi/cloudloom/common"
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// DefaultEndpoint is LocalStack's edge port. The localstack.cloud name resolves to
+// 127.0.0.1 for every subdomain, so virtual-hosted S3 bucket addressing keeps working.
+const DefaultEndpoint = "http://localhost.localstack.cloud:4566"
+
+// roleName is the customer role the setup flow assumes, created in the emulated account
+const roleName = "CloudLoomAutoApplyFixRole"
+
+// Options configure a harness run
+type Options struct {
+	Endpoint string
+	// Region must match the region the services assume roles into
+	Region   string
+	Fixtures []string
+	// Keep leaves the seeded fixtures in place after the run for debugging
+	Keep bool
+}
+
+// Step statuses
+const (
+	StepPassed = "passed"
+	StepFailed = "failed"
+)
+
+// StepResult is the outcome of one stage of the flow
+type StepResult struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of a harness run
+type Report struct {
+	Endpoint  string        `json:"endpoint"`
+	AccountID string        `json:"accountId"`
+	Fixtures  []string      `json:"fixtures"`
+	Missing   []Expectation `json:"missing,omitempty"`
+	Steps     []StepResult  `json:"steps"`
+	Passed    bool          `json:"passed"`
+}
+
+// Harness runs the flow against one emulated account
+type Harness struct {
+	opts      Options
+	fixtures  []Fixture
+	cfg       aws.Config
+	accountID string
+}
+
+// New points the AWS SDK at the emulator, creates the CloudLoom role there and
+// points the services at it. The process-wide AWS configuration is replaced, so
+// a harness must not share a process with a server talking to real AWS.
+func New(ctx context.Context, opts Options) (*Harness, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = DefaultEndpoint
+	}
+	if opts.Region == "" {
+		opts.Region = "ap-south-1"
+	}
+	fixtures, err := Lookup(opts.Fixtures)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every client the services build loads its endpoint from the environment,
+	// including the ones created from assumed-role credentials
+	os.Setenv("AWS_ENDPOINT_URL", opts.Endpoint)
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(opts.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
+		config.WithAPIOptions(awsconfig.AWSAPIOptions()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	awsconfig.AWSConfig = cfg
+
+	accountID, err := callerAccount(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("emulator at %s is not reachable: %w", opts.Endpoint, err)
+	}
+	roleArn, err := ensureRole(ctx, cfg, accountID)
+	if err != nil {
+		return nil, err
+	}
+	common.ARNNumber = roleArn
+
+	log.Printf("[Harness] ✅ Using emulated account %s at %s", accountID, opts.Endpoint)
+	return &Harness{opts: opts, fixtures: fixtures, cfg: cfg, accountID: accountID}, nil
+}
+
+// Run seeds the fixtures, runs setup, scans the account, checks the scan found every
+// seeded resource, exercises the auto-apply-fix queue and cleans up
+func (h *Harness) Run(ctx context.Context) *Report {
+	report := &Report{Endpoint: h.opts.Endpoint, AccountID: h.accountID, Passed: true}
+	for _, fixture := range h.fixtures {
+		report.Fixtures = append(report.Fixtures, fixture.Name)
+	}
+
+	step := func(name string, fn func() (string, error)) bool {
+		started := time.Now()
+		detail, err := fn()
+		result := StepResult{Name: name, Status: StepPassed, Detail: detail, Duration: time.Since(started)}
+		if err != nil {
+			result.Status = StepFailed
+			result.Detail = err.Error()
+			report.Passed = false
+		}
+		report.Steps = append(report.Steps, result)
+		log.Printf("[Harness] %s: %s %s", name, result.Status, result.Detail)
+		return err == nil
+	}
+
+	if !h.opts.Keep {
+		defer step("cleanup", func() (string, error) { return "", h.cleanup(ctx) })
+	}
+
+	var expected []Expectation
+	if !step("seed", func() (string, error) {
+		for _, fixture := range h.fixtures {
+			found, err := fixture.Seed(ctx, h.cfg)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", fixture.Name, err)
+			}
+			expected = append(expected, found...)
+		}
+		return fmt.Sprintf("%d fixtures, %d resources", len(h.fixtures), len(expected)), nil
+	}) {
+		return report
+	}
+
+	if !step("setup", func() (string, error) {
+		return "", services.NewCloudTrailService().SetupCloudTrail(ctx)
+	}) {
+		return report
+	}
+
+	var inventory *services.ResourceInventory
+	if !step("scan", func() (string, error) {
+		var err error
+		inventory, err = services.NewConfigService(h.cfg).GetComprehensiveResourceInventory(ctx, h.cfg)
+		if err != nil {
+			return "", err
+		}
+		if jobs.Default() != nil {
+			if _, err := services.IngestInventory(ctx, h.accountID, inventory); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%d resources, %d policies", len(inventory.Resources), len(inventory.Policies)), nil
+	}) {
+		return report
+	}
+
+	step("verify", func() (string, error) {
+		report.Missing = missingExpectations(inventory, expected)
+		if len(report.Missing) > 0 {
+			return "", fmt.Errorf("%d of %d seeded resources missing from the inventory", len(report.Missing), len(expected))
+		}
+		return fmt.Sprintf("all %d seeded resources found", len(expected)), nil
+	})
+
+	step("remediate", func() (string, error) {
+		// There is no fix engine yet; this checks events reach the auto-apply-fix queue
+		if err := services.NewCloudTrailService().SendTestMessage(ctx); err != nil {
+			return "", err
+		}
+		return "test event delivered to the auto-apply-fix queue", nil
+	})
+
+	return report
+}
+
+func (h *Harness) cleanup(ctx context.Context) error {
+	var failed []string
+	for _, fixture := range h.fixtures {
+		if err := fixture.Cleanup(ctx, h.cfg); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", fixture.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cleanup failed for %v", failed)
+	}
+	return nil
+}
+
+// missingExpectations returns the expectations the inventory does not report
+func missingExpectations(inventory *services.ResourceInventory, expected []Expectation) []Expectation {
+	seen := map[Expectation]bool{}
+	for _, resource := range inventory.Resources {
+		seen[Expectation{ResourceType: resource.ResourceType, ResourceID: resource.ResourceID}] = true
+		seen[Expectation{ResourceType: resource.ResourceType, ResourceID: resource.ResourceName}] = true
+	}
+	for _, policy := range inventory.Policies {
+		seen[Expectation{ResourceType: PolicyResourceType, ResourceID: policy.PolicyName}] = true
+	}
+
+	var missing []Expectation
+	for _, e := range expected {
+		if !seen[e] {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
+
+// ensureRole creates the CloudLoom customer role in the emulated account if it is missing
+func ensureRole(ctx context.Context, cfg aws.Config, accountID string) (string, error) {
+	client := iam.NewFromConfig(cfg)
+	existing, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err == nil {
+		return aws.ToString(existing.Role.Arn), nil
+	}
+	if !isNotFound(err) {
+		return "", fmt.Errorf("failed to look up role: %w", err)
+	}
+
+	trust := fmt.Sprintf(`{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::%s:root"}, "Action": "sts:AssumeRole"}]
+}`, accountID)
+	created, err := client.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 aws.String(roleName),
+		AssumeRolePolicyDocument: aws.String(trust),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create role: %w", err)
+	}
+	return aws.ToString(created.Role.Arn), nil
+}
+
+func callerAccount(ctx context.Context, cfg aws.Config) (string, error) {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(identity.Account), nil
+}
+
+func isNotFound(err error) bool {
+	var missing *iamtypes.NoSuchEntityException
+	return errors.As(err, &missing)
+}
@@ -1,13 +1,56 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/rishichirchi/cloudloom/api/infrastructure"
+	"github.com/rishichirchi/cloudloom/common"
 	"github.com/rishichirchi/cloudloom/config"
 	"github.com/rishichirchi/cloudloom/route"
+	"github.com/rishichirchi/cloudloom/rpc"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/accountconfig"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"github.com/rishichirchi/cloudloom/services/cache"
+	"github.com/rishichirchi/cloudloom/services/deadletters"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+	"github.com/rishichirchi/cloudloom/services/eventsubscriptions"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/guardrails"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/keyrotation"
+	"github.com/rishichirchi/cloudloom/services/notificationtargets"
+	"github.com/rishichirchi/cloudloom/services/notifiers"
+	"github.com/rishichirchi/cloudloom/services/orgonboarding"
+	"github.com/rishichirchi/cloudloom/services/playbooks"
+	"github.com/rishichirchi/cloudloom/services/pollers"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+	"github.com/rishichirchi/cloudloom/services/resourcehistory"
+	"github.com/rishichirchi/cloudloom/services/retention"
+	"github.com/rishichirchi/cloudloom/services/scheduler"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+	"github.com/rishichirchi/cloudloom/services/tagpolicy"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+	"github.com/rishichirchi/cloudloom/services/ticketing"
+	"github.com/rishichirchi/cloudloom/services/views"
+	"github.com/rishichirchi/cloudloom/services/webhooks"
 )
 
+// shutdownTimeout bounds how long in-flight requests and queue messages may take to finish
+// once the server is asked to stop
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	env_error := godotenv.Load()
 	if env_error != nil {
@@ -16,20 +59,117 @@ func main() {
 	// Initialize AWS configuration
 	config.InitAWS()
 
+	// Initialize MongoDB and the durable delivery buffer
+	config.InitMongo()
+	deliveryBuffer := buffer.Init(config.MongoDB)
+	services.RegisterDeliverySinks(deliveryBuffer)
+	go deliveryBuffer.Start(context.Background())
+
+	// Store received CloudTrail events, findings and the API audit log for querying, triage and export
+	events.Init(config.MongoDB)
+	deadletters.Init(config.MongoDB)
+	eventsubscriptions.Init(config.MongoDB)
+	notificationtargets.Init(config.MongoDB)
+	notifiers.Init(config.MongoDB)
+	findings.Init(config.MongoDB)
+	audit.Init(config.MongoDB)
+	audit.InitTrail(config.MongoDB)
+	retention.Init(config.MongoDB)
+	views.Init(config.MongoDB)
+	accountconfig.Init(config.MongoDB)
+	keyrotation.Init(config.MongoDB)
+	remediations.Init(config.MongoDB)
+	playbooks.Init(config.MongoDB)
+	guardrails.Init(config.MongoDB)
+	webhooks.Init(config.MongoDB)
+	ticketing.Init(config.MongoDB)
+	tenants.Init(config.MongoDB)
+	orgonboarding.Init(config.MongoDB)
+	resourcehistory.Init(config.MongoDB)
+	tagpolicy.Init(config.MongoDB)
+
+	// Encrypted storage for the GitHub App key and integration credentials
+	secrets.Init(config.AWSConfig, config.MongoDB)
+
+	// Cache for dashboard and inventory reads (Redis when REDIS_URL is set, otherwise memory over MongoDB)
+	cache.Init(config.MongoDB)
+
+	// Start the background job workers
+	jobManager := jobs.Init(config.MongoDB, 4)
+	services.RegisterJobHandlers(jobManager)
+	infrastructure.RegisterJobHandlers(jobManager)
+	infrastructure.InvalidateCacheOnNewSnapshot(jobManager)
+	services.NotifyOnScheduledScans(jobManager)
+	go jobManager.Start(context.Background())
+
+	// Route the events the tenant queues receive to their handlers. Queue pollers run under the
+	// server's context and drain when it is stopped.
+	services.RegisterEventHandlers(eventpipeline.Default())
+	serverCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	pollerManager := pollers.Init(serverCtx)
+
+	// In demo mode, serve synthetic data instead of scanning a real AWS account
+	if services.DemoModeEnabled() {
+		log.Println("[Demo] ⚠️ DEMO_MODE is on: scans and diagrams use synthetic data")
+		services.SeedDemoData(context.Background(), jobManager)
+	}
+
+	// Archive and delete data past each tenant's retention policy once a day
+	go services.StartRetentionSchedule(context.Background(), jobManager, 24*time.Hour)
+
+	// Raise tickets for new findings and sync their status with Jira or ServiceNow
+	go services.StartTicketSyncSchedule(serverCtx, jobManager, 5*time.Minute)
+
+	// Check the tenants' EventBridge rules for drift, healing it if RULE_HEALTH_SELF_HEAL is set
+	go services.StartRuleHealthSchedule(serverCtx, 15*time.Minute)
+
+	// Start the per-tenant cron scheduler; scans pause while the findings queue is backed up
+	jobScheduler := scheduler.Init(config.MongoDB, jobManager)
+	jobScheduler.SetLowPriority(services.JobTypeInventoryScan, services.JobTypeDriftCheck, services.JobTypeSteampipeBenchmark)
+	go jobScheduler.Start(context.Background())
+
 	// Set up Gin router
 	// gin.SetMode(gin.ReleaseMode) // Set Gin to release mode for production
 	app := gin.Default()
 
 	// Configure CORS
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001", "https://your-frontend-domain.com"},
+		AllowOrigins:     common.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Requested-With", common.TenantHeader, common.UserHeader, "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "X-Cache", "X-Snapshot-ID", "X-Snapshot-Freshness"},
 		AllowCredentials: true,
 	}))
 
+	// Record every state-changing API call in the audit log
+	app.Use(audit.Middleware())
+
+	common.RegisterValidators()
 	route.SetupRoutes(app)
 
-	app.Run(":5000")
+	// Serve the gRPC API for self-hosted agents alongside the HTTP API
+	go func() {
+		if err := rpc.ListenAndServe(); err != nil {
+			log.Printf("[gRPC] Warning: server stopped: %v", err)
+		}
+	}()
+
+	server := &http.Server{Addr: ":5000", Handler: app}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-serverCtx.Done()
+	log.Println("Shutting down: finishing in-flight requests and queue messages")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: HTTP server did not shut down cleanly: %v", err)
+	}
+	if err := pollerManager.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: SQS pollers did not drain in time: %v", err)
+	}
 }
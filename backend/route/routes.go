@@ -2,11 +2,61 @@ package route
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/api/audit"
 	"github.com/rishichirchi/cloudloom/api/cloudformation"
+	"github.com/rishichirchi/cloudloom/api/cloudtrail"
+	"github.com/rishichirchi/cloudloom/api/compliance"
 	"github.com/rishichirchi/cloudloom/api/configure"
+	"github.com/rishichirchi/cloudloom/api/dashboard"
+	"github.com/rishichirchi/cloudloom/api/events"
+	"github.com/rishichirchi/cloudloom/api/exports"
+	"github.com/rishichirchi/cloudloom/api/findings"
+	"github.com/rishichirchi/cloudloom/api/graphql"
 	"github.com/rishichirchi/cloudloom/api/infrastructure"
+	"github.com/rishichirchi/cloudloom/api/integrations"
+	"github.com/rishichirchi/cloudloom/api/inventory"
+	"github.com/rishichirchi/cloudloom/api/jobs"
+	"github.com/rishichirchi/cloudloom/api/metrics"
+	"github.com/rishichirchi/cloudloom/api/notifications"
+	"github.com/rishichirchi/cloudloom/api/remediation"
+	"github.com/rishichirchi/cloudloom/api/schedules"
+	"github.com/rishichirchi/cloudloom/api/tenant"
+	apiv2 "github.com/rishichirchi/cloudloom/api/v2"
+	"github.com/rishichirchi/cloudloom/api/views"
+	"github.com/rishichirchi/cloudloom/common"
 )
 
+// apiGroup is a group of routes mounted under the same prefix in every API version
+type apiGroup struct {
+	prefix string
+	setup  func(common.Router)
+}
+
+var apiGroups = []apiGroup{
+	{"/audit", audit.SetupAuditRoutes},
+	{"/cloudformation", cloudformation.CloudFormationRoutes},
+	{"/cloudtrail", cloudtrail.SetupCloudTrailRoutes},
+	{"/compliance", compliance.SetupComplianceRoutes},
+	{"/configure", configure.SetupConfigureRoutes},
+	{"/dashboard", dashboard.SetupDashboardRoutes},
+	{"/events", events.SetupEventRoutes},
+	{"/findings", findings.SetupFindingRoutes},
+	{"/graphql", graphql.SetupGraphQLRoutes},
+	{"/infrastructure", infrastructure.SetupInfrastructureRoutes},
+	{"/inventory", inventory.SetupInventoryRoutes},
+	{"/integrations", integrations.SetupIntegrationRoutes},
+	{"/exports", exports.SetupExportRoutes},
+	{"/jobs", jobs.SetupJobRoutes},
+	{"/metrics", metrics.SetupMetricsRoutes},
+	{"/notifications", notifications.SetupNotificationRoutes},
+	{"/playbooks", remediation.SetupPlaybookRoutes},
+	{"/remediation", remediation.SetupRemediationRoutes},
+	{"/remediations", remediation.SetupRemediationQueueRoutes},
+	{"/schedules", schedules.SetupScheduleRoutes},
+	{"/tenant", tenant.SetupTenantRoutes},
+	{"/views", views.SetupViewRoutes},
+}
+
 func SetupRoutes(router *gin.Engine) {
 	v1 := router.Group("/api/v1")
 
@@ -15,12 +65,11 @@ func SetupRoutes(router *gin.Engine) {
 		c.String(200, "Hello, World!")
 	})
 
-	cloudFormationRouterGroup := v1.Group("/cloudformation")
-	cloudformation.CloudFormationRoutes(cloudFormationRouterGroup)
-
-	assumeRoleRouterGroup := v1.Group("/configure")
-	configure.SetupConfigureRoutes(assumeRoleRouterGroup)
+	// v2 serves the same handlers with a consistent {data, error, meta} envelope
+	v2 := router.Group("/api/v2")
 
-	infrastructureRouterGroup := v1.Group("/infrastructure")
-	infrastructure.SetupInfrastructureRoutes(infrastructureRouterGroup)
+	for _, group := range apiGroups {
+		group.setup(common.NewRouter(v1.Group(group.prefix), nil))
+		group.setup(common.NewRouter(v2.Group(group.prefix), apiv2.Enveloped))
+	}
 }
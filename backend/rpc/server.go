@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	agentv1 "github.com/rishichirchi/cloudloom/proto/agent/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewServer creates the gRPC server for agent and internal service traffic. Every call must
+// carry one of the tenant tokens in AGENT_API_TOKENS as a bearer token in the authorization
+// metadata, and may only act for that tenant.
+func NewServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			tenantID, err := authorize(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return handler(context.WithValue(ctx, tenantKey{}, tenantID), req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			tenantID, err := authorize(ss.Context())
+			if err != nil {
+				return err
+			}
+			return handler(srv, &tenantStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), tenantKey{}, tenantID)})
+		}),
+	)
+	agentv1.RegisterEventServiceServer(server, &eventServer{})
+	agentv1.RegisterInventoryServiceServer(server, &inventoryServer{})
+	agentv1.RegisterJobServiceServer(server, &jobServer{})
+	return server
+}
+
+// ListenAndServe serves the gRPC API on GRPC_ADDR (default :50051) until the listener fails
+func ListenAndServe() error {
+	addr := os.Getenv("GRPC_ADDR")
+	if addr == "" {
+		addr = ":50051"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("[gRPC] ✅ Listening on %s", addr)
+	return NewServer().Serve(listener)
+}
+
+type tenantKey struct{}
+
+// tenantStream carries the authorized tenant in the context of a streaming call
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorizedTenant returns the tenant the call's token was issued to
+func authorizedTenant(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey{}).(string)
+	return tenantID
+}
+
+// agentTokens parses AGENT_API_TOKENS, a comma-separated list of tenantID:token pairs
+func agentTokens() map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("AGENT_API_TOKENS"), ",") {
+		tenantID, token, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || tenantID == "" || token == "" {
+			continue
+		}
+		tokens[tenantID] = token
+	}
+	return tokens
+}
+
+// authorize returns the tenant whose token the call carries
+func authorize(ctx context.Context) (string, error) {
+	tokens := agentTokens()
+	if len(tokens) == 0 {
+		return "", status.Error(codes.Unavailable, "agent API is not configured")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, found := strings.CutPrefix(value, "Bearer ")
+		if !found {
+			continue
+		}
+		for tenantID, expected := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+				return tenantID, nil
+			}
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, "invalid or missing agent token")
+}
@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	agentv1 "github.com/rishichirchi/cloudloom/proto/agent/v1"
+	"github.com/rishichirchi/cloudloom/services"
+	"github.com/rishichirchi/cloudloom/services/events"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxInventoryBytes caps the size of a single uploaded inventory snapshot
+const maxInventoryBytes = 256 << 20
+
+type eventServer struct {
+	agentv1.UnimplementedEventServiceServer
+}
+
+// SubmitEvents stores each event whose account matches the tenant and reports the rest
+func (s *eventServer) SubmitEvents(ctx context.Context, req *agentv1.SubmitEventsRequest) (*agentv1.SubmitEventsResponse, error) {
+	store := events.Default()
+	if store == nil {
+		return nil, status.Error(codes.Unavailable, "event store is not initialized")
+	}
+	if req.GetTenantId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant_id is required")
+	}
+	if req.GetTenantId() != authorizedTenant(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "agent token is not valid for this tenant")
+	}
+
+	resp := &agentv1.SubmitEventsResponse{}
+	for i, body := range req.GetEvents() {
+		event, err := store.Record(ctx, body)
+		if err == nil && event.TenantID != req.GetTenantId() {
+			err = fmt.Errorf("event account %s does not match tenant", event.TenantID)
+		}
+		if err != nil {
+			resp.Rejected++
+			resp.Errors = append(resp.Errors, fmt.Sprintf("event %d: %v", i, err))
+			continue
+		}
+		resp.Accepted++
+	}
+	return resp, nil
+}
+
+type inventoryServer struct {
+	agentv1.UnimplementedInventoryServiceServer
+}
+
+// UploadInventory reassembles the streamed snapshot and stores it as the tenant's latest
+// inventory. Every chunk must name the tenant the agent token was issued to.
+func (s *inventoryServer) UploadInventory(stream grpc.ClientStreamingServer[agentv1.InventoryChunk, agentv1.UploadInventoryResponse]) error {
+	var (
+		tenantID = authorizedTenant(stream.Context())
+		received bool
+		data     bytes.Buffer
+	)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if chunk.GetTenantId() == "" && !received {
+			return status.Error(codes.InvalidArgument, "tenant_id is required in the first chunk")
+		}
+		if chunk.GetTenantId() != "" && chunk.GetTenantId() != tenantID {
+			return status.Error(codes.PermissionDenied, "agent token is not valid for this tenant")
+		}
+		received = true
+		if data.Len()+len(chunk.GetData()) > maxInventoryBytes {
+			return status.Errorf(codes.ResourceExhausted, "inventory exceeds %d bytes", maxInventoryBytes)
+		}
+		data.Write(chunk.GetData())
+	}
+	if !received {
+		return status.Error(codes.InvalidArgument, "tenant_id is required in the first chunk")
+	}
+
+	var inventory services.ResourceInventory
+	if err := json.Unmarshal(data.Bytes(), &inventory); err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to parse inventory: %v", err)
+	}
+
+	job, err := services.IngestInventory(stream.Context(), tenantID, &inventory)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(&agentv1.UploadInventoryResponse{
+		SnapshotId:    job.ID.Hex(),
+		ResourceCount: int32(len(inventory.Resources)),
+	})
+}
+
+type jobServer struct {
+	agentv1.UnimplementedJobServiceServer
+}
+
+// ClaimJob hands the tenant's oldest ready remote job of the requested types to the worker
+func (s *jobServer) ClaimJob(ctx context.Context, req *agentv1.ClaimJobRequest) (*agentv1.ClaimJobResponse, error) {
+	if req.GetWorkerId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "worker_id is required")
+	}
+
+	job, err := jobs.Default().ClaimRemote(ctx, authorizedTenant(ctx), req.GetWorkerId(), req.GetJobTypes())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if job == nil {
+		return &agentv1.ClaimJobResponse{}, nil
+	}
+
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode payload: %v", err)
+	}
+	return &agentv1.ClaimJobResponse{Job: &agentv1.Job{
+		Id:          job.ID.Hex(),
+		Type:        job.Type,
+		TenantId:    job.TenantID,
+		PayloadJson: payload,
+		Attempt:     int32(job.Attempts),
+	}}, nil
+}
+
+// CompleteJob records the worker's result or error for a claimed job
+func (s *jobServer) CompleteJob(ctx context.Context, req *agentv1.CompleteJobRequest) (*agentv1.CompleteJobResponse, error) {
+	var result interface{}
+	if len(req.GetResultJson()) > 0 {
+		if err := json.Unmarshal(req.GetResultJson(), &result); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to parse result: %v", err)
+		}
+	}
+
+	var jobErr error
+	if req.GetError() != "" {
+		jobErr = errors.New(req.GetError())
+		if req.GetPermanent() {
+			jobErr = jobs.Permanent(jobErr)
+		}
+	}
+
+	err := jobs.Default().CompleteRemote(ctx, authorizedTenant(ctx), req.GetJobId(), req.GetWorkerId(), result, jobErr)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, jobs.ErrNotClaimed):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &agentv1.CompleteJobResponse{}, nil
+}
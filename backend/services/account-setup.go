@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobTypeAccountSetup onboards a customer account in the background, reporting each setup step
+const JobTypeAccountSetup = "account_setup"
+
+// Steps reported on account setup jobs, in the order setup runs them
+const (
+	SetupStepAssumeRole       = "role_assumed"
+	SetupStepPermissions      = "permissions_checked"
+	SetupStepEncryptionKey    = "encryption_key_ready"
+	SetupStepBucket           = "bucket_created"
+	SetupStepLogGroup         = "log_group_created"
+	SetupStepLogRetention     = "log_retention_set"
+	SetupStepReplication      = "log_replication_configured"
+	SetupStepTrailRole        = "trail_role_created"
+	SetupStepTrail            = "trail_started"
+	SetupStepTopic            = "topic_ready"
+	SetupStepQueue            = "queue_ready"
+	SetupStepEventBridgeRole  = "eventbridge_role_created"
+	SetupStepEventBridgeRules = "eventbridge_rules_created"
+	SetupStepGuardDuty        = "guardduty_detectors_ready"
+	SetupStepQueuePolicy      = "queue_policy_set"
+	SetupStepPolling          = "polling_started"
+	SetupStepSteampipe        = "steampipe_configured"
+)
+
+var setupSteps = []string{
+	SetupStepAssumeRole, SetupStepPermissions, SetupStepEncryptionKey, SetupStepBucket, SetupStepLogGroup,
+	SetupStepLogRetention, SetupStepReplication, SetupStepTrailRole, SetupStepTrail, SetupStepTopic,
+	SetupStepQueue, SetupStepEventBridgeRole, SetupStepEventBridgeRules, SetupStepGuardDuty, SetupStepQueuePolicy,
+	SetupStepPolling, SetupStepSteampipe,
+}
+
+// resumedDetail is the detail of a step skipped because an earlier setup completed it
+const resumedDetail = "completed by an earlier run"
+
+// ResetSetupCheckpoint discards what the account's earlier setups completed, so the next
+// setup runs every step from scratch. It fails with tenants.ErrSetupInProgress while the
+// account is being set up.
+func ResetSetupCheckpoint(ctx context.Context, accountID string) error {
+	manager := tenants.Default()
+	if manager == nil {
+		return nil
+	}
+	existing, err := manager.Get(ctx, accountID)
+	if errors.Is(err, tenants.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.SetupActive() {
+		return tenants.ErrSetupInProgress
+	}
+	return manager.ClearCheckpoint(ctx, accountID)
+}
+
+// EnqueueAccountSetup starts onboarding the tenant in the background and returns the job to
+// poll for progress. It fails with tenants.ErrSetupInProgress while the account is already
+// being set up.
+func EnqueueAccountSetup(ctx context.Context, tenant *tenants.Tenant) (*jobs.Job, error) {
+	manager := jobs.Default()
+	if manager == nil {
+		return nil, fmt.Errorf("job subsystem is not initialized")
+	}
+	if store := tenants.Default(); store != nil {
+		existing, err := store.Get(ctx, tenant.AccountID)
+		if err != nil && !errors.Is(err, tenants.ErrNotFound) {
+			return nil, err
+		}
+		if existing != nil && existing.SetupActive() {
+			return nil, tenants.ErrSetupInProgress
+		}
+	}
+
+	return manager.Enqueue(ctx, JobTypeAccountSetup, tenant.AccountID, map[string]interface{}{
+		"roleArn":           tenant.RoleArn,
+		"externalId":        tenant.ExternalID,
+		"region":            tenant.Region,
+		"regions":           strings.Join(tenant.Regions, ","),
+		"allRegions":        tenant.AllRegions,
+		"kmsKeyArn":         tenant.KMSKeyArn,
+		"createKmsKey":      tenant.CreateKMSKey,
+		"retentionDays":     strconv.Itoa(tenant.LogRetentionDays),
+		"replicationRegion": tenant.ReplicationRegion,
+		"existingTrailArn":  tenant.ExistingTrailArn,
+		"existingBucket":    tenant.ExistingBucketName,
+		"s3DataEvents":      tenant.TrailEvents.S3DataEvents,
+		"lambdaDataEvents":  tenant.TrailEvents.LambdaDataEvents,
+		"insights":          tenant.TrailEvents.Insights,
+		"accessTier":        string(tenant.AccessTier),
+		"fifoQueue":         tenant.FifoQueue,
+		// URLs may contain commas but not newlines
+		"notificationEndpoints": strings.Join(tenant.NotificationEndpoints, "\n"),
+	})
+}
+
+// runAccountSetupJob onboards the tenant named in the payload. Setup failures need the customer
+// to fix their role or account, so they are not retried.
+func runAccountSetupJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	tenant := &tenants.Tenant{AccountID: job.TenantID}
+	tenant.RoleArn, _ = job.Payload["roleArn"].(string)
+	tenant.ExternalID, _ = job.Payload["externalId"].(string)
+	tenant.Region, _ = job.Payload["region"].(string)
+	if regions, _ := job.Payload["regions"].(string); regions != "" {
+		tenant.Regions = strings.Split(regions, ",")
+	}
+	tenant.AllRegions, _ = job.Payload["allRegions"].(bool)
+	tenant.KMSKeyArn, _ = job.Payload["kmsKeyArn"].(string)
+	tenant.CreateKMSKey, _ = job.Payload["createKmsKey"].(bool)
+	if days, _ := job.Payload["retentionDays"].(string); days != "" {
+		tenant.LogRetentionDays, _ = strconv.Atoi(days)
+	}
+	tenant.ReplicationRegion, _ = job.Payload["replicationRegion"].(string)
+	tenant.ExistingTrailArn, _ = job.Payload["existingTrailArn"].(string)
+	tenant.ExistingBucketName, _ = job.Payload["existingBucket"].(string)
+	tenant.TrailEvents.S3DataEvents, _ = job.Payload["s3DataEvents"].(bool)
+	tenant.TrailEvents.LambdaDataEvents, _ = job.Payload["lambdaDataEvents"].(bool)
+	tenant.TrailEvents.Insights, _ = job.Payload["insights"].(bool)
+	if endpoints, _ := job.Payload["notificationEndpoints"].(string); endpoints != "" {
+		tenant.NotificationEndpoints = strings.Split(endpoints, "\n")
+	}
+	if tier, _ := job.Payload["accessTier"].(string); tier != "" {
+		tenant.AccessTier = tenants.AccessTier(tier)
+	}
+	tenant.FifoQueue, _ = job.Payload["fifoQueue"].(bool)
+
+	progress := newSetupProgress(job.ID)
+	progress.save(ctx)
+	if err := onboardTenant(ctx, tenant, progress); err != nil {
+		notifySetupFailure(ctx, job.TenantID, err)
+		return nil, jobs.Permanent(err)
+	}
+	return tenant, nil
+}
+
+// resume returns the output an earlier setup of the tenant with the same options recorded for
+// step, marking the step done, or false if the step must run
+func (s *CloudTrailService) resume(ctx context.Context, step string) (string, bool) {
+	if s.tenant == nil || s.tenant.SetupCheckpoint == nil || s.tenant.SetupCheckpoint.Fingerprint != s.tenant.SetupFingerprint() {
+		return "", false
+	}
+	output, ok := s.tenant.SetupCheckpoint.Outputs[step]
+	if !ok {
+		return "", false
+	}
+	fmt.Printf("⏭️ Step %s was completed by an earlier run, resuming after it\n", step)
+	s.progress.done(ctx, step, resumedDetail)
+	return output, true
+}
+
+// checkpoint records that step completed with output, so a failed setup resumes after it
+func (s *CloudTrailService) checkpoint(ctx context.Context, step, output string) {
+	manager := tenants.Default()
+	if s.tenant == nil || manager == nil {
+		return
+	}
+	err := manager.SaveCheckpoint(context.WithoutCancel(ctx), s.tenant.AccountID, s.tenant.SetupFingerprint(), step, output)
+	if err != nil {
+		log.Printf("[AccountSetup] Warning: %v", err)
+	}
+}
+
+// setupProgress records the outcome of each setup step on the setup job. A nil
+// *setupProgress is valid and records nothing, for setups run outside a job.
+type setupProgress struct {
+	jobID primitive.ObjectID
+	steps []jobs.Step
+}
+
+func newSetupProgress(jobID primitive.ObjectID) *setupProgress {
+	now := time.Now()
+	p := &setupProgress{jobID: jobID}
+	for _, name := range setupSteps {
+		p.steps = append(p.steps, jobs.Step{Name: name, Status: jobs.StepPending})
+	}
+	p.steps[0].Status, p.steps[0].StartedAt = jobs.StepRunning, &now
+	return p
+}
+
+// done marks a step as succeeded and the next pending step as running
+func (p *setupProgress) done(ctx context.Context, name, detail string) {
+	p.finish(ctx, name, jobs.StepSucceeded, detail)
+}
+
+// skip marks a step the tenant's access tier leaves out as skipped
+func (p *setupProgress) skip(ctx context.Context, name, detail string) {
+	p.finish(ctx, name, jobs.StepSkipped, detail)
+}
+
+func (p *setupProgress) finish(ctx context.Context, name string, status jobs.StepStatus, detail string) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	for i := range p.steps {
+		step := &p.steps[i]
+		if step.Name == name {
+			step.Status, step.Detail, step.FinishedAt = status, detail, &now
+			if step.StartedAt == nil {
+				step.StartedAt = &now
+			}
+		} else if step.Status == jobs.StepPending && (i == 0 || p.steps[i-1].Status == jobs.StepSucceeded || p.steps[i-1].Status == jobs.StepSkipped) {
+			step.Status, step.StartedAt = jobs.StepRunning, &now
+			break
+		}
+	}
+	p.save(ctx)
+}
+
+// fail marks a step as failed with the error as its detail and returns err
+func (p *setupProgress) fail(ctx context.Context, name string, err error) error {
+	if p == nil {
+		return err
+	}
+	now := time.Now()
+	for i := range p.steps {
+		if p.steps[i].Name == name {
+			p.steps[i].Status, p.steps[i].Detail, p.steps[i].FinishedAt = jobs.StepFailed, err.Error(), &now
+		}
+	}
+	p.save(ctx)
+	return err
+}
+
+func (p *setupProgress) save(ctx context.Context) {
+	manager := jobs.Default()
+	if p == nil || manager == nil {
+		return
+	}
+	if err := manager.SetSteps(context.WithoutCancel(ctx), p.jobID, p.steps); err != nil {
+		log.Printf("[AccountSetup] Warning: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package accountconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionAccountConfig
+
+var (
+	// ErrInvalid is returned when a spec names a malformed region, rule or channel
+	ErrInvalid = errors.New("invalid account configuration")
+	// ErrNotFound is returned when a tenant has never applied a configuration
+	ErrNotFound = errors.New("account configuration not found")
+)
+
+// ChannelEmail sends notifications to the address in Target. The other channel types
+// deliver through the tenant's stored integration credentials.
+const ChannelEmail = "email"
+
+// ChannelTypes are the supported notification channel types
+var ChannelTypes = []string{ChannelEmail, "slack", "jira", "siem"}
+
+var rulePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+var resourceTypePattern = regexp.MustCompile(`^AWS::[A-Za-z0-9]+::[A-Za-z0-9]+$`)
+
+// Recording frequencies supported by the AWS Config recorder
+const (
+	FrequencyContinuous = "CONTINUOUS"
+	FrequencyDaily      = "DAILY"
+)
+
+// Channel is a destination for CloudLoom notifications
+type Channel struct {
+	Type   string `bson:"type" json:"type" binding:"required,oneof=email slack jira siem"`
+	Target string `bson:"target,omitempty" json:"target,omitempty"`
+}
+
+// Key identifies the channel within a spec
+func (c Channel) Key() string {
+	if c.Target == "" {
+		return c.Type
+	}
+	return c.Type + ":" + c.Target
+}
+
+// Spec is the desired configuration of a customer account. Every list is the complete
+// desired set: anything CloudLoom manages that is missing from it is removed.
+type Spec struct {
+	Regions              []string  `bson:"regions" json:"regions" binding:"dive,awsregion"`
+	Rules                []string  `bson:"rules" json:"rules"`
+	NotificationChannels []Channel `bson:"notificationChannels" json:"notificationChannels" binding:"dive"`
+	// Recorder narrows what the AWS Config recorder records. When nil the recorder's recording
+	// group is left as it is.
+	Recorder *Recorder `bson:"recorder,omitempty" json:"recorder,omitempty"`
+}
+
+// Recorder selects the resource types the AWS Config recorder records in every desired region.
+// At most one of IncludeResourceTypes and ExcludeResourceTypes may be set; with neither, all
+// supported resource types are recorded.
+type Recorder struct {
+	IncludeResourceTypes []string `bson:"includeResourceTypes,omitempty" json:"includeResourceTypes,omitempty"`
+	ExcludeResourceTypes []string `bson:"excludeResourceTypes,omitempty" json:"excludeResourceTypes,omitempty"`
+	// RecordingFrequency is CONTINUOUS or DAILY; empty keeps the AWS default of CONTINUOUS
+	RecordingFrequency string `bson:"recordingFrequency,omitempty" json:"recordingFrequency,omitempty" binding:"omitempty,oneof=CONTINUOUS DAILY"`
+}
+
+// Normalize validates the recorder settings and sorts and de-duplicates the resource types
+func (r *Recorder) Normalize() error {
+	if len(r.IncludeResourceTypes) > 0 && len(r.ExcludeResourceTypes) > 0 {
+		return fmt.Errorf("%w: set either includeResourceTypes or excludeResourceTypes, not both", ErrInvalid)
+	}
+	for _, resourceType := range append(r.IncludeResourceTypes, r.ExcludeResourceTypes...) {
+		if !resourceTypePattern.MatchString(resourceType) {
+			return fmt.Errorf("%w: '%s' is not an AWS resource type", ErrInvalid, resourceType)
+		}
+	}
+	if r.RecordingFrequency != "" && r.RecordingFrequency != FrequencyContinuous && r.RecordingFrequency != FrequencyDaily {
+		return fmt.Errorf("%w: recording frequency must be %s or %s", ErrInvalid, FrequencyContinuous, FrequencyDaily)
+	}
+	if len(r.IncludeResourceTypes) > 0 {
+		r.IncludeResourceTypes = uniqueSorted(r.IncludeResourceTypes)
+	}
+	if len(r.ExcludeResourceTypes) > 0 {
+		r.ExcludeResourceTypes = uniqueSorted(r.ExcludeResourceTypes)
+	}
+	return nil
+}
+
+// Normalize validates the spec and sorts and de-duplicates its lists so equal specs compare equal
+func (s *Spec) Normalize() error {
+	for _, region := range s.Regions {
+		if !common.IsAWSRegion(region) {
+			return fmt.Errorf("%w: '%s' is not an AWS region", ErrInvalid, region)
+		}
+	}
+	for _, rule := range s.Rules {
+		if !rulePattern.MatchString(rule) {
+			return fmt.Errorf("%w: '%s' is not a valid Config rule identifier", ErrInvalid, rule)
+		}
+	}
+	for _, channel := range s.NotificationChannels {
+		if !contains(ChannelTypes, channel.Type) {
+			return fmt.Errorf("%w: channel type must be one of %v", ErrInvalid, ChannelTypes)
+		}
+		if channel.Type == ChannelEmail {
+			if _, err := mail.ParseAddress(channel.Target); err != nil {
+				return fmt.Errorf("%w: '%s' is not an email address", ErrInvalid, channel.Target)
+			}
+		}
+	}
+
+	if s.Recorder != nil {
+		if err := s.Recorder.Normalize(); err != nil {
+			return err
+		}
+	}
+
+	s.Regions = uniqueSorted(s.Regions)
+	s.Rules = uniqueSorted(s.Rules)
+	seen := map[string]bool{}
+	channels := []Channel{}
+	for _, channel := range s.NotificationChannels {
+		if !seen[channel.Key()] {
+			seen[channel.Key()] = true
+			channels = append(channels, channel)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Key() < channels[j].Key() })
+	s.NotificationChannels = channels
+	return nil
+}
+
+// EmailRecipients returns the addresses of the spec's email channels
+func (s *Spec) EmailRecipients() []string {
+	var recipients []string
+	for _, channel := range s.NotificationChannels {
+		if channel.Type == ChannelEmail {
+			recipients = append(recipients, channel.Target)
+		}
+	}
+	return recipients
+}
+
+func uniqueSorted(items []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Action is what reconciliation did to one item
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionDeleted   Action = "deleted"
+	ActionUnchanged Action = "unchanged"
+	ActionFailed    Action = "failed"
+)
+
+// Change records the outcome of reconciling one region, rule or channel
+type Change struct {
+	Kind   string `bson:"kind" json:"kind"`
+	Name   string `bson:"name" json:"name"`
+	Region string `bson:"region,omitempty" json:"region,omitempty"`
+	Action Action `bson:"action" json:"action"`
+	Detail string `bson:"detail,omitempty" json:"detail,omitempty"`
+}
+
+// State is a tenant's desired configuration and the outcome of the last reconciliation
+type State struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	Spec     Spec   `bson:"spec" json:"spec"`
+	// ManagedRules are the "region/rule" Config rules CloudLoom created, and may therefore delete
+	ManagedRules []string  `bson:"managedRules" json:"managedRules"`
+	Changes      []Change  `bson:"changes" json:"changes"`
+	Converged    bool      `bson:"converged" json:"converged"`
+	AppliedAt    time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// Store persists per-tenant account configuration in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide account configuration store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide account configuration store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the account_config collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Get returns the tenant's last applied configuration
+func (s *Store) Get(ctx context.Context, tenantID string) (*State, error) {
+	var state State
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account configuration: %w", err)
+	}
+	return &state, nil
+}
+
+// Save replaces the tenant's configuration
+func (s *Store) Save(ctx context.Context, state *State) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"tenantId": state.TenantID}, state, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save account configuration: %w", err)
+	}
+	return nil
+}
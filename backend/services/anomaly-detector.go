@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// FindingSourceAnomaly marks findings of suspicious activity detected in CloudTrail events
+const FindingSourceAnomaly = "cloudtrail_anomaly"
+
+// Kinds of suspicious activity, also the rule IDs of their findings
+const (
+	AnomalyConsoleLoginWithoutMFA = "console-login-without-mfa"
+	AnomalyRootAccountUsage       = "root-account-usage"
+	AnomalyMonitoringDisabled     = "monitoring-disabled"
+	AnomalyOpenIngress            = "security-group-ingress-open-to-internet"
+	AnomalyIAMPolicyChange        = "iam-policy-changed"
+	AnomalyUnusualRegion          = "unusual-region-activity"
+)
+
+// unusualRegionLookback is how far back the detector looks for earlier API calls in a region
+const unusualRegionLookback = 30 * 24 * time.Hour
+
+// unusualRegionBaseline is how many API calls an account needs in the lookback before calls in
+// a new region stand out, so newly onboarded accounts are not flagged in every region
+const unusualRegionBaseline = 100
+
+// monitoringDisabledCalls are the calls that stop CloudTrail, AWS Config or GuardDuty from
+// recording, by event source. GuardDuty's UpdateDetector counts when it disables the detector.
+var monitoringDisabledCalls = map[string][]string{
+	"cloudtrail.amazonaws.com": {"StopLogging", "DeleteTrail"},
+	"config.amazonaws.com":     {"StopConfigurationRecorder", "DeleteConfigurationRecorder", "DeleteDeliveryChannel"},
+	"guardduty.amazonaws.com":  {"DeleteDetector", "DisassociateFromMasterAccount", "DisassociateFromAdministratorAccount"},
+}
+
+// iamPolicyChangeCalls are the IAM calls that change what a principal is allowed to do
+var iamPolicyChangeCalls = []string{
+	"AttachGroupPolicy", "AttachRolePolicy", "AttachUserPolicy",
+	"DetachGroupPolicy", "DetachRolePolicy", "DetachUserPolicy",
+	"PutGroupPolicy", "PutRolePolicy", "PutUserPolicy",
+	"DeleteGroupPolicy", "DeleteRolePolicy", "DeleteUserPolicy",
+	"CreatePolicy", "CreatePolicyVersion", "SetDefaultPolicyVersion", "DeletePolicy",
+	"UpdateAssumeRolePolicy",
+}
+
+// Anomaly is suspicious activity found in a CloudTrail event
+type Anomaly struct {
+	Kind         string `json:"kind"`
+	Severity     string `json:"severity"`
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	Region       string `json:"region,omitempty"`
+	Title        string `json:"title"`
+	Detail       string `json:"detail,omitempty"`
+	Remediation  string `json:"remediation"`
+}
+
+// finding converts the anomaly into the finding recorded for the tenant
+func (a Anomaly) finding(tenantID string) *findings.Finding {
+	return &findings.Finding{
+		TenantID:     tenantID,
+		Source:       FindingSourceAnomaly,
+		RuleID:       a.Kind,
+		Title:        a.Title,
+		Description:  a.Detail,
+		Remediation:  a.Remediation,
+		Severity:     a.Severity,
+		ResourceType: a.ResourceType,
+		ResourceID:   a.ResourceID,
+		Context:      &findings.ResourceContext{Region: a.Region},
+	}
+}
+
+// AnomalyDetector finds suspicious activity in CloudTrail API calls and console sign-ins:
+// console logins without MFA, use of the root account, disabling of CloudTrail, AWS Config or
+// GuardDuty, security group ingress from the whole internet, IAM policy changes, and API
+// calls in a region the account has not used lately
+type AnomalyDetector struct {
+	// events holds the account's earlier API calls, which unusual region activity is judged
+	// against; without it that check is skipped
+	events *events.Store
+}
+
+// NewAnomalyDetector returns a detector judging region activity against the given event store
+func NewAnomalyDetector(store *events.Store) *AnomalyDetector {
+	return &AnomalyDetector{events: store}
+}
+
+// Detect returns the anomalies of one API call or console sign-in. Calls CloudLoom makes in the
+// account, and calls that failed, are ignored.
+func (a *AnomalyDetector) Detect(ctx context.Context, event *eventpipeline.Event) ([]Anomaly, error) {
+	var detail apiCallDetail
+	if err := event.DecodeDetail(&detail); err != nil {
+		return nil, err
+	}
+	if detail.ErrorCode != "" || strings.HasSuffix(detail.UserIdentity.ARN, "/"+assumeRoleSessionName) {
+		return nil, nil
+	}
+	if detail.AWSRegion == "" {
+		detail.AWSRegion = event.Region
+	}
+	accountID := detail.UserIdentity.AccountID
+	if accountID == "" {
+		accountID = event.TenantID
+	}
+
+	result := []Anomaly{}
+	for _, check := range []func(*apiCallDetail, string) (Anomaly, bool){
+		consoleLoginWithoutMFA, rootAccountUsage, monitoringDisabled, openIngress, iamPolicyChange,
+	} {
+		if anomaly, ok := check(&detail, accountID); ok {
+			result = append(result, anomaly)
+		}
+	}
+	anomaly, ok, err := a.unusualRegion(ctx, event, &detail, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		result = append(result, anomaly)
+	}
+	return result, nil
+}
+
+func consoleLoginWithoutMFA(detail *apiCallDetail, accountID string) (Anomaly, bool) {
+	if detail.EventName != "ConsoleLogin" || stringValue(detail.ResponseElements["ConsoleLogin"]) != "Success" ||
+		stringValue(detail.AdditionalEventData["MFAUsed"]) != "No" {
+		return Anomaly{}, false
+	}
+	// Federated sign-ins authenticate, and enforce MFA, at the identity provider
+	identityType := detail.UserIdentity.Type
+	if identityType != "IAMUser" && identityType != "Root" {
+		return Anomaly{}, false
+	}
+	anomaly := Anomaly{
+		Kind:         AnomalyConsoleLoginWithoutMFA,
+		Severity:     "high",
+		ResourceType: "AWS::IAM::User",
+		ResourceID:   detail.UserIdentity.ARN,
+		Region:       detail.AWSRegion,
+		Title:        fmt.Sprintf("%s signed in to the console without MFA", detail.actor()),
+		Detail:       fmt.Sprintf("Console sign-in from %s without multi-factor authentication.", detail.SourceIP),
+		Remediation:  "Enable an MFA device for the user and deny console access without MFA with an aws:MultiFactorAuthPresent policy condition. If the sign-in was not expected, reset the user's password and review its recent activity.",
+	}
+	if identityType == "Root" {
+		anomaly.Severity, anomaly.ResourceType, anomaly.ResourceID = "critical", "AWS::::Account", accountID
+		anomaly.Remediation = "Enable MFA on the root user, preferably a hardware key, and keep its credentials offline. If the sign-in was not expected, change the root password and review the account's recent activity."
+	}
+	return anomaly, true
+}
+
+func rootAccountUsage(detail *apiCallDetail, accountID string) (Anomaly, bool) {
+	// AWS services acting on the account's behalf also appear as the root user
+	if detail.UserIdentity.Type != "Root" || detail.UserIdentity.InvokedBy != "" || detail.EventType == "AwsServiceEvent" {
+		return Anomaly{}, false
+	}
+	return Anomaly{
+		Kind:         AnomalyRootAccountUsage,
+		Severity:     "high",
+		ResourceType: "AWS::::Account",
+		ResourceID:   accountID,
+		Region:       detail.AWSRegion,
+		Title:        fmt.Sprintf("Root user of account %s called %s", accountID, detail.EventName),
+		Detail:       fmt.Sprintf("%s %s was called by the root user from %s.", detail.EventSource, detail.EventName, detail.SourceIP),
+		Remediation:  "Use IAM users or roles for everyday work and keep the root user for the few tasks that need it. Delete any root access keys, enable MFA on the root user, and review the call if it was not expected.",
+	}, true
+}
+
+func monitoringDisabled(detail *apiCallDetail, accountID string) (Anomaly, bool) {
+	disabling := containsString(monitoringDisabledCalls[detail.EventSource], detail.EventName)
+	if detail.EventSource == "guardduty.amazonaws.com" && detail.EventName == "UpdateDetector" {
+		enable, ok := detail.RequestParameters["enable"].(bool)
+		disabling = ok && !enable
+	}
+	if !disabling {
+		return Anomaly{}, false
+	}
+
+	var resourceType, resourceID, service string
+	switch detail.EventSource {
+	case "cloudtrail.amazonaws.com":
+		resourceType, resourceID, service = "AWS::CloudTrail::Trail", stringValue(detail.RequestParameters["name"]), "CloudTrail"
+	case "config.amazonaws.com":
+		resourceType, resourceID, service = "AWS::Config::ConfigurationRecorder", stringValue(detail.RequestParameters["configurationRecorderName"]), "AWS Config"
+		if detail.EventName == "DeleteDeliveryChannel" {
+			resourceType, resourceID = "AWS::Config::DeliveryChannel", stringValue(detail.RequestParameters["deliveryChannelName"])
+		}
+	default:
+		resourceType, resourceID, service = "AWS::GuardDuty::Detector", stringValue(detail.RequestParameters["detectorId"]), "GuardDuty"
+	}
+	if resourceID == "" {
+		resourceID = accountID
+	}
+	return Anomaly{
+		Kind:         AnomalyMonitoringDisabled,
+		Severity:     "critical",
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Region:       detail.AWSRegion,
+		Title:        fmt.Sprintf("%s was disabled by %s", service, detail.actor()),
+		Detail:       fmt.Sprintf("%s called %s in %s, which stops %s from recording activity.", detail.actor(), detail.EventName, detail.AWSRegion, service),
+		Remediation:  fmt.Sprintf("Re-enable %s right away and find out who disabled it and why. Deny %s to everyone but a break-glass role with a service control policy.", service, detail.EventName),
+	}, true
+}
+
+func openIngress(detail *apiCallDetail, accountID string) (Anomaly, bool) {
+	if detail.EventSource != "ec2.amazonaws.com" || detail.EventName != "AuthorizeSecurityGroupIngress" {
+		return Anomaly{}, false
+	}
+	var opened []string
+	severity := "medium"
+	for _, item := range nestedItems(detail.RequestParameters["ipPermissions"]) {
+		raw, _ := item.(map[string]interface{})
+		permission := cloudTrailPermission(raw)
+		if !openToInternet(permission) {
+			continue
+		}
+		ports, sensitive := describePorts(permission)
+		opened = append(opened, ports)
+		if sensitive {
+			severity = "high"
+		}
+	}
+	if len(opened) == 0 {
+		return Anomaly{}, false
+	}
+	groupID := stringValue(detail.RequestParameters["groupId"])
+	if groupID == "" {
+		groupID = stringValue(detail.RequestParameters["groupName"])
+	}
+	return Anomaly{
+		Kind:         AnomalyOpenIngress,
+		Severity:     severity,
+		ResourceType: "AWS::EC2::SecurityGroup",
+		ResourceID:   groupID,
+		Region:       detail.AWSRegion,
+		Title:        fmt.Sprintf("Security group %s was opened to the internet", groupID),
+		Detail:       fmt.Sprintf("%s allowed ingress from 0.0.0.0/0 or ::/0 on %s.", detail.actor(), strings.Join(opened, ", ")),
+		Remediation:  "Revoke the rule and allow only the address ranges that need access, or reach the instances through Systems Manager Session Manager or a load balancer instead of opening ports.",
+	}, true
+}
+
+// nestedItems returns the items of a CloudTrail list parameter, which is logged as {"items": [...]}
+func nestedItems(v interface{}) []interface{} {
+	list, _ := v.(map[string]interface{})
+	items, _ := list["items"].([]interface{})
+	return items
+}
+
+// cloudTrailPermission unwraps the {"items": [...]} lists CloudTrail logs the ranges of an
+// ingress permission as, giving the shape openToInternet reads from Config
+func cloudTrailPermission(permission map[string]interface{}) map[string]interface{} {
+	unwrapped := make(map[string]interface{}, len(permission))
+	for key, value := range permission {
+		if items := nestedItems(value); items != nil {
+			value = items
+		}
+		unwrapped[key] = value
+	}
+	return unwrapped
+}
+
+// describePorts describes the ports an ingress permission opens and whether they include all
+// traffic or a port the exposure analyzer considers sensitive
+func describePorts(permission map[string]interface{}) (string, bool) {
+	protocol := stringValue(permission["ipProtocol"])
+	from, hasFrom := permission["fromPort"].(float64)
+	to, hasTo := permission["toPort"].(float64)
+	if protocol == "-1" || !hasFrom || !hasTo || from < 0 {
+		return "all ports", true
+	}
+	sensitive := false
+	for port := range defaultSensitivePorts {
+		if float64(port) >= from && float64(port) <= to {
+			sensitive = true
+			break
+		}
+	}
+	if from == to {
+		return fmt.Sprintf("%s port %d", protocol, int(from)), sensitive
+	}
+	return fmt.Sprintf("%s ports %d-%d", protocol, int(from), int(to)), sensitive
+}
+
+func iamPolicyChange(detail *apiCallDetail, accountID string) (Anomaly, bool) {
+	if detail.EventSource != "iam.amazonaws.com" || !containsString(iamPolicyChangeCalls, detail.EventName) {
+		return Anomaly{}, false
+	}
+	params := detail.RequestParameters
+	resourceType, resourceID := "AWS::IAM::Policy", stringValue(params["policyArn"])
+	switch {
+	case stringValue(params["roleName"]) != "":
+		resourceType, resourceID = "AWS::IAM::Role", stringValue(params["roleName"])
+	case stringValue(params["userName"]) != "":
+		resourceType, resourceID = "AWS::IAM::User", stringValue(params["userName"])
+	case stringValue(params["groupName"]) != "":
+		resourceType, resourceID = "AWS::IAM::Group", stringValue(params["groupName"])
+	case resourceID == "":
+		resourceID = stringValue(params["policyName"])
+	}
+	severity := "medium"
+	if strings.HasPrefix(detail.EventName, "Attach") && strings.HasSuffix(stringValue(params["policyArn"]), "/AdministratorAccess") {
+		severity = "high"
+	}
+	return Anomaly{
+		Kind:         AnomalyIAMPolicyChange,
+		Severity:     severity,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Region:       detail.AWSRegion,
+		Title:        fmt.Sprintf("%s called %s on %s", detail.actor(), detail.EventName, resourceID),
+		Detail:       fmt.Sprintf("IAM permissions changed: %s %s.", detail.EventName, resourceID),
+		Remediation:  "Confirm the change was approved. If it was not, revert it and review what the affected principals did since. Manage IAM policies through infrastructure as code so changes are reviewed before they are made.",
+	}, true
+}
+
+// unusualRegion reports an API call in a region the account made no API calls in during the
+// lookback, once the account has enough history to judge by
+func (a *AnomalyDetector) unusualRegion(ctx context.Context, event *eventpipeline.Event, detail *apiCallDetail, accountID string) (Anomaly, bool, error) {
+	if a.events == nil || event.DetailType != eventpipeline.DetailTypeAPICall || event.Region == "" || detail.UserIdentity.InvokedBy != "" {
+		return Anomaly{}, false, nil
+	}
+	filter := events.Filter{
+		TenantID:   event.TenantID,
+		DetailType: eventpipeline.DetailTypeAPICall,
+		From:       event.Time.Add(-unusualRegionLookback),
+		To:         event.Time,
+	}
+	total, err := a.events.Count(ctx, filter, unusualRegionBaseline)
+	if err != nil || total < unusualRegionBaseline {
+		return Anomaly{}, false, err
+	}
+	filter.Region = event.Region
+	regional, err := a.events.Count(ctx, filter, 1)
+	if err != nil || regional > 0 {
+		return Anomaly{}, false, err
+	}
+	return Anomaly{
+		Kind:         AnomalyUnusualRegion,
+		Severity:     "medium",
+		ResourceType: "AWS::::Account",
+		ResourceID:   fmt.Sprintf("%s/%s", accountID, event.Region),
+		Region:       event.Region,
+		Title:        fmt.Sprintf("API activity in unusual region %s", event.Region),
+		Detail:       fmt.Sprintf("%s called %s %s in %s, where the account made no API calls in the previous %d days.", detail.actor(), detail.EventSource, detail.EventName, event.Region, int(unusualRegionLookback.Hours()/24)),
+		Remediation:  "Confirm the activity is expected. If the account does not use the region, deny it with a service control policy on aws:RequestedRegion and review the resources created there.",
+	}, true, nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+)
+
+func TestOpenToInternet(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission string
+		want       bool
+	}{
+		{"config ipRanges string", `{"ipRanges": ["0.0.0.0/0"]}`, true},
+		{"config ipv4Ranges object", `{"ipv4Ranges": [{"cidrIp": "0.0.0.0/0"}]}`, true},
+		{"config ipv6Ranges object", `{"ipv6Ranges": [{"cidrIpv6": "::/0"}]}`, true},
+		{"config capitalized keys", `{"IpRanges": ["0.0.0.0/0"]}`, true},
+		{"config narrower ranges", `{"ipRanges": ["10.0.0.0/8"], "ipv6Ranges": [{"cidrIpv6": "2001:db8::/32"}]}`, false},
+		{"config one of several ranges open", `{"ipv4Ranges": [{"cidrIp": "10.0.0.0/8"}, {"cidrIp": "0.0.0.0/0"}]}`, true},
+		{"no ranges", `{"ipProtocol": "tcp"}`, false},
+		{"cloudtrail ipRanges items", `{"ipRanges": {"items": [{"cidrIp": "0.0.0.0/0"}]}}`, true},
+		{"cloudtrail ipv6Ranges items", `{"ipv6Ranges": {"items": [{"cidrIpv6": "::/0"}]}}`, true},
+		{"cloudtrail narrower range", `{"ipRanges": {"items": [{"cidrIp": "192.168.0.0/16"}]}}`, false},
+		{"cloudtrail security group source", `{"groups": {"items": [{"groupId": "sg-123"}]}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var permission map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.permission), &permission); err != nil {
+				t.Fatal(err)
+			}
+			if got := openToInternet(cloudTrailPermission(permission)); got != tt.want {
+				t.Errorf("openToInternet(%s) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnomalyDetectorDetect(t *testing.T) {
+	type want struct {
+		kind       string
+		severity   string
+		resourceID string
+	}
+	tests := []struct {
+		name   string
+		detail string
+		want   []want
+	}{
+		{
+			name: "console login without mfa",
+			detail: `{"eventSource": "signin.amazonaws.com", "eventName": "ConsoleLogin",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice", "accountId": "111122223333"},
+				"responseElements": {"ConsoleLogin": "Success"}, "additionalEventData": {"MFAUsed": "No"}}`,
+			want: []want{{AnomalyConsoleLoginWithoutMFA, "high", "arn:aws:iam::111122223333:user/alice"}},
+		},
+		{
+			name: "console login with mfa",
+			detail: `{"eventSource": "signin.amazonaws.com", "eventName": "ConsoleLogin",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/alice", "accountId": "111122223333"},
+				"responseElements": {"ConsoleLogin": "Success"}, "additionalEventData": {"MFAUsed": "Yes"}}`,
+		},
+		{
+			name: "federated console login",
+			detail: `{"eventSource": "signin.amazonaws.com", "eventName": "ConsoleLogin",
+				"userIdentity": {"type": "AssumedRole", "arn": "arn:aws:sts::111122223333:assumed-role/sso/alice", "accountId": "111122223333"},
+				"responseElements": {"ConsoleLogin": "Success"}, "additionalEventData": {"MFAUsed": "No"}}`,
+		},
+		{
+			name: "root console login without mfa",
+			detail: `{"eventSource": "signin.amazonaws.com", "eventName": "ConsoleLogin",
+				"userIdentity": {"type": "Root", "arn": "arn:aws:iam::111122223333:root", "accountId": "111122223333"},
+				"responseElements": {"ConsoleLogin": "Success"}, "additionalEventData": {"MFAUsed": "No"}}`,
+			want: []want{
+				{AnomalyConsoleLoginWithoutMFA, "critical", "111122223333"},
+				{AnomalyRootAccountUsage, "high", "111122223333"},
+			},
+		},
+		{
+			name: "root call made by a service",
+			detail: `{"eventSource": "s3.amazonaws.com", "eventName": "PutObject", "eventType": "AwsServiceEvent",
+				"userIdentity": {"type": "Root", "accountId": "111122223333"}}`,
+		},
+		{
+			name: "cloudtrail stopped",
+			detail: `{"eventSource": "cloudtrail.amazonaws.com", "eventName": "StopLogging",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"name": "org-trail"}}`,
+			want: []want{{AnomalyMonitoringDisabled, "critical", "org-trail"}},
+		},
+		{
+			name: "guardduty detector disabled",
+			detail: `{"eventSource": "guardduty.amazonaws.com", "eventName": "UpdateDetector",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"detectorId": "abc123", "enable": false}}`,
+			want: []want{{AnomalyMonitoringDisabled, "critical", "abc123"}},
+		},
+		{
+			name: "guardduty detector updated but still enabled",
+			detail: `{"eventSource": "guardduty.amazonaws.com", "eventName": "UpdateDetector",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"detectorId": "abc123", "enable": true}}`,
+		},
+		{
+			name: "ssh opened to the internet",
+			detail: `{"eventSource": "ec2.amazonaws.com", "eventName": "AuthorizeSecurityGroupIngress",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"groupId": "sg-0123", "ipPermissions": {"items": [
+					{"ipProtocol": "tcp", "fromPort": 22, "toPort": 22, "ipRanges": {"items": [{"cidrIp": "0.0.0.0/0"}]}}]}}}`,
+			want: []want{{AnomalyOpenIngress, "high", "sg-0123"}},
+		},
+		{
+			name: "other port opened to the internet over ipv6",
+			detail: `{"eventSource": "ec2.amazonaws.com", "eventName": "AuthorizeSecurityGroupIngress",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"groupName": "web", "ipPermissions": {"items": [
+					{"ipProtocol": "tcp", "fromPort": 8080, "toPort": 8080, "ipv6Ranges": {"items": [{"cidrIpv6": "::/0"}]}}]}}}`,
+			want: []want{{AnomalyOpenIngress, "medium", "web"}},
+		},
+		{
+			name: "ingress from a private range",
+			detail: `{"eventSource": "ec2.amazonaws.com", "eventName": "AuthorizeSecurityGroupIngress",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"groupId": "sg-0123", "ipPermissions": {"items": [
+					{"ipProtocol": "-1", "ipRanges": {"items": [{"cidrIp": "10.0.0.0/8"}]}}]}}}`,
+		},
+		{
+			name: "administrator access attached to a role",
+			detail: `{"eventSource": "iam.amazonaws.com", "eventName": "AttachRolePolicy",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"roleName": "deploy", "policyArn": "arn:aws:iam::aws:policy/AdministratorAccess"}}`,
+			want: []want{{AnomalyIAMPolicyChange, "high", "deploy"}},
+		},
+		{
+			name: "inline user policy changed",
+			detail: `{"eventSource": "iam.amazonaws.com", "eventName": "PutUserPolicy",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"userName": "carol", "policyName": "s3-read"}}`,
+			want: []want{{AnomalyIAMPolicyChange, "medium", "carol"}},
+		},
+		{
+			name: "failed call",
+			detail: `{"eventSource": "cloudtrail.amazonaws.com", "eventName": "StopLogging", "errorCode": "AccessDenied",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111122223333:user/bob", "accountId": "111122223333"},
+				"requestParameters": {"name": "org-trail"}}`,
+		},
+		{
+			name: "call made by cloudloom",
+			detail: `{"eventSource": "cloudtrail.amazonaws.com", "eventName": "DeleteTrail",
+				"userIdentity": {"type": "AssumedRole", "arn": "arn:aws:sts::111122223333:assumed-role/CloudLoomRole/CloudLoomSession", "accountId": "111122223333"},
+				"requestParameters": {"name": "cloudloom-trail"}}`,
+		},
+	}
+
+	detector := NewAnomalyDetector(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &eventpipeline.Event{
+				Envelope: &eventpipeline.Envelope{
+					DetailType: eventpipeline.DetailTypeAPICall,
+					Region:     "us-east-1",
+					Detail:     json.RawMessage(tt.detail),
+				},
+				TenantID: "111122223333",
+			}
+			anomalies, err := detector.Detect(context.Background(), event)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if len(anomalies) != len(tt.want) {
+				t.Fatalf("Detect() returned %d anomalies, want %d: %+v", len(anomalies), len(tt.want), anomalies)
+			}
+			for i, w := range tt.want {
+				got := anomalies[i]
+				if got.Kind != w.kind || got.Severity != w.severity || got.ResourceID != w.resourceID {
+					t.Errorf("anomaly %d = %s/%s/%s, want %s/%s/%s", i, got.Kind, got.Severity, got.ResourceID, w.kind, w.severity, w.resourceID)
+				}
+				if got.Region != "us-east-1" {
+					t.Errorf("anomaly %d region = %q, want us-east-1", i, got.Region)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigateway"
+	apigwtypes "github.com/aws/aws-sdk-go-v2/service/apigateway/types"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/appsync"
+	appsynctypes "github.com/aws/aws-sdk-go-v2/service/appsync/types"
+)
+
+// Compliance rules evaluated against API Gateway and AppSync APIs
+const (
+	RuleAPIAuthorizationRequired = "cloudloom-api-authorization-required"
+	RuleAPINoOpenResourcePolicy  = "cloudloom-api-no-open-resource-policy"
+	RuleAPIExecutionLogging      = "cloudloom-api-execution-logging-enabled"
+)
+
+// Kinds of exposed endpoint
+const (
+	ExposureRESTAPI      = "rest_api"
+	ExposureHTTPAPI      = "http_api"
+	ExposureWebSocketAPI = "websocket_api"
+	ExposureGraphQLAPI   = "graphql_api"
+)
+
+// ExposedEndpoint is an API reachable from the internet and what protects it. Together these
+// make up the inventory's public exposure view.
+type ExposedEndpoint struct {
+	Kind         string   `json:"kind"`
+	ResourceType string   `json:"resourceType"`
+	ResourceID   string   `json:"resourceId"`
+	Name         string   `json:"name"`
+	Endpoints    []string `json:"endpoints,omitempty"`
+	// Unauthenticated lists the methods or routes callable without any authorizer
+	Unauthenticated []string `json:"unauthenticated,omitempty"`
+	OpenPolicy      bool     `json:"openPolicy"`
+	LoggingEnabled  bool     `json:"loggingEnabled"`
+}
+
+// apiCheck is the result of auditing one API, whether or not it is public
+type apiCheck struct {
+	endpoint ExposedEndpoint
+	public   bool
+	// hasPolicy is set for API types that support resource policies
+	hasPolicy bool
+}
+
+// AuditAPIExposure enumerates REST, HTTP and WebSocket APIs and AppSync GraphQL APIs, and flags
+// those callable without an authorizer, with resource policies open to everyone, or without
+// execution logging. Public APIs are returned as the inventory's public exposure.
+func (cs *ConfigService) AuditAPIExposure(ctx context.Context, cfg aws.Config) ([]ExposedEndpoint, []ComplianceRule, error) {
+	log.Println("[APIExposure] Auditing API Gateway and AppSync APIs...")
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var checks []apiCheck
+	rest, err := auditRESTAPIs(ctx, apigateway.NewFromConfig(cfg), accountID, cfg.Region)
+	if err != nil {
+		return nil, nil, err
+	}
+	checks = append(checks, rest...)
+
+	for _, audit := range []func() ([]apiCheck, error){
+		func() ([]apiCheck, error) { return auditHTTPAPIs(ctx, apigatewayv2.NewFromConfig(cfg)) },
+		func() ([]apiCheck, error) { return auditGraphQLAPIs(ctx, appsync.NewFromConfig(cfg)) },
+	} {
+		found, err := audit()
+		if err != nil {
+			log.Printf("[APIExposure] Warning: %v", err)
+		}
+		checks = append(checks, found...)
+	}
+
+	now := time.Now()
+	authorization := newAuditRule(RuleAPIAuthorizationRequired, "")
+	openPolicy := newAuditRule(RuleAPINoOpenResourcePolicy, "")
+	logging := newAuditRule(RuleAPIExecutionLogging, "")
+	exposure := []ExposedEndpoint{}
+	for _, check := range checks {
+		e := check.endpoint
+		if check.public {
+			exposure = append(exposure, e)
+			authorization.evaluateAs(e.ResourceType, e.ResourceID, len(e.Unauthenticated) == 0,
+				"Callable without an authorizer: "+strings.Join(e.Unauthenticated, ", "), now)
+		}
+		if check.hasPolicy {
+			openPolicy.evaluateAs(e.ResourceType, e.ResourceID, !e.OpenPolicy, "Resource policy allows invocation by anyone", now)
+		}
+		logging.evaluateAs(e.ResourceType, e.ResourceID, e.LoggingEnabled, "Execution or access logging is not enabled", now)
+	}
+
+	log.Printf("[APIExposure] ✅ Audited %d APIs, %d are public", len(checks), len(exposure))
+	return exposure, []ComplianceRule{authorization.rule(), openPolicy.rule(), logging.rule()}, nil
+}
+
+func auditRESTAPIs(ctx context.Context, client *apigateway.Client, accountID, region string) ([]apiCheck, error) {
+	var checks []apiCheck
+	paginator := apigateway.NewGetRestApisPaginator(client, &apigateway.GetRestApisInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list REST APIs: %w", err)
+		}
+		for _, api := range page.Items {
+			id := aws.ToString(api.Id)
+			check := apiCheck{hasPolicy: true, public: true, endpoint: ExposedEndpoint{
+				Kind:         ExposureRESTAPI,
+				ResourceType: "AWS::ApiGateway::RestApi",
+				ResourceID:   id,
+				Name:         aws.ToString(api.Name),
+			}}
+			if api.EndpointConfiguration != nil {
+				for _, t := range api.EndpointConfiguration.Types {
+					if t == apigwtypes.EndpointTypePrivate {
+						check.public = false
+					}
+				}
+			}
+			if api.DisableExecuteApiEndpoint {
+				check.public = false
+			}
+
+			// REST API policies come back with their quotes escaped
+			policy := strings.ReplaceAll(aws.ToString(api.Policy), `\"`, `"`)
+			grants, err := ExternalGrants(policy, accountID)
+			if err != nil {
+				log.Printf("[APIExposure] Warning: REST API %s: %v", id, err)
+			}
+			for _, grant := range grants {
+				if grant.Principal == "*" && !grant.Conditional {
+					check.endpoint.OpenPolicy = true
+				}
+			}
+
+			if methods, err := unauthenticatedMethods(ctx, client, id); err != nil {
+				log.Printf("[APIExposure] Warning: %v", err)
+			} else {
+				check.endpoint.Unauthenticated = methods
+			}
+
+			stages, err := client.GetStages(ctx, &apigateway.GetStagesInput{RestApiId: api.Id})
+			if err != nil {
+				log.Printf("[APIExposure] Warning: failed to get stages of REST API %s: %v", id, err)
+			} else {
+				check.endpoint.LoggingEnabled = len(stages.Item) > 0
+				for _, stage := range stages.Item {
+					name := aws.ToString(stage.StageName)
+					check.endpoint.Endpoints = append(check.endpoint.Endpoints,
+						fmt.Sprintf("https://%s.execute-api.%s.amazonaws.com/%s", id, region, name))
+					if !restStageLogs(stage) {
+						check.endpoint.LoggingEnabled = false
+					}
+				}
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// unauthenticatedMethods lists "METHOD /path" for every REST method without an authorizer or
+// API key. CORS preflight OPTIONS methods are expected to be open and are skipped.
+func unauthenticatedMethods(ctx context.Context, client *apigateway.Client, apiID string) ([]string, error) {
+	var open []string
+	paginator := apigateway.NewGetResourcesPaginator(client, &apigateway.GetResourcesInput{
+		RestApiId: aws.String(apiID),
+		Embed:     []string{"methods"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resources of REST API %s: %w", apiID, err)
+		}
+		for _, resource := range page.Items {
+			for verb, method := range resource.ResourceMethods {
+				if verb == "OPTIONS" {
+					continue
+				}
+				if strings.EqualFold(aws.ToString(method.AuthorizationType), "NONE") && !aws.ToBool(method.ApiKeyRequired) {
+					open = append(open, verb+" "+aws.ToString(resource.Path))
+				}
+			}
+		}
+	}
+	sort.Strings(open)
+	return open, nil
+}
+
+// restStageLogs reports whether a REST stage writes execution or access logs
+func restStageLogs(stage apigwtypes.Stage) bool {
+	if stage.AccessLogSettings != nil && aws.ToString(stage.AccessLogSettings.DestinationArn) != "" {
+		return true
+	}
+	if settings, ok := stage.MethodSettings["*/*"]; ok {
+		level := aws.ToString(settings.LoggingLevel)
+		return level != "" && level != "OFF"
+	}
+	return false
+}
+
+func auditHTTPAPIs(ctx context.Context, client *apigatewayv2.Client) ([]apiCheck, error) {
+	var checks []apiCheck
+	input := &apigatewayv2.GetApisInput{}
+	for {
+		page, err := client.GetApis(ctx, input)
+		if err != nil {
+			return checks, fmt.Errorf("failed to list HTTP and WebSocket APIs: %w", err)
+		}
+		for _, api := range page.Items {
+			id := aws.ToString(api.ApiId)
+			kind := ExposureHTTPAPI
+			if api.ProtocolType == "WEBSOCKET" {
+				kind = ExposureWebSocketAPI
+			}
+			check := apiCheck{public: !aws.ToBool(api.DisableExecuteApiEndpoint), endpoint: ExposedEndpoint{
+				Kind:         kind,
+				ResourceType: "AWS::ApiGatewayV2::Api",
+				ResourceID:   id,
+				Name:         aws.ToString(api.Name),
+				Endpoints:    []string{aws.ToString(api.ApiEndpoint)},
+			}}
+
+			routes, err := client.GetRoutes(ctx, &apigatewayv2.GetRoutesInput{ApiId: api.ApiId})
+			if err != nil {
+				log.Printf("[APIExposure] Warning: failed to get routes of API %s: %v", id, err)
+			} else {
+				for _, route := range routes.Items {
+					if route.AuthorizationType == "NONE" && !aws.ToBool(route.ApiKeyRequired) {
+						check.endpoint.Unauthenticated = append(check.endpoint.Unauthenticated, aws.ToString(route.RouteKey))
+					}
+				}
+				sort.Strings(check.endpoint.Unauthenticated)
+			}
+
+			stages, err := client.GetStages(ctx, &apigatewayv2.GetStagesInput{ApiId: api.ApiId})
+			if err != nil {
+				log.Printf("[APIExposure] Warning: failed to get stages of API %s: %v", id, err)
+			} else {
+				check.endpoint.LoggingEnabled = len(stages.Items) > 0
+				for _, stage := range stages.Items {
+					if stage.AccessLogSettings == nil || aws.ToString(stage.AccessLogSettings.DestinationArn) == "" {
+						check.endpoint.LoggingEnabled = false
+					}
+				}
+			}
+			checks = append(checks, check)
+		}
+		if aws.ToString(page.NextToken) == "" {
+			return checks, nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
+
+func auditGraphQLAPIs(ctx context.Context, client *appsync.Client) ([]apiCheck, error) {
+	var checks []apiCheck
+	paginator := appsync.NewListGraphqlApisPaginator(client, &appsync.ListGraphqlApisInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return checks, fmt.Errorf("failed to list AppSync APIs: %w", err)
+		}
+		for _, api := range page.GraphqlApis {
+			check := apiCheck{public: api.Visibility != appsynctypes.GraphQLApiVisibilityPrivate, endpoint: ExposedEndpoint{
+				Kind:         ExposureGraphQLAPI,
+				ResourceType: "AWS::AppSync::GraphQLApi",
+				ResourceID:   aws.ToString(api.ApiId),
+				Name:         aws.ToString(api.Name),
+			}}
+			for _, uri := range api.Uris {
+				check.endpoint.Endpoints = append(check.endpoint.Endpoints, uri)
+			}
+			sort.Strings(check.endpoint.Endpoints)
+
+			// An API key identifies the caller's app, not the caller, so API_KEY alone is no authorizer
+			keyOnly := api.AuthenticationType == appsynctypes.AuthenticationTypeApiKey
+			for _, provider := range api.AdditionalAuthenticationProviders {
+				if provider.AuthenticationType != appsynctypes.AuthenticationTypeApiKey {
+					keyOnly = false
+				}
+			}
+			if keyOnly {
+				check.endpoint.Unauthenticated = []string{"API_KEY"}
+			}
+
+			check.endpoint.LoggingEnabled = api.LogConfig != nil && api.LogConfig.FieldLogLevel != appsynctypes.FieldLogLevelNone
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionAuditLogs
+
+// Entry records a single state-changing API call
+type Entry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID  string             `bson:"tenantId,omitempty" json:"tenantId,omitempty"`
+	Action    string             `bson:"action" json:"action"`
+	Method    string             `bson:"method" json:"method"`
+	Path      string             `bson:"path" json:"path"`
+	Status    int                `bson:"status" json:"status"`
+	ClientIP  string             `bson:"clientIp,omitempty" json:"clientIp,omitempty"`
+	UserAgent string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	LatencyMs int64              `bson:"latencyMs" json:"latencyMs"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// Log persists audit entries in MongoDB
+type Log struct {
+	collection *mongo.Collection
+}
+
+var defaultLog *Log
+
+// Init creates the process-wide audit log backed by the given database
+func Init(db *mongo.Database) *Log {
+	defaultLog = NewLog(db)
+	return defaultLog
+}
+
+// Default returns the process-wide audit log created by Init
+func Default() *Log {
+	return defaultLog
+}
+
+// NewLog creates a Log using the audit_logs collection
+func NewLog(db *mongo.Database) *Log {
+	return &Log{collection: db.Collection(collectionName)}
+}
+
+// Record stores an audit entry
+func (l *Log) Record(ctx context.Context, entry *Entry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if _, err := l.collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns the tenant's most recent audit entries
+func (l *Log) List(ctx context.Context, tenantID string, limit int64) ([]Entry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(limit)
+	cursor, err := l.collection.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// purgeAction is the route, under any API version, that purges a tenant's data. Its entries
+// are recorded without the tenant, client IP or user agent, which the purge has just removed
+// from every other entry.
+const purgeAction = "/tenant/purge"
+
+// Middleware records every state-changing request (anything but GET, HEAD and OPTIONS)
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		l := Default()
+		if l == nil {
+			return
+		}
+		entry := &Entry{
+			TenantID:  common.TenantID(c),
+			Action:    c.FullPath(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			LatencyMs: time.Since(start).Milliseconds(),
+			Timestamp: start,
+		}
+		if c.Request.Method == http.MethodPost && strings.HasSuffix(entry.Action, purgeAction) {
+			entry.TenantID, entry.ClientIP, entry.UserAgent = "", "", ""
+		}
+
+		// Write outside the request so a slow database doesn't delay the response
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := l.Record(ctx, entry); err != nil {
+				log.Printf("[Audit] Warning: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evidenceColumns are the columns of a CSV evidence export, in order
+var evidenceColumns = []string{
+	"sequence", "occurredAt", "event", "remediationId", "trigger", "actor", "playbook",
+	"findingId", "findingType", "action", "resourceType", "resourceId", "region",
+	"outcome", "reason", "error", "changes", "calls", "before", "after", "prevHash", "hash",
+}
+
+// Evidence is a tenant's remediation audit records over a period, with the verification of
+// the whole chain they belong to, as handed to auditors
+type Evidence struct {
+	TenantID     string              `json:"tenantId"`
+	From         time.Time           `json:"from"`
+	To           time.Time           `json:"to"`
+	Records      []RemediationRecord `json:"records"`
+	Verification *Verification       `json:"verification"`
+	GeneratedAt  time.Time           `json:"generatedAt"`
+}
+
+// WriteCSV writes the records one per row, with changes joined by newlines and the calls and
+// states as JSON
+func (e *Evidence) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(evidenceColumns); err != nil {
+		return err
+	}
+	for _, r := range e.Records {
+		err := writer.Write([]string{
+			strconv.FormatInt(r.Sequence, 10), r.OccurredAt.UTC().Format(time.RFC3339Nano), r.Event, r.RemediationID,
+			r.Trigger, r.Actor, r.Playbook, r.FindingID, r.FindingType, r.Action, r.ResourceType, r.ResourceID,
+			r.Region, r.Outcome, r.Reason, r.Error, strings.Join(r.Changes, "\n"), string(r.Calls), string(r.Before),
+			string(r.After), r.PrevHash, r.Hash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// PDF renders the evidence as a plain-text report: the chain verification first, then every
+// record with its hashes
+func (e *Evidence) PDF() []byte {
+	doc := &pdfDocument{}
+	doc.line("CloudLoom remediation audit evidence")
+	doc.line("")
+	doc.line("Account:      " + e.TenantID)
+	doc.line("Period:       " + evidencePeriod(e.From, e.To))
+	doc.line("Generated at: " + e.GeneratedAt.UTC().Format(time.RFC3339))
+	doc.line(fmt.Sprintf("Records:      %d in the period", len(e.Records)))
+	if v := e.Verification; v != nil {
+		status := fmt.Sprintf("VALID - %d records, last hash %s", v.Records, v.LastHash)
+		if !v.Valid {
+			status = fmt.Sprintf("BROKEN at record %d: %s", v.BrokenAt, v.Reason)
+		}
+		doc.line("Hash chain:   " + status)
+	}
+
+	for _, r := range e.Records {
+		doc.line("")
+		doc.line(strings.Repeat("-", pdfColumns))
+		doc.line(fmt.Sprintf("#%d  %s  %s %s", r.Sequence, r.OccurredAt.UTC().Format(time.RFC3339), r.Action, r.Event))
+		doc.field("Remediation", r.RemediationID)
+		doc.field("Triggered by", strings.TrimSpace(r.Trigger+" "+r.Playbook))
+		doc.field("Actor", r.Actor)
+		doc.field("Finding", strings.TrimSpace(r.FindingID+" "+r.FindingType))
+		doc.field("Resource", strings.TrimSpace(r.ResourceType+" "+r.ResourceID+" "+r.Region))
+		doc.field("Outcome", r.Outcome)
+		doc.field("Reason", r.Reason)
+		doc.field("Error", r.Error)
+		for _, change := range r.Changes {
+			doc.field("Change", change)
+		}
+		doc.field("API calls", string(r.Calls))
+		doc.field("Before", string(r.Before))
+		doc.field("After", string(r.After))
+		doc.field("Previous hash", r.PrevHash)
+		doc.field("Hash", r.Hash)
+	}
+	return doc.bytes()
+}
+
+func evidencePeriod(from, to time.Time) string {
+	period := "beginning"
+	if !from.IsZero() {
+		period = from.UTC().Format(time.RFC3339)
+	}
+	if to.IsZero() {
+		return period + " to now"
+	}
+	return period + " to " + to.UTC().Format(time.RFC3339)
+}
+
+const (
+	// pdfColumns is how many Courier characters fit across an A4 page at pdfFontSize
+	pdfColumns     = 90
+	pdfFontSize    = 9
+	pdfLeading     = 11
+	pdfMargin      = 50
+	pdfPageWidth   = 595
+	pdfPageHeight  = 842
+	pdfLinesOnPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// pdfDocument lays plain text out on A4 pages in Courier, the standard font every PDF reader
+// has, so the report needs no font files or PDF library
+type pdfDocument struct {
+	lines []string
+}
+
+// line adds text, wrapped at pdfColumns
+func (d *pdfDocument) line(text string) {
+	text = pdfSafe(text)
+	for len(text) > pdfColumns {
+		d.lines = append(d.lines, text[:pdfColumns])
+		text = "    " + text[pdfColumns:]
+	}
+	d.lines = append(d.lines, text)
+}
+
+// field adds a labelled value, skipping empty ones
+func (d *pdfDocument) field(label, value string) {
+	if value != "" {
+		d.line(fmt.Sprintf("  %-14s %s", label+":", value))
+	}
+}
+
+// bytes writes the document: the catalog, the page tree, the font, then each page and its
+// content stream, followed by the cross-reference table
+func (d *pdfDocument) bytes() []byte {
+	var pages [][]string
+	for start := 0; start < len(d.lines); start += pdfLinesOnPage {
+		pages = append(pages, d.lines[start:min(start+pdfLinesOnPage, len(d.lines))])
+	}
+	if len(pages) == 0 {
+		pages = [][]string{{}}
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		// Pages start at object 4, each followed by its content stream
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+	for i, lines := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfSafe keeps printable ASCII, which the standard fonts can show, and flattens whitespace
+func pdfSafe(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\n' || r == '\t' || r == '\r':
+			b.WriteByte(' ')
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pdfEscape escapes the characters that end or escape a PDF string
+func pdfEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(text)
+}
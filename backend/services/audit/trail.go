@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const trailCollectionName = config.CollectionRemediationAudit
+
+// appendAttempts bounds how often Append retries when another record took its sequence number
+const appendAttempts = 5
+
+// ErrRecordNotFound is returned when a remediation audit record does not exist for the tenant
+var ErrRecordNotFound = errors.New("audit record not found")
+
+// What happened to a remediation
+const (
+	EventProposed   = "proposed"
+	EventApproved   = "approved"
+	EventRejected   = "rejected"
+	EventBlocked    = "blocked"
+	EventExecuted   = "executed"
+	EventRolledBack = "rolled-back"
+)
+
+// RemediationRecord is one entry of a tenant's remediation audit trail. Records are only ever
+// appended: each holds the hash of the one before it, and its own hash covers every field
+// including that link, so changing or removing a record breaks the chain from there on.
+type RemediationRecord struct {
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	TenantID string             `bson:"tenantId" json:"tenantId"`
+	// Sequence numbers the tenant's records from 1 with no gaps
+	Sequence      int64  `bson:"sequence" json:"sequence"`
+	Event         string `bson:"event" json:"event"`
+	RemediationID string `bson:"remediationId" json:"remediationId"`
+	// Trigger is what started the remediation, and Actor the user who caused the event, or
+	// cloudloom when nobody did
+	Trigger      string `bson:"trigger" json:"trigger"`
+	Actor        string `bson:"actor" json:"actor"`
+	Playbook     string `bson:"playbook,omitempty" json:"playbook,omitempty"`
+	FindingID    string `bson:"findingId" json:"findingId"`
+	FindingType  string `bson:"findingType" json:"findingType"`
+	Action       string `bson:"action" json:"action"`
+	ResourceType string `bson:"resourceType" json:"resourceType"`
+	ResourceID   string `bson:"resourceId" json:"resourceId"`
+	Region       string `bson:"region,omitempty" json:"region,omitempty"`
+	// Calls are the AWS API calls the action was to make, as JSON
+	Calls json.RawMessage `bson:"calls,omitempty" json:"calls,omitempty"`
+	// Changes describe what the action or its rollback changed, one entry per API call
+	Changes []string `bson:"changes,omitempty" json:"changes,omitempty"`
+	// Before and After are the state of what the action changes, as JSON, when the action
+	// can capture it
+	Before json.RawMessage `bson:"before,omitempty" json:"before,omitempty"`
+	After  json.RawMessage `bson:"after,omitempty" json:"after,omitempty"`
+	// Outcome is the remediation's status after the event
+	Outcome string `bson:"outcome" json:"outcome"`
+	// Reason is why a reviewer rejected the remediation or a guardrail held it back
+	Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	OccurredAt time.Time `bson:"occurredAt" json:"occurredAt"`
+	PrevHash   string    `bson:"prevHash" json:"prevHash"`
+	Hash       string    `bson:"hash" json:"hash"`
+}
+
+// digest is the SHA-256 of the record's JSON with Hash left empty. Times are kept to the
+// millisecond in UTC, as MongoDB stores them, so a record read back hashes the same.
+func (r RemediationRecord) digest() (string, error) {
+	r.Hash = ""
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// TrailFilter narrows the records returned by Trail.List
+type TrailFilter struct {
+	TenantID      string
+	RemediationID string
+	FindingID     string
+	From          time.Time
+	To            time.Time
+	Limit         int64
+}
+
+// Verification is the result of walking a tenant's chain of records
+type Verification struct {
+	Valid   bool  `json:"valid"`
+	Records int64 `json:"records"`
+	// BrokenAt is the sequence of the first record whose hash or link does not match, and
+	// Reason why
+	BrokenAt   int64     `json:"brokenAt,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	LastHash   string    `json:"lastHash,omitempty"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// Trail persists hash-chained remediation audit records in MongoDB
+type Trail struct {
+	collection *mongo.Collection
+}
+
+var defaultTrail *Trail
+
+// InitTrail creates the process-wide remediation audit trail backed by the given database
+func InitTrail(db *mongo.Database) *Trail {
+	defaultTrail = NewTrail(db)
+	return defaultTrail
+}
+
+// DefaultTrail returns the process-wide remediation audit trail created by InitTrail
+func DefaultTrail() *Trail {
+	return defaultTrail
+}
+
+// NewTrail creates a Trail using the remediation_audit collection
+func NewTrail(db *mongo.Database) *Trail {
+	return &Trail{collection: db.Collection(trailCollectionName)}
+}
+
+// Append links the record to the end of its tenant's chain and stores it. The unique
+// sequence index keeps two concurrent appends from both linking to the same record; the
+// loser links to the winner and tries again.
+func (t *Trail) Append(ctx context.Context, record *RemediationRecord) error {
+	if record.OccurredAt.IsZero() {
+		record.OccurredAt = time.Now()
+	}
+	record.OccurredAt = record.OccurredAt.UTC().Truncate(time.Millisecond)
+
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		last, err := t.last(ctx, record.TenantID)
+		if err != nil {
+			return err
+		}
+		record.ID, record.Sequence, record.PrevHash = primitive.NewObjectID(), 1, ""
+		if last != nil {
+			record.Sequence, record.PrevHash = last.Sequence+1, last.Hash
+		}
+		if record.Hash, err = record.digest(); err != nil {
+			return err
+		}
+		_, err = t.collection.InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to append audit record: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to append audit record: the chain of tenant %s kept moving", record.TenantID)
+}
+
+func (t *Trail) last(ctx context.Context, tenantID string) (*RemediationRecord, error) {
+	var record RemediationRecord
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	err := t.collection.FindOne(ctx, bson.M{"tenantId": tenantID}, opts).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the last audit record: %w", err)
+	}
+	return &record, nil
+}
+
+// Get returns one of the tenant's records
+func (t *Trail) Get(ctx context.Context, tenantID, id string) (*RemediationRecord, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+	var record RemediationRecord
+	err = t.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit record: %w", err)
+	}
+	return &record, nil
+}
+
+// List returns the tenant's records in chain order. A zero Limit returns them all.
+func (t *Trail) List(ctx context.Context, filter TrailFilter) ([]RemediationRecord, error) {
+	query := bson.M{"tenantId": filter.TenantID}
+	if filter.RemediationID != "" {
+		query["remediationId"] = filter.RemediationID
+	}
+	if filter.FindingID != "" {
+		query["findingId"] = filter.FindingID
+	}
+	occurred := bson.M{}
+	if !filter.From.IsZero() {
+		occurred["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		occurred["$lt"] = filter.To
+	}
+	if len(occurred) > 0 {
+		query["occurredAt"] = occurred
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cursor, err := t.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	records := []RemediationRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode audit records: %w", err)
+	}
+	return records, nil
+}
+
+// Verify walks the tenant's whole chain, recomputing each record's hash and checking it links
+// to the record before it
+func (t *Trail) Verify(ctx context.Context, tenantID string) (*Verification, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := t.collection.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := &Verification{Valid: true}
+	prevHash := ""
+	for cursor.Next(ctx) {
+		var record RemediationRecord
+		if err := cursor.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to decode audit record: %w", err)
+		}
+		result.Records++
+		hash, err := record.digest()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case record.Sequence != result.Records:
+			result.Reason = fmt.Sprintf("expected record %d, found %d", result.Records, record.Sequence)
+		case record.PrevHash != prevHash:
+			result.Reason = "the record does not link to the one before it"
+		case record.Hash != hash:
+			result.Reason = "the record's contents do not match its hash"
+		}
+		if result.Reason != "" {
+			result.Valid, result.BrokenAt = false, result.Records
+			break
+		}
+		prevHash = record.Hash
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+	result.LastHash = prevHash
+	result.VerifiedAt = time.Now()
+	return result, nil
+}
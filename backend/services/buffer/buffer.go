@@ -0,0 +1,322 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionDeliveryBuffer
+
+// DefaultMaxAttempts is how often a buffered delivery is tried before it is dead-lettered.
+// With backoff capped at ten minutes that is about three hours.
+const DefaultMaxAttempts = 25
+
+// Entry is a delivery that could not reach its destination and is waiting to be retried, or
+// that was dead-lettered after failing permanently or too often
+type Entry struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Sink          string             `bson:"sink" json:"sink"`
+	Destination   string             `bson:"destination" json:"destination"`
+	TenantID      string             `bson:"tenantId,omitempty" json:"tenantId,omitempty"`
+	Payload       []byte             `bson:"payload" json:"-"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	LastError     string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	// DeadLetteredAt is set once the delivery is no longer retried
+	DeadLetteredAt *time.Time `bson:"deadLetteredAt,omitempty" json:"deadLetteredAt,omitempty"`
+}
+
+// SinkFunc delivers a tenant's payload to a destination (queue URL, topic, bucket, ...)
+type SinkFunc func(ctx context.Context, tenantID, destination string, payload []byte) error
+
+// SinkStats summarises the buffered backlog for one sink
+type SinkStats struct {
+	Sink          string    `json:"sink"`
+	Pending       int64     `json:"pending"`
+	OldestPending time.Time `json:"oldestPending,omitempty"`
+	DeadLettered  int64     `json:"deadLettered"`
+}
+
+// permanentError marks a delivery failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so a sink's failed delivery is dead-lettered instead of retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Buffer persists failed deliveries in MongoDB and drains them once the destination recovers
+type Buffer struct {
+	collection  *mongo.Collection
+	interval    time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+
+	mu    sync.RWMutex
+	sinks map[string]SinkFunc
+}
+
+var defaultBuffer *Buffer
+
+// Init creates the process-wide buffer backed by the given database
+func Init(db *mongo.Database) *Buffer {
+	defaultBuffer = New(db)
+	return defaultBuffer
+}
+
+// Default returns the process-wide buffer created by Init
+func Default() *Buffer {
+	return defaultBuffer
+}
+
+// New creates a Buffer using the delivery_buffer collection
+func New(db *mongo.Database) *Buffer {
+	return &Buffer{
+		collection:  db.Collection(collectionName),
+		interval:    15 * time.Second,
+		maxBackoff:  10 * time.Minute,
+		maxAttempts: DefaultMaxAttempts,
+		sinks:       make(map[string]SinkFunc),
+	}
+}
+
+// RegisterSink registers the function used to deliver payloads for a sink name
+func (b *Buffer) RegisterSink(name string, fn SinkFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks[name] = fn
+}
+
+func (b *Buffer) sink(name string) (SinkFunc, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	fn, ok := b.sinks[name]
+	return fn, ok
+}
+
+// Deliver sends the payload straight to the sink. If the sink fails, or older
+// deliveries for the same destination are still buffered, the payload is
+// persisted and retried later. A nil error means the payload was either
+// delivered or safely buffered; buffered reports which. Permanent failures
+// are returned without buffering.
+func (b *Buffer) Deliver(ctx context.Context, sinkName, destination, tenantID string, payload []byte) (buffered bool, err error) {
+	fn, ok := b.sink(sinkName)
+	if !ok {
+		return false, fmt.Errorf("unknown delivery sink: %s", sinkName)
+	}
+
+	// Keep ordering per destination: never jump ahead of an existing backlog
+	backlog, err := b.collection.CountDocuments(ctx, bson.M{"sink": sinkName, "destination": destination, "deadLetteredAt": bson.M{"$exists": false}})
+	if err != nil {
+		log.Printf("[Buffer] Warning: failed to check backlog for %s: %v", sinkName, err)
+	}
+
+	if backlog == 0 {
+		deliverErr := fn(ctx, tenantID, destination, payload)
+		if deliverErr == nil {
+			return false, nil
+		}
+		if IsPermanent(deliverErr) {
+			return false, deliverErr
+		}
+		log.Printf("[Buffer] ⚠️ Delivery to %s (%s) failed, buffering: %v", sinkName, destination, deliverErr)
+		return true, b.enqueue(ctx, sinkName, destination, tenantID, payload, deliverErr)
+	}
+
+	log.Printf("[Buffer] %d deliveries already buffered for %s (%s), appending to backlog", backlog, sinkName, destination)
+	return true, b.enqueue(ctx, sinkName, destination, tenantID, payload, nil)
+}
+
+func (b *Buffer) enqueue(ctx context.Context, sinkName, destination, tenantID string, payload []byte, cause error) error {
+	now := time.Now()
+	entry := Entry{
+		Sink:          sinkName,
+		Destination:   destination,
+		TenantID:      tenantID,
+		Payload:       payload,
+		CreatedAt:     now,
+		NextAttemptAt: now.Add(b.interval),
+	}
+	if cause != nil {
+		entry.Attempts = 1
+		entry.LastError = cause.Error()
+	}
+
+	if _, err := b.collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to buffer delivery for %s: %w", sinkName, err)
+	}
+	return nil
+}
+
+// Start drains the buffer on an interval until ctx is cancelled
+func (b *Buffer) Start(ctx context.Context) {
+	log.Printf("[Buffer] Drainer started (interval %s)", b.interval)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[Buffer] Drainer stopped")
+			return
+		case <-ticker.C:
+			b.Drain(ctx)
+		}
+	}
+}
+
+// Drain attempts every buffered delivery that is due, oldest first. The first
+// failure for a destination stops draining that destination so order is kept,
+// unless the delivery is dead-lettered and so no longer holds the others back.
+func (b *Buffer) Drain(ctx context.Context) {
+	cursor, err := b.collection.Find(ctx,
+		bson.M{"nextAttemptAt": bson.M{"$lte": time.Now()}, "deadLetteredAt": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetLimit(500),
+	)
+	if err != nil {
+		log.Printf("[Buffer] Warning: failed to load buffered deliveries: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	blocked := make(map[string]bool)
+	delivered := 0
+
+	for cursor.Next(ctx) {
+		var entry Entry
+		if err := cursor.Decode(&entry); err != nil {
+			log.Printf("[Buffer] Warning: failed to decode buffered delivery: %v", err)
+			continue
+		}
+
+		key := entry.Sink + "|" + entry.Destination
+		if blocked[key] {
+			continue
+		}
+
+		fn, ok := b.sink(entry.Sink)
+		if !ok {
+			// Sink not registered in this process yet; leave the entry for later
+			blocked[key] = true
+			continue
+		}
+
+		if err := fn(ctx, entry.TenantID, entry.Destination, entry.Payload); err != nil {
+			if !b.markFailed(ctx, entry, err) {
+				blocked[key] = true
+			}
+			continue
+		}
+
+		if _, err := b.collection.DeleteOne(ctx, bson.M{"_id": entry.ID}); err != nil {
+			log.Printf("[Buffer] Warning: delivered %s but failed to remove it from the buffer: %v", entry.ID.Hex(), err)
+		}
+		delivered++
+	}
+
+	if delivered > 0 {
+		log.Printf("[Buffer] ✅ Drained %d buffered deliveries", delivered)
+	}
+}
+
+// markFailed schedules the next attempt of a failed delivery, or dead-letters it when the
+// failure is permanent or it has used up its attempts, and reports whether it dead-lettered it
+func (b *Buffer) markFailed(ctx context.Context, entry Entry, cause error) bool {
+	attempts := entry.Attempts + 1
+	if deadLetter(attempts, b.maxAttempts, cause) {
+		now := time.Now()
+		_, err := b.collection.UpdateByID(ctx, entry.ID, bson.M{"$set": bson.M{
+			"attempts":       attempts,
+			"lastError":      cause.Error(),
+			"deadLetteredAt": now,
+		}})
+		if err != nil {
+			log.Printf("[Buffer] Warning: failed to dead-letter buffered delivery %s: %v", entry.ID.Hex(), err)
+		}
+		log.Printf("[Buffer] ❌ Dead-lettered delivery %s to %s (%s) after %d attempts: %v", entry.ID.Hex(), entry.Sink, entry.Destination, attempts, cause)
+		return true
+	}
+
+	backoff := b.backoff(attempts)
+	_, err := b.collection.UpdateByID(ctx, entry.ID, bson.M{"$set": bson.M{
+		"attempts":      attempts,
+		"lastError":     cause.Error(),
+		"nextAttemptAt": time.Now().Add(backoff),
+	}})
+	if err != nil {
+		log.Printf("[Buffer] Warning: failed to update buffered delivery %s: %v", entry.ID.Hex(), err)
+	}
+	log.Printf("[Buffer] %s (%s) still unavailable after %d attempts, next retry in %s", entry.Sink, entry.Destination, attempts, backoff)
+	return false
+}
+
+// deadLetter reports whether a delivery that just failed its attempts-th attempt is given up on
+func deadLetter(attempts, maxAttempts int, cause error) bool {
+	return IsPermanent(cause) || (maxAttempts > 0 && attempts >= maxAttempts)
+}
+
+// backoff returns the delay after the given failed attempt, doubling from the drain interval
+// up to maxBackoff
+func (b *Buffer) backoff(attempts int) time.Duration {
+	return min(b.interval*time.Duration(1<<uint(min(attempts, 10))), b.maxBackoff)
+}
+
+// Stats returns the buffered backlog and dead-lettered deliveries per sink
+func (b *Buffer) Stats(ctx context.Context) ([]SinkStats, error) {
+	deadLettered := bson.D{{Key: "$gt", Value: bson.A{"$deadLetteredAt", nil}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$sink"},
+			{Key: "pending", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{deadLettered, 0, 1}}}}}},
+			{Key: "deadLettered", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{deadLettered, 1, 0}}}}}},
+			{Key: "oldestPending", Value: bson.D{{Key: "$min", Value: bson.D{{Key: "$cond", Value: bson.A{deadLettered, nil, "$createdAt"}}}}}},
+		}}},
+	}
+
+	cursor, err := b.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate buffer stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Sink          string    `bson:"_id"`
+		Pending       int64     `bson:"pending"`
+		DeadLettered  int64     `bson:"deadLettered"`
+		OldestPending time.Time `bson:"oldestPending"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode buffer stats: %w", err)
+	}
+
+	stats := make([]SinkStats, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, SinkStats{Sink: row.Sink, Pending: row.Pending, OldestPending: row.OldestPending, DeadLettered: row.DeadLettered})
+	}
+	return stats, nil
+}
@@ -0,0 +1,97 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("destination unavailable")
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"transient", errUnavailable, false},
+		{"permanent", Permanent(errUnavailable), true},
+		{"wrapped permanent", fmt.Errorf("failed to deliver: %w", Permanent(errUnavailable)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if tt.err != nil && !errors.Is(tt.err, errUnavailable) {
+				t.Errorf("%v does not wrap the sink's error", tt.err)
+			}
+		})
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempts    int
+		maxAttempts int
+		cause       error
+		want        bool
+	}{
+		{"first failure", 1, DefaultMaxAttempts, errUnavailable, false},
+		{"one attempt left", DefaultMaxAttempts - 1, DefaultMaxAttempts, errUnavailable, false},
+		{"out of attempts", DefaultMaxAttempts, DefaultMaxAttempts, errUnavailable, true},
+		{"past the limit", DefaultMaxAttempts + 1, DefaultMaxAttempts, errUnavailable, true},
+		{"permanent on the first attempt", 1, DefaultMaxAttempts, Permanent(errUnavailable), true},
+		{"no limit", 1000, 0, errUnavailable, false},
+		{"permanent without a limit", 1, 0, Permanent(errUnavailable), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deadLetter(tt.attempts, tt.maxAttempts, tt.cause); got != tt.want {
+				t.Errorf("deadLetter(%d, %d, %v) = %v, want %v", tt.attempts, tt.maxAttempts, tt.cause, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := &Buffer{interval: 15 * time.Second, maxBackoff: 10 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 15 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute},
+		{10, 10 * time.Minute},
+		{DefaultMaxAttempts, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			if got := b.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverUnknownSink(t *testing.T) {
+	// The buffer has no collection, so this only passes if Deliver rejects the sink first
+	b := &Buffer{sinks: map[string]SinkFunc{}}
+	buffered, err := b.Deliver(context.Background(), "carrier-pigeon", "dest", "111122223333", []byte("{}"))
+	if err == nil || buffered {
+		t.Errorf("Deliver() = %v, %v, want an unknown sink error", buffered, err)
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// keyPrefix namespaces every key written by the backend
+const keyPrefix = "cloudloom:"
+
+// Cache stores serialized values for hot read paths such as inventory summaries and diagrams
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every key starting with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+var (
+	defaultCache Cache = NewMemory(1000)
+	defaultTTL         = 5 * time.Minute
+)
+
+// nearTTL bounds how long a value read from the shared Mongo cache is kept in process
+const nearTTL = 30 * time.Second
+
+// Init selects the process-wide cache: Redis when REDIS_URL is set, otherwise an in-process
+// LRU sized by CACHE_MAX_ENTRIES, in front of MongoDB when db is not nil so entries are shared
+// by every instance and survive restarts. CACHE_TTL_SECONDS sets the default TTL.
+func Init(db *mongo.Database) Cache {
+	if v, err := strconv.Atoi(os.Getenv("CACHE_TTL_SECONDS")); err == nil && v > 0 {
+		defaultTTL = time.Duration(v) * time.Second
+	}
+
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		redisCache, err := NewRedis(url)
+		if err == nil {
+			log.Println("[Cache] ✅ Using Redis cache")
+			defaultCache = redisCache
+			return defaultCache
+		}
+		log.Printf("[Cache] Warning: %v, falling back to in-memory cache", err)
+	}
+
+	maxEntries := 1000
+	if v, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil && v > 0 {
+		maxEntries = v
+	}
+	if db != nil {
+		log.Printf("[Cache] ✅ Using in-memory LRU cache (%d entries) in front of MongoDB", maxEntries)
+		defaultCache = NewTiered(NewMemory(maxEntries), NewMongo(db), min(nearTTL, defaultTTL))
+		return defaultCache
+	}
+	log.Printf("[Cache] ✅ Using in-memory LRU cache (%d entries)", maxEntries)
+	defaultCache = NewMemory(maxEntries)
+	return defaultCache
+}
+
+// Default returns the process-wide cache
+func Default() Cache {
+	return defaultCache
+}
+
+// TenantKey builds a key scoped to a tenant and the snapshot (e.g. scan job ID) the value was computed from
+func TenantKey(tenantID, snapshot, name string) string {
+	return fmt.Sprintf("%s%s:%s:%s", keyPrefix, tenantID, snapshot, name)
+}
+
+// InvalidateTenant drops every cached value for the tenant, e.g. after a new scan completes
+func InvalidateTenant(ctx context.Context, tenantID string) {
+	if err := defaultCache.DeletePrefix(ctx, keyPrefix+tenantID+":"); err != nil {
+		log.Printf("[Cache] Warning: failed to invalidate tenant %s: %v", tenantID, err)
+	}
+}
+
+// GetJSON decodes a cached JSON value into out, reporting whether it was found.
+// Cache errors are logged and treated as a miss so callers fall back to the source.
+func GetJSON(ctx context.Context, key string, out interface{}) bool {
+	data, ok, err := defaultCache.Get(ctx, key)
+	if err != nil {
+		log.Printf("[Cache] Warning: failed to read %s: %v", key, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		log.Printf("[Cache] Warning: failed to decode %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// SetJSON stores value as JSON with the default TTL
+func SetJSON(ctx context.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("[Cache] Warning: failed to encode %s: %v", key, err)
+		return
+	}
+	if err := defaultCache.Set(ctx, key, data, defaultTTL); err != nil {
+		log.Printf("[Cache] Warning: failed to write %s: %v", key, err)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache with per-entry expiry
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemory creates an LRU cache holding at most maxEntries values
+func NewMemory(maxEntries int) *Memory {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &Memory{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value for key if present and not expired
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		m.removeLocked(elem)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set stores value under key, evicting the least recently used entry when full
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if elem, ok := m.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		m.order.MoveToFront(elem)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for m.order.Len() > m.maxEntries {
+		m.removeLocked(m.order.Back())
+	}
+	return nil
+}
+
+// Delete removes key
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.removeLocked(elem)
+	}
+	return nil
+}
+
+// DeletePrefix removes every key starting with prefix
+func (m *Memory) DeletePrefix(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, elem := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.removeLocked(elem)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) removeLocked(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).key)
+}
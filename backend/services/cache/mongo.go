@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo is a Cache backed by a MongoDB collection, so entries survive restarts and are shared
+// by every backend instance without running Redis. Expired entries are removed by a TTL index.
+type Mongo struct {
+	collection *mongo.Collection
+}
+
+type mongoEntry struct {
+	Key       string     `bson:"_id"`
+	Value     []byte     `bson:"value"`
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty"`
+}
+
+// NewMongo creates a cache using the cache_entries collection
+func NewMongo(db *mongo.Database) *Mongo {
+	return &Mongo{collection: db.Collection(config.CollectionCacheEntries)}
+}
+
+// Get returns the value for key if present and not expired. The TTL monitor only runs once a
+// minute, so expiry is checked here as well.
+func (m *Mongo) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var entry mongoEntry
+	err := m.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Set stores value under key with the given TTL
+func (m *Mongo) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := mongoEntry{Key: key, Value: value}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Delete removes key
+func (m *Mongo) Delete(ctx context.Context, key string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// DeletePrefix removes every key starting with prefix. An anchored regex is answered from the
+// _id index.
+func (m *Mongo) DeletePrefix(ctx context.Context, prefix string) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+	return err
+}
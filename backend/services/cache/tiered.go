@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Tiered serves reads from a small in-process cache in front of a shared one, so hot keys are
+// answered without a round trip while every instance still sees the same entries. Values
+// read from the shared cache are kept near for at most nearTTL, which bounds how long an
+// instance can serve a value another instance has since deleted.
+type Tiered struct {
+	near    Cache
+	far     Cache
+	nearTTL time.Duration
+}
+
+// NewTiered creates a cache reading through near to far
+func NewTiered(near, far Cache, nearTTL time.Duration) *Tiered {
+	return &Tiered{near: near, far: far, nearTTL: nearTTL}
+}
+
+// Get returns the value for key from the near cache, or from the far one on a near miss
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, err := t.near.Get(ctx, key); err == nil && ok {
+		return value, true, nil
+	}
+	value, ok, err := t.far.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	t.near.Set(ctx, key, value, t.nearTTL)
+	return value, true, nil
+}
+
+// Set stores value in both caches
+func (t *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	nearTTL := t.nearTTL
+	if ttl > 0 && ttl < nearTTL {
+		nearTTL = ttl
+	}
+	t.near.Set(ctx, key, value, nearTTL)
+	return t.far.Set(ctx, key, value, ttl)
+}
+
+// Delete removes key from both caches
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	t.near.Delete(ctx, key)
+	return t.far.Delete(ctx, key)
+}
+
+// DeletePrefix removes every key starting with prefix from both caches
+func (t *Tiered) DeletePrefix(ctx context.Context, prefix string) error {
+	t.near.DeletePrefix(ctx, prefix)
+	return t.far.DeletePrefix(ctx, prefix)
+}
@@ -2,31 +2,170 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"github.com/rishichirchi/cloudloom/services/pollers"
 	"github.com/rishichirchi/cloudloom/services/steampipe"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type CloudTrailService struct{}
+// stopPolling stops the account's SQS poller and reports whether one was running
+func stopPolling(accountID string) bool {
+	return pollers.Default().Stop(accountID)
+}
+
+// CloudTrailService sets up and operates on one customer account through its CloudLoom role
+type CloudTrailService struct {
+	tenant   *tenants.Tenant
+	progress *setupProgress
+	// setupID identifies the running setup in the cloudloom:setup-id tag
+	setupID string
+}
 
+// NewCloudTrailService returns a service for the default role in common.ARNNumber. Code that
+// knows which account it is working on should use NewTenantCloudTrailService instead.
 func NewCloudTrailService() *CloudTrailService {
 	return &CloudTrailService{}
 }
 
+// NewTenantCloudTrailService returns a service that assumes the tenant's role with its
+// external ID in its home region
+func NewTenantCloudTrailService(tenant *tenants.Tenant) *CloudTrailService {
+	return &CloudTrailService{tenant: tenant}
+}
+
+// cloudTrailServiceFor returns a service for the tenant's registered role. Only the legacy
+// tenant, whose account owns the default role in common.ARNNumber, falls back to that role when
+// it has no stored tenant; any other unknown tenant is reported as tenants.ErrNotFound.
+func cloudTrailServiceFor(ctx context.Context, tenantID string) (*CloudTrailService, error) {
+	manager := tenants.Default()
+	if manager == nil || tenantID == "" {
+		return NewCloudTrailService(), nil
+	}
+	tenant, err := manager.Get(ctx, tenantID)
+	if usesDefaultRole(tenantID, err) {
+		return NewCloudTrailService(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewTenantCloudTrailService(tenant), nil
+}
+
+// usesDefaultRole reports whether a tenant whose lookup failed with err is operated on with the
+// default role: only the account that role belongs to may be, and only if it was never onboarded
+func usesDefaultRole(tenantID string, err error) bool {
+	return errors.Is(err, tenants.ErrNotFound) && tenantID == tenants.AccountFromRoleARN(common.ARNNumber)
+}
+
+// assumeTenantRole assumes the role of the tenant's account
+func assumeTenantRole(ctx context.Context, tenantID string) (aws.Config, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return s.assumeRole(ctx)
+}
+
+func (s *CloudTrailService) roleArn() string {
+	if s.tenant != nil {
+		return s.tenant.RoleArn
+	}
+	return common.ARNNumber
+}
+
+func (s *CloudTrailService) externalID() string {
+	if s.tenant != nil && s.tenant.ExternalID != "" {
+		return s.tenant.ExternalID
+	}
+	return common.ExternalID
+}
+
+func (s *CloudTrailService) trailEvents() tenants.TrailEvents {
+	if s.tenant != nil {
+		return s.tenant.TrailEvents
+	}
+	return tenants.TrailEvents{}
+}
+
+func (s *CloudTrailService) notificationEndpoints() []string {
+	if s.tenant != nil {
+		return s.tenant.NotificationEndpoints
+	}
+	return nil
+}
+
+func (s *CloudTrailService) tier() tenants.AccessTier {
+	if s.tenant != nil {
+		return s.tenant.Tier()
+	}
+	return tenants.TierAutoApplyFix
+}
+
+// fifoQueue reports whether the tenant's events are queued on a FIFO queue
+func (s *CloudTrailService) fifoQueue() bool {
+	return s.tenant != nil && s.tenant.FifoQueue
+}
+
+func (s *CloudTrailService) region() string {
+	if s.tenant != nil && s.tenant.Region != "" {
+		return s.tenant.Region
+	}
+	return tenants.DefaultRegion
+}
+
+// OnboardTenant registers the tenant and sets up its account, recording the setup status on
+// the tenant. Different accounts can be onboarded concurrently; starting a second setup of an
+// account that is still being set up fails with tenants.ErrSetupInProgress.
+func OnboardTenant(ctx context.Context, tenant *tenants.Tenant) error {
+	return onboardTenant(ctx, tenant, nil)
+}
+
+func onboardTenant(ctx context.Context, tenant *tenants.Tenant, progress *setupProgress) error {
+	service := &CloudTrailService{tenant: tenant, progress: progress}
+	manager := tenants.Default()
+	if manager == nil {
+		return service.SetupCloudTrail(ctx)
+	}
+	if err := manager.Register(ctx, tenant); err != nil {
+		return err
+	}
+	if err := manager.BeginSetup(ctx, tenant.AccountID); err != nil {
+		return err
+	}
+
+	setupErr := service.SetupCloudTrail(ctx)
+	// Record the outcome even if the request that started setup has gone away
+	if err := manager.FinishSetup(context.WithoutCancel(ctx), tenant.AccountID, setupErr); err != nil {
+		log.Printf("[Tenants] Warning: failed to record setup status of %s: %v", tenant.AccountID, err)
+	}
+	return setupErr
+}
+
 // SetupCloudTrail is the main function to orchestrate the automated setup.
 func (s *CloudTrailService) SetupCloudTrail(ctx context.Context) error {
 
 	fmt.Println("=== Starting CloudTrail Setup ===")
+	s.setupID = primitive.NewObjectID().Hex()
+	if s.progress != nil {
+		s.setupID = s.progress.jobID.Hex()
+	}
 
 	// Get temporary credentials by assuming the customer's role
 	fmt.Println("Step 1: Assuming customer role...")
 	customerCfg, err := s.assumeRole(ctx)
 	if err != nil {
 		fmt.Printf("❌ Failed to assume role: %v\n", err)
-		return err
+		return s.progress.fail(ctx, SetupStepAssumeRole, err)
 	}
 	fmt.Println("✅ Successfully assumed customer role")
 
@@ -37,60 +176,216 @@ func (s *CloudTrailService) SetupCloudTrail(ctx context.Context) error {
 	customerAccountID, err := getAccountID(ctx, &customerCfg)
 	if err != nil {
 		fmt.Printf("❌ Failed to get account ID: %v\n", err)
-		return err
+		return s.progress.fail(ctx, SetupStepAssumeRole, err)
 	}
 	fmt.Printf("✅ Retrieved customer account ID: %s\n", customerAccountID)
+	s.progress.done(ctx, SetupStepAssumeRole, "account "+customerAccountID)
 
-	// Generate predictable names for resources (no UUID for reusability)
-	// S3 bucket names must be DNS-compliant: lowercase, no underscores, 3-63 characters
-	bucketName := fmt.Sprintf("cloudloom-logs-%s", customerAccountID)
-	logGroupName := fmt.Sprintf("/aws/cloudtrail/cloudloom-agent-%s", customerAccountID)
-	trailName := fmt.Sprintf("CloudLoom-Agent-Trail-%s", customerAccountID)
-	queueName := fmt.Sprintf("cloudloom-autoapplyfix-%s", customerAccountID)
-	ruleName := fmt.Sprintf("CloudLoom-AutoApplyFix-Rule-%s", customerAccountID)
+	regionsToMonitor, err := s.resolveRegions(ctx, customerCfg)
+	if err != nil {
+		fmt.Printf("❌ Failed to resolve regions to monitor: %v\n", err)
+		return s.progress.fail(ctx, SetupStepPermissions, err)
+	}
+	if s.allRegions() {
+		// Record the resolved regions so teardown and status checks find every rule
+		if manager := tenants.Default(); manager != nil {
+			if err := manager.SetRegions(ctx, customerAccountID, regionsToMonitor, true); err != nil {
+				log.Printf("[Regions] Warning: failed to record regions of %s: %v", customerAccountID, err)
+			}
+		}
+	}
+
+	// Reuse what an earlier setup created even if the naming convention has changed since,
+	// otherwise use predictable names (no UUID for reusability)
+	fmt.Println("Step 3: Discovering resources from earlier setups by tag...")
+	names := s.resourceNames(ctx, customerCfg, customerAccountID, regionsToMonitor)
+	bucketName, logGroupName, trailName, queueName := names.bucket, names.logGroup, names.trail, names.queue
 
-	fmt.Printf("Step 3: Generated resource names:\n")
+	fmt.Printf("Step 3a: Resource names:\n")
 	fmt.Printf("  - S3 Bucket: %s\n", bucketName)
 	fmt.Printf("  - Log Group: %s\n", logGroupName)
 	fmt.Printf("  - Trail: %s\n", trailName)
+	fmt.Printf("  - SNS Topic: %s\n", names.topic)
 	fmt.Printf("  - SQS Queue: %s\n", queueName)
-	fmt.Printf("  - EventBridge Rule: %s\n", ruleName)
+	fmt.Printf("  - EventBridge Rules: %v\n", names.rules)
+
+	// Fail before creating anything if the role cannot perform every setup step
+	fmt.Printf("Step 3b: Checking regions %v are enabled...\n", regionsToMonitor)
+	replicationRegion := s.replicationRegion()
+	if replicationRegion == customerRegion {
+		return s.progress.fail(ctx, SetupStepPermissions, fmt.Errorf("%w: %s", ErrInvalidReplicationRegion, replicationRegion))
+	}
+	requiredRegions := append([]string{customerRegion}, regionsToMonitor...)
+	if replicationRegion != "" {
+		requiredRegions = append(requiredRegions, replicationRegion)
+	}
+	if err := validateRegions(ctx, customerCfg, requiredRegions); err != nil {
+		fmt.Printf("❌ Region check failed: %v\n", err)
+		return s.progress.fail(ctx, SetupStepPermissions, err)
+	}
+
+	fmt.Println("Step 3c: Simulating role permissions...")
+	tier := s.tier()
+	fmt.Printf("  - Access tier: %s\n", tier)
+	required := setupPermissions(customerAccountID, customerRegion, names, tier)
+	if err := SimulateRolePermissions(ctx, customerCfg, s.roleArn(), required); err != nil {
+		fmt.Printf("❌ Permission check failed: %v\n", err)
+		return s.progress.fail(ctx, SetupStepPermissions, err)
+	}
+	fmt.Println("✅ Role has every permission setup needs")
+	s.progress.done(ctx, SetupStepPermissions, "")
+
+	// Encrypt logs with a customer managed KMS key if the tenant asked for one
+	fmt.Println("Step 3d: Preparing KMS key for log encryption...")
+	kmsKeyArn, resumed := s.resume(ctx, SetupStepEncryptionKey)
+	if names.existingTrail {
+		s.progress.skip(ctx, SetupStepEncryptionKey, "encryption is configured on the existing trail")
+	} else if !resumed {
+		kmsKeyArn, err = s.ensureLogEncryptionKey(ctx, customerCfg, customerAccountID, names.kmsKey, trailName)
+		if err != nil {
+			fmt.Printf("❌ Failed to prepare KMS key: %v\n", err)
+			return s.progress.fail(ctx, SetupStepEncryptionKey, fmt.Errorf("failed to prepare KMS key: %w", err))
+		}
+		if kmsKeyArn == "" {
+			s.progress.done(ctx, SetupStepEncryptionKey, "S3-managed encryption")
+		} else {
+			s.progress.done(ctx, SetupStepEncryptionKey, kmsKeyArn)
+		}
+		s.checkpoint(ctx, SetupStepEncryptionKey, kmsKeyArn)
+	}
 
 	// Create S3 bucket for CloudTrail logs (reuses existing if found)
 	fmt.Println("Step 4: Creating/checking S3 bucket and policy...")
-	err = s.createS3BucketAndPolicy(ctx, customerCfg, bucketName, customerAccountID, customerRegion)
-	if err != nil {
-		fmt.Printf("❌ Failed to create S3 bucket: %v\n", err)
-		return fmt.Errorf("failed to create S3 bucket: %w", err)
+	if names.existingBucket {
+		if _, resumed := s.resume(ctx, SetupStepBucket); !resumed {
+			// The customer's bucket is theirs to manage, so only CloudLoom's statements are added
+			if err := augmentBucketPolicy(ctx, customerCfg, bucketName, customerAccountID); err != nil {
+				fmt.Printf("❌ Failed to update existing S3 bucket policy: %v\n", err)
+				return s.progress.fail(ctx, SetupStepBucket, err)
+			}
+			fmt.Println("✅ Existing S3 bucket policy allows log delivery")
+			s.progress.done(ctx, SetupStepBucket, bucketName)
+			s.checkpoint(ctx, SetupStepBucket, bucketName)
+		}
+	} else if names.existingTrail {
+		s.progress.skip(ctx, SetupStepBucket, "logs are delivered by the existing trail")
+	} else if _, resumed := s.resume(ctx, SetupStepBucket); !resumed {
+		err = s.createS3BucketAndPolicy(ctx, customerCfg, bucketName, customerAccountID, customerRegion, kmsKeyArn)
+		if err != nil {
+			fmt.Printf("❌ Failed to create S3 bucket: %v\n", err)
+			return s.progress.fail(ctx, SetupStepBucket, fmt.Errorf("failed to create S3 bucket: %w", err))
+		}
+		fmt.Println("✅ S3 bucket and policy created successfully")
+		s.tagManaged(ctx, customerCfg, "arn:aws:s3:::"+bucketName)
+		s.progress.done(ctx, SetupStepBucket, bucketName)
+		s.checkpoint(ctx, SetupStepBucket, bucketName)
 	}
-	fmt.Println("✅ S3 bucket and policy created successfully")
 
 	// Create CloudWatch Logs group and its resource policy
 	fmt.Println("Step 5: Creating CloudWatch Log Group...")
-	logGroupArn, err := s.createCloudWatchLogGroup(ctx, &customerCfg, logGroupName, customerRegion)
-	if err != nil {
-		fmt.Printf("❌ Failed to create CloudWatch Log Group: %v\n", err)
-		return fmt.Errorf("failed to create CloudWatch Log Group: %w", err)
+	logGroupArn, resumed := s.resume(ctx, SetupStepLogGroup)
+	if names.existingTrail {
+		s.progress.skip(ctx, SetupStepLogGroup, "logs are delivered by the existing trail")
+	} else if !resumed {
+		arn, err := s.createCloudWatchLogGroup(ctx, &customerCfg, logGroupName, customerRegion)
+		if err != nil {
+			fmt.Printf("❌ Failed to create CloudWatch Log Group: %v\n", err)
+			return s.progress.fail(ctx, SetupStepLogGroup, fmt.Errorf("failed to create CloudWatch Log Group: %w", err))
+		}
+		logGroupArn = *arn
+		fmt.Printf("✅ CloudWatch Log Group created: %s\n", logGroupArn)
+		s.tagManaged(ctx, customerCfg, strings.TrimSuffix(logGroupArn, ":*"))
+		s.progress.done(ctx, SetupStepLogGroup, logGroupName)
+		s.checkpoint(ctx, SetupStepLogGroup, logGroupArn)
+	}
+
+	// Expire old logs in the bucket and log group, if the tenant set a retention
+	fmt.Println("Step 5a: Applying log retention...")
+	if names.existingTrail {
+		s.progress.skip(ctx, SetupStepLogRetention, "retention is managed with the existing trail")
+	} else if _, resumed := s.resume(ctx, SetupStepLogRetention); !resumed {
+		// Expiring objects in the customer's own bucket is left to them
+		retentionBucket := bucketName
+		if names.existingBucket {
+			retentionBucket = ""
+		}
+		retention, err := applyLogRetention(ctx, customerCfg, retentionBucket, logGroupName, s.logRetentionDays())
+		if err != nil {
+			fmt.Printf("❌ Failed to apply log retention: %v\n", err)
+			return s.progress.fail(ctx, SetupStepLogRetention, err)
+		}
+		if retention.Days == 0 {
+			s.progress.done(ctx, SetupStepLogRetention, "logs kept indefinitely")
+		} else {
+			s.progress.done(ctx, SetupStepLogRetention, fmt.Sprintf("logs kept %d days", retention.Days))
+		}
+		s.checkpoint(ctx, SetupStepLogRetention, "")
+	}
+
+	// Replicate the log bucket to the disaster recovery region, if the tenant asked for it
+	if replicationRegion == "" {
+		s.progress.skip(ctx, SetupStepReplication, "no replication region")
+	} else if names.existingBucket || names.existingTrail {
+		s.progress.skip(ctx, SetupStepReplication, "not configured on the customer's own bucket")
+	} else if _, resumed := s.resume(ctx, SetupStepReplication); !resumed {
+		fmt.Printf("Step 5b: Replicating log bucket to %s...\n", replicationRegion)
+		replication, err := s.applyLogReplication(ctx, customerCfg, customerAccountID, bucketName, replicationRegion, kmsKeyArn)
+		if err != nil {
+			fmt.Printf("❌ Failed to configure log replication: %v\n", err)
+			return s.progress.fail(ctx, SetupStepReplication, err)
+		}
+		fmt.Printf("✅ Log bucket replicates to %s\n", replication.DestinationBucket)
+		s.progress.done(ctx, SetupStepReplication, replication.DestinationBucket)
+		s.checkpoint(ctx, SetupStepReplication, replication.DestinationBucket)
 	}
-	fmt.Printf("✅ CloudWatch Log Group created: %s\n", *logGroupArn)
 
 	// Create the IAM role for CloudTrail to write to CloudWatch Logs
 	fmt.Println("Step 6: Creating IAM role for CloudTrail...")
-	cloudTrailRoleArn, err := s.createCloudTrailIAMRole(ctx, &customerCfg, customerAccountID)
-	if err != nil {
-		fmt.Printf("❌ Failed to create CloudTrail IAM role: %v\n", err)
-		return fmt.Errorf("failed to create CloudTrail IAM role: %w", err)
+	cloudTrailRoleArn, resumed := s.resume(ctx, SetupStepTrailRole)
+	if names.existingTrail {
+		s.progress.skip(ctx, SetupStepTrailRole, "logs are delivered by the existing trail")
+	} else if !resumed {
+		arn, err := s.createCloudTrailIAMRole(ctx, &customerCfg, customerAccountID, logGroupArn)
+		if err != nil {
+			fmt.Printf("❌ Failed to create CloudTrail IAM role: %v\n", err)
+			return s.progress.fail(ctx, SetupStepTrailRole, fmt.Errorf("failed to create CloudTrail IAM role: %w", err))
+		}
+		cloudTrailRoleArn = *arn
+		fmt.Printf("✅ CloudTrail IAM role created: %s\n", cloudTrailRoleArn)
+		s.progress.done(ctx, SetupStepTrailRole, cloudTrailRoleArn)
+		s.checkpoint(ctx, SetupStepTrailRole, cloudTrailRoleArn)
 	}
-	fmt.Printf("✅ CloudTrail IAM role created: %s\n", *cloudTrailRoleArn)
 
 	// Create/Update the CloudTrail trail
 	fmt.Println("Step 7: Creating/updating CloudTrail trail...")
-	err = s.createOrUpdateCloudTrailTrail(ctx, &customerCfg, trailName, bucketName, *logGroupArn, *cloudTrailRoleArn)
-	if err != nil {
-		fmt.Printf("❌ Failed to create or update CloudTrail: %v\n", err)
-		return fmt.Errorf("failed to create or update CloudTrail: %w", err)
+	if names.existingTrail {
+		if _, resumed := s.resume(ctx, SetupStepTrail); !resumed {
+			existing, err := useExistingTrail(ctx, customerCfg, customerAccountID, trailName, s.trailEvents())
+			if err == nil && names.existingBucket && existing.Bucket != bucketName {
+				err = fmt.Errorf("%w: %s delivers to %s, not %s", ErrExistingTrailUnusable, existing.Arn, existing.Bucket, bucketName)
+			}
+			if err != nil {
+				fmt.Printf("❌ Failed to use existing CloudTrail trail: %v\n", err)
+				return s.progress.fail(ctx, SetupStepTrail, err)
+			}
+			fmt.Println("✅ Existing CloudTrail trail records what CloudLoom needs")
+			s.progress.done(ctx, SetupStepTrail, existing.Arn)
+			s.checkpoint(ctx, SetupStepTrail, existing.Arn)
+		}
+	} else if _, resumed := s.resume(ctx, SetupStepTrail); !resumed {
+		// CloudTrail may still reject a role IAM reports as usable, so retry while it does
+		err = retryWhilePropagating(ctx, func() error {
+			return s.createOrUpdateCloudTrailTrail(ctx, &customerCfg, trailName, bucketName, logGroupArn, cloudTrailRoleArn, kmsKeyArn, s.trailEvents())
+		}, "InvalidCloudWatchLogsRoleArnException", "InvalidCloudWatchLogsLogGroupArnException")
+		if err != nil {
+			fmt.Printf("❌ Failed to create or update CloudTrail: %v\n", err)
+			return s.progress.fail(ctx, SetupStepTrail, fmt.Errorf("failed to create or update CloudTrail: %w", err))
+		}
+		fmt.Println("✅ CloudTrail trail created/updated successfully")
+		s.tagManaged(ctx, customerCfg, fmt.Sprintf("arn:aws:cloudtrail:%s:%s:trail/%s", customerRegion, customerAccountID, trailName))
+		s.progress.done(ctx, SetupStepTrail, trailName)
+		s.checkpoint(ctx, SetupStepTrail, trailName)
 	}
-	fmt.Println("✅ CloudTrail trail created/updated successfully")
 
 	// // Step 7.5: Enable AWS Config for infrastructure inventory
 	// fmt.Println("Step 7.5: Enabling AWS Config for infrastructure monitoring...")
@@ -104,64 +399,151 @@ func (s *CloudTrailService) SetupCloudTrail(ctx context.Context) error {
 	// 	fmt.Println("✅ AWS Config enabled successfully")
 	// }
 
-	// Create SQS Queue for Auto Apply Fix (reuses existing if found)
-	fmt.Println("Step 8: Creating/checking SQS queue for Auto Apply Fix...")
-	queueInfo, err := s.createSQSQueue(ctx, customerCfg, queueName, customerAccountID)
-	if err != nil {
-		fmt.Printf("❌ Failed to create SQS queue: %v\n", err)
-		return fmt.Errorf("failed to create SQS queue: %w", err)
+	// Every tier notifies the customer of the account's API calls through an SNS topic
+	fmt.Println("Step 7a: Creating/checking SNS topic for notifications...")
+	topicArn, resumed := s.resume(ctx, SetupStepTopic)
+	if !resumed {
+		topicArn, err = s.createNotificationTopic(ctx, customerCfg, names.topic, customerAccountID)
+		if err != nil {
+			fmt.Printf("❌ Failed to create SNS topic: %v\n", err)
+			return s.progress.fail(ctx, SetupStepTopic, err)
+		}
+		s.tagManaged(ctx, customerCfg, topicArn)
+		if endpoints := s.notificationEndpoints(); len(endpoints) > 0 {
+			fmt.Printf("Step 7b: Subscribing %d notification endpoints...\n", len(endpoints))
+			if _, err := subscribeEndpoints(ctx, sns.NewFromConfig(customerCfg), topicArn, endpoints); err != nil {
+				fmt.Printf("❌ Failed to subscribe notification endpoints: %v\n", err)
+				return s.progress.fail(ctx, SetupStepTopic, err)
+			}
+		}
+		s.progress.done(ctx, SetupStepTopic, topicArn)
+		s.checkpoint(ctx, SetupStepTopic, topicArn)
 	}
-	fmt.Printf("✅ SQS queue ready: %s\n", queueInfo.QueueURL)
 
-	// NEW: Create IAM role for EventBridge to send messages to SQS
-	fmt.Println("Step 9: Creating/checking IAM role for EventBridge...")
-	eventBridgeRoleArn, err := s.createEventBridgeIAMRole(ctx, &customerCfg, customerAccountID, queueInfo.QueueArn)
-	if err != nil {
-		return fmt.Errorf("failed to create EventBridge IAM role: %w", err)
+	// The queue and its poller are only needed when CloudLoom analyzes the account's events
+	var queueInfo *QueueInfo
+	var queueArn, eventBridgeRoleArn string
+	if tier.Analyzes() {
+		// Create SQS Queue for Auto Apply Fix (reuses existing if found)
+		fmt.Println("Step 8: Creating/checking SQS queue for Auto Apply Fix...")
+		if queueURL, resumed := s.resume(ctx, SetupStepQueue); resumed {
+			queueArn := fmt.Sprintf("arn:aws:sqs:%s:%s:%s", customerRegion, customerAccountID, queueName)
+			queueInfo = &QueueInfo{
+				AccountID:          customerAccountID,
+				QueueURL:           queueURL,
+				QueueArn:           queueArn,
+				DeadLetterQueueURL: deadLetterQueueURL(queueURL),
+				DeadLetterQueueArn: deadLetterQueueName(queueArn),
+			}
+		} else {
+			queueInfo, err = s.createSQSQueue(ctx, customerCfg, queueName, customerAccountID)
+			if err != nil {
+				fmt.Printf("❌ Failed to create SQS queue: %v\n", err)
+				return s.progress.fail(ctx, SetupStepQueue, fmt.Errorf("failed to create SQS queue: %w", err))
+			}
+			fmt.Printf("✅ SQS queue ready: %s\n", queueInfo.QueueURL)
+			s.tagManaged(ctx, customerCfg, queueInfo.QueueArn, queueInfo.DeadLetterQueueArn)
+			s.progress.done(ctx, SetupStepQueue, queueInfo.QueueURL)
+			s.checkpoint(ctx, SetupStepQueue, queueInfo.QueueURL)
+		}
+		queueArn = queueInfo.QueueArn
+
+		// NEW: Create IAM role for EventBridge to send messages to SQS
+		fmt.Println("Step 9: Creating/checking IAM role for EventBridge...")
+		eventBridgeRoleArn, resumed = s.resume(ctx, SetupStepEventBridgeRole)
+		if !resumed {
+			eventBridgeRoleArn, err = s.createEventBridgeIAMRole(ctx, &customerCfg, customerAccountID, queueInfo.QueueArn)
+			if err != nil {
+				return s.progress.fail(ctx, SetupStepEventBridgeRole, fmt.Errorf("failed to create EventBridge IAM role: %w", err))
+			}
+			fmt.Printf("✅ EventBridge IAM role created: %s\n", eventBridgeRoleArn)
+			s.progress.done(ctx, SetupStepEventBridgeRole, eventBridgeRoleArn)
+			s.checkpoint(ctx, SetupStepEventBridgeRole, eventBridgeRoleArn)
+		}
+	} else {
+		fmt.Printf("Steps 8-9: Skipped, the %s tier does not analyze events\n", tier)
+		s.progress.skip(ctx, SetupStepQueue, "not needed by "+string(tier))
+		s.progress.skip(ctx, SetupStepEventBridgeRole, "not needed by "+string(tier))
 	}
-	fmt.Printf("✅ EventBridge IAM role created: %s\n", eventBridgeRoleArn)
 
-	regionsToMonitor := []string{"ap-south-1", "us-east-1"} // Add other regions as needed
 	fmt.Printf("Step 10: Creating EventBridge rules in regions: %v\n", regionsToMonitor)
 
 	var ruleArns []string
-	for _, region := range regionsToMonitor {
-		fmt.Printf("--- Processing region: %s ---\n", region)
-
-		// Create a new AWS config targeting the specific region for the API call
-		regionalCfg := customerCfg
-		regionalCfg.Region = region
-
-		// The rule name can be the same across different regions
-		ruleName := fmt.Sprintf("CloudLoom-AutoApplyFix-Rule-%s", customerAccountID)
-
-		// Create the rule, pointing it to the central SQS queue in ap-south-1
-		ruleArn, err := s.createEventBridgeRule(ctx, regionalCfg, ruleName, queueInfo.QueueArn, eventBridgeRoleArn)
-		if err != nil {
-			return fmt.Errorf("❌ failed to create EventBridge rule in region %s: %w", region, err)
+	if arns, resumed := s.resume(ctx, SetupStepEventBridgeRules); resumed {
+		ruleArns = strings.Split(arns, ",")
+	} else {
+		for _, region := range regionsToMonitor {
+			fmt.Printf("--- Processing region: %s ---\n", region)
+
+			// Create a new AWS config targeting the specific region for the API call
+			regionalCfg := customerCfg
+			regionalCfg.Region = region
+
+			// The rule name is the same in every region unless an earlier rule was found by tag
+			ruleName := names.rules[region]
+
+			// Create the rule, pointing it to the topic and central SQS queue in the home region
+			ruleArn, err := s.createEventBridgeRule(ctx, regionalCfg, ruleName, topicArn, queueArn, eventBridgeRoleArn)
+			if err != nil {
+				return s.progress.fail(ctx, SetupStepEventBridgeRules, fmt.Errorf("❌ failed to create EventBridge rule in region %s: %w", region, err))
+			}
+			s.tagManaged(ctx, regionalCfg, ruleArn)
+			ruleArns = append(ruleArns, ruleArn)
 		}
-		ruleArns = append(ruleArns, ruleArn)
+		fmt.Printf("✅ EventBridge rules created successfully.\n")
+		s.progress.done(ctx, SetupStepEventBridgeRules, strings.Join(regionsToMonitor, ", "))
+		s.checkpoint(ctx, SetupStepEventBridgeRules, strings.Join(ruleArns, ","))
 	}
-	fmt.Printf("✅ EventBridge rules created successfully.\n")
 
-	// UPDATED: Pass all the collected rule ARNs to the SQS policy function.
-	fmt.Println("Step 11: Setting SQS queue policy to allow all rules...")
-	err = s.setSQSQueuePolicy(ctx, customerCfg, queueInfo.QueueURL, queueInfo.QueueArn, ruleArns)
-	if err != nil {
-		return fmt.Errorf("❌ Failed to set SQS queue policy: %w", err)
+	// GuardDuty findings only reach the rules, and the queue, from regions with a detector
+	if queueInfo != nil {
+		fmt.Println("Step 10a: Ensuring GuardDuty detectors...")
+		if _, resumed := s.resume(ctx, SetupStepGuardDuty); !resumed {
+			detectorIDs, err := s.ensureGuardDutyDetectors(ctx, customerCfg, regionsToMonitor)
+			if err != nil {
+				return s.progress.fail(ctx, SetupStepGuardDuty, fmt.Errorf("❌ failed to ensure GuardDuty detector in region %w", err))
+			}
+			fmt.Printf("✅ GuardDuty detectors ready: %v\n", detectorIDs)
+			s.progress.done(ctx, SetupStepGuardDuty, strings.Join(detectorIDs, ", "))
+			s.checkpoint(ctx, SetupStepGuardDuty, strings.Join(detectorIDs, ","))
+		}
+	} else {
+		s.progress.skip(ctx, SetupStepGuardDuty, "not needed by "+string(tier))
 	}
-	fmt.Println("✅ SQS queue policy set successfully")
 
-	// Start SQS polling goroutine with EventBridge connection check
-	fmt.Println("Step 12: Starting SQS polling goroutine...")
-	go s.startSQSPollingWithEventBridgeCheck(context.Background(), customerCfg, queueInfo.QueueURL, queueInfo.QueueArn, customerAccountID)
-	fmt.Println("✅ SQS polling goroutine started")
+	if queueInfo != nil {
+		// UPDATED: Pass all the collected rule ARNs to the SQS policy function.
+		fmt.Println("Step 11: Setting SQS queue policy to allow all rules...")
+		if _, resumed := s.resume(ctx, SetupStepQueuePolicy); !resumed {
+			err = s.setSQSQueuePolicy(ctx, customerCfg, queueInfo.QueueURL, queueInfo.QueueArn, ruleArns)
+			if err != nil {
+				return s.progress.fail(ctx, SetupStepQueuePolicy, fmt.Errorf("❌ Failed to set SQS queue policy: %w", err))
+			}
+			fmt.Println("✅ SQS queue policy set successfully")
+			s.progress.done(ctx, SetupStepQueuePolicy, "")
+			s.checkpoint(ctx, SetupStepQueuePolicy, "")
+		}
 
-	fmt.Printf("Step 13: Queue information for reference:\n")
-	fmt.Printf("  - Account ID: %s\n", queueInfo.AccountID)
-	fmt.Printf("  - Queue URL: %s\n", queueInfo.QueueURL)
-	fmt.Printf("  - Queue ARN: %s\n", queueInfo.QueueArn)
-	fmt.Printf("  - Rule ARN: %s\n", queueInfo.RuleArn)
+		// Start SQS polling goroutine with EventBridge connection check
+		fmt.Println("Step 12: Starting SQS polling goroutine...")
+		if err := s.startPolling(customerCfg, queueInfo.QueueURL, queueInfo.QueueArn, customerAccountID); err != nil {
+			return s.progress.fail(ctx, SetupStepPolling, err)
+		}
+		fmt.Println("✅ SQS polling goroutine started")
+		s.progress.done(ctx, SetupStepPolling, "")
+
+		fmt.Printf("Step 13: Queue information for reference:\n")
+		fmt.Printf("  - Account ID: %s\n", queueInfo.AccountID)
+		fmt.Printf("  - Queue URL: %s\n", queueInfo.QueueURL)
+		fmt.Printf("  - Queue ARN: %s\n", queueInfo.QueueArn)
+		fmt.Printf("  - Dead-letter queue URL: %s\n", queueInfo.DeadLetterQueueURL)
+		fmt.Printf("  - Rule ARN: %s\n", queueInfo.RuleArn)
+	} else {
+		// A tenant moved down from an analyzing tier keeps no poller on its old queue
+		stopPolling(customerAccountID)
+		s.progress.skip(ctx, SetupStepQueuePolicy, "not needed by "+string(tier))
+		s.progress.skip(ctx, SetupStepPolling, "not needed by "+string(tier))
+	}
 
 	// // Step 14: Collect infrastructure inventory
 	// fmt.Println("Step 14: Collecting infrastructure inventory...")
@@ -173,10 +555,11 @@ func (s *CloudTrailService) SetupCloudTrail(ctx context.Context) error {
 	// 	fmt.Println("✅ Infrastructure inventory collected successfully")
 	// }
 
-	fmt.Println("🎉 CloudTrail and Auto Apply Fix setup completed successfully!")
+	fmt.Printf("🎉 CloudTrail setup for the %s tier completed successfully!\n", tier)
 
 	fmt.Println("Step 15: Configuring Steampipe connection...")
-	steampipe.ConfigureSteampipe("cloudloom_user", common.ARNNumber, common.ExternalID, "cloud-burner")
+	steampipe.ConfigureSteampipe("cloudloom_user", s.roleArn(), s.externalID(), "cloud-burner", customerRegion)
+	s.progress.done(ctx, SetupStepSteampipe, "")
 	return nil
 }
 
@@ -239,10 +622,23 @@ func (s *CloudTrailService) SendTestMessage(ctx context.Context) error {
         }
     }`, customerAccountID, customerAccountID, customerAccountID)
 
-	err = s.sendTestMessage(ctx, customerCfg, queueURL, testMessage)
-	if err != nil {
-		fmt.Printf("❌ Failed to send test message: %v\n", err)
-		return err
+	// Route through the overflow buffer so the message survives a transient SQS outage
+	if buf := buffer.Default(); buf != nil {
+		buffered, err := buf.Deliver(ctx, SQSDeliverySink, queueURL, customerAccountID, []byte(testMessage))
+		if err != nil {
+			fmt.Printf("❌ Failed to send test message: %v\n", err)
+			return err
+		}
+		if buffered {
+			fmt.Println("⏳ SQS unavailable, test message buffered and will be delivered when the queue recovers")
+			return nil
+		}
+	} else {
+		err = s.sendTestMessage(ctx, customerCfg, queueURL, testMessage)
+		if err != nil {
+			fmt.Printf("❌ Failed to send test message: %v\n", err)
+			return err
+		}
 	}
 
 	fmt.Println("🎉 Test message sent successfully! Check the polling logs for message reception.")
@@ -260,6 +656,7 @@ func (s *CloudTrailService) enableAWSConfig(ctx context.Context, cfg aws.Config,
 	err := configService.CheckConfigStatus(ctx)
 	if err == nil {
 		fmt.Println("[AWS Config] ✅ AWS Config is already enabled")
+		s.ensureConfigAggregator(ctx, cfg, accountID)
 		return nil
 	}
 
@@ -268,7 +665,7 @@ func (s *CloudTrailService) enableAWSConfig(ctx context.Context, cfg aws.Config,
 
 	// Step 2: Create IAM Service Role for AWS Config
 	fmt.Println("[AWS Config] Creating IAM service role for AWS Config...")
-	configRoleArn, err := s.createConfigServiceRole(ctx, cfg, accountID)
+	configRoleArn, err := s.createConfigServiceRole(ctx, cfg, bucketName, accountID)
 	if err != nil {
 		return fmt.Errorf("failed to create Config service role: %w", err)
 	}
@@ -287,7 +684,7 @@ func (s *CloudTrailService) enableAWSConfig(ctx context.Context, cfg aws.Config,
 	// Step 3: Create Configuration Recorder
 	fmt.Println("[AWS Config] Creating configuration recorder...")
 	recorderName := fmt.Sprintf("CloudLoom-Config-Recorder-%s", accountID)
-	err = s.createConfigurationRecorder(ctx, cfg, recorderName, configRoleArn)
+	err = s.createConfigurationRecorder(ctx, cfg, recorderName, configRoleArn, accountID)
 	if err != nil {
 		return fmt.Errorf("failed to create configuration recorder: %w", err)
 	}
@@ -320,6 +717,9 @@ func (s *CloudTrailService) enableAWSConfig(ctx context.Context, cfg aws.Config,
 		fmt.Println("[AWS Config] ✅ Basic Config rules created")
 	}
 
+	// Step 7: Aggregate every region, and the organization's accounts, into one query path
+	s.ensureConfigAggregator(ctx, cfg, accountID)
+
 	fmt.Println("[AWS Config] ✅ AWS Config setup completed successfully")
 	fmt.Println("[AWS Config] Note: It may take a few minutes for Config to start recording resources")
 	return nil
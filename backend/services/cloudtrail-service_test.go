@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+func TestUsesDefaultRole(t *testing.T) {
+	legacy := tenants.AccountFromRoleARN(common.ARNNumber)
+	tests := []struct {
+		name     string
+		tenantID string
+		err      error
+		want     bool
+	}{
+		{"legacy tenant never onboarded", legacy, tenants.ErrNotFound, true},
+		{"legacy tenant, wrapped not found", legacy, fmt.Errorf("failed to load tenant: %w", tenants.ErrNotFound), true},
+		{"legacy tenant onboarded", legacy, nil, false},
+		{"legacy tenant lookup failed", legacy, errors.New("connection refused"), false},
+		{"other tenant not found", "111122223333", tenants.ErrNotFound, false},
+		{"other tenant onboarded", "111122223333", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usesDefaultRole(tt.tenantID, tt.err); got != tt.want {
+				t.Errorf("usesDefaultRole(%q, %v) = %v, want %v", tt.tenantID, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudTrailServiceForWithoutTenantManager(t *testing.T) {
+	if tenants.Default() != nil {
+		t.Skip("tenant manager is initialized")
+	}
+	for _, tenantID := range []string{"", "111122223333"} {
+		s, err := cloudTrailServiceFor(context.Background(), tenantID)
+		if err != nil {
+			t.Fatalf("cloudTrailServiceFor(%q) error = %v", tenantID, err)
+		}
+		if got := s.roleArn(); got != common.ARNNumber {
+			t.Errorf("cloudTrailServiceFor(%q) role = %s, want the default role", tenantID, got)
+		}
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cttypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/rishichirchi/cloudloom/services/tenants"
 )
 
-func (s *CloudTrailService) createCloudTrailIAMRole(ctx context.Context, cfg *aws.Config, accountID string) (*string, error) {
+// createCloudTrailIAMRole creates the role CloudTrail delivers events to the log group with, or
+// updates the existing one, allowing it to write to that log group only
+func (s *CloudTrailService) createCloudTrailIAMRole(ctx context.Context, cfg *aws.Config, accountID, logGroupArn string) (*string, error) {
 	iamClient := iam.NewFromConfig(*cfg)
 	roleName := fmt.Sprintf("CloudLoom-CloudTrail-Role-%s", accountID)
 	fmt.Printf("[IAM] Setting up role '%s'\n", roleName)
@@ -52,51 +55,56 @@ func (s *CloudTrailService) createCloudTrailIAMRole(ctx context.Context, cfg *aw
 		fmt.Printf("[IAM] ✅ Role created successfully: %s\n", *createRoleOutput.Role.Arn)
 		roleArn = createRoleOutput.Role.Arn
 	}
+	s.tagRole(ctx, iamClient, roleName)
 
-	// Check if the policy is already attached (this can be done regardless of whether role was created or existed)
-	policyArn := "arn:aws:iam::aws:policy/CloudWatchLogsFullAccess"
-	fmt.Printf("[IAM] Checking if policy is already attached...\n")
-	listPoliciesOutput, err := iamClient.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{
-		RoleName: aws.String(roleName),
+	// Allow writing only to the trail's log group, instead of the CloudWatchLogsFullAccess
+	// policy earlier setups attached
+	streamArn := strings.TrimSuffix(logGroupArn, ":*") + ":log-stream:*"
+	policyDocument := fmt.Sprintf(`{
+        "Version": "2012-10-17",
+        "Statement": [{
+            "Effect": "Allow",
+            "Action": ["logs:CreateLogStream", "logs:PutLogEvents"],
+            "Resource": "%s"
+        }]
+    }`, streamArn)
+	fmt.Printf("[IAM] Putting log group policy on role...\n")
+	_, err = iamClient.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(fmt.Sprintf("CloudLoom-CloudTrail-LogsPolicy-%s", accountID)),
+		PolicyDocument: aws.String(policyDocument),
 	})
-
-	var policyAttached bool
-	if err == nil {
-		for _, policy := range listPoliciesOutput.AttachedPolicies {
-			if policy.PolicyArn != nil && *policy.PolicyArn == policyArn {
-				policyAttached = true
-				fmt.Printf("[IAM] ✅ Policy already attached\n")
-				break
-			}
-		}
+	if err != nil {
+		fmt.Printf("[IAM] ❌ Failed to put role policy: %v\n", err)
+		return nil, err
 	}
+	if err := detachManagedPolicies(ctx, iamClient, roleName); err != nil {
+		return nil, err
+	}
+	fmt.Printf("[IAM] ✅ Role policy scoped to %s\n", streamArn)
 
-	// Attach the policy only if it's not already attached
-	if !policyAttached {
-		fmt.Printf("[IAM] Attaching policy '%s' to role...\n", policyArn)
-		_, err = iamClient.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
-			RoleName:  aws.String(roleName),
-			PolicyArn: aws.String(policyArn),
-		})
-		if err != nil {
-			fmt.Printf("[IAM] ❌ Failed to attach policy: %v\n", err)
-			return nil, err
-		}
-		fmt.Printf("[IAM] ✅ Policy attached successfully\n")
-
-		// Give some time for the role to become available (propagation delay) only for new attachments
-		fmt.Printf("[IAM] Waiting 10 seconds for role propagation...\n")
-		time.Sleep(10 * time.Second)
-		fmt.Printf("[IAM] ✅ Role propagation complete\n")
+	// Wait for the policy to propagate
+	fmt.Printf("[IAM] Waiting for role propagation...\n")
+	if err := waitForRole(ctx, iamClient, roleName, "logs:PutLogEvents", streamArn); err != nil {
+		return nil, err
 	}
+	fmt.Printf("[IAM] ✅ Role propagation complete\n")
 
 	return roleArn, nil
 }
 
-func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, cfg *aws.Config, trailName, bucketName, logGroupArn, cloudTrailRoleArn string) error {
+// createOrUpdateCloudTrailTrail creates or updates the multi-region trail, sets the events it
+// records and starts logging. With a KMS key, log files are encrypted with it.
+func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, cfg *aws.Config, trailName, bucketName, logGroupArn, cloudTrailRoleArn, kmsKeyArn string, events tenants.TrailEvents) error {
 	cloudTrailClient := cloudtrail.NewFromConfig(*cfg)
 	fmt.Printf("[CloudTrail] Setting up trail '%s'\n", trailName)
 
+	// Leaving KmsKeyId unset keeps whatever encryption the trail already has
+	var kmsKeyID *string
+	if kmsKeyArn != "" {
+		kmsKeyID = aws.String(kmsKeyArn)
+	}
+
 	// First, check if the trail already exists
 	fmt.Printf("[CloudTrail] Checking if trail already exists...\n")
 	describeOutput, err := cloudTrailClient.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{
@@ -119,6 +127,8 @@ func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, c
 			CloudWatchLogsRoleArn:      aws.String(cloudTrailRoleArn),
 			IsMultiRegionTrail:         aws.Bool(true),
 			IncludeGlobalServiceEvents: aws.Bool(true),
+			EnableLogFileValidation:    aws.Bool(true),
+			KmsKeyId:                   kmsKeyID,
 		})
 		if err != nil {
 			fmt.Printf("[CloudTrail] ❌ Failed to update trail: %v\n", err)
@@ -135,6 +145,8 @@ func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, c
 			CloudWatchLogsRoleArn:      aws.String(cloudTrailRoleArn),
 			IsMultiRegionTrail:         aws.Bool(true),
 			IncludeGlobalServiceEvents: aws.Bool(true),
+			EnableLogFileValidation:    aws.Bool(true),
+			KmsKeyId:                   kmsKeyID,
 		})
 		if err != nil {
 			// Check if the error is because the trail already exists
@@ -148,6 +160,8 @@ func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, c
 					CloudWatchLogsRoleArn:      aws.String(cloudTrailRoleArn),
 					IsMultiRegionTrail:         aws.Bool(true),
 					IncludeGlobalServiceEvents: aws.Bool(true),
+					EnableLogFileValidation:    aws.Bool(true),
+					KmsKeyId:                   kmsKeyID,
 				})
 				if updateErr != nil {
 					fmt.Printf("[CloudTrail] ❌ Failed to update existing trail: %v\n", updateErr)
@@ -169,6 +183,14 @@ func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, c
 	fmt.Printf("  - Role ARN: %s\n", cloudTrailRoleArn)
 	fmt.Printf("  - Multi-Region: true\n")
 	fmt.Printf("  - Global Service Events: true\n")
+	fmt.Printf("  - Log File Validation: true\n")
+	if kmsKeyArn != "" {
+		fmt.Printf("  - KMS Key: %s\n", kmsKeyArn)
+	}
+
+	if err := setTrailSelectors(ctx, cloudTrailClient, trailName, bucketName, events); err != nil {
+		return err
+	}
 
 	// IMPORTANT: Start logging for the trail
 	fmt.Printf("[CloudTrail] Starting logging for trail...\n")
@@ -183,3 +205,72 @@ func (s *CloudTrailService) createOrUpdateCloudTrailTrail(ctx context.Context, c
 
 	return nil
 }
+
+// trailEventSelectors returns the advanced event selectors for management events and the
+// requested data events. S3 data events exclude the log bucket, whose writes would otherwise
+// be logged in turn.
+func trailEventSelectors(bucketName string, events tenants.TrailEvents) []cttypes.AdvancedEventSelector {
+	selectors := []cttypes.AdvancedEventSelector{{
+		Name: aws.String("Management events"),
+		FieldSelectors: []cttypes.AdvancedFieldSelector{
+			{Field: aws.String("eventCategory"), Equals: []string{"Management"}},
+		},
+	}}
+	if events.S3DataEvents {
+		selectors = append(selectors, cttypes.AdvancedEventSelector{
+			Name: aws.String("S3 data events"),
+			FieldSelectors: []cttypes.AdvancedFieldSelector{
+				{Field: aws.String("eventCategory"), Equals: []string{"Data"}},
+				{Field: aws.String("resources.type"), Equals: []string{"AWS::S3::Object"}},
+				{Field: aws.String("resources.ARN"), NotStartsWith: []string{fmt.Sprintf("arn:aws:s3:::%s/", bucketName)}},
+			},
+		})
+	}
+	if events.LambdaDataEvents {
+		selectors = append(selectors, cttypes.AdvancedEventSelector{
+			Name: aws.String("Lambda data events"),
+			FieldSelectors: []cttypes.AdvancedFieldSelector{
+				{Field: aws.String("eventCategory"), Equals: []string{"Data"}},
+				{Field: aws.String("resources.type"), Equals: []string{"AWS::Lambda::Function"}},
+			},
+		})
+	}
+	return selectors
+}
+
+// trailInsightSelectors returns the Insights types to enable, none unless Insights is requested
+func trailInsightSelectors(events tenants.TrailEvents) []cttypes.InsightSelector {
+	if !events.Insights {
+		return []cttypes.InsightSelector{}
+	}
+	return []cttypes.InsightSelector{
+		{InsightType: cttypes.InsightTypeApiCallRateInsight},
+		{InsightType: cttypes.InsightTypeApiErrorRateInsight},
+	}
+}
+
+// setTrailSelectors sets the trail's event and Insights selectors. Both are always set, so
+// turning an option off in a later setup stops recording those events.
+func setTrailSelectors(ctx context.Context, client *cloudtrail.Client, trailName, bucketName string, events tenants.TrailEvents) error {
+	fmt.Printf("[CloudTrail] Setting event selectors (S3 data events: %t, Lambda data events: %t)...\n", events.S3DataEvents, events.LambdaDataEvents)
+	_, err := client.PutEventSelectors(ctx, &cloudtrail.PutEventSelectorsInput{
+		TrailName:              aws.String(trailName),
+		AdvancedEventSelectors: trailEventSelectors(bucketName, events),
+	})
+	if err != nil {
+		fmt.Printf("[CloudTrail] ❌ Failed to set event selectors: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("[CloudTrail] Setting Insights selectors (enabled: %t)...\n", events.Insights)
+	_, err = client.PutInsightSelectors(ctx, &cloudtrail.PutInsightSelectorsInput{
+		TrailName:        aws.String(trailName),
+		InsightSelectors: trailInsightSelectors(events),
+	})
+	if err != nil {
+		fmt.Printf("[CloudTrail] ❌ Failed to set Insights selectors: %v\n", err)
+		return err
+	}
+	fmt.Printf("[CloudTrail] ✅ Event selectors set\n")
+	return nil
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// Trend lengths of a compliance summary, in snapshots
+const (
+	defaultComplianceTrendPoints = 30
+	maxComplianceTrendPoints     = 100
+)
+
+// complianceRuleFields are the fields of each rule a trend point reads. Scan results are
+// stored with lowercased keys.
+var complianceRuleFields = []string{
+	"configrulename",
+	"evaluationresults.resourceid",
+	"evaluationresults.resourcetype",
+	"evaluationresults.compliancetype",
+}
+
+// ComplianceScore counts compliant and non-compliant results. Score is the compliant
+// percentage, or null when nothing was evaluated either way.
+type ComplianceScore struct {
+	Compliant    int      `json:"compliant"`
+	NonCompliant int      `json:"nonCompliant"`
+	Score        *float64 `json:"score"`
+}
+
+func (s *ComplianceScore) add(complianceType string) {
+	switch complianceType {
+	case ComplianceCompliant:
+		s.Compliant++
+	case ComplianceNonCompliant:
+		s.NonCompliant++
+	}
+}
+
+// finish sets the score from the counts, rounded to one decimal
+func (s *ComplianceScore) finish() {
+	if evaluated := s.Compliant + s.NonCompliant; evaluated > 0 {
+		score := math.Round(float64(s.Compliant)*1000/float64(evaluated)) / 10
+		s.Score = &score
+	}
+}
+
+// RuleCompliance is the score of one rule across the resources it evaluated
+type RuleCompliance struct {
+	ConfigRuleName string `json:"configRuleName"`
+	Source         string `json:"source,omitempty"`
+	ComplianceScore
+}
+
+// ResourceTypeCompliance is the score of the resources of one type; a resource counts as
+// non-compliant if any rule found it non-compliant
+type ResourceTypeCompliance struct {
+	ResourceType string `json:"resourceType"`
+	ComplianceScore
+}
+
+// ComplianceTrendPoint is the overall score of one earlier snapshot
+type ComplianceTrendPoint struct {
+	SnapshotID string    `json:"snapshotId"`
+	At         time.Time `json:"at"`
+	ComplianceScore
+}
+
+// ComplianceSummary is the compliance of a snapshot per rule, per resource type and overall,
+// with the overall score of the snapshots before it, oldest first
+type ComplianceSummary struct {
+	Snapshot InventorySnapshot `json:"snapshot"`
+	// Overall scores resources, like ResourceTypes
+	Overall       ComplianceScore          `json:"overall"`
+	Rules         []RuleCompliance         `json:"rules"`
+	ResourceTypes []ResourceTypeCompliance `json:"resourceTypes"`
+	Trend         []ComplianceTrendPoint   `json:"trend"`
+}
+
+// resourceCompliance returns the compliance of each evaluated resource, by type/ID: non-compliant
+// with any rule, compliant if evaluated and never non-compliant
+func resourceCompliance(rules []ComplianceRule) map[string]string {
+	status := map[string]string{}
+	for _, rule := range rules {
+		for _, eval := range rule.EvaluationResults {
+			key := eval.ResourceType + "/" + eval.ResourceID
+			switch {
+			case eval.ComplianceType == ComplianceNonCompliant:
+				status[key] = ComplianceNonCompliant
+			case eval.ComplianceType == ComplianceCompliant && status[key] == "":
+				status[key] = ComplianceCompliant
+			}
+		}
+	}
+	return status
+}
+
+// overallCompliance scores the evaluated resources of a set of rules
+func overallCompliance(rules []ComplianceRule) ComplianceScore {
+	var overall ComplianceScore
+	for _, status := range resourceCompliance(rules) {
+		overall.add(status)
+	}
+	overall.finish()
+	return overall
+}
+
+// SummarizeCompliance scores the tenant's snapshot snapshotID, or its latest snapshot if that
+// is empty, and the up to trendPoints snapshots before it. It returns jobs.ErrNotFound if there
+// is no such snapshot.
+func SummarizeCompliance(ctx context.Context, tenantID, snapshotID string, trendPoints int) (*ComplianceSummary, error) {
+	snapshot, inventory, err := LoadInventory(ctx, tenantID, snapshotID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ComplianceSummary{
+		Snapshot:      *snapshot,
+		Overall:       overallCompliance(inventory.ComplianceRules),
+		Rules:         []RuleCompliance{},
+		ResourceTypes: []ResourceTypeCompliance{},
+	}
+	for _, rule := range inventory.ComplianceRules {
+		ruleScore := RuleCompliance{ConfigRuleName: rule.ConfigRuleName, Source: rule.Source}
+		for _, eval := range rule.EvaluationResults {
+			ruleScore.add(eval.ComplianceType)
+		}
+		ruleScore.finish()
+		summary.Rules = append(summary.Rules, ruleScore)
+	}
+	// Least compliant rules first; unevaluated rules last
+	sort.SliceStable(summary.Rules, func(i, j int) bool {
+		a, b := summary.Rules[i].Score, summary.Rules[j].Score
+		return a != nil && (b == nil || *a < *b)
+	})
+
+	byType := map[string]*ResourceTypeCompliance{}
+	for key, status := range resourceCompliance(inventory.ComplianceRules) {
+		// Resource types never contain a slash, though IDs may
+		resourceType, _, _ := strings.Cut(key, "/")
+		if byType[resourceType] == nil {
+			byType[resourceType] = &ResourceTypeCompliance{ResourceType: resourceType}
+		}
+		byType[resourceType].add(status)
+	}
+	for _, typeScore := range byType {
+		typeScore.finish()
+		summary.ResourceTypes = append(summary.ResourceTypes, *typeScore)
+	}
+	sort.Slice(summary.ResourceTypes, func(i, j int) bool {
+		return summary.ResourceTypes[i].ResourceType < summary.ResourceTypes[j].ResourceType
+	})
+
+	if summary.Trend, err = complianceTrend(ctx, tenantID, snapshot, trendPoints); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// complianceTrend scores the snapshots before snapshot, oldest first, reading only the rule
+// evaluations of each
+func complianceTrend(ctx context.Context, tenantID string, snapshot *InventorySnapshot, points int) ([]ComplianceTrendPoint, error) {
+	if points <= 0 {
+		points = defaultComplianceTrendPoints
+	}
+	points = min(points, maxComplianceTrendPoints)
+
+	earlier, err := jobs.Default().List(ctx, jobs.ListFilter{
+		Type:          JobTypeInventoryScan,
+		TenantID:      tenantID,
+		Status:        jobs.StatusSucceeded,
+		CreatedBefore: snapshot.CreatedAt,
+		Limit:         int64(points),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trend := make([]ComplianceTrendPoint, 0, len(earlier))
+	for i := len(earlier) - 1; i >= 0; i-- {
+		rules, err := snapshotComplianceRules(ctx, earlier[i].ID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		trend = append(trend, ComplianceTrendPoint{
+			SnapshotID:      earlier[i].ID.Hex(),
+			At:              earlier[i].CreatedAt,
+			ComplianceScore: overallCompliance(rules),
+		})
+	}
+	return trend, nil
+}
+
+// snapshotComplianceRules reads the rule evaluations of a snapshot without decoding the rest
+func snapshotComplianceRules(ctx context.Context, id string) ([]ComplianceRule, error) {
+	cursor, err := jobs.Default().ResultItems(ctx, id, "compliancerules", 0, 0, complianceRuleFields)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := []ComplianceRule{}
+	for cursor.Next(ctx) {
+		var rule ComplianceRule
+		if err := cursor.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("failed to decode compliance rule of snapshot %s: %w", id, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, cursor.Err()
+}
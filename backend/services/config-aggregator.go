@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+const (
+	// ConfigAggregatorName is the aggregator setup creates so one query covers every region,
+	// and every account of the organization when the tenant is its management account
+	ConfigAggregatorName = "CloudLoom-Config-Aggregator"
+	// configAggregatorRoleName is the role an organization aggregator reads member accounts with
+	configAggregatorRoleName = "CloudLoom-Config-AggregatorRole"
+	// configOrganizationsPolicy is the AWS managed policy an organization aggregator's role needs
+	configOrganizationsPolicy = "arn:aws:iam::aws:policy/service-role/AWSConfigRoleForOrganizations"
+)
+
+// createConfigAggregator creates or updates the tenant's Config aggregator across all regions.
+// In an organization's management account it aggregates every member account; elsewhere only
+// the account itself.
+func (s *CloudTrailService) createConfigAggregator(ctx context.Context, cfg aws.Config, accountID string) error {
+	fmt.Printf("[AWS Config] Creating configuration aggregator: %s\n", ConfigAggregatorName)
+
+	input := &configservice.PutConfigurationAggregatorInput{
+		ConfigurationAggregatorName: aws.String(ConfigAggregatorName),
+		Tags:                        []types.Tag{{Key: aws.String(TagManaged), Value: aws.String("true")}},
+	}
+	if isOrganizationManagementAccount(ctx, cfg, accountID) {
+		roleArn, err := s.createConfigAggregatorRole(ctx, cfg, accountID)
+		if err != nil {
+			return err
+		}
+		input.OrganizationAggregationSource = &types.OrganizationAggregationSource{
+			RoleArn:       aws.String(roleArn),
+			AllAwsRegions: true,
+		}
+	} else {
+		input.AccountAggregationSources = []types.AccountAggregationSource{{
+			AccountIds:    []string{accountID},
+			AllAwsRegions: true,
+		}}
+	}
+
+	if _, err := configservice.NewFromConfig(cfg).PutConfigurationAggregator(ctx, input); err != nil {
+		return fmt.Errorf("failed to create configuration aggregator: %w", err)
+	}
+	scope := "account"
+	if input.OrganizationAggregationSource != nil {
+		scope = "organization"
+	}
+	fmt.Printf("[AWS Config] Configuration aggregator ready: %s (%s, all regions)\n", ConfigAggregatorName, scope)
+	return nil
+}
+
+// ensureConfigAggregator creates the aggregator without failing setup, since inventory scans
+// fall back to querying the home region when it is missing
+func (s *CloudTrailService) ensureConfigAggregator(ctx context.Context, cfg aws.Config, accountID string) {
+	if err := s.createConfigAggregator(ctx, cfg, accountID); err != nil {
+		fmt.Printf("[AWS Config] Warning: Failed to create configuration aggregator: %v\n", err)
+		return
+	}
+	fmt.Println("[AWS Config] ✅ Configuration aggregator created")
+}
+
+// isOrganizationManagementAccount reports whether the account manages an AWS organization.
+// Accounts outside an organization, or that may not describe it, are treated as standalone.
+func isOrganizationManagementAccount(ctx context.Context, cfg aws.Config, accountID string) bool {
+	out, err := organizations.NewFromConfig(cfg).DescribeOrganization(ctx, &organizations.DescribeOrganizationInput{})
+	if err != nil {
+		log.Printf("[AWS Config] Not aggregating an organization: %v", err)
+		return false
+	}
+	return out.Organization != nil && aws.ToString(out.Organization.MasterAccountId) == accountID
+}
+
+// createConfigAggregatorRole creates the role an organization aggregator assumes, or updates
+// the existing one
+func (s *CloudTrailService) createConfigAggregatorRole(ctx context.Context, cfg aws.Config, accountID string) (string, error) {
+	iamClient := iam.NewFromConfig(cfg)
+	roleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, configAggregatorRoleName)
+
+	if _, err := iamClient.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(configAggregatorRoleName)}); err != nil {
+		trustPolicy := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Principal": {"Service": "config.amazonaws.com"},
+				"Action": "sts:AssumeRole"
+			}
+		]
+	}`
+		_, err = iamClient.CreateRole(ctx, &iam.CreateRoleInput{
+			RoleName:                 aws.String(configAggregatorRoleName),
+			AssumeRolePolicyDocument: aws.String(trustPolicy),
+			Description:              aws.String("CloudLoom AWS Config organization aggregator role"),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create Config aggregator role: %w", err)
+		}
+	}
+	s.tagRole(ctx, iamClient, configAggregatorRoleName)
+
+	_, err := iamClient.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+		RoleName:  aws.String(configAggregatorRoleName),
+		PolicyArn: aws.String(configOrganizationsPolicy),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to attach Config aggregator policy: %w", err)
+	}
+	return roleArn, nil
+}
+
+// useAggregator switches the service to query the CloudLoom aggregator when it exists and at
+// least one of its sources has been collected, so a new aggregator does not hide resources
+// the account's own Config already reports
+func (cs *ConfigService) useAggregator(ctx context.Context) bool {
+	out, err := cs.client.DescribeConfigurationAggregatorSourcesStatus(ctx, &configservice.DescribeConfigurationAggregatorSourcesStatusInput{
+		ConfigurationAggregatorName: aws.String(ConfigAggregatorName),
+	})
+	var notFound *types.NoSuchConfigurationAggregatorException
+	if errors.As(err, &notFound) {
+		return false
+	}
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to check configuration aggregator: %v", err)
+		return false
+	}
+
+	for _, source := range out.AggregatedSourceStatusList {
+		if source.LastUpdateStatus == types.AggregatedSourceStatusTypeSucceeded {
+			cs.aggregator = ConfigAggregatorName
+			log.Printf("[ConfigService] Querying configuration aggregator %s", ConfigAggregatorName)
+			return true
+		}
+	}
+	log.Printf("[ConfigService] Configuration aggregator %s has not collected any source yet", ConfigAggregatorName)
+	return false
+}
+
+// selectResources runs a Config SQL query through the aggregator when the service uses one,
+// else against the account's own region, and decodes every result row
+func (cs *ConfigService) selectResources(ctx context.Context, expression string) ([]ConfigurationItem, error) {
+	var results []string
+	if cs.aggregator != "" {
+		paginator := configservice.NewSelectAggregateResourceConfigPaginator(cs.client, &configservice.SelectAggregateResourceConfigInput{
+			ConfigurationAggregatorName: aws.String(cs.aggregator),
+			Expression:                  aws.String(expression),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get next page of aggregated resource configurations: %w", err)
+			}
+			results = append(results, page.Results...)
+		}
+	} else {
+		paginator := configservice.NewSelectResourceConfigPaginator(cs.client, &configservice.SelectResourceConfigInput{
+			Expression: aws.String(expression),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get next page of resource configurations: %w", err)
+			}
+			results = append(results, page.Results...)
+		}
+	}
+
+	resources := make([]ConfigurationItem, 0, len(results))
+	for _, resultString := range results {
+		var item ConfigurationItem
+		if err := json.Unmarshal([]byte(resultString), &item); err != nil {
+			log.Printf("[ConfigService] Warning: failed to unmarshal resource configuration: %v", err)
+			continue
+		}
+		resources = append(resources, item)
+	}
+	return resources, nil
+}
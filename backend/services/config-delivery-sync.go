@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/resourcehistory"
+)
+
+// InventoryScanModeSync is the inventory scan payload mode that applies the configuration
+// items AWS Config delivered to S3 since the latest snapshot, instead of querying every resource
+const InventoryScanModeSync = "sync"
+
+// maxSyncAge is how far behind the latest snapshot may be for a sync. Older snapshots are
+// replaced by a full scan, which is cheaper than reading that many days of delivery files.
+const maxSyncAge = 7 * 24 * time.Hour
+
+// Configuration item statuses AWS Config records when a resource is deleted
+var deletedItemStatuses = map[string]bool{
+	"ResourceDeleted":            true,
+	"ResourceDeletedNotRecorded": true,
+}
+
+// errSyncUnavailable means there is nothing to sync from, so the account is scanned in full
+var errSyncUnavailable = errors.New("incremental sync unavailable")
+
+// InventorySync is what a sync applied to the latest snapshot
+type InventorySync struct {
+	// BaseSnapshotID is the snapshot the delivered changes were applied to
+	BaseSnapshotID string `json:"baseSnapshotId"`
+	FilesRead      int    `json:"filesRead"`
+	ItemsRead      int    `json:"itemsRead"`
+	Added          int    `json:"added"`
+	Updated        int    `json:"updated"`
+	Removed        int    `json:"removed"`
+	// HistoryRecorded counts the changes that were new to the resource history
+	HistoryRecorded int `json:"historyRecorded"`
+}
+
+// deliveryFile is a configuration history or snapshot file AWS Config delivered to S3
+type deliveryFile struct {
+	ConfigurationItems []json.RawMessage `json:"configurationItems"`
+}
+
+// deliveredItem is a configuration item as written to delivery files, which name the
+// relationship "name" rather than "relationshipName" and the account "awsAccountId"
+type deliveredItem struct {
+	ConfigurationItem
+	AWSAccountID  string `json:"awsAccountId"`
+	Relationships []struct {
+		ResourceType string `json:"resourceType"`
+		ResourceID   string `json:"resourceId"`
+		ResourceName string `json:"resourceName"`
+		Name         string `json:"name"`
+	} `json:"relationships"`
+}
+
+// syncInventory brings the tenant's latest snapshot up to date from the configuration history
+// and snapshot files AWS Config delivered since, recording each changed resource in its
+// history. Compliance, policies and the other audits are carried over from the snapshot. The
+// account is scanned in full when there is no recent snapshot or no delivery channel.
+func syncInventory(ctx context.Context, tenantID string, now time.Time) (*ResourceInventory, error) {
+	if DemoModeEnabled() {
+		return DemoInventory(tenantID, now), nil
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	inventory, err := syncFromDelivery(ctx, customerCfg, tenantID, now)
+	if errors.Is(err, errSyncUnavailable) {
+		log.Printf("[InventorySync] %v, scanning tenant %s in full", err, tenantID)
+		inventory, err = NewConfigService(customerCfg).GetComprehensiveResourceInventory(ctx, customerCfg)
+		if err != nil {
+			return nil, fmt.Errorf("inventory scan failed: %w", err)
+		}
+		return inventory, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inventory sync failed: %w", err)
+	}
+	return inventory, nil
+}
+
+func syncFromDelivery(ctx context.Context, cfg aws.Config, tenantID string, now time.Time) (*ResourceInventory, error) {
+	var inventory ResourceInventory
+	base, err := jobs.Default().LatestResult(ctx, JobTypeInventoryScan, tenantID, &inventory)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, fmt.Errorf("%w: no snapshot to apply changes to", errSyncUnavailable)
+	}
+	if err != nil {
+		return nil, err
+	}
+	since := inventory.LastUpdated
+	if inventory.SyncedThrough != nil {
+		since = *inventory.SyncedThrough
+	}
+	if now.Sub(since) > maxSyncAge {
+		return nil, fmt.Errorf("%w: latest snapshot is from %s", errSyncUnavailable, since.Format(time.RFC3339))
+	}
+
+	channels, err := configservice.NewFromConfig(cfg).DescribeDeliveryChannels(ctx, &configservice.DescribeDeliveryChannelsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe delivery channels: %w", err)
+	}
+	if len(channels.DeliveryChannels) == 0 {
+		return nil, fmt.Errorf("%w: AWS Config has no delivery channel", errSyncUnavailable)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := channels.DeliveryChannels[0]
+	reader := &deliveryReader{
+		s3:     s3.NewFromConfig(cfg),
+		pool:   newWorkerPool(inventoryConcurrencyFromEnv()),
+		bucket: aws.ToString(channel.S3BucketName),
+		prefix: path.Join(aws.ToString(channel.S3KeyPrefix), "AWSLogs", accountID, "Config") + "/",
+	}
+	keys, syncedThrough, err := reader.listSince(ctx, since, now)
+	if err != nil {
+		return nil, err
+	}
+	items, err := reader.read(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &InventorySync{BaseSnapshotID: base.ID.Hex(), FilesRead: len(keys), ItemsRead: len(items)}
+	changed := applyDeliveredItems(&inventory, items, stats)
+	if stats.HistoryRecorded, err = recordResourceHistory(ctx, tenantID, changed); err != nil {
+		log.Printf("[InventorySync] Warning: %v", err)
+	}
+
+	if syncedThrough.After(since) {
+		inventory.SyncedThrough = &syncedThrough
+	} else {
+		inventory.SyncedThrough = &since
+	}
+	inventory.Sync = stats
+	inventory.LastUpdated = now
+	inventory.ResourceSummary = (&ConfigService{}).GenerateResourceSummary(&inventory)
+	log.Printf("[InventorySync] ✅ Read %d items from %d files for tenant %s: %d added, %d updated, %d removed",
+		stats.ItemsRead, stats.FilesRead, tenantID, stats.Added, stats.Updated, stats.Removed)
+	return &inventory, nil
+}
+
+// deliveryReader reads the files AWS Config delivered to one bucket and prefix
+type deliveryReader struct {
+	s3     *s3.Client
+	pool   *workerPool
+	bucket string
+	// prefix is the delivery channel's <prefix>/AWSLogs/<account>/Config/ directory
+	prefix string
+}
+
+// listSince returns the keys of the history and snapshot files delivered after since, oldest
+// first, and when the newest of them was delivered
+func (r *deliveryReader) listSince(ctx context.Context, since, now time.Time) ([]string, time.Time, error) {
+	regions, err := r.s3.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(r.bucket),
+		Prefix:    aws.String(r.prefix),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to list Config delivery regions in %s: %w", r.bucket, err)
+	}
+
+	type delivered struct {
+		key string
+		at  time.Time
+	}
+	var files []delivered
+	var newest time.Time
+	for _, region := range regions.CommonPrefixes {
+		// Files are filed under the UTC day they were delivered, as <region>/<yyyy>/<m>/<d>/
+		for day := since.UTC().Truncate(24 * time.Hour); !day.After(now); day = day.Add(24 * time.Hour) {
+			dayPrefix := fmt.Sprintf("%s%d/%d/%d/", aws.ToString(region.Prefix), day.Year(), int(day.Month()), day.Day())
+			paginator := s3.NewListObjectsV2Paginator(r.s3, &s3.ListObjectsV2Input{Bucket: aws.String(r.bucket), Prefix: aws.String(dayPrefix)})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					return nil, time.Time{}, fmt.Errorf("failed to list Config delivery files under %s: %w", dayPrefix, err)
+				}
+				for _, object := range page.Contents {
+					key, at := aws.ToString(object.Key), aws.ToTime(object.LastModified)
+					if !at.After(since) || !isConfigItemFile(key) {
+						continue
+					}
+					files = append(files, delivered{key: key, at: at})
+					if at.After(newest) {
+						newest = at
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].at.Before(files[j].at) })
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		keys = append(keys, file.key)
+	}
+	return keys, newest, nil
+}
+
+// isConfigItemFile reports whether a delivered object holds configuration items, rather than
+// being e.g. the delivery channel's access check file
+func isConfigItemFile(key string) bool {
+	return strings.Contains(key, "/ConfigHistory/") || strings.Contains(key, "/ConfigSnapshot/")
+}
+
+// read downloads the files in parallel and returns their configuration items in file order
+func (r *deliveryReader) read(ctx context.Context, keys []string) ([]ConfigurationItem, error) {
+	byFile := make([][]ConfigurationItem, len(keys))
+	errs := r.pool.run(ctx, len(keys), func(ctx context.Context, i int) error {
+		var err error
+		byFile[i], err = r.readFile(ctx, keys[i])
+		return err
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var items []ConfigurationItem
+	for i, err := range errs {
+		if err != nil {
+			// A file that cannot be read fails the sync, so its changes are not skipped for good
+			return nil, err
+		}
+		items = append(items, byFile[i]...)
+	}
+	return items, nil
+}
+
+func (r *deliveryReader) readFile(ctx context.Context, key string) ([]ConfigurationItem, error) {
+	object, err := r.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(r.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	content, err := gunzipAll(object.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+	}
+	var file deliveryFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+
+	items := make([]ConfigurationItem, 0, len(file.ConfigurationItems))
+	for _, raw := range file.ConfigurationItems {
+		var delivered deliveredItem
+		if err := json.Unmarshal(raw, &delivered); err != nil {
+			log.Printf("[InventorySync] Warning: skipping configuration item in %s: %v", key, err)
+			continue
+		}
+		item := delivered.ConfigurationItem
+		item.AccountID = delivered.AWSAccountID
+		for _, relationship := range delivered.Relationships {
+			item.Relationships = append(item.Relationships, Relationship{
+				ResourceType:     relationship.ResourceType,
+				ResourceID:       relationship.ResourceID,
+				ResourceName:     relationship.ResourceName,
+				RelationshipName: relationship.Name,
+			})
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// applyDeliveredItems applies configuration items to the inventory in capture order and
+// returns those that changed it. An item older than the stored configuration of its resource,
+// or in the same state, changes nothing.
+func applyDeliveredItems(inventory *ResourceInventory, items []ConfigurationItem, stats *InventorySync) []ConfigurationItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return aws.ToTime(items[i].CaptureTime).Before(aws.ToTime(items[j].CaptureTime))
+	})
+
+	position := make(map[string]int, len(inventory.Resources))
+	for i, resource := range inventory.Resources {
+		position[resource.ResourceType+"/"+resource.ResourceID] = i
+	}
+	removed := map[int]bool{}
+
+	var changed []ConfigurationItem
+	for _, item := range items {
+		key := item.ResourceType + "/" + item.ResourceID
+		i, exists := position[key]
+		if exists && removed[i] {
+			exists = false
+		}
+		if exists {
+			current := inventory.Resources[i]
+			if current.CaptureTime != nil && item.CaptureTime != nil && item.CaptureTime.Before(*current.CaptureTime) {
+				continue
+			}
+			if current.ConfigurationStateId != "" && current.ConfigurationStateId == item.ConfigurationStateId {
+				continue
+			}
+		}
+
+		switch {
+		case deletedItemStatuses[item.ConfigurationStatus]:
+			if !exists {
+				continue
+			}
+			removed[i] = true
+			stats.Removed++
+		case exists:
+			if item.Tags == nil {
+				item.Tags = make(FlexibleTags)
+			}
+			inventory.Resources[i] = item
+			stats.Updated++
+		default:
+			if item.Tags == nil {
+				item.Tags = make(FlexibleTags)
+			}
+			position[key] = len(inventory.Resources)
+			inventory.Resources = append(inventory.Resources, item)
+			stats.Added++
+		}
+		changed = append(changed, item)
+	}
+
+	if len(removed) > 0 {
+		kept := inventory.Resources[:0]
+		for i, resource := range inventory.Resources {
+			if !removed[i] {
+				kept = append(kept, resource)
+			}
+		}
+		inventory.Resources = kept
+	}
+	return changed
+}
+
+// recordResourceHistory stores the changed configuration items in each resource's history
+func recordResourceHistory(ctx context.Context, tenantID string, items []ConfigurationItem) (int, error) {
+	store := resourcehistory.Default()
+	if store == nil || len(items) == 0 {
+		return 0, nil
+	}
+	changes := make([]resourcehistory.Change, 0, len(items))
+	for _, item := range items {
+		changes = append(changes, resourcehistory.Change{
+			TenantID:      tenantID,
+			ResourceType:  item.ResourceType,
+			ResourceID:    item.ResourceID,
+			ResourceName:  item.ResourceName,
+			Region:        item.Region,
+			Status:        item.ConfigurationStatus,
+			StateID:       item.ConfigurationStateId,
+			CapturedAt:    aws.ToTime(item.CaptureTime),
+			Configuration: item.Configuration,
+			Tags:          item.Tags,
+		})
+	}
+	return store.Record(ctx, changes)
+}
+
+// ResourceHistory returns the recorded configurations of one of the tenant's resources,
+// newest first
+func ResourceHistory(ctx context.Context, tenantID, resourceType, resourceID string, limit int64) ([]resourcehistory.Change, error) {
+	store := resourcehistory.Default()
+	if store == nil {
+		return nil, errors.New("resource history is not initialized")
+	}
+	return store.List(ctx, tenantID, resourceType, resourceID, limit)
+}
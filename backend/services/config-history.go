@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// Lengths of a configuration timeline, in configuration items
+const (
+	defaultConfigHistoryLimit = 20
+	maxConfigHistoryLimit     = 100
+)
+
+// ConfigHistoryOptions narrows a resource's configuration timeline
+type ConfigHistoryOptions struct {
+	// ResourceType is looked up in the latest snapshot when empty
+	ResourceType string
+	// Region defaults to the region of the resource in the latest snapshot, else the home region
+	Region string
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+}
+
+// ConfigChange is one value that differs between consecutive configuration items. Path is a
+// JSON pointer into the item, e.g. /configuration/ipPermissions/0/fromPort.
+type ConfigChange struct {
+	Path   string      `json:"path"`
+	Op     string      `json:"op"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Operations of a ConfigChange
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeRemoved = "removed"
+	ConfigChangeChanged = "changed"
+)
+
+// ConfigHistoryEntry is one configuration item of a resource with what changed since the item
+// before it. Changes is nil for the oldest item of a resource's history.
+type ConfigHistoryEntry struct {
+	CaptureTime                time.Time              `json:"captureTime"`
+	Status                     string                 `json:"status"`
+	StateID                    string                 `json:"stateId"`
+	Configuration              map[string]interface{} `json:"configuration,omitempty"`
+	SupplementaryConfiguration map[string]interface{} `json:"supplementaryConfiguration,omitempty"`
+	Tags                       map[string]string      `json:"tags"`
+	Relationships              []Relationship         `json:"relationships"`
+	// RelatedEvents are the CloudTrail event IDs AWS Config linked to the change
+	RelatedEvents []string       `json:"relatedEvents,omitempty"`
+	Changes       []ConfigChange `json:"changes"`
+}
+
+// ConfigTimeline is a resource's configuration history, newest first
+type ConfigTimeline struct {
+	ResourceType string               `json:"resourceType"`
+	ResourceID   string               `json:"resourceId"`
+	Region       string               `json:"region"`
+	Entries      []ConfigHistoryEntry `json:"entries"`
+}
+
+// ResourceConfigHistory returns the configuration items AWS Config recorded for one of the
+// tenant's resources, newest first, each with the changes from the item before it. It returns
+// jobs.ErrNotFound if no type is given and the latest snapshot does not have the resource.
+func ResourceConfigHistory(ctx context.Context, tenantID, resourceID string, opts ConfigHistoryOptions) (*ConfigTimeline, error) {
+	if opts.ResourceType == "" || opts.Region == "" {
+		resource, err := latestResource(ctx, tenantID, resourceID)
+		switch {
+		case err == nil:
+			if opts.ResourceType == "" {
+				opts.ResourceType = resource.ResourceType
+			}
+			if opts.Region == "" {
+				opts.Region = resource.Region
+			}
+		case opts.ResourceType == "" || !errors.Is(err, jobs.ErrNotFound):
+			return nil, err
+		}
+	}
+	if DemoModeEnabled() {
+		return &ConfigTimeline{ResourceType: opts.ResourceType, ResourceID: resourceID, Region: opts.Region, Entries: []ConfigHistoryEntry{}}, nil
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultConfigHistoryLimit
+	}
+	opts.Limit = min(opts.Limit, maxConfigHistoryLimit)
+
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	if opts.Region != "" {
+		cfg = inRegion(cfg, opts.Region)
+	}
+
+	// One item more than asked for, so the oldest returned item has one to be diffed against
+	items, err := getConfigHistory(ctx, configservice.NewFromConfig(cfg), resourceID, opts, opts.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := &ConfigTimeline{ResourceType: opts.ResourceType, ResourceID: resourceID, Region: cfg.Region, Entries: []ConfigHistoryEntry{}}
+	for _, item := range items {
+		timeline.Entries = append(timeline.Entries, configHistoryEntry(item))
+	}
+	for i := 0; i+1 < len(timeline.Entries); i++ {
+		timeline.Entries[i].Changes = diffConfigHistoryEntries(&timeline.Entries[i+1], &timeline.Entries[i])
+	}
+	if len(timeline.Entries) > opts.Limit {
+		timeline.Entries = timeline.Entries[:opts.Limit]
+	}
+	return timeline, nil
+}
+
+// latestResource finds a resource in the tenant's latest snapshot
+func latestResource(ctx context.Context, tenantID, resourceID string) (*ConfigurationItem, error) {
+	snapshot, inventory, err := LoadInventory(ctx, tenantID, "", false)
+	if err != nil {
+		return nil, err
+	}
+	detail, err := GetResourceDetail(snapshot, inventory, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	return &detail.Resource, nil
+}
+
+// getConfigHistory reads up to limit configuration items of a resource, newest first
+func getConfigHistory(ctx context.Context, client *configservice.Client, resourceID string, opts ConfigHistoryOptions, limit int) ([]types.ConfigurationItem, error) {
+	input := &configservice.GetResourceConfigHistoryInput{
+		ResourceId:         aws.String(resourceID),
+		ResourceType:       types.ResourceType(opts.ResourceType),
+		ChronologicalOrder: types.ChronologicalOrderReverse,
+		EarlierTime:        opts.Since,
+		LaterTime:          opts.Until,
+	}
+
+	var items []types.ConfigurationItem
+	paginator := configservice.NewGetResourceConfigHistoryPaginator(client, input)
+	for paginator.HasMorePages() && len(items) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration history of %s: %w", resourceID, err)
+		}
+		items = append(items, page.ConfigurationItems...)
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func configHistoryEntry(item types.ConfigurationItem) ConfigHistoryEntry {
+	entry := ConfigHistoryEntry{
+		CaptureTime:   aws.ToTime(item.ConfigurationItemCaptureTime),
+		Status:        string(item.ConfigurationItemStatus),
+		StateID:       aws.ToString(item.ConfigurationStateId),
+		Tags:          item.Tags,
+		Relationships: []Relationship{},
+		RelatedEvents: item.RelatedEvents,
+	}
+	if entry.Tags == nil {
+		entry.Tags = map[string]string{}
+	}
+	if configuration := aws.ToString(item.Configuration); configuration != "" {
+		_ = json.Unmarshal([]byte(configuration), &entry.Configuration)
+	}
+	if len(item.SupplementaryConfiguration) > 0 {
+		entry.SupplementaryConfiguration = map[string]interface{}{}
+		for key, value := range item.SupplementaryConfiguration {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				decoded = value
+			}
+			entry.SupplementaryConfiguration[key] = decoded
+		}
+	}
+	for _, relationship := range item.Relationships {
+		entry.Relationships = append(entry.Relationships, Relationship{
+			ResourceType:     string(relationship.ResourceType),
+			ResourceID:       aws.ToString(relationship.ResourceId),
+			ResourceName:     aws.ToString(relationship.ResourceName),
+			RelationshipName: aws.ToString(relationship.RelationshipName),
+		})
+	}
+	return entry
+}
+
+// diffConfigHistoryEntries lists what changed from one configuration item to the next in its
+// configuration, supplementary configuration, tags and relationships
+func diffConfigHistoryEntries(before, after *ConfigHistoryEntry) []ConfigChange {
+	changes := []ConfigChange{}
+	diffJSON("/configuration", normalizeJSON(before.Configuration), normalizeJSON(after.Configuration), &changes)
+	diffJSON("/supplementaryConfiguration", normalizeJSON(before.SupplementaryConfiguration), normalizeJSON(after.SupplementaryConfiguration), &changes)
+	diffJSON("/tags", normalizeJSON(before.Tags), normalizeJSON(after.Tags), &changes)
+	diffJSON("/relationships", normalizeJSON(before.Relationships), normalizeJSON(after.Relationships), &changes)
+	return changes
+}
+
+// normalizeJSON round-trips a value through JSON so maps, slices and numbers compare alike
+// however they were decoded
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil
+	}
+	return normalized
+}
+
+// diffJSON appends the differences between two decoded JSON values. Objects are compared key
+// by key and arrays index by index; any other difference replaces the value at path.
+func diffJSON(path string, before, after interface{}, changes *[]ConfigChange) {
+	if before == nil && after == nil {
+		return
+	}
+	if before == nil {
+		*changes = append(*changes, ConfigChange{Path: path, Op: ConfigChangeAdded, After: after})
+		return
+	}
+	if after == nil {
+		*changes = append(*changes, ConfigChange{Path: path, Op: ConfigChangeRemoved, Before: before})
+		return
+	}
+
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, seen := b[key]; !seen {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffJSON(path+"/"+escapeJSONPointer(key), b[key], a[key], changes)
+		}
+		return
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(b), len(a)); i++ {
+			var beforeItem, afterItem interface{}
+			if i < len(b) {
+				beforeItem = b[i]
+			}
+			if i < len(a) {
+				afterItem = a[i]
+			}
+			diffJSON(path+"/"+strconv.Itoa(i), beforeItem, afterItem, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, ConfigChange{Path: path, Op: ConfigChangeChanged, Before: before, After: after})
+	}
+}
+
+// escapeJSONPointer escapes a key for use as a JSON pointer segment (RFC 6901)
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
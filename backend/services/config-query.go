@@ -0,0 +1,447 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	"github.com/rishichirchi/cloudloom/common"
+)
+
+// Page sizes and length of an advanced query, as AWS Config limits them
+const (
+	maxConfigQueryLength   = 4096
+	defaultConfigQueryPage = 100
+	maxConfigQueryPage     = 100
+)
+
+// ErrInvalidQuery is wrapped by every advanced query validation error
+var ErrInvalidQuery = errors.New("invalid query")
+
+// configQueryFields are the top-level fields of a configuration item a query may name. Those
+// mapped to true have nested properties, e.g. configuration.instanceType or tags.key.
+var configQueryFields = map[string]bool{
+	"accountid":                    false,
+	"arn":                          false,
+	"availabilityzone":             false,
+	"awsregion":                    false,
+	"configurationitemcapturetime": false,
+	"configurationitemstatus":      false,
+	"configurationstateid":         false,
+	"resourcecreationtime":         false,
+	"resourceid":                   false,
+	"resourcename":                 false,
+	"resourcetype":                 false,
+	"version":                      false,
+	"configuration":                true,
+	"supplementaryconfiguration":   true,
+	"tags":                         true,
+	"relationships":                true,
+}
+
+// configQueryKeywords are the keywords, functions and literals a query may use. Anything else
+// that is not a field is rejected, so a query cannot reach past the resource configuration
+// table whatever AWS Config adds to its dialect.
+var configQueryKeywords = map[string]bool{
+	"SELECT": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "IN": true,
+	"LIKE": true, "BETWEEN": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true,
+	"GROUP": true, "ORDER": true, "BY": true, "ASC": true, "DESC": true, "AS": true,
+	"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true,
+}
+
+// configQueryOperators are the comparison operators and punctuation a query may use
+var configQueryOperators = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*"}
+
+// ConfigQuery is an AWS Config advanced query and the page of its results to return
+type ConfigQuery struct {
+	Expression string
+	Limit      int
+	NextToken  string
+}
+
+// ConfigQueryField is a column of a query's results with the JSON type of its values: string,
+// number, boolean, object or array, or null if no row on the page has a value for it
+type ConfigQueryField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ConfigQueryResult is a page of the rows an advanced query selected
+type ConfigQueryResult struct {
+	Fields    []ConfigQueryField       `json:"fields"`
+	Rows      []map[string]interface{} `json:"rows"`
+	NextToken string                   `json:"nextToken,omitempty"`
+}
+
+// ValidateConfigQuery checks that an expression is a single SELECT over allowlisted fields
+// using only allowlisted keywords and operators. Statement separators, comments and quoted
+// identifiers are rejected.
+func ValidateConfigQuery(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return fmt.Errorf("%w: expression is required", ErrInvalidQuery)
+	}
+	if len(expression) > maxConfigQueryLength {
+		return fmt.Errorf("%w: expression is longer than %d characters", ErrInvalidQuery, maxConfigQueryLength)
+	}
+
+	trimmed := strings.TrimSpace(expression)
+	if len(trimmed) < len("SELECT") || !strings.EqualFold(trimmed[:len("SELECT")], "SELECT") ||
+		len(trimmed) > len("SELECT") && isQueryIdentifierByte(trimmed[len("SELECT")]) {
+		return fmt.Errorf("%w: expression must start with SELECT", ErrInvalidQuery)
+	}
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(expression[i+1:], '\'')
+			if end < 0 {
+				return fmt.Errorf("%w: unterminated string at position %d", ErrInvalidQuery, i)
+			}
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(expression) && expression[i+1] >= '0' && expression[i+1] <= '9':
+			i++
+			for i < len(expression) && (expression[i] >= '0' && expression[i] <= '9' || expression[i] == '.') {
+				i++
+			}
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(expression) && isQueryIdentifierByte(expression[i]) {
+				i++
+			}
+			if err := checkQueryWord(expression[start:i]); err != nil {
+				return err
+			}
+		default:
+			operator := ""
+			for _, candidate := range configQueryOperators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return fmt.Errorf("%w: unexpected '%c' at position %d", ErrInvalidQuery, c, i)
+			}
+			i += len(operator)
+		}
+	}
+	return nil
+}
+
+func isQueryIdentifierByte(b byte) bool {
+	return b == '_' || b == '.' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// checkQueryWord accepts an allowlisted keyword or a field path whose top-level field is
+// allowlisted; only fields with nested properties may be followed by a path
+func checkQueryWord(word string) error {
+	if configQueryKeywords[strings.ToUpper(word)] {
+		return nil
+	}
+	field, path, nested := strings.Cut(word, ".")
+	hasNested, known := configQueryFields[strings.ToLower(field)]
+	if !known {
+		return fmt.Errorf("%w: '%s' is not a queryable field or keyword", ErrInvalidQuery, word)
+	}
+	if nested && (!hasNested || path == "" || strings.HasSuffix(path, ".") || strings.Contains(path, "..")) {
+		return fmt.Errorf("%w: '%s' is not a queryable field", ErrInvalidQuery, word)
+	}
+	return nil
+}
+
+// RunConfigQuery validates an advanced query and runs it against the tenant's account, through
+// the CloudLoom aggregator when it has collected data, returning one page of rows. Numbers keep
+// their precision, and each column is typed from the values on the page.
+func RunConfigQuery(ctx context.Context, tenantID string, query ConfigQuery) (*ConfigQueryResult, error) {
+	if err := ValidateConfigQuery(query.Expression); err != nil {
+		return nil, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultConfigQueryPage
+	}
+	query.Limit = min(query.Limit, maxConfigQueryPage)
+	if DemoModeEnabled() {
+		return &ConfigQueryResult{Fields: []ConfigQueryField{}, Rows: []map[string]interface{}{}}, nil
+	}
+
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	cs := NewConfigService(cfg)
+	cs.useAggregator(ctx)
+	return cs.selectPage(ctx, query)
+}
+
+// FindTenantResources runs a structured resource query against the tenant's account, through
+// the CloudLoom aggregator when it has collected data, returning every matching resource
+func FindTenantResources(ctx context.Context, tenantID string, query ResourceQuery) ([]ConfigurationItem, error) {
+	if _, err := query.Expression(); err != nil {
+		return nil, err
+	}
+	if DemoModeEnabled() {
+		return []ConfigurationItem{}, nil
+	}
+
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	cs := NewConfigService(cfg)
+	cs.useAggregator(ctx)
+	return cs.FindResources(ctx, query)
+}
+
+// selectPage runs a query for one page of results, as selectResources runs it for all of them
+func (cs *ConfigService) selectPage(ctx context.Context, query ConfigQuery) (*ConfigQueryResult, error) {
+	var token *string
+	if query.NextToken != "" {
+		token = aws.String(query.NextToken)
+	}
+
+	var results, fields []string
+	var next *string
+	if cs.aggregator != "" {
+		out, err := cs.client.SelectAggregateResourceConfig(ctx, &configservice.SelectAggregateResourceConfigInput{
+			ConfigurationAggregatorName: aws.String(cs.aggregator),
+			Expression:                  aws.String(query.Expression),
+			Limit:                       int32(query.Limit),
+			NextToken:                   token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to run aggregated query: %w", err)
+		}
+		results, next = out.Results, out.NextToken
+		if out.QueryInfo != nil {
+			for _, field := range out.QueryInfo.SelectFields {
+				fields = append(fields, aws.ToString(field.Name))
+			}
+		}
+	} else {
+		out, err := cs.client.SelectResourceConfig(ctx, &configservice.SelectResourceConfigInput{
+			Expression: aws.String(query.Expression),
+			Limit:      int32(query.Limit),
+			NextToken:  token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to run query: %w", err)
+		}
+		results, next = out.Results, out.NextToken
+		if out.QueryInfo != nil {
+			for _, field := range out.QueryInfo.SelectFields {
+				fields = append(fields, aws.ToString(field.Name))
+			}
+		}
+	}
+
+	result := &ConfigQueryResult{Fields: []ConfigQueryField{}, Rows: []map[string]interface{}{}, NextToken: aws.ToString(next)}
+	for _, raw := range results {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+		decoder.UseNumber()
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode query result: %w", err)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	for _, name := range fields {
+		result.Fields = append(result.Fields, ConfigQueryField{Name: name, Type: queryFieldType(result.Rows, name)})
+	}
+	return result, nil
+}
+
+// queryFieldType is the JSON type of the first value of a field on a page. Nested fields are
+// returned nested, so configuration.instanceType is looked up as configuration, instanceType.
+func queryFieldType(rows []map[string]interface{}, name string) string {
+	for _, row := range rows {
+		var value interface{} = row
+		for _, key := range strings.Split(name, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = object[key]
+		}
+		switch value.(type) {
+		case nil:
+			continue
+		case string:
+			return "string"
+		case json.Number:
+			return "number"
+		case bool:
+			return "boolean"
+		case []interface{}:
+			return "array"
+		default:
+			return "object"
+		}
+	}
+	return "null"
+}
+
+// configItemColumns are the columns of a configuration item that queries for whole resources
+// select
+const configItemColumns = `resourceId, accountId, resourceType, resourceName, awsRegion, availabilityZone, configuration,
+	supplementaryConfiguration, configurationItemStatus, configurationStateId, configurationItemCaptureTime,
+	resourceCreationTime, tags, relationships`
+
+// maxTagLength is the longest tag key or value AWS allows
+const maxTagLength = 256
+
+// knownResourceTypes are the resource types AWS Config records, from the SDK's enum
+var knownResourceTypes = func() map[string]bool {
+	known := map[string]bool{}
+	for _, resourceType := range types.ResourceType("").Values() {
+		known[string(resourceType)] = true
+	}
+	return known
+}()
+
+// ResourceQuery selects whole configuration items by structured filters. Empty fields match
+// every resource; a resource must match every non-empty one.
+type ResourceQuery struct {
+	ResourceTypes []string
+	Regions       []string
+	// Tags are "key" or "key=value"; a resource must have every one of them
+	Tags []string
+	// ComplianceStatus is COMPLIANT or NON_COMPLIANT, as AWS Config last evaluated the resource
+	ComplianceStatus string
+}
+
+// quoteQueryValue quotes a value as a Config SQL string literal, doubling any single quote so
+// the value cannot end the literal. Control characters are rejected.
+func quoteQueryValue(value string) (string, error) {
+	for _, r := range value {
+		if r < ' ' || r == 0x7f {
+			return "", fmt.Errorf("%w: value %q contains a control character", ErrInvalidQuery, value)
+		}
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'", nil
+}
+
+// quoteQueryList quotes each value with quoteQueryValue and joins them for an IN list
+func quoteQueryList(values []string) (string, error) {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if quoted[i], err = quoteQueryValue(value); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+// Expression builds the query's Config SQL expression. Resource types must be ones AWS Config
+// records and regions must be AWS regions; every value is quoted. The compliance status is not
+// part of the expression, since compliance is recorded on separate configuration items, and is
+// applied by ConfigService.FindResources.
+func (q ResourceQuery) Expression() (string, error) {
+	var conditions []string
+
+	if len(q.ResourceTypes) > 0 {
+		for _, resourceType := range q.ResourceTypes {
+			if !knownResourceTypes[resourceType] {
+				return "", fmt.Errorf("%w: '%s' is not a resource type AWS Config records", ErrInvalidQuery, resourceType)
+			}
+		}
+		list, _ := quoteQueryList(q.ResourceTypes)
+		conditions = append(conditions, "resourceType IN ("+list+")")
+	}
+
+	if len(q.Regions) > 0 {
+		for _, region := range q.Regions {
+			if !common.IsAWSRegion(region) {
+				return "", fmt.Errorf("%w: '%s' is not an AWS region", ErrInvalidQuery, region)
+			}
+		}
+		list, _ := quoteQueryList(q.Regions)
+		conditions = append(conditions, "awsRegion IN ("+list+")")
+	}
+
+	for _, tag := range q.Tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		if key == "" || len(key) > maxTagLength || len(value) > maxTagLength {
+			return "", fmt.Errorf("%w: tag '%s' must be key or key=value", ErrInvalidQuery, tag)
+		}
+		// tags.tag is "key:value"
+		field, literal := "tags.key", key
+		if hasValue {
+			field, literal = "tags.tag", key+":"+value
+		}
+		quoted, err := quoteQueryValue(literal)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, field+" = "+quoted)
+	}
+
+	switch q.ComplianceStatus {
+	case "", ComplianceCompliant, ComplianceNonCompliant:
+	default:
+		return "", fmt.Errorf("%w: compliance status must be %s or %s", ErrInvalidQuery, ComplianceCompliant, ComplianceNonCompliant)
+	}
+
+	expression := "SELECT " + configItemColumns
+	if len(conditions) > 0 {
+		expression += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return expression, nil
+}
+
+// FindResources returns the configuration items matching a structured query, through the
+// aggregator when the service uses one
+func (cs *ConfigService) FindResources(ctx context.Context, query ResourceQuery) ([]ConfigurationItem, error) {
+	expression, err := query.Expression()
+	if err != nil {
+		return nil, err
+	}
+	resources, err := cs.selectResources(ctx, expression)
+	if err != nil || query.ComplianceStatus == "" {
+		return resources, err
+	}
+
+	compliance, err := cs.resourceComplianceStatus(ctx, query.ComplianceStatus)
+	if err != nil {
+		return nil, err
+	}
+	matching := make([]ConfigurationItem, 0, len(resources))
+	for _, item := range resources {
+		if compliance[item.ResourceType+"/"+item.ResourceID] {
+			matching = append(matching, item)
+		}
+	}
+	return matching, nil
+}
+
+// resourceComplianceStatus returns the "type/ID" of every resource AWS Config last evaluated
+// as status, read from the account's AWS::Config::ResourceCompliance items
+func (cs *ConfigService) resourceComplianceStatus(ctx context.Context, status string) (map[string]bool, error) {
+	quoted, err := quoteQueryValue(status)
+	if err != nil {
+		return nil, err
+	}
+	expression := "SELECT configuration.targetResourceType, configuration.targetResourceId WHERE resourceType = 'AWS::Config::ResourceCompliance' AND configuration.complianceType = " + quoted
+	items, err := cs.selectResources(ctx, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := map[string]bool{}
+	for _, item := range items {
+		resourceType := stringValue(configValue(item.Configuration, "targetResourceType"))
+		resourceID := stringValue(configValue(item.Configuration, "targetResourceId"))
+		resources[resourceType+"/"+resourceID] = true
+	}
+	return resources, nil
+}
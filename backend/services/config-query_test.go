@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResourceQueryExpression(t *testing.T) {
+	selectAll := "SELECT " + configItemColumns
+	tests := []struct {
+		name    string
+		query   ResourceQuery
+		want    string
+		wantErr bool
+	}{
+		{name: "no filters", query: ResourceQuery{}, want: selectAll},
+		{
+			name:  "resource types",
+			query: ResourceQuery{ResourceTypes: []string{"AWS::EC2::Instance", "AWS::S3::Bucket"}},
+			want:  selectAll + " WHERE resourceType IN ('AWS::EC2::Instance', 'AWS::S3::Bucket')",
+		},
+		{name: "type containing a quote", query: ResourceQuery{ResourceTypes: []string{"AWS::S3::Bucket' OR resourceType = 'AWS::IAM::User"}}, wantErr: true},
+		{name: "unknown type", query: ResourceQuery{ResourceTypes: []string{"AWS::Made::Up"}}, wantErr: true},
+		{
+			name:  "regions",
+			query: ResourceQuery{Regions: []string{"us-east-1", "eu-west-1"}},
+			want:  selectAll + " WHERE awsRegion IN ('us-east-1', 'eu-west-1')",
+		},
+		{name: "invalid region", query: ResourceQuery{Regions: []string{"us-east-1' OR '1'='1"}}, wantErr: true},
+		{name: "tag key", query: ResourceQuery{Tags: []string{"env"}}, want: selectAll + " WHERE tags.key = 'env'"},
+		{name: "tag key and value", query: ResourceQuery{Tags: []string{"env=prod"}}, want: selectAll + " WHERE tags.tag = 'env:prod'"},
+		{name: "tag value containing a quote", query: ResourceQuery{Tags: []string{"owner=o'brien"}}, want: selectAll + " WHERE tags.tag = 'owner:o''brien'"},
+		{name: "tag value containing =", query: ResourceQuery{Tags: []string{"query=a=b"}}, want: selectAll + " WHERE tags.tag = 'query:a=b'"},
+		{name: "tag with a control character", query: ResourceQuery{Tags: []string{"env\n=prod"}}, wantErr: true},
+		{name: "tag without key", query: ResourceQuery{Tags: []string{"=prod"}}, wantErr: true},
+		{name: "compliance status", query: ResourceQuery{ComplianceStatus: ComplianceNonCompliant}, want: selectAll},
+		{name: "unknown compliance status", query: ResourceQuery{ComplianceStatus: "BROKEN"}, wantErr: true},
+		{
+			name:  "every filter",
+			query: ResourceQuery{ResourceTypes: []string{"AWS::S3::Bucket"}, Regions: []string{"eu-west-1"}, Tags: []string{"env=prod", "team"}},
+			want:  selectAll + " WHERE resourceType IN ('AWS::S3::Bucket') AND awsRegion IN ('eu-west-1') AND tags.tag = 'env:prod' AND tags.key = 'team'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Expression()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("Expression() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Expression() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+)
+
+var (
+	// ErrInvalidConfigRule is returned for a rule with a bad name, an identifier missing from
+	// the managed rule catalog, or parameters the managed rule does not accept
+	ErrInvalidConfigRule = errors.New("invalid config rule")
+	// ErrConfigRuleNotFound is returned when the rule does not exist in the tenant's account
+	ErrConfigRuleNotFound = errors.New("config rule not found")
+	// ErrConfigRuleExists is returned when creating a rule whose name is taken
+	ErrConfigRuleExists = errors.New("config rule already exists")
+	// ErrConfigRuleNotManaged is returned when updating or deleting a rule CloudLoom did not create
+	ErrConfigRuleNotManaged = errors.New("config rule was not created by CloudLoom")
+)
+
+var configRuleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Types of managed rule parameter, as AWS Config names them
+const (
+	ParamString  = "String"
+	ParamInt     = "Int"
+	ParamDouble  = "Double"
+	ParamBoolean = "Boolean"
+	ParamCSV     = "CSV"
+)
+
+// ManagedRuleParameter is a parameter an AWS managed Config rule accepts
+type ManagedRuleParameter struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	// Default is used when a required parameter is not given
+	Default string `json:"default,omitempty"`
+}
+
+// ManagedRule is an AWS managed Config rule CloudLoom can create
+type ManagedRule struct {
+	Identifier  string `json:"identifier"`
+	Description string `json:"description"`
+	// ResourceTypes scope the rule to configuration changes of these types. Periodic rules,
+	// which evaluate the account on a schedule, have none.
+	ResourceTypes []string               `json:"resourceTypes,omitempty"`
+	Periodic      bool                   `json:"periodic"`
+	Parameters    []ManagedRuleParameter `json:"parameters,omitempty"`
+}
+
+// managedRuleCatalog is the curated set of AWS managed rules tenants can create, by identifier
+var managedRuleCatalog = map[string]ManagedRule{}
+
+func init() {
+	for _, rule := range []ManagedRule{
+		{Identifier: "ACCESS_KEYS_ROTATED", Description: "Checks whether active IAM access keys are rotated within maxAccessKeyAge days", Periodic: true,
+			Parameters: []ManagedRuleParameter{{Name: "maxAccessKeyAge", Type: ParamInt, Required: true, Default: "90"}}},
+		{Identifier: "CLOUD_TRAIL_ENABLED", Description: "Checks whether a CloudTrail trail is enabled in the account", Periodic: true,
+			Parameters: []ManagedRuleParameter{{Name: "s3BucketName", Type: ParamString}, {Name: "snsTopicArn", Type: ParamString}, {Name: "cloudWatchLogsLogGroupArn", Type: ParamString}}},
+		{Identifier: "CLOUD_TRAIL_ENCRYPTION_ENABLED", Description: "Checks whether CloudTrail trails encrypt logs with a KMS key", Periodic: true},
+		{Identifier: "CLOUD_TRAIL_LOG_FILE_VALIDATION_ENABLED", Description: "Checks whether CloudTrail trails validate log files", Periodic: true},
+		{Identifier: "MULTI_REGION_CLOUD_TRAIL_ENABLED", Description: "Checks whether at least one multi-region CloudTrail trail is enabled", Periodic: true},
+		{Identifier: "DYNAMODB_PITR_ENABLED", Description: "Checks whether point-in-time recovery is enabled for DynamoDB tables", ResourceTypes: []string{"AWS::DynamoDB::Table"}},
+		{Identifier: "EC2_EBS_ENCRYPTION_BY_DEFAULT", Description: "Checks whether EBS encryption is enabled by default", Periodic: true},
+		{Identifier: "ENCRYPTED_VOLUMES", Description: "Checks whether attached EBS volumes are encrypted", ResourceTypes: []string{"AWS::EC2::Volume"},
+			Parameters: []ManagedRuleParameter{{Name: "kmsId", Type: ParamString}}},
+		{Identifier: "GUARDDUTY_ENABLED_CENTRALIZED", Description: "Checks whether GuardDuty is enabled in the account and region", Periodic: true},
+		{Identifier: "IAM_PASSWORD_POLICY", Description: "Checks whether the account password policy meets the given requirements", Periodic: true,
+			Parameters: []ManagedRuleParameter{
+				{Name: "RequireUppercaseCharacters", Type: ParamBoolean},
+				{Name: "RequireLowercaseCharacters", Type: ParamBoolean},
+				{Name: "RequireSymbols", Type: ParamBoolean},
+				{Name: "RequireNumbers", Type: ParamBoolean},
+				{Name: "MinimumPasswordLength", Type: ParamInt},
+				{Name: "PasswordReusePrevention", Type: ParamInt},
+				{Name: "MaxPasswordAge", Type: ParamInt},
+			}},
+		{Identifier: "IAM_ROOT_ACCESS_KEY_CHECK", Description: "Checks whether the root user has access keys", Periodic: true},
+		{Identifier: "IAM_USER_UNUSED_CREDENTIALS_CHECK", Description: "Checks whether IAM users have passwords or access keys unused for maxCredentialUsageAge days", Periodic: true,
+			Parameters: []ManagedRuleParameter{{Name: "maxCredentialUsageAge", Type: ParamInt, Required: true, Default: "90"}}},
+		{Identifier: "INCOMING_SSH_DISABLED", Description: "Checks whether security groups allow unrestricted incoming SSH traffic", ResourceTypes: []string{"AWS::EC2::SecurityGroup"}},
+		{Identifier: "LAMBDA_FUNCTION_PUBLIC_ACCESS_PROHIBITED", Description: "Checks whether Lambda function policies prohibit public access", ResourceTypes: []string{"AWS::Lambda::Function"}},
+		{Identifier: "MFA_ENABLED_FOR_IAM_CONSOLE_ACCESS", Description: "Checks whether MFA is enabled for IAM users with a console password", Periodic: true},
+		{Identifier: "RDS_INSTANCE_PUBLIC_ACCESS_CHECK", Description: "Checks whether RDS instances are not publicly accessible", ResourceTypes: []string{"AWS::RDS::DBInstance"}},
+		{Identifier: "RDS_STORAGE_ENCRYPTED", Description: "Checks whether RDS instances encrypt their storage", ResourceTypes: []string{"AWS::RDS::DBInstance"},
+			Parameters: []ManagedRuleParameter{{Name: "kmsKeyId", Type: ParamString}}},
+		{Identifier: "REQUIRED_TAGS", Description: "Checks whether resources have the given tags", ResourceTypes: []string{"AWS::EC2::Instance", "AWS::EC2::Volume", "AWS::S3::Bucket", "AWS::RDS::DBInstance"},
+			Parameters: []ManagedRuleParameter{
+				{Name: "tag1Key", Type: ParamString, Required: true},
+				{Name: "tag1Value", Type: ParamCSV},
+				{Name: "tag2Key", Type: ParamString},
+				{Name: "tag2Value", Type: ParamCSV},
+				{Name: "tag3Key", Type: ParamString},
+				{Name: "tag3Value", Type: ParamCSV},
+			}},
+		{Identifier: "RESTRICTED_INCOMING_TRAFFIC", Description: "Checks whether security groups restrict incoming traffic on the blocked ports", ResourceTypes: []string{"AWS::EC2::SecurityGroup"},
+			Parameters: []ManagedRuleParameter{
+				{Name: "blockedPort1", Type: ParamInt},
+				{Name: "blockedPort2", Type: ParamInt},
+				{Name: "blockedPort3", Type: ParamInt},
+				{Name: "blockedPort4", Type: ParamInt},
+				{Name: "blockedPort5", Type: ParamInt},
+			}},
+		{Identifier: "ROOT_ACCOUNT_MFA_ENABLED", Description: "Checks whether the root user has MFA enabled", Periodic: true},
+		{Identifier: "S3_BUCKET_LEVEL_PUBLIC_ACCESS_PROHIBITED", Description: "Checks whether S3 buckets block public access", ResourceTypes: []string{"AWS::S3::Bucket"},
+			Parameters: []ManagedRuleParameter{{Name: "excludedPublicBuckets", Type: ParamCSV}}},
+		{Identifier: "S3_BUCKET_PUBLIC_READ_PROHIBITED", Description: "Checks whether S3 buckets prohibit public read access", ResourceTypes: []string{"AWS::S3::Bucket"}},
+		{Identifier: "S3_BUCKET_PUBLIC_WRITE_PROHIBITED", Description: "Checks whether S3 buckets prohibit public write access", ResourceTypes: []string{"AWS::S3::Bucket"}},
+		{Identifier: "S3_BUCKET_SERVER_SIDE_ENCRYPTION_ENABLED", Description: "Checks whether S3 buckets have default encryption enabled", ResourceTypes: []string{"AWS::S3::Bucket"}},
+		{Identifier: "S3_BUCKET_SSL_REQUESTS_ONLY", Description: "Checks whether S3 bucket policies deny requests without TLS", ResourceTypes: []string{"AWS::S3::Bucket"}},
+		{Identifier: "SECURITYHUB_ENABLED", Description: "Checks whether Security Hub is enabled in the account", Periodic: true},
+		{Identifier: "VPC_DEFAULT_SECURITY_GROUP_CLOSED", Description: "Checks whether default security groups allow no traffic", ResourceTypes: []string{"AWS::EC2::SecurityGroup"}},
+		{Identifier: "VPC_FLOW_LOGS_ENABLED", Description: "Checks whether VPCs have flow logs enabled", Periodic: true,
+			Parameters: []ManagedRuleParameter{{Name: "trafficType", Type: ParamString}}},
+	} {
+		managedRuleCatalog[rule.Identifier] = rule
+	}
+}
+
+// ManagedRuleCatalog returns the AWS managed rules tenants can create, by identifier
+func ManagedRuleCatalog() []ManagedRule {
+	rules := make([]ManagedRule, 0, len(managedRuleCatalog))
+	for _, rule := range managedRuleCatalog {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Identifier < rules[j].Identifier })
+	return rules
+}
+
+// executionFrequencies are the schedules a periodic rule may run on
+var executionFrequencies = map[string]bool{
+	string(types.MaximumExecutionFrequencyOneHour):         true,
+	string(types.MaximumExecutionFrequencyThreeHours):      true,
+	string(types.MaximumExecutionFrequencySixHours):        true,
+	string(types.MaximumExecutionFrequencyTwelveHours):     true,
+	string(types.MaximumExecutionFrequencyTwentyFourHours): true,
+}
+
+// ConfigRuleSpec is a Config rule to create or update from the managed rule catalog
+type ConfigRuleSpec struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description,omitempty" binding:"max=256"`
+	SourceIdentifier string            `json:"sourceIdentifier" binding:"required"`
+	Parameters       map[string]string `json:"parameters,omitempty"`
+	// MaximumExecutionFrequency is how often a periodic rule runs, e.g. TwentyFour_Hours
+	MaximumExecutionFrequency string `json:"maximumExecutionFrequency,omitempty"`
+}
+
+// validate checks the spec against the managed rule catalog and fills in default parameters
+func (s *ConfigRuleSpec) validate() (ManagedRule, error) {
+	if !configRuleNamePattern.MatchString(s.Name) {
+		return ManagedRule{}, fmt.Errorf("%w: name must be 1-128 letters, digits, '-' or '_'", ErrInvalidConfigRule)
+	}
+	rule, ok := managedRuleCatalog[s.SourceIdentifier]
+	if !ok {
+		return ManagedRule{}, fmt.Errorf("%w: '%s' is not a managed rule in the catalog", ErrInvalidConfigRule, s.SourceIdentifier)
+	}
+	if s.MaximumExecutionFrequency != "" {
+		if !rule.Periodic {
+			return ManagedRule{}, fmt.Errorf("%w: %s runs on configuration changes and takes no execution frequency", ErrInvalidConfigRule, rule.Identifier)
+		}
+		if !executionFrequencies[s.MaximumExecutionFrequency] {
+			return ManagedRule{}, fmt.Errorf("%w: '%s' is not an execution frequency", ErrInvalidConfigRule, s.MaximumExecutionFrequency)
+		}
+	}
+
+	accepted := map[string]bool{}
+	for _, param := range rule.Parameters {
+		accepted[param.Name] = true
+		value, given := s.Parameters[param.Name]
+		if !given {
+			if param.Required && param.Default == "" {
+				return ManagedRule{}, fmt.Errorf("%w: %s requires parameter %s", ErrInvalidConfigRule, rule.Identifier, param.Name)
+			}
+			if param.Required {
+				if s.Parameters == nil {
+					s.Parameters = map[string]string{}
+				}
+				s.Parameters[param.Name] = param.Default
+			}
+			continue
+		}
+		if err := checkParameterValue(param, value); err != nil {
+			return ManagedRule{}, err
+		}
+	}
+	for name := range s.Parameters {
+		if !accepted[name] {
+			return ManagedRule{}, fmt.Errorf("%w: %s does not accept parameter %s", ErrInvalidConfigRule, rule.Identifier, name)
+		}
+	}
+	return rule, nil
+}
+
+func checkParameterValue(param ManagedRuleParameter, value string) error {
+	var err error
+	switch param.Type {
+	case ParamInt:
+		_, err = strconv.Atoi(value)
+	case ParamDouble:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamBoolean:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil || (param.Required && strings.TrimSpace(value) == "") {
+		return fmt.Errorf("%w: parameter %s must be a %s", ErrInvalidConfigRule, param.Name, param.Type)
+	}
+	return nil
+}
+
+// configRule builds the AWS Config rule for a validated spec
+func (s *ConfigRuleSpec) configRule(rule ManagedRule) (*types.ConfigRule, error) {
+	configRule := &types.ConfigRule{
+		ConfigRuleName: aws.String(s.Name),
+		Source: &types.Source{
+			Owner:            types.OwnerAws,
+			SourceIdentifier: aws.String(rule.Identifier),
+		},
+	}
+	configRule.Description = aws.String(rule.Description)
+	if s.Description != "" {
+		configRule.Description = aws.String(s.Description)
+	}
+	if len(rule.ResourceTypes) > 0 {
+		configRule.Scope = &types.Scope{ComplianceResourceTypes: rule.ResourceTypes}
+	}
+	if s.MaximumExecutionFrequency != "" {
+		configRule.MaximumExecutionFrequency = types.MaximumExecutionFrequency(s.MaximumExecutionFrequency)
+	}
+	if len(s.Parameters) > 0 {
+		params, err := json.Marshal(s.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		configRule.InputParameters = aws.String(string(params))
+	}
+	return configRule, nil
+}
+
+// ConfigRuleInfo is a Config rule in the tenant's account
+type ConfigRuleInfo struct {
+	Name             string            `json:"name"`
+	Arn              string            `json:"arn"`
+	Description      string            `json:"description,omitempty"`
+	Owner            string            `json:"owner"`
+	SourceIdentifier string            `json:"sourceIdentifier"`
+	Parameters       map[string]string `json:"parameters,omitempty"`
+	ResourceTypes    []string          `json:"resourceTypes,omitempty"`
+	// MaximumExecutionFrequency is set for periodic rules
+	MaximumExecutionFrequency string `json:"maximumExecutionFrequency,omitempty"`
+	State                     string `json:"state"`
+	// Managed is set for rules CloudLoom created, which are the only ones it updates or deletes
+	Managed bool `json:"managed"`
+}
+
+// ConfigRuleManager lists, creates, updates and deletes the Config rules of a tenant's
+// account in its home region
+type ConfigRuleManager struct {
+	client *configservice.Client
+	pool   *workerPool
+}
+
+// ConfigRuleManagerFor assumes the tenant's role and returns a manager for its account
+func ConfigRuleManagerFor(ctx context.Context, tenantID string) (*ConfigRuleManager, error) {
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	return NewConfigRuleManager(cfg), nil
+}
+
+// NewConfigRuleManager creates a ConfigRuleManager for the account of cfg
+func NewConfigRuleManager(cfg aws.Config) *ConfigRuleManager {
+	return &ConfigRuleManager{client: configservice.NewFromConfig(cfg), pool: newWorkerPool(inventoryConcurrencyFromEnv())}
+}
+
+// List returns every Config rule in the account, including those CloudLoom did not create
+func (m *ConfigRuleManager) List(ctx context.Context) ([]ConfigRuleInfo, error) {
+	var rules []types.ConfigRule
+	paginator := configservice.NewDescribeConfigRulesPaginator(m.client, &configservice.DescribeConfigRulesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe config rules: %w", err)
+		}
+		rules = append(rules, page.ConfigRules...)
+	}
+
+	infos := make([]ConfigRuleInfo, len(rules))
+	errs := m.pool.run(ctx, len(rules), func(ctx context.Context, i int) error {
+		infos[i] = configRuleInfo(rules[i])
+		var err error
+		infos[i].Managed, err = m.isManaged(ctx, rules[i])
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[ConfigRules] Warning: could not read tags of %s: %v", infos[i].Name, err)
+		}
+	}
+	return infos, nil
+}
+
+// Get returns one rule of the account
+func (m *ConfigRuleManager) Get(ctx context.Context, name string) (*ConfigRuleInfo, error) {
+	rule, err := m.describe(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	info := configRuleInfo(*rule)
+	if info.Managed, err = m.isManaged(ctx, *rule); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Create creates a rule from the managed rule catalog, tagged as managed by CloudLoom
+func (m *ConfigRuleManager) Create(ctx context.Context, spec ConfigRuleSpec) (*ConfigRuleInfo, error) {
+	rule, err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.describe(ctx, spec.Name); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConfigRuleExists, spec.Name)
+	} else if !errors.Is(err, ErrConfigRuleNotFound) {
+		return nil, err
+	}
+	if err := m.put(ctx, spec, rule); err != nil {
+		return nil, err
+	}
+	log.Printf("[ConfigRules] ✅ Created %s (%s)", spec.Name, rule.Identifier)
+	return m.Get(ctx, spec.Name)
+}
+
+// Update replaces the source, parameters and schedule of a rule CloudLoom created
+func (m *ConfigRuleManager) Update(ctx context.Context, spec ConfigRuleSpec) (*ConfigRuleInfo, error) {
+	rule, err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.requireManaged(ctx, spec.Name); err != nil {
+		return nil, err
+	}
+	if err := m.put(ctx, spec, rule); err != nil {
+		return nil, err
+	}
+	log.Printf("[ConfigRules] ✅ Updated %s (%s)", spec.Name, rule.Identifier)
+	return m.Get(ctx, spec.Name)
+}
+
+// Delete deletes a rule CloudLoom created, with its evaluation results
+func (m *ConfigRuleManager) Delete(ctx context.Context, name string) error {
+	if _, err := m.requireManaged(ctx, name); err != nil {
+		return err
+	}
+	if _, err := m.client.DeleteConfigRule(ctx, &configservice.DeleteConfigRuleInput{ConfigRuleName: aws.String(name)}); err != nil {
+		var notFound *types.NoSuchConfigRuleException
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("%w: %s", ErrConfigRuleNotFound, name)
+		}
+		return fmt.Errorf("failed to delete config rule %s: %w", name, err)
+	}
+	log.Printf("[ConfigRules] Deleted %s", name)
+	return nil
+}
+
+func (m *ConfigRuleManager) put(ctx context.Context, spec ConfigRuleSpec, rule ManagedRule) error {
+	configRule, err := spec.configRule(rule)
+	if err != nil {
+		return err
+	}
+	_, err = m.client.PutConfigRule(ctx, &configservice.PutConfigRuleInput{
+		ConfigRule: configRule,
+		Tags:       []types.Tag{{Key: aws.String(TagManaged), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put config rule %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+func (m *ConfigRuleManager) describe(ctx context.Context, name string) (*types.ConfigRule, error) {
+	out, err := m.client.DescribeConfigRules(ctx, &configservice.DescribeConfigRulesInput{ConfigRuleNames: []string{name}})
+	var notFound *types.NoSuchConfigRuleException
+	if errors.As(err, &notFound) || (err == nil && len(out.ConfigRules) == 0) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigRuleNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe config rule %s: %w", name, err)
+	}
+	return &out.ConfigRules[0], nil
+}
+
+// requireManaged returns the rule if it exists and CloudLoom created it
+func (m *ConfigRuleManager) requireManaged(ctx context.Context, name string) (*types.ConfigRule, error) {
+	rule, err := m.describe(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := m.isManaged(ctx, *rule)
+	if err != nil {
+		return nil, err
+	}
+	if !managed {
+		return nil, fmt.Errorf("%w: %s", ErrConfigRuleNotManaged, name)
+	}
+	return rule, nil
+}
+
+// isManaged reports whether the rule has the cloudloom:managed tag
+func (m *ConfigRuleManager) isManaged(ctx context.Context, rule types.ConfigRule) (bool, error) {
+	out, err := m.client.ListTagsForResource(ctx, &configservice.ListTagsForResourceInput{ResourceArn: rule.ConfigRuleArn})
+	if err != nil {
+		return false, fmt.Errorf("failed to list tags of config rule %s: %w", aws.ToString(rule.ConfigRuleName), err)
+	}
+	for _, tag := range out.Tags {
+		if aws.ToString(tag.Key) == TagManaged && aws.ToString(tag.Value) == "true" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func configRuleInfo(rule types.ConfigRule) ConfigRuleInfo {
+	info := ConfigRuleInfo{
+		Name:                      aws.ToString(rule.ConfigRuleName),
+		Arn:                       aws.ToString(rule.ConfigRuleArn),
+		Description:               aws.ToString(rule.Description),
+		MaximumExecutionFrequency: string(rule.MaximumExecutionFrequency),
+		State:                     string(rule.ConfigRuleState),
+	}
+	if rule.Source != nil {
+		info.Owner = string(rule.Source.Owner)
+		info.SourceIdentifier = aws.ToString(rule.Source.SourceIdentifier)
+	}
+	if rule.Scope != nil {
+		info.ResourceTypes = rule.Scope.ComplianceResourceTypes
+	}
+	if params := aws.ToString(rule.InputParameters); params != "" && params != "{}" {
+		if err := json.Unmarshal([]byte(params), &info.Parameters); err != nil {
+			log.Printf("[ConfigRules] Warning: could not parse parameters of %s: %v", info.Name, err)
+		}
+	}
+	return info
+}
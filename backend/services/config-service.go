@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
 	"strings"
 	"time"
 
@@ -14,23 +13,40 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rishichirchi/cloudloom/services/accountconfig"
 )
 
 // --- Data Structures ---
 
 // ResourceInventory represents a comprehensive view of AWS resources
 type ResourceInventory struct {
-	Resources       []ConfigurationItem `json:"resources"`
-	Policies        []PolicyDocument    `json:"policies"`
-	ComplianceRules []ComplianceRule    `json:"complianceRules"`
-	ResourceSummary ResourceSummary     `json:"resourceSummary"`
-	LastUpdated     time.Time           `json:"lastUpdated"`
+	Resources        []ConfigurationItem `json:"resources"`
+	Policies         []PolicyDocument    `json:"policies"`
+	ComplianceRules  []ComplianceRule    `json:"complianceRules"`
+	Secrets          []SecretItem        `json:"secrets,omitempty"`
+	Parameters       []ParameterItem     `json:"parameters,omitempty"`
+	ECRRepositories  []ECRRepository     `json:"ecrRepositories,omitempty"`
+	WebACLs          []WebACL            `json:"webAcls,omitempty"`
+	EdgeProtection   []EdgeProtection    `json:"edgeProtection,omitempty"`
+	PublicExposure   []ExposedEndpoint   `json:"publicExposure,omitempty"`
+	PublicArtifacts  []PublicArtifact    `json:"publicArtifacts,omitempty"`
+	UserActivity     []IAMUserActivity   `json:"userActivity,omitempty"`
+	ResourcePolicies []ResourcePolicy    `json:"resourcePolicies,omitempty"`
+	ResourceSummary  ResourceSummary     `json:"resourceSummary"`
+	LastUpdated      time.Time           `json:"lastUpdated"`
+	// SyncedThrough is the delivery time of the newest Config file applied by a sync
+	SyncedThrough *time.Time `json:"syncedThrough,omitempty"`
+	// Sync is set when the inventory was synced from the previous snapshot rather than scanned
+	Sync *InventorySync `json:"sync,omitempty"`
+	// Aggregator is the Config aggregator resources were queried through, covering all regions
+	// and, for an organization, all accounts; empty when only the home region was queried
+	Aggregator string `json:"aggregator,omitempty"`
 }
 
 // ConfigurationItem represents an AWS resource configuration, compatible with SelectResourceConfig output
 type ConfigurationItem struct {
 	ResourceID           string                 `json:"resourceId"`
+	AccountID            string                 `json:"accountId,omitempty"`
 	ResourceType         string                 `json:"resourceType"`
 	ResourceName         string                 `json:"resourceName"`
 	Region               string                 `json:"awsRegion"`
@@ -38,10 +54,15 @@ type ConfigurationItem struct {
 	Configuration        map[string]interface{} `json:"configuration"`
 	ConfigurationStatus  string                 `json:"configurationItemStatus"`
 	ConfigurationStateId string                 `json:"configurationStateId"`
+	CaptureTime          *time.Time             `json:"configurationItemCaptureTime,omitempty"`
 	ResourceCreationTime *time.Time             `json:"resourceCreationTime"`
 	Tags                 FlexibleTags           `json:"tags"`
 	Relationships        []Relationship         `json:"relationships"`
 	ComplianceStatus     string                 `json:"complianceStatus"` // This will be populated separately
+
+	// SupplementaryConfiguration holds settings Config records apart from the configuration,
+	// such as a bucket's public access block
+	SupplementaryConfiguration map[string]interface{} `json:"supplementaryConfiguration,omitempty"`
 }
 
 // FlexibleTags handles both map[string]string and array formats from AWS Config
@@ -78,10 +99,12 @@ func (ft *FlexibleTags) UnmarshalJSON(data []byte) error {
 // PolicyDocument represents IAM policies and resource policies
 type PolicyDocument struct {
 	PolicyName     string                 `json:"policyName"`
-	PolicyType     string                 `json:"policyType"` // IAM_MANAGED, etc.
+	PolicyType     string                 `json:"policyType"` // One of the PolicyType constants
 	PolicyDocument map[string]interface{} `json:"policyDocument"`
 	AttachedTo     []string               `json:"attachedTo"`
 	ResourceArn    string                 `json:"resourceArn"`
+	// BoundaryFor lists the ARNs of the users and roles the policy is the permissions boundary of
+	BoundaryFor []string `json:"boundaryFor,omitempty"`
 }
 
 // ComplianceRule represents AWS Config rules and their compliance status
@@ -111,6 +134,9 @@ type ResourceSummary struct {
 	ComplianceStatus  map[string]int `json:"complianceStatus"`
 	PolicyCount       int            `json:"policyCount"`
 	ConfigRulesCount  int            `json:"configRulesCount"`
+
+	// ResourcesByAccount is set when resources were queried across an organization's accounts
+	ResourcesByAccount map[string]int `json:"resourcesByAccount,omitempty"`
 }
 
 // Relationship represents resource relationships
@@ -124,12 +150,17 @@ type Relationship struct {
 // ConfigService provides methods to interact with AWS Config
 type ConfigService struct {
 	client *configservice.Client
+	// pool fans the per-type, per-rule and per-policy calls of a scan out in parallel
+	pool *workerPool
+	// aggregator is the Config aggregator resource queries go through, if useAggregator found one
+	aggregator string
 }
 
 // NewConfigService creates a new ConfigService instance
 func NewConfigService(cfg aws.Config) *ConfigService {
 	return &ConfigService{
 		client: configservice.NewFromConfig(cfg),
+		pool:   newWorkerPool(inventoryConcurrencyFromEnv()),
 	}
 }
 
@@ -367,19 +398,36 @@ func (cs *ConfigService) createMissingDeliveryChannel(ctx context.Context, chann
 // getResourceCount gets a simple count of resources to verify Config is working
 func (cs *ConfigService) getResourceCount(ctx context.Context) (int, error) {
 	query := "SELECT COUNT(*)"
-	input := &configservice.SelectResourceConfigInput{
-		Expression: aws.String(query),
-	}
+	var results []string
+	if cs.aggregator != "" {
+		result, err := cs.client.SelectAggregateResourceConfig(ctx, &configservice.SelectAggregateResourceConfigInput{
+			ConfigurationAggregatorName: aws.String(cs.aggregator),
+			Expression:                  aws.String(query),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute aggregated count query: %w", err)
+		}
+		results = result.Results
+	} else {
+		input := &configservice.SelectResourceConfigInput{
+			Expression: aws.String(query),
+		}
 
-	result, err := cs.client.SelectResourceConfig(ctx, input)
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute count query: %w", err)
+		result, err := cs.client.SelectResourceConfig(ctx, input)
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute count query: %w", err)
+		}
+		results = result.Results
 	}
 
-	if len(result.Results) > 0 {
-		// Parse the count result
+	if len(results) > 0 {
+		// Parse the count result, a row like {"COUNT(*)":42}
+		var row map[string]int
+		if err := json.Unmarshal([]byte(results[0]), &row); err == nil {
+			return row["COUNT(*)"], nil
+		}
 		var count int
-		if _, err := fmt.Sscanf(result.Results[0], "%d", &count); err == nil {
+		if _, err := fmt.Sscanf(results[0], "%d", &count); err == nil {
 			return count, nil
 		}
 	}
@@ -395,7 +443,11 @@ func (cs *ConfigService) GetComprehensiveResourceInventory(ctx context.Context,
 		LastUpdated: time.Now(),
 	}
 
-	// Step 1: Discover all resources efficiently
+	// Step 1: Discover all resources efficiently, across regions and accounts when setup
+	// created an aggregator
+	cs.useAggregator(ctx)
+	// configErr is set when neither Config query could run
+	var configErr error
 	allResources, err := cs.getAllResourcesWithSQL(ctx)
 	if err != nil {
 		// Check if this is a "just started" scenario
@@ -407,9 +459,12 @@ func (cs *ConfigService) GetComprehensiveResourceInventory(ctx context.Context,
 			log.Printf("[ConfigService] SQL approach failed: %v, trying ListDiscoveredResources fallback...", err)
 		}
 
+		// ListDiscoveredResources only covers the home region
+		cs.aggregator = ""
 		allResources, err = cs.getAllResourcesWithListAPI(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("both SQL and List API approaches failed: %w", err)
+			configErr = fmt.Errorf("both SQL and List API approaches failed: %w", err)
+			log.Printf("[ConfigService] %v", configErr)
 		}
 
 		// If fallback succeeded but SQL failed due to just started recorders
@@ -417,7 +472,20 @@ func (cs *ConfigService) GetComprehensiveResourceInventory(ctx context.Context,
 			log.Printf("[ConfigService] ✅ ListDiscoveredResources found %d resources while Config is initializing", len(allResources))
 		}
 	}
+
+	// Step 1b: Read resources from the services themselves while Config has nothing recorded
+	if len(allResources) == 0 {
+		log.Println("[ConfigService] AWS Config returned no resources, collecting them directly...")
+		allResources, err = cs.CollectResourcesDirectly(ctx, cfg)
+		if err != nil {
+			if configErr != nil {
+				return nil, configErr
+			}
+			log.Printf("[ConfigService] Warning: %v", err)
+		}
+	}
 	inventory.Resources = allResources
+	inventory.Aggregator = cs.aggregator
 
 	// Step 2: Get compliance rules and their evaluations
 	complianceRules, err := cs.GetComplianceRules(ctx)
@@ -435,6 +503,69 @@ func (cs *ConfigService) GetComprehensiveResourceInventory(ctx context.Context,
 		inventory.Policies = policies
 	}
 
+	// Step 3b: Audit Secrets Manager secrets and SSM parameters
+	secretsAudit, err := cs.AuditSecrets(ctx, cfg)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to audit secrets: %v", err)
+	} else {
+		inventory.Secrets = secretsAudit.Secrets
+		inventory.Parameters = secretsAudit.Parameters
+		inventory.ComplianceRules = append(inventory.ComplianceRules, secretsAudit.Rules...)
+	}
+
+	// Step 3c: Collect ECR repositories and image scan findings
+	repositories, ecrRules, err := cs.AuditECR(ctx, cfg, inventory.Resources)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to audit ECR: %v", err)
+	} else {
+		inventory.ECRRepositories = repositories
+		inventory.ComplianceRules = append(inventory.ComplianceRules, ecrRules...)
+	}
+
+	// Step 3d: Check WAF and Shield coverage of internet-facing resources
+	wafAudit, err := cs.AuditWAF(ctx, cfg, inventory.Resources)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to audit WAF: %v", err)
+	} else {
+		inventory.WebACLs = wafAudit.WebACLs
+		inventory.EdgeProtection = wafAudit.EdgeProtection
+		inventory.ComplianceRules = append(inventory.ComplianceRules, wafAudit.Rules...)
+	}
+
+	// Step 3e: Check which API Gateway and AppSync APIs are exposed and how they are protected
+	exposure, apiRules, err := cs.AuditAPIExposure(ctx, cfg)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to audit API exposure: %v", err)
+	} else {
+		inventory.PublicExposure = exposure
+		inventory.ComplianceRules = append(inventory.ComplianceRules, apiRules...)
+	}
+
+	// Step 3f: Check SNS, SQS, Lambda and KMS resource policies for access outside the account
+	resourcePolicies, policyRules, err := cs.AuditResourcePolicies(ctx, cfg)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to audit resource policies: %v", err)
+	} else {
+		inventory.ResourcePolicies = resourcePolicies
+		inventory.ComplianceRules = append(inventory.ComplianceRules, policyRules...)
+	}
+
+	// Step 3g: Find AMIs and EBS snapshots shared with everyone, which Config does not record
+	artifacts, err := cs.ListPublicArtifacts(ctx, cfg, inventory.Resources)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to list public artifacts: %v", err)
+	} else {
+		inventory.PublicArtifacts = artifacts
+	}
+
+	// Step 3h: Read when IAM users last signed in or used an access key, which Config does not record
+	activity, err := cs.GetIAMUserActivity(ctx, cfg)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to get IAM user activity: %v", err)
+	} else {
+		inventory.UserActivity = activity
+	}
+
 	// Step 4: Generate a summary of the collected data
 	inventory.ResourceSummary = cs.GenerateResourceSummary(inventory)
 
@@ -476,6 +607,14 @@ func (cs *ConfigService) getAllResourcesWithSQL(ctx context.Context) ([]Configur
 		log.Printf("[ConfigService] Simple count query failed: %v", err)
 		return nil, fmt.Errorf("config service not ready: %w", err)
 	}
+	if count == 0 && cs.aggregator != "" {
+		// The aggregator may still be collecting; the account's own Config may already have data
+		log.Println("[ConfigService] Aggregator reports no resources yet, querying the home region instead")
+		cs.aggregator = ""
+		if count, err = cs.getResourceCount(ctx); err != nil {
+			return nil, fmt.Errorf("config service not ready: %w", err)
+		}
+	}
 	log.Printf("[ConfigService] Config reports %d total resources available", count)
 
 	if count == 0 {
@@ -493,41 +632,25 @@ func (cs *ConfigService) getAllResourcesWithSQL(ctx context.Context) ([]Configur
 	// AWS Config SQL syntax - no FROM clause needed
 	query := `SELECT 
 		resourceId, 
+		accountId, 
 		resourceType, 
 		resourceName, 
 		awsRegion, 
 		availabilityZone, 
 		configuration, 
+		supplementaryConfiguration, 
 		configurationItemStatus, 
 		configurationStateId, 
+		configurationItemCaptureTime, 
 		resourceCreationTime, 
 		tags, 
 		relationships`
 
 	log.Printf("[ConfigService] Executing SQL query: %s", query)
 
-	input := &configservice.SelectResourceConfigInput{
-		Expression: aws.String(query),
-	}
-
-	paginator := configservice.NewSelectResourceConfigPaginator(cs.client, input)
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get next page of resource configurations: %w", err)
-		}
-
-		for _, resultString := range page.Results {
-			var item ConfigurationItem
-			err := json.Unmarshal([]byte(resultString), &item)
-			if err != nil {
-				log.Printf("[ConfigService] Warning: failed to unmarshal resource configuration: %v", err)
-				log.Printf("[ConfigService] Raw result string: %s", resultString)
-				continue
-			}
-			resources = append(resources, item)
-		}
+	resources, err = cs.selectResources(ctx, query)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Printf("[ConfigService] Successfully fetched %d resources via SQL query.", len(resources))
@@ -567,33 +690,22 @@ func (cs *ConfigService) getAllResourcesWithListAPI(ctx context.Context) ([]Conf
 		"AWS::CloudFormation::Stack",
 	}
 
-	for _, resourceType := range resourceTypes {
-		log.Printf("[ConfigService] Discovering resources of type: %s", resourceType)
-
-		input := &configservice.ListDiscoveredResourcesInput{
-			ResourceType: types.ResourceType(resourceType),
-		}
-
-		paginator := configservice.NewListDiscoveredResourcesPaginator(cs.client, input)
-
-		for paginator.HasMorePages() {
-			page, err := paginator.NextPage(ctx)
-			if err != nil {
-				log.Printf("[ConfigService] Warning: failed to list resources of type %s: %v", resourceType, err)
-				continue
-			}
-
-			for _, resource := range page.ResourceIdentifiers {
-				// Convert discovered resource to ConfigurationItem
-				item := ConfigurationItem{
-					ResourceID:   aws.ToString(resource.ResourceId),
-					ResourceType: string(resource.ResourceType),
-					ResourceName: aws.ToString(resource.ResourceName),
-					Tags:         make(FlexibleTags), // Initialize empty tags
-				}
-				allResources = append(allResources, item)
-			}
+	// Each type is listed in parallel; results are kept in the order of resourceTypes
+	byType := make([][]ConfigurationItem, len(resourceTypes))
+	errs := cs.pool.run(ctx, len(resourceTypes), func(ctx context.Context, i int) error {
+		log.Printf("[ConfigService] Discovering resources of type: %s", resourceTypes[i])
+		var err error
+		byType[i], err = cs.listDiscoveredResources(ctx, resourceTypes[i])
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[ConfigService] Warning: failed to list resources of type %s: %v", resourceTypes[i], err)
 		}
+		allResources = append(allResources, byType[i]...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	log.Printf("[ConfigService] Found %d resources using ListDiscoveredResources API", len(allResources))
@@ -618,6 +730,33 @@ func (cs *ConfigService) getAllResourcesWithListAPI(ctx context.Context) ([]Conf
 	return allResources, nil
 }
 
+// listDiscoveredResources lists every resource of one type AWS Config has discovered. The
+// resources found before a failed page are returned with the error.
+func (cs *ConfigService) listDiscoveredResources(ctx context.Context, resourceType string) ([]ConfigurationItem, error) {
+	var resources []ConfigurationItem
+	input := &configservice.ListDiscoveredResourcesInput{
+		ResourceType: types.ResourceType(resourceType),
+	}
+	paginator := configservice.NewListDiscoveredResourcesPaginator(cs.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return resources, err
+		}
+
+		for _, resource := range page.ResourceIdentifiers {
+			// Convert discovered resource to ConfigurationItem
+			resources = append(resources, ConfigurationItem{
+				ResourceID:   aws.ToString(resource.ResourceId),
+				ResourceType: string(resource.ResourceType),
+				ResourceName: aws.ToString(resource.ResourceName),
+				Tags:         make(FlexibleTags), // Initialize empty tags
+			})
+		}
+	}
+	return resources, nil
+}
+
 // diagnoseConfigStatus checks the current state of AWS Config service
 func (cs *ConfigService) diagnoseConfigStatus(ctx context.Context) error {
 	log.Println("[ConfigService] 🔍 Diagnosing AWS Config service status...")
@@ -714,7 +853,7 @@ func (cs *ConfigService) tryBroadResourceDiscovery(ctx context.Context) ([]Confi
 // GetComplianceRules retrieves all AWS Config rules and their compliance status
 func (cs *ConfigService) GetComplianceRules(ctx context.Context) ([]ComplianceRule, error) {
 	log.Println("[ConfigService] Fetching compliance rules...")
-	var rules []ComplianceRule
+	var configRules []types.ConfigRule
 	input := &configservice.DescribeConfigRulesInput{}
 	paginator := configservice.NewDescribeConfigRulesPaginator(cs.client, input)
 
@@ -723,30 +862,41 @@ func (cs *ConfigService) GetComplianceRules(ctx context.Context) ([]ComplianceRu
 		if err != nil {
 			return nil, fmt.Errorf("failed to describe config rules: %w", err)
 		}
+		configRules = append(configRules, page.ConfigRules...)
+	}
 
-		for _, rule := range page.ConfigRules {
-			// Get detailed compliance for each rule
-			complianceDetails, err := cs.getRuleCompliance(ctx, aws.ToString(rule.ConfigRuleName))
-			if err != nil {
-				log.Printf("[ConfigService] Warning: could not get compliance for rule %s: %v", aws.ToString(rule.ConfigRuleName), err)
-				continue
-			}
+	// Get detailed compliance for each rule in parallel, keeping the order rules were described in
+	details := make([]*ComplianceRule, len(configRules))
+	errs := cs.pool.run(ctx, len(configRules), func(ctx context.Context, i int) error {
+		var err error
+		details[i], err = cs.getRuleCompliance(ctx, aws.ToString(configRules[i].ConfigRuleName))
+		return err
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-			// Determine resource type scope
-			var resourceTypesStr = "ALL"
-			if rule.Scope != nil && len(rule.Scope.ComplianceResourceTypes) > 0 {
-				resourceTypesStr = strings.Join(rule.Scope.ComplianceResourceTypes, ",")
-			}
+	var rules []ComplianceRule
+	for i, rule := range configRules {
+		if errs[i] != nil {
+			log.Printf("[ConfigService] Warning: could not get compliance for rule %s: %v", aws.ToString(rule.ConfigRuleName), errs[i])
+			continue
+		}
 
-			complianceRule := ComplianceRule{
-				ConfigRuleName:    aws.ToString(rule.ConfigRuleName),
-				Source:            string(rule.Source.Owner),
-				ResourceType:      resourceTypesStr,
-				ComplianceType:    complianceDetails.ComplianceType,
-				EvaluationResults: complianceDetails.EvaluationResults,
-			}
-			rules = append(rules, complianceRule)
+		// Determine resource type scope
+		var resourceTypesStr = "ALL"
+		if rule.Scope != nil && len(rule.Scope.ComplianceResourceTypes) > 0 {
+			resourceTypesStr = strings.Join(rule.Scope.ComplianceResourceTypes, ",")
+		}
+
+		complianceRule := ComplianceRule{
+			ConfigRuleName:    aws.ToString(rule.ConfigRuleName),
+			Source:            string(rule.Source.Owner),
+			ResourceType:      resourceTypesStr,
+			ComplianceType:    details[i].ComplianceType,
+			EvaluationResults: details[i].EvaluationResults,
 		}
+		rules = append(rules, complianceRule)
 	}
 	log.Printf("[ConfigService] Successfully fetched %d compliance rules.", len(rules))
 	return rules, nil
@@ -801,69 +951,6 @@ func (cs *ConfigService) getRuleCompliance(ctx context.Context, ruleName string)
 	return compliance, nil
 }
 
-// GetIAMPolicies retrieves all customer-managed IAM policies in the account
-func (cs *ConfigService) GetIAMPolicies(ctx context.Context, cfg aws.Config) ([]PolicyDocument, error) {
-	log.Println("[ConfigService] Fetching IAM policies...")
-	iamClient := iam.NewFromConfig(cfg)
-	var policies []PolicyDocument
-
-	input := &iam.ListPoliciesInput{
-		Scope: iamtypes.PolicyScopeTypeLocal, // Only customer-managed policies
-	}
-
-	paginator := iam.NewListPoliciesPaginator(iamClient, input)
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to list managed policies: %w", err)
-		}
-
-		for _, policy := range page.Policies {
-			policyDoc, err := cs.getPolicyDocument(ctx, iamClient, aws.ToString(policy.Arn), aws.ToString(policy.DefaultVersionId))
-			if err != nil {
-				log.Printf("[ConfigService] Warning: failed to get policy document for %s: %v", aws.ToString(policy.Arn), err)
-				continue
-			}
-
-			policies = append(policies, PolicyDocument{
-				PolicyName:     aws.ToString(policy.PolicyName),
-				PolicyType:     "IAM_MANAGED",
-				PolicyDocument: policyDoc,
-				ResourceArn:    aws.ToString(policy.Arn),
-			})
-		}
-	}
-	log.Printf("[ConfigService] Successfully fetched %d IAM policies.", len(policies))
-	return policies, nil
-}
-
-// getPolicyDocument retrieves and parses the JSON document for a given policy version.
-func (cs *ConfigService) getPolicyDocument(ctx context.Context, iamClient *iam.Client, policyArn, versionId string) (map[string]interface{}, error) {
-	versionInput := &iam.GetPolicyVersionInput{
-		PolicyArn: aws.String(policyArn),
-		VersionId: aws.String(versionId),
-	}
-
-	version, err := iamClient.GetPolicyVersion(ctx, versionInput)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get policy version: %w", err)
-	}
-
-	// The policy document is URL-encoded JSON. It must be decoded first.
-	decodedDoc, err := url.QueryUnescape(aws.ToString(version.PolicyVersion.Document))
-	if err != nil {
-		return nil, fmt.Errorf("failed to URL-decode policy document: %w", err)
-	}
-
-	var policyDoc map[string]interface{}
-	err = json.Unmarshal([]byte(decodedDoc), &policyDoc)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse policy document JSON: %w", err)
-	}
-
-	return policyDoc, nil
-}
-
 // GenerateResourceSummary creates a summary of the resource inventory
 func (cs *ConfigService) GenerateResourceSummary(inventory *ResourceInventory) ResourceSummary {
 	summary := ResourceSummary{
@@ -878,6 +965,12 @@ func (cs *ConfigService) GenerateResourceSummary(inventory *ResourceInventory) R
 	for _, resource := range inventory.Resources {
 		summary.ResourcesByType[resource.ResourceType]++
 		summary.ResourcesByRegion[resource.Region]++
+		if resource.AccountID != "" {
+			if summary.ResourcesByAccount == nil {
+				summary.ResourcesByAccount = make(map[string]int)
+			}
+			summary.ResourcesByAccount[resource.AccountID]++
+		}
 	}
 
 	return summary
@@ -911,7 +1004,8 @@ func (cs *ConfigService) CheckConfigStatus(ctx context.Context) error {
 	return nil
 }
 
-// GetResourcesByType retrieves resources filtered by specific resource types
+// GetResourcesByType retrieves resources filtered by specific resource types, which must be
+// types AWS Config records
 func (cs *ConfigService) GetResourcesByType(ctx context.Context, resourceTypes []string) ([]ConfigurationItem, error) {
 	log.Printf("[ConfigService] Fetching resources for types: %v", resourceTypes)
 
@@ -919,58 +1013,22 @@ func (cs *ConfigService) GetResourcesByType(ctx context.Context, resourceTypes [
 		return []ConfigurationItem{}, nil
 	}
 
-	var resources []ConfigurationItem
-
-	// Build SQL query with resource type filter
-	typeFilter := make([]string, len(resourceTypes))
-	for i, rt := range resourceTypes {
-		typeFilter[i] = fmt.Sprintf("'%s'", rt)
-	}
-
-	query := fmt.Sprintf(`SELECT 
-		resourceId, 
-		resourceType, 
-		resourceName, 
-		awsRegion, 
-		availabilityZone, 
-		configuration, 
-		configurationItemStatus, 
-		configurationStateId, 
-		resourceCreationTime, 
-		tags, 
-		relationships 
-	WHERE 
-		resourceType IN (%s)`, strings.Join(typeFilter, ","))
-
-	input := &configservice.SelectResourceConfigInput{
-		Expression: aws.String(query),
-	}
-
-	paginator := configservice.NewSelectResourceConfigPaginator(cs.client, input)
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get next page of resource configurations: %w", err)
-		}
-
-		for _, resultString := range page.Results {
-			var item ConfigurationItem
-			err := json.Unmarshal([]byte(resultString), &item)
-			if err != nil {
-				log.Printf("[ConfigService] Warning: failed to unmarshal resource configuration: %v", err)
-				continue
-			}
-			resources = append(resources, item)
-		}
+	resources, err := cs.FindResources(ctx, ResourceQuery{ResourceTypes: resourceTypes})
+	if err != nil {
+		return nil, err
 	}
 
 	log.Printf("[ConfigService] Successfully fetched %d resources for specified types.", len(resources))
 	return resources, nil
 }
 
-// createConfigServiceRole creates an IAM role for AWS Config service
-func (s *CloudTrailService) createConfigServiceRole(ctx context.Context, cfg aws.Config, accountID string) (string, error) {
+// configRecordingPolicy is the AWS managed policy that lets AWS Config read the configuration
+// of the resources it records. It is read-only, and the narrowest policy Config can record with.
+const configRecordingPolicy = "arn:aws:iam::aws:policy/service-role/AWS_ConfigRole"
+
+// createConfigServiceRole creates an IAM role for AWS Config service, or updates the existing
+// one. Besides reading resource configurations, the role may only deliver to the log bucket.
+func (s *CloudTrailService) createConfigServiceRole(ctx context.Context, cfg aws.Config, bucketName, accountID string) (string, error) {
 	fmt.Println("[AWS Config] Creating Config service role...")
 
 	iamClient := iam.NewFromConfig(cfg)
@@ -982,11 +1040,9 @@ func (s *CloudTrailService) createConfigServiceRole(ctx context.Context, cfg aws
 	_, err := iamClient.GetRole(ctx, getRoleInput)
 	if err == nil {
 		fmt.Printf("[AWS Config] Role already exists: %s\n", roleArn)
-		return roleArn, nil
-	}
-
-	// Trust policy for AWS Config service
-	trustPolicy := `{
+	} else {
+		// Trust policy for AWS Config service
+		trustPolicy := `{
 		"Version": "2012-10-17",
 		"Statement": [
 			{
@@ -999,47 +1055,66 @@ func (s *CloudTrailService) createConfigServiceRole(ctx context.Context, cfg aws
 		]
 	}`
 
-	// Create the role
-	createRoleInput := &iam.CreateRoleInput{
-		RoleName:                 aws.String(roleName),
-		AssumeRolePolicyDocument: aws.String(trustPolicy),
-		Description:              aws.String("CloudLoom AWS Config service role"),
-	}
+		// Create the role
+		createRoleInput := &iam.CreateRoleInput{
+			RoleName:                 aws.String(roleName),
+			AssumeRolePolicyDocument: aws.String(trustPolicy),
+			Description:              aws.String("CloudLoom AWS Config service role"),
+		}
 
-	_, err = iamClient.CreateRole(ctx, createRoleInput)
-	if err != nil {
-		return "", fmt.Errorf("failed to create Config service role: %w", err)
+		_, err = iamClient.CreateRole(ctx, createRoleInput)
+		if err != nil {
+			return "", fmt.Errorf("failed to create Config service role: %w", err)
+		}
 	}
+	s.tagRole(ctx, iamClient, roleName)
 
-	// Attach the AWS managed policy for Config service
-	attachPolicyInput := &iam.AttachRolePolicyInput{
+	// Attach the AWS managed policy for recording, and drop the deprecated ConfigRole policy
+	// earlier setups attached
+	_, err = iamClient.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
 		RoleName:  aws.String(roleName),
-		PolicyArn: aws.String("arn:aws:iam::aws:policy/service-role/ConfigRole"),
-	}
-
-	_, err = iamClient.AttachRolePolicy(ctx, attachPolicyInput)
+		PolicyArn: aws.String(configRecordingPolicy),
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to attach Config service policy: %w", err)
 	}
-
-	// Also attach the S3 delivery permissions policy
-	s3PolicyInput := &iam.AttachRolePolicyInput{
-		RoleName:  aws.String(roleName),
-		PolicyArn: aws.String("arn:aws:iam::aws:policy/service-role/AWS_ConfigRole"),
+	if err := detachManagedPolicies(ctx, iamClient, roleName, configRecordingPolicy); err != nil {
+		return "", err
 	}
 
-	_, err = iamClient.AttachRolePolicy(ctx, s3PolicyInput)
+	// Allow delivery to the log bucket only
+	deliveryPolicy := fmt.Sprintf(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Effect": "Allow",
+				"Action": "s3:PutObject",
+				"Resource": "arn:aws:s3:::%s/AWSLogs/%s/*",
+				"Condition": {"StringLike": {"s3:x-amz-acl": "bucket-owner-full-control"}}
+			},
+			{
+				"Effect": "Allow",
+				"Action": "s3:GetBucketAcl",
+				"Resource": "arn:aws:s3:::%s"
+			}
+		]
+	}`, bucketName, accountID, bucketName)
+	_, err = iamClient.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String("CloudLoom-Config-DeliveryPolicy"),
+		PolicyDocument: aws.String(deliveryPolicy),
+	})
 	if err != nil {
-		fmt.Printf("[AWS Config] Warning: failed to attach S3 delivery policy: %v\n", err)
-		// Don't fail completely if this policy attachment fails
+		return "", fmt.Errorf("failed to put Config delivery policy: %w", err)
 	}
 
-	fmt.Printf("[AWS Config] Config service role created: %s\n", roleArn)
+	fmt.Printf("[AWS Config] Config service role ready: %s\n", roleArn)
 	return roleArn, nil
 }
 
-// createConfigurationRecorder creates an AWS Config configuration recorder
-func (s *CloudTrailService) createConfigurationRecorder(ctx context.Context, cfg aws.Config, recorderName, roleArn string) error {
+// createConfigurationRecorder creates an AWS Config configuration recorder. It records the
+// resource types in the tenant's desired state, or every supported type when none are set.
+func (s *CloudTrailService) createConfigurationRecorder(ctx context.Context, cfg aws.Config, recorderName, roleArn, tenantID string) error {
 	fmt.Printf("[AWS Config] Creating configuration recorder: %s\n", recorderName)
 
 	configClient := configservice.NewFromConfig(cfg)
@@ -1059,15 +1134,21 @@ func (s *CloudTrailService) createConfigurationRecorder(ctx context.Context, cfg
 		}
 	}
 
+	var desired *accountconfig.Recorder
+	if store := accountconfig.Default(); store != nil {
+		if state, err := store.Get(ctx, tenantID); err == nil {
+			desired = state.Spec.Recorder
+		}
+	}
+	group, mode := recordingGroup(desired)
+
 	// Create the configuration recorder
 	createInput := &configservice.PutConfigurationRecorderInput{
 		ConfigurationRecorder: &types.ConfigurationRecorder{
-			Name:    aws.String(recorderName),
-			RoleARN: aws.String(roleArn),
-			RecordingGroup: &types.RecordingGroup{
-				AllSupported:               true,
-				IncludeGlobalResourceTypes: true,
-			},
+			Name:           aws.String(recorderName),
+			RoleARN:        aws.String(roleArn),
+			RecordingGroup: group,
+			RecordingMode:  mode,
 		},
 	}
 
@@ -1155,73 +1236,44 @@ func (s *CloudTrailService) startConfigurationRecorder(ctx context.Context, cfg
 	return nil
 }
 
+// basicConfigRules are the rules setup creates, by name, from the managed rule catalog
+var basicConfigRules = []ConfigRuleSpec{
+	{Name: "root-user-access-key-check", SourceIdentifier: "IAM_ROOT_ACCESS_KEY_CHECK"},
+	{Name: "s3-bucket-public-access-prohibited", SourceIdentifier: "S3_BUCKET_LEVEL_PUBLIC_ACCESS_PROHIBITED"},
+	{Name: "encrypted-volumes", SourceIdentifier: "ENCRYPTED_VOLUMES"},
+}
+
 // createBasicConfigRules creates basic AWS Config compliance rules
 func (s *CloudTrailService) createBasicConfigRules(ctx context.Context, cfg aws.Config, accountID string) error {
 	fmt.Println("[AWS Config] Creating basic Config rules...")
 
 	configClient := configservice.NewFromConfig(cfg)
 
-	// List of basic Config rules to create
-	basicRules := []struct {
-		name        string
-		source      string
-		description string
-	}{
-		{
-			name:        "root-user-access-key-check",
-			source:      "AWS_CONFIG_RULE",
-			description: "Checks whether the root access key is available",
-		},
-		{
-			name:        "s3-bucket-public-access-prohibited",
-			source:      "AWS_CONFIG_RULE",
-			description: "Checks if S3 buckets prohibit public access",
-		},
-		{
-			name:        "encrypted-volumes",
-			source:      "AWS_CONFIG_RULE",
-			description: "Checks whether EBS volumes are encrypted",
-		},
-	}
-
 	// Get existing rules to avoid duplicates
-	listInput := &configservice.DescribeConfigRulesInput{}
-	listResult, err := configClient.DescribeConfigRules(ctx, listInput)
+	existingRules, err := listConfigRuleNames(ctx, configClient)
 	if err != nil {
-		return fmt.Errorf("failed to list existing config rules: %w", err)
-	}
-
-	existingRules := make(map[string]bool)
-	for _, rule := range listResult.ConfigRules {
-		existingRules[aws.ToString(rule.ConfigRuleName)] = true
+		return err
 	}
 
 	// Create each rule if it doesn't exist
-	for _, rule := range basicRules {
-		if existingRules[rule.name] {
-			fmt.Printf("[AWS Config] Rule already exists: %s\n", rule.name)
+	manager := NewConfigRuleManager(cfg)
+	for _, rule := range basicConfigRules {
+		if existingRules[rule.Name] {
+			fmt.Printf("[AWS Config] Rule already exists: %s\n", rule.Name)
 			continue
 		}
 
-		putRuleInput := &configservice.PutConfigRuleInput{
-			ConfigRule: &types.ConfigRule{
-				ConfigRuleName: aws.String(rule.name),
-				Description:    aws.String(rule.description),
-				Source: &types.Source{
-					Owner:            types.OwnerAws,
-					SourceIdentifier: aws.String(rule.name),
-				},
-			},
+		managedRule, err := rule.validate()
+		if err == nil {
+			err = manager.put(ctx, rule, managedRule)
 		}
-
-		_, err = configClient.PutConfigRule(ctx, putRuleInput)
 		if err != nil {
-			fmt.Printf("[AWS Config] Warning: Failed to create rule %s: %v\n", rule.name, err)
+			fmt.Printf("[AWS Config] Warning: Failed to create rule %s: %v\n", rule.Name, err)
 			// Continue with other rules even if one fails
 			continue
 		}
 
-		fmt.Printf("[AWS Config] Created Config rule: %s\n", rule.name)
+		fmt.Printf("[AWS Config] Created Config rule: %s\n", rule.Name)
 	}
 
 	fmt.Println("[AWS Config] Basic Config rules setup completed")
@@ -1314,39 +1366,39 @@ func (s *CloudTrailService) collectBasicResourceInfo(ctx context.Context, cfg aw
 	return nil
 }
 
-// collectEC2Resources collects EC2 instances, volumes, and security groups (placeholder)
+// collectEC2Resources collects EC2 instances, volumes, security groups and VPC networking
 func (s *CloudTrailService) collectEC2Resources(ctx context.Context, cfg aws.Config) (int, error) {
-	// TODO: Implement actual EC2 resource collection when ec2 service is added to dependencies
-	// This would use:
-	// - ec2.DescribeInstances for EC2 instances
-	// - ec2.DescribeVolumes for EBS volumes
-	// - ec2.DescribeSecurityGroups for security groups
-	// - ec2.DescribeVpcs for VPCs
-	// - ec2.DescribeSubnets for subnets
-
-	fmt.Println("[Infrastructure] EC2: Using placeholder enumeration (requires adding ec2 SDK dependency)")
-	return 0, nil // Return 0 count for now
+	resources, err := NewConfigService(cfg).collectEC2(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	byType := map[string]int{}
+	for _, resource := range resources {
+		byType[resource.ResourceType]++
+	}
+	for resourceType, count := range byType {
+		fmt.Printf("[Infrastructure] EC2: Found %d %s\n", count, resourceType)
+	}
+
+	return len(resources), nil
 }
 
 // collectS3Resources collects S3 buckets and their configurations
 func (s *CloudTrailService) collectS3Resources(ctx context.Context, cfg aws.Config) (int, error) {
-	s3Client := s3.NewFromConfig(cfg)
-
-	// List all S3 buckets
-	listBucketsInput := &s3.ListBucketsInput{}
-	result, err := s3Client.ListBuckets(ctx, listBucketsInput)
+	buckets, err := NewConfigService(cfg).collectS3Buckets(ctx, cfg)
 	if err != nil {
-		return 0, fmt.Errorf("failed to list S3 buckets: %w", err)
+		return 0, err
 	}
 
-	bucketCount := len(result.Buckets)
-	for _, bucket := range result.Buckets {
-		fmt.Printf("[Infrastructure] S3: Found bucket %s (created: %v)\n",
-			aws.ToString(bucket.Name),
-			aws.ToTime(bucket.CreationDate))
+	for _, bucket := range buckets {
+		_, encrypted := bucket.SupplementaryConfiguration["ServerSideEncryptionConfiguration"]
+		versioning, _ := bucket.SupplementaryConfiguration["BucketVersioningConfiguration"].(map[string]interface{})
+		fmt.Printf("[Infrastructure] S3: Found bucket %s in %s (created: %v, encrypted: %t, versioning: %s)\n",
+			bucket.ResourceName, bucket.Region, aws.ToTime(bucket.ResourceCreationTime), encrypted, stringValue(versioning["status"]))
 	}
 
-	return bucketCount, nil
+	return len(buckets), nil
 }
 
 // collectIAMResources collects IAM users, roles, and policies
@@ -1401,25 +1453,37 @@ func (s *CloudTrailService) collectIAMResources(ctx context.Context, cfg aws.Con
 	return totalCount, nil
 }
 
-// collectRDSResources collects RDS instances and clusters (placeholder)
+// collectRDSResources collects RDS instances, clusters and manual snapshots
 func (s *CloudTrailService) collectRDSResources(ctx context.Context, cfg aws.Config) (int, error) {
-	// TODO: Implement actual RDS resource collection when rds service is added to dependencies
-	// This would use:
-	// - rds.DescribeDBInstances for RDS instances
-	// - rds.DescribeDBClusters for RDS clusters
-	// - rds.DescribeDBSnapshots for snapshots
-
-	fmt.Println("[Infrastructure] RDS: Using placeholder enumeration (requires adding rds SDK dependency)")
-	return 0, nil // Return 0 count for now
+	resources, err := NewConfigService(cfg).collectRDS(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, resource := range resources {
+		if resource.ResourceType != "AWS::RDS::DBInstance" {
+			continue
+		}
+		publiclyAccessible, _ := configValue(resource.Configuration, "publiclyAccessible").(bool)
+		encrypted, _ := configValue(resource.Configuration, "storageEncrypted").(bool)
+		fmt.Printf("[Infrastructure] RDS: Found instance %s in %s (encrypted: %t, public: %t)\n",
+			resource.ResourceName, resource.Region, encrypted, publiclyAccessible)
+	}
+
+	return len(resources), nil
 }
 
-// collectLambdaResources collects Lambda functions (placeholder)
+// collectLambdaResources collects Lambda functions
 func (s *CloudTrailService) collectLambdaResources(ctx context.Context, cfg aws.Config) (int, error) {
-	// TODO: Implement actual Lambda resource collection when lambda service is added to dependencies
-	// This would use:
-	// - lambda.ListFunctions for Lambda functions
-	// - lambda.ListLayers for Lambda layers
+	functions, err := NewConfigService(cfg).collectLambda(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, function := range functions {
+		fmt.Printf("[Infrastructure] Lambda: Found function %s in %s (runtime: %s)\n",
+			function.ResourceName, function.Region, stringValue(configValue(function.Configuration, "runtime")))
+	}
 
-	fmt.Println("[Infrastructure] Lambda: Using placeholder enumeration (requires adding lambda SDK dependency)")
-	return 0, nil // Return 0 count for now
+	return len(functions), nil
 }
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/deadletters"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/queuemonitor"
+)
+
+// consumeDeadLetters moves what reaches the dead-letter queue of a tenant's queue into the dead
+// letter store until ctx is cancelled. Messages are deleted from the dead-letter queue once
+// stored, so they stay available after the queue's retention ends.
+func consumeDeadLetters(ctx context.Context, cfg aws.Config, queueURL, accountID string) {
+	store := deadletters.Default()
+	if store == nil {
+		return
+	}
+	sqsClient := sqs.NewFromConfig(cfg)
+	deadLetterURL := deadLetterQueueURL(queueURL)
+	fmt.Printf("[Dead Letters] Consuming dead-letter queue: %s\n", deadLetterURL)
+
+	for {
+		result, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(deadLetterURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameSentTimestamp,
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+			},
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		var missing *types.QueueDoesNotExist
+		if errors.As(err, &missing) {
+			// Queues set up before dead-lettering have none until setup runs again
+			log.Printf("[Dead Letters] No dead-letter queue for tenant %s, run setup again to create it", accountID)
+			return
+		}
+		if err != nil {
+			log.Printf("[Dead Letters] Error receiving messages: %v", err)
+			if awsconfig.SleepContext(ctx, 30*time.Second) != nil {
+				return
+			}
+			continue
+		}
+
+		// Finish storing a received batch even if consuming is stopped meanwhile
+		batchCtx := context.WithoutCancel(ctx)
+		for _, message := range result.Messages {
+			letter := deadLetterOf(accountID, queueURL, message)
+			if err := store.Record(batchCtx, letter); err != nil {
+				log.Printf("[Dead Letters] Warning: %v", err)
+				continue
+			}
+			log.Printf("[Dead Letters] Message %s of tenant %s was dead-lettered after %d receives", letter.MessageID, accountID, letter.ReceiveCount)
+			_, err := sqsClient.DeleteMessage(batchCtx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(deadLetterURL),
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			if err != nil {
+				log.Printf("[Dead Letters] Error deleting message: %v", err)
+			}
+		}
+	}
+}
+
+// deadLetterOf converts a message received from a dead-letter queue, reading the source and
+// detail type of the event it carries when it is one
+func deadLetterOf(accountID, queueURL string, message types.Message) *deadletters.DeadLetter {
+	letter := &deadletters.DeadLetter{
+		TenantID:       accountID,
+		MessageID:      aws.ToString(message.MessageId),
+		QueueURL:       queueURL,
+		Body:           aws.ToString(message.Body),
+		DeadLetteredAt: time.Now(),
+		Status:         deadletters.StatusPending,
+	}
+	if envelope, err := eventpipeline.Parse(letter.Body); err == nil {
+		letter.Source, letter.DetailType = envelope.Source, envelope.DetailType
+	}
+	if sentAt, ok := queuemonitor.SentTimestamp(message); ok {
+		letter.SentAt = &sentAt
+	}
+	letter.ReceiveCount, _ = strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	return letter
+}
+
+// RedriveDeadLetters sends the tenant's selected dead letters back to the queue they came from,
+// typically once the handler that failed on them is fixed. Each is sent as a new message, so
+// it is processed again rather than skipped as a redelivery.
+func RedriveDeadLetters(ctx context.Context, tenantID string, ids []string) (*EventBatchResult, error) {
+	store := deadletters.Default()
+	if store == nil {
+		return nil, fmt.Errorf("dead letter store is not initialized")
+	}
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	sqsClient := sqs.NewFromConfig(cfg)
+
+	result := newEventBatchResult()
+	for _, id := range ids {
+		letter, err := store.Get(ctx, tenantID, id)
+		if err != nil {
+			result.fail(id, err.Error())
+			continue
+		}
+		if letter.Status == deadletters.StatusRedriven {
+			result.fail(id, "already redriven")
+			continue
+		}
+		input := &sqs.SendMessageInput{
+			QueueUrl:    aws.String(letter.QueueURL),
+			MessageBody: aws.String(letter.Body),
+		}
+		if isFIFOQueue(letter.QueueURL) {
+			// The letter rejoins its region's group, and its own deduplication ID keeps SQS from
+			// dropping a body it received within the last 5 minutes
+			input.MessageGroupId = aws.String(messageGroup(letter.Body))
+			input.MessageDeduplicationId = aws.String(letter.ID.Hex())
+		}
+		_, err = sqsClient.SendMessage(ctx, input)
+		if err != nil {
+			result.fail(id, fmt.Sprintf("failed to send to queue: %v", err))
+			continue
+		}
+		if err := store.MarkRedriven(ctx, tenantID, letter.ID); err != nil {
+			// The message is back on the queue; only its status is stale
+			log.Printf("[Dead Letters] Warning: %v", err)
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	log.Printf("[Dead Letters] Redrove %d of %d dead letters for tenant %s", len(result.Succeeded), len(ids), tenantID)
+	return result, nil
+}
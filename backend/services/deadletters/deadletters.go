@@ -0,0 +1,148 @@
+package deadletters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionDeadLetters
+
+// Status is what has been done with a dead-lettered message
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusRedriven Status = "redriven"
+)
+
+// ErrNotFound is returned when a dead letter does not exist for the tenant
+var ErrNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message the tenant's queue moved to its dead-letter queue after the event
+// handlers failed on it too many times
+type DeadLetter struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID   string             `bson:"tenantId" json:"tenantId"`
+	MessageID  string             `bson:"messageId" json:"messageId"`
+	QueueURL   string             `bson:"queueUrl" json:"queueUrl"`
+	Source     string             `bson:"source,omitempty" json:"source,omitempty"`
+	DetailType string             `bson:"detailType,omitempty" json:"detailType,omitempty"`
+	Body       string             `bson:"body" json:"body"`
+	// ReceiveCount is how many times the message was received before it was dead-lettered
+	ReceiveCount   int        `bson:"receiveCount" json:"receiveCount"`
+	SentAt         *time.Time `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+	DeadLetteredAt time.Time  `bson:"deadLetteredAt" json:"deadLetteredAt"`
+	Status         Status     `bson:"status" json:"status"`
+	RedrivenAt     *time.Time `bson:"redrivenAt,omitempty" json:"redrivenAt,omitempty"`
+}
+
+// ListFilter narrows the dead letters returned by List
+type ListFilter struct {
+	TenantID string
+	Status   Status
+	Limit    int64
+}
+
+// Store persists the contents of the tenants' dead-letter queues in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide dead letter store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide dead letter store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the dead_letters collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Record stores a message read from a dead-letter queue. A message stored before, which a
+// dead-letter queue delivers again when deleting it failed, is stored once.
+func (s *Store) Record(ctx context.Context, letter *DeadLetter) error {
+	if letter.Status == "" {
+		letter.Status = StatusPending
+	}
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"tenantId": letter.TenantID, "messageId": letter.MessageID},
+		bson.M{"$setOnInsert": letter},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store dead letter %s: %w", letter.MessageID, err)
+	}
+	return nil
+}
+
+// List returns the tenant's dead letters matching the filter, most recent first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]DeadLetter, error) {
+	query := bson.M{"tenantId": filter.TenantID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "deadLetteredAt", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []DeadLetter{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letters: %w", err)
+	}
+	return result, nil
+}
+
+// Get returns one of the tenant's dead letters
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*DeadLetter, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var letter DeadLetter
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&letter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter %s: %w", id, err)
+	}
+	return &letter, nil
+}
+
+// MarkRedriven records that a dead letter was sent back to its queue
+func (s *Store) MarkRedriven(ctx context.Context, tenantID string, id primitive.ObjectID) error {
+	now := time.Now()
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "tenantId": tenantID},
+		bson.M{"$set": bson.M{"status": StatusRedriven, "redrivenAt": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update dead letter %s: %w", id.Hex(), err)
+	}
+	return nil
+}
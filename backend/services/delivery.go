@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"github.com/rishichirchi/cloudloom/services/tenantdata"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// Buffer sink names for deliveries to customer accounts
+const (
+	// SQSDeliverySink sends messages to customer SQS queues
+	SQSDeliverySink = "sqs"
+	// NotificationDeliverySink publishes notifications to the tenant's SNS topic. Its
+	// destination is the tenant ID, so each tenant's notifications keep their order.
+	NotificationDeliverySink = "sns"
+)
+
+// bufferedNotification is the payload of a notification waiting in the delivery buffer
+type bufferedNotification struct {
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+// RegisterDeliverySinks registers the AWS-backed delivery sinks with the overflow buffer
+func RegisterDeliverySinks(b *buffer.Buffer) {
+	b.RegisterSink(SQSDeliverySink, deliverToSQS)
+	b.RegisterSink(NotificationDeliverySink, deliverNotification)
+	b.RegisterSink(tenantdata.ExportDeliverySink, deliverToS3)
+}
+
+// deliverToSQS assumes the role of the account that owns the queue and sends the payload to it
+func deliverToSQS(ctx context.Context, tenantID, queueURL string, payload []byte) error {
+	if tenantID == "" {
+		tenantID = queueAccount(queueURL)
+	}
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if errors.Is(err, tenants.ErrNotFound) {
+		return buffer.Permanent(err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assume role for SQS delivery: %w", err)
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(payload)),
+	}
+	if isFIFOQueue(queueURL) {
+		input.MessageGroupId = aws.String(messageGroup(string(payload)))
+	}
+	_, err = sqs.NewFromConfig(cfg).SendMessage(ctx, input)
+	var missing *sqstypes.QueueDoesNotExist
+	if errors.As(err, &missing) {
+		return buffer.Permanent(fmt.Errorf("queue %s no longer exists: %w", queueURL, err))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send message to %s: %w", queueURL, err)
+	}
+	return nil
+}
+
+// deliverNotification publishes a buffered notification to the tenant's topic
+func deliverNotification(ctx context.Context, tenantID, _ string, payload []byte) error {
+	var notification bufferedNotification
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return buffer.Permanent(fmt.Errorf("failed to decode buffered notification: %w", err))
+	}
+	err := publishNotification(ctx, tenantID, notification.Subject, notification.Message)
+	var missing *snstypes.NotFoundException
+	if errors.Is(err, tenants.ErrNotFound) || errors.As(err, &missing) {
+		return buffer.Permanent(err)
+	}
+	return err
+}
+
+// deliverToS3 writes the payload to an s3://bucket/key destination in the tenant's account
+func deliverToS3(ctx context.Context, tenantID, destination string, payload []byte) error {
+	parsed, err := url.Parse(destination)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" || len(parsed.Path) < 2 {
+		return buffer.Permanent(fmt.Errorf("invalid S3 destination %q", destination))
+	}
+	bucket, key := parsed.Host, strings.TrimPrefix(parsed.Path, "/")
+
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if errors.Is(err, tenants.ErrNotFound) {
+		return buffer.Permanent(err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assume role for S3 delivery: %w", err)
+	}
+	region, err := manager.GetBucketRegion(ctx, s3.NewFromConfig(cfg), bucket)
+	var noBucket manager.BucketNotFound
+	if errors.As(err, &noBucket) {
+		return buffer.Permanent(fmt.Errorf("bucket %s no longer exists: %w", bucket, err))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find the region of bucket %s: %w", bucket, err)
+	}
+
+	_, err = s3.NewFromConfig(inRegion(cfg, region)).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(payload),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", destination, err)
+	}
+	return nil
+}
+
+// queueAccount returns the account ID in a queue URL such as
+// https://sqs.us-east-1.amazonaws.com/123456789012/name
+func queueAccount(queueURL string) string {
+	parsed, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+	account, _, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	return account
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// ErrDemoMode is returned by operations that would touch a real AWS account while in demo mode
+var ErrDemoMode = errors.New("not available in demo mode: no AWS account is connected")
+
+// DemoModeEnabled reports whether DEMO_MODE is set, in which case scans and diagrams are
+// served from synthetic data and CloudLoom never calls AWS
+func DemoModeEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DEMO_MODE"))
+	return enabled
+}
+
+// DemoTenantID is the account demo data is seeded for at startup (DEMO_TENANT_ID)
+func DemoTenantID() string {
+	if tenantID := os.Getenv("DEMO_TENANT_ID"); tenantID != "" {
+		return tenantID
+	}
+	return "123456789012"
+}
+
+// SeedDemoData enqueues an inventory scan for the demo tenant unless it already has one,
+// so the dashboard has data as soon as the server starts
+func SeedDemoData(ctx context.Context, m *jobs.Manager) {
+	tenantID := DemoTenantID()
+	if _, err := m.Latest(ctx, JobTypeInventoryScan, tenantID); err == nil {
+		return
+	}
+	if _, err := m.Enqueue(ctx, JobTypeInventoryScan, tenantID, nil); err != nil {
+		log.Printf("[Demo] Warning: failed to seed demo inventory: %v", err)
+		return
+	}
+	log.Printf("[Demo] ✅ Seeding synthetic inventory for tenant %s", tenantID)
+}
+
+// demoBuilder accumulates the resources and evaluations of a synthetic inventory
+type demoBuilder struct {
+	rand      *rand.Rand
+	accountID string
+	now       time.Time
+	inventory *ResourceInventory
+	rules     map[string]*ComplianceRule
+	ruleOrder []string
+}
+
+func (b *demoBuilder) id(prefix string) string {
+	return fmt.Sprintf("%s-%017x", prefix, b.rand.Uint64()&0xfffffffffffffff)
+}
+
+func (b *demoBuilder) add(resourceType, id, name, region string, config map[string]interface{}, tags map[string]string, related ...Relationship) ConfigurationItem {
+	created := b.now.Add(-time.Duration(30+b.rand.Intn(700)) * 24 * time.Hour)
+	item := ConfigurationItem{
+		ResourceID:           id,
+		ResourceType:         resourceType,
+		ResourceName:         name,
+		Region:               region,
+		AvailabilityZone:     region + "a",
+		Configuration:        config,
+		ConfigurationStatus:  "OK",
+		ConfigurationStateId: strconv.FormatInt(b.now.UnixMilli()-int64(b.rand.Intn(86400000)), 10),
+		ResourceCreationTime: &created,
+		Tags:                 FlexibleTags(tags),
+		Relationships:        related,
+	}
+	b.inventory.Resources = append(b.inventory.Resources, item)
+	return item
+}
+
+// evaluate records the outcome of a Config rule for a resource
+func (b *demoBuilder) evaluate(rule string, item ConfigurationItem, compliant bool, annotation string) {
+	r, ok := b.rules[rule]
+	if !ok {
+		r = &ComplianceRule{ConfigRuleName: rule, Source: "AWS", ResourceType: item.ResourceType, ComplianceType: "COMPLIANT"}
+		b.rules[rule] = r
+		b.ruleOrder = append(b.ruleOrder, rule)
+	}
+	result := EvaluationResult{
+		ResourceID:         item.ResourceID,
+		ResourceType:       item.ResourceType,
+		ComplianceType:     "COMPLIANT",
+		OrderingTimestamp:  b.now.Add(-time.Hour),
+		ResultRecordedTime: b.now.Add(-50 * time.Minute),
+	}
+	if !compliant {
+		result.ComplianceType = "NON_COMPLIANT"
+		result.Annotation = annotation
+		r.ComplianceType = "NON_COMPLIANT"
+	}
+	r.EvaluationResults = append(r.EvaluationResults, result)
+}
+
+func relatesTo(resourceType, id, relationship string) Relationship {
+	return Relationship{ResourceType: resourceType, ResourceID: id, RelationshipName: relationship}
+}
+
+// DemoInventory builds a realistic synthetic inventory: a small two-region production and
+// staging estate with a handful of typical misconfigurations (a public bucket, an open SSH
+// security group, unencrypted storage, an IAM user without MFA). Resource IDs are stable
+// per tenant so findings keep their identity across demo scans.
+func DemoInventory(tenantID string, now time.Time) *ResourceInventory {
+	seed := fnv.New64a()
+	seed.Write([]byte(tenantID))
+	b := &demoBuilder{
+		rand:      rand.New(rand.NewSource(int64(seed.Sum64()))),
+		accountID: tenantID,
+		now:       now,
+		inventory: &ResourceInventory{LastUpdated: now},
+		rules:     map[string]*ComplianceRule{},
+	}
+
+	for _, env := range []struct {
+		name, region string
+		public       bool
+	}{
+		{name: "production", region: "ap-south-1"},
+		{name: "staging", region: "us-east-1", public: true},
+	} {
+		tags := map[string]string{"Environment": env.name, "Owner": "platform-team"}
+
+		vpc := b.add("AWS::EC2::VPC", b.id("vpc"), env.name+"-vpc", env.region,
+			map[string]interface{}{"cidrBlock": "10.0.0.0/16", "isDefault": false}, tags)
+		subnet := b.add("AWS::EC2::Subnet", b.id("subnet"), env.name+"-private-a", env.region,
+			map[string]interface{}{"cidrBlock": "10.0.1.0/24", "mapPublicIpOnLaunch": false}, tags,
+			relatesTo(vpc.ResourceType, vpc.ResourceID, "Is contained in Vpc"))
+
+		sshCIDR := "10.0.0.0/8"
+		if env.public {
+			sshCIDR = "0.0.0.0/0"
+		}
+		sg := b.add("AWS::EC2::SecurityGroup", b.id("sg"), env.name+"-app-sg", env.region,
+			map[string]interface{}{"ipPermissions": []map[string]interface{}{
+				{"ipProtocol": "tcp", "fromPort": 22, "toPort": 22, "ipRanges": []string{sshCIDR}},
+				{"ipProtocol": "tcp", "fromPort": 443, "toPort": 443, "ipRanges": []string{"0.0.0.0/0"}},
+			}}, tags,
+			relatesTo(vpc.ResourceType, vpc.ResourceID, "Is contained in Vpc"))
+		b.evaluate("restricted-ssh", sg, !env.public, "Security group allows SSH from 0.0.0.0/0")
+
+		for i := 1; i <= 2; i++ {
+			volume := b.add("AWS::EC2::Volume", b.id("vol"), fmt.Sprintf("%s-app-%d-root", env.name, i), env.region,
+				map[string]interface{}{"size": 50, "volumeType": "gp3", "encrypted": !(env.public && i == 2)}, tags)
+			b.evaluate("encrypted-volumes", volume, !(env.public && i == 2), "EBS volume is not encrypted")
+
+			b.add("AWS::EC2::Instance", b.id("i"), fmt.Sprintf("%s-app-%d", env.name, i), env.region,
+				map[string]interface{}{"instanceType": "t3.medium", "state": map[string]string{"name": "running"}, "imageId": "ami-0f5ee92e2d63afc18"}, tags,
+				relatesTo(subnet.ResourceType, subnet.ResourceID, "Is contained in Subnet"),
+				relatesTo(sg.ResourceType, sg.ResourceID, "Is associated with SecurityGroup"),
+				relatesTo(volume.ResourceType, volume.ResourceID, "Is attached to Volume"))
+		}
+
+		db := b.add("AWS::RDS::DBInstance", b.id("db"), env.name+"-postgres", env.region,
+			map[string]interface{}{"engine": "postgres", "dBInstanceClass": "db.t3.medium", "publiclyAccessible": env.public, "storageEncrypted": !env.public}, tags,
+			relatesTo(sg.ResourceType, sg.ResourceID, "Is associated with SecurityGroup"))
+		b.evaluate("rds-instance-public-access-check", db, !env.public, "RDS instance is publicly accessible")
+		b.evaluate("rds-storage-encrypted", db, !env.public, "RDS storage is not encrypted")
+
+		for _, fn := range []string{"ingest-events", "thumbnailer"} {
+			b.add("AWS::Lambda::Function", fmt.Sprintf("%s-%s", env.name, fn), fmt.Sprintf("%s-%s", env.name, fn), env.region,
+				map[string]interface{}{"runtime": "python3.12", "memorySize": 256, "timeout": 30}, tags)
+		}
+	}
+
+	for i, bucket := range []struct {
+		name   string
+		public bool
+	}{
+		{name: "app-assets"}, {name: "cloudtrail-logs"}, {name: "marketing-site", public: true}, {name: "db-backups"},
+	} {
+		item := b.add("AWS::S3::Bucket", fmt.Sprintf("acme-%s-%s", bucket.name, b.accountID), fmt.Sprintf("acme-%s-%s", bucket.name, b.accountID), "ap-south-1",
+			map[string]interface{}{"publicAccessBlockConfiguration": map[string]bool{"blockPublicAcls": !bucket.public, "ignorePublicAcls": !bucket.public, "blockPublicPolicy": !bucket.public, "restrictPublicBuckets": !bucket.public}, "versioning": i%2 == 0},
+			map[string]string{"Owner": "platform-team"})
+		b.evaluate("s3-bucket-public-read-prohibited", item, !bucket.public, "Bucket policy allows public read access")
+	}
+
+	for _, user := range []struct {
+		name string
+		mfa  bool
+	}{
+		{name: "ci-deployer", mfa: true}, {name: "legacy-admin"},
+	} {
+		mfaDevices := 0
+		if user.mfa {
+			mfaDevices = 1
+		}
+		item := b.add("AWS::IAM::User", b.id("AIDA"), user.name, "global",
+			map[string]interface{}{"userName": user.name, "mfaDevices": mfaDevices}, nil)
+		b.evaluate("iam-user-mfa-enabled", item, user.mfa, "IAM user has console access without MFA")
+	}
+	for _, role := range []string{"app-instance-role", "lambda-exec-role", "CloudLoomAutoApplyFixRole"} {
+		b.add("AWS::IAM::Role", b.id("AROA"), role, "global", map[string]interface{}{"roleName": role}, nil)
+	}
+
+	b.inventory.Policies = []PolicyDocument{
+		{
+			PolicyName: "AppReadOnly",
+			PolicyType: PolicyTypeCustomerManaged,
+			PolicyDocument: map[string]interface{}{"Version": "2012-10-17", "Statement": []map[string]interface{}{
+				{"Effect": "Allow", "Action": []string{"s3:GetObject", "s3:ListBucket"}, "Resource": "*"},
+			}},
+			AttachedTo:  []string{fmt.Sprintf("arn:aws:iam::%s:role/app-instance-role", b.accountID)},
+			ResourceArn: fmt.Sprintf("arn:aws:iam::%s:policy/AppReadOnly", b.accountID),
+		},
+		{
+			PolicyName: "LegacyFullAccess",
+			PolicyType: PolicyTypeCustomerManaged,
+			PolicyDocument: map[string]interface{}{"Version": "2012-10-17", "Statement": []map[string]interface{}{
+				{"Effect": "Allow", "Action": "*", "Resource": "*"},
+			}},
+			AttachedTo:  []string{fmt.Sprintf("arn:aws:iam::%s:user/legacy-admin", b.accountID)},
+			ResourceArn: fmt.Sprintf("arn:aws:iam::%s:policy/LegacyFullAccess", b.accountID),
+		},
+		{
+			PolicyName: "app-instance-role",
+			PolicyType: PolicyTypeTrust,
+			PolicyDocument: map[string]interface{}{"Version": "2012-10-17", "Statement": []map[string]interface{}{
+				{"Effect": "Allow", "Principal": map[string]string{"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"},
+			}},
+			AttachedTo: []string{fmt.Sprintf("arn:aws:iam::%s:role/app-instance-role", b.accountID)},
+		},
+	}
+
+	for _, name := range b.ruleOrder {
+		b.inventory.ComplianceRules = append(b.inventory.ComplianceRules, *b.rules[name])
+	}
+	b.inventory.ResourceSummary = (&ConfigService{}).GenerateResourceSummary(b.inventory)
+	return b.inventory
+}
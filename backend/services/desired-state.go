@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	"github.com/rishichirchi/cloudloom/services/accountconfig"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+)
+
+// ApplyAccountConfig reconciles the customer account with spec and stores spec as the tenant's
+// desired state. It is idempotent: applying the same spec again only reports unchanged items.
+// Per-item failures are recorded in the returned state rather than aborting the whole apply.
+func ApplyAccountConfig(ctx context.Context, tenantID string, spec accountconfig.Spec) (*accountconfig.State, error) {
+	store := accountconfig.Default()
+	if store == nil {
+		return nil, fmt.Errorf("account configuration store is not initialized")
+	}
+	if err := spec.Normalize(); err != nil {
+		return nil, err
+	}
+
+	previous, err := store.Get(ctx, tenantID)
+	if errors.Is(err, accountconfig.ErrNotFound) {
+		previous = &accountconfig.State{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	state := &accountconfig.State{TenantID: tenantID, Spec: spec, AppliedAt: time.Now()}
+	regions := spec.Regions
+	if len(regions) == 0 {
+		regions = []string{customerCfg.Region}
+	}
+
+	state.Changes = append(state.Changes, reconcileRegions(ctx, customerCfg, spec.Regions, previous.Spec.Regions)...)
+	if spec.Recorder != nil {
+		state.Changes = append(state.Changes, reconcileRecorder(ctx, customerCfg, regions, *spec.Recorder)...)
+	}
+	ruleChanges, managed := reconcileConfigRules(ctx, customerCfg, regions, spec.Rules, previous.ManagedRules)
+	state.Changes = append(state.Changes, ruleChanges...)
+	state.ManagedRules = managed
+	state.Changes = append(state.Changes, reconcileChannels(ctx, tenantID, spec.NotificationChannels, previous.Spec.NotificationChannels)...)
+
+	state.Converged = true
+	for _, change := range state.Changes {
+		if change.Action == accountconfig.ActionFailed {
+			state.Converged = false
+		}
+	}
+	if err := store.Save(ctx, state); err != nil {
+		return nil, err
+	}
+	log.Printf("[AccountConfig] ✅ Applied configuration for tenant %s (%d changes, converged=%t)", tenantID, len(state.Changes), state.Converged)
+	return state, nil
+}
+
+func inRegion(cfg aws.Config, region string) aws.Config {
+	regional := cfg.Copy()
+	regional.Region = region
+	return regional
+}
+
+// reconcileRegions makes sure the AWS Config recorder is recording in every desired region.
+// Recorders are created by account setup, so a region without one is reported as failed.
+// Regions dropped from the spec are no longer managed; their recorders are left as they are.
+func reconcileRegions(ctx context.Context, cfg aws.Config, desired, previous []string) []accountconfig.Change {
+	var changes []accountconfig.Change
+	for _, region := range desired {
+		change := accountconfig.Change{Kind: "region", Name: region, Region: region}
+		client := configservice.NewFromConfig(inRegion(cfg, region))
+
+		status, err := client.DescribeConfigurationRecorderStatus(ctx, &configservice.DescribeConfigurationRecorderStatusInput{})
+		switch {
+		case err != nil:
+			change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+		case len(status.ConfigurationRecordersStatus) == 0:
+			change.Action, change.Detail = accountconfig.ActionFailed, "no AWS Config recorder in this region; run account setup there first"
+		case status.ConfigurationRecordersStatus[0].Recording:
+			change.Action = accountconfig.ActionUnchanged
+		default:
+			name := status.ConfigurationRecordersStatus[0].Name
+			if _, err := client.StartConfigurationRecorder(ctx, &configservice.StartConfigurationRecorderInput{ConfigurationRecorderName: name}); err != nil {
+				change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+			} else {
+				change.Action, change.Detail = accountconfig.ActionUpdated, "started recorder "+aws.ToString(name)
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for _, region := range previous {
+		if !containsString(desired, region) {
+			changes = append(changes, accountconfig.Change{Kind: "region", Name: region, Region: region,
+				Action: accountconfig.ActionDeleted, Detail: "no longer managed; recorder left running"})
+		}
+	}
+	return changes
+}
+
+// recordingGroup builds the recorder's recording group and mode for the desired settings.
+// A nil recorder records every supported resource type continuously, as account setup does.
+func recordingGroup(recorder *accountconfig.Recorder) (*types.RecordingGroup, *types.RecordingMode) {
+	group := &types.RecordingGroup{AllSupported: true, IncludeGlobalResourceTypes: true}
+	if recorder == nil {
+		return group, nil
+	}
+
+	switch {
+	case len(recorder.IncludeResourceTypes) > 0:
+		group = &types.RecordingGroup{
+			ResourceTypes:     toResourceTypes(recorder.IncludeResourceTypes),
+			RecordingStrategy: &types.RecordingStrategy{UseOnly: types.RecordingStrategyTypeInclusionByResourceTypes},
+		}
+	case len(recorder.ExcludeResourceTypes) > 0:
+		group = &types.RecordingGroup{
+			ExclusionByResourceTypes: &types.ExclusionByResourceTypes{ResourceTypes: toResourceTypes(recorder.ExcludeResourceTypes)},
+			RecordingStrategy:        &types.RecordingStrategy{UseOnly: types.RecordingStrategyTypeExclusionByResourceTypes},
+		}
+	}
+
+	var mode *types.RecordingMode
+	if recorder.RecordingFrequency != "" {
+		mode = &types.RecordingMode{RecordingFrequency: types.RecordingFrequency(recorder.RecordingFrequency)}
+	}
+	return group, mode
+}
+
+func toResourceTypes(names []string) []types.ResourceType {
+	resourceTypes := make([]types.ResourceType, 0, len(names))
+	for _, name := range names {
+		resourceTypes = append(resourceTypes, types.ResourceType(name))
+	}
+	return resourceTypes
+}
+
+// reconcileRecorder updates the recording group of the recorder in every desired region when
+// it differs from the desired resource types and frequency
+func reconcileRecorder(ctx context.Context, cfg aws.Config, regions []string, desired accountconfig.Recorder) []accountconfig.Change {
+	group, mode := recordingGroup(&desired)
+	var changes []accountconfig.Change
+	for _, region := range regions {
+		change := accountconfig.Change{Kind: "recorder", Region: region}
+		client := configservice.NewFromConfig(inRegion(cfg, region))
+
+		out, err := client.DescribeConfigurationRecorders(ctx, &configservice.DescribeConfigurationRecordersInput{})
+		switch {
+		case err != nil:
+			change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+		case len(out.ConfigurationRecorders) == 0:
+			change.Action, change.Detail = accountconfig.ActionFailed, "no AWS Config recorder in this region; run account setup there first"
+		default:
+			recorder := out.ConfigurationRecorders[0]
+			change.Name = aws.ToString(recorder.Name)
+			if sameRecording(recorder, group, mode) {
+				change.Action = accountconfig.ActionUnchanged
+				break
+			}
+			recorder.RecordingGroup = group
+			if mode != nil {
+				recorder.RecordingMode = mode
+			}
+			_, err := client.PutConfigurationRecorder(ctx, &configservice.PutConfigurationRecorderInput{ConfigurationRecorder: &recorder})
+			if err != nil {
+				change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+			} else {
+				change.Action = accountconfig.ActionUpdated
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// sameRecording reports whether a recorder already records what group and mode describe
+func sameRecording(recorder types.ConfigurationRecorder, group *types.RecordingGroup, mode *types.RecordingMode) bool {
+	current := recorder.RecordingGroup
+	if current == nil {
+		return false
+	}
+	if mode != nil && (recorder.RecordingMode == nil || recorder.RecordingMode.RecordingFrequency != mode.RecordingFrequency) {
+		return false
+	}
+	if current.AllSupported != group.AllSupported {
+		return false
+	}
+	if group.AllSupported {
+		return current.IncludeGlobalResourceTypes == group.IncludeGlobalResourceTypes
+	}
+
+	var currentExcluded, desiredExcluded []types.ResourceType
+	if current.ExclusionByResourceTypes != nil {
+		currentExcluded = current.ExclusionByResourceTypes.ResourceTypes
+	}
+	if group.ExclusionByResourceTypes != nil {
+		desiredExcluded = group.ExclusionByResourceTypes.ResourceTypes
+	}
+	return sameResourceTypes(current.ResourceTypes, group.ResourceTypes) && sameResourceTypes(currentExcluded, desiredExcluded)
+}
+
+func sameResourceTypes(a, b []types.ResourceType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[types.ResourceType]bool{}
+	for _, t := range a {
+		seen[t] = true
+	}
+	for _, t := range b {
+		if !seen[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileConfigRules creates missing AWS managed Config rules in every region and deletes
+// the rules CloudLoom created earlier that are no longer desired. Rules the customer created
+// themselves are never deleted. It returns the changes and the new set of managed rules.
+func reconcileConfigRules(ctx context.Context, cfg aws.Config, regions, rules, previouslyManaged []string) ([]accountconfig.Change, []string) {
+	var changes []accountconfig.Change
+	managed := []string{}
+	wanted := map[string]bool{}
+
+	for _, region := range regions {
+		client := configservice.NewFromConfig(inRegion(cfg, region))
+		existing, err := listConfigRuleNames(ctx, client)
+		if err != nil {
+			for _, rule := range rules {
+				changes = append(changes, accountconfig.Change{Kind: "rule", Name: rule, Region: region, Action: accountconfig.ActionFailed, Detail: err.Error()})
+			}
+			// Keep whatever was managed here so a later apply can still clean it up
+			for _, key := range previouslyManaged {
+				if strings.HasPrefix(key, region+"/") {
+					wanted[key] = true
+					managed = append(managed, key)
+				}
+			}
+			continue
+		}
+
+		for _, rule := range rules {
+			key := region + "/" + rule
+			wanted[key] = true
+			change := accountconfig.Change{Kind: "rule", Name: rule, Region: region}
+			if existing[rule] {
+				change.Action = accountconfig.ActionUnchanged
+				if containsString(previouslyManaged, key) {
+					managed = append(managed, key)
+				}
+				changes = append(changes, change)
+				continue
+			}
+
+			_, err := client.PutConfigRule(ctx, &configservice.PutConfigRuleInput{
+				ConfigRule: &types.ConfigRule{
+					ConfigRuleName: aws.String(rule),
+					Source: &types.Source{
+						Owner:            types.OwnerAws,
+						SourceIdentifier: aws.String(rule),
+					},
+				},
+			})
+			if err != nil {
+				change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+			} else {
+				change.Action = accountconfig.ActionCreated
+				managed = append(managed, key)
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for _, key := range previouslyManaged {
+		if wanted[key] {
+			continue
+		}
+		region, rule, _ := strings.Cut(key, "/")
+		change := accountconfig.Change{Kind: "rule", Name: rule, Region: region}
+		client := configservice.NewFromConfig(inRegion(cfg, region))
+		_, err := client.DeleteConfigRule(ctx, &configservice.DeleteConfigRuleInput{ConfigRuleName: aws.String(rule)})
+		var notFound *types.NoSuchConfigRuleException
+		switch {
+		case err == nil || errors.As(err, &notFound):
+			change.Action = accountconfig.ActionDeleted
+		default:
+			change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+			managed = append(managed, key)
+		}
+		changes = append(changes, change)
+	}
+	return changes, managed
+}
+
+func listConfigRuleNames(ctx context.Context, client *configservice.Client) (map[string]bool, error) {
+	names := map[string]bool{}
+	input := &configservice.DescribeConfigRulesInput{}
+	for {
+		out, err := client.DescribeConfigRules(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list config rules: %w", err)
+		}
+		for _, rule := range out.ConfigRules {
+			names[aws.ToString(rule.ConfigRuleName)] = true
+		}
+		if out.NextToken == nil {
+			return names, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// reconcileChannels checks that every integration channel has stored credentials. Email
+// channels need nothing beyond the address, which report emails are sent to by default.
+func reconcileChannels(ctx context.Context, tenantID string, desired, previous []accountconfig.Channel) []accountconfig.Change {
+	previousKeys := map[string]bool{}
+	for _, channel := range previous {
+		previousKeys[channel.Key()] = true
+	}
+
+	var changes []accountconfig.Change
+	desiredKeys := map[string]bool{}
+	for _, channel := range desired {
+		desiredKeys[channel.Key()] = true
+		change := accountconfig.Change{Kind: "notificationChannel", Name: channel.Key(), Action: accountconfig.ActionCreated}
+		if previousKeys[channel.Key()] {
+			change.Action = accountconfig.ActionUnchanged
+		}
+
+		if channel.Type != accountconfig.ChannelEmail {
+			store := secrets.Default()
+			if store == nil {
+				change.Action, change.Detail = accountconfig.ActionFailed, "no secret store is configured for integration credentials"
+			} else if _, err := store.Get(ctx, secrets.TenantName(tenantID, channel.Type)); errors.Is(err, secrets.ErrNotFound) {
+				change.Action, change.Detail = accountconfig.ActionFailed, fmt.Sprintf("no %s credentials stored; PUT /api/v1/integrations/%s/credentials first", channel.Type, channel.Type)
+			} else if err != nil {
+				change.Action, change.Detail = accountconfig.ActionFailed, err.Error()
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for _, channel := range previous {
+		if !desiredKeys[channel.Key()] {
+			changes = append(changes, accountconfig.Change{Kind: "notificationChannel", Name: channel.Key(), Action: accountconfig.ActionDeleted})
+		}
+	}
+	return changes
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// collectEC2 reads instances, volumes, security groups, VPCs, subnets, NAT gateways, network
+// interfaces, elastic IPs and the account's own EBS snapshots in every enabled region, related to one another the way Config relates
+// them
+func (cs *ConfigService) collectEC2(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+	accountID, _ := getAccountID(ctx, &cfg)
+	return cs.collectPerRegion(ctx, cfg, "EC2", func(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+		return (&ec2Collector{client: ec2.NewFromConfig(cfg), region: cfg.Region, accountID: accountID}).collect(ctx)
+	})
+}
+
+// ec2Collector reads the EC2 and VPC resources of one region
+type ec2Collector struct {
+	client    *ec2.Client
+	region    string
+	accountID string
+}
+
+func (c *ec2Collector) collect(ctx context.Context) ([]ConfigurationItem, error) {
+	return describeAll(ctx, c.region, []resourceDescriber{
+		{"instances", c.instances},
+		{"volumes", c.volumes},
+		{"security groups", c.securityGroups},
+		{"VPCs", c.vpcs},
+		{"subnets", c.subnets},
+		{"NAT gateways", c.natGateways},
+		{"network interfaces", c.networkInterfaces},
+		{"elastic IPs", c.addresses},
+		{"snapshots", c.snapshots},
+	})
+}
+
+func (c *ec2Collector) item(resourceType, id string, description interface{}, tags []ec2types.Tag, relationships ...Relationship) ConfigurationItem {
+	flexible := FlexibleTags{}
+	for _, tag := range tags {
+		flexible[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return collectedItem(resourceType, id, flexible["Name"], c.region, c.accountID, description, flexible, nil, relationships...)
+}
+
+func (c *ec2Collector) instances(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeInstancesPaginator(c.client, &ec2.DescribeInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State != nil && instance.State.Name == ec2types.InstanceStateNameTerminated {
+					continue
+				}
+				relationships := relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(instance.VpcId))
+				relationships = append(relationships, relatedTo("AWS::EC2::Subnet", "Is contained in Subnet", aws.ToString(instance.SubnetId))...)
+				for _, group := range instance.SecurityGroups {
+					relationships = append(relationships, relatedTo("AWS::EC2::SecurityGroup", "Is associated with SecurityGroup", aws.ToString(group.GroupId))...)
+				}
+				for _, mapping := range instance.BlockDeviceMappings {
+					if mapping.Ebs != nil {
+						relationships = append(relationships, relatedTo("AWS::EC2::Volume", "Is attached to Volume", aws.ToString(mapping.Ebs.VolumeId))...)
+					}
+				}
+				for _, eni := range instance.NetworkInterfaces {
+					relationships = append(relationships, relatedTo("AWS::EC2::NetworkInterface", "Contains NetworkInterface", aws.ToString(eni.NetworkInterfaceId))...)
+				}
+
+				item := c.item("AWS::EC2::Instance", aws.ToString(instance.InstanceId), instance, instance.Tags, relationships...)
+				item.ResourceCreationTime = instance.LaunchTime
+				if instance.Placement != nil {
+					item.AvailabilityZone = aws.ToString(instance.Placement.AvailabilityZone)
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) volumes(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeVolumesPaginator(c.client, &ec2.DescribeVolumesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe volumes: %w", err)
+		}
+		for _, volume := range page.Volumes {
+			var relationships []Relationship
+			for _, attachment := range volume.Attachments {
+				relationships = append(relationships, relatedTo("AWS::EC2::Instance", "Is attached to Instance", aws.ToString(attachment.InstanceId))...)
+			}
+			item := c.item("AWS::EC2::Volume", aws.ToString(volume.VolumeId), volume, volume.Tags, relationships...)
+			item.ResourceCreationTime = volume.CreateTime
+			item.AvailabilityZone = aws.ToString(volume.AvailabilityZone)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) securityGroups(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeSecurityGroupsPaginator(c.client, &ec2.DescribeSecurityGroupsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe security groups: %w", err)
+		}
+		for _, group := range page.SecurityGroups {
+			item := c.item("AWS::EC2::SecurityGroup", aws.ToString(group.GroupId), group, group.Tags,
+				relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(group.VpcId))...)
+			item.ResourceName = aws.ToString(group.GroupName)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) vpcs(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeVpcsPaginator(c.client, &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe VPCs: %w", err)
+		}
+		for _, vpc := range page.Vpcs {
+			items = append(items, c.item("AWS::EC2::VPC", aws.ToString(vpc.VpcId), vpc, vpc.Tags))
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) subnets(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeSubnetsPaginator(c.client, &ec2.DescribeSubnetsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe subnets: %w", err)
+		}
+		for _, subnet := range page.Subnets {
+			item := c.item("AWS::EC2::Subnet", aws.ToString(subnet.SubnetId), subnet, subnet.Tags,
+				relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(subnet.VpcId))...)
+			item.AvailabilityZone = aws.ToString(subnet.AvailabilityZone)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) natGateways(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeNatGatewaysPaginator(c.client, &ec2.DescribeNatGatewaysInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe NAT gateways: %w", err)
+		}
+		for _, gateway := range page.NatGateways {
+			// Deleted gateways stay listed for about an hour
+			if gateway.State == ec2types.NatGatewayStateDeleted {
+				continue
+			}
+			relationships := relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(gateway.VpcId))
+			relationships = append(relationships, relatedTo("AWS::EC2::Subnet", "Is contained in Subnet", aws.ToString(gateway.SubnetId))...)
+			item := c.item("AWS::EC2::NatGateway", aws.ToString(gateway.NatGatewayId), gateway, gateway.Tags, relationships...)
+			item.ResourceCreationTime = gateway.CreateTime
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) networkInterfaces(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeNetworkInterfacesPaginator(c.client, &ec2.DescribeNetworkInterfacesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe network interfaces: %w", err)
+		}
+		for _, eni := range page.NetworkInterfaces {
+			relationships := relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(eni.VpcId))
+			relationships = append(relationships, relatedTo("AWS::EC2::Subnet", "Is contained in Subnet", aws.ToString(eni.SubnetId))...)
+			for _, group := range eni.Groups {
+				relationships = append(relationships, relatedTo("AWS::EC2::SecurityGroup", "Is associated with SecurityGroup", aws.ToString(group.GroupId))...)
+			}
+			if eni.Attachment != nil {
+				relationships = append(relationships, relatedTo("AWS::EC2::Instance", "Is attached to Instance", aws.ToString(eni.Attachment.InstanceId))...)
+			}
+			item := c.item("AWS::EC2::NetworkInterface", aws.ToString(eni.NetworkInterfaceId), eni, eni.TagSet, relationships...)
+			item.AvailabilityZone = aws.ToString(eni.AvailabilityZone)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *ec2Collector) addresses(ctx context.Context) ([]ConfigurationItem, error) {
+	out, err := c.client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe addresses: %w", err)
+	}
+	var items []ConfigurationItem
+	for _, address := range out.Addresses {
+		item := c.item("AWS::EC2::EIP", aws.ToString(address.AllocationId), address, address.Tags,
+			relatedTo("AWS::EC2::Instance", "Is attached to Instance", aws.ToString(address.InstanceId))...)
+		if item.ResourceName == "" {
+			item.ResourceName = aws.ToString(address.PublicIp)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// snapshots reads the EBS snapshots the account owns, which Config does not record
+func (c *ec2Collector) snapshots(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := ec2.NewDescribeSnapshotsPaginator(c.client, &ec2.DescribeSnapshotsInput{OwnerIds: []string{"self"}})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe snapshots: %w", err)
+		}
+		for _, snapshot := range page.Snapshots {
+			item := c.item("AWS::EC2::Snapshot", aws.ToString(snapshot.SnapshotId), snapshot, snapshot.Tags,
+				relatedTo("AWS::EC2::Volume", "Is associated with Volume", aws.ToString(snapshot.VolumeId))...)
+			item.ResourceCreationTime = snapshot.StartTime
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
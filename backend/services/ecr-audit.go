@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// Compliance rules evaluated against ECR repositories
+const (
+	RuleECRScanOnPush       = "cloudloom-ecr-scan-on-push-enabled"
+	RuleECRImmutableTags    = "cloudloom-ecr-tag-immutability-enabled"
+	ecrRepositoryType       = "AWS::ECR::Repository"
+	ecrImageType            = "AWS::ECR::Image"
+	maxScannedImagesPerRepo = 10
+)
+
+// FindingSourceECR marks findings produced from ECR image scan results
+const FindingSourceECR = "ecr_scan"
+
+// ECRRepository is an ECR repository, its scan settings and its most recently pushed images
+type ECRRepository struct {
+	Name               string     `json:"name"`
+	ARN                string     `json:"arn"`
+	URI                string     `json:"uri"`
+	ScanOnPush         bool       `json:"scanOnPush"`
+	ImageTagMutability string     `json:"imageTagMutability"`
+	Images             []ECRImage `json:"images"`
+}
+
+// ECRImage is a pushed image and the vulnerabilities its latest scan reported
+type ECRImage struct {
+	Digest          string               `json:"digest"`
+	Tags            []string             `json:"tags,omitempty"`
+	PushedAt        *time.Time           `json:"pushedAt,omitempty"`
+	ScanStatus      string               `json:"scanStatus,omitempty"`
+	SeverityCounts  map[string]int32     `json:"severityCounts,omitempty"`
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities,omitempty"`
+	// RunningIn lists the ECS services and task definitions whose containers use the image
+	RunningIn []string `json:"runningIn,omitempty"`
+}
+
+// ImageVulnerability is one CVE reported by an ECR basic or enhanced scan
+type ImageVulnerability struct {
+	Name           string `json:"name"`
+	Severity       string `json:"severity"`
+	Package        string `json:"package,omitempty"`
+	PackageVersion string `json:"packageVersion,omitempty"`
+	URI            string `json:"uri,omitempty"`
+}
+
+// AuditECR collects the account's ECR repositories with their latest images and scan findings,
+// evaluates scan-on-push and tag immutability, and links images to the ECS services running them
+func (cs *ConfigService) AuditECR(ctx context.Context, cfg aws.Config, resources []ConfigurationItem) ([]ECRRepository, []ComplianceRule, error) {
+	log.Println("[ECR] Collecting repositories and image scan findings...")
+	client := ecr.NewFromConfig(cfg)
+	repositories := []ECRRepository{}
+	now := time.Now()
+
+	scanOnPush := newAuditRule(RuleECRScanOnPush, ecrRepositoryType)
+	immutable := newAuditRule(RuleECRImmutableTags, ecrRepositoryType)
+
+	paginator := ecr.NewDescribeRepositoriesPaginator(client, &ecr.DescribeRepositoriesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to describe ECR repositories: %w", err)
+		}
+		for _, r := range page.Repositories {
+			repo := ECRRepository{
+				Name:               aws.ToString(r.RepositoryName),
+				ARN:                aws.ToString(r.RepositoryArn),
+				URI:                aws.ToString(r.RepositoryUri),
+				ImageTagMutability: string(r.ImageTagMutability),
+			}
+			if r.ImageScanningConfiguration != nil {
+				repo.ScanOnPush = r.ImageScanningConfiguration.ScanOnPush
+			}
+
+			images, err := latestImages(ctx, client, repo.Name)
+			if err != nil {
+				log.Printf("[ECR] Warning: %v", err)
+			}
+			repo.Images = images
+			repositories = append(repositories, repo)
+
+			scanOnPush.evaluate(repo.Name, repo.ScanOnPush, "Images are not scanned for vulnerabilities when pushed", now)
+			immutable.evaluate(repo.Name, r.ImageTagMutability == ecrtypes.ImageTagMutabilityImmutable,
+				"Image tags can be overwritten, so a tag may not identify the image that was scanned", now)
+		}
+	}
+
+	linkImagesToWorkloads(repositories, resources)
+
+	log.Printf("[ECR] ✅ Collected %d repositories", len(repositories))
+	return repositories, []ComplianceRule{scanOnPush.rule(), immutable.rule()}, nil
+}
+
+// latestImages returns the repository's most recently pushed images with their scan findings
+func latestImages(ctx context.Context, client *ecr.Client, repoName string) ([]ECRImage, error) {
+	var details []ecrtypes.ImageDetail
+	paginator := ecr.NewDescribeImagesPaginator(client, &ecr.DescribeImagesInput{RepositoryName: aws.String(repoName)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe images in %s: %w", repoName, err)
+		}
+		details = append(details, page.ImageDetails...)
+	}
+
+	sort.Slice(details, func(i, j int) bool {
+		return aws.ToTime(details[i].ImagePushedAt).After(aws.ToTime(details[j].ImagePushedAt))
+	})
+	if len(details) > maxScannedImagesPerRepo {
+		details = details[:maxScannedImagesPerRepo]
+	}
+
+	images := make([]ECRImage, 0, len(details))
+	for _, d := range details {
+		image := ECRImage{
+			Digest:   aws.ToString(d.ImageDigest),
+			Tags:     d.ImageTags,
+			PushedAt: d.ImagePushedAt,
+		}
+		if d.ImageScanStatus != nil {
+			image.ScanStatus = string(d.ImageScanStatus.Status)
+		}
+		if d.ImageScanFindingsSummary != nil && len(d.ImageScanFindingsSummary.FindingSeverityCounts) > 0 {
+			image.SeverityCounts = d.ImageScanFindingsSummary.FindingSeverityCounts
+			vulns, err := imageVulnerabilities(ctx, client, repoName, image.Digest)
+			if err != nil {
+				log.Printf("[ECR] Warning: %v", err)
+			}
+			image.Vulnerabilities = vulns
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// imageVulnerabilities reads an image's basic or enhanced (Inspector) scan findings
+func imageVulnerabilities(ctx context.Context, client *ecr.Client, repoName, digest string) ([]ImageVulnerability, error) {
+	var vulns []ImageVulnerability
+	paginator := ecr.NewDescribeImageScanFindingsPaginator(client, &ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String(repoName),
+		ImageId:        &ecrtypes.ImageIdentifier{ImageDigest: aws.String(digest)},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return vulns, fmt.Errorf("failed to read scan findings of %s@%s: %w", repoName, digest, err)
+		}
+		if page.ImageScanFindings == nil {
+			continue
+		}
+		for _, f := range page.ImageScanFindings.Findings {
+			vuln := ImageVulnerability{Name: aws.ToString(f.Name), Severity: string(f.Severity), URI: aws.ToString(f.Uri)}
+			for _, attr := range f.Attributes {
+				switch aws.ToString(attr.Key) {
+				case "package_name":
+					vuln.Package = aws.ToString(attr.Value)
+				case "package_version":
+					vuln.PackageVersion = aws.ToString(attr.Value)
+				}
+			}
+			vulns = append(vulns, vuln)
+		}
+		for _, f := range page.ImageScanFindings.EnhancedFindings {
+			vuln := ImageVulnerability{Severity: aws.ToString(f.Severity)}
+			if details := f.PackageVulnerabilityDetails; details != nil {
+				vuln.Name = aws.ToString(details.VulnerabilityId)
+				vuln.URI = aws.ToString(details.SourceUrl)
+				if len(details.VulnerablePackages) > 0 {
+					vuln.Package = aws.ToString(details.VulnerablePackages[0].Name)
+					vuln.PackageVersion = aws.ToString(details.VulnerablePackages[0].Version)
+				}
+			}
+			if vuln.Name == "" {
+				vuln.Name = aws.ToString(f.Title)
+			}
+			vulns = append(vulns, vuln)
+		}
+	}
+	return vulns, nil
+}
+
+// linkImagesToWorkloads fills in RunningIn from the ECS task definitions in the inventory and
+// the services whose relationships or configuration point at those task definitions.
+// EKS workloads are not recorded by AWS Config, so they cannot be linked this way.
+func linkImagesToWorkloads(repositories []ECRRepository, resources []ConfigurationItem) {
+	taskImages := map[string][]string{}
+	var ecsServices []ConfigurationItem
+	for _, item := range resources {
+		switch item.ResourceType {
+		case "AWS::ECS::TaskDefinition":
+			var images []string
+			for _, container := range configList(item.Configuration, "containerDefinitions") {
+				if def, ok := container.(map[string]interface{}); ok {
+					if image, ok := configValue(def, "image").(string); ok {
+						images = append(images, image)
+					}
+				}
+			}
+			for _, id := range []string{item.ResourceID, item.ResourceName, stringValue(configValue(item.Configuration, "taskDefinitionArn"))} {
+				if id != "" {
+					taskImages[id] = images
+				}
+			}
+		case "AWS::ECS::Service":
+			ecsServices = append(ecsServices, item)
+		}
+	}
+
+	// workloads maps each image reference to the task definitions and services that run it
+	workloads := map[string][]string{}
+	for id, images := range taskImages {
+		for _, image := range images {
+			workloads[image] = appendUnique(workloads[image], "task-definition/"+id)
+		}
+	}
+	for _, service := range ecsServices {
+		refs := []string{stringValue(configValue(service.Configuration, "taskDefinition"))}
+		for _, rel := range service.Relationships {
+			if rel.ResourceType == "AWS::ECS::TaskDefinition" {
+				refs = append(refs, rel.ResourceID, rel.ResourceName)
+			}
+		}
+		name := service.ResourceName
+		if name == "" {
+			name = service.ResourceID
+		}
+		for _, ref := range refs {
+			for _, image := range taskImages[ref] {
+				workloads[image] = appendUnique(workloads[image], "service/"+name)
+			}
+		}
+	}
+
+	for i := range repositories {
+		repo := &repositories[i]
+		for j := range repo.Images {
+			image := &repo.Images[j]
+			for ref, users := range workloads {
+				if imageMatches(repo.URI, image, ref) {
+					for _, user := range users {
+						image.RunningIn = appendUnique(image.RunningIn, user)
+					}
+				}
+			}
+			sort.Strings(image.RunningIn)
+		}
+	}
+}
+
+// imageMatches reports whether a container image reference names the image: by digest, by
+// one of its tags, or as the repository with no tag, which resolves to latest
+func imageMatches(repoURI string, image *ECRImage, ref string) bool {
+	if repoURI == "" || !strings.HasPrefix(ref, repoURI) {
+		return false
+	}
+	rest := strings.TrimPrefix(ref, repoURI)
+	switch {
+	case strings.HasPrefix(rest, "@"):
+		return rest[1:] == image.Digest
+	case strings.HasPrefix(rest, ":"):
+		return containsString(image.Tags, rest[1:])
+	case rest == "":
+		return containsString(image.Tags, "latest")
+	}
+	return false
+}
+
+// syncImageFindings records a finding for every vulnerability in the scanned images and resolves
+// those no longer reported. Inventories collected without ECR data leave image findings untouched.
+func syncImageFindings(ctx context.Context, tenantID string, repositories []ECRRepository, scanStartedAt time.Time) error {
+	store := findings.Default()
+	if store == nil || repositories == nil {
+		return nil
+	}
+
+	recorded := 0
+	for _, repo := range repositories {
+		for _, image := range repo.Images {
+			resourceID := repo.Name + "@" + image.Digest
+			for _, vuln := range image.Vulnerabilities {
+				severity := imageFindingSeverity(vuln.Severity)
+				if severity == "" {
+					continue
+				}
+				description := fmt.Sprintf("%s %s is vulnerable. %s", vuln.Package, vuln.PackageVersion, vuln.URI)
+				if len(image.RunningIn) > 0 {
+					description += " Running in: " + strings.Join(image.RunningIn, ", ")
+				}
+				finding := &findings.Finding{
+					TenantID:     tenantID,
+					Source:       FindingSourceECR,
+					RuleID:       vuln.Name,
+					Title:        fmt.Sprintf("%s in %s", vuln.Name, repo.Name),
+					Description:  strings.TrimSpace(description),
+					Severity:     severity,
+					ResourceType: ecrImageType,
+					ResourceID:   resourceID,
+				}
+				if err := recordFinding(ctx, store, finding); err != nil {
+					return err
+				}
+				recorded++
+			}
+		}
+	}
+
+	resolved, err := store.ResolveStale(ctx, tenantID, FindingSourceECR, scanStartedAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Findings] ✅ Recorded %d image vulnerability findings, resolved %d for tenant %s", recorded, resolved, tenantID)
+	return nil
+}
+
+// imageFindingSeverity maps an ECR severity to a finding severity; informational and
+// undefined results are not recorded
+func imageFindingSeverity(severity string) string {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL":
+		return "critical"
+	case "HIGH":
+		return "high"
+	case "MEDIUM":
+		return "medium"
+	case "LOW":
+		return "low"
+	}
+	return ""
+}
+
+// configValue looks up a key in a Config configuration map without regard to case, since
+// resource types differ in whether they use camelCase or PascalCase
+func configValue(config map[string]interface{}, key string) interface{} {
+	if v, ok := config[key]; ok {
+		return v
+	}
+	for k, v := range config {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func configList(config map[string]interface{}, key string) []interface{} {
+	list, _ := configValue(config, key).([]interface{})
+	return list
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func appendUnique(list []string, value string) []string {
+	if containsString(list, value) {
+		return list
+	}
+	return append(list, value)
+}
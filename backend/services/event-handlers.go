@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// RegisterEventHandlers registers the handlers of the events the tenant queues receive
+func RegisterEventHandlers(d *eventpipeline.Dispatcher) {
+	d.Handle("cloudtrail_api_call", "", eventpipeline.DetailTypeAPICall, handleAPICall)
+	d.Handle("anomaly_detection", "", eventpipeline.DetailTypeAPICall, handleAnomalies)
+	d.Handle("console_sign_in_anomaly_detection", "", eventpipeline.DetailTypeConsoleSignIn, handleAnomalies)
+	d.Handle("securityhub_findings", eventpipeline.SourceSecurityHub, eventpipeline.DetailTypeSecurityHub, handleSecurityHubFindings)
+	d.Handle("guardduty_finding", eventpipeline.SourceGuardDuty, eventpipeline.DetailTypeGuardDuty, handleGuardDutyFinding)
+	d.Handle("config_compliance_change", eventpipeline.SourceConfig, eventpipeline.DetailTypeConfigCompliance, handleComplianceChange)
+}
+
+// apiCallDetail is the part of the detail of a CloudTrail API call or console sign-in event
+// CloudLoom reads
+type apiCallDetail struct {
+	EventSource  string `json:"eventSource"`
+	EventName    string `json:"eventName"`
+	EventType    string `json:"eventType"`
+	AWSRegion    string `json:"awsRegion"`
+	SourceIP     string `json:"sourceIPAddress"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+	UserIdentity struct {
+		Type        string `json:"type"`
+		ARN         string `json:"arn"`
+		AccountID   string `json:"accountId"`
+		AccessKeyID string `json:"accessKeyId"`
+		InvokedBy   string `json:"invokedBy"`
+	} `json:"userIdentity"`
+	RequestParameters   map[string]interface{} `json:"requestParameters"`
+	ResponseElements    map[string]interface{} `json:"responseElements"`
+	AdditionalEventData map[string]interface{} `json:"additionalEventData"`
+}
+
+// actor names who made the call, for finding titles
+func (d *apiCallDetail) actor() string {
+	if d.UserIdentity.Type == "Root" {
+		return "root user"
+	}
+	if d.UserIdentity.ARN != "" {
+		return d.UserIdentity.ARN
+	}
+	return d.UserIdentity.Type
+}
+
+func handleAPICall(ctx context.Context, event *eventpipeline.Event) error {
+	var detail apiCallDetail
+	if err := event.DecodeDetail(&detail); err != nil {
+		return err
+	}
+	outcome := "succeeded"
+	if detail.ErrorCode != "" {
+		outcome = "failed with " + detail.ErrorCode
+	}
+	log.Printf("[Events] %s %s by %s in %s %s", detail.EventSource, detail.EventName, detail.UserIdentity.ARN, detail.AWSRegion, outcome)
+	return nil
+}
+
+// handleAnomalies records a finding for each kind of suspicious activity in an API call or
+// console sign-in. Repeats of the same activity on a resource update its finding.
+func handleAnomalies(ctx context.Context, event *eventpipeline.Event) error {
+	store := findings.Default()
+	if store == nil {
+		return nil
+	}
+	anomalies, err := NewAnomalyDetector(events.Default()).Detect(ctx, event)
+	if err != nil {
+		return err
+	}
+	for _, anomaly := range anomalies {
+		if err := upsertFinding(ctx, store, anomaly.finding(event.TenantID)); err != nil {
+			return err
+		}
+		log.Printf("[Events] ⚠️ Detected %s (%s) for tenant %s: %s", anomaly.Kind, anomaly.Severity, event.TenantID, anomaly.Title)
+	}
+	return nil
+}
+
+func handleSecurityHubFindings(ctx context.Context, event *eventpipeline.Event) error {
+	ingested, err := IngestSecurityHubEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if ingested > 0 {
+		log.Printf("[Events] ✅ Recorded %d Security Hub findings for tenant %s", ingested, event.TenantID)
+	}
+	return nil
+}
+
+func handleGuardDutyFinding(ctx context.Context, event *eventpipeline.Event) error {
+	recorded, err := IngestGuardDutyEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if recorded {
+		log.Printf("[Events] ✅ Recorded GuardDuty finding for tenant %s", event.TenantID)
+	}
+	return nil
+}
+
+// complianceChangeDetail is the detail of a Config rule compliance change event
+type complianceChangeDetail struct {
+	ResourceID          string `json:"resourceId"`
+	ResourceType        string `json:"resourceType"`
+	AWSRegion           string `json:"awsRegion"`
+	AWSAccountID        string `json:"awsAccountId"`
+	ConfigRuleName      string `json:"configRuleName"`
+	NewEvaluationResult struct {
+		ComplianceType string `json:"complianceType"`
+		Annotation     string `json:"annotation"`
+	} `json:"newEvaluationResult"`
+}
+
+// handleComplianceChange records a finding as soon as Config evaluates a resource as
+// non-compliant, and resolves it once the resource complies again, rather than waiting for
+// the next inventory scan. The findings are the ones inventory scans record from Config.
+func handleComplianceChange(ctx context.Context, event *eventpipeline.Event) error {
+	store := findings.Default()
+	if store == nil {
+		return nil
+	}
+	var detail complianceChangeDetail
+	if err := event.DecodeDetail(&detail); err != nil {
+		return err
+	}
+	if detail.AWSAccountID != "" && detail.AWSAccountID != event.TenantID {
+		return nil
+	}
+
+	switch detail.NewEvaluationResult.ComplianceType {
+	case ComplianceNonCompliant:
+		return recordFinding(ctx, store, &findings.Finding{
+			TenantID:     event.TenantID,
+			Source:       FindingSourceAWSConfig,
+			RuleID:       detail.ConfigRuleName,
+			Title:        fmt.Sprintf("%s is non-compliant with %s", detail.ResourceID, detail.ConfigRuleName),
+			Description:  detail.NewEvaluationResult.Annotation,
+			Severity:     "medium",
+			ResourceType: detail.ResourceType,
+			ResourceID:   detail.ResourceID,
+		})
+	case ComplianceCompliant:
+		fingerprint := findings.Fingerprint(FindingSourceAWSConfig, detail.ConfigRuleName, detail.ResourceType, detail.ResourceID)
+		_, err := store.Close(ctx, event.TenantID, fingerprint, findings.StatusResolved, "compliant in AWS Config")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+)
+
+// EventBatchFailure explains why one event or dead letter of a batch was not processed
+type EventBatchFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// EventBatchResult reports which events or dead letters of a batch were processed and which
+// were not
+type EventBatchResult struct {
+	Succeeded []string            `json:"succeeded"`
+	Failed    []EventBatchFailure `json:"failed"`
+}
+
+func newEventBatchResult() *EventBatchResult {
+	return &EventBatchResult{Succeeded: []string{}, Failed: []EventBatchFailure{}}
+}
+
+func (r *EventBatchResult) fail(id, err string) {
+	r.Failed = append(r.Failed, EventBatchFailure{ID: id, Error: err})
+}
+
+// ReplayEvents runs the tenant's selected stored events through the handlers again, typically
+// after a handler changed, and stores each outcome with its event. Events run in the order
+// given.
+func ReplayEvents(ctx context.Context, tenantID string, ids []string) (*EventBatchResult, error) {
+	store := events.Default()
+	if store == nil {
+		return nil, fmt.Errorf("event store is not initialized")
+	}
+	// Handlers that read more from the account need the credentials the queue is polled with
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	result := newEventBatchResult()
+	for _, id := range ids {
+		event, err := store.Get(ctx, tenantID, id)
+		if err != nil {
+			result.fail(id, err.Error())
+			continue
+		}
+		if event.Raw == "" {
+			result.fail(id, "event was stored without its message body")
+			continue
+		}
+
+		err = eventpipeline.Default().DispatchBody(ctx, tenantID, cfg, event.Raw)
+		if recordErr := store.RecordResult(ctx, tenantID, event.ID, err, true); recordErr != nil {
+			log.Printf("[Events] Warning: %v", recordErr)
+		}
+		if err != nil {
+			result.fail(id, err.Error())
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	log.Printf("[Events] Replayed %d of %d events for tenant %s", len(result.Succeeded), len(ids), tenantID)
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/rishichirchi/cloudloom/services/eventsubscriptions"
+)
+
+// EventSubscriptionUpdate reports a tenant's event subscription and the EventBridge rules its
+// pattern was applied to
+type EventSubscriptionUpdate struct {
+	Subscription *eventsubscriptions.Subscription `json:"subscription"`
+	EventPattern string                           `json:"eventPattern"`
+	// Regions are the monitored regions whose rule now matches the pattern
+	Regions []string `json:"regions"`
+	// MissingRegions are monitored regions without a rule; setup creates them with the pattern
+	MissingRegions []string `json:"missingRegions,omitempty"`
+}
+
+// GetEventSubscription returns the tenant's event subscription and the pattern its rules are
+// given
+func GetEventSubscription(ctx context.Context, tenantID string) (*EventSubscriptionUpdate, error) {
+	store := eventsubscriptions.Default()
+	if store == nil {
+		return nil, fmt.Errorf("event subscription store is not initialized")
+	}
+	subscription, err := store.Get(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := subscription.EventPattern()
+	if err != nil {
+		return nil, err
+	}
+	return &EventSubscriptionUpdate{Subscription: subscription, EventPattern: pattern, Regions: []string{}}, nil
+}
+
+// UpdateEventSubscription saves the tenant's event subscription, or resets it to the default
+// when subscription is nil, and applies its pattern to the rules in every monitored region.
+// The subscription is kept when applying fails, so running setup again applies it.
+func UpdateEventSubscription(ctx context.Context, tenantID string, subscription *eventsubscriptions.Subscription) (*EventSubscriptionUpdate, error) {
+	store := eventsubscriptions.Default()
+	if store == nil {
+		return nil, fmt.Errorf("event subscription store is not initialized")
+	}
+	if subscription == nil {
+		if err := store.Delete(ctx, tenantID); err != nil {
+			return nil, err
+		}
+		subscription = eventsubscriptions.DefaultSubscription(tenantID)
+	} else if err := store.Put(ctx, tenantID, subscription); err != nil {
+		return nil, err
+	}
+	pattern, err := subscription.EventPattern()
+	if err != nil {
+		return nil, err
+	}
+	update := &EventSubscriptionUpdate{Subscription: subscription, EventPattern: pattern, Regions: []string{}}
+
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	regions := s.monitoredRegions()
+	names := s.resourceNames(ctx, cfg, accountID, regions)
+	for _, region := range regions {
+		ruleName := names.rules[region]
+		client := eventbridge.NewFromConfig(inRegion(cfg, region))
+		// Only existing rules are updated: PutRule would create a rule without targets
+		_, err := client.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ruleName)})
+		if isNotFound(err) {
+			update.MissingRegions = append(update.MissingRegions, region)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe EventBridge rule in region %s: %w", region, err)
+		}
+		if _, err := s.putEventBridgeRule(ctx, client, ruleName); err != nil {
+			return nil, fmt.Errorf("failed to update EventBridge rule in region %s: %w", region, err)
+		}
+		update.Regions = append(update.Regions, region)
+	}
+	log.Printf("[EventBridge] Applied event subscription of tenant %s to rules in %d regions", tenantID, len(update.Regions))
+	return update, nil
+}
@@ -5,59 +5,134 @@ import (
     "context"
     "fmt"
     "log"
-    "time"
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/eventbridge"
     ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
     "github.com/aws/aws-sdk-go-v2/service/iam"
+    "github.com/rishichirchi/cloudloom/services/eventsubscriptions"
 )
 
-func (s *CloudTrailService) createEventBridgeRule(ctx context.Context, cfg aws.Config, ruleName, queueArn, eventBridgeRoleArn string) (string, error) {
-    eventBridgeClient := eventbridge.NewFromConfig(cfg)
-    fmt.Printf("[EventBridge] Setting up rule '%s'\n", ruleName)
+// eventPattern returns the pattern of the account's Auto Apply Fix rules, built from the
+// tenant's event subscription, or from the default subscription when the tenant has none or
+// it cannot be loaded. Matched findings are recorded by the queue poller's event handlers.
+func (s *CloudTrailService) eventPattern(ctx context.Context) (string, error) {
+    subscription := eventsubscriptions.DefaultSubscription("")
+    if store := eventsubscriptions.Default(); store != nil && s.tenant != nil {
+        stored, err := store.Get(ctx, s.tenant.AccountID)
+        if err != nil {
+            log.Printf("[EventBridge] Warning: using the default event subscription: %v", err)
+        } else {
+            subscription = stored
+        }
+    }
+    return subscription.EventPattern()
+}
 
-    // FIXED: A more robust and simpler event pattern.
-    // This captures all API calls from key services without needing a long, static list of event names.
-    // This is much more likely to catch the events you care about.
-    eventPattern := `{
-        "source": ["aws.s3", "aws.ec2", "aws.iam", "aws.rds", "aws.cloudformation"],
-        "detail-type": ["AWS API Call via CloudTrail"]
-    }`
+// autoApplyFixTargetID is the ID of the SQS target on each Auto Apply Fix rule
+const autoApplyFixTargetID = "CloudLoom-SQS-Target"
 
-    putRuleInput := &eventbridge.PutRuleInput{
-        Name:         aws.String(ruleName),
-        Description:  aws.String("CloudLoom Auto Apply Fix rule for AWS API events"),
-        EventPattern: aws.String(eventPattern),
-        State:        ebtypes.RuleStateEnabled,
-    }
+// createEventBridgeRule creates or updates the rule sending the account's API calls to the
+// notification topic, and to the queue when queueArn is set. The queue target is removed from
+// rules of tenants whose tier no longer has CloudLoom analyze their events.
+func (s *CloudTrailService) createEventBridgeRule(ctx context.Context, cfg aws.Config, ruleName, topicArn, queueArn, eventBridgeRoleArn string) (string, error) {
+    eventBridgeClient := eventbridge.NewFromConfig(cfg)
+    fmt.Printf("[EventBridge] Setting up rule '%s'\n", ruleName)
 
-    ruleResult, err := eventBridgeClient.PutRule(ctx, putRuleInput)
+    ruleArn, err := s.putEventBridgeRule(ctx, eventBridgeClient, ruleName)
     if err != nil {
-        return "", fmt.Errorf("failed to create or update EventBridge rule: %w", err)
+        return "", err
     }
-    fmt.Printf("[EventBridge] ✅ Rule created/updated successfully: %s\n", *ruleResult.RuleArn)
+    fmt.Printf("[EventBridge] ✅ Rule created/updated successfully: %s\n", ruleArn)
 
-    // Add SQS queue as the target
-    fmt.Printf("[EventBridge] Adding/updating SQS target...\n")
-    putTargetsInput := &eventbridge.PutTargetsInput{
-        Rule: aws.String(ruleName),
-        Targets: []ebtypes.Target{
-            {
-                Id:      aws.String("CloudLoom-SQS-Target"), // A more descriptive ID
-                Arn:     aws.String(queueArn),
-                RoleArn: aws.String(eventBridgeRoleArn),
-            },
+    // Add the SNS topic, and the SQS queue if events are analyzed, as the targets
+    fmt.Printf("[EventBridge] Adding/updating targets...\n")
+    targets := []ebtypes.Target{
+        {
+            Id:  aws.String(notificationTargetID),
+            Arn: aws.String(topicArn),
         },
     }
+    if queueArn != "" {
+        queueTarget := ebtypes.Target{
+            Id:      aws.String(autoApplyFixTargetID), // A more descriptive ID
+            Arn:     aws.String(queueArn),
+            RoleArn: aws.String(eventBridgeRoleArn),
+        }
+        if isFIFOQueue(queueArn) {
+            // Each region's events form one message group, processed in the order they arrive
+            queueTarget.SqsParameters = &ebtypes.SqsParameters{MessageGroupId: aws.String(cfg.Region)}
+        }
+        targets = append(targets, queueTarget)
+    }
+    // Topics the customer fans the events out to in this region
+    targets = append(targets, s.fanOutTargets(ctx, cfg.Region)...)
+    putTargetsInput := &eventbridge.PutTargetsInput{
+        Rule:    aws.String(ruleName),
+        Targets: targets,
+    }
 
     _, err = eventBridgeClient.PutTargets(ctx, putTargetsInput)
     if err != nil {
         return "", fmt.Errorf("failed to add targets to EventBridge rule: %w", err)
     }
-    fmt.Printf("[EventBridge] ✅ Target added/updated successfully\n")
+    fmt.Printf("[EventBridge] ✅ Targets added/updated successfully\n")
 
-    return *ruleResult.RuleArn, nil
+    if queueArn == "" {
+        // Removing a target the rule does not have is not an error
+        _, err = eventBridgeClient.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{
+            Rule: aws.String(ruleName),
+            Ids:  []string{autoApplyFixTargetID},
+        })
+        if err != nil {
+            return "", fmt.Errorf("failed to remove SQS target from EventBridge rule: %w", err)
+        }
+    }
+
+    return ruleArn, nil
+}
+
+// deleteEventBridgeRule removes every target of the rule, including the customer's fan-out
+// topics, then deletes it. The error of a rule that does not exist satisfies isNotFound.
+func deleteEventBridgeRule(ctx context.Context, client *eventbridge.Client, ruleName string) error {
+    targets, err := client.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(ruleName)})
+    if err != nil {
+        return fmt.Errorf("failed to list targets of EventBridge rule %s: %w", ruleName, err)
+    }
+    if len(targets.Targets) > 0 {
+        ids := make([]string, len(targets.Targets))
+        for i, target := range targets.Targets {
+            ids[i] = aws.ToString(target.Id)
+        }
+        _, err = client.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{Rule: aws.String(ruleName), Ids: ids})
+        if err != nil && !isNotFound(err) {
+            return fmt.Errorf("failed to remove targets of EventBridge rule %s: %w", ruleName, err)
+        }
+    }
+    _, err = client.DeleteRule(ctx, &eventbridge.DeleteRuleInput{Name: aws.String(ruleName)})
+    if err != nil {
+        return fmt.Errorf("failed to delete EventBridge rule %s: %w", ruleName, err)
+    }
+    return nil
+}
+
+// putEventBridgeRule creates or updates a rule with the tenant's event pattern, leaving its
+// targets as they are
+func (s *CloudTrailService) putEventBridgeRule(ctx context.Context, client *eventbridge.Client, ruleName string) (string, error) {
+    pattern, err := s.eventPattern(ctx)
+    if err != nil {
+        return "", err
+    }
+    ruleResult, err := client.PutRule(ctx, &eventbridge.PutRuleInput{
+        Name:         aws.String(ruleName),
+        Description:  aws.String("CloudLoom Auto Apply Fix rule for AWS API events"),
+        EventPattern: aws.String(pattern),
+        State:        ebtypes.RuleStateEnabled,
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to create or update EventBridge rule: %w", err)
+    }
+    return aws.ToString(ruleResult.RuleArn), nil
 }
 
 func (s *CloudTrailService) createEventBridgeIAMRole(ctx context.Context, cfg *aws.Config, accountID string, queueArn string) (string, error) {
@@ -84,6 +159,7 @@ func (s *CloudTrailService) createEventBridgeIAMRole(ctx context.Context, cfg *a
             return "", fmt.Errorf("failed to create EventBridge IAM role: %w", err)
         }
     }
+    s.tagRole(ctx, iamClient, roleName)
     
     // FIXED: Use a specific policy that ONLY allows sending to the created SQS queue.
     policyDocument := fmt.Sprintf(`{
@@ -104,8 +180,10 @@ func (s *CloudTrailService) createEventBridgeIAMRole(ctx context.Context, cfg *a
         return "", fmt.Errorf("failed to attach SQS SendMessage policy to EventBridge role: %w", err)
     }
     
-    // Give some time for role to propagate
-    time.Sleep(10 * time.Second)
+    // Wait until the role may send to the queue
+    if err := waitForRole(ctx, iamClient, roleName, "sqs:SendMessage", queueArn); err != nil {
+        return "", err
+    }
 
     // Return the constructed role ARN
     roleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, roleName)
@@ -0,0 +1,224 @@
+package eventpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Sources and detail types of the events the tenant queues receive
+const (
+	DetailTypeAPICall          = "AWS API Call via CloudTrail"
+	DetailTypeConsoleSignIn    = "AWS Console Sign In via CloudTrail"
+	SourceSecurityHub          = "aws.securityhub"
+	DetailTypeSecurityHub      = "Security Hub Findings - Imported"
+	SourceGuardDuty            = "aws.guardduty"
+	DetailTypeGuardDuty        = "GuardDuty Finding"
+	SourceConfig               = "aws.config"
+	DetailTypeConfigCompliance = "Config Rules Compliance Change"
+)
+
+// ErrMalformed is returned for message bodies that are not EventBridge events
+var ErrMalformed = errors.New("malformed event")
+
+// Envelope is an EventBridge event as delivered to a tenant's queue. Detail is left for the
+// handler to decode into the type of its source.
+type Envelope struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       time.Time       `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// Parse decodes a message body into an envelope. It returns ErrMalformed if the body is not
+// JSON or lacks a source or detail type.
+func Parse(body string) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if envelope.Source == "" || envelope.DetailType == "" {
+		return nil, fmt.Errorf("%w: no source or detail type", ErrMalformed)
+	}
+	return &envelope, nil
+}
+
+// DecodeDetail decodes the envelope's detail into v
+func (e *Envelope) DecodeDetail(v interface{}) error {
+	if err := json.Unmarshal(e.Detail, v); err != nil {
+		return fmt.Errorf("failed to decode %s detail: %w", e.DetailType, err)
+	}
+	return nil
+}
+
+// Event is an envelope received on a tenant's queue
+type Event struct {
+	*Envelope
+	// TenantID is the tenant whose queue the event was received on
+	TenantID string
+	// Body is the message as received
+	Body string
+	// Config holds the credentials the queue is polled with, for handlers that read more
+	// from the tenant's account
+	Config aws.Config
+}
+
+// Handler processes one event. A returned error is counted against the handler and logged.
+type Handler func(ctx context.Context, event *Event) error
+
+// HandlerStats are the counters of one registered handler
+type HandlerStats struct {
+	Name          string     `json:"name"`
+	Source        string     `json:"source,omitempty"`
+	DetailType    string     `json:"detailType,omitempty"`
+	Handled       int64      `json:"handled"`
+	Failed        int64      `json:"failed"`
+	AverageMillis float64    `json:"averageMillis"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastHandledAt *time.Time `json:"lastHandledAt,omitempty"`
+	totalDuration time.Duration
+}
+
+// Stats are the dispatcher's counters: per handler, and of events no handler took or that
+// could not be parsed
+type Stats struct {
+	Handlers  []HandlerStats `json:"handlers"`
+	Unmatched int64          `json:"unmatched"`
+	Malformed int64          `json:"malformed"`
+}
+
+type route struct {
+	source     string
+	detailType string
+	handler    Handler
+	stats      *HandlerStats
+}
+
+// matches reports whether the route takes the envelope; an empty source or detail type
+// matches any
+func (r *route) matches(envelope *Envelope) bool {
+	return (r.source == "" || r.source == envelope.Source) && (r.detailType == "" || r.detailType == envelope.DetailType)
+}
+
+// Dispatcher routes events to the handlers registered for their source and detail type
+type Dispatcher struct {
+	mu        sync.Mutex
+	routes    []*route
+	unmatched int64
+	malformed int64
+}
+
+var defaultDispatcher = New()
+
+// Default returns the process-wide dispatcher the queue pollers use
+func Default() *Dispatcher {
+	return defaultDispatcher
+}
+
+// New creates a Dispatcher without handlers
+func New() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Handle registers a handler under name for events of source and detailType. An empty source
+// or detail type matches any. Every matching handler gets each event.
+func (d *Dispatcher) Handle(name, source, detailType string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = append(d.routes, &route{
+		source:     source,
+		detailType: detailType,
+		handler:    handler,
+		stats:      &HandlerStats{Name: name, Source: source, DetailType: detailType},
+	})
+}
+
+// DispatchBody parses a message received on the tenant's queue and dispatches it
+func (d *Dispatcher) DispatchBody(ctx context.Context, tenantID string, cfg aws.Config, body string) error {
+	envelope, err := Parse(body)
+	if err != nil {
+		d.mu.Lock()
+		d.malformed++
+		d.mu.Unlock()
+		return err
+	}
+	return d.Dispatch(ctx, &Event{Envelope: envelope, TenantID: tenantID, Body: body, Config: cfg})
+}
+
+// Dispatch runs every handler matching the event in registration order. A failing or
+// panicking handler does not stop the others; their errors are returned joined.
+func (d *Dispatcher) Dispatch(ctx context.Context, event *Event) error {
+	d.mu.Lock()
+	var matched []*route
+	for _, r := range d.routes {
+		if r.matches(event.Envelope) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) == 0 {
+		d.unmatched++
+	}
+	d.mu.Unlock()
+
+	var errs []error
+	for _, r := range matched {
+		started := time.Now()
+		err := run(ctx, r.handler, event)
+		d.record(r, started, err)
+		if err != nil {
+			log.Printf("[Events] Warning: handler %s failed on %s event %s of tenant %s: %v", r.stats.Name, event.DetailType, event.ID, event.TenantID, err)
+			errs = append(errs, fmt.Errorf("%s: %w", r.stats.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run calls a handler, turning a panic into an error so one bad event cannot stop the poller
+func run(ctx context.Context, handler Handler, event *Event) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+func (d *Dispatcher) record(r *route, started time.Time, err error) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := r.stats
+	stats.Handled++
+	stats.totalDuration += now.Sub(started)
+	stats.AverageMillis = stats.totalDuration.Seconds() * 1000 / float64(stats.Handled)
+	stats.LastHandledAt = &now
+	if err != nil {
+		stats.Failed++
+		stats.LastError, stats.LastErrorAt = err.Error(), &now
+	}
+}
+
+// Stats returns a copy of the dispatcher's counters, handlers sorted by name
+func (d *Dispatcher) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := Stats{Handlers: make([]HandlerStats, 0, len(d.routes)), Unmatched: d.unmatched, Malformed: d.malformed}
+	for _, r := range d.routes {
+		stats.Handlers = append(stats.Handlers, *r.stats)
+	}
+	sort.Slice(stats.Handlers, func(i, j int) bool { return stats.Handlers[i].Name < stats.Handlers[j].Name })
+	return stats
+}
@@ -0,0 +1,262 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionEvents
+
+// ErrNotFound is returned when an event does not exist for the tenant
+var ErrNotFound = errors.New("event not found")
+
+// Event is an event delivered through EventBridge and the account's SQS queue. TenantID is the
+// account the event came from.
+type Event struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	TenantID   string                 `bson:"tenantId" json:"tenantId"`
+	EventID    string                 `bson:"eventId" json:"eventId"`
+	Source     string                 `bson:"source" json:"source"`
+	DetailType string                 `bson:"detailType" json:"detailType"`
+	Region     string                 `bson:"region,omitempty" json:"region,omitempty"`
+	EventTime  time.Time              `bson:"eventTime" json:"eventTime"`
+	ReceivedAt time.Time              `bson:"receivedAt" json:"receivedAt"`
+	Detail     map[string]interface{} `bson:"detail,omitempty" json:"detail,omitempty"`
+	// Raw is the message body as received, which replays run through the handlers again
+	Raw string `bson:"raw,omitempty" json:"raw,omitempty"`
+	// Processing is the outcome of the last run through the handlers; events submitted by
+	// agents are stored without running them
+	Processing *Processing `bson:"processing,omitempty" json:"processing,omitempty"`
+}
+
+// ProcessingStatus is whether the handlers processed an event
+type ProcessingStatus string
+
+const (
+	ProcessingSucceeded ProcessingStatus = "succeeded"
+	ProcessingFailed    ProcessingStatus = "failed"
+)
+
+// Processing is the outcome of running an event through the handlers
+type Processing struct {
+	Status ProcessingStatus `bson:"status" json:"status"`
+	Error  string           `bson:"error,omitempty" json:"error,omitempty"`
+	// Attempts counts the runs, including redeliveries and replays
+	Attempts       int        `bson:"attempts" json:"attempts"`
+	Replays        int        `bson:"replays,omitempty" json:"replays,omitempty"`
+	ProcessedAt    time.Time  `bson:"processedAt" json:"processedAt"`
+	LastReplayedAt *time.Time `bson:"lastReplayedAt,omitempty" json:"lastReplayedAt,omitempty"`
+}
+
+// envelope is the EventBridge event format
+type envelope struct {
+	ID         string                 `json:"id"`
+	Source     string                 `json:"source"`
+	DetailType string                 `json:"detail-type"`
+	Account    string                 `json:"account"`
+	Region     string                 `json:"region"`
+	Time       time.Time              `json:"time"`
+	Detail     map[string]interface{} `json:"detail"`
+}
+
+// Filter selects events for listing and export
+type Filter struct {
+	TenantID   string
+	Source     string
+	DetailType string
+	Region     string
+	Status     ProcessingStatus
+	From       time.Time
+	To         time.Time
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{"tenantId": f.TenantID}
+	if f.Source != "" {
+		query["source"] = f.Source
+	}
+	if f.DetailType != "" {
+		query["detailType"] = f.DetailType
+	}
+	if f.Region != "" {
+		query["region"] = f.Region
+	}
+	if f.Status != "" {
+		query["processing.status"] = f.Status
+	}
+	timeRange := bson.M{}
+	if !f.From.IsZero() {
+		timeRange["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		timeRange["$lt"] = f.To
+	}
+	if len(timeRange) > 0 {
+		query["eventTime"] = timeRange
+	}
+	return query
+}
+
+// Store persists received events in MongoDB
+type Store struct {
+	collection *mongo.Collection
+	processed  *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide event store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide event store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the events collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{
+		collection: db.Collection(collectionName),
+		processed:  db.Collection(ProcessedCollection),
+	}
+}
+
+// Record parses an EventBridge message body and stores it with the body as received.
+// Redelivered events (same EventBridge ID) are stored once, and the stored event is returned.
+func (s *Store) Record(ctx context.Context, body string) (*Event, error) {
+	var env envelope
+	if err := json.Unmarshal([]byte(body), &env); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if env.ID == "" {
+		return nil, fmt.Errorf("event has no id")
+	}
+
+	event := &Event{
+		TenantID:   env.Account,
+		EventID:    env.ID,
+		Source:     env.Source,
+		DetailType: env.DetailType,
+		Region:     env.Region,
+		EventTime:  env.Time,
+		ReceivedAt: time.Now(),
+		Detail:     env.Detail,
+		Raw:        body,
+	}
+
+	var stored Event
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"tenantId": event.TenantID, "eventId": event.EventID},
+		bson.M{"$setOnInsert": event},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store event %s: %w", event.EventID, err)
+	}
+	return &stored, nil
+}
+
+// RecordResult stores the outcome of running an event through the handlers, err being what
+// they returned. Replays are counted apart from deliveries.
+func (s *Store) RecordResult(ctx context.Context, tenantID string, id primitive.ObjectID, err error, replay bool) error {
+	now := time.Now()
+	set := bson.M{"processing.status": ProcessingSucceeded, "processing.processedAt": now}
+	inc := bson.M{"processing.attempts": 1}
+	update := bson.M{"$set": set, "$inc": inc}
+	if err != nil {
+		set["processing.status"] = ProcessingFailed
+		set["processing.error"] = err.Error()
+	} else {
+		update["$unset"] = bson.M{"processing.error": ""}
+	}
+	if replay {
+		set["processing.lastReplayedAt"] = now
+		inc["processing.replays"] = 1
+	}
+
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "tenantId": tenantID}, update); err != nil {
+		return fmt.Errorf("failed to record processing of event %s: %w", id.Hex(), err)
+	}
+	return nil
+}
+
+// Get returns one of the tenant's events
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Event, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var event Event
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event %s: %w", id, err)
+	}
+	return &event, nil
+}
+
+// List returns the events matching the filter, most recent first and without their raw
+// bodies, which Get returns
+func (s *Store) List(ctx context.Context, filter Filter, limit int64) ([]Event, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "eventTime", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"raw": 0})
+
+	cursor, err := s.collection.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Event{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+	return result, nil
+}
+
+// Cursor returns a cursor over events matching the filter in event-time order,
+// so large result sets can be streamed instead of loaded at once
+func (s *Store) Cursor(ctx context.Context, filter Filter, skip, limit int64) (*mongo.Cursor, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "eventTime", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	return cursor, nil
+}
+
+// Count returns the number of events matching the filter, counting no further than limit
+// when it is positive
+func (s *Store) Count(ctx context.Context, filter Filter, limit int64) (int64, error) {
+	opts := options.Count()
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	count, err := s.collection.CountDocuments(ctx, filter.query(), opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count events: %w", err)
+	}
+	return count, nil
+}
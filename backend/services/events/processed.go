@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProcessedCollection holds the IDs of handled SQS messages and events, so redeliveries on a
+// standard queue are not handled twice
+const ProcessedCollection = "processed_events"
+
+// ProcessedTTL is how long processed SQS message IDs are remembered for de-duplication
+const ProcessedTTL = 7 * 24 * time.Hour
+
+func init() {
+	config.RegisterIndexes(ProcessedCollection,
+		mongo.IndexModel{Keys: bson.D{{Key: "processedAt", Value: 1}}, Options: options.Index().SetName("processedAt_ttl").SetExpireAfterSeconds(int32(ProcessedTTL.Seconds()))},
+	)
+}
+
+// MarkProcessed records that an SQS message, or the event of EventKey, was handled and reports whether this is the
+// first time it was seen. Entries expire after ProcessedTTL.
+func (s *Store) MarkProcessed(ctx context.Context, messageID string) (bool, error) {
+	_, err := s.processed.InsertOne(ctx, bson.M{"_id": messageID, "processedAt": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to mark message %s processed: %w", messageID, err)
+	}
+	return true, nil
+}
+
+// EventKey is the key MarkProcessed keeps an EventBridge event's mark under, apart from the
+// marks of SQS messages
+func EventKey(tenantID, eventID string) string {
+	return "event:" + tenantID + ":" + eventID
+}
+
+// ClearProcessed forgets that an SQS message was handled, so the redelivery of a message whose
+// processing failed is handled again rather than skipped as a duplicate
+func (s *Store) ClearProcessed(ctx context.Context, messageID string) error {
+	if _, err := s.processed.DeleteOne(ctx, bson.M{"_id": messageID}); err != nil {
+		return fmt.Errorf("failed to clear processed mark of message %s: %w", messageID, err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package eventsubscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionEventSubscriptions
+
+// ErrInvalid is returned when a subscription names an unknown service, source or severity, or
+// matches nothing
+var ErrInvalid = errors.New("invalid event subscription")
+
+// Sources of findings a subscription may match besides API calls
+const (
+	FindingSourceSecurityHub = "securityhub"
+	FindingSourceGuardDuty   = "guardduty"
+	FindingSourceConfig      = "config"
+)
+
+// severities are the finding severities from lowest to highest
+var severities = []string{"informational", "low", "medium", "high", "critical"}
+
+// guardDutyMinimum is the lowest GuardDuty severity score of each severity
+var guardDutyMinimum = map[string]float64{"informational": 0, "low": 0, "medium": 4, "high": 7, "critical": 9}
+
+var (
+	servicePattern   = regexp.MustCompile(`^[a-z0-9-]+$`)
+	eventNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	regionPattern    = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d$`)
+)
+
+// Subscription is what a tenant's EventBridge rules send CloudLoom: API calls of some AWS
+// services and findings of some sources, optionally narrowed by event name, region and
+// finding severity
+type Subscription struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	// Services are the services whose CloudTrail API calls are matched, by the name in their
+	// event source, e.g. "s3" for aws.s3. Console sign-ins are matched by "signin".
+	Services []string `bson:"services" json:"services"`
+	// EventNames narrows the API calls to these names, e.g. "PutBucketPolicy"; empty matches
+	// every call of the services
+	EventNames []string `bson:"eventNames,omitempty" json:"eventNames,omitempty"`
+	// FindingSources are the finding sources matched: securityhub, guardduty and config
+	FindingSources []string `bson:"findingSources" json:"findingSources"`
+	// MinSeverity drops Security Hub and GuardDuty findings below this severity; empty keeps all
+	MinSeverity string `bson:"minSeverity,omitempty" json:"minSeverity,omitempty"`
+	// Regions narrows every event to these monitored regions; empty matches them all
+	Regions   []string  `bson:"regions,omitempty" json:"regions,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// DefaultSubscription is the subscription of tenants that did not define one: API calls of the
+// services CloudLoom fixes or watches for anomalies, console sign-ins, and every finding
+func DefaultSubscription(tenantID string) *Subscription {
+	return &Subscription{
+		TenantID:       tenantID,
+		Services:       []string{"cloudformation", "cloudtrail", "config", "ec2", "guardduty", "iam", "rds", "s3", "signin"},
+		FindingSources: []string{FindingSourceConfig, FindingSourceGuardDuty, FindingSourceSecurityHub},
+	}
+}
+
+// Normalize validates the subscription and sorts and de-duplicates its lists
+func (s *Subscription) Normalize() error {
+	var err error
+	if s.Services, err = normalizeList(s.Services, "service", strings.ToLower, servicePattern.MatchString); err != nil {
+		return err
+	}
+	if s.EventNames, err = normalizeList(s.EventNames, "event name", nil, eventNamePattern.MatchString); err != nil {
+		return err
+	}
+	if s.Regions, err = normalizeList(s.Regions, "region", strings.ToLower, regionPattern.MatchString); err != nil {
+		return err
+	}
+	if s.FindingSources, err = normalizeList(s.FindingSources, "finding source", strings.ToLower, func(source string) bool {
+		return source == FindingSourceSecurityHub || source == FindingSourceGuardDuty || source == FindingSourceConfig
+	}); err != nil {
+		return err
+	}
+	s.MinSeverity = strings.ToLower(s.MinSeverity)
+	if s.MinSeverity != "" && severityRank(s.MinSeverity) < 0 {
+		return fmt.Errorf("%w: severity '%s' is not one of %s", ErrInvalid, s.MinSeverity, strings.Join(severities, ", "))
+	}
+	if len(s.EventNames) > 0 && len(s.Services) == 0 {
+		return fmt.Errorf("%w: event names need at least one service", ErrInvalid)
+	}
+	if len(s.Services) == 0 && len(s.FindingSources) == 0 {
+		return fmt.Errorf("%w: at least one service or finding source is required", ErrInvalid)
+	}
+	return nil
+}
+
+func normalizeList(values []string, kind string, transform func(string) string, valid func(string) bool) ([]string, error) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if transform != nil {
+			value = transform(value)
+		}
+		if !valid(value) {
+			return nil, fmt.Errorf("%w: '%s' is not a valid %s", ErrInvalid, value, kind)
+		}
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// EventPattern builds the EventBridge pattern matching the subscription, one alternative per
+// kind of event
+func (s *Subscription) EventPattern() (string, error) {
+	var alternatives []map[string]interface{}
+	if len(s.Services) > 0 {
+		sources := make([]string, len(s.Services))
+		for i, service := range s.Services {
+			sources[i] = "aws." + service
+		}
+		apiCalls := s.alternative(sources, eventpipeline.DetailTypeAPICall, eventpipeline.DetailTypeConsoleSignIn)
+		if len(s.EventNames) > 0 {
+			apiCalls["detail"] = map[string]interface{}{"eventName": s.EventNames}
+		}
+		alternatives = append(alternatives, apiCalls)
+	}
+
+	minimum := max(severityRank(s.MinSeverity), 0)
+	for _, source := range s.FindingSources {
+		switch source {
+		case FindingSourceSecurityHub:
+			findings := s.alternative([]string{eventpipeline.SourceSecurityHub}, eventpipeline.DetailTypeSecurityHub)
+			if minimum > 0 {
+				labels := []string{}
+				for _, severity := range severities[minimum:] {
+					labels = append(labels, strings.ToUpper(severity))
+				}
+				findings["detail"] = map[string]interface{}{
+					"findings": map[string]interface{}{"Severity": map[string]interface{}{"Label": labels}},
+				}
+			}
+			alternatives = append(alternatives, findings)
+		case FindingSourceGuardDuty:
+			findings := s.alternative([]string{eventpipeline.SourceGuardDuty}, eventpipeline.DetailTypeGuardDuty)
+			if minimum > 0 {
+				findings["detail"] = map[string]interface{}{
+					"severity": []interface{}{map[string]interface{}{"numeric": []interface{}{">=", guardDutyMinimum[severities[minimum]]}}},
+				}
+			}
+			alternatives = append(alternatives, findings)
+		case FindingSourceConfig:
+			alternatives = append(alternatives, s.alternative([]string{eventpipeline.SourceConfig}, eventpipeline.DetailTypeConfigCompliance))
+		}
+	}
+
+	if len(alternatives) == 0 {
+		return "", fmt.Errorf("%w: it matches no events", ErrInvalid)
+	}
+	var pattern interface{} = alternatives[0]
+	if len(alternatives) > 1 {
+		pattern = map[string]interface{}{"$or": alternatives}
+	}
+	encoded, err := json.Marshal(pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event pattern: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func (s *Subscription) alternative(sources []string, detailTypes ...string) map[string]interface{} {
+	alternative := map[string]interface{}{"source": sources, "detail-type": detailTypes}
+	if len(s.Regions) > 0 {
+		alternative["region"] = s.Regions
+	}
+	return alternative
+}
+
+// Store persists per-tenant event subscriptions in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide event subscription store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide event subscription store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the event_subscriptions collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Get returns the tenant's subscription, or DefaultSubscription when the tenant has not
+// defined one
+func (s *Store) Get(ctx context.Context, tenantID string) (*Subscription, error) {
+	var subscription Subscription
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&subscription)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return DefaultSubscription(tenantID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// Put validates the subscription and replaces the tenant's subscription with it
+func (s *Store) Put(ctx context.Context, tenantID string, subscription *Subscription) error {
+	if err := subscription.Normalize(); err != nil {
+		return err
+	}
+	subscription.TenantID = tenantID
+	subscription.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"tenantId": tenantID}, subscription, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save event subscription: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the tenant's subscription, returning it to DefaultSubscription
+func (s *Store) Delete(ctx context.Context, tenantID string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"tenantId": tenantID}); err != nil {
+		return fmt.Errorf("failed to delete event subscription: %w", err)
+	}
+	return nil
+}
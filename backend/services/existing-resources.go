@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cttypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// ErrExistingTrailUnusable is returned when the trail a tenant asked setup to reuse does not
+// record what CloudLoom needs and setup may not change it
+var ErrExistingTrailUnusable = errors.New("existing trail cannot be used")
+
+// existingBucketStatementPrefix starts the Sid of each statement setup adds to the policy of a
+// customer's existing bucket, so they can be told apart from the customer's own and removed
+const existingBucketStatementPrefix = "CloudLoom"
+
+// ExistingTrail is a customer's trail setup reuses instead of creating one
+type ExistingTrail struct {
+	Arn    string `json:"arn"`
+	Bucket string `json:"bucket"`
+	// Owned is set when the trail belongs to the tenant's account, so setup may change it. An
+	// organization trail is owned by the management account.
+	Owned bool `json:"owned"`
+}
+
+func (s *CloudTrailService) existingTrailArn() string {
+	if s.tenant != nil {
+		return s.tenant.ExistingTrailArn
+	}
+	return ""
+}
+
+func (s *CloudTrailService) existingBucketName() string {
+	if s.tenant != nil {
+		return s.tenant.ExistingBucketName
+	}
+	return ""
+}
+
+// useExistingTrail checks the trail records the management events of every region and is
+// logging. A trail the account owns is started if stopped and has the tenant's data event and
+// Insights selectors added to its own; one it does not own must already be logging and may
+// not be asked for more events.
+func useExistingTrail(ctx context.Context, cfg aws.Config, accountID, trailArn string, events tenants.TrailEvents) (*ExistingTrail, error) {
+	client := cloudtrail.NewFromConfig(cfg)
+	described, err := client.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{
+		TrailNameList:       []string{trailArn},
+		IncludeShadowTrails: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trail %s: %w", trailArn, err)
+	}
+	if len(described.TrailList) == 0 {
+		return nil, fmt.Errorf("%w: trail %s not found", ErrExistingTrailUnusable, trailArn)
+	}
+	trail := described.TrailList[0]
+	existing := &ExistingTrail{
+		Arn:    aws.ToString(trail.TrailARN),
+		Bucket: aws.ToString(trail.S3BucketName),
+		Owned:  principalAccount(aws.ToString(trail.TrailARN)) == accountID,
+	}
+	if !aws.ToBool(trail.IsMultiRegionTrail) {
+		return nil, fmt.Errorf("%w: %s is not a multi-region trail", ErrExistingTrailUnusable, existing.Arn)
+	}
+
+	status, err := client.GetTrailStatus(ctx, &cloudtrail.GetTrailStatusInput{Name: aws.String(existing.Arn)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of trail %s: %w", existing.Arn, err)
+	}
+	if !aws.ToBool(status.IsLogging) {
+		if !existing.Owned {
+			return nil, fmt.Errorf("%w: %s is not logging", ErrExistingTrailUnusable, existing.Arn)
+		}
+		log.Printf("[CloudTrail] Starting logging on existing trail %s", existing.Arn)
+		if _, err := client.StartLogging(ctx, &cloudtrail.StartLoggingInput{Name: aws.String(existing.Arn)}); err != nil {
+			return nil, fmt.Errorf("failed to start logging on %s: %w", existing.Arn, err)
+		}
+	}
+
+	selectors, err := client.GetEventSelectors(ctx, &cloudtrail.GetEventSelectorsInput{TrailName: aws.String(existing.Arn)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event selectors of %s: %w", existing.Arn, err)
+	}
+	if !recordsManagementEvents(selectors) {
+		return nil, fmt.Errorf("%w: %s does not record read and write management events", ErrExistingTrailUnusable, existing.Arn)
+	}
+	if err := addTrailSelectors(ctx, client, existing, selectors, events); err != nil {
+		return nil, err
+	}
+	log.Printf("[CloudTrail] ✅ Using existing trail %s delivering to %s", existing.Arn, existing.Bucket)
+	return existing, nil
+}
+
+// recordsManagementEvents reports whether a trail's selectors record every management event
+func recordsManagementEvents(selectors *cloudtrail.GetEventSelectorsOutput) bool {
+	for _, selector := range selectors.EventSelectors {
+		if aws.ToBool(selector.IncludeManagementEvents) && selector.ReadWriteType == cttypes.ReadWriteTypeAll {
+			return true
+		}
+	}
+	for _, selector := range selectors.AdvancedEventSelectors {
+		management, readOnly := false, false
+		for _, field := range selector.FieldSelectors {
+			switch aws.ToString(field.Field) {
+			case "eventCategory":
+				management = containsString(field.Equals, "Management")
+			case "readOnly":
+				readOnly = true
+			}
+		}
+		if management && !readOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// addTrailSelectors adds the data event and Insights selectors the tenant asked for to those
+// the trail already has, leaving the customer's own selectors as they are
+func addTrailSelectors(ctx context.Context, client *cloudtrail.Client, trail *ExistingTrail, current *cloudtrail.GetEventSelectorsOutput, events tenants.TrailEvents) error {
+	// The first of trailEventSelectors is for management events, which the trail records
+	wanted := trailEventSelectors(trail.Bucket, events)[1:]
+	if len(wanted) == 0 && !events.Insights {
+		return nil
+	}
+	if !trail.Owned {
+		return fmt.Errorf("%w: data events and Insights cannot be added to %s, which belongs to another account", ErrExistingTrailUnusable, trail.Arn)
+	}
+
+	if len(wanted) > 0 {
+		if len(current.EventSelectors) > 0 {
+			return fmt.Errorf("%w: %s uses basic event selectors; switch it to advanced event selectors to add data events", ErrExistingTrailUnusable, trail.Arn)
+		}
+		selectors := current.AdvancedEventSelectors
+		for _, selector := range wanted {
+			if !hasAdvancedSelector(selectors, aws.ToString(selector.Name)) {
+				selectors = append(selectors, selector)
+			}
+		}
+		if len(selectors) > len(current.AdvancedEventSelectors) {
+			_, err := client.PutEventSelectors(ctx, &cloudtrail.PutEventSelectorsInput{TrailName: aws.String(trail.Arn), AdvancedEventSelectors: selectors})
+			if err != nil {
+				return fmt.Errorf("failed to add event selectors to %s: %w", trail.Arn, err)
+			}
+		}
+	}
+
+	if events.Insights {
+		insights, err := client.GetInsightSelectors(ctx, &cloudtrail.GetInsightSelectorsInput{TrailName: aws.String(trail.Arn)})
+		if err != nil && !strings.Contains(err.Error(), "InsightNotEnabledException") {
+			return fmt.Errorf("failed to get Insights selectors of %s: %w", trail.Arn, err)
+		}
+		var selectors []cttypes.InsightSelector
+		if insights != nil {
+			selectors = insights.InsightSelectors
+		}
+		added := false
+		for _, selector := range trailInsightSelectors(events) {
+			if !hasInsightSelector(selectors, selector.InsightType) {
+				selectors, added = append(selectors, selector), true
+			}
+		}
+		if added {
+			_, err := client.PutInsightSelectors(ctx, &cloudtrail.PutInsightSelectorsInput{TrailName: aws.String(trail.Arn), InsightSelectors: selectors})
+			if err != nil {
+				return fmt.Errorf("failed to add Insights selectors to %s: %w", trail.Arn, err)
+			}
+		}
+	}
+	return nil
+}
+
+func hasAdvancedSelector(selectors []cttypes.AdvancedEventSelector, name string) bool {
+	for _, selector := range selectors {
+		if aws.ToString(selector.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasInsightSelector(selectors []cttypes.InsightSelector, insightType cttypes.InsightType) bool {
+	for _, selector := range selectors {
+		if selector.InsightType == insightType {
+			return true
+		}
+	}
+	return false
+}
+
+// existingBucketStatements are the statements letting CloudTrail and AWS Config deliver the
+// account's logs to a customer's existing bucket
+func existingBucketStatements(bucketName, accountID string) []map[string]interface{} {
+	bucketArn := "arn:aws:s3:::" + bucketName
+	sourceAccount := map[string]interface{}{"StringEquals": map[string]string{"AWS:SourceAccount": accountID}}
+	return []map[string]interface{}{
+		{
+			"Sid":       existingBucketStatementPrefix + "CloudTrailAclCheck",
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "cloudtrail.amazonaws.com"},
+			"Action":    "s3:GetBucketAcl",
+			"Resource":  bucketArn,
+			"Condition": sourceAccount,
+		},
+		{
+			"Sid":       existingBucketStatementPrefix + "CloudTrailWrite",
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "cloudtrail.amazonaws.com"},
+			"Action":    "s3:PutObject",
+			"Resource":  fmt.Sprintf("%s/AWSLogs/%s/*", bucketArn, accountID),
+			"Condition": map[string]interface{}{"StringEquals": map[string]string{"s3:x-amz-acl": "bucket-owner-full-control", "AWS:SourceAccount": accountID}},
+		},
+		{
+			"Sid":       existingBucketStatementPrefix + "ConfigAclCheck",
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "config.amazonaws.com"},
+			"Action":    []string{"s3:GetBucketAcl", "s3:ListBucket"},
+			"Resource":  bucketArn,
+			"Condition": sourceAccount,
+		},
+		{
+			"Sid":       existingBucketStatementPrefix + "ConfigWrite",
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "config.amazonaws.com"},
+			"Action":    "s3:PutObject",
+			"Resource":  fmt.Sprintf("%s/config/AWSLogs/%s/Config/*", bucketArn, accountID),
+			"Condition": map[string]interface{}{"StringEquals": map[string]string{"s3:x-amz-acl": "bucket-owner-full-control", "AWS:SourceAccount": accountID}},
+		},
+	}
+}
+
+// augmentBucketPolicy adds CloudLoom's delivery statements to the policy of a customer's
+// existing bucket, replacing those an earlier setup added and keeping every other statement
+func augmentBucketPolicy(ctx context.Context, cfg aws.Config, bucketName, accountID string) error {
+	client := s3.NewFromConfig(cfg)
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err != nil {
+		return fmt.Errorf("existing bucket %s is not accessible: %w", bucketName, err)
+	}
+	policy, err := bucketPolicyWithout(ctx, client, bucketName)
+	if err != nil {
+		return err
+	}
+	for _, statement := range existingBucketStatements(bucketName, accountID) {
+		policy.Statement = append(policy.Statement, statement)
+	}
+	return putBucketPolicy(ctx, client, bucketName, policy)
+}
+
+// removeBucketPolicyStatements removes the statements augmentBucketPolicy added, deleting the
+// policy if nothing else is left in it
+func removeBucketPolicyStatements(ctx context.Context, cfg aws.Config, bucketName string) error {
+	client := s3.NewFromConfig(cfg)
+	policy, err := bucketPolicyWithout(ctx, client, bucketName)
+	if err != nil {
+		return err
+	}
+	if len(policy.Statement) == 0 {
+		_, err := client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(bucketName)})
+		return err
+	}
+	return putBucketPolicy(ctx, client, bucketName, policy)
+}
+
+// bucketPolicy is a bucket policy with its statements left undecoded, so statements CloudLoom
+// does not manage are written back exactly as they were
+type bucketPolicy struct {
+	Version   string        `json:"Version"`
+	ID        string        `json:"Id,omitempty"`
+	Statement []interface{} `json:"Statement"`
+}
+
+// bucketPolicyWithout returns the bucket's policy without the statements CloudLoom added
+func bucketPolicyWithout(ctx context.Context, client *s3.Client, bucketName string) (*bucketPolicy, error) {
+	policy := &bucketPolicy{Version: "2012-10-17"}
+	out, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		// A bucket without a policy reports NoSuchBucketPolicy
+		if strings.Contains(err.Error(), "NoSuchBucketPolicy") {
+			return policy, nil
+		}
+		return nil, fmt.Errorf("failed to get policy of bucket %s: %w", bucketName, err)
+	}
+
+	var current struct {
+		Version   string            `json:"Version"`
+		ID        string            `json:"Id"`
+		Statement []json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(out.Policy)), &current); err != nil {
+		return nil, fmt.Errorf("failed to parse policy of bucket %s: %w", bucketName, err)
+	}
+	policy.Version, policy.ID = current.Version, current.ID
+	for _, raw := range current.Statement {
+		var statement struct {
+			Sid string `json:"Sid"`
+		}
+		json.Unmarshal(raw, &statement)
+		if !strings.HasPrefix(statement.Sid, existingBucketStatementPrefix) {
+			policy.Statement = append(policy.Statement, raw)
+		}
+	}
+	return policy, nil
+}
+
+func putBucketPolicy(ctx context.Context, client *s3.Client, bucketName string, policy *bucketPolicy) error {
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{Bucket: aws.String(bucketName), Policy: aws.String(string(document))})
+	if err != nil {
+		return fmt.Errorf("failed to set policy of bucket %s: %w", bucketName, err)
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// FindingSourceExposure marks findings produced by the exposure analyzer
+const FindingSourceExposure = "exposure"
+
+// Kinds of public exposure, also the rule IDs of their findings
+const (
+	ExposureS3PublicAccess     = "s3-public-access-not-blocked"
+	ExposureOpenSecurityGroup  = "security-group-open-sensitive-port"
+	ExposurePublicRDS          = "rds-instance-publicly-accessible"
+	ExposurePublicAMI          = "ami-public"
+	ExposurePublicSnapshot     = "snapshot-public"
+	ExposureUnauthenticatedAPI = "api-unauthenticated"
+	ExposurePublicLambda       = "lambda-public-policy"
+)
+
+// Kinds of public artifact
+const (
+	ArtifactAMI         = "ami"
+	ArtifactEBSSnapshot = "ebs_snapshot"
+)
+
+// defaultSensitivePorts are the ports the analyzer flags when a security group opens them to
+// the internet, by the service usually listening on them
+var defaultSensitivePorts = map[int]string{
+	20: "FTP data", 21: "FTP", 22: "SSH", 23: "Telnet", 445: "SMB", 1433: "SQL Server",
+	1521: "Oracle", 2375: "Docker", 2379: "etcd", 3306: "MySQL", 3389: "RDP", 5432: "PostgreSQL",
+	5601: "Kibana", 5900: "VNC", 6379: "Redis", 9200: "Elasticsearch", 11211: "Memcached",
+	27017: "MongoDB",
+}
+
+// s3PublicAccessFlags are the settings that together block all public access to a bucket
+var s3PublicAccessFlags = []string{"blockPublicAcls", "ignorePublicAcls", "blockPublicPolicy", "restrictPublicBuckets"}
+
+// PublicArtifact is an AMI or EBS snapshot the account shares with everyone. AWS Config does
+// not record launch and restore permissions, so scans collect these separately.
+type PublicArtifact struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Region string `json:"region"`
+}
+
+// ExposureFinding is a resource reachable or readable from the internet
+type ExposureFinding struct {
+	Kind         string `json:"kind"`
+	Severity     string `json:"severity"`
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Title        string `json:"title"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+// ExposureReport is the public exposure of a snapshot
+type ExposureReport struct {
+	Snapshot   InventorySnapshot `json:"snapshot"`
+	BySeverity map[string]int    `json:"bySeverity"`
+	ByKind     map[string]int    `json:"byKind"`
+	Findings   []ExposureFinding `json:"findings"`
+}
+
+// ExposureAnalyzer post-processes an inventory to find publicly exposed resources: S3 buckets
+// without a full public access block, security groups open to the internet on sensitive
+// ports, publicly accessible RDS instances, public AMIs and snapshots, and APIs callable
+// without authentication
+type ExposureAnalyzer struct {
+	// SensitivePorts are flagged when open to 0.0.0.0/0 or ::/0, by service name
+	SensitivePorts map[int]string
+}
+
+// NewExposureAnalyzer returns an analyzer flagging the default sensitive ports
+func NewExposureAnalyzer() *ExposureAnalyzer {
+	return &ExposureAnalyzer{SensitivePorts: defaultSensitivePorts}
+}
+
+// Analyze returns the exposure findings of an inventory, most severe first
+func (a *ExposureAnalyzer) Analyze(inventory *ResourceInventory) []ExposureFinding {
+	result := []ExposureFinding{}
+	accountBlock := map[string]bool{}
+	for _, item := range inventory.Resources {
+		if item.ResourceType == "AWS::S3::AccountPublicAccessBlock" {
+			for flag, on := range publicAccessBlock(normalizedConfig(item.Configuration)) {
+				accountBlock[flag] = accountBlock[flag] || on
+			}
+		}
+	}
+
+	for _, item := range inventory.Resources {
+		config := normalizedConfig(item.Configuration)
+		switch item.ResourceType {
+		case "AWS::S3::Bucket":
+			if finding, ok := a.checkBucket(item, config, accountBlock); ok {
+				result = append(result, finding)
+			}
+		case "AWS::EC2::SecurityGroup":
+			if finding, ok := a.checkSecurityGroup(item, config); ok {
+				result = append(result, finding)
+			}
+		case "AWS::RDS::DBInstance":
+			if publiclyAccessible, _ := configValue(config, "publiclyAccessible").(bool); publiclyAccessible {
+				result = append(result, exposureFinding(item, ExposurePublicRDS, "high",
+					fmt.Sprintf("RDS instance %s is publicly accessible", displayName(item)),
+					"The instance has a public DNS name; only its security groups restrict who can connect."))
+			}
+		case "AWS::RDS::DBSnapshot", "AWS::RDS::DBClusterSnapshot":
+			if rdsSnapshotPublic(normalizedConfig(item.SupplementaryConfiguration)) {
+				result = append(result, exposureFinding(item, ExposurePublicSnapshot, "high",
+					fmt.Sprintf("RDS snapshot %s can be restored by any AWS account", displayName(item)), ""))
+			}
+		case "AWS::Lambda::Function":
+			if grants := publicGrants(item); len(grants) > 0 {
+				result = append(result, exposureFinding(item, ExposurePublicLambda, "high",
+					fmt.Sprintf("Lambda function %s can be invoked by anyone", displayName(item)),
+					"Its resource policy allows everyone without conditions: "+strings.Join(grants, "; ")))
+			}
+		}
+	}
+
+	for _, artifact := range inventory.PublicArtifacts {
+		finding := ExposureFinding{Kind: ExposurePublicAMI, Severity: "medium", ResourceType: "AWS::EC2::Image", ResourceID: artifact.ID, ResourceName: artifact.Name, Region: artifact.Region,
+			Title: fmt.Sprintf("AMI %s is public", artifact.ID), Detail: "Any AWS account can launch instances from the image and read its volumes."}
+		if artifact.Kind == ArtifactEBSSnapshot {
+			finding.Kind, finding.Severity, finding.ResourceType = ExposurePublicSnapshot, "high", "AWS::EC2::Snapshot"
+			finding.Title, finding.Detail = fmt.Sprintf("EBS snapshot %s can be restored by any AWS account", artifact.ID), ""
+		}
+		result = append(result, finding)
+	}
+
+	for _, endpoint := range inventory.PublicExposure {
+		if len(endpoint.Unauthenticated) == 0 && !endpoint.OpenPolicy {
+			continue
+		}
+		name := endpoint.Name
+		if name == "" {
+			name = endpoint.ResourceID
+		}
+		finding := ExposureFinding{Kind: ExposureUnauthenticatedAPI, Severity: "medium", ResourceType: endpoint.ResourceType, ResourceID: endpoint.ResourceID, ResourceName: endpoint.Name,
+			Title: fmt.Sprintf("API %s can be called without authentication", name)}
+		if len(endpoint.Unauthenticated) > 0 {
+			finding.Detail = "No authorizer on: " + strings.Join(endpoint.Unauthenticated, ", ")
+		}
+		if endpoint.OpenPolicy {
+			finding.Severity = "high"
+			finding.Detail = strings.TrimSpace(finding.Detail + " Its resource policy allows everyone.")
+		}
+		result = append(result, finding)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return severityRank(result[i].Severity) > severityRank(result[j].Severity)
+	})
+	return result
+}
+
+func (a *ExposureAnalyzer) checkBucket(item ConfigurationItem, config map[string]interface{}, accountBlock map[string]bool) (ExposureFinding, bool) {
+	block := publicAccessBlock(config)
+	if len(block) == 0 {
+		block = publicAccessBlock(normalizedConfig(item.SupplementaryConfiguration))
+	}
+	var missing []string
+	for _, flag := range s3PublicAccessFlags {
+		if !block[flag] && !accountBlock[flag] {
+			missing = append(missing, flag)
+		}
+	}
+	if len(missing) == 0 {
+		return ExposureFinding{}, false
+	}
+	return exposureFinding(item, ExposureS3PublicAccess, "medium",
+		fmt.Sprintf("S3 bucket %s does not block public access", displayName(item)),
+		"Not enabled on the bucket or the account: "+strings.Join(missing, ", ")), true
+}
+
+func (a *ExposureAnalyzer) checkSecurityGroup(item ConfigurationItem, config map[string]interface{}) (ExposureFinding, bool) {
+	var open []string
+	for _, raw := range configList(config, "ipPermissions") {
+		permission, _ := raw.(map[string]interface{})
+		if permission == nil || !openToInternet(permission) {
+			continue
+		}
+		// Protocol -1 means all protocols and ports; ICMP and others have no ports
+		protocol := stringValue(configValue(permission, "ipProtocol"))
+		if protocol != "-1" && protocol != "tcp" && protocol != "6" && protocol != "udp" && protocol != "17" {
+			continue
+		}
+		from, hasFrom := configValue(permission, "fromPort").(float64)
+		to, hasTo := configValue(permission, "toPort").(float64)
+		allPorts := protocol == "-1" || !hasFrom || !hasTo || (from <= 0 && to >= 65535)
+		for port, service := range a.SensitivePorts {
+			if allPorts || (float64(port) >= from && float64(port) <= to) {
+				open = appendUnique(open, fmt.Sprintf("%d (%s)", port, service))
+			}
+		}
+	}
+	if len(open) == 0 {
+		return ExposureFinding{}, false
+	}
+	sort.Strings(open)
+	return exposureFinding(item, ExposureOpenSecurityGroup, "high",
+		fmt.Sprintf("Security group %s allows internet access to sensitive ports", displayName(item)),
+		"Open to 0.0.0.0/0 or ::/0: "+strings.Join(open, ", ")), true
+}
+
+// openToInternet reports whether an ingress permission allows any IPv4 or IPv6 address.
+// Config records the ranges as plain strings in ipRanges and as objects in ipv4Ranges and
+// ipv6Ranges.
+func openToInternet(permission map[string]interface{}) bool {
+	for _, field := range []string{"ipRanges", "ipv4Ranges", "ipv6Ranges"} {
+		for _, r := range configList(permission, field) {
+			cidr := stringValue(r)
+			if m, ok := r.(map[string]interface{}); ok {
+				cidr = stringValue(configValue(m, "cidrIp")) + stringValue(configValue(m, "cidrIpv6"))
+			}
+			if cidr == "0.0.0.0/0" || cidr == "::/0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publicAccessBlock reads the public access block settings of a bucket or account, whichever
+// casing Config recorded them in
+func publicAccessBlock(config map[string]interface{}) map[string]bool {
+	settings, _ := configValue(config, "publicAccessBlockConfiguration").(map[string]interface{})
+	if settings == nil {
+		// The account-level resource has the settings at the top level
+		settings = config
+	}
+	block := map[string]bool{}
+	for _, flag := range s3PublicAccessFlags {
+		if on, ok := configValue(settings, flag).(bool); ok {
+			block[flag] = on
+		}
+	}
+	return block
+}
+
+// publicGrants returns the statements of a resource's recorded policy that allow everyone
+// without a condition
+func publicGrants(item ConfigurationItem) []string {
+	// Config records the policy as a JSON string; it may also have been stored decoded
+	raw := configValue(item.SupplementaryConfiguration, "Policy")
+	policy, ok := raw.(string)
+	if !ok && raw != nil {
+		data, _ := json.Marshal(raw)
+		policy = string(data)
+	}
+	if policy == "" {
+		return nil
+	}
+	grants, err := ExternalGrants(policy, item.AccountID)
+	if err != nil {
+		return nil
+	}
+	var statements []string
+	for _, grant := range grants {
+		if grant.Principal == "*" && !grant.Conditional {
+			statements = appendUnique(statements, grant.Statement)
+		}
+	}
+	return statements
+}
+
+// rdsSnapshotPublic reports whether an RDS snapshot's restore attribute includes "all"
+func rdsSnapshotPublic(supplementary map[string]interface{}) bool {
+	for _, field := range []string{"DBSnapshotAttributes", "DBClusterSnapshotAttributes"} {
+		for _, raw := range configList(supplementary, field) {
+			attribute, _ := raw.(map[string]interface{})
+			if stringValue(configValue(attribute, "attributeName")) != "restore" {
+				continue
+			}
+			for _, value := range configList(attribute, "attributeValues") {
+				if stringValue(value) == "all" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// normalizedConfig returns a configuration as decoded from JSON, so the analyzer reads a
+// freshly scanned inventory and a stored snapshot alike
+func normalizedConfig(config interface{}) map[string]interface{} {
+	normalized, _ := normalizeJSON(config).(map[string]interface{})
+	return normalized
+}
+
+func exposureFinding(item ConfigurationItem, kind, severity, title, detail string) ExposureFinding {
+	return ExposureFinding{
+		Kind:         kind,
+		Severity:     severity,
+		ResourceType: item.ResourceType,
+		ResourceID:   item.ResourceID,
+		ResourceName: item.ResourceName,
+		Region:       item.Region,
+		Title:        title,
+		Detail:       detail,
+	}
+}
+
+func displayName(item ConfigurationItem) string {
+	if item.ResourceName != "" {
+		return item.ResourceName
+	}
+	return item.ResourceID
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
+
+// ListPublicArtifacts finds the account's AMIs and EBS snapshots that any AWS account may use,
+// in every region the inventory has resources in
+func (cs *ConfigService) ListPublicArtifacts(ctx context.Context, cfg aws.Config, resources []ConfigurationItem) ([]PublicArtifact, error) {
+	regions := []string{cfg.Region}
+	for _, item := range resources {
+		if item.Region != "" && item.Region != "global" && !containsString(regions, item.Region) {
+			regions = append(regions, item.Region)
+		}
+	}
+
+	found := make([][]PublicArtifact, len(regions))
+	errs := cs.pool.run(ctx, len(regions), func(ctx context.Context, i int) error {
+		var err error
+		found[i], err = listPublicArtifactsIn(ctx, ec2.NewFromConfig(inRegion(cfg, regions[i])), regions[i])
+		return err
+	})
+
+	artifacts := []PublicArtifact{}
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[Exposure] Warning: failed to list public artifacts in %s: %v", regions[i], err)
+			continue
+		}
+		artifacts = append(artifacts, found[i]...)
+	}
+	return artifacts, nil
+}
+
+func listPublicArtifactsIn(ctx context.Context, client *ec2.Client, region string) ([]PublicArtifact, error) {
+	var artifacts []PublicArtifact
+	images, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners:  []string{"self"},
+		Filters: []ec2types.Filter{{Name: aws.String("is-public"), Values: []string{"true"}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe images: %w", err)
+	}
+	for _, image := range images.Images {
+		artifacts = append(artifacts, PublicArtifact{Kind: ArtifactAMI, ID: aws.ToString(image.ImageId), Name: aws.ToString(image.Name), Region: region})
+	}
+
+	paginator := ec2.NewDescribeSnapshotsPaginator(client, &ec2.DescribeSnapshotsInput{
+		OwnerIds:            []string{"self"},
+		RestorableByUserIds: []string{"all"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe snapshots: %w", err)
+		}
+		for _, snapshot := range page.Snapshots {
+			artifacts = append(artifacts, PublicArtifact{Kind: ArtifactEBSSnapshot, ID: aws.ToString(snapshot.SnapshotId), Name: aws.ToString(snapshot.Description), Region: region})
+		}
+	}
+	return artifacts, nil
+}
+
+// AnalyzeExposure runs the exposure analyzer over the tenant's snapshot snapshotID, or its
+// latest snapshot if that is empty. It returns jobs.ErrNotFound if there is no such snapshot.
+func AnalyzeExposure(ctx context.Context, tenantID, snapshotID string) (*ExposureReport, error) {
+	snapshot, inventory, err := LoadInventory(ctx, tenantID, snapshotID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExposureReport{
+		Snapshot:   *snapshot,
+		BySeverity: map[string]int{},
+		ByKind:     map[string]int{},
+		Findings:   NewExposureAnalyzer().Analyze(inventory),
+	}
+	for _, finding := range report.Findings {
+		report.BySeverity[finding.Severity]++
+		report.ByKind[finding.Kind]++
+	}
+	return report, nil
+}
+
+// syncExposureFindings records a finding for every exposed resource of a scan and resolves
+// findings from earlier scans that are no longer exposed
+func syncExposureFindings(ctx context.Context, tenantID string, inventory *ResourceInventory, scanStartedAt time.Time) error {
+	store := findings.Default()
+	if store == nil {
+		return nil
+	}
+
+	recorded := 0
+	for _, exposure := range NewExposureAnalyzer().Analyze(inventory) {
+		finding := &findings.Finding{
+			TenantID:     tenantID,
+			Source:       FindingSourceExposure,
+			RuleID:       exposure.Kind,
+			Title:        exposure.Title,
+			Description:  exposure.Detail,
+			Severity:     exposure.Severity,
+			ResourceType: exposure.ResourceType,
+			ResourceID:   exposure.ResourceID,
+			Context:      &findings.ResourceContext{ResourceName: exposure.ResourceName, Region: exposure.Region},
+		}
+		if err := upsertFinding(ctx, store, finding); err != nil {
+			return err
+		}
+		recorded++
+	}
+
+	resolved, err := store.ResolveStale(ctx, tenantID, FindingSourceExposure, scanStartedAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Findings] ✅ Recorded %d exposure findings, resolved %d for tenant %s", recorded, resolved, tenantID)
+	return nil
+}
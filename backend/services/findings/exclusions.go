@@ -0,0 +1,181 @@
+package findings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Exclusion removes a resource from the tenant's findings, e.g. a sandbox bucket
+type Exclusion struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID     string             `bson:"tenantId" json:"tenantId"`
+	ResourceID   string             `bson:"resourceId" json:"resourceId" binding:"required"`
+	ResourceType string             `bson:"resourceType,omitempty" json:"resourceType,omitempty"`
+	Reason       string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func (s *Store) isExcluded(ctx context.Context, tenantID, resourceID string) (bool, error) {
+	err := s.exclusions.FindOne(ctx, bson.M{"tenantId": tenantID, "resourceId": resourceID}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check exclusions: %w", err)
+	}
+	return true, nil
+}
+
+// ListExclusions returns the tenant's exclusion list
+func (s *Store) ListExclusions(ctx context.Context, tenantID string) ([]Exclusion, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := s.exclusions.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exclusions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Exclusion{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode exclusions: %w", err)
+	}
+	return result, nil
+}
+
+// AddExclusions adds resources to the tenant's exclusion list and hides their findings.
+// Items are keyed by resource ID in the result; resources already excluded count as succeeded.
+func (s *Store) AddExclusions(ctx context.Context, tenantID string, items []Exclusion) (*BulkResult, error) {
+	if len(items) > MaxBulkItems {
+		return nil, fmt.Errorf("at most %d exclusions can be added at once", MaxBulkItems)
+	}
+
+	result := newBulkResult()
+	valid := make([]Exclusion, 0, len(items))
+	ids := make([]string, 0, len(items))
+	requested := make(map[string]bool, len(items))
+	for i, item := range items {
+		item.ResourceID = strings.TrimSpace(item.ResourceID)
+		if item.ResourceID == "" {
+			result.fail(fmt.Sprintf("#%d", i), "resourceId is required")
+			continue
+		}
+		if requested[item.ResourceID] {
+			continue
+		}
+		requested[item.ResourceID] = true
+		valid = append(valid, item)
+		ids = append(ids, item.ResourceID)
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+
+	// Skip resources that are already on the list
+	cursor, err := s.exclusions.Find(ctx,
+		bson.M{"tenantId": tenantID, "resourceId": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"resourceId": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up exclusions: %w", err)
+	}
+	var existing []Exclusion
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, fmt.Errorf("failed to decode exclusions: %w", err)
+	}
+	already := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		already[e.ResourceID] = true
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, 0, len(valid))
+	inserted := make([]string, 0, len(valid))
+	for _, item := range valid {
+		if already[item.ResourceID] {
+			result.Succeeded = append(result.Succeeded, item.ResourceID)
+			continue
+		}
+		docs = append(docs, Exclusion{
+			TenantID:     tenantID,
+			ResourceID:   item.ResourceID,
+			ResourceType: item.ResourceType,
+			Reason:       item.Reason,
+			CreatedAt:    now,
+		})
+		inserted = append(inserted, item.ResourceID)
+	}
+
+	if len(docs) > 0 {
+		// Unordered so one bad document doesn't stop the rest
+		_, err := s.exclusions.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		failedIdx := map[int]string{}
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			for _, we := range bulkErr.WriteErrors {
+				failedIdx[we.Index] = we.Message
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to add exclusions: %w", err)
+		}
+		for i, resourceID := range inserted {
+			if msg, failed := failedIdx[i]; failed {
+				result.fail(resourceID, msg)
+				continue
+			}
+			result.Succeeded = append(result.Succeeded, resourceID)
+		}
+	}
+
+	if len(result.Succeeded) > 0 {
+		if err := s.setExcluded(ctx, tenantID, result.Succeeded, true); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RemoveExclusions removes resources from the tenant's exclusion list and restores their findings
+func (s *Store) RemoveExclusions(ctx context.Context, tenantID string, resourceIDs []string) (*BulkResult, error) {
+	if len(resourceIDs) > MaxBulkItems {
+		return nil, fmt.Errorf("at most %d exclusions can be removed at once", MaxBulkItems)
+	}
+
+	result := newBulkResult()
+	for _, resourceID := range resourceIDs {
+		res, err := s.exclusions.DeleteOne(ctx, bson.M{"tenantId": tenantID, "resourceId": resourceID})
+		switch {
+		case err != nil:
+			result.fail(resourceID, err.Error())
+		case res.DeletedCount == 0:
+			result.fail(resourceID, "resource is not excluded")
+		default:
+			result.Succeeded = append(result.Succeeded, resourceID)
+		}
+	}
+
+	if len(result.Succeeded) > 0 {
+		if err := s.setExcluded(ctx, tenantID, result.Succeeded, false); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) setExcluded(ctx context.Context, tenantID string, resourceIDs []string, excluded bool) error {
+	_, err := s.findings.UpdateMany(ctx,
+		bson.M{"tenantId": tenantID, "resourceId": bson.M{"$in": resourceIDs}},
+		bson.M{"$set": bson.M{"excluded": excluded, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update excluded findings: %w", err)
+	}
+	return nil
+}
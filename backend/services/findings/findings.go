@@ -0,0 +1,574 @@
+package findings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName           = config.CollectionFindings
+	exclusionsCollectionName = config.CollectionExclusions
+)
+
+// MaxBulkItems caps the number of items a single bulk request may touch
+const MaxBulkItems = 1000
+
+// Status is the triage state of a finding
+type Status string
+
+const (
+	StatusOpen         Status = "open"
+	StatusAcknowledged Status = "acknowledged"
+	StatusResolved     Status = "resolved"
+	StatusSuppressed   Status = "suppressed"
+)
+
+// Valid reports whether s is a known finding status
+func (s Status) Valid() bool {
+	switch s {
+	case StatusOpen, StatusAcknowledged, StatusResolved, StatusSuppressed:
+		return true
+	}
+	return false
+}
+
+// transitions are the statuses a finding may be moved to by hand from each status. A
+// suppressed finding may be suppressed again to change its justification or expiry.
+var transitions = map[Status][]Status{
+	StatusOpen:         {StatusAcknowledged, StatusSuppressed, StatusResolved},
+	StatusAcknowledged: {StatusOpen, StatusSuppressed, StatusResolved},
+	StatusSuppressed:   {StatusOpen, StatusSuppressed, StatusResolved},
+	StatusResolved:     {StatusOpen},
+}
+
+// CanTransitionTo reports whether a finding with status s may be moved to next by hand
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrNotFound is returned when a finding does not exist for the tenant
+	ErrNotFound = errors.New("finding not found")
+	// ErrInvalidTransition is returned when a finding cannot be moved to a status from its own
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrInvalid is returned for a suppression without a justification or with a past expiry
+	ErrInvalid = errors.New("invalid finding update")
+	// ErrConflict is returned when a finding's status changed while it was being transitioned
+	ErrConflict = errors.New("finding was changed concurrently")
+)
+
+// Finding is a single misconfiguration or compliance failure on a resource
+type Finding struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID     string             `bson:"tenantId" json:"tenantId"`
+	Fingerprint  string             `bson:"fingerprint" json:"fingerprint"`
+	Source       string             `bson:"source" json:"source"`
+	RuleID       string             `bson:"ruleId" json:"ruleId"`
+	Title        string             `bson:"title" json:"title"`
+	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
+	Remediation  string             `bson:"remediation,omitempty" json:"remediation,omitempty"`
+	Severity     string             `bson:"severity" json:"severity"`
+	ResourceType string             `bson:"resourceType" json:"resourceType"`
+	ResourceID   string             `bson:"resourceId" json:"resourceId"`
+	Context      *ResourceContext   `bson:"context,omitempty" json:"context,omitempty"`
+	Status       Status             `bson:"status" json:"status"`
+	// StatusReason is why the finding has its status: the justification of a suppression, or
+	// what resolved or reopened it
+	StatusReason    string     `bson:"statusReason,omitempty" json:"statusReason,omitempty"`
+	SuppressedUntil *time.Time `bson:"suppressedUntil,omitempty" json:"suppressedUntil,omitempty"`
+	// StatusChangedBy and StatusChangedAt are who last changed the status by hand, and when
+	StatusChangedBy string     `bson:"statusChangedBy,omitempty" json:"statusChangedBy,omitempty"`
+	StatusChangedAt *time.Time `bson:"statusChangedAt,omitempty" json:"statusChangedAt,omitempty"`
+	// Assignee is who is working on the finding
+	Assignee    string    `bson:"assignee,omitempty" json:"assignee,omitempty"`
+	Excluded    bool      `bson:"excluded" json:"excluded"`
+	FirstSeenAt time.Time `bson:"firstSeenAt" json:"firstSeenAt"`
+	LastSeenAt  time.Time `bson:"lastSeenAt" json:"lastSeenAt"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ResourceContext is what the inventory knew about a finding's resource when the finding was
+// last seen, so it can be triaged without looking the resource up
+type ResourceContext struct {
+	ResourceName string            `bson:"resourceName,omitempty" json:"resourceName,omitempty"`
+	Region       string            `bson:"region,omitempty" json:"region,omitempty"`
+	Tags         map[string]string `bson:"tags,omitempty" json:"tags,omitempty"`
+	Related      []RelatedResource `bson:"related,omitempty" json:"related,omitempty"`
+}
+
+// RelatedResource is a resource the inventory relates a finding's resource to
+type RelatedResource struct {
+	ResourceType string `bson:"resourceType" json:"resourceType"`
+	ResourceID   string `bson:"resourceId" json:"resourceId"`
+	ResourceName string `bson:"resourceName,omitempty" json:"resourceName,omitempty"`
+	Relationship string `bson:"relationship,omitempty" json:"relationship,omitempty"`
+}
+
+// ListFilter narrows the findings returned by List
+type ListFilter struct {
+	TenantID        string
+	Status          Status
+	Severity        string
+	Source          string
+	ResourceID      string
+	Assignee        string
+	IncludeExcluded bool
+	Limit           int64
+}
+
+// BulkFailure explains why one item of a bulk request was not applied
+type BulkFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// BulkResult reports which items of a bulk request succeeded and which failed
+type BulkResult struct {
+	Succeeded []string      `json:"succeeded"`
+	Failed    []BulkFailure `json:"failed"`
+}
+
+func newBulkResult() *BulkResult {
+	return &BulkResult{Succeeded: []string{}, Failed: []BulkFailure{}}
+}
+
+func (r *BulkResult) fail(id string, err string) {
+	r.Failed = append(r.Failed, BulkFailure{ID: id, Error: err})
+}
+
+// Store persists findings and resource exclusion lists in MongoDB
+type Store struct {
+	findings   *mongo.Collection
+	exclusions *mongo.Collection
+	hub        *Hub
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide findings store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide findings store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the findings and exclusions collections
+func NewStore(db *mongo.Database) *Store {
+	return &Store{
+		findings:   db.Collection(collectionName),
+		exclusions: db.Collection(exclusionsCollectionName),
+		hub:        NewHub(),
+	}
+}
+
+// Changes returns the hub that new findings and status changes are published to
+func (s *Store) Changes() *Hub {
+	return s.hub
+}
+
+// Fingerprint identifies a finding across scans by its source, rule and resource
+func Fingerprint(source, ruleID, resourceType, resourceID string) string {
+	return fmt.Sprintf("%s|%s|%s|%s", source, ruleID, resourceType, resourceID)
+}
+
+// Upsert records that a finding was observed. New findings start open; existing ones keep
+// their triage status, except resolved findings that reappear and suppressed findings whose
+// suppression has expired are reopened. Findings suppressed until later, or indefinitely, stay
+// suppressed however often scanners report them. A finding's resource context and remediation
+// are only replaced when f has them. f's ID and status are set only when the finding was
+// created or reopened.
+func (s *Store) Upsert(ctx context.Context, f *Finding, seenAt time.Time) error {
+	if f.Fingerprint == "" {
+		f.Fingerprint = Fingerprint(f.Source, f.RuleID, f.ResourceType, f.ResourceID)
+	}
+	excluded, err := s.isExcluded(ctx, f.TenantID, f.ResourceID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"tenantId": f.TenantID, "fingerprint": f.Fingerprint}
+	set := bson.M{
+		"source":       f.Source,
+		"ruleId":       f.RuleID,
+		"title":        f.Title,
+		"description":  f.Description,
+		"severity":     f.Severity,
+		"resourceType": f.ResourceType,
+		"resourceId":   f.ResourceID,
+		"excluded":     excluded,
+		"lastSeenAt":   seenAt,
+		"updatedAt":    seenAt,
+	}
+	if f.Context != nil {
+		set["context"] = f.Context
+	}
+	if f.Remediation != "" {
+		set["remediation"] = f.Remediation
+	}
+	update := bson.M{
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"status":      StatusOpen,
+			"firstSeenAt": seenAt,
+		},
+	}
+	upserted, err := s.findings.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to upsert finding: %w", err)
+	}
+	if id, ok := upserted.UpsertedID.(primitive.ObjectID); ok {
+		f.ID, f.Status, f.Excluded = id, StatusOpen, excluded
+		f.FirstSeenAt, f.LastSeenAt, f.UpdatedAt = seenAt, seenAt, seenAt
+		s.hub.Publish(Change{Type: ChangeCreated, TenantID: f.TenantID, FindingID: id.Hex(), Finding: f, Status: StatusOpen})
+		return nil
+	}
+
+	// A resolved finding that shows up again is a regression, and a risk whose acceptance has
+	// expired is no longer accepted
+	reopened, err := s.reopen(ctx, f, bson.M{"status": StatusResolved}, "reappeared in scan")
+	if err == nil && reopened == nil {
+		reopened, err = s.reopen(ctx, f, bson.M{"status": StatusSuppressed, "suppressedUntil": bson.M{"$lte": seenAt}}, "suppression expired")
+	}
+	if err != nil || reopened == nil {
+		return err
+	}
+	f.ID, f.Status, f.Excluded = reopened.ID, StatusOpen, reopened.Excluded
+	s.hub.Publish(Change{Type: ChangeReopened, TenantID: f.TenantID, FindingID: reopened.ID.Hex(), Finding: reopened,
+		Status: StatusOpen, Reason: reopened.StatusReason})
+	return nil
+}
+
+// reopen opens the finding with f's fingerprint if it matches filter, returning nil if it does not
+func (s *Store) reopen(ctx context.Context, f *Finding, filter bson.M, reason string) (*Finding, error) {
+	filter["tenantId"], filter["fingerprint"] = f.TenantID, f.Fingerprint
+	var reopened Finding
+	err := s.findings.FindOneAndUpdate(ctx, filter,
+		bson.M{
+			"$set":   bson.M{"status": StatusOpen, "statusReason": reason},
+			"$unset": bson.M{"suppressedUntil": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reopened)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen finding: %w", err)
+	}
+	return &reopened, nil
+}
+
+// ResolveStale resolves open or acknowledged findings from source that were not seen since before
+func (s *Store) ResolveStale(ctx context.Context, tenantID, source string, before time.Time) (int64, error) {
+	res, err := s.findings.UpdateMany(ctx,
+		bson.M{
+			"tenantId":   tenantID,
+			"source":     source,
+			"status":     bson.M{"$in": []Status{StatusOpen, StatusAcknowledged}},
+			"lastSeenAt": bson.M{"$lt": before},
+		},
+		bson.M{"$set": bson.M{
+			"status":       StatusResolved,
+			"statusReason": "no longer detected",
+			"updatedAt":    time.Now(),
+		}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve stale findings: %w", err)
+	}
+	if res.ModifiedCount > 0 {
+		s.hub.Publish(Change{Type: ChangeResolved, TenantID: tenantID, Status: StatusResolved,
+			Reason: "no longer detected", Source: source, Count: res.ModifiedCount})
+	}
+	return res.ModifiedCount, nil
+}
+
+// Close sets the status of the tenant's open or acknowledged finding with the given
+// fingerprint, for sources that report findings as resolved or suppressed themselves rather
+// than by no longer reporting them. It returns false if there was no such finding.
+func (s *Store) Close(ctx context.Context, tenantID, fingerprint string, status Status, reason string) (bool, error) {
+	var closed Finding
+	err := s.findings.FindOneAndUpdate(ctx,
+		bson.M{"tenantId": tenantID, "fingerprint": fingerprint, "status": bson.M{"$in": []Status{StatusOpen, StatusAcknowledged}}},
+		bson.M{"$set": bson.M{"status": status, "statusReason": reason, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&closed)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to close finding: %w", err)
+	}
+	s.hub.Publish(Change{Type: ChangeStatusChanged, TenantID: tenantID, FindingID: closed.ID.Hex(), Finding: &closed,
+		Status: status, Reason: reason})
+	return true, nil
+}
+
+// Get returns one of the tenant's findings
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Finding, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var finding Finding
+	err = s.findings.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&finding)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load finding: %w", err)
+	}
+	return &finding, nil
+}
+
+// List returns findings matching the filter, most recently seen first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]Finding, error) {
+	query := bson.M{"tenantId": filter.TenantID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Severity != "" {
+		query["severity"] = filter.Severity
+	}
+	if filter.Source != "" {
+		query["source"] = filter.Source
+	}
+	if filter.ResourceID != "" {
+		query["resourceId"] = filter.ResourceID
+	}
+	if filter.Assignee != "" {
+		query["assignee"] = filter.Assignee
+	}
+	if !filter.IncludeExcluded {
+		query["excluded"] = bson.M{"$ne": true}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.findings.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list findings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Finding{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode findings: %w", err)
+	}
+	return result, nil
+}
+
+// StatusUpdate is the change applied by Transition and BulkUpdateStatus
+type StatusUpdate struct {
+	Status          Status
+	Reason          string
+	SuppressedUntil *time.Time
+}
+
+// BulkUpdateStatus applies the same status change to many findings, reporting
+// per-finding failures (unknown or foreign IDs) instead of failing the whole batch
+func (s *Store) BulkUpdateStatus(ctx context.Context, tenantID string, ids []string, change StatusUpdate) (*BulkResult, error) {
+	if !change.Status.Valid() {
+		return nil, fmt.Errorf("invalid status '%s'", change.Status)
+	}
+	if change.Status == StatusSuppressed && change.Reason == "" {
+		return nil, fmt.Errorf("a reason is required to suppress findings")
+	}
+	if len(ids) > MaxBulkItems {
+		return nil, fmt.Errorf("at most %d findings can be updated at once", MaxBulkItems)
+	}
+
+	result := newBulkResult()
+	oids := make([]primitive.ObjectID, 0, len(ids))
+	requested := make(map[primitive.ObjectID]string, len(ids))
+	for _, id := range ids {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			result.fail(id, "invalid finding ID")
+			continue
+		}
+		if _, dup := requested[oid]; dup {
+			continue
+		}
+		requested[oid] = id
+		oids = append(oids, oid)
+	}
+	if len(oids) == 0 {
+		return result, nil
+	}
+
+	// Only findings that exist and belong to the tenant are updated
+	cursor, err := s.findings.Find(ctx,
+		bson.M{"_id": bson.M{"$in": oids}, "tenantId": tenantID},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up findings: %w", err)
+	}
+	var found []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("failed to decode findings: %w", err)
+	}
+
+	existing := make([]primitive.ObjectID, 0, len(found))
+	seen := make(map[primitive.ObjectID]bool, len(found))
+	for _, f := range found {
+		existing = append(existing, f.ID)
+		seen[f.ID] = true
+	}
+	for _, oid := range oids {
+		if !seen[oid] {
+			result.fail(requested[oid], ErrNotFound.Error())
+		}
+	}
+	if len(existing) == 0 {
+		return result, nil
+	}
+
+	set := bson.M{"status": change.Status, "statusReason": change.Reason, "updatedAt": time.Now()}
+	update := bson.M{"$set": set}
+	if change.Status == StatusSuppressed && change.SuppressedUntil != nil {
+		set["suppressedUntil"] = change.SuppressedUntil
+	} else {
+		update["$unset"] = bson.M{"suppressedUntil": ""}
+	}
+
+	if _, err := s.findings.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": existing}, "tenantId": tenantID}, update); err != nil {
+		// The batch write failed as a whole, so every remaining item failed
+		for _, oid := range existing {
+			result.fail(requested[oid], err.Error())
+		}
+		return result, nil
+	}
+	for _, oid := range existing {
+		result.Succeeded = append(result.Succeeded, requested[oid])
+		s.hub.Publish(Change{Type: ChangeStatusChanged, TenantID: tenantID, FindingID: oid.Hex(),
+			Status: change.Status, Reason: change.Reason})
+	}
+	return result, nil
+}
+
+// validate checks the status is known and a suppression has a justification and, if it
+// expires, an expiry after now. It trims the reason.
+func (c *StatusUpdate) validate(now time.Time) error {
+	if !c.Status.Valid() {
+		return fmt.Errorf("%w: unknown status '%s'", ErrInvalid, c.Status)
+	}
+	c.Reason = strings.TrimSpace(c.Reason)
+	if c.Status == StatusSuppressed && c.Reason == "" {
+		return fmt.Errorf("%w: a justification is required to suppress a finding", ErrInvalid)
+	}
+	if c.Status == StatusSuppressed && c.SuppressedUntil != nil && !c.SuppressedUntil.After(now) {
+		return fmt.Errorf("%w: a suppression must expire in the future", ErrInvalid)
+	}
+	return nil
+}
+
+// Transition moves one of the tenant's findings to a new status by hand, if its current status
+// allows it. Suppressing needs a justification, and an expiry, if any, in the future; leaving
+// a finding suppressed without an expiry accepts the risk until someone reopens it. Any other
+// status clears the expiry. It returns ErrConflict if the status changed since it was read.
+func (s *Store) Transition(ctx context.Context, tenantID, id string, change StatusUpdate, actor string) (*Finding, error) {
+	now := time.Now()
+	if err := change.validate(now); err != nil {
+		return nil, err
+	}
+
+	finding, err := s.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !finding.Status.CanTransitionTo(change.Status) {
+		return nil, fmt.Errorf("%w: a %s finding cannot be moved to %s", ErrInvalidTransition, finding.Status, change.Status)
+	}
+
+	set := bson.M{"status": change.Status, "statusReason": change.Reason, "statusChangedBy": actor, "statusChangedAt": now, "updatedAt": now}
+	update := bson.M{"$set": set}
+	if change.Status == StatusSuppressed && change.SuppressedUntil != nil {
+		set["suppressedUntil"] = change.SuppressedUntil
+	} else {
+		update["$unset"] = bson.M{"suppressedUntil": ""}
+	}
+
+	var updated Finding
+	err = s.findings.FindOneAndUpdate(ctx,
+		bson.M{"_id": finding.ID, "tenantId": tenantID, "status": finding.Status},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update finding: %w", err)
+	}
+	s.hub.Publish(Change{Type: ChangeStatusChanged, TenantID: tenantID, FindingID: updated.ID.Hex(), Finding: &updated,
+		Status: updated.Status, Reason: updated.StatusReason})
+	return &updated, nil
+}
+
+// Assign sets who is working on one of the tenant's findings; an empty assignee unassigns it
+func (s *Store) Assign(ctx context.Context, tenantID, id, assignee string) (*Finding, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	update := bson.M{"$set": bson.M{"assignee": assignee, "updatedAt": time.Now()}}
+	if assignee = strings.TrimSpace(assignee); assignee == "" {
+		update = bson.M{"$set": bson.M{"updatedAt": time.Now()}, "$unset": bson.M{"assignee": ""}}
+	}
+
+	var updated Finding
+	err = s.findings.FindOneAndUpdate(ctx, bson.M{"_id": oid, "tenantId": tenantID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign finding: %w", err)
+	}
+	s.hub.Publish(Change{Type: ChangeAssigned, TenantID: tenantID, FindingID: updated.ID.Hex(), Finding: &updated,
+		Assignee: updated.Assignee})
+	return &updated, nil
+}
+
+// ReopenExpiredSuppressions reopens suppressed findings whose suppression window has passed
+func (s *Store) ReopenExpiredSuppressions(ctx context.Context) (int64, error) {
+	now := time.Now()
+	res, err := s.findings.UpdateMany(ctx,
+		bson.M{"status": StatusSuppressed, "suppressedUntil": bson.M{"$lte": now}},
+		bson.M{
+			"$set":   bson.M{"status": StatusOpen, "statusReason": "suppression expired", "updatedAt": now},
+			"$unset": bson.M{"suppressedUntil": ""},
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reopen expired suppressions: %w", err)
+	}
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,96 @@
+package findings
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusOpen, StatusAcknowledged, true},
+		{StatusOpen, StatusSuppressed, true},
+		{StatusOpen, StatusResolved, true},
+		{StatusOpen, StatusOpen, false},
+		{StatusAcknowledged, StatusOpen, true},
+		{StatusAcknowledged, StatusSuppressed, true},
+		{StatusAcknowledged, StatusResolved, true},
+		{StatusAcknowledged, StatusAcknowledged, false},
+		{StatusSuppressed, StatusOpen, true},
+		{StatusSuppressed, StatusSuppressed, true},
+		{StatusSuppressed, StatusResolved, true},
+		{StatusSuppressed, StatusAcknowledged, false},
+		{StatusResolved, StatusOpen, true},
+		{StatusResolved, StatusAcknowledged, false},
+		{StatusResolved, StatusSuppressed, false},
+		{StatusResolved, StatusResolved, false},
+		{Status("unknown"), StatusOpen, false},
+		{StatusOpen, Status("unknown"), false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusUpdateValidate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(30*24*time.Hour)
+	tests := []struct {
+		name       string
+		change     StatusUpdate
+		wantReason string
+		wantErr    bool
+	}{
+		{name: "acknowledge", change: StatusUpdate{Status: StatusAcknowledged}},
+		{name: "resolve with reason", change: StatusUpdate{Status: StatusResolved, Reason: " fixed by hand "}, wantReason: "fixed by hand"},
+		{name: "suppress until further notice", change: StatusUpdate{Status: StatusSuppressed, Reason: "accepted risk"}, wantReason: "accepted risk"},
+		{name: "suppress until a future date", change: StatusUpdate{Status: StatusSuppressed, Reason: "accepted risk", SuppressedUntil: &future}, wantReason: "accepted risk"},
+		{name: "expiry ignored when not suppressing", change: StatusUpdate{Status: StatusOpen, SuppressedUntil: &past}},
+		{name: "suppress without justification", change: StatusUpdate{Status: StatusSuppressed}, wantErr: true},
+		{name: "suppress with blank justification", change: StatusUpdate{Status: StatusSuppressed, Reason: "   "}, wantErr: true},
+		{name: "suppress until a past date", change: StatusUpdate{Status: StatusSuppressed, Reason: "accepted risk", SuppressedUntil: &past}, wantErr: true},
+		{name: "suppress until now", change: StatusUpdate{Status: StatusSuppressed, Reason: "accepted risk", SuppressedUntil: &now}, wantErr: true},
+		{name: "unknown status", change: StatusUpdate{Status: "closed"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.change.validate(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("validate() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if tt.change.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", tt.change.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestTransitionRejectsInvalidChangesBeforeReading(t *testing.T) {
+	// A store without collections panics on any read, so these only pass if Transition rejects
+	// the change first
+	store := &Store{}
+	past := time.Now().Add(-time.Minute)
+	for _, change := range []StatusUpdate{
+		{Status: "closed"},
+		{Status: StatusSuppressed},
+		{Status: StatusSuppressed, Reason: "accepted risk", SuppressedUntil: &past},
+	} {
+		if _, err := store.Transition(context.Background(), "111122223333", "64f000000000000000000000", change, "alice"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Transition(%+v) error = %v, want ErrInvalid", change, err)
+		}
+	}
+}
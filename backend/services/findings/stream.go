@@ -0,0 +1,83 @@
+package findings
+
+import (
+	"sync"
+	"time"
+)
+
+// Change types pushed to stream subscribers
+const (
+	ChangeCreated       = "finding.created"
+	ChangeReopened      = "finding.reopened"
+	ChangeStatusChanged = "finding.status_changed"
+	ChangeAssigned      = "finding.assigned"
+	ChangeResolved      = "findings.resolved"
+)
+
+// Change describes a new finding or a status change on existing findings
+type Change struct {
+	Type      string   `json:"type"`
+	TenantID  string   `json:"tenantId"`
+	FindingID string   `json:"findingId,omitempty"`
+	Finding   *Finding `json:"finding,omitempty"`
+	Status    Status   `json:"status,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	Assignee  string   `json:"assignee,omitempty"`
+	// Source and Count describe bulk changes that are not reported per finding
+	Source string    `json:"source,omitempty"`
+	Count  int64     `json:"count,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Hub fans finding changes out to per-tenant subscribers in this process
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Change]struct{}
+}
+
+// NewHub creates an empty Hub
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[chan Change]struct{})}
+}
+
+// Subscribe returns a channel of the tenant's changes and a function that ends the subscription.
+// A subscriber that falls more than buffer changes behind misses the overflow.
+func (h *Hub) Subscribe(tenantID string, buffer int) (<-chan Change, func()) {
+	ch := make(chan Change, buffer)
+
+	h.mu.Lock()
+	if h.subs[tenantID] == nil {
+		h.subs[tenantID] = make(map[chan Change]struct{})
+	}
+	h.subs[tenantID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[tenantID], ch)
+			if len(h.subs[tenantID]) == 0 {
+				delete(h.subs, tenantID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the change to the tenant's subscribers without blocking the writer
+func (h *Hub) Publish(change Change) {
+	if change.At.IsZero() {
+		change.At = time.Now()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subs[change.TenantID] {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
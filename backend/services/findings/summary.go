@@ -0,0 +1,65 @@
+package findings
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OpenStatuses are the statuses of findings that still need attention
+var OpenStatuses = []Status{StatusOpen, StatusAcknowledged}
+
+// CountOpenBySeverity counts the tenant's open and acknowledged findings per severity,
+// leaving out excluded resources
+func (s *Store) CountOpenBySeverity(ctx context.Context, tenantID string) (map[string]int64, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"tenantId": tenantID,
+			"status":   bson.M{"$in": OpenStatuses},
+			"excluded": bson.M{"$ne": true},
+		}},
+		{"$group": bson.M{"_id": "$severity", "count": bson.M{"$sum": 1}}},
+	}
+
+	cursor, err := s.findings.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count findings by severity: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Severity string `bson:"_id"`
+		Count    int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode finding counts: %w", err)
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.Severity] = row.Count
+	}
+	return counts, nil
+}
+
+// RecentlyResolved returns the tenant's most recently resolved findings
+func (s *Store) RecentlyResolved(ctx context.Context, tenantID string, limit int64) ([]Finding, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}).SetLimit(limit)
+
+	cursor, err := s.findings.Find(ctx, bson.M{"tenantId": tenantID, "status": StatusResolved}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resolved findings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Finding{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode findings: %w", err)
+	}
+	return result, nil
+}
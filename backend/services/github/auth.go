@@ -1,6 +1,8 @@
 package github
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -8,6 +10,8 @@ import (
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v53/github"
 	"github.com/joho/godotenv"
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/secrets"
 )
 
 func GetGHClient(installationId int64, appID int64) (*github.Client, error) {
@@ -15,10 +19,9 @@ func GetGHClient(installationId int64, appID int64) (*github.Client, error) {
 	if err != nil {
 		fmt.Println("No .env file found or failed to load")
 	}
-	keyPath := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH")
-	privateKey, err := os.ReadFile(keyPath)
+	privateKey, err := appPrivateKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %w", err)
+		return nil, err
 	}
 	transport, err := ghinstallation.New(http.DefaultTransport, appID, installationId, privateKey)
 	if err != nil {
@@ -31,3 +34,26 @@ func GetGHClient(installationId int64, appID int64) (*github.Client, error) {
 	fmt.Println("Client:", client)
 	return client, nil
 }
+
+// appPrivateKey loads the GitHub App private key from the secret store, falling back to
+// the file at GITHUB_APP_PRIVATE_KEY_PATH when no store is configured or the key is not stored
+func appPrivateKey() ([]byte, error) {
+	if store := secrets.Default(); store != nil {
+		ctx, cancel := config.WithAWSTimeout(context.Background())
+		defer cancel()
+
+		privateKey, err := store.Get(ctx, secrets.GitHubAppPrivateKey)
+		if err == nil {
+			return privateKey, nil
+		}
+		if !errors.Is(err, secrets.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+	}
+
+	privateKey, err := os.ReadFile(os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/guardduty"
+	gdtypes "github.com/aws/aws-sdk-go-v2/service/guardduty/types"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// FindingSourceGuardDuty marks findings reported by Amazon GuardDuty
+const FindingSourceGuardDuty = "guardduty"
+
+// errResourceFound stops EachResource once a finding's resource has been found
+var errResourceFound = errors.New("resource found")
+
+// GuardDutyService makes sure GuardDuty runs in a customer account and reads its findings
+type GuardDutyService struct {
+	client *guardduty.Client
+}
+
+// NewGuardDutyService creates a GuardDutyService for the account and region of cfg
+func NewGuardDutyService(cfg aws.Config) *GuardDutyService {
+	return &GuardDutyService{client: guardduty.NewFromConfig(cfg)}
+}
+
+// EnsureDetector returns the ID of the region's GuardDuty detector, enabling it if it was
+// suspended or creating one with tags if there is none
+func (s *GuardDutyService) EnsureDetector(ctx context.Context, tags map[string]string) (string, error) {
+	detectors, err := s.client.ListDetectors(ctx, &guardduty.ListDetectorsInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list GuardDuty detectors: %w", err)
+	}
+	// A region has at most one detector
+	if len(detectors.DetectorIds) > 0 {
+		detectorID := detectors.DetectorIds[0]
+		detector, err := s.client.GetDetector(ctx, &guardduty.GetDetectorInput{DetectorId: aws.String(detectorID)})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe GuardDuty detector %s: %w", detectorID, err)
+		}
+		if detector.Status != gdtypes.DetectorStatusEnabled {
+			if _, err := s.client.UpdateDetector(ctx, &guardduty.UpdateDetectorInput{DetectorId: aws.String(detectorID), Enable: aws.Bool(true)}); err != nil {
+				return "", fmt.Errorf("failed to enable GuardDuty detector %s: %w", detectorID, err)
+			}
+		}
+		return detectorID, nil
+	}
+
+	created, err := s.client.CreateDetector(ctx, &guardduty.CreateDetectorInput{
+		Enable:                     aws.Bool(true),
+		FindingPublishingFrequency: gdtypes.FindingPublishingFrequencyFifteenMinutes,
+		Tags:                       tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create GuardDuty detector: %w", err)
+	}
+	return aws.ToString(created.DetectorId), nil
+}
+
+// Finding reads a finding from the detector, which has fields the event may leave out
+func (s *GuardDutyService) Finding(ctx context.Context, detectorID, findingID string) (*guardDutyFinding, error) {
+	out, err := s.client.GetFindings(ctx, &guardduty.GetFindingsInput{
+		DetectorId: aws.String(detectorID),
+		FindingIds: []string{findingID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GuardDuty finding %s: %w", findingID, err)
+	}
+	if len(out.Findings) == 0 {
+		return nil, fmt.Errorf("GuardDuty finding %s not found", findingID)
+	}
+	return guardDutyFindingOf(out.Findings[0]), nil
+}
+
+// ensureGuardDutyDetectors makes sure every monitored region has an enabled detector, so
+// GuardDuty findings reach the regions' EventBridge rules, and returns the detector IDs
+func (s *CloudTrailService) ensureGuardDutyDetectors(ctx context.Context, cfg aws.Config, regions []string) ([]string, error) {
+	var detectorIDs []string
+	for _, region := range regions {
+		detectorID, err := NewGuardDutyService(inRegion(cfg, region)).EnsureDetector(ctx, s.managedTags())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", region, err)
+		}
+		detectorIDs = append(detectorIDs, detectorID)
+	}
+	return detectorIDs, nil
+}
+
+// removeGuardDutyDetectors deletes the detectors setup created, which carry the CloudLoom
+// tags. Detectors the customer had before are kept.
+func removeGuardDutyDetectors(ctx context.Context, cfg aws.Config, regions []string, report *TeardownReport) {
+	for _, region := range regions {
+		client := guardduty.NewFromConfig(inRegion(cfg, region))
+		detectors, err := client.ListDetectors(ctx, &guardduty.ListDetectorsInput{})
+		if err != nil {
+			report.record("guardduty_detector", "", region, err)
+			continue
+		}
+		for _, detectorID := range detectors.DetectorIds {
+			detector, err := client.GetDetector(ctx, &guardduty.GetDetectorInput{DetectorId: aws.String(detectorID)})
+			if err != nil {
+				report.record("guardduty_detector", detectorID, region, err)
+				continue
+			}
+			if detector.Tags[TagManaged] != "true" {
+				report.Resources = append(report.Resources, TeardownResource{Kind: "guardduty_detector", Name: detectorID, Region: region, Action: TeardownRetained, Detail: "customer's existing detector"})
+				continue
+			}
+			_, err = client.DeleteDetector(ctx, &guardduty.DeleteDetectorInput{DetectorId: aws.String(detectorID)})
+			report.record("guardduty_detector", detectorID, region, err)
+		}
+	}
+}
+
+// guardDutyFinding is the part of a GuardDuty finding CloudLoom keeps, as it appears in the
+// detail of an event
+type guardDutyFinding struct {
+	ID          string  `json:"id"`
+	AccountID   string  `json:"accountId"`
+	Region      string  `json:"region"`
+	Type        string  `json:"type"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Severity    float64 `json:"severity"`
+	Resource    struct {
+		ResourceType    string `json:"resourceType"`
+		InstanceDetails struct {
+			InstanceID string `json:"instanceId"`
+		} `json:"instanceDetails"`
+		AccessKeyDetails struct {
+			UserName string `json:"userName"`
+			// UserType is IAMUser, AssumedRole, Root or FederatedUser; for an assumed role
+			// UserName is the role's name
+			UserType string `json:"userType"`
+		} `json:"accessKeyDetails"`
+		S3BucketDetails   []guardDutyBucket `json:"s3BucketDetails"`
+		EksClusterDetails struct {
+			Name string `json:"name"`
+		} `json:"eksClusterDetails"`
+		RdsDbInstanceDetails struct {
+			DBInstanceIdentifier string `json:"dbInstanceIdentifier"`
+		} `json:"rdsDbInstanceDetails"`
+		LambdaDetails struct {
+			FunctionName string `json:"functionName"`
+		} `json:"lambdaDetails"`
+	} `json:"resource"`
+	Service struct {
+		DetectorID string `json:"detectorId"`
+		Archived   bool   `json:"archived"`
+	} `json:"service"`
+}
+
+type guardDutyBucket struct {
+	Name string `json:"name"`
+}
+
+// guardDutyFindingOf copies the fields CloudLoom keeps from a finding read from the API
+func guardDutyFindingOf(f gdtypes.Finding) *guardDutyFinding {
+	finding := &guardDutyFinding{
+		ID:          aws.ToString(f.Id),
+		AccountID:   aws.ToString(f.AccountId),
+		Region:      aws.ToString(f.Region),
+		Type:        aws.ToString(f.Type),
+		Title:       aws.ToString(f.Title),
+		Description: aws.ToString(f.Description),
+		Severity:    aws.ToFloat64(f.Severity),
+	}
+	if r := f.Resource; r != nil {
+		finding.Resource.ResourceType = aws.ToString(r.ResourceType)
+		if r.InstanceDetails != nil {
+			finding.Resource.InstanceDetails.InstanceID = aws.ToString(r.InstanceDetails.InstanceId)
+		}
+		if r.AccessKeyDetails != nil {
+			finding.Resource.AccessKeyDetails.UserName = aws.ToString(r.AccessKeyDetails.UserName)
+			finding.Resource.AccessKeyDetails.UserType = aws.ToString(r.AccessKeyDetails.UserType)
+		}
+		for _, bucket := range r.S3BucketDetails {
+			finding.Resource.S3BucketDetails = append(finding.Resource.S3BucketDetails, guardDutyBucket{Name: aws.ToString(bucket.Name)})
+		}
+		if r.EksClusterDetails != nil {
+			finding.Resource.EksClusterDetails.Name = aws.ToString(r.EksClusterDetails.Name)
+		}
+		if r.RdsDbInstanceDetails != nil {
+			finding.Resource.RdsDbInstanceDetails.DBInstanceIdentifier = aws.ToString(r.RdsDbInstanceDetails.DbInstanceIdentifier)
+		}
+		if r.LambdaDetails != nil {
+			finding.Resource.LambdaDetails.FunctionName = aws.ToString(r.LambdaDetails.FunctionName)
+		}
+	}
+	if f.Service != nil {
+		finding.Service.DetectorID = aws.ToString(f.Service.DetectorId)
+		finding.Service.Archived = aws.ToBool(f.Service.Archived)
+	}
+	return finding
+}
+
+// resource returns the Config resource type of the finding's resource, and the ID or, for
+// IAM users and roles, the name it has in the inventory
+func (f *guardDutyFinding) resource() (string, string) {
+	r := f.Resource
+	switch r.ResourceType {
+	case "Instance":
+		return "AWS::EC2::Instance", r.InstanceDetails.InstanceID
+	case "AccessKey":
+		if r.AccessKeyDetails.UserType == "AssumedRole" {
+			return "AWS::IAM::Role", r.AccessKeyDetails.UserName
+		}
+		return "AWS::IAM::User", r.AccessKeyDetails.UserName
+	case "S3Bucket":
+		if len(r.S3BucketDetails) > 0 {
+			return "AWS::S3::Bucket", r.S3BucketDetails[0].Name
+		}
+	case "EKSCluster":
+		return "AWS::EKS::Cluster", r.EksClusterDetails.Name
+	case "RDSDBInstance":
+		return "AWS::RDS::DBInstance", r.RdsDbInstanceDetails.DBInstanceIdentifier
+	case "Lambda":
+		return "AWS::Lambda::Function", r.LambdaDetails.FunctionName
+	}
+	// Other kinds of resource are findings about the account itself
+	return "AWS::::Account", f.AccountID
+}
+
+// guardDutySeverity maps GuardDuty's numeric severity onto CloudLoom's severities the way the
+// GuardDuty console labels it
+func guardDutySeverity(severity float64) string {
+	switch {
+	case severity >= 9:
+		return "critical"
+	case severity >= 7:
+		return "high"
+	case severity >= 4:
+		return "medium"
+	}
+	return "low"
+}
+
+// IngestGuardDutyEvent records the finding of a "GuardDuty Finding" event received on the
+// tenant's queue, read in full from the detector with the poller's credentials, and reports
+// whether it did. The event's own copy of the finding is used when the detector cannot be
+// read. The finding's resource is enriched with its name, tags and relationships from the
+// tenant's latest inventory snapshot.
+func IngestGuardDutyEvent(ctx context.Context, event *eventpipeline.Event) (bool, error) {
+	store := findings.Default()
+	if store == nil {
+		return false, nil
+	}
+
+	finding := &guardDutyFinding{}
+	if err := event.DecodeDetail(finding); err != nil {
+		return false, err
+	}
+	tenantID := event.TenantID
+	if finding.AccountID != "" && finding.AccountID != tenantID {
+		return false, nil
+	}
+
+	if detectorID := finding.Service.DetectorID; detectorID != "" && finding.ID != "" {
+		region := event.Region
+		if region == "" {
+			region = finding.Region
+		}
+		full, err := NewGuardDutyService(inRegion(event.Config, region)).Finding(ctx, detectorID, finding.ID)
+		if err != nil {
+			log.Printf("[GuardDuty] Warning: using the event's copy of finding %s: %v", finding.ID, err)
+		} else {
+			finding = full
+		}
+	}
+
+	resourceType, resourceID := finding.resource()
+	normalized := &findings.Finding{
+		TenantID:     tenantID,
+		Source:       FindingSourceGuardDuty,
+		RuleID:       finding.Type,
+		Title:        finding.Title,
+		Description:  finding.Description,
+		Severity:     guardDutySeverity(finding.Severity),
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	}
+	if item := inventoryResource(ctx, tenantID, resourceType, resourceID); item != nil {
+		normalized.ResourceID = item.ResourceID
+		normalized.Context = resourceContext(item)
+	}
+
+	// Archived findings are ones the customer dismissed in GuardDuty
+	if finding.Service.Archived {
+		fingerprint := findings.Fingerprint(normalized.Source, normalized.RuleID, normalized.ResourceType, normalized.ResourceID)
+		return store.Close(ctx, tenantID, fingerprint, findings.StatusResolved, "archived in GuardDuty")
+	}
+	if err := upsertFinding(ctx, store, normalized); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// inventoryResource finds a resource in the tenant's latest inventory snapshot by its ID or
+// name, or returns nil if there is no snapshot or the resource is not in it
+func inventoryResource(ctx context.Context, tenantID, resourceType, idOrName string) *ConfigurationItem {
+	if idOrName == "" || jobs.Default() == nil {
+		return nil
+	}
+	snapshot, err := GetInventorySnapshot(ctx, tenantID, "")
+	if err != nil {
+		return nil
+	}
+	var found *ConfigurationItem
+	err = EachResource(ctx, snapshot, ResourceFilter{Type: resourceType}, func(item *ConfigurationItem) error {
+		if item.ResourceID == idOrName || item.ResourceName == idOrName {
+			found = item
+			return errResourceFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errResourceFound) {
+		log.Printf("[Findings] Warning: failed to look up %s %s in the inventory: %v", resourceType, idOrName, err)
+	}
+	return found
+}
+
+// resourceContext is what a finding records about an inventory resource
+func resourceContext(item *ConfigurationItem) *findings.ResourceContext {
+	result := &findings.ResourceContext{ResourceName: item.ResourceName, Region: item.Region, Tags: item.Tags}
+	for _, related := range item.Relationships {
+		result.Related = append(result.Related, findings.RelatedResource{
+			ResourceType: related.ResourceType,
+			ResourceID:   related.ResourceID,
+			ResourceName: related.ResourceName,
+			Relationship: related.RelationshipName,
+		})
+	}
+	return result
+}
@@ -0,0 +1,174 @@
+package guardrails
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionGuardrails
+
+var (
+	// ErrInvalid is returned when guardrails protect nothing or have an unknown violation mode
+	ErrInvalid = errors.New("invalid guardrails")
+	// ErrNotFound is returned when a tenant has not defined guardrails
+	ErrNotFound = errors.New("guardrails not found")
+)
+
+// What the remediation engine does with an action that violates a guardrail
+const (
+	// OnViolationQueue proposes the action for approval instead of applying it
+	OnViolationQueue = "queue"
+	// OnViolationRefuse records the action as blocked without applying it
+	OnViolationRefuse = "refuse"
+)
+
+// Guardrails keep remediations nobody reviewed from changing protected resources, and from
+// changing too much of the account at once
+type Guardrails struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	// ProtectedTags protect resources with any of these tags, such as env: prod; a value of *
+	// matches any value
+	ProtectedTags map[string]string `bson:"protectedTags,omitempty" json:"protectedTags,omitempty"`
+	// ProtectedResources are ARNs or resource IDs; one ending in * protects every resource
+	// starting with the rest
+	ProtectedResources []string `bson:"protectedResources,omitempty" json:"protectedResources,omitempty"`
+	// MaxActionsPerHour caps the remediations started in any hour; 0 sets no cap
+	MaxActionsPerHour int `bson:"maxActionsPerHour" json:"maxActionsPerHour" binding:"min=0,max=10000"`
+	// OnViolation is queue or refuse; it defaults to queue
+	OnViolation string    `bson:"onViolation" json:"onViolation"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Normalize validates the guardrails, defaults their violation mode and sorts the resources
+func (g *Guardrails) Normalize() error {
+	if len(g.ProtectedTags) == 0 && len(g.ProtectedResources) == 0 && g.MaxActionsPerHour == 0 {
+		return fmt.Errorf("%w: protect at least one tag or resource, or cap the actions per hour", ErrInvalid)
+	}
+	if g.MaxActionsPerHour < 0 {
+		return fmt.Errorf("%w: maxActionsPerHour cannot be negative", ErrInvalid)
+	}
+	switch g.OnViolation {
+	case "":
+		g.OnViolation = OnViolationQueue
+	case OnViolationQueue, OnViolationRefuse:
+	default:
+		return fmt.Errorf("%w: onViolation must be %s or %s", ErrInvalid, OnViolationQueue, OnViolationRefuse)
+	}
+	for key := range g.ProtectedTags {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%w: protected tag keys cannot be empty", ErrInvalid)
+		}
+	}
+	for _, resource := range g.ProtectedResources {
+		if strings.TrimSpace(resource) == "" || resource == "*" {
+			return fmt.Errorf("%w: '%s' is not a resource ARN or ID", ErrInvalid, resource)
+		}
+	}
+	sort.Strings(g.ProtectedResources)
+	return nil
+}
+
+// Protects returns why the guardrails protect a resource known by any of the identifiers and
+// with the tags, or "" if they do not
+func (g *Guardrails) Protects(identifiers []string, tags map[string]string) string {
+	for _, resource := range g.ProtectedResources {
+		for _, id := range identifiers {
+			if resourceMatches(resource, id) {
+				return fmt.Sprintf("resource %s is protected", id)
+			}
+		}
+	}
+	keys := make([]string, 0, len(g.ProtectedTags))
+	for key := range g.ProtectedTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		actual, ok := tags[key]
+		if value := g.ProtectedTags[key]; ok && (value == "*" || strings.EqualFold(actual, value)) {
+			return fmt.Sprintf("resources tagged %s=%s are protected", key, actual)
+		}
+	}
+	return ""
+}
+
+func resourceMatches(pattern, id string) bool {
+	if id == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(id, prefix)
+	}
+	return pattern == id
+}
+
+// Store persists per-tenant guardrails in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide guardrail store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide guardrail store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the guardrails collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Get returns the tenant's guardrails
+func (s *Store) Get(ctx context.Context, tenantID string) (*Guardrails, error) {
+	var guardrails Guardrails
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&guardrails)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load guardrails: %w", err)
+	}
+	return &guardrails, nil
+}
+
+// Put validates the guardrails and replaces the tenant's guardrails with them
+func (s *Store) Put(ctx context.Context, tenantID string, guardrails *Guardrails) error {
+	if err := guardrails.Normalize(); err != nil {
+		return err
+	}
+	guardrails.TenantID = tenantID
+	guardrails.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"tenantId": tenantID}, guardrails, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save guardrails: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the tenant's guardrails
+func (s *Store) Delete(ctx context.Context, tenantID string) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete guardrails: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// credentialReportTimeout bounds how long a scan waits for IAM to generate the credential report
+const credentialReportTimeout = 30 * time.Second
+
+// IAMUserActivity is when an IAM user last signed in or used an access key, from the account's
+// credential report. AWS Config does not record either.
+type IAMUserActivity struct {
+	UserName          string     `json:"userName"`
+	Arn               string     `json:"arn"`
+	CreatedAt         *time.Time `json:"createdAt,omitempty"`
+	PasswordEnabled   bool       `json:"passwordEnabled"`
+	PasswordLastUsed  *time.Time `json:"passwordLastUsed,omitempty"`
+	AccessKeyLastUsed *time.Time `json:"accessKeyLastUsed,omitempty"`
+}
+
+// LastActivity is the latest sign-in or access key use, nil if the user never did either
+func (a IAMUserActivity) LastActivity() *time.Time {
+	last := a.PasswordLastUsed
+	if a.AccessKeyLastUsed != nil && (last == nil || a.AccessKeyLastUsed.After(*last)) {
+		last = a.AccessKeyLastUsed
+	}
+	return last
+}
+
+// GetIAMUserActivity generates the account's credential report and returns the activity of
+// every IAM user in it. The root user is left out.
+func (cs *ConfigService) GetIAMUserActivity(ctx context.Context, cfg aws.Config) ([]IAMUserActivity, error) {
+	client := iam.NewFromConfig(cfg)
+
+	// Generation is asynchronous; a report generated in the last four hours is returned as is
+	deadline := time.Now().Add(credentialReportTimeout)
+	for {
+		out, err := client.GenerateCredentialReport(ctx, &iam.GenerateCredentialReportInput{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate credential report: %w", err)
+		}
+		if out.State == iamtypes.ReportStateTypeComplete {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("credential report was not generated in time")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	report, err := client.GetCredentialReport(ctx, &iam.GetCredentialReportInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential report: %w", err)
+	}
+	activity, err := parseCredentialReport(string(report.Content))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[ConfigService] Read activity of %d IAM users from the credential report", len(activity))
+	return activity, nil
+}
+
+// parseCredentialReport reads the CSV credential report. Dates IAM does not have are given as
+// N/A, no_information or not_supported, and are left nil.
+func parseCredentialReport(content string) ([]IAMUserActivity, error) {
+	rows, err := csv.NewReader(strings.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credential report: %w", err)
+	}
+	if len(rows) == 0 {
+		return []IAMUserActivity{}, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	date := func(row []string, name string) *time.Time {
+		t, err := time.Parse(time.RFC3339, field(row, name))
+		if err != nil {
+			return nil
+		}
+		return &t
+	}
+
+	activity := []IAMUserActivity{}
+	for _, row := range rows[1:] {
+		if field(row, "user") == "<root_account>" {
+			continue
+		}
+		user := IAMUserActivity{
+			UserName:         field(row, "user"),
+			Arn:              field(row, "arn"),
+			CreatedAt:        date(row, "user_creation_time"),
+			PasswordEnabled:  field(row, "password_enabled") == "true",
+			PasswordLastUsed: date(row, "password_last_used"),
+		}
+		for _, key := range []string{"access_key_1_last_used_date", "access_key_2_last_used_date"} {
+			if used := date(row, key); used != nil && (user.AccessKeyLastUsed == nil || used.After(*user.AccessKeyLastUsed)) {
+				user.AccessKeyLastUsed = used
+			}
+		}
+		activity = append(activity, user)
+	}
+	return activity, nil
+}
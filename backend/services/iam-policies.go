@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Types of PolicyDocument collected from IAM
+const (
+	PolicyTypeCustomerManaged = "IAM_MANAGED"
+	PolicyTypeAWSManaged      = "AWS_MANAGED"
+	PolicyTypeInline          = "INLINE"
+	// PolicyTypeTrust is a role's trust policy, which says who may assume it
+	PolicyTypeTrust = "TRUST"
+)
+
+// awsManagedPolicyPrefix starts the ARN of every AWS managed policy
+const awsManagedPolicyPrefix = "arn:aws:iam::aws:policy/"
+
+// GetIAMPolicies retrieves every customer-managed policy, the AWS managed policies attached to
+// or bounding an identity, the inline policies of roles, users and groups, and role trust
+// policies. AttachedTo lists the ARNs of the identities each policy applies to, and BoundaryFor
+// those it is the permissions boundary of.
+func (cs *ConfigService) GetIAMPolicies(ctx context.Context, cfg aws.Config) ([]PolicyDocument, error) {
+	log.Println("[ConfigService] Fetching IAM policies...")
+
+	// One paginated call returns every identity with its policies, instead of several calls per
+	// identity and policy
+	var details iam.GetAccountAuthorizationDetailsOutput
+	paginator := iam.NewGetAccountAuthorizationDetailsPaginator(iam.NewFromConfig(cfg), &iam.GetAccountAuthorizationDetailsInput{
+		Filter: []iamtypes.EntityType{
+			iamtypes.EntityTypeUser,
+			iamtypes.EntityTypeRole,
+			iamtypes.EntityTypeGroup,
+			iamtypes.EntityTypeLocalManagedPolicy,
+			iamtypes.EntityTypeAWSManagedPolicy,
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get account authorization details: %w", err)
+		}
+		details.UserDetailList = append(details.UserDetailList, page.UserDetailList...)
+		details.RoleDetailList = append(details.RoleDetailList, page.RoleDetailList...)
+		details.GroupDetailList = append(details.GroupDetailList, page.GroupDetailList...)
+		details.Policies = append(details.Policies, page.Policies...)
+	}
+
+	collector := newPolicyCollector()
+	for _, policy := range details.Policies {
+		collector.addManaged(policy)
+	}
+	for _, role := range details.RoleDetailList {
+		roleArn := aws.ToString(role.Arn)
+		collector.addInline(aws.ToString(role.RoleName), roleArn, PolicyTypeTrust, aws.ToString(role.AssumeRolePolicyDocument))
+		for _, inline := range role.RolePolicyList {
+			collector.addInline(aws.ToString(inline.PolicyName), roleArn, PolicyTypeInline, aws.ToString(inline.PolicyDocument))
+		}
+		collector.attach(roleArn, role.AttachedManagedPolicies, role.PermissionsBoundary)
+	}
+	for _, user := range details.UserDetailList {
+		userArn := aws.ToString(user.Arn)
+		for _, inline := range user.UserPolicyList {
+			collector.addInline(aws.ToString(inline.PolicyName), userArn, PolicyTypeInline, aws.ToString(inline.PolicyDocument))
+		}
+		collector.attach(userArn, user.AttachedManagedPolicies, user.PermissionsBoundary)
+	}
+	for _, group := range details.GroupDetailList {
+		groupArn := aws.ToString(group.Arn)
+		for _, inline := range group.GroupPolicyList {
+			collector.addInline(aws.ToString(inline.PolicyName), groupArn, PolicyTypeInline, aws.ToString(inline.PolicyDocument))
+		}
+		collector.attach(groupArn, group.AttachedManagedPolicies, nil)
+	}
+
+	policies := collector.policies()
+	log.Printf("[ConfigService] Successfully fetched %d IAM policies (%d managed, %d inline or trust).",
+		len(policies), len(collector.managedOrder), len(collector.inline))
+	return policies, nil
+}
+
+// policyCollector gathers the policies of an account's authorization details, keeping managed
+// policies by ARN so identities can be attached to them
+type policyCollector struct {
+	managed      map[string]*PolicyDocument
+	managedOrder []string
+	inline       []PolicyDocument
+}
+
+func newPolicyCollector() *policyCollector {
+	return &policyCollector{managed: map[string]*PolicyDocument{}}
+}
+
+// addManaged adds a managed policy with its default version's document. AWS managed policies
+// no identity uses are skipped, since every account has all of them.
+func (c *policyCollector) addManaged(policy iamtypes.ManagedPolicyDetail) {
+	arn := aws.ToString(policy.Arn)
+	policyType := PolicyTypeCustomerManaged
+	if strings.HasPrefix(arn, awsManagedPolicyPrefix) {
+		if aws.ToInt32(policy.AttachmentCount) == 0 && aws.ToInt32(policy.PermissionsBoundaryUsageCount) == 0 {
+			return
+		}
+		policyType = PolicyTypeAWSManaged
+	}
+
+	var document map[string]interface{}
+	for _, version := range policy.PolicyVersionList {
+		if !version.IsDefaultVersion {
+			continue
+		}
+		var err error
+		if document, err = decodePolicyDocument(aws.ToString(version.Document)); err != nil {
+			log.Printf("[ConfigService] Warning: failed to decode policy document for %s: %v", arn, err)
+		}
+	}
+
+	c.managed[arn] = &PolicyDocument{
+		PolicyName:     aws.ToString(policy.PolicyName),
+		PolicyType:     policyType,
+		PolicyDocument: document,
+		AttachedTo:     []string{},
+		ResourceArn:    arn,
+	}
+	c.managedOrder = append(c.managedOrder, arn)
+}
+
+// addInline adds a policy embedded in an identity: an inline policy or a trust policy
+func (c *policyCollector) addInline(name, identityArn, policyType, encoded string) {
+	if encoded == "" {
+		return
+	}
+	document, err := decodePolicyDocument(encoded)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: failed to decode %s policy %s of %s: %v", strings.ToLower(policyType), name, identityArn, err)
+		return
+	}
+	c.inline = append(c.inline, PolicyDocument{
+		PolicyName:     name,
+		PolicyType:     policyType,
+		PolicyDocument: document,
+		AttachedTo:     []string{identityArn},
+	})
+}
+
+// attach records an identity on the managed policies attached to it and on its boundary
+func (c *policyCollector) attach(identityArn string, attached []iamtypes.AttachedPolicy, boundary *iamtypes.AttachedPermissionsBoundary) {
+	for _, policy := range attached {
+		if managed := c.managed[aws.ToString(policy.PolicyArn)]; managed != nil {
+			managed.AttachedTo = appendUnique(managed.AttachedTo, identityArn)
+		}
+	}
+	if boundary != nil {
+		if managed := c.managed[aws.ToString(boundary.PermissionsBoundaryArn)]; managed != nil {
+			managed.BoundaryFor = appendUnique(managed.BoundaryFor, identityArn)
+		}
+	}
+}
+
+// policies returns the managed policies in the order IAM listed them, then the embedded ones
+func (c *policyCollector) policies() []PolicyDocument {
+	policies := make([]PolicyDocument, 0, len(c.managedOrder)+len(c.inline))
+	for _, arn := range c.managedOrder {
+		policies = append(policies, *c.managed[arn])
+	}
+	return append(policies, c.inline...)
+}
+
+// decodePolicyDocument parses a policy document as IAM returns it, URL-encoded JSON
+func decodePolicyDocument(encoded string) (map[string]interface{}, error) {
+	decoded, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to URL-decode policy document: %w", err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(decoded), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document JSON: %w", err)
+	}
+	return document, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// Defaults of how long a snapshot answers a refresh request: one younger than the max age is
+// served as is, and one stale by no more than the stale window is served while a scan
+// replaces it in the background
+const (
+	defaultInventoryMaxAge   = 5 * time.Minute
+	defaultInventoryStaleFor = time.Hour
+)
+
+// Freshness of the snapshot a refresh request was answered with
+const (
+	SnapshotFresh   = "fresh"
+	SnapshotStale   = "stale"
+	SnapshotScanned = "scanned"
+)
+
+// InventoryCachePolicy is how long a snapshot answers requests to refresh the inventory, so
+// clients polling with refresh do not scan the account, and trip AWS throttling, on every poll
+type InventoryCachePolicy struct {
+	MaxAge   time.Duration
+	StaleFor time.Duration
+}
+
+// inventoryCachePolicy is read from INVENTORY_MAX_AGE_SECONDS and INVENTORY_STALE_SECONDS
+var inventoryCachePolicy = inventoryCachePolicyFromEnv()
+
+func inventoryCachePolicyFromEnv() InventoryCachePolicy {
+	policy := InventoryCachePolicy{MaxAge: defaultInventoryMaxAge, StaleFor: defaultInventoryStaleFor}
+	if v, err := strconv.Atoi(os.Getenv("INVENTORY_MAX_AGE_SECONDS")); err == nil && v >= 0 {
+		policy.MaxAge = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("INVENTORY_STALE_SECONDS")); err == nil && v >= 0 {
+		policy.StaleFor = time.Duration(v) * time.Second
+	}
+	return policy
+}
+
+// snapshotAge is how long ago a snapshot was scanned
+func snapshotAge(snapshot *InventorySnapshot, now time.Time) time.Duration {
+	if snapshot.ScannedAt != nil {
+		return now.Sub(*snapshot.ScannedAt)
+	}
+	return now.Sub(snapshot.CreatedAt)
+}
+
+// ResolveInventorySnapshot returns the tenant's snapshot snapshotID, or its latest one if that
+// is empty, without loading its inventory, and how fresh it is. With refresh the latest
+// snapshot is returned if it is within the cache policy's max age; a stale one is returned
+// while an inventory scan is queued to replace it; otherwise the account is scanned now. It
+// returns jobs.ErrNotFound if there is no such snapshot.
+func ResolveInventorySnapshot(ctx context.Context, tenantID, snapshotID string, refresh bool) (*InventorySnapshot, string, error) {
+	snapshot, _, freshness, err := resolveInventory(ctx, tenantID, snapshotID, refresh)
+	return snapshot, freshness, err
+}
+
+// resolveInventory is ResolveInventorySnapshot, also returning the inventory when the account
+// was scanned for it
+func resolveInventory(ctx context.Context, tenantID, snapshotID string, refresh bool) (*InventorySnapshot, *ResourceInventory, string, error) {
+	if !refresh {
+		snapshot, err := GetInventorySnapshot(ctx, tenantID, snapshotID)
+		return snapshot, nil, SnapshotFresh, err
+	}
+
+	latest, err := GetInventorySnapshot(ctx, tenantID, "")
+	if err != nil && !errors.Is(err, jobs.ErrNotFound) {
+		return nil, nil, "", err
+	}
+	if latest != nil {
+		policy := inventoryCachePolicy
+		age := snapshotAge(latest, time.Now())
+		if age <= policy.MaxAge {
+			return latest, nil, SnapshotFresh, nil
+		}
+		if age <= policy.MaxAge+policy.StaleFor {
+			revalidateInventory(ctx, tenantID)
+			return latest, nil, SnapshotStale, nil
+		}
+	}
+
+	snapshot, inventory, err := sharedRefresh(ctx, tenantID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return snapshot, inventory, SnapshotScanned, nil
+}
+
+// revalidateInventory queues an inventory scan for the tenant unless one is already queued or
+// running. Failures are logged, since the stale snapshot has been served either way.
+func revalidateInventory(ctx context.Context, tenantID string) {
+	manager := jobs.Default()
+	for _, status := range []jobs.Status{jobs.StatusQueued, jobs.StatusRunning} {
+		active, err := manager.List(ctx, jobs.ListFilter{Type: JobTypeInventoryScan, TenantID: tenantID, Status: status, Limit: 1})
+		if err != nil {
+			log.Printf("[Inventory] Warning: failed to look up inventory scans of tenant %s: %v", tenantID, err)
+			return
+		}
+		if len(active) > 0 {
+			return
+		}
+	}
+	if _, err := manager.Enqueue(ctx, JobTypeInventoryScan, tenantID, nil); err != nil {
+		log.Printf("[Inventory] Warning: failed to queue inventory scan of tenant %s: %v", tenantID, err)
+	}
+}
+
+// inventoryRefresh is a scan started by a refresh request, which concurrent refresh requests
+// of the same tenant wait for rather than scanning again
+type inventoryRefresh struct {
+	done      chan struct{}
+	snapshot  *InventorySnapshot
+	inventory *ResourceInventory
+	err       error
+}
+
+var (
+	refreshesMu sync.Mutex
+	refreshes   = map[string]*inventoryRefresh{}
+)
+
+// sharedRefresh scans the tenant's account as RefreshInventory does, joining a scan already
+// in progress for the tenant. The scan is not cancelled with the request that started it,
+// since other requests may be waiting for it.
+func sharedRefresh(ctx context.Context, tenantID string) (*InventorySnapshot, *ResourceInventory, error) {
+	refreshesMu.Lock()
+	refresh, inProgress := refreshes[tenantID]
+	if !inProgress {
+		refresh = &inventoryRefresh{done: make(chan struct{})}
+		refreshes[tenantID] = refresh
+	}
+	refreshesMu.Unlock()
+
+	if !inProgress {
+		go func() {
+			refresh.snapshot, refresh.inventory, refresh.err = RefreshInventory(context.WithoutCancel(ctx), tenantID)
+			refreshesMu.Lock()
+			delete(refreshes, tenantID)
+			refreshesMu.Unlock()
+			close(refresh.done)
+		}()
+	}
+
+	select {
+	case <-refresh.done:
+		return refresh.snapshot, refresh.inventory, refresh.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// Compliance of a resource across the AWS Config rules that evaluated it
+const (
+	ComplianceCompliant    = "COMPLIANT"
+	ComplianceNonCompliant = "NON_COMPLIANT"
+	ComplianceNotEvaluated = "NOT_EVALUATED"
+)
+
+// maxResourcePage is the most resources QueryResources returns at once
+const maxResourcePage = 500
+
+// ResourceFilter narrows the resources QueryResources returns. Empty fields match every resource.
+type ResourceFilter struct {
+	Type   string
+	Region string
+	// Tags are "key" or "key=value"; a resource must have every one of them
+	Tags             []string
+	ComplianceStatus string
+	Offset           int
+	Limit            int
+}
+
+// matches reports whether a resource, with its compliance already set, passes the filter
+func (f ResourceFilter) matches(item *ConfigurationItem) bool {
+	if f.Type != "" && !strings.EqualFold(item.ResourceType, f.Type) {
+		return false
+	}
+	if f.Region != "" && item.Region != f.Region {
+		return false
+	}
+	if f.ComplianceStatus != "" && !strings.EqualFold(item.ComplianceStatus, f.ComplianceStatus) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		actual, ok := item.Tags[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResourcePage is one page of the resources in a snapshot that match a filter
+type ResourcePage struct {
+	Snapshot  InventorySnapshot   `json:"snapshot"`
+	Total     int                 `json:"total"`
+	Offset    int                 `json:"offset"`
+	Resources []ConfigurationItem `json:"resources"`
+}
+
+// ResourceEvaluation is an AWS Config rule's evaluation of one resource
+type ResourceEvaluation struct {
+	ConfigRuleName string `json:"configRuleName"`
+	EvaluationResult
+}
+
+// ResourceDetail is a resource with its full configuration, the rules that evaluated it and
+// the resources that name it in their own relationships
+type ResourceDetail struct {
+	Snapshot     InventorySnapshot    `json:"snapshot"`
+	Resource     ConfigurationItem    `json:"resource"`
+	Evaluations  []ResourceEvaluation `json:"evaluations"`
+	ReferencedBy []Relationship       `json:"referencedBy"`
+}
+
+// InventorySummary is the resource summary of a snapshot
+type InventorySummary struct {
+	Snapshot    InventorySnapshot `json:"snapshot"`
+	Summary     ResourceSummary   `json:"summary"`
+	LastUpdated time.Time         `json:"lastUpdated"`
+}
+
+// LoadInventory returns a stored inventory snapshot of the tenant: snapshotID, or the latest
+// one if it is empty. With refresh the latest snapshot is returned if the inventory cache
+// policy allows, and otherwise the account is scanned first and the new snapshot stored and
+// returned, as ResolveInventorySnapshot does. It returns jobs.ErrNotFound if there is no such
+// snapshot.
+func LoadInventory(ctx context.Context, tenantID, snapshotID string, refresh bool) (*InventorySnapshot, *ResourceInventory, error) {
+	if refresh {
+		snapshot, scanned, _, err := resolveInventory(ctx, tenantID, snapshotID, true)
+		if err != nil || scanned != nil {
+			return snapshot, scanned, err
+		}
+		snapshotID = snapshot.ID
+	}
+
+	var inventory ResourceInventory
+	var job *jobs.Job
+	var err error
+	if snapshotID == "" {
+		job, err = jobs.Default().LatestResult(ctx, JobTypeInventoryScan, tenantID, &inventory)
+	} else if job, err = inventorySnapshotJob(ctx, tenantID, snapshotID); err == nil {
+		err = jobs.Default().DecodeResult(ctx, job.ID.Hex(), &inventory)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := snapshotOf(job)
+	applyResourceCompliance(&inventory)
+	return &snapshot, &inventory, nil
+}
+
+// GetInventorySnapshot returns the tenant's snapshot snapshotID, or its latest one if that is
+// empty, without loading its inventory. It returns jobs.ErrNotFound if there is no such snapshot.
+func GetInventorySnapshot(ctx context.Context, tenantID, snapshotID string) (*InventorySnapshot, error) {
+	var job *jobs.Job
+	var err error
+	if snapshotID == "" {
+		job, err = jobs.Default().Latest(ctx, JobTypeInventoryScan, tenantID)
+	} else {
+		job, err = inventorySnapshotJob(ctx, tenantID, snapshotID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := snapshotOf(job)
+	return &snapshot, nil
+}
+
+// EachResource calls fn with each resource of a snapshot that matches the filter, with its
+// compliance set, reading them from the store a batch at a time so large inventories are never
+// held in memory. The filter's Offset and Limit are ignored. It stops at the first error of fn
+// and returns it.
+func EachResource(ctx context.Context, snapshot *InventorySnapshot, filter ResourceFilter, fn func(item *ConfigurationItem) error) error {
+	rules, err := jobs.Default().ResultItems(ctx, snapshot.ID, "compliancerules", 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	var complianceRules []ComplianceRule
+	if err := rules.All(ctx, &complianceRules); err != nil {
+		return fmt.Errorf("failed to read compliance rules of snapshot %s: %w", snapshot.ID, err)
+	}
+	status := resourceCompliance(complianceRules)
+
+	cursor, err := jobs.Default().ResultItems(ctx, snapshot.ID, "resources", 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var item ConfigurationItem
+		if err := cursor.Decode(&item); err != nil {
+			return fmt.Errorf("failed to decode resource of snapshot %s: %w", snapshot.ID, err)
+		}
+		item.ComplianceStatus = status[item.ResourceType+"/"+item.ResourceID]
+		if item.ComplianceStatus == "" {
+			item.ComplianceStatus = ComplianceNotEvaluated
+		}
+		if !filter.matches(&item) {
+			continue
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// RefreshInventory scans the tenant's account now and stores the result as its latest
+// snapshot, as a scheduled inventory scan would
+func RefreshInventory(ctx context.Context, tenantID string) (*InventorySnapshot, *ResourceInventory, error) {
+	inventory, err := scanInventory(ctx, tenantID, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	job, err := IngestInventory(ctx, tenantID, inventory)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := snapshotOf(job)
+	applyResourceCompliance(inventory)
+	return &snapshot, inventory, nil
+}
+
+// applyResourceCompliance sets the compliance of each resource from the rule evaluations in
+// the inventory, as resourceCompliance derives it
+func applyResourceCompliance(inventory *ResourceInventory) {
+	status := resourceCompliance(inventory.ComplianceRules)
+	for i := range inventory.Resources {
+		item := &inventory.Resources[i]
+		item.ComplianceStatus = status[item.ResourceType+"/"+item.ResourceID]
+		if item.ComplianceStatus == "" {
+			item.ComplianceStatus = ComplianceNotEvaluated
+		}
+	}
+}
+
+// QueryResources returns the page of the inventory's resources matching the filter
+func QueryResources(snapshot *InventorySnapshot, inventory *ResourceInventory, filter ResourceFilter) *ResourcePage {
+	if filter.Limit <= 0 || filter.Limit > maxResourcePage {
+		filter.Limit = 100
+	}
+	page := &ResourcePage{Snapshot: *snapshot, Offset: filter.Offset, Resources: []ConfigurationItem{}}
+	for i := range inventory.Resources {
+		if !filter.matches(&inventory.Resources[i]) {
+			continue
+		}
+		if page.Total >= filter.Offset && len(page.Resources) < filter.Limit {
+			page.Resources = append(page.Resources, inventory.Resources[i])
+		}
+		page.Total++
+	}
+	return page
+}
+
+// GetResourceDetail returns a resource of the inventory by its ID, or jobs.ErrNotFound if the
+// snapshot does not have it
+func GetResourceDetail(snapshot *InventorySnapshot, inventory *ResourceInventory, resourceID string) (*ResourceDetail, error) {
+	var detail *ResourceDetail
+	for i := range inventory.Resources {
+		if inventory.Resources[i].ResourceID == resourceID {
+			detail = &ResourceDetail{Snapshot: *snapshot, Resource: inventory.Resources[i], Evaluations: []ResourceEvaluation{}, ReferencedBy: []Relationship{}}
+			break
+		}
+	}
+	if detail == nil {
+		return nil, fmt.Errorf("%w: resource %s is not in snapshot %s", jobs.ErrNotFound, resourceID, snapshot.ID)
+	}
+
+	for _, rule := range inventory.ComplianceRules {
+		for _, eval := range rule.EvaluationResults {
+			if eval.ResourceID == resourceID {
+				detail.Evaluations = append(detail.Evaluations, ResourceEvaluation{ConfigRuleName: rule.ConfigRuleName, EvaluationResult: eval})
+			}
+		}
+	}
+	for _, item := range inventory.Resources {
+		for _, relationship := range item.Relationships {
+			if relationship.ResourceID == resourceID {
+				detail.ReferencedBy = append(detail.ReferencedBy, Relationship{
+					ResourceType:     item.ResourceType,
+					ResourceID:       item.ResourceID,
+					ResourceName:     item.ResourceName,
+					RelationshipName: relationship.RelationshipName,
+				})
+			}
+		}
+	}
+	return detail, nil
+}
+
+// SummarizeInventory returns the resource summary of the inventory, counting resources by the
+// compliance applyResourceCompliance set
+func SummarizeInventory(snapshot *InventorySnapshot, inventory *ResourceInventory) *InventorySummary {
+	summary := inventory.ResourceSummary
+	summary.ComplianceStatus = map[string]int{}
+	for _, item := range inventory.Resources {
+		summary.ComplianceStatus[item.ComplianceStatus]++
+	}
+	return &InventorySummary{Snapshot: *snapshot, Summary: summary, LastUpdated: inventory.LastUpdated}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// snapshotResourceFields are the fields of each resource a snapshot diff reads. Scan results
+// are stored with lowercased keys.
+var snapshotResourceFields = []string{"resourcetype", "resourceid", "resourcename", "configurationstateid"}
+
+// InventorySnapshot is one stored inventory scan of a tenant's account. Every successful
+// inventory scan is kept as a snapshot; its ID is the ID of the scan job.
+type InventorySnapshot struct {
+	ID        string     `json:"id"`
+	TenantID  string     `json:"tenantId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ScannedAt *time.Time `json:"scannedAt,omitempty"`
+}
+
+// SnapshotDiff lists the resources added, removed or changed between two inventory snapshots
+type SnapshotDiff struct {
+	From    InventorySnapshot `json:"from"`
+	To      InventorySnapshot `json:"to"`
+	Added   []DriftResource   `json:"added"`
+	Removed []DriftResource   `json:"removed"`
+	Changed []DriftResource   `json:"changed"`
+}
+
+func snapshotOf(job *jobs.Job) InventorySnapshot {
+	return InventorySnapshot{ID: job.ID.Hex(), TenantID: job.TenantID, CreatedAt: job.CreatedAt, ScannedAt: job.FinishedAt}
+}
+
+// ListInventorySnapshots returns the tenant's inventory snapshots, newest first
+func ListInventorySnapshots(ctx context.Context, tenantID string, limit int64) ([]InventorySnapshot, error) {
+	found, err := jobs.Default().List(ctx, jobs.ListFilter{
+		Type:     JobTypeInventoryScan,
+		TenantID: tenantID,
+		Status:   jobs.StatusSucceeded,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]InventorySnapshot, 0, len(found))
+	for i := range found {
+		snapshots = append(snapshots, snapshotOf(&found[i]))
+	}
+	return snapshots, nil
+}
+
+// inventorySnapshotJob returns the scan job of one of the tenant's snapshots, or
+// jobs.ErrNotFound if the ID is not a successful inventory scan of the tenant
+func inventorySnapshotJob(ctx context.Context, tenantID, id string) (*jobs.Job, error) {
+	job, err := jobs.Default().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Type != JobTypeInventoryScan || job.TenantID != tenantID || job.Status != jobs.StatusSucceeded {
+		return nil, jobs.ErrNotFound
+	}
+	return job, nil
+}
+
+// DiffInventorySnapshots compares snapshot id with snapshot againstID, or with the snapshot
+// taken before it if againstID is empty. It returns jobs.ErrNotFound if either snapshot does
+// not exist, including when id is the tenant's first.
+func DiffInventorySnapshots(ctx context.Context, tenantID, id, againstID string) (*SnapshotDiff, error) {
+	to, err := inventorySnapshotJob(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var from *jobs.Job
+	if againstID != "" {
+		if from, err = inventorySnapshotJob(ctx, tenantID, againstID); err != nil {
+			return nil, err
+		}
+	} else {
+		previous, err := jobs.Default().List(ctx, jobs.ListFilter{
+			Type:          JobTypeInventoryScan,
+			TenantID:      tenantID,
+			Status:        jobs.StatusSucceeded,
+			CreatedBefore: to.CreatedAt,
+			Limit:         1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(previous) == 0 {
+			return nil, fmt.Errorf("%w: no snapshot before %s", jobs.ErrNotFound, id)
+		}
+		from = &previous[0]
+	}
+
+	previous, err := snapshotResources(ctx, from.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	current, err := snapshotResources(ctx, to.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	diff := &SnapshotDiff{From: snapshotOf(from), To: snapshotOf(to)}
+	diff.Added, diff.Removed, diff.Changed = diffResources(previous, current)
+	return diff, nil
+}
+
+// snapshotResources reads the identity and configuration state of every resource in a
+// snapshot, without decoding the rest of the scan
+func snapshotResources(ctx context.Context, id string) ([]DriftResource, error) {
+	cursor, err := jobs.Default().ResultItems(ctx, id, "resources", 0, 0, snapshotResourceFields)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	resources := []DriftResource{}
+	for cursor.Next(ctx) {
+		var item ConfigurationItem
+		if err := cursor.Decode(&item); err != nil {
+			return nil, fmt.Errorf("failed to decode resource of snapshot %s: %w", id, err)
+		}
+		resources = append(resources, DriftResource{
+			ResourceType: item.ResourceType,
+			ResourceID:   item.ResourceID,
+			ResourceName: item.ResourceName,
+			StateID:      item.ConfigurationStateId,
+		})
+	}
+	return resources, cursor.Err()
+}
+
+// diffResources returns the resources in current but not previous, those in previous but not
+// current, and those in both whose configuration state changed
+func diffResources(previous, current []DriftResource) (added, removed, changed []DriftResource) {
+	added, removed, changed = []DriftResource{}, []DriftResource{}, []DriftResource{}
+	byKey := make(map[string]DriftResource, len(current))
+	for _, resource := range current {
+		byKey[resource.ResourceType+"/"+resource.ResourceID] = resource
+	}
+
+	seen := make(map[string]bool, len(previous))
+	for _, old := range previous {
+		key := old.ResourceType + "/" + old.ResourceID
+		seen[key] = true
+		now, ok := byKey[key]
+		switch {
+		case !ok:
+			removed = append(removed, old)
+		case old.StateID != "" && now.StateID != old.StateID:
+			changed = append(changed, now)
+		}
+	}
+	for _, resource := range current {
+		if !seen[resource.ResourceType+"/"+resource.ResourceID] {
+			added = append(added, resource)
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/accountconfig"
+	"github.com/rishichirchi/cloudloom/services/email"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/retention"
+	"github.com/rishichirchi/cloudloom/services/steampipe"
+	"github.com/rishichirchi/cloudloom/services/tenantdata"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobTypeInventoryScan collects the full AWS Config resource inventory for the customer account
+const JobTypeInventoryScan = "inventory_scan"
+
+// JobTypeDriftCheck compares the current resource inventory with the previous drift check
+const JobTypeDriftCheck = "drift_check"
+
+// JobTypeSteampipeBenchmark runs a Steampipe compliance benchmark
+const JobTypeSteampipeBenchmark = "steampipe_benchmark"
+
+// JobTypeReportEmail emails a summary of the latest inventory scan
+const JobTypeReportEmail = "report_email"
+
+// JobTypeTenantExport writes all of a tenant's data to a customer-provided S3 bucket
+const JobTypeTenantExport = "tenant_export"
+
+// JobTypeAgentInventoryScan asks a self-hosted agent to scan the account and upload the inventory
+const JobTypeAgentInventoryScan = "agent_inventory_scan"
+
+// JobTypeRetention archives and deletes data that is older than the tenant's retention policy
+const JobTypeRetention = "data_retention"
+
+// RegisterJobHandlers registers the background jobs implemented by the services package
+func RegisterJobHandlers(m *jobs.Manager) {
+	m.RegisterWithPolicy(JobTypeInventoryScan, runInventoryScanJob, jobs.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     15 * time.Minute,
+		Multiplier:     3,
+	})
+	m.RegisterWithPolicy(JobTypeDriftCheck, runDriftCheckJob, jobs.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     15 * time.Minute,
+		Multiplier:     3,
+	})
+	m.Register(JobTypeSteampipeBenchmark, runSteampipeBenchmarkJob)
+	m.Register(JobTypeReportEmail, runReportEmailJob)
+	m.Register(JobTypeTenantExport, runTenantExportJob)
+	m.Register(JobTypeRetention, runRetentionJob)
+	m.Register(JobTypeKeyDeactivation, runKeyDeactivationJob)
+	m.Register(JobTypeAccountSetup, runAccountSetupJob)
+	m.RegisterWithPolicy(JobTypeWebhookDelivery, runWebhookDeliveryJob, webhookRetryPolicy)
+	m.RegisterWithPolicy(JobTypeNotifierDelivery, runNotifierDeliveryJob, notifierRetryPolicy)
+	// A failed ticket sync is not retried; the next scheduled one picks up where it left off
+	m.RegisterWithPolicy(JobTypeTicketSync, runTicketSyncJob, jobs.NoRetry)
+	m.RegisterRemote(JobTypeAgentInventoryScan, jobs.DefaultRetryPolicy)
+
+	// Inventory scans are the tenant's snapshot history, so they are not expired with other jobs
+	m.SetRetention(JobTypeInventoryScan, 0)
+}
+
+// runInventoryScanJob assumes the customer role, runs a comprehensive inventory scan, or with
+// the "sync" payload mode applies the changes AWS Config delivered since the last one, and
+// refreshes the tenant's compliance findings from it
+func runInventoryScanJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	scanStartedAt := time.Now()
+	scan := scanInventory
+	if mode, _ := job.Payload["mode"].(string); mode == InventoryScanModeSync {
+		scan = syncInventory
+	}
+	inventory, err := scan(ctx, job.TenantID, scanStartedAt)
+	if err != nil {
+		return nil, err
+	}
+	syncInventoryFindings(ctx, job.TenantID, inventory, scanStartedAt)
+	return inventory, nil
+}
+
+// scanInventory collects the tenant's resource inventory, synthetic in demo mode
+func scanInventory(ctx context.Context, tenantID string, now time.Time) (*ResourceInventory, error) {
+	if DemoModeEnabled() {
+		return DemoInventory(tenantID, now), nil
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	inventory, err := NewConfigService(customerCfg).GetComprehensiveResourceInventory(ctx, customerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("inventory scan failed: %w", err)
+	}
+	return inventory, nil
+}
+
+// IngestInventory stores an inventory collected outside the API process, such as by a
+// self-hosted agent, as the tenant's latest snapshot and refreshes its compliance findings
+func IngestInventory(ctx context.Context, tenantID string, inventory *ResourceInventory) (*jobs.Job, error) {
+	ingestedAt := time.Now()
+	job, err := jobs.Default().RecordResult(ctx, JobTypeInventoryScan, tenantID, inventory)
+	if err != nil {
+		return nil, err
+	}
+	syncInventoryFindings(ctx, tenantID, inventory, ingestedAt)
+	return job, nil
+}
+
+// FindingSourceAWSConfig marks findings produced from AWS Config rule evaluations
+const FindingSourceAWSConfig = "aws_config"
+
+// syncInventoryFindings refreshes every kind of finding derived from an inventory scan.
+// Failures are logged so they do not fail the scan itself.
+func syncInventoryFindings(ctx context.Context, tenantID string, inventory *ResourceInventory, scanStartedAt time.Time) {
+	if err := syncComplianceFindings(ctx, tenantID, inventory.ComplianceRules, scanStartedAt); err != nil {
+		log.Printf("[Findings] Warning: %v", err)
+	}
+	if err := syncImageFindings(ctx, tenantID, inventory.ECRRepositories, scanStartedAt); err != nil {
+		log.Printf("[Findings] Warning: %v", err)
+	}
+	if err := syncTagFindings(ctx, tenantID, inventory.Resources, scanStartedAt); err != nil {
+		log.Printf("[Findings] Warning: %v", err)
+	}
+	if err := syncExposureFindings(ctx, tenantID, inventory, scanStartedAt); err != nil {
+		log.Printf("[Findings] Warning: %v", err)
+	}
+	if err := syncUnusedFindings(ctx, tenantID, inventory, scanStartedAt); err != nil {
+		log.Printf("[Findings] Warning: %v", err)
+	}
+}
+
+// syncComplianceFindings records a finding for every non-compliant evaluation and
+// resolves findings from earlier scans that are no longer reported
+func syncComplianceFindings(ctx context.Context, tenantID string, rules []ComplianceRule, scanStartedAt time.Time) error {
+	store := findings.Default()
+	if store == nil {
+		return nil
+	}
+
+	if _, err := store.ReopenExpiredSuppressions(ctx); err != nil {
+		return err
+	}
+
+	recorded := 0
+	for _, rule := range rules {
+		for _, eval := range rule.EvaluationResults {
+			if eval.ComplianceType != "NON_COMPLIANT" {
+				continue
+			}
+			finding := &findings.Finding{
+				TenantID:     tenantID,
+				Source:       FindingSourceAWSConfig,
+				RuleID:       rule.ConfigRuleName,
+				Title:        fmt.Sprintf("%s is non-compliant with %s", eval.ResourceID, rule.ConfigRuleName),
+				Description:  eval.Annotation,
+				Severity:     "medium",
+				ResourceType: eval.ResourceType,
+				ResourceID:   eval.ResourceID,
+			}
+			if err := upsertFinding(ctx, store, finding); err != nil {
+				return err
+			}
+			recorded++
+		}
+	}
+
+	resolved, err := store.ResolveStale(ctx, tenantID, FindingSourceAWSConfig, scanStartedAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Findings] ✅ Recorded %d compliance findings, resolved %d for tenant %s", recorded, resolved, tenantID)
+	return nil
+}
+
+// DriftResource identifies a resource and the configuration state it was last seen in
+type DriftResource struct {
+	ResourceType string `bson:"resourceType" json:"resourceType"`
+	ResourceID   string `bson:"resourceId" json:"resourceId"`
+	ResourceName string `bson:"resourceName,omitempty" json:"resourceName,omitempty"`
+	StateID      string `bson:"stateId,omitempty" json:"stateId,omitempty"`
+}
+
+// DriftReport lists the resources added, removed or changed since the previous drift check
+type DriftReport struct {
+	BaselineAt *time.Time      `bson:"baselineAt,omitempty" json:"baselineAt,omitempty"`
+	CheckedAt  time.Time       `bson:"checkedAt" json:"checkedAt"`
+	Added      []DriftResource `bson:"added" json:"added"`
+	Removed    []DriftResource `bson:"removed" json:"removed"`
+	Changed    []DriftResource `bson:"changed" json:"changed"`
+	Snapshot   []DriftResource `bson:"snapshot" json:"snapshot"`
+}
+
+// runDriftCheckJob scans the inventory and diffs it against the last successful drift check
+func runDriftCheckJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	customerCfg, err := assumeTenantRole(ctx, job.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	inventory, err := NewConfigService(customerCfg).GetComprehensiveResourceInventory(ctx, customerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("inventory scan failed: %w", err)
+	}
+
+	report := &DriftReport{
+		CheckedAt: time.Now(),
+		Added:     []DriftResource{},
+		Removed:   []DriftResource{},
+		Changed:   []DriftResource{},
+		Snapshot:  make([]DriftResource, 0, len(inventory.Resources)),
+	}
+	for _, item := range inventory.Resources {
+		report.Snapshot = append(report.Snapshot, DriftResource{
+			ResourceType: item.ResourceType,
+			ResourceID:   item.ResourceID,
+			ResourceName: item.ResourceName,
+			StateID:      item.ConfigurationStateId,
+		})
+	}
+
+	var previous DriftReport
+	previousJob, err := jobs.Default().LatestResult(ctx, JobTypeDriftCheck, job.TenantID, &previous)
+	if errors.Is(err, jobs.ErrNotFound) {
+		// First run establishes the baseline
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.BaselineAt = previousJob.FinishedAt
+	report.Added, report.Removed, report.Changed = diffResources(previous.Snapshot, report.Snapshot)
+	return report, nil
+}
+
+// runSteampipeBenchmarkJob runs the benchmark named in the job payload
+func runSteampipeBenchmarkJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	benchmark, _ := job.Payload["benchmark"].(string)
+	if benchmark == "" {
+		return nil, jobs.Permanent(fmt.Errorf("payload.benchmark is required"))
+	}
+	connection, _ := job.Payload["connection"].(string)
+
+	return steampipe.RunBenchmark(ctx, benchmark, connection)
+}
+
+// runReportEmailJob emails a summary of the latest inventory scan to the payload recipients,
+// or to the tenant's email notification channels when the payload names none
+func runReportEmailJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	recipients := stringList(job.Payload["recipients"])
+	if len(recipients) == 0 && accountconfig.Default() != nil {
+		state, err := accountconfig.Default().Get(ctx, job.TenantID)
+		if err != nil && !errors.Is(err, accountconfig.ErrNotFound) {
+			return nil, err
+		}
+		if state != nil {
+			recipients = state.Spec.EmailRecipients()
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, jobs.Permanent(fmt.Errorf("payload.recipients is required when no email notification channel is configured"))
+	}
+
+	var inventory ResourceInventory
+	scanJob, err := jobs.Default().LatestResult(ctx, JobTypeInventoryScan, job.TenantID, &inventory)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, jobs.Permanent(fmt.Errorf("no completed inventory scan to report on"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subject := fmt.Sprintf("CloudLoom report for account %s", job.TenantID)
+	body := inventoryReportBody(&inventory, scanJob.FinishedAt)
+	if err := email.Send(email.ConfigFromEnv(), recipients, subject, body); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"recipients": recipients,
+		"scanJobId":  scanJob.ID.Hex(),
+		"sentAt":     time.Now(),
+	}, nil
+}
+
+// TenantExportOptions reads tenant export options from a job payload
+func TenantExportOptions(payload map[string]interface{}) tenantdata.ExportOptions {
+	opts := tenantdata.ExportOptions{Datasets: stringList(payload["datasets"])}
+	opts.Bucket, _ = payload["bucket"].(string)
+	opts.Prefix, _ = payload["prefix"].(string)
+	opts.Region, _ = payload["region"].(string)
+	opts.Format, _ = payload["format"].(string)
+	return opts
+}
+
+// runTenantExportJob exports the tenant's data to the bucket named in the payload using the customer role
+func runTenantExportJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	opts := TenantExportOptions(job.Payload)
+	if err := opts.Validate(); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, job.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	return tenantdata.Export(ctx, awsconfig.MongoDB, customerCfg, job.TenantID, opts)
+}
+
+// runRetentionJob enforces retention for the job's tenant, or for every tenant when the job has none.
+// Expired data is archived to RETENTION_ARCHIVE_BUCKET before it is deleted.
+func runRetentionJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	bucket := os.Getenv("RETENTION_ARCHIVE_BUCKET")
+	if bucket == "" {
+		return nil, jobs.Permanent(fmt.Errorf("RETENTION_ARCHIVE_BUCKET is not set; refusing to delete unarchived data"))
+	}
+	store := retention.Default()
+	if store == nil {
+		return nil, fmt.Errorf("retention policy store is not initialized")
+	}
+
+	tenants := []string{job.TenantID}
+	if job.TenantID == "" {
+		var err error
+		if tenants, err = tenantdata.Tenants(ctx, awsconfig.MongoDB); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	archived := []tenantdata.ArchiveResult{}
+	for _, tenantID := range tenants {
+		policy, err := store.Get(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range policy.Datasets() {
+			cutoff, expires := policy.Cutoff(name, now)
+			dataset, ok := tenantdata.Lookup([]string{name})
+			if !expires || !ok {
+				continue
+			}
+			result, err := tenantdata.ArchiveOlderThan(ctx, awsconfig.MongoDB, awsconfig.AWSConfig, bucket, tenantID, dataset[0], cutoff)
+			if err != nil {
+				return nil, err
+			}
+			if result != nil {
+				archived = append(archived, *result)
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"bucket":   bucket,
+		"tenants":  len(tenants),
+		"archived": archived,
+	}, nil
+}
+
+// StartRetentionSchedule enqueues a retention job for all tenants every interval until ctx is cancelled
+func StartRetentionSchedule(ctx context.Context, m *jobs.Manager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.Enqueue(ctx, JobTypeRetention, "", nil); err != nil {
+				log.Printf("[Retention] Warning: %v", err)
+			}
+		}
+	}
+}
+
+// inventoryReportBody renders the plain-text summary used by report emails
+func inventoryReportBody(inventory *ResourceInventory, scannedAt *time.Time) string {
+	summary := inventory.ResourceSummary
+	var b strings.Builder
+
+	b.WriteString("CloudLoom infrastructure report\n\n")
+	if scannedAt != nil {
+		fmt.Fprintf(&b, "Scanned at: %s\n", scannedAt.Format(time.RFC1123))
+	}
+	fmt.Fprintf(&b, "Total resources: %d\n", summary.TotalResources)
+	fmt.Fprintf(&b, "IAM policies: %d\n", summary.PolicyCount)
+	fmt.Fprintf(&b, "Config rules: %d\n", summary.ConfigRulesCount)
+
+	writeCounts(&b, "Compliance", summary.ComplianceStatus)
+	writeCounts(&b, "Resources by type", summary.ResourcesByType)
+	writeCounts(&b, "Resources by region", summary.ResourcesByRegion)
+	return b.String()
+}
+
+func writeCounts(b *strings.Builder, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "\n%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(b, "  %s: %d\n", k, counts[k])
+	}
+}
+
+// stringList reads a payload value that may be a string, a JSON array or a BSON array
+func stringList(value interface{}) []string {
+	var items []interface{}
+	switch v := value.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		items = v
+	case primitive.A:
+		items = v
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,703 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionJobs
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// AttemptError records why a single attempt of a job failed
+type AttemptError struct {
+	Attempt int       `bson:"attempt" json:"attempt"`
+	Error   string    `bson:"error" json:"error"`
+	At      time.Time `bson:"at" json:"at"`
+}
+
+// Job is a unit of background work and its status/result record
+type Job struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Type       string                 `bson:"type" json:"type"`
+	TenantID   string                 `bson:"tenantId,omitempty" json:"tenantId,omitempty"`
+	Status     Status                 `bson:"status" json:"status"`
+	Payload    map[string]interface{} `bson:"payload,omitempty" json:"payload,omitempty"`
+	Result     interface{}            `bson:"result,omitempty" json:"result,omitempty"`
+	Error      string                 `bson:"error,omitempty" json:"error,omitempty"`
+	Attempts   int                    `bson:"attempts" json:"attempts"`
+	WorkerID   string                 `bson:"workerId,omitempty" json:"workerId,omitempty"`
+	CreatedAt  time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time              `bson:"updatedAt" json:"updatedAt"`
+	StartedAt  *time.Time             `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	FinishedAt *time.Time             `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+
+	// Steps is the progress of a multi-step job, for jobs that report it
+	Steps []Step `bson:"steps,omitempty" json:"steps,omitempty"`
+
+	// Retry bookkeeping
+	MaxAttempts    int            `bson:"maxAttempts" json:"maxAttempts"`
+	NextRunAt      time.Time      `bson:"nextRunAt" json:"nextRunAt"`
+	ErrorHistory   []AttemptError `bson:"errorHistory,omitempty" json:"errorHistory,omitempty"`
+	DeadLettered   bool           `bson:"deadLettered,omitempty" json:"deadLettered,omitempty"`
+	DeadLetteredAt *time.Time     `bson:"deadLetteredAt,omitempty" json:"deadLetteredAt,omitempty"`
+
+	// ExpireAt is when the finished job is removed by the jobs TTL index
+	ExpireAt *time.Time `bson:"expireAt,omitempty" json:"expireAt,omitempty"`
+}
+
+// HandlerFunc executes a job and returns the result to store on the job record
+type HandlerFunc func(ctx context.Context, job *Job) (interface{}, error)
+
+// ListFilter narrows the jobs returned by List
+type ListFilter struct {
+	Type         string
+	TenantID     string
+	Status       Status
+	DeadLettered *bool
+	// CreatedBefore, if set, only matches jobs created before it
+	CreatedBefore time.Time
+	Limit         int64
+}
+
+var (
+	// ErrNotFound is returned when a job ID does not exist
+	ErrNotFound = errors.New("job not found")
+	// ErrNotRetryable is returned when re-running a job that has not failed
+	ErrNotRetryable = errors.New("only failed jobs can be re-run")
+	// ErrNotClaimed is returned when completing a job that is not running under the caller
+	ErrNotClaimed = errors.New("job is not running under this worker")
+)
+
+// Manager stores jobs in MongoDB and runs them on a pool of worker goroutines
+type Manager struct {
+	collection   *mongo.Collection
+	workers      int
+	pollInterval time.Duration
+	staleAfter   time.Duration
+	instanceID   string
+	wake         chan struct{}
+
+	mu           sync.RWMutex
+	handlers     map[string]HandlerFunc
+	policies     map[string]RetryPolicy
+	successHooks []func(ctx context.Context, job *Job)
+	retention    map[string]time.Duration
+	remote       map[string]bool
+}
+
+var defaultManager *Manager
+
+// Init creates the process-wide job manager backed by the given database
+func Init(db *mongo.Database, workers int) *Manager {
+	defaultManager = NewManager(db, workers)
+	return defaultManager
+}
+
+// Default returns the process-wide job manager created by Init
+func Default() *Manager {
+	return defaultManager
+}
+
+// NewManager creates a Manager using the jobs collection
+func NewManager(db *mongo.Database, workers int) *Manager {
+	if workers <= 0 {
+		workers = 1
+	}
+	hostname, _ := os.Hostname()
+	return &Manager{
+		collection:   db.Collection(collectionName),
+		workers:      workers,
+		pollInterval: 5 * time.Second,
+		staleAfter:   30 * time.Minute,
+		instanceID:   fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		wake:         make(chan struct{}, 1),
+		handlers:     make(map[string]HandlerFunc),
+		policies:     make(map[string]RetryPolicy),
+		retention:    make(map[string]time.Duration),
+		remote:       make(map[string]bool),
+	}
+}
+
+// Register associates a job type with the function that executes it, using DefaultRetryPolicy
+func (m *Manager) Register(jobType string, handler HandlerFunc) {
+	m.RegisterWithPolicy(jobType, handler, DefaultRetryPolicy)
+}
+
+// RegisterWithPolicy associates a job type with its handler and retry policy
+func (m *Manager) RegisterWithPolicy(jobType string, handler HandlerFunc, policy RetryPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[jobType] = handler
+	m.policies[jobType] = policy
+	log.Printf("[Jobs] Registered handler for job type '%s' (max %d attempts)", jobType, policy.MaxAttempts)
+}
+
+// Policy returns the retry policy for a job type
+func (m *Manager) Policy(jobType string) RetryPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if policy, ok := m.policies[jobType]; ok {
+		return policy
+	}
+	return DefaultRetryPolicy
+}
+
+// Policies returns the retry policy of every registered job type
+func (m *Manager) Policies() map[string]RetryPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	policies := make(map[string]RetryPolicy, len(m.handlers))
+	for jobType := range m.handlers {
+		policies[jobType] = m.policies[jobType]
+	}
+	return policies
+}
+
+// SetPolicy changes the retry policy of a registered job type. Jobs that are
+// already queued keep the attempt limit they were created with.
+func (m *Manager) SetPolicy(jobType string, policy RetryPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.handlers[jobType]; !ok {
+		return fmt.Errorf("no handler registered for job type '%s'", jobType)
+	}
+	m.policies[jobType] = policy
+	return nil
+}
+
+func (m *Manager) handler(jobType string) (HandlerFunc, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	handler, ok := m.handlers[jobType]
+	return handler, ok
+}
+
+// OnSuccess registers a callback invoked after a job's successful result is stored,
+// e.g. to invalidate caches derived from the previous result
+func (m *Manager) OnSuccess(hook func(ctx context.Context, job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.successHooks = append(m.successHooks, hook)
+}
+
+// HasHandler reports whether a local handler or remote executor is registered for the job type
+func (m *Manager) HasHandler(jobType string) bool {
+	if _, ok := m.handler(jobType); ok {
+		return true
+	}
+	return m.isRemote(jobType)
+}
+
+func (m *Manager) registeredTypes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	types := make([]string, 0, len(m.handlers))
+	for jobType := range m.handlers {
+		types = append(types, jobType)
+	}
+	return types
+}
+
+// Enqueue stores a new queued job and wakes an idle worker
+func (m *Manager) Enqueue(ctx context.Context, jobType, tenantID string, payload map[string]interface{}) (*Job, error) {
+	return m.EnqueueAt(ctx, jobType, tenantID, payload, time.Now())
+}
+
+// EnqueueAt stores a new queued job that no worker picks up before runAt
+func (m *Manager) EnqueueAt(ctx context.Context, jobType, tenantID string, payload map[string]interface{}, runAt time.Time) (*Job, error) {
+	if !m.HasHandler(jobType) {
+		return nil, fmt.Errorf("no handler registered for job type '%s'", jobType)
+	}
+
+	now := time.Now()
+	job := &Job{
+		Type:        jobType,
+		TenantID:    tenantID,
+		Status:      StatusQueued,
+		Payload:     payload,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		MaxAttempts: m.Policy(jobType).MaxAttempts,
+		NextRunAt:   runAt,
+	}
+
+	result, err := m.collection.InsertOne(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job: %w", jobType, err)
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+	log.Printf("[Jobs] Enqueued %s job %s", jobType, job.ID.Hex())
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a single job by its hex ID
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var job Job
+	err = m.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// IsActive reports whether a job is still queued or running
+func (m *Manager) IsActive(ctx context.Context, id string) (bool, error) {
+	job, err := m.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return job.Status == StatusQueued || job.Status == StatusRunning, nil
+}
+
+// Latest returns the most recent successful job of the given type for a tenant,
+// without its result. Its ID identifies the snapshot that job produced.
+func (m *Manager) Latest(ctx context.Context, jobType, tenantID string) (*Job, error) {
+	filter := bson.M{"type": jobType, "status": StatusSucceeded}
+	if tenantID != "" {
+		filter["tenantId"] = tenantID
+	}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "finishedAt", Value: -1}}).
+		SetProjection(bson.M{"result": 0})
+
+	var job Job
+	err := m.collection.FindOne(ctx, filter, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load latest %s job: %w", jobType, err)
+	}
+	return &job, nil
+}
+
+// DecodeResult decodes the stored result of a job into out
+func (m *Manager) DecodeResult(ctx context.Context, id string, out interface{}) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"result": 1})
+	raw, err := m.collection.FindOne(ctx, bson.M{"_id": oid}, opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load job %s: %w", id, err)
+	}
+	resultValue, err := raw.LookupErr("result")
+	if err != nil {
+		return fmt.Errorf("job %s has no result", id)
+	}
+	if err := resultValue.Unmarshal(out); err != nil {
+		return fmt.Errorf("failed to decode result of job %s: %w", id, err)
+	}
+	return nil
+}
+
+// ResultItems returns a cursor over the elements of an array inside a job's result
+// (e.g. "resources" of an inventory scan), so large results can be streamed page by page.
+// When fields is not empty, each element is projected down to those (dotted) paths.
+func (m *Manager) ResultItems(ctx context.Context, id, field string, skip, limit int64, fields []string) (*mongo.Cursor, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	path := "$result." + field
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": oid}}},
+		{{Key: "$unwind", Value: path}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": path}}},
+		{{Key: "$skip", Value: skip}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for _, f := range fields {
+			projection[f] = 1
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s of job %s: %w", field, id, err)
+	}
+	return cursor, nil
+}
+
+// LatestResult decodes the result of the most recent successful job of the
+// given type for a tenant into out. It returns ErrNotFound if there is none.
+func (m *Manager) LatestResult(ctx context.Context, jobType, tenantID string, out interface{}) (*Job, error) {
+	filter := bson.M{"type": jobType, "status": StatusSucceeded}
+	if tenantID != "" {
+		filter["tenantId"] = tenantID
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "finishedAt", Value: -1}})
+
+	raw, err := m.collection.FindOne(ctx, filter, opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load latest %s job: %w", jobType, err)
+	}
+
+	var job Job
+	if err := bson.Unmarshal(raw, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode %s job: %w", jobType, err)
+	}
+	if resultValue, err := raw.LookupErr("result"); err == nil && out != nil {
+		if err := resultValue.Unmarshal(out); err != nil {
+			return nil, fmt.Errorf("failed to decode %s job result: %w", jobType, err)
+		}
+	}
+	return &job, nil
+}
+
+// List returns the most recent jobs matching the filter. Results are omitted
+// to keep list responses small; fetch a single job to see its result.
+func (m *Manager) List(ctx context.Context, filter ListFilter) ([]Job, error) {
+	query := bson.M{}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.TenantID != "" {
+		query["tenantId"] = filter.TenantID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.DeadLettered != nil {
+		if *filter.DeadLettered {
+			query["deadLettered"] = true
+		} else {
+			query["deadLettered"] = bson.M{"$ne": true}
+		}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query["createdAt"] = bson.M{"$lt": filter.CreatedBefore}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"result": 0})
+
+	cursor, err := m.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Start requeues jobs orphaned by a previous process and runs the worker pool until ctx is cancelled
+func (m *Manager) Start(ctx context.Context) {
+	m.requeueStale(ctx)
+
+	log.Printf("[Jobs] Starting %d workers (instance %s)", m.workers, m.instanceID)
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			m.work(ctx, fmt.Sprintf("%s-%d", m.instanceID, n))
+		}(i)
+	}
+	wg.Wait()
+	log.Println("[Jobs] All workers stopped")
+}
+
+func (m *Manager) work(ctx context.Context, workerID string) {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is ready before going back to sleep
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			job, err := m.claim(ctx, workerID)
+			if err != nil {
+				log.Printf("[Jobs] Warning: failed to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			m.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Retry re-queues a failed (or dead-lettered) job with a fresh attempt budget
+func (m *Manager) Retry(ctx context.Context, id string) (*Job, error) {
+	job, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusFailed {
+		return nil, ErrNotRetryable
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":      StatusQueued,
+			"attempts":    0,
+			"maxAttempts": m.Policy(job.Type).MaxAttempts,
+			"nextRunAt":   now,
+			"updatedAt":   now,
+		},
+		"$unset": bson.M{
+			"deadLettered":   "",
+			"deadLetteredAt": "",
+			"finishedAt":     "",
+			"workerId":       "",
+		},
+	}
+	// Guard on status so two operators re-running the same job only queue it once
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": job.ID, "status": StatusFailed}, update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-queue job %s: %w", id, err)
+	}
+	if result.ModifiedCount == 0 {
+		return nil, ErrNotRetryable
+	}
+	log.Printf("[Jobs] Re-queued failed %s job %s", job.Type, job.ID.Hex())
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return m.Get(ctx, id)
+}
+
+// claim atomically moves the oldest queued job of a registered type to running
+func (m *Manager) claim(ctx context.Context, workerID string) (*Job, error) {
+	return m.claimOf(ctx, workerID, "", m.registeredTypes())
+}
+
+// claimOf atomically moves the oldest queued job of one of the given types to running,
+// limited to the tenant's jobs when tenantID is set
+func (m *Manager) claimOf(ctx context.Context, workerID, tenantID string, types []string) (*Job, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"status": StatusQueued,
+		"type":   bson.M{"$in": types},
+		"$or": bson.A{
+			bson.M{"nextRunAt": bson.M{"$lte": now}},
+			bson.M{"nextRunAt": bson.M{"$exists": false}},
+		},
+	}
+	if tenantID != "" {
+		filter["tenantId"] = tenantID
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    StatusRunning,
+			"workerId":  workerID,
+			"startedAt": now,
+			"updatedAt": now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextRunAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job Job
+	err := m.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run executes a claimed job and records its outcome
+func (m *Manager) run(ctx context.Context, job *Job) {
+	handler, ok := m.handler(job.Type)
+	if !ok {
+		m.finish(ctx, job, nil, fmt.Errorf("no handler registered for job type '%s'", job.Type))
+		return
+	}
+
+	log.Printf("[Jobs] ▶️ Running %s job %s (attempt %d)", job.Type, job.ID.Hex(), job.Attempts)
+	start := time.Now()
+
+	result, err := func() (result interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+				log.Printf("[Jobs] ❌ %s job %s panicked: %v\n%s", job.Type, job.ID.Hex(), r, debug.Stack())
+			}
+		}()
+		return handler(ctx, job)
+	}()
+
+	if err != nil {
+		log.Printf("[Jobs] ❌ %s job %s failed after %s: %v", job.Type, job.ID.Hex(), time.Since(start), err)
+	} else {
+		log.Printf("[Jobs] ✅ %s job %s succeeded in %s", job.Type, job.ID.Hex(), time.Since(start))
+	}
+	m.finish(ctx, job, result, err)
+}
+
+func (m *Manager) finish(ctx context.Context, job *Job, result interface{}, jobErr error) {
+	now := time.Now()
+	update := bson.M{}
+	set := bson.M{"updatedAt": now}
+
+	switch {
+	case jobErr == nil:
+		set["status"] = StatusSucceeded
+		set["result"] = result
+		set["finishedAt"] = now
+		update["$unset"] = bson.M{"error": ""}
+
+	case !IsPermanent(jobErr) && job.Attempts < m.maxAttempts(job):
+		backoff := m.Policy(job.Type).Backoff(job.Attempts)
+		set["status"] = StatusQueued
+		set["error"] = jobErr.Error()
+		set["nextRunAt"] = now.Add(backoff)
+		log.Printf("[Jobs] 🔁 %s job %s will retry in %s (attempt %d of %d)", job.Type, job.ID.Hex(), backoff, job.Attempts, m.maxAttempts(job))
+
+	default:
+		set["status"] = StatusFailed
+		set["error"] = jobErr.Error()
+		set["finishedAt"] = now
+		set["deadLettered"] = true
+		set["deadLetteredAt"] = now
+		log.Printf("[Jobs] ☠️ %s job %s dead-lettered after %d attempts", job.Type, job.ID.Hex(), job.Attempts)
+	}
+
+	if _, finished := set["finishedAt"]; finished {
+		if retention := m.Retention(job.Type); retention > 0 {
+			set["expireAt"] = now.Add(retention)
+		}
+	}
+
+	update["$set"] = set
+	if jobErr != nil {
+		update["$push"] = bson.M{"errorHistory": AttemptError{Attempt: job.Attempts, Error: jobErr.Error(), At: now}}
+	}
+
+	// Record the outcome even if the server context is shutting down
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if _, err := m.collection.UpdateByID(writeCtx, job.ID, update); err != nil {
+		log.Printf("[Jobs] Warning: failed to record outcome of job %s: %v", job.ID.Hex(), err)
+		return
+	}
+
+	if jobErr == nil {
+		m.runSuccessHooks(writeCtx, job)
+	}
+}
+
+func (m *Manager) runSuccessHooks(ctx context.Context, job *Job) {
+	m.mu.RLock()
+	hooks := m.successHooks
+	m.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, job)
+	}
+}
+
+// maxAttempts returns the attempt limit stored on the job, falling back to the type's policy
+func (m *Manager) maxAttempts(job *Job) int {
+	if job.MaxAttempts > 0 {
+		return job.MaxAttempts
+	}
+	return m.Policy(job.Type).MaxAttempts
+}
+
+// requeueStale puts running jobs whose worker stopped updating them back in the queue
+func (m *Manager) requeueStale(ctx context.Context) {
+	result, err := m.collection.UpdateMany(ctx,
+		bson.M{
+			"status":    StatusRunning,
+			"updatedAt": bson.M{"$lt": time.Now().Add(-m.staleAfter)},
+		},
+		bson.M{"$set": bson.M{"status": StatusQueued, "nextRunAt": time.Now(), "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("[Jobs] Warning: failed to requeue stale jobs: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("[Jobs] Requeued %d stale running jobs", result.ModifiedCount)
+	}
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RegisterRemote marks a job type as executed outside the API process. Jobs of the type are
+// queued as usual but only handed out through ClaimRemote, e.g. to self-hosted agents.
+func (m *Manager) RegisterRemote(jobType string, policy RetryPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remote[jobType] = true
+	m.policies[jobType] = policy
+	log.Printf("[Jobs] Registered remote job type '%s' (max %d attempts)", jobType, policy.MaxAttempts)
+}
+
+func (m *Manager) isRemote(jobType string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.remote[jobType]
+}
+
+// ClaimRemote moves the tenant's oldest ready job of the requested remote types to running
+// under workerID. It returns nil when no job is ready.
+func (m *Manager) ClaimRemote(ctx context.Context, tenantID, workerID string, jobTypes []string) (*Job, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID is required to claim remote jobs")
+	}
+
+	types := make([]string, 0, len(jobTypes))
+	for _, jobType := range jobTypes {
+		if m.isRemote(jobType) {
+			types = append(types, jobType)
+		}
+	}
+
+	job, err := m.claimOf(ctx, workerID, tenantID, types)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim remote job: %w", err)
+	}
+	if job != nil {
+		log.Printf("[Jobs] ▶️ %s job %s claimed by remote worker %s (attempt %d)", job.Type, job.ID.Hex(), workerID, job.Attempts)
+	}
+	return job, nil
+}
+
+// CompleteRemote records the outcome of a job the tenant's worker claimed with ClaimRemote,
+// applying the same retry and dead-letter rules as local jobs. Other tenants' jobs are
+// reported as not found.
+func (m *Manager) CompleteRemote(ctx context.Context, tenantID, id, workerID string, result interface{}, jobErr error) error {
+	job, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.TenantID != tenantID {
+		return ErrNotFound
+	}
+	if job.Status != StatusRunning || job.WorkerID != workerID {
+		return ErrNotClaimed
+	}
+
+	if jobErr != nil {
+		log.Printf("[Jobs] ❌ %s job %s failed on remote worker %s: %v", job.Type, job.ID.Hex(), workerID, jobErr)
+	} else {
+		log.Printf("[Jobs] ✅ %s job %s succeeded on remote worker %s", job.Type, job.ID.Hex(), workerID)
+	}
+	m.finish(ctx, job, result, jobErr)
+	return nil
+}
+
+// RecordResult stores a result produced outside the job queue as a succeeded job, so it is
+// served like any other snapshot of the type
+func (m *Manager) RecordResult(ctx context.Context, jobType, tenantID string, result interface{}) (*Job, error) {
+	now := time.Now()
+	job := &Job{
+		Type:       jobType,
+		TenantID:   tenantID,
+		Status:     StatusSucceeded,
+		Result:     result,
+		Attempts:   1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		StartedAt:  &now,
+		FinishedAt: &now,
+		NextRunAt:  now,
+	}
+	if retention := m.Retention(jobType); retention > 0 {
+		expireAt := now.Add(retention)
+		job.ExpireAt = &expireAt
+	}
+
+	inserted, err := m.collection.InsertOne(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s result: %w", jobType, err)
+	}
+	job.ID = inserted.InsertedID.(primitive.ObjectID)
+	log.Printf("[Jobs] ✅ Recorded %s result %s", jobType, job.ID.Hex())
+
+	m.runSuccessHooks(ctx, job)
+	return job, nil
+}
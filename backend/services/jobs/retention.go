@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	// Finished job records expire once expireAt passes (set per job type)
+	config.RegisterIndexes(collectionName,
+		mongo.IndexModel{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetName("expireAt_ttl").SetExpireAfterSeconds(0)},
+	)
+}
+
+// DefaultRetention is how long finished jobs are kept unless overridden per type.
+// Override with JOB_RETENTION_DAYS.
+var DefaultRetention = retentionFromEnv()
+
+func retentionFromEnv() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("JOB_RETENTION_DAYS")); err == nil && v > 0 {
+		return time.Duration(v) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// SetRetention overrides how long finished jobs of a type are kept. A zero duration keeps them indefinitely.
+func (m *Manager) SetRetention(jobType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retention[jobType] = d
+}
+
+// Retention returns how long finished jobs of a type are kept
+func (m *Manager) Retention(jobType string) time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if d, ok := m.retention[jobType]; ok {
+		return d
+	}
+	return DefaultRetention
+}
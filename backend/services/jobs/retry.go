@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how often and how quickly a failed job is retried
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"maxAttempts"`
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff"`
+	Multiplier     float64       `json:"multiplier"`
+}
+
+// DefaultRetryPolicy is used for job types registered without an explicit policy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     10 * time.Minute,
+	Multiplier:     2,
+}
+
+// NoRetry runs a job exactly once
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// Backoff returns the delay before the given retry attempt (1-based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && time.Duration(delay) >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(delay)
+}
+
+// Validate checks that a policy is usable
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return errors.New("maxAttempts must be at least 1")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff durations must not be negative")
+	}
+	if p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		return errors.New("initialBackoff must not exceed maxBackoff")
+	}
+	return nil
+}
+
+// permanentError marks a job failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead-lettered immediately instead of retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StepStatus is the state of one step of a multi-step job
+type StepStatus string
+
+const (
+	StepPending   StepStatus = "pending"
+	StepRunning   StepStatus = "running"
+	StepSucceeded StepStatus = "succeeded"
+	StepFailed    StepStatus = "failed"
+	StepSkipped   StepStatus = "skipped"
+)
+
+// Step is the progress of one named step of a job
+type Step struct {
+	Name       string     `bson:"name" json:"name"`
+	Status     StepStatus `bson:"status" json:"status"`
+	Detail     string     `bson:"detail,omitempty" json:"detail,omitempty"`
+	StartedAt  *time.Time `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	FinishedAt *time.Time `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+}
+
+// SetSteps replaces the step progress recorded on a running job so clients polling the job
+// can show it. Only the job's own handler should call it.
+func (m *Manager) SetSteps(ctx context.Context, id primitive.ObjectID, steps []Step) error {
+	_, err := m.collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"steps": steps, "updatedAt": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to record progress of job %s: %w", id.Hex(), err)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/keyrotation"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+)
+
+// JobTypeKeyDeactivation deactivates a rotated access key once its grace period has ended
+const JobTypeKeyDeactivation = "access_key_deactivation"
+
+// DefaultKeyRotationGracePeriod is how long the old key keeps working after rotation
+const DefaultKeyRotationGracePeriod = 7 * 24 * time.Hour
+
+// KeyRotationRequest starts the access key rotation playbook for one IAM user
+type KeyRotationRequest struct {
+	UserName string
+	// AccessKeyID is the flagged key; it may be left out when the user has only one key
+	AccessKeyID string
+	// FindingID is resolved when the rotation completes
+	FindingID string
+	// StoreInSecretsManager keeps the new key in the customer's Secrets Manager instead
+	// of returning it to the caller
+	StoreInSecretsManager bool
+	GracePeriod           time.Duration
+	RequestedBy           string
+	// Approved is set for a rotation someone approved as a remediation, which may run on a
+	// tier that only suggests fixes
+	Approved bool
+}
+
+// ErrFixesNotAllowed is returned when a remediation is started for an account whose access
+// tier does not let CloudLoom change it
+var ErrFixesNotAllowed = errors.New("the account's access tier does not allow CloudLoom to apply fixes")
+
+// NewAccessKey is the new key's secret, returned once when it is not stored in Secrets Manager
+type NewAccessKey struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+}
+
+// StartKeyRotation creates a new access key for the user, optionally stores it in the
+// customer's Secrets Manager, and schedules the old key's deactivation after the grace period.
+// The new key's secret is returned only when it was not stored.
+func StartKeyRotation(ctx context.Context, tenantID string, req KeyRotationRequest) (*keyrotation.Rotation, *NewAccessKey, error) {
+	store := keyrotation.Default()
+	if store == nil || jobs.Default() == nil {
+		return nil, nil, fmt.Errorf("access key rotation is not available: rotation store or job manager is not initialized")
+	}
+	if req.UserName == "" {
+		return nil, nil, fmt.Errorf("%w: userName is required", keyrotation.ErrInvalid)
+	}
+	if req.GracePeriod == 0 {
+		req.GracePeriod = DefaultKeyRotationGracePeriod
+	}
+	if req.GracePeriod < 0 || req.GracePeriod > keyrotation.MaxGracePeriod {
+		return nil, nil, fmt.Errorf("%w: grace period must be at most %s", keyrotation.ErrInvalid, keyrotation.MaxGracePeriod)
+	}
+
+	active, err := store.HasActive(ctx, tenantID, req.UserName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if active {
+		return nil, nil, fmt.Errorf("%w: %s already has a rotation in progress", keyrotation.ErrConflict, req.UserName)
+	}
+
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tier := service.tier(); !tier.AppliesFixes() && !(req.Approved && tier.Analyzes()) {
+		return nil, nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	customerCfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	if err := SimulateRolePermissions(ctx, customerCfg, service.roleArn(), keyRotationPermissions(tenantID, customerCfg.Region, req)); err != nil {
+		return nil, nil, err
+	}
+
+	client := iam.NewFromConfig(customerCfg)
+	oldKeyID, err := keyToRotate(ctx, client, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created, err := client.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{UserName: aws.String(req.UserName)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create access key for %s: %w", req.UserName, err)
+	}
+	newKey := &NewAccessKey{
+		AccessKeyID:     aws.ToString(created.AccessKey.AccessKeyId),
+		SecretAccessKey: aws.ToString(created.AccessKey.SecretAccessKey),
+	}
+	log.Printf("[KeyRotation] ✅ Created access key %s for %s", newKey.AccessKeyID, req.UserName)
+
+	rotation := &keyrotation.Rotation{
+		TenantID:       tenantID,
+		UserName:       req.UserName,
+		FindingID:      req.FindingID,
+		OldAccessKeyID: oldKeyID,
+		NewAccessKeyID: newKey.AccessKeyID,
+		Status:         keyrotation.StatusNewKeyCreated,
+		RequestedBy:    req.RequestedBy,
+		DeactivateAt:   time.Now().Add(req.GracePeriod),
+	}
+
+	if req.StoreInSecretsManager {
+		rotation.SecretName = "access-keys/" + req.UserName
+		value, _ := json.Marshal(newKey)
+		if err := secrets.NewAWS(customerCfg, "").Put(ctx, rotation.SecretName, value); err != nil {
+			// Without the secret stored the caller has no way to read the new key, so undo it
+			client.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{UserName: aws.String(req.UserName), AccessKeyId: created.AccessKey.AccessKeyId})
+			return nil, nil, fmt.Errorf("failed to store new access key in Secrets Manager: %w", err)
+		}
+		newKey = nil
+	}
+
+	if err := store.Create(ctx, rotation); err != nil {
+		return nil, nil, err
+	}
+	if _, err := jobs.Default().EnqueueAt(ctx, JobTypeKeyDeactivation, tenantID, map[string]interface{}{
+		"rotationId": rotation.ID.Hex(),
+	}, rotation.DeactivateAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to schedule old key deactivation: %w", err)
+	}
+
+	log.Printf("[KeyRotation] ✅ Old key %s of %s will be deactivated at %s", oldKeyID, req.UserName, rotation.DeactivateAt.Format(time.RFC3339))
+	return rotation, newKey, nil
+}
+
+// ConfirmKeyRotation deletes the old key of a rotation whose grace period has passed and
+// resolves the finding that triggered it
+func ConfirmKeyRotation(ctx context.Context, tenantID, id, userID string) (*keyrotation.Rotation, error) {
+	store := keyrotation.Default()
+	if store == nil {
+		return nil, fmt.Errorf("access key rotation store is not initialized")
+	}
+	rotation, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if rotation.Status != keyrotation.StatusOldKeyDeactivated {
+		return nil, fmt.Errorf("%w: the old key can only be deleted after it has been deactivated (status is %s)",
+			keyrotation.ErrConflict, rotation.Status)
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	_, err = iam.NewFromConfig(customerCfg).DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+		UserName:    aws.String(rotation.UserName),
+		AccessKeyId: aws.String(rotation.OldAccessKeyID),
+	})
+	var missing *iamtypes.NoSuchEntityException
+	if err != nil && !errors.As(err, &missing) {
+		return nil, fmt.Errorf("failed to delete access key %s: %w", rotation.OldAccessKeyID, err)
+	}
+
+	now := time.Now()
+	rotation.Status = keyrotation.StatusCompleted
+	rotation.DeletedAt = &now
+	rotation.ConfirmedBy = userID
+	if err := store.Transition(ctx, rotation, keyrotation.StatusOldKeyDeactivated); err != nil {
+		return nil, err
+	}
+	log.Printf("[KeyRotation] ✅ Deleted old access key %s of %s", rotation.OldAccessKeyID, rotation.UserName)
+
+	if rotation.FindingID != "" && findings.Default() != nil {
+		if _, err := findings.Default().BulkUpdateStatus(ctx, tenantID, []string{rotation.FindingID}, findings.StatusUpdate{
+			Status: findings.StatusResolved,
+			Reason: "access key rotated",
+		}); err != nil {
+			log.Printf("[KeyRotation] Warning: failed to resolve finding %s: %v", rotation.FindingID, err)
+		}
+	}
+	return rotation, nil
+}
+
+// runKeyDeactivationJob deactivates the old key of a rotation once its grace period has ended
+func runKeyDeactivationJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	store := keyrotation.Default()
+	if store == nil {
+		return nil, fmt.Errorf("access key rotation store is not initialized")
+	}
+	id, _ := job.Payload["rotationId"].(string)
+	rotation, err := store.Get(ctx, job.TenantID, id)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	if rotation.Status != keyrotation.StatusNewKeyCreated {
+		return map[string]interface{}{"skipped": true, "status": rotation.Status}, nil
+	}
+
+	customerCfg, err := assumeTenantRole(ctx, job.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	_, err = iam.NewFromConfig(customerCfg).UpdateAccessKey(ctx, &iam.UpdateAccessKeyInput{
+		UserName:    aws.String(rotation.UserName),
+		AccessKeyId: aws.String(rotation.OldAccessKeyID),
+		Status:      iamtypes.StatusTypeInactive,
+	})
+	now := time.Now()
+	var missing *iamtypes.NoSuchEntityException
+	switch {
+	case errors.As(err, &missing):
+		// Someone already deleted the old key, so there is nothing left to confirm
+		rotation.Status = keyrotation.StatusCompleted
+		rotation.DeletedAt = &now
+	case err != nil:
+		return nil, fmt.Errorf("failed to deactivate access key %s: %w", rotation.OldAccessKeyID, err)
+	default:
+		rotation.Status = keyrotation.StatusOldKeyDeactivated
+		rotation.DeactivatedAt = &now
+	}
+	if err := store.Transition(ctx, rotation, keyrotation.StatusNewKeyCreated); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[KeyRotation] ✅ Old access key %s of %s is now %s", rotation.OldAccessKeyID, rotation.UserName, rotation.Status)
+	return rotation, nil
+}
+
+// keyToRotate returns the key the rotation replaces. IAM users hold at most two keys,
+// so the user must have exactly one for a new key to be created next to it.
+func keyToRotate(ctx context.Context, client *iam.Client, req KeyRotationRequest) (string, error) {
+	out, err := client.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: aws.String(req.UserName)})
+	if err != nil {
+		return "", fmt.Errorf("failed to list access keys of %s: %w", req.UserName, err)
+	}
+
+	switch len(out.AccessKeyMetadata) {
+	case 0:
+		return "", fmt.Errorf("%w: %s has no access key to rotate", keyrotation.ErrInvalid, req.UserName)
+	case 1:
+		keyID := aws.ToString(out.AccessKeyMetadata[0].AccessKeyId)
+		if req.AccessKeyID != "" && req.AccessKeyID != keyID {
+			return "", fmt.Errorf("%w: %s has no access key %s", keyrotation.ErrInvalid, req.UserName, req.AccessKeyID)
+		}
+		return keyID, nil
+	default:
+		return "", fmt.Errorf("%w: %s already has two access keys; delete the unused one before rotating",
+			keyrotation.ErrConflict, req.UserName)
+	}
+}
+
+// keyRotationPermissions lists what the rotation playbook does in the customer account
+func keyRotationPermissions(tenantID, region string, req KeyRotationRequest) []Permission {
+	userArn := fmt.Sprintf("arn:aws:iam::%s:user/%s", tenantID, req.UserName)
+	required := []Permission{
+		{Action: "iam:ListAccessKeys", Resource: userArn},
+		{Action: "iam:CreateAccessKey", Resource: userArn},
+		{Action: "iam:UpdateAccessKey", Resource: userArn},
+		{Action: "iam:DeleteAccessKey", Resource: userArn},
+	}
+	if req.StoreInSecretsManager {
+		secretArn := fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:cloudloom/access-keys/%s", region, tenantID, req.UserName)
+		required = append(required,
+			Permission{Action: "secretsmanager:CreateSecret", Resource: secretArn},
+			Permission{Action: "secretsmanager:PutSecretValue", Resource: secretArn},
+		)
+	}
+	return required
+}
@@ -0,0 +1,170 @@
+package keyrotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionKeyRotations
+
+var (
+	// ErrNotFound is returned when a rotation does not exist for the tenant
+	ErrNotFound = errors.New("access key rotation not found")
+	// ErrInvalid is returned when a rotation request names no user or a bad grace period
+	ErrInvalid = errors.New("invalid access key rotation")
+	// ErrConflict is returned when a rotation cannot move on from its current status
+	ErrConflict = errors.New("access key rotation is in the wrong state")
+)
+
+// Status is the stage a rotation has reached
+type Status string
+
+const (
+	// StatusNewKeyCreated means the new key exists and the old key is still active
+	StatusNewKeyCreated Status = "new_key_created"
+	// StatusOldKeyDeactivated means the grace period ended and the old key was disabled
+	StatusOldKeyDeactivated Status = "old_key_deactivated"
+	// StatusCompleted means the old key was deleted after confirmation
+	StatusCompleted Status = "completed"
+	// StatusFailed means a step failed; Error says which
+	StatusFailed Status = "failed"
+)
+
+// Active are the statuses of rotations that have not finished
+var Active = []Status{StatusNewKeyCreated, StatusOldKeyDeactivated}
+
+// MaxGracePeriod bounds how long an old key may stay active after rotation
+const MaxGracePeriod = 30 * 24 * time.Hour
+
+// Rotation replaces one IAM user's access key: a new key is created, the old key is
+// deactivated once the grace period ends and deleted when someone confirms nothing broke
+type Rotation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID       string             `bson:"tenantId" json:"tenantId"`
+	UserName       string             `bson:"userName" json:"userName"`
+	FindingID      string             `bson:"findingId,omitempty" json:"findingId,omitempty"`
+	OldAccessKeyID string             `bson:"oldAccessKeyId" json:"oldAccessKeyId"`
+	NewAccessKeyID string             `bson:"newAccessKeyId" json:"newAccessKeyId"`
+	// SecretName is the customer Secrets Manager secret (under the cloudloom/ prefix)
+	// holding the new key, if it was stored there
+	SecretName    string     `bson:"secretName,omitempty" json:"secretName,omitempty"`
+	Status        Status     `bson:"status" json:"status"`
+	Error         string     `bson:"error,omitempty" json:"error,omitempty"`
+	RequestedBy   string     `bson:"requestedBy,omitempty" json:"requestedBy,omitempty"`
+	ConfirmedBy   string     `bson:"confirmedBy,omitempty" json:"confirmedBy,omitempty"`
+	DeactivateAt  time.Time  `bson:"deactivateAt" json:"deactivateAt"`
+	DeactivatedAt *time.Time `bson:"deactivatedAt,omitempty" json:"deactivatedAt,omitempty"`
+	DeletedAt     *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	CreatedAt     time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Store persists access key rotations in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide rotation store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide rotation store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the access_key_rotations collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create saves a new rotation
+func (s *Store) Create(ctx context.Context, rotation *Rotation) error {
+	now := time.Now()
+	rotation.CreatedAt = now
+	rotation.UpdatedAt = now
+	res, err := s.collection.InsertOne(ctx, rotation)
+	if err != nil {
+		return fmt.Errorf("failed to create access key rotation: %w", err)
+	}
+	rotation.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Get returns one of the tenant's rotations
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Rotation, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var rotation Rotation
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&rotation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load access key rotation: %w", err)
+	}
+	return &rotation, nil
+}
+
+// List returns the tenant's rotations, newest first, optionally for one user
+func (s *Store) List(ctx context.Context, tenantID, userName string) ([]Rotation, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if userName != "" {
+		filter["userName"] = userName
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(200)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access key rotations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Rotation{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode access key rotations: %w", err)
+	}
+	return result, nil
+}
+
+// HasActive reports whether the user already has a rotation in progress
+func (s *Store) HasActive(ctx context.Context, tenantID, userName string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId": tenantID,
+		"userName": userName,
+		"status":   bson.M{"$in": Active},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check access key rotations: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Transition saves the rotation if it is still in the from status, so concurrent
+// workers cannot both act on it. It returns ErrConflict if the status has moved on.
+func (s *Store) Transition(ctx context.Context, rotation *Rotation, from Status) error {
+	rotation.UpdatedAt = time.Now()
+	res, err := s.collection.ReplaceOne(ctx, bson.M{"_id": rotation.ID, "status": from}, rotation)
+	if err != nil {
+		return fmt.Errorf("failed to save access key rotation: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
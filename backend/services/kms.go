@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// logKeyDeletionWindowDays is how long a key setup created stays recoverable after teardown
+const logKeyDeletionWindowDays = 7
+
+// logKeyStatementIDs are the Sids of the key policy statements setup manages
+var logKeyStatementIDs = map[string]bool{
+	"CloudLoomCloudTrailEncrypt":     true,
+	"CloudLoomCloudTrailDescribeKey": true,
+	"CloudLoomConfigEncrypt":         true,
+	"CloudLoomLogDecrypt":            true,
+}
+
+// logKeyAlias is the alias of the KMS key setup creates for an account's logs
+func logKeyAlias(accountID string) string {
+	return "alias/cloudloom-logs-" + accountID
+}
+
+// logKey returns the KMS key the tenant's logs are encrypted with: the ARN of the tenant's own
+// key, the alias of the key setup creates, or "" when logs use S3-managed encryption
+func (s *CloudTrailService) logKey(accountID string) string {
+	switch {
+	case s.tenant == nil:
+		return ""
+	case s.tenant.KMSKeyArn != "":
+		return s.tenant.KMSKeyArn
+	case s.tenant.CreateKMSKey:
+		return logKeyAlias(accountID)
+	}
+	return ""
+}
+
+// trailNamePattern matches the names CloudTrail accepts for a trail
+var trailNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{2,127}$`)
+
+// keyPolicyStatement is a statement of a KMS key policy. Action is a single action or a list.
+type keyPolicyStatement struct {
+	Sid       string                       `json:"Sid"`
+	Effect    string                       `json:"Effect"`
+	Principal map[string]string            `json:"Principal"`
+	Action    interface{}                  `json:"Action"`
+	Resource  string                       `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// logKeyStatements are the key policy statements that let CloudTrail encrypt the trail's logs,
+// AWS Config encrypt its snapshots and principals of the account decrypt them
+func logKeyStatements(accountID, region, trailName string) ([]interface{}, error) {
+	if !trailNamePattern.MatchString(trailName) {
+		return nil, fmt.Errorf("invalid trail name '%s': it must be 3-128 letters, digits, '.', '-' or '_'", trailName)
+	}
+	accountTrails := fmt.Sprintf("arn:aws:cloudtrail:*:%s:trail/*", accountID)
+	return []interface{}{
+		keyPolicyStatement{
+			Sid:       "CloudLoomCloudTrailEncrypt",
+			Effect:    "Allow",
+			Principal: map[string]string{"Service": "cloudtrail.amazonaws.com"},
+			Action:    "kms:GenerateDataKey*",
+			Resource:  "*",
+			Condition: map[string]map[string]string{
+				"StringEquals": {"aws:SourceArn": fmt.Sprintf("arn:aws:cloudtrail:%s:%s:trail/%s", region, accountID, trailName)},
+				"StringLike":   {"kms:EncryptionContext:aws:cloudtrail:arn": accountTrails},
+			},
+		},
+		keyPolicyStatement{
+			Sid:       "CloudLoomCloudTrailDescribeKey",
+			Effect:    "Allow",
+			Principal: map[string]string{"Service": "cloudtrail.amazonaws.com"},
+			Action:    "kms:DescribeKey",
+			Resource:  "*",
+		},
+		keyPolicyStatement{
+			Sid:       "CloudLoomConfigEncrypt",
+			Effect:    "Allow",
+			Principal: map[string]string{"Service": "config.amazonaws.com"},
+			Action:    []string{"kms:Decrypt", "kms:GenerateDataKey"},
+			Resource:  "*",
+			Condition: map[string]map[string]string{"StringEquals": {"AWS:SourceAccount": accountID}},
+		},
+		keyPolicyStatement{
+			Sid:       "CloudLoomLogDecrypt",
+			Effect:    "Allow",
+			Principal: map[string]string{"AWS": fmt.Sprintf("arn:aws:iam::%s:root", accountID)},
+			Action:    []string{"kms:Decrypt", "kms:ReEncryptFrom"},
+			Resource:  "*",
+			Condition: map[string]map[string]string{
+				"StringEquals": {"kms:CallerAccount": accountID},
+				"StringLike":   {"kms:EncryptionContext:aws:cloudtrail:arn": accountTrails},
+			},
+		},
+	}, nil
+}
+
+// ensureLogEncryptionKey returns the ARN of the key to encrypt logs with, creating the key
+// when keyID is setup's own alias and no key has it yet, and grants CloudTrail and AWS Config
+// use of it in its key policy. It returns "" when keyID is empty.
+func (s *CloudTrailService) ensureLogEncryptionKey(ctx context.Context, cfg aws.Config, accountID, keyID, trailName string) (string, error) {
+	if keyID == "" {
+		fmt.Printf("[KMS] No key requested, logs use S3-managed encryption\n")
+		return "", nil
+	}
+	client := kms.NewFromConfig(cfg)
+
+	fmt.Printf("[KMS] Checking key '%s'...\n", keyID)
+	key, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil && isNotFound(err) && strings.HasPrefix(keyID, "alias/") {
+		key, err = s.createLogKey(ctx, cfg, client, keyID, accountID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get KMS key %s: %w", keyID, err)
+	}
+
+	metadata := key.KeyMetadata
+	keyArn := aws.ToString(metadata.Arn)
+	if metadata.KeyState != kmstypes.KeyStateEnabled {
+		return "", fmt.Errorf("KMS key %s is %s, not enabled", keyArn, metadata.KeyState)
+	}
+	if metadata.KeyManager != kmstypes.KeyManagerTypeCustomer {
+		return "", fmt.Errorf("KMS key %s is AWS managed; CloudTrail needs a customer managed key", keyArn)
+	}
+	// CloudTrail only encrypts with keys in the region of the trail and its bucket
+	if parts := strings.Split(keyArn, ":"); len(parts) > 3 && parts[3] != cfg.Region {
+		return "", fmt.Errorf("KMS key %s is in %s, but must be in the home region %s", keyArn, parts[3], cfg.Region)
+	}
+
+	statements, err := logKeyStatements(accountID, cfg.Region, trailName)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("[KMS] Granting CloudTrail and AWS Config use of the key...\n")
+	if err := updateKeyPolicy(ctx, client, keyArn, statements); err != nil {
+		return "", err
+	}
+	fmt.Printf("[KMS] ✅ Logs will be encrypted with %s\n", keyArn)
+	return keyArn, nil
+}
+
+// createLogKey creates a customer managed key with rotation enabled under the given alias.
+// The key starts with the default key policy, which delegates access to IAM in the account.
+func (s *CloudTrailService) createLogKey(ctx context.Context, cfg aws.Config, client *kms.Client, alias, accountID string) (*kms.DescribeKeyOutput, error) {
+	fmt.Printf("[KMS] Creating key for CloudTrail and AWS Config logs...\n")
+	created, err := client.CreateKey(ctx, &kms.CreateKeyInput{
+		Description: aws.String("CloudLoom CloudTrail and AWS Config logs of account " + accountID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	keyID := created.KeyMetadata.KeyId
+
+	if _, err := client.CreateAlias(ctx, &kms.CreateAliasInput{AliasName: aws.String(alias), TargetKeyId: keyID}); err != nil {
+		return nil, fmt.Errorf("failed to create alias %s: %w", alias, err)
+	}
+	if _, err := client.EnableKeyRotation(ctx, &kms.EnableKeyRotationInput{KeyId: keyID}); err != nil {
+		log.Printf("[KMS] Warning: failed to enable rotation of %s: %v", aws.ToString(keyID), err)
+	}
+	s.tagManaged(ctx, cfg, aws.ToString(created.KeyMetadata.Arn))
+	fmt.Printf("[KMS] ✅ Key created: %s\n", aws.ToString(created.KeyMetadata.Arn))
+	return &kms.DescribeKeyOutput{KeyMetadata: created.KeyMetadata}, nil
+}
+
+// updateKeyPolicy replaces the CloudLoom statements in the key's policy with statements,
+// leaving the rest of the policy as the customer wrote it
+func updateKeyPolicy(ctx context.Context, client *kms.Client, keyID string, statements []interface{}) error {
+	current, err := client.GetKeyPolicy(ctx, &kms.GetKeyPolicyInput{KeyId: aws.String(keyID), PolicyName: aws.String("default")})
+	if err != nil {
+		return fmt.Errorf("failed to get key policy: %w", err)
+	}
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(aws.ToString(current.Policy)), &policy); err != nil {
+		return fmt.Errorf("failed to parse key policy: %w", err)
+	}
+
+	var existing []interface{}
+	switch statement := policy["Statement"].(type) {
+	case []interface{}:
+		existing = statement
+	case map[string]interface{}:
+		existing = []interface{}{statement}
+	}
+	kept := []interface{}{}
+	for _, statement := range existing {
+		if fields, ok := statement.(map[string]interface{}); ok {
+			if sid, _ := fields["Sid"].(string); logKeyStatementIDs[sid] {
+				continue
+			}
+		}
+		kept = append(kept, statement)
+	}
+	policy["Statement"] = append(kept, statements...)
+
+	updated, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode key policy: %w", err)
+	}
+	if sameJSON(aws.ToString(current.Policy), string(updated)) {
+		fmt.Printf("[KMS] Key policy already up to date\n")
+		return nil
+	}
+	_, err = client.PutKeyPolicy(ctx, &kms.PutKeyPolicyInput{
+		KeyId:      aws.String(keyID),
+		PolicyName: aws.String("default"),
+		Policy:     aws.String(string(updated)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update key policy: %w", err)
+	}
+	return nil
+}
+
+// removeLogKey schedules deletion of the key setup created, or takes the CloudLoom statements
+// out of the customer's own key. Either key is kept while logs encrypted with it are retained.
+func removeLogKey(ctx context.Context, cfg aws.Config, keyID string, retainLogs bool, report *TeardownReport) {
+	if retainLogs {
+		report.Resources = append(report.Resources, TeardownResource{Kind: "kms_key", Name: keyID, Action: TeardownRetained, Detail: "the retained logs are encrypted with it"})
+		return
+	}
+
+	client := kms.NewFromConfig(cfg)
+	if !strings.HasPrefix(keyID, "alias/") {
+		report.record("kms_key_policy", keyID, cfg.Region, updateKeyPolicy(ctx, client, keyID, nil))
+		return
+	}
+
+	// Delete the alias last, since it is how teardown finds the key again after a failure
+	key, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err == nil && key.KeyMetadata.KeyState != kmstypes.KeyStatePendingDeletion {
+		_, err = client.ScheduleKeyDeletion(ctx, &kms.ScheduleKeyDeletionInput{
+			KeyId:               key.KeyMetadata.KeyId,
+			PendingWindowInDays: aws.Int32(logKeyDeletionWindowDays),
+		})
+	}
+	if err == nil {
+		_, err = client.DeleteAlias(ctx, &kms.DeleteAliasInput{AliasName: aws.String(keyID)})
+	}
+	report.record("kms_key", keyID, cfg.Region, err)
+}
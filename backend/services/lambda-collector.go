@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// collectLambda reads functions in every enabled region with their runtime, the KMS key their
+// environment is encrypted with, their VPC configuration and resource policy. The policy is
+// supplementary configuration, as Config records it.
+func (cs *ConfigService) collectLambda(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+	accountID, _ := getAccountID(ctx, &cfg)
+	return cs.collectPerRegion(ctx, cfg, "Lambda", func(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+		return collectFunctions(ctx, lambda.NewFromConfig(cfg), cfg.Region, accountID)
+	})
+}
+
+func collectFunctions(ctx context.Context, client *lambda.Client, region, accountID string) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Lambda functions: %w", err)
+		}
+		for _, fn := range page.Functions {
+			items = append(items, describeFunction(ctx, client, fn, region, accountID))
+		}
+	}
+	return items, nil
+}
+
+// describeFunction builds a function's configuration item. Environment variable values are
+// dropped, keeping only their names, since they often hold secrets.
+func describeFunction(ctx context.Context, client *lambda.Client, fn lambdatypes.FunctionConfiguration, region, accountID string) ConfigurationItem {
+	name := aws.ToString(fn.FunctionName)
+	if fn.Environment != nil {
+		environment := *fn.Environment
+		environment.Variables = make(map[string]string, len(fn.Environment.Variables))
+		for variable := range fn.Environment.Variables {
+			environment.Variables[variable] = ""
+		}
+		fn.Environment = &environment
+	}
+
+	var relationships []Relationship
+	if fn.VpcConfig != nil {
+		relationships = relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(fn.VpcConfig.VpcId))
+		relationships = append(relationships, relatedTo("AWS::EC2::Subnet", "Is contained in Subnet", fn.VpcConfig.SubnetIds...)...)
+		relationships = append(relationships, relatedTo("AWS::EC2::SecurityGroup", "Is associated with SecurityGroup", fn.VpcConfig.SecurityGroupIds...)...)
+	}
+
+	var tags FlexibleTags
+	if out, err := client.ListTags(ctx, &lambda.ListTagsInput{Resource: fn.FunctionArn}); err != nil {
+		log.Printf("[ConfigService] Warning: failed to read tags of function %s: %v", name, err)
+	} else {
+		tags = FlexibleTags(out.Tags)
+	}
+
+	item := collectedItem("AWS::Lambda::Function", name, name, region, accountID, fn, tags, nil, relationships...)
+	policy, err := client.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: fn.FunctionName})
+	var noPolicy *lambdatypes.ResourceNotFoundException
+	switch {
+	case errors.As(err, &noPolicy):
+	case err != nil:
+		log.Printf("[ConfigService] Warning: failed to get policy of function %s: %v", name, err)
+	default:
+		item.SupplementaryConfiguration = map[string]interface{}{"Policy": aws.ToString(policy.Policy)}
+	}
+	return item
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// logReplicationRuleID names the replication rule setup manages on the log bucket
+const logReplicationRuleID = "cloudloom-log-replication"
+
+// ErrInvalidReplicationRegion is returned when logs would be replicated to the region they
+// are already in
+var ErrInvalidReplicationRegion = errors.New("replication region must differ from the setup region")
+
+// LogReplication is where an account's log bucket is replicated to for disaster recovery
+type LogReplication struct {
+	Region            string `json:"region"`
+	Bucket            string `json:"bucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	RoleArn           string `json:"roleArn"`
+	// ReplicaKMSKey encrypts replicas of objects encrypted with the account's log key
+	ReplicaKMSKey string `json:"replicaKmsKey,omitempty"`
+}
+
+func (s *CloudTrailService) replicationRegion() string {
+	if s.tenant != nil {
+		return s.tenant.ReplicationRegion
+	}
+	return ""
+}
+
+// replicaBucketName is the destination bucket logs are replicated to in region
+func replicaBucketName(accountID, region string) string {
+	return fmt.Sprintf("cloudloom-logs-%s-%s", accountID, region)
+}
+
+// replicationRoleName is the role S3 assumes to replicate the log bucket
+func replicationRoleName(accountID string) string {
+	return fmt.Sprintf("CloudLoom-Replication-Role-%s", accountID)
+}
+
+// replicaKMSKey is the key replicas of KMS-encrypted logs are encrypted with: the
+// destination region's AWS managed S3 key, since a customer key does not leave its region
+func replicaKMSKey(accountID, region string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:alias/aws/s3", region, accountID)
+}
+
+// applyLogReplication replicates every new object in the log bucket to a versioned bucket in
+// region, creating the destination bucket and the role S3 replicates with if they do not
+// exist. Objects already in the bucket are not copied. With a KMS key, KMS-encrypted logs are
+// replicated too and re-encrypted in the destination region.
+func (s *CloudTrailService) applyLogReplication(ctx context.Context, cfg aws.Config, accountID, bucketName, region, kmsKeyArn string) (*LogReplication, error) {
+	if region == cfg.Region {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidReplicationRegion, region)
+	}
+	replication := &LogReplication{
+		Region:            region,
+		Bucket:            bucketName,
+		DestinationBucket: replicaBucketName(accountID, region),
+	}
+	if kmsKeyArn != "" {
+		replication.ReplicaKMSKey = replicaKMSKey(accountID, region)
+	}
+
+	// Replication requires versioning on both buckets
+	buckets := s3.NewFromConfig(cfg)
+	if err := enableVersioning(ctx, buckets, bucketName); err != nil {
+		return nil, err
+	}
+
+	replicaCfg := inRegion(cfg, region)
+	if err := createReplicaBucket(ctx, s3.NewFromConfig(replicaCfg), replication.DestinationBucket, region); err != nil {
+		return nil, err
+	}
+	s.tagManaged(ctx, replicaCfg, "arn:aws:s3:::"+replication.DestinationBucket)
+
+	roleArn, err := s.createReplicationRole(ctx, cfg, accountID, replication, kmsKeyArn)
+	if err != nil {
+		return nil, err
+	}
+	replication.RoleArn = roleArn
+
+	rule := s3types.ReplicationRule{
+		ID:                      aws.String(logReplicationRuleID),
+		Status:                  s3types.ReplicationRuleStatusEnabled,
+		Priority:                aws.Int32(1),
+		Filter:                  &s3types.ReplicationRuleFilter{Prefix: aws.String("")},
+		DeleteMarkerReplication: &s3types.DeleteMarkerReplication{Status: s3types.DeleteMarkerReplicationStatusDisabled},
+		Destination: &s3types.Destination{
+			Bucket: aws.String("arn:aws:s3:::" + replication.DestinationBucket),
+		},
+	}
+	if replication.ReplicaKMSKey != "" {
+		rule.SourceSelectionCriteria = &s3types.SourceSelectionCriteria{
+			SseKmsEncryptedObjects: &s3types.SseKmsEncryptedObjects{Status: s3types.SseKmsEncryptedObjectsStatusEnabled},
+		}
+		rule.Destination.EncryptionConfiguration = &s3types.EncryptionConfiguration{ReplicaKmsKeyID: aws.String(replication.ReplicaKMSKey)}
+	}
+
+	// S3 checks it can assume the role when the configuration is put, so retry until it can
+	err = retryWhilePropagating(ctx, func() error {
+		_, err := buckets.PutBucketReplication(ctx, &s3.PutBucketReplicationInput{
+			Bucket: aws.String(bucketName),
+			ReplicationConfiguration: &s3types.ReplicationConfiguration{
+				Role:  aws.String(roleArn),
+				Rules: []s3types.ReplicationRule{rule},
+			},
+		})
+		return err
+	}, "InvalidRequest", "AccessDenied")
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure replication of %s: %w", bucketName, err)
+	}
+	log.Printf("[S3] ✅ Bucket %s replicates to %s in %s", bucketName, replication.DestinationBucket, region)
+	return replication, nil
+}
+
+func enableVersioning(ctx context.Context, client *s3.Client, bucketName string) error {
+	_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucketName),
+		VersioningConfiguration: &s3types.VersioningConfiguration{Status: s3types.BucketVersioningStatusEnabled},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable versioning on %s: %w", bucketName, err)
+	}
+	return nil
+}
+
+// createReplicaBucket creates the destination bucket if it does not exist, versioned, private
+// and encrypted by default
+func createReplicaBucket(ctx context.Context, client *s3.Client, bucketName, region string) error {
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err != nil {
+		log.Printf("[S3] Creating replica bucket %s in %s", bucketName, region)
+		input := &s3.CreateBucketInput{Bucket: aws.String(bucketName)}
+		// us-east-1 is the default location and may not be named as a constraint
+		if region != "us-east-1" {
+			input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+				LocationConstraint: s3types.BucketLocationConstraint(region),
+			}
+		}
+		if _, err := client.CreateBucket(ctx, input); err != nil {
+			return fmt.Errorf("failed to create replica bucket %s: %w", bucketName, err)
+		}
+	}
+
+	if err := enableVersioning(ctx, client, bucketName); err != nil {
+		return err
+	}
+	_, err := client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block public access to %s: %w", bucketName, err)
+	}
+	_, err = client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+		ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAes256},
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable encryption on %s: %w", bucketName, err)
+	}
+	return nil
+}
+
+// createReplicationRole creates the role S3 replicates the log bucket with, or updates the
+// policy of the existing one, and returns its ARN
+func (s *CloudTrailService) createReplicationRole(ctx context.Context, cfg aws.Config, accountID string, replication *LogReplication, kmsKeyArn string) (string, error) {
+	client := iam.NewFromConfig(cfg)
+	roleName := replicationRoleName(accountID)
+
+	if _, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)}); err != nil {
+		log.Printf("[IAM] Creating IAM role '%s' for S3 replication", roleName)
+		_, err := client.CreateRole(ctx, &iam.CreateRoleInput{
+			RoleName: aws.String(roleName),
+			AssumeRolePolicyDocument: aws.String(`{
+            "Version": "2012-10-17",
+            "Statement": [{"Effect": "Allow", "Principal": {"Service": "s3.amazonaws.com"}, "Action": "sts:AssumeRole"}]
+        }`),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create replication role: %w", err)
+		}
+	}
+	s.tagRole(ctx, client, roleName)
+
+	kmsStatements := ""
+	if kmsKeyArn != "" {
+		kmsStatements = fmt.Sprintf(`,
+            {
+                "Effect": "Allow",
+                "Action": "kms:Decrypt",
+                "Resource": "%s"
+            },
+            {
+                "Effect": "Allow",
+                "Action": ["kms:Encrypt", "kms:GenerateDataKey"],
+                "Resource": "arn:aws:kms:%s:%s:key/*",
+                "Condition": {"StringLike": {"kms:ViaService": "s3.%s.amazonaws.com"}}
+            }`, kmsKeyArn, replication.Region, accountID, replication.Region)
+	}
+	policy := fmt.Sprintf(`{
+        "Version": "2012-10-17",
+        "Statement": [
+            {
+                "Effect": "Allow",
+                "Action": ["s3:GetReplicationConfiguration", "s3:ListBucket"],
+                "Resource": "arn:aws:s3:::%s"
+            },
+            {
+                "Effect": "Allow",
+                "Action": ["s3:GetObjectVersionForReplication", "s3:GetObjectVersionAcl", "s3:GetObjectVersionTagging"],
+                "Resource": "arn:aws:s3:::%s/*"
+            },
+            {
+                "Effect": "Allow",
+                "Action": ["s3:ReplicateObject", "s3:ReplicateTags"],
+                "Resource": "arn:aws:s3:::%s/*"
+            }%s
+        ]
+    }`, replication.Bucket, replication.Bucket, replication.DestinationBucket, kmsStatements)
+	_, err := client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String("CloudLoom-Replication-Policy"),
+		PolicyDocument: aws.String(policy),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to set replication role policy: %w", err)
+	}
+
+	if err := waitForRole(ctx, client, roleName, "s3:ReplicateObject", "arn:aws:s3:::"+replication.DestinationBucket+"/*"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, roleName), nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+const (
+	// MaxLogRetentionDays is the longest retention CloudWatch Logs supports
+	MaxLogRetentionDays = 3653
+	// logRetentionRuleID names the lifecycle rule setup manages on the log bucket
+	logRetentionRuleID = "cloudloom-log-retention"
+	// Log objects move to Glacier after logArchiveAfterDays, but only when they are kept long
+	// enough to outlast the minimum storage duration Glacier bills for
+	logArchiveAfterDays = 30
+	glacierMinimumDays  = 90
+)
+
+// logGroupRetentionDays are the retention periods CloudWatch Logs accepts, in ascending order
+var logGroupRetentionDays = []int32{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// LogRetention is how long an account's CloudTrail and AWS Config logs are kept
+type LogRetention struct {
+	// Days is zero when logs are kept indefinitely
+	Days   int    `json:"days"`
+	Bucket string `json:"bucket,omitempty"`
+	// ArchiveAfterDays is when log objects move to Glacier, zero if they expire first
+	ArchiveAfterDays int    `json:"archiveAfterDays,omitempty"`
+	LogGroup         string `json:"logGroup,omitempty"`
+	// LogGroupDays is Days rounded up to a period CloudWatch Logs supports
+	LogGroupDays int `json:"logGroupDays,omitempty"`
+}
+
+func (s *CloudTrailService) logRetentionDays() int {
+	if s.tenant != nil {
+		return s.tenant.LogRetentionDays
+	}
+	return 0
+}
+
+// logGroupRetention rounds days up to the next period CloudWatch Logs supports
+func logGroupRetention(days int) int32 {
+	for _, supported := range logGroupRetentionDays {
+		if int(supported) >= days {
+			return supported
+		}
+	}
+	return MaxLogRetentionDays
+}
+
+// logArchiveAfter returns when log objects kept for days move to Glacier, or zero if never
+func logArchiveAfter(days int) int {
+	if days >= logArchiveAfterDays+glacierMinimumDays {
+		return logArchiveAfterDays
+	}
+	return 0
+}
+
+// applyLogRetention sets the log bucket's lifecycle rule and the log group's retention policy
+// to keep logs for days. Zero keeps logs indefinitely. Lifecycle rules the customer added to
+// the bucket are left as they are. An empty bucket or log group name leaves it unchanged, as
+// for a customer's own bucket or trail.
+func applyLogRetention(ctx context.Context, cfg aws.Config, bucketName, logGroupName string, days int) (*LogRetention, error) {
+	retention := &LogRetention{Days: days, Bucket: bucketName, ArchiveAfterDays: logArchiveAfter(days), LogGroup: logGroupName}
+
+	if bucketName != "" {
+		buckets := s3.NewFromConfig(cfg)
+		rules, err := otherLifecycleRules(ctx, buckets, bucketName)
+		if err != nil {
+			return nil, err
+		}
+		if days > 0 {
+			rule := s3types.LifecycleRule{
+				ID:         aws.String(logRetentionRuleID),
+				Status:     s3types.ExpirationStatusEnabled,
+				Filter:     &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+				Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(int32(days))},
+			}
+			if retention.ArchiveAfterDays > 0 {
+				rule.Transitions = []s3types.Transition{{
+					Days:         aws.Int32(int32(retention.ArchiveAfterDays)),
+					StorageClass: s3types.TransitionStorageClassGlacier,
+				}}
+			}
+			rules = append(rules, rule)
+		}
+		if len(rules) == 0 {
+			_, err = buckets.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucketName)})
+		} else {
+			_, err = buckets.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+				Bucket:                 aws.String(bucketName),
+				LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set lifecycle of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	if logGroupName != "" {
+		logs := cloudwatchlogs.NewFromConfig(cfg)
+		var err error
+		if days > 0 {
+			retention.LogGroupDays = int(logGroupRetention(days))
+			_, err = logs.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+				LogGroupName:    aws.String(logGroupName),
+				RetentionInDays: aws.Int32(int32(retention.LogGroupDays)),
+			})
+		} else {
+			_, err = logs.DeleteRetentionPolicy(ctx, &cloudwatchlogs.DeleteRetentionPolicyInput{LogGroupName: aws.String(logGroupName)})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to set retention of log group %s: %w", logGroupName, err)
+		}
+	}
+	return retention, nil
+}
+
+// otherLifecycleRules returns the bucket's lifecycle rules except CloudLoom's own
+func otherLifecycleRules(ctx context.Context, client *s3.Client, bucketName string) ([]s3types.LifecycleRule, error) {
+	current, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucketName)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle of bucket %s: %w", bucketName, err)
+	}
+
+	var rules []s3types.LifecycleRule
+	for _, rule := range current.Rules {
+		if aws.ToString(rule.ID) != logRetentionRuleID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// UpdateLogRetention applies a new log retention to the log bucket and log group setup created
+// in the tenant's account, and records it on the tenant so later setups keep it
+func UpdateLogRetention(ctx context.Context, tenantID string, days int) (*LogRetention, error) {
+	manager := tenants.Default()
+	if manager == nil {
+		return nil, fmt.Errorf("tenant store is not initialized")
+	}
+	tenant, err := manager.Get(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewTenantCloudTrailService(tenant)
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+	bucketName, logGroupName := names.bucket, names.logGroup
+	if names.existingBucket || names.existingTrail {
+		bucketName = ""
+	}
+	if names.existingTrail {
+		logGroupName = ""
+	}
+
+	retention, err := applyLogRetention(ctx, cfg, bucketName, logGroupName, days)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.SetLogRetention(ctx, tenantID, days); err != nil {
+		return nil, err
+	}
+	log.Printf("[Retention] ✅ Logs of account %s are now kept for %d days (0 = indefinitely)", accountID, days)
+	return retention, nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/rishichirchi/cloudloom/services/notificationtargets"
+)
+
+// maxFanOutTargets is how many customer topics one rule may publish to. EventBridge allows
+// five targets per rule and CloudLoom's topic and queue take two.
+const maxFanOutTargets = 3
+
+// ErrNotificationTargetsUnavailable is returned when the notification target store is not
+// initialized
+var ErrNotificationTargetsUnavailable = errors.New("notification targets are not available")
+
+// ListNotificationTargets returns the destinations the tenant's events are fanned out to
+func ListNotificationTargets(ctx context.Context, tenantID string) ([]notificationtargets.Target, error) {
+	store := notificationtargets.Default()
+	if store == nil {
+		return nil, ErrNotificationTargetsUnavailable
+	}
+	return store.List(ctx, tenantID, "")
+}
+
+// AddNotificationTarget fans the tenant's events out to another destination. An sns target's
+// topic is added to the rule in its region, which must be monitored; an https target is
+// subscribed to the notification topic and stays pending until the endpoint confirms.
+func AddNotificationTarget(ctx context.Context, tenantID string, target *notificationtargets.Target) (*notificationtargets.Target, error) {
+	store := notificationtargets.Default()
+	if store == nil {
+		return nil, ErrNotificationTargetsUnavailable
+	}
+	target.TenantID = tenantID
+	if err := target.Validate(); err != nil {
+		return nil, err
+	}
+
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+
+	if target.Type == notificationtargets.TypeSNS {
+		if !containsString(names.regions, target.Region) {
+			return nil, fmt.Errorf("%w: region %s of the topic is not monitored", notificationtargets.ErrInvalid, target.Region)
+		}
+		existing, err := store.List(ctx, tenantID, target.Region)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) >= maxFanOutTargets {
+			return nil, fmt.Errorf("%w: the rule in %s already publishes to %d topics", notificationtargets.ErrInvalid, target.Region, maxFanOutTargets)
+		}
+	}
+
+	if err := store.Create(ctx, target); err != nil {
+		return nil, err
+	}
+	switch target.Type {
+	case notificationtargets.TypeSNS:
+		_, err = eventbridge.NewFromConfig(inRegion(cfg, target.Region)).PutTargets(ctx, &eventbridge.PutTargetsInput{
+			Rule:    aws.String(names.rules[target.Region]),
+			Targets: []ebtypes.Target{fanOutTarget(*target)},
+		})
+		if err == nil {
+			log.Printf("[NotificationTargets] ✅ Rule %s publishes to %s", names.rules[target.Region], target.Destination)
+		}
+	case notificationtargets.TypeHTTPS:
+		topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic)
+		// Raw delivery posts the event itself instead of wrapping it in an SNS envelope
+		_, err = sns.NewFromConfig(cfg).Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn:   aws.String(topicArn),
+			Protocol:   aws.String("https"),
+			Endpoint:   aws.String(target.Destination),
+			Attributes: map[string]string{"RawMessageDelivery": "true"},
+		})
+		if err == nil {
+			log.Printf("[NotificationTargets] ✅ Subscribed %s to %s", target.Destination, topicArn)
+		}
+	}
+	if err != nil {
+		if deleteErr := store.Delete(ctx, tenantID, target.ID); deleteErr != nil {
+			log.Printf("[NotificationTargets] Warning: %v", deleteErr)
+		}
+		return nil, fmt.Errorf("failed to add %s: %w", target.Destination, err)
+	}
+	return target, nil
+}
+
+// RemoveNotificationTarget stops fanning the tenant's events out to a destination. A pending
+// https subscription cannot be removed from SNS and expires after 3 days.
+func RemoveNotificationTarget(ctx context.Context, tenantID, id string) error {
+	store := notificationtargets.Default()
+	if store == nil {
+		return ErrNotificationTargetsUnavailable
+	}
+	target, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+
+	switch target.Type {
+	case notificationtargets.TypeSNS:
+		if ruleName, ok := names.rules[target.Region]; ok {
+			_, err := eventbridge.NewFromConfig(inRegion(cfg, target.Region)).RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{
+				Rule: aws.String(ruleName),
+				Ids:  []string{target.RuleTargetID()},
+			})
+			if err != nil && !isNotFound(err) {
+				return fmt.Errorf("failed to remove %s from rule %s: %w", target.Destination, ruleName, err)
+			}
+		}
+	case notificationtargets.TypeHTTPS:
+		client := sns.NewFromConfig(cfg)
+		subscriptions, err := listSubscriptions(ctx, client, fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic))
+		if err != nil {
+			return err
+		}
+		for _, subscription := range subscriptions {
+			if subscription.Endpoint != target.Destination || subscription.Pending {
+				continue
+			}
+			if _, err := client.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(subscription.SubscriptionArn)}); err != nil {
+				return fmt.Errorf("failed to unsubscribe %s: %w", target.Destination, err)
+			}
+		}
+	}
+
+	if err := store.Delete(ctx, tenantID, target.ID); err != nil {
+		return err
+	}
+	log.Printf("[NotificationTargets] ✅ Removed %s of tenant %s", target.Destination, tenantID)
+	return nil
+}
+
+// fanOutTargets returns the tenant's sns targets in the region as targets of the region's rule,
+// so setup and healing keep them on the rules they recreate
+func (s *CloudTrailService) fanOutTargets(ctx context.Context, region string) []ebtypes.Target {
+	store := notificationtargets.Default()
+	if store == nil || s.tenant == nil {
+		return nil
+	}
+	stored, err := store.List(ctx, s.tenant.AccountID, region)
+	if err != nil {
+		log.Printf("[NotificationTargets] Warning: rule in %s keeps its fan-out targets as they are: %v", region, err)
+		return nil
+	}
+	targets := make([]ebtypes.Target, len(stored))
+	for i, target := range stored {
+		targets[i] = fanOutTarget(target)
+	}
+	return targets
+}
+
+func fanOutTarget(target notificationtargets.Target) ebtypes.Target {
+	return ebtypes.Target{Id: aws.String(target.RuleTargetID()), Arn: aws.String(target.Destination)}
+}
@@ -0,0 +1,171 @@
+package notificationtargets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionNotificationTargets
+
+var (
+	// ErrNotFound is returned when a target does not exist for the tenant
+	ErrNotFound = errors.New("notification target not found")
+	// ErrExists is returned when the tenant already fans out to the destination
+	ErrExists = errors.New("notification target already exists")
+	// ErrInvalid is returned for a target whose destination does not match its type
+	ErrInvalid = errors.New("invalid notification target")
+)
+
+// Type is how events reach a target
+type Type string
+
+const (
+	// TypeSNS adds the customer's own SNS topic as a target of the EventBridge rule in the
+	// topic's region. The topic policy must let events.amazonaws.com publish.
+	TypeSNS Type = "sns"
+	// TypeHTTPS subscribes an HTTPS endpoint to the tenant's notification topic with raw
+	// message delivery, so it receives the events as EventBridge sends them
+	TypeHTTPS Type = "https"
+)
+
+var topicArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:sns:([a-z0-9-]+):\d{12}:[A-Za-z0-9_-]{1,256}$`)
+
+// Target is a customer destination the tenant's account events are fanned out to, besides the
+// queue CloudLoom processes them from
+type Target struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID string             `bson:"tenantId" json:"tenantId"`
+	Type     Type               `bson:"type" json:"type"`
+	// Destination is the topic ARN of an sns target or the URL of an https target
+	Destination string `bson:"destination" json:"destination"`
+	// Region is where the rule publishing to an sns target's topic runs
+	Region      string    `bson:"region,omitempty" json:"region,omitempty"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Validate checks the destination matches the target's type and sets the region of an sns
+// target from its topic ARN
+func (t *Target) Validate() error {
+	switch t.Type {
+	case TypeSNS:
+		match := topicArnPattern.FindStringSubmatch(t.Destination)
+		if match == nil {
+			return fmt.Errorf("%w: '%s' is not an SNS topic ARN", ErrInvalid, t.Destination)
+		}
+		t.Region = match[1]
+	case TypeHTTPS:
+		if !strings.HasPrefix(t.Destination, "https://") {
+			return fmt.Errorf("%w: '%s' is not an HTTPS URL", ErrInvalid, t.Destination)
+		}
+		t.Region = ""
+	default:
+		return fmt.Errorf("%w: type must be %s or %s", ErrInvalid, TypeSNS, TypeHTTPS)
+	}
+	return nil
+}
+
+// RuleTargetPrefix starts the ID of every fan-out target on the EventBridge rules
+const RuleTargetPrefix = "CloudLoom-FanOut-"
+
+// RuleTargetID is the ID of an sns target on the EventBridge rule
+func (t *Target) RuleTargetID() string {
+	return RuleTargetPrefix + t.ID.Hex()
+}
+
+// Store persists per-tenant notification targets in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide notification target store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide notification target store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the notification_targets collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create validates and stores a new target for the tenant
+func (s *Store) Create(ctx context.Context, target *Target) error {
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	target.ID = primitive.NewObjectID()
+	target.CreatedAt = time.Now()
+	_, err := s.collection.InsertOne(ctx, target)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, target.Destination)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create notification target: %w", err)
+	}
+	return nil
+}
+
+// List returns the tenant's targets, oldest first. A non-empty region keeps only sns targets
+// in that region.
+func (s *Store) List(ctx context.Context, tenantID, region string) ([]Target, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if region != "" {
+		filter["type"], filter["region"] = TypeSNS, region
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification targets: %w", err)
+	}
+	result := []Target{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode notification targets: %w", err)
+	}
+	return result, nil
+}
+
+// Get returns one of the tenant's targets
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Target, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var target Target
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&target)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification target: %w", err)
+	}
+	return &target, nil
+}
+
+// Delete removes one of the tenant's targets
+func (s *Store) Delete(ctx context.Context, tenantID string, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete notification target: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/notifiers"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+)
+
+// JobTypeNotifierDelivery posts one message to one of the tenant's Slack or Teams notifiers
+const JobTypeNotifierDelivery = "notifier_delivery"
+
+// notifierRetryPolicy retries a failed post for about an hour, backing off from 30 seconds to
+// 20 minutes; a message about a finding is of little use much later than that
+var notifierRetryPolicy = jobs.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     20 * time.Minute,
+	Multiplier:     3,
+}
+
+// notifierTimeout bounds one attempt to post a message
+const notifierTimeout = 10 * time.Second
+
+// notifierClient only connects to public addresses, wherever the webhook's name resolves to
+var notifierClient = common.PublicHTTPClient(notifierTimeout)
+
+// ErrNotifiersUnavailable is returned when the notifier store or the secret store that keeps
+// their webhook URLs is not configured
+var ErrNotifiersUnavailable = errors.New("notifiers are not available")
+
+// ListNotifiers returns the tenant's notifiers
+func ListNotifiers(ctx context.Context, tenantID string) ([]notifiers.Notifier, error) {
+	store := notifiers.Default()
+	if store == nil {
+		return nil, ErrNotifiersUnavailable
+	}
+	return store.List(ctx, tenantID)
+}
+
+// CreateNotifier stores an enabled notifier for the tenant that posts to the incoming webhook URL
+func CreateNotifier(ctx context.Context, tenantID string, notifier *notifiers.Notifier, webhookURL string) (*notifiers.Notifier, error) {
+	store, secretStore := notifiers.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, ErrNotifiersUnavailable
+	}
+	host, err := notifier.WebhookHost(webhookURL)
+	if err != nil {
+		return nil, err
+	}
+	notifier.TenantID, notifier.Host, notifier.Enabled = tenantID, host, true
+	if err := store.Create(ctx, notifier); err != nil {
+		return nil, err
+	}
+	if err := setNotifierURL(ctx, secretStore, tenantID, notifier.ID.Hex(), webhookURL); err != nil {
+		if deleteErr := store.Delete(ctx, tenantID, notifier.ID); deleteErr != nil {
+			log.Printf("[Notifiers] Warning: %v", deleteErr)
+		}
+		return nil, err
+	}
+	log.Printf("[Notifiers] ✅ Tenant %s posts %v to %s %s", tenantID, notifier.Events, notifier.Type, notifier.Name)
+	return notifier, nil
+}
+
+// UpdateNotifier changes the name, events, severity threshold or enabled state of one of the
+// tenant's notifiers, and its webhook URL when one is given
+func UpdateNotifier(ctx context.Context, tenantID string, notifier *notifiers.Notifier, webhookURL string) (*notifiers.Notifier, error) {
+	store, secretStore := notifiers.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, ErrNotifiersUnavailable
+	}
+	existing, err := store.Get(ctx, tenantID, notifier.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	notifier.TenantID, notifier.Type, notifier.Host = tenantID, existing.Type, existing.Host
+	if webhookURL != "" {
+		if notifier.Host, err = notifier.WebhookHost(webhookURL); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.Update(ctx, notifier); err != nil {
+		return nil, err
+	}
+	if webhookURL != "" {
+		if err := setNotifierURL(ctx, secretStore, tenantID, notifier.ID.Hex(), webhookURL); err != nil {
+			return nil, err
+		}
+	}
+	return store.Get(ctx, tenantID, notifier.ID.Hex())
+}
+
+// DeleteNotifier removes one of the tenant's notifiers and its webhook URL. Messages still
+// waiting to be retried are dropped.
+func DeleteNotifier(ctx context.Context, tenantID, id string) error {
+	store, secretStore := notifiers.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return ErrNotifiersUnavailable
+	}
+	notifier, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, tenantID, notifier.ID); err != nil {
+		return err
+	}
+	urls, err := notifierURLs(ctx, secretStore, tenantID)
+	if err == nil {
+		delete(urls, id)
+		err = secrets.PutJSON(ctx, secretStore, secrets.TenantName(tenantID, secrets.NotifierWebhookURLs), urls)
+	}
+	if err != nil {
+		log.Printf("[Notifiers] Warning: failed to remove the webhook URL of notifier %s: %v", id, err)
+	}
+	log.Printf("[Notifiers] ✅ Removed %s notifier %s of tenant %s", notifier.Type, notifier.Name, tenantID)
+	return nil
+}
+
+// TestNotifier posts a test message to one of the tenant's notifiers, even a disabled one
+func TestNotifier(ctx context.Context, tenantID, id string) (*jobs.Job, error) {
+	store := notifiers.Default()
+	if store == nil || jobs.Default() == nil {
+		return nil, ErrNotifiersUnavailable
+	}
+	notifier, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	return enqueueNotification(ctx, notifier, notifiers.EventTest, testNotification(notifier))
+}
+
+// notifyFinding tells the tenant's notifiers about a finding that was just created or reopened
+func notifyFinding(ctx context.Context, f *findings.Finding) {
+	if f.ID.IsZero() || f.Status != findings.StatusOpen || f.Excluded {
+		return
+	}
+	dispatchNotification(ctx, f.TenantID, notifiers.EventFindingCreated, f.Severity, func() *notification {
+		return findingNotification(ctx, f)
+	})
+}
+
+// notifyRemediation tells the tenant's notifiers about a remediation that finished running
+func notifyRemediation(ctx context.Context, remediation *remediations.Remediation, event string) {
+	if event != audit.EventExecuted {
+		return
+	}
+	dispatchNotification(ctx, remediation.TenantID, notifiers.EventRemediationCompleted, "", func() *notification {
+		return remediationNotification(remediation)
+	})
+}
+
+// notifySetupFailure tells the tenant's notifiers that setting up their account failed
+func notifySetupFailure(ctx context.Context, tenantID string, setupErr error) {
+	dispatchNotification(ctx, tenantID, notifiers.EventSetupFailed, "", func() *notification {
+		return setupFailureNotification(tenantID, setupErr)
+	})
+}
+
+// dispatchNotification queues a message about the event to each of the tenant's notifiers told
+// about it. The message is only built when some notifier wants it. Failing to queue is logged
+// and does not affect whatever the event is about.
+func dispatchNotification(ctx context.Context, tenantID, event, severity string, build func() *notification) {
+	store := notifiers.Default()
+	if store == nil || jobs.Default() == nil || DemoModeEnabled() {
+		return
+	}
+	registered, err := store.List(ctx, tenantID)
+	if err != nil {
+		log.Printf("[Notifiers] Warning: not posting %s of tenant %s: %v", event, tenantID, err)
+		return
+	}
+
+	var message *notification
+	for i := range registered {
+		notifier := &registered[i]
+		if !notifier.Notifies(event, severity) {
+			continue
+		}
+		if message == nil {
+			message = build()
+		}
+		if _, err := enqueueNotification(ctx, notifier, event, message); err != nil {
+			log.Printf("[Notifiers] Warning: failed to queue %s for %s: %v", event, notifier.Name, err)
+		}
+	}
+}
+
+// enqueueNotification renders the message for the notifier's chat service and queues posting it
+func enqueueNotification(ctx context.Context, notifier *notifiers.Notifier, event string, message *notification) (*jobs.Job, error) {
+	body, err := json.Marshal(message.render(notifier.Type))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s message: %w", event, err)
+	}
+	return jobs.Default().Enqueue(ctx, JobTypeNotifierDelivery, notifier.TenantID, map[string]interface{}{
+		"notifierId": notifier.ID.Hex(),
+		"event":      event,
+		"body":       string(body),
+	})
+}
+
+// runNotifierDeliveryJob posts a queued message to its notifier's current webhook URL. Server
+// errors, timeouts and rate limiting are retried with backoff; other client errors, which
+// Slack and Teams return for revoked webhooks, and deleted notifiers are not.
+func runNotifierDeliveryJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	store, secretStore := notifiers.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, ErrNotifiersUnavailable
+	}
+	notifierID, _ := job.Payload["notifierId"].(string)
+	event, _ := job.Payload["event"].(string)
+	body, _ := job.Payload["body"].(string)
+	notifier, err := store.Get(ctx, job.TenantID, notifierID)
+	if errors.Is(err, notifiers.ErrNotFound) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if event != notifiers.EventTest && !notifier.Enabled {
+		return map[string]interface{}{"skipped": true, "reason": "notifier is disabled"}, nil
+	}
+	urls, err := notifierURLs(ctx, secretStore, job.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	webhookURL, ok := urls[notifierID]
+	if !ok {
+		return nil, jobs.Permanent(fmt.Errorf("notifier %s has no webhook URL", notifierID))
+	}
+
+	status, deliveryErr := postNotification(ctx, webhookURL, []byte(body))
+	if err := store.RecordDelivery(ctx, job.TenantID, notifier.ID, time.Now(), deliveryErr); err != nil {
+		log.Printf("[Notifiers] Warning: %v", err)
+	}
+	if deliveryErr != nil {
+		deliveryErr = fmt.Errorf("%s notifier %s: %w", notifier.Type, notifier.Name, deliveryErr)
+		retryable := status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+		if !retryable {
+			return nil, jobs.Permanent(deliveryErr)
+		}
+		return nil, deliveryErr
+	}
+	return map[string]interface{}{"notifierId": notifierID, "event": event, "status": status}, nil
+}
+
+// postNotification posts a rendered message and returns the response status, 0 when there
+// was no response. The webhook URL is left out of errors, since it is a credential.
+func postNotification(ctx context.Context, webhookURL string, body []byte) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.New("failed to build request to the webhook URL")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "CloudLoom-Notifiers/1.0")
+
+	response, err := notifierClient.Do(request)
+	if err != nil {
+		var urlErr interface{ Timeout() bool }
+		if errors.As(err, &urlErr) && urlErr.Timeout() {
+			return 0, errors.New("the webhook did not answer in time")
+		}
+		return 0, errors.New("failed to reach the webhook")
+	}
+	defer response.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("the webhook answered %s: %s", response.Status, bytes.TrimSpace(answer))
+	}
+	return response.StatusCode, nil
+}
+
+// notifierURLs returns the webhook URLs of the tenant's notifiers by notifier ID
+func notifierURLs(ctx context.Context, store secrets.Store, tenantID string) (map[string]string, error) {
+	urls := map[string]string{}
+	err := secrets.GetJSON(ctx, store, secrets.TenantName(tenantID, secrets.NotifierWebhookURLs), &urls)
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// setNotifierURL stores the webhook URL of one of the tenant's notifiers
+func setNotifierURL(ctx context.Context, store secrets.Store, tenantID, id, webhookURL string) error {
+	urls, err := notifierURLs(ctx, store, tenantID)
+	if err != nil {
+		return err
+	}
+	urls[id] = webhookURL
+	return secrets.PutJSON(ctx, store, secrets.TenantName(tenantID, secrets.NotifierWebhookURLs), urls)
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/notifiers"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// defaultAppURL is where the web app is served when CLOUDLOOM_APP_URL is not set
+const defaultAppURL = "http://localhost:3000"
+
+// Tones of a notification, shown as an emoji in Slack and a text color in Teams
+const (
+	toneAttention = "attention"
+	toneWarning   = "warning"
+	toneGood      = "good"
+	toneNeutral   = "neutral"
+)
+
+// notification is a chat message independent of the service it is posted to: a title, a
+// paragraph, a list of facts and buttons that open CloudLoom
+type notification struct {
+	Title   string
+	Text    string
+	Tone    string
+	Facts   []notificationFact
+	Actions []notificationAction
+}
+
+type notificationFact struct {
+	Name  string
+	Value string
+}
+
+// notificationAction is a button linking to CloudLoom. Buttons only open pages; approving a
+// fix still happens in CloudLoom, signed in.
+type notificationAction struct {
+	Label   string
+	URL     string
+	Primary bool
+}
+
+// fact appends a fact, leaving out those without a value
+func (n *notification) fact(name, value string) {
+	if value != "" {
+		n.Facts = append(n.Facts, notificationFact{Name: name, Value: value})
+	}
+}
+
+// appURL links to a page of the web app at CLOUDLOOM_APP_URL
+func appURL(path string, query url.Values) string {
+	base := strings.TrimRight(os.Getenv("CLOUDLOOM_APP_URL"), "/")
+	if base == "" {
+		base = defaultAppURL
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return base + path
+}
+
+// findingNotification describes a new or reopened finding, with a button to approve the fix
+// the remediation engine proposed for it, if any
+func findingNotification(ctx context.Context, f *findings.Finding) *notification {
+	n := &notification{
+		Title: fmt.Sprintf("%s finding: %s", titleCase(f.Severity), f.Title),
+		Text:  f.Description,
+		Tone:  severityTone(f.Severity),
+	}
+	n.fact("Severity", f.Severity)
+	n.fact("Resource", strings.TrimSpace(f.ResourceType+" "+f.ResourceID))
+	if f.Context != nil {
+		n.fact("Region", f.Context.Region)
+	}
+	n.fact("Account", f.TenantID)
+	n.fact("Rule", f.RuleID)
+	n.fact("Source", f.Source)
+
+	if store := remediations.Default(); store != nil {
+		pending, err := store.List(ctx, remediations.ListFilter{
+			TenantID:  f.TenantID,
+			FindingID: f.ID.Hex(),
+			Status:    remediations.StatusPending,
+			Limit:     1,
+		})
+		if err != nil {
+			log.Printf("[Notifiers] Warning: not offering a fix for finding %s: %v", f.ID.Hex(), err)
+		}
+		if len(pending) > 0 {
+			n.fact("Proposed fix", pending[0].Action)
+			n.Actions = append(n.Actions, notificationAction{
+				Label:   "Approve fix",
+				URL:     appURL("/risks", url.Values{"remediation": {pending[0].ID.Hex()}}),
+				Primary: true,
+			})
+		}
+	}
+	n.Actions = append(n.Actions, notificationAction{
+		Label: "Open in CloudLoom",
+		URL:   appURL("/risks", url.Values{"finding": {f.ID.Hex()}}),
+	})
+	return n
+}
+
+// remediationNotification describes a remediation that finished running
+func remediationNotification(remediation *remediations.Remediation) *notification {
+	n := &notification{
+		Title: fmt.Sprintf("Fixed %s %s", remediation.ResourceType, remediation.ResourceID),
+		Tone:  toneGood,
+	}
+	if remediation.Status == remediations.StatusFailed {
+		n.Title = fmt.Sprintf("Failed to fix %s %s", remediation.ResourceType, remediation.ResourceID)
+		n.Text, n.Tone = remediation.Error, toneAttention
+	} else if len(remediation.Changes) > 0 {
+		n.Text = strings.Join(remediation.Changes, "\n")
+	}
+	n.fact("Action", remediation.Action)
+	n.fact("Status", string(remediation.Status))
+	n.fact("Region", remediation.Region)
+	n.fact("Account", remediation.TenantID)
+	n.fact("Triggered", string(remediation.Trigger))
+	n.fact("Playbook", remediation.Playbook)
+	n.Actions = append(n.Actions, notificationAction{
+		Label: "Open in CloudLoom",
+		URL:   appURL("/risks", url.Values{"remediation": {remediation.ID.Hex()}}),
+	})
+	return n
+}
+
+// setupFailureNotification describes why setting up the tenant's account stopped
+func setupFailureNotification(tenantID string, setupErr error) *notification {
+	n := &notification{
+		Title: fmt.Sprintf("CloudLoom setup failed for account %s", tenantID),
+		Text:  setupErr.Error(),
+		Tone:  toneAttention,
+	}
+	n.fact("Account", tenantID)
+	n.Actions = append(n.Actions, notificationAction{Label: "Resume setup", URL: appURL("/setup", nil), Primary: true})
+	return n
+}
+
+// testNotification is posted when someone tests a notifier
+func testNotification(notifier *notifiers.Notifier) *notification {
+	n := &notification{
+		Title: "CloudLoom is connected",
+		Text:  fmt.Sprintf("This channel will be told about %s.", strings.Join(notifier.Events, ", ")),
+		Tone:  toneNeutral,
+	}
+	n.fact("Notifier", notifier.Name)
+	n.fact("Findings from", notifier.MinSeverity)
+	n.Actions = append(n.Actions, notificationAction{Label: "Open in CloudLoom", URL: appURL("/dashboard", nil)})
+	return n
+}
+
+func severityTone(severity string) string {
+	switch severity {
+	case "critical", "high":
+		return toneAttention
+	case "medium":
+		return toneWarning
+	}
+	return toneNeutral
+}
+
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// truncate shortens s to at most limit bytes, marking the cut
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit-3] + "..."
+}
+
+// render formats the message for the chat service's incoming webhooks
+func (n *notification) render(kind notifiers.Type) interface{} {
+	if kind == notifiers.TypeTeams {
+		return n.teams()
+	}
+	return n.slack()
+}
+
+// slackEmoji prefixes the title of a Slack message with its tone
+var slackEmoji = map[string]string{
+	toneAttention: ":rotating_light: ",
+	toneWarning:   ":warning: ",
+	toneGood:      ":white_check_mark: ",
+	toneNeutral:   "",
+}
+
+// slack renders the message as Block Kit, within Slack's limits of 150 characters a header,
+// 3000 a section and 10 fields
+func (n *notification) slack() map[string]interface{} {
+	title := truncate(slackEmoji[n.Tone]+n.Title, 150)
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]interface{}{"type": "plain_text", "text": title, "emoji": true}},
+	}
+	if n.Text != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": truncate(slackEscape(n.Text), 3000)},
+		})
+	}
+	if len(n.Facts) > 0 {
+		fields := []map[string]string{}
+		for _, fact := range n.Facts[:min(len(n.Facts), 10)] {
+			fields = append(fields, map[string]string{
+				"type": "mrkdwn",
+				"text": truncate(fmt.Sprintf("*%s*\n%s", fact.Name, slackEscape(fact.Value)), 2000),
+			})
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+	if len(n.Actions) > 0 {
+		buttons := []map[string]interface{}{}
+		for _, action := range n.Actions {
+			button := map[string]interface{}{
+				"type": "button",
+				"text": map[string]string{"type": "plain_text", "text": action.Label},
+				"url":  action.URL,
+			}
+			if action.Primary {
+				button["style"] = "primary"
+			}
+			buttons = append(buttons, button)
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": buttons})
+	}
+	// text is what notifications and clients without blocks show
+	return map[string]interface{}{"text": title, "blocks": blocks}
+}
+
+// slackEscape escapes the characters Slack's mrkdwn treats as markup
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// teamsColor is the Adaptive Card color of the title for each tone
+var teamsColor = map[string]string{
+	toneAttention: "Attention",
+	toneWarning:   "Warning",
+	toneGood:      "Good",
+	toneNeutral:   "Default",
+}
+
+// teams renders the message as an Adaptive Card, which both Office 365 connectors and
+// Power Automate workflows accept
+func (n *notification) teams() map[string]interface{} {
+	body := []map[string]interface{}{
+		{"type": "TextBlock", "text": n.Title, "size": "Large", "weight": "Bolder", "wrap": true, "color": teamsColor[n.Tone]},
+	}
+	if n.Text != "" {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": truncate(n.Text, 3000), "wrap": true})
+	}
+	if len(n.Facts) > 0 {
+		facts := []map[string]string{}
+		for _, fact := range n.Facts {
+			facts = append(facts, map[string]string{"title": fact.Name, "value": fact.Value})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+	actions := []map[string]interface{}{}
+	for _, action := range n.Actions {
+		button := map[string]interface{}{"type": "Action.OpenUrl", "title": action.Label, "url": action.URL}
+		if action.Primary {
+			button["style"] = "positive"
+		}
+		actions = append(actions, button)
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"msteams": map[string]string{"width": "Full"},
+				"body":    body,
+				"actions": actions,
+			},
+		}},
+	}
+}
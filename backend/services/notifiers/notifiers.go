@@ -0,0 +1,295 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionNotifiers
+
+var (
+	// ErrNotFound is returned when a notifier does not exist for the tenant
+	ErrNotFound = errors.New("notifier not found")
+	// ErrExists is returned when the tenant already has a notifier with the name
+	ErrExists = errors.New("notifier already exists")
+	// ErrInvalid is returned for a notifier with an unknown type, event or severity, or a
+	// webhook URL its chat service does not issue
+	ErrInvalid = errors.New("invalid notifier")
+)
+
+// Type is the chat service a notifier posts to through an incoming webhook
+type Type string
+
+const (
+	TypeSlack Type = "slack"
+	TypeTeams Type = "teams"
+)
+
+// Events a notifier can be told about
+const (
+	// EventFindingCreated is a finding at or above the notifier's severity threshold that is
+	// new or has reappeared
+	EventFindingCreated = "finding.created"
+	// EventRemediationCompleted is a remediation that finished running, fixed or failed
+	EventRemediationCompleted = "remediation.completed"
+	// EventSetupFailed is an account setup that stopped on an error
+	EventSetupFailed = "setup.failed"
+	// EventTest is sent when someone tests the notifier, whatever it is told about
+	EventTest = "test"
+)
+
+// Events are the events a notifier can be told about
+var Events = []string{EventFindingCreated, EventRemediationCompleted, EventSetupFailed}
+
+// severities are the finding severities, lowest first
+var severities = []string{"informational", "low", "medium", "high", "critical"}
+
+// DefaultMinSeverity is the threshold of a notifier created without one
+const DefaultMinSeverity = "high"
+
+// Outcome of the last message posted by a notifier
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Notifier posts formatted messages about the tenant's findings, remediations and setup to a
+// Slack or Microsoft Teams channel. Its incoming webhook URL grants anyone who has it the
+// right to post, so it is kept in the secret store; only its host is stored here.
+type Notifier struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID string             `bson:"tenantId" json:"tenantId"`
+	Name     string             `bson:"name" json:"name"`
+	Type     Type               `bson:"type" json:"type"`
+	// Host is the host of the webhook URL, enough to tell notifiers apart
+	Host string `bson:"host" json:"host"`
+	// Events are the events posted; none means all of them
+	Events []string `bson:"events" json:"events"`
+	// MinSeverity is the lowest severity of the findings posted
+	MinSeverity string `bson:"minSeverity" json:"minSeverity"`
+	Enabled     bool   `bson:"enabled" json:"enabled"`
+	// LastDeliveryAt, LastDelivery and LastError describe the last attempt to post a message
+	LastDeliveryAt *time.Time `bson:"lastDeliveryAt,omitempty" json:"lastDeliveryAt,omitempty"`
+	LastDelivery   string     `bson:"lastDelivery,omitempty" json:"lastDelivery,omitempty"`
+	LastError      string     `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt      time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Validate checks the name, type, events and severity threshold, telling a notifier without
+// events about all of them and defaulting its threshold
+func (n *Notifier) Validate() error {
+	n.Name = strings.TrimSpace(n.Name)
+	if n.Name == "" {
+		return fmt.Errorf("%w: a name is required", ErrInvalid)
+	}
+	if n.Type != TypeSlack && n.Type != TypeTeams {
+		return fmt.Errorf("%w: type must be %s or %s", ErrInvalid, TypeSlack, TypeTeams)
+	}
+	if len(n.Events) == 0 {
+		n.Events = append([]string(nil), Events...)
+	}
+	for _, event := range n.Events {
+		if !contains(Events, event) {
+			return fmt.Errorf("%w: unknown event '%s'", ErrInvalid, event)
+		}
+	}
+	if n.MinSeverity == "" {
+		n.MinSeverity = DefaultMinSeverity
+	}
+	if SeverityRank(n.MinSeverity) < 0 {
+		return fmt.Errorf("%w: unknown severity '%s'", ErrInvalid, n.MinSeverity)
+	}
+	return nil
+}
+
+// WebhookHost checks the URL is an incoming webhook of the notifier's chat service and returns
+// its host: hooks.slack.com for Slack, and an Office 365 connector or a Power Automate
+// workflow for Teams
+func (n *Notifier) WebhookHost(webhookURL string) (string, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", fmt.Errorf("%w: the webhook URL is not an HTTPS URL", ErrInvalid)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if err := common.CheckPublicHost(host); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	switch n.Type {
+	case TypeSlack:
+		if host == "hooks.slack.com" {
+			return host, nil
+		}
+	case TypeTeams:
+		if strings.HasSuffix(host, ".webhook.office.com") || strings.HasSuffix(host, ".logic.azure.com") ||
+			strings.HasSuffix(host, ".powerplatform.com") {
+			return host, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is not a %s incoming webhook", ErrInvalid, host, n.Type)
+}
+
+// Notifies reports whether the notifier is enabled and told about the event. Findings must
+// also be at or above its severity threshold; other events have no severity.
+func (n *Notifier) Notifies(event, severity string) bool {
+	if !n.Enabled || !contains(n.Events, event) {
+		return false
+	}
+	return severity == "" || SeverityRank(severity) >= SeverityRank(n.MinSeverity)
+}
+
+// SeverityRank orders finding severities from informational (0) to critical, -1 when unknown
+func SeverityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists per-tenant notifiers in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide notifier store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide notifier store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the notifiers collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create validates and stores a new notifier for the tenant
+func (s *Store) Create(ctx context.Context, notifier *Notifier) error {
+	if err := notifier.Validate(); err != nil {
+		return err
+	}
+	notifier.ID = primitive.NewObjectID()
+	notifier.CreatedAt = time.Now()
+	notifier.UpdatedAt = notifier.CreatedAt
+	_, err := s.collection.InsertOne(ctx, notifier)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, notifier.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create notifier: %w", err)
+	}
+	return nil
+}
+
+// List returns the tenant's notifiers, oldest first
+func (s *Store) List(ctx context.Context, tenantID string) ([]Notifier, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"tenantId": tenantID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifiers: %w", err)
+	}
+	result := []Notifier{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode notifiers: %w", err)
+	}
+	return result, nil
+}
+
+// Get returns one of the tenant's notifiers
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Notifier, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var notifier Notifier
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&notifier)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notifier: %w", err)
+	}
+	return &notifier, nil
+}
+
+// Update validates and saves the notifier's name, webhook host, events, threshold and whether
+// it is enabled. Its type cannot change.
+func (s *Store) Update(ctx context.Context, notifier *Notifier) error {
+	if err := notifier.Validate(); err != nil {
+		return err
+	}
+	notifier.UpdatedAt = time.Now()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": notifier.ID, "tenantId": notifier.TenantID, "type": notifier.Type},
+		bson.M{"$set": bson.M{
+			"name":        notifier.Name,
+			"host":        notifier.Host,
+			"events":      notifier.Events,
+			"minSeverity": notifier.MinSeverity,
+			"enabled":     notifier.Enabled,
+			"updatedAt":   notifier.UpdatedAt,
+		}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, notifier.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update notifier: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordDelivery saves the outcome of an attempt to post a message. A nil deliveryErr records
+// it as delivered.
+func (s *Store) RecordDelivery(ctx context.Context, tenantID string, id primitive.ObjectID, at time.Time, deliveryErr error) error {
+	set := bson.M{"lastDeliveryAt": at, "lastDelivery": DeliveryDelivered, "lastError": ""}
+	if deliveryErr != nil {
+		set["lastDelivery"], set["lastError"] = DeliveryFailed, deliveryErr.Error()
+	}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "tenantId": tenantID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to record notifier delivery: %w", err)
+	}
+	return nil
+}
+
+// Delete removes one of the tenant's notifiers
+func (s *Store) Delete(ctx context.Context, tenantID string, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete notifier: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
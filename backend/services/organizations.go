@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/orgonboarding"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// DefaultMemberRoleName is the role assumed in member accounts when an onboarding names none.
+// It is the role the CloudLoom StackSet template deploys.
+const DefaultMemberRoleName = "CloudLoomAutoApplyFixRole"
+
+// OrgOnboardingOptions controls how member accounts are onboarded
+type OrgOnboardingOptions struct {
+	Mode           orgonboarding.Mode
+	MemberRoleName string
+	// ExternalID, Region and Regions apply to every member account
+	ExternalID  string
+	Region      string
+	Regions     []string
+	RequestedBy string
+}
+
+// OrganizationsService onboards the member accounts of an AWS organization through the
+// management account's CloudLoom role
+type OrganizationsService struct {
+	management *CloudTrailService
+	tenantID   string
+}
+
+// NewOrganizationsService returns a service acting through the tenant's role, which must be
+// in the organization's management account or a delegated administrator
+func NewOrganizationsService(ctx context.Context, tenantID string) (*OrganizationsService, error) {
+	management, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &OrganizationsService{management: management, tenantID: tenantID}, nil
+}
+
+// ListMemberAccounts returns the organization's active accounts other than the management
+// account itself, which is onboarded through the usual setup
+func (o *OrganizationsService) ListMemberAccounts(ctx context.Context) ([]orgonboarding.Account, error) {
+	cfg, err := o.management.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume management account role: %w", err)
+	}
+	managementAccountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []orgonboarding.Account
+	paginator := organizations.NewListAccountsPaginator(organizations.NewFromConfig(cfg), &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organization accounts: %w", err)
+		}
+		for _, account := range page.Accounts {
+			id := aws.ToString(account.Id)
+			if account.Status != orgtypes.AccountStatusActive || id == managementAccountID {
+				continue
+			}
+			accounts = append(accounts, orgonboarding.Account{AccountID: id, Name: aws.ToString(account.Name)})
+		}
+	}
+	return accounts, nil
+}
+
+// Onboard starts setup in, or stages, every member account and records the onboarding so its
+// progress can be followed. Accounts whose setup cannot be started are recorded with the
+// reason instead of failing the whole onboarding.
+func (o *OrganizationsService) Onboard(ctx context.Context, opts OrgOnboardingOptions) (*orgonboarding.Onboarding, error) {
+	store, manager := orgonboarding.Default(), tenants.Default()
+	if store == nil || manager == nil {
+		return nil, fmt.Errorf("organization onboarding is not initialized")
+	}
+	if opts.Mode == "" {
+		opts.Mode = orgonboarding.ModeSetup
+	}
+	if opts.Mode == orgonboarding.ModeSetup && jobs.Default() == nil {
+		return nil, fmt.Errorf("job subsystem is not initialized")
+	}
+	if opts.MemberRoleName == "" {
+		opts.MemberRoleName = DefaultMemberRoleName
+	}
+
+	accounts, err := o.ListMemberAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	onboarding := &orgonboarding.Onboarding{
+		TenantID:       o.tenantID,
+		Mode:           opts.Mode,
+		MemberRoleName: opts.MemberRoleName,
+		Accounts:       []orgonboarding.Account{},
+		RequestedBy:    opts.RequestedBy,
+	}
+	for _, account := range accounts {
+		account.RoleArn = fmt.Sprintf("arn:aws:iam::%s:role/%s", account.AccountID, opts.MemberRoleName)
+		tenant := &tenants.Tenant{
+			AccountID:  account.AccountID,
+			RoleArn:    account.RoleArn,
+			ExternalID: opts.ExternalID,
+			Region:     opts.Region,
+			Regions:    opts.Regions,
+		}
+
+		switch opts.Mode {
+		case orgonboarding.ModeStage:
+			err = manager.Register(ctx, tenant)
+		default:
+			var job *jobs.Job
+			if job, err = EnqueueAccountSetup(ctx, tenant); err == nil {
+				account.JobID = job.ID.Hex()
+			}
+		}
+		if err != nil {
+			log.Printf("[Organizations] Warning: failed to onboard account %s: %v", account.AccountID, err)
+			account.Error = err.Error()
+		}
+		onboarding.Accounts = append(onboarding.Accounts, account)
+	}
+
+	if err := store.Create(ctx, onboarding); err != nil {
+		return nil, err
+	}
+	log.Printf("[Organizations] ✅ Started %s of %d member accounts for %s", onboarding.Mode, len(onboarding.Accounts), o.tenantID)
+	return onboarding, nil
+}
+
+// OrgAccountProgress is where one member account's onboarding stands
+type OrgAccountProgress struct {
+	orgonboarding.Account
+	// Status is the setup job's status in ModeSetup, otherwise the tenant's setup status
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// OrgOnboardingProgress summarizes an onboarding: each account's status and a count per status
+type OrgOnboardingProgress struct {
+	Onboarding *orgonboarding.Onboarding `json:"onboarding"`
+	Accounts   []OrgAccountProgress      `json:"accounts"`
+	Summary    map[string]int            `json:"summary"`
+}
+
+// GetOrgOnboardingProgress returns the onboarding's progress in each member account
+func GetOrgOnboardingProgress(ctx context.Context, tenantID, id string) (*OrgOnboardingProgress, error) {
+	store := orgonboarding.Default()
+	if store == nil {
+		return nil, fmt.Errorf("organization onboarding is not initialized")
+	}
+	onboarding, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &OrgOnboardingProgress{Onboarding: onboarding, Accounts: []OrgAccountProgress{}, Summary: map[string]int{}}
+	for _, account := range onboarding.Accounts {
+		entry := OrgAccountProgress{Account: account}
+		switch {
+		case account.Error != "":
+			entry.Status, entry.Detail = "not_started", account.Error
+		case account.JobID != "" && jobs.Default() != nil:
+			entry.Status, entry.Detail = accountJobStatus(ctx, account.JobID)
+		case tenants.Default() != nil:
+			entry.Status, entry.Detail = accountTenantStatus(ctx, account.AccountID)
+		default:
+			entry.Status = "unknown"
+		}
+		progress.Accounts = append(progress.Accounts, entry)
+		progress.Summary[entry.Status]++
+	}
+	return progress, nil
+}
+
+func accountJobStatus(ctx context.Context, jobID string) (string, string) {
+	job, err := jobs.Default().Get(ctx, jobID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return "unknown", "setup job no longer exists"
+	}
+	if err != nil {
+		return "unknown", err.Error()
+	}
+	return string(job.Status), job.Error
+}
+
+func accountTenantStatus(ctx context.Context, accountID string) (string, string) {
+	tenant, err := tenants.Default().Get(ctx, accountID)
+	if err != nil {
+		return "unknown", err.Error()
+	}
+	return string(tenant.SetupStatus), tenant.SetupError
+}
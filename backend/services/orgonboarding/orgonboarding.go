@@ -0,0 +1,122 @@
+package orgonboarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionOrgOnboardings
+
+// ErrNotFound is returned when an onboarding does not exist for the tenant
+var ErrNotFound = errors.New("organization onboarding not found")
+
+// Mode is what an onboarding does in each member account
+type Mode string
+
+const (
+	// ModeSetup runs account setup in every member account through its CloudLoom role
+	ModeSetup Mode = "setup"
+	// ModeStage only registers the member accounts as pending tenants, e.g. while the
+	// CloudLoom role is still being rolled out to them with a StackSet
+	ModeStage Mode = "stage"
+)
+
+// Account is one member account of an onboarding
+type Account struct {
+	AccountID string `bson:"accountId" json:"accountId"`
+	Name      string `bson:"name" json:"name"`
+	RoleArn   string `bson:"roleArn" json:"roleArn"`
+	// JobID is the account's setup job in ModeSetup
+	JobID string `bson:"jobId,omitempty" json:"jobId,omitempty"`
+	// Error says why the account could not be staged or its setup could not be started
+	Error string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Onboarding is one run of onboarding the member accounts of an AWS organization, started
+// from its management account
+type Onboarding struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// TenantID is the management account
+	TenantID       string    `bson:"tenantId" json:"tenantId"`
+	Mode           Mode      `bson:"mode" json:"mode"`
+	MemberRoleName string    `bson:"memberRoleName" json:"memberRoleName"`
+	Accounts       []Account `bson:"accounts" json:"accounts"`
+	RequestedBy    string    `bson:"requestedBy,omitempty" json:"requestedBy,omitempty"`
+	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Store persists organization onboardings in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide onboarding store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide onboarding store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the org_onboardings collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create saves a new onboarding
+func (s *Store) Create(ctx context.Context, onboarding *Onboarding) error {
+	onboarding.CreatedAt = time.Now()
+	res, err := s.collection.InsertOne(ctx, onboarding)
+	if err != nil {
+		return fmt.Errorf("failed to create organization onboarding: %w", err)
+	}
+	onboarding.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Get returns one of the tenant's onboardings
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Onboarding, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var onboarding Onboarding
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&onboarding)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load organization onboarding: %w", err)
+	}
+	return &onboarding, nil
+}
+
+// List returns the tenant's onboardings, newest first
+func (s *Store) List(ctx context.Context, tenantID string) ([]Onboarding, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(50)
+	cursor, err := s.collection.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization onboardings: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Onboarding{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode organization onboardings: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// Permission is one IAM action a flow performs against one resource
+type Permission struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+}
+
+func (p Permission) String() string {
+	if p.Resource == "*" {
+		return p.Action
+	}
+	return p.Action + " on " + p.Resource
+}
+
+// MissingPermissionsError lists the permissions a policy simulation denied to a role
+type MissingPermissionsError struct {
+	RoleArn string       `json:"roleArn"`
+	Missing []Permission `json:"missing"`
+}
+
+func (e *MissingPermissionsError) Error() string {
+	missing := make([]string, 0, len(e.Missing))
+	for _, p := range e.Missing {
+		missing = append(missing, p.String())
+	}
+	return fmt.Sprintf("role %s missing %s", e.RoleArn, strings.Join(missing, ", "))
+}
+
+// ErrSimulationNotAllowed is returned when the role may not run iam:SimulatePrincipalPolicy
+// against itself, so its permissions cannot be checked up front
+var ErrSimulationNotAllowed = errors.New("role may not simulate its own policies")
+
+// PermissionCheck is the simulated decision for one required permission
+type PermissionCheck struct {
+	Permission
+	Allowed bool `json:"allowed"`
+	// Decision is the simulation's decision: allowed, explicitDeny or implicitDeny
+	Decision string `json:"decision"`
+}
+
+// EvaluateRolePermissions runs iam:SimulatePrincipalPolicy for the role against every
+// required permission and returns the decision for each, in the order given. It fails with
+// ErrSimulationNotAllowed when the role may not simulate its own policies.
+func EvaluateRolePermissions(ctx context.Context, cfg aws.Config, roleArn string, required []Permission) ([]PermissionCheck, error) {
+	// The simulation evaluates every action against every resource, so group by resource
+	var resources []string
+	actions := map[string][]string{}
+	for _, p := range required {
+		if _, ok := actions[p.Resource]; !ok {
+			resources = append(resources, p.Resource)
+		}
+		actions[p.Resource] = append(actions[p.Resource], p.Action)
+	}
+
+	client := iam.NewFromConfig(cfg)
+	decisions := map[Permission]iamtypes.PolicyEvaluationDecisionType{}
+	for _, resource := range resources {
+		paginator := iam.NewSimulatePrincipalPolicyPaginator(client, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(roleArn),
+			ActionNames:     actions[resource],
+			ResourceArns:    []string{resource},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				var apiErr smithy.APIError
+				if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+					return nil, ErrSimulationNotAllowed
+				}
+				return nil, fmt.Errorf("failed to simulate permissions for %s: %w", roleArn, err)
+			}
+			for _, result := range page.EvaluationResults {
+				decisions[Permission{Action: aws.ToString(result.EvalActionName), Resource: resource}] = result.EvalDecision
+			}
+		}
+	}
+
+	checks := make([]PermissionCheck, 0, len(required))
+	for _, p := range required {
+		decision := decisions[p]
+		checks = append(checks, PermissionCheck{
+			Permission: p,
+			Allowed:    decision == iamtypes.PolicyEvaluationDecisionTypeAllowed,
+			Decision:   string(decision),
+		})
+	}
+	return checks, nil
+}
+
+// SimulateRolePermissions simulates every required permission for the role and returns a
+// *MissingPermissionsError naming the ones it denies, so a flow can fail before it changes
+// anything instead of halfway through.
+// When the simulation itself is not allowed the check is skipped with a warning.
+func SimulateRolePermissions(ctx context.Context, cfg aws.Config, roleArn string, required []Permission) error {
+	checks, err := EvaluateRolePermissions(ctx, cfg, roleArn, required)
+	if errors.Is(err, ErrSimulationNotAllowed) {
+		log.Printf("[Permissions] ⚠️ Role %s may not simulate its own policies, skipping permission check", roleArn)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var missing []Permission
+	for _, check := range checks {
+		if !check.Allowed {
+			missing = append(missing, check.Permission)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingPermissionsError{RoleArn: roleArn, Missing: missing}
+	}
+	log.Printf("[Permissions] ✅ Role %s is allowed all %d required actions", roleArn, len(required))
+	return nil
+}
+
+// setupPermissions lists what SetupCloudTrail does in the customer account for the access
+// tier. Less is needed when the customer's existing trail or bucket is reused.
+func setupPermissions(accountID, region string, names setupNames, tier tenants.AccessTier) []Permission {
+	bucketArn := "arn:aws:s3:::" + names.bucket
+	logGroupArn := fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s:*", region, accountID, names.logGroup)
+	trailArn := fmt.Sprintf("arn:aws:cloudtrail:%s:%s:trail/%s", region, accountID, names.trail)
+	queueArn := fmt.Sprintf("arn:aws:sqs:%s:%s:%s", region, accountID, names.queue)
+	deadLetterQueueArn := deadLetterQueueName(queueArn)
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", region, accountID, names.topic)
+	trailRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/CloudLoom-CloudTrail-Role-%s", accountID, accountID)
+	eventsRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/CloudLoom-Events-Role-%s", accountID, accountID)
+
+	required := []Permission{
+		{Action: "sns:CreateTopic", Resource: topicArn},
+		{Action: "sns:SetTopicAttributes", Resource: topicArn},
+		{Action: "sns:Subscribe", Resource: topicArn},
+		{Action: "ec2:DescribeRegions", Resource: "*"},
+		{Action: "tag:GetResources", Resource: "*"},
+		{Action: "tag:TagResources", Resource: "*"},
+		{Action: "sns:TagResource", Resource: topicArn},
+	}
+	switch {
+	case names.existingBucket:
+		// Setup only adds its delivery statements to the customer's bucket policy
+		required = append(required,
+			Permission{Action: "s3:ListBucket", Resource: bucketArn},
+			Permission{Action: "s3:GetBucketPolicy", Resource: bucketArn},
+			Permission{Action: "s3:PutBucketPolicy", Resource: bucketArn},
+		)
+	case !names.existingTrail:
+		required = append(required,
+			Permission{Action: "s3:CreateBucket", Resource: bucketArn},
+			Permission{Action: "s3:ListBucket", Resource: bucketArn},
+			Permission{Action: "s3:PutBucketPolicy", Resource: bucketArn},
+			Permission{Action: "s3:GetLifecycleConfiguration", Resource: bucketArn},
+			Permission{Action: "s3:PutLifecycleConfiguration", Resource: bucketArn},
+			Permission{Action: "s3:PutBucketTagging", Resource: bucketArn},
+		)
+	}
+	if names.existingTrail {
+		required = append(required,
+			Permission{Action: "cloudtrail:DescribeTrails", Resource: "*"},
+			Permission{Action: "cloudtrail:GetTrailStatus", Resource: names.trail},
+			Permission{Action: "cloudtrail:GetEventSelectors", Resource: names.trail},
+			Permission{Action: "cloudtrail:StartLogging", Resource: names.trail},
+			Permission{Action: "cloudtrail:PutEventSelectors", Resource: names.trail},
+			Permission{Action: "cloudtrail:GetInsightSelectors", Resource: names.trail},
+			Permission{Action: "cloudtrail:PutInsightSelectors", Resource: names.trail},
+		)
+	} else {
+		required = append(required,
+			Permission{Action: "logs:CreateLogGroup", Resource: logGroupArn},
+			Permission{Action: "logs:DescribeLogGroups", Resource: "*"},
+			Permission{Action: "logs:PutResourcePolicy", Resource: "*"},
+			Permission{Action: "logs:PutRetentionPolicy", Resource: logGroupArn},
+			Permission{Action: "logs:DeleteRetentionPolicy", Resource: logGroupArn},
+			Permission{Action: "logs:TagResource", Resource: logGroupArn},
+			Permission{Action: "iam:GetRole", Resource: trailRoleArn},
+			Permission{Action: "iam:CreateRole", Resource: trailRoleArn},
+			Permission{Action: "iam:PutRolePolicy", Resource: trailRoleArn},
+			Permission{Action: "iam:ListAttachedRolePolicies", Resource: trailRoleArn},
+			Permission{Action: "iam:DetachRolePolicy", Resource: trailRoleArn},
+			Permission{Action: "iam:PassRole", Resource: trailRoleArn},
+			Permission{Action: "iam:TagRole", Resource: trailRoleArn},
+			Permission{Action: "cloudtrail:DescribeTrails", Resource: "*"},
+			Permission{Action: "cloudtrail:CreateTrail", Resource: trailArn},
+			Permission{Action: "cloudtrail:UpdateTrail", Resource: trailArn},
+			Permission{Action: "cloudtrail:PutEventSelectors", Resource: trailArn},
+			Permission{Action: "cloudtrail:PutInsightSelectors", Resource: trailArn},
+			Permission{Action: "cloudtrail:StartLogging", Resource: trailArn},
+			Permission{Action: "cloudtrail:AddTags", Resource: trailArn},
+		)
+	}
+	if tier.Analyzes() {
+		required = append(required,
+			Permission{Action: "sqs:CreateQueue", Resource: queueArn},
+			Permission{Action: "sqs:GetQueueUrl", Resource: queueArn},
+			Permission{Action: "sqs:GetQueueAttributes", Resource: queueArn},
+			Permission{Action: "sqs:SetQueueAttributes", Resource: queueArn},
+			Permission{Action: "sqs:ReceiveMessage", Resource: queueArn},
+			Permission{Action: "sqs:DeleteMessage", Resource: queueArn},
+			// Messages still being processed are kept hidden from other receivers
+			Permission{Action: "sqs:ChangeMessageVisibility", Resource: queueArn},
+			Permission{Action: "sqs:TagQueue", Resource: queueArn},
+			// Dead letters are redriven by sending them to the queue again
+			Permission{Action: "sqs:SendMessage", Resource: queueArn},
+			Permission{Action: "sqs:CreateQueue", Resource: deadLetterQueueArn},
+			Permission{Action: "sqs:GetQueueUrl", Resource: deadLetterQueueArn},
+			Permission{Action: "sqs:GetQueueAttributes", Resource: deadLetterQueueArn},
+			Permission{Action: "sqs:ReceiveMessage", Resource: deadLetterQueueArn},
+			Permission{Action: "sqs:DeleteMessage", Resource: deadLetterQueueArn},
+			Permission{Action: "sqs:TagQueue", Resource: deadLetterQueueArn},
+			Permission{Action: "iam:GetRole", Resource: eventsRoleArn},
+			Permission{Action: "iam:CreateRole", Resource: eventsRoleArn},
+			Permission{Action: "iam:PutRolePolicy", Resource: eventsRoleArn},
+			Permission{Action: "iam:PassRole", Resource: eventsRoleArn},
+			Permission{Action: "iam:TagRole", Resource: eventsRoleArn},
+			Permission{Action: "guardduty:ListDetectors", Resource: "*"},
+			Permission{Action: "guardduty:CreateDetector", Resource: "*"},
+		)
+	}
+	if tier.AppliesFixes() {
+		required = append(required, remediationPermissions(accountID)...)
+	}
+	if names.allRegions {
+		required = append(required, Permission{Action: "account:ListRegions", Resource: "*"})
+	}
+	for _, r := range names.regions {
+		ruleArn := fmt.Sprintf("arn:aws:events:%s:%s:rule/%s", r, accountID, names.rules[r])
+		required = append(required,
+			Permission{Action: "events:DescribeRule", Resource: ruleArn},
+			Permission{Action: "events:PutRule", Resource: ruleArn},
+			Permission{Action: "events:ListTargetsByRule", Resource: ruleArn},
+			Permission{Action: "events:PutTargets", Resource: ruleArn},
+			Permission{Action: "events:TagResource", Resource: ruleArn},
+		)
+		if tier.Analyzes() {
+			detectorArn := fmt.Sprintf("arn:aws:guardduty:%s:%s:detector/*", r, accountID)
+			required = append(required,
+				Permission{Action: "guardduty:GetDetector", Resource: detectorArn},
+				Permission{Action: "guardduty:UpdateDetector", Resource: detectorArn},
+				Permission{Action: "guardduty:GetFindings", Resource: detectorArn},
+				Permission{Action: "guardduty:TagResource", Resource: detectorArn},
+			)
+		} else {
+			required = append(required, Permission{Action: "events:RemoveTargets", Resource: ruleArn})
+		}
+	}
+	if names.replicationRegion != "" {
+		replicaArn := "arn:aws:s3:::" + replicaBucketName(accountID, names.replicationRegion)
+		replicationRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, replicationRoleName(accountID))
+		required = append(required,
+			Permission{Action: "s3:PutBucketVersioning", Resource: bucketArn},
+			Permission{Action: "s3:PutReplicationConfiguration", Resource: bucketArn},
+			Permission{Action: "s3:CreateBucket", Resource: replicaArn},
+			Permission{Action: "s3:ListBucket", Resource: replicaArn},
+			Permission{Action: "s3:PutBucketVersioning", Resource: replicaArn},
+			Permission{Action: "s3:PutBucketPublicAccessBlock", Resource: replicaArn},
+			Permission{Action: "s3:PutEncryptionConfiguration", Resource: replicaArn},
+			Permission{Action: "s3:PutBucketTagging", Resource: replicaArn},
+			Permission{Action: "iam:GetRole", Resource: replicationRoleArn},
+			Permission{Action: "iam:CreateRole", Resource: replicationRoleArn},
+			Permission{Action: "iam:PutRolePolicy", Resource: replicationRoleArn},
+			Permission{Action: "iam:PassRole", Resource: replicationRoleArn},
+			Permission{Action: "iam:TagRole", Resource: replicationRoleArn},
+		)
+	}
+	if names.kmsKey != "" && !names.existingTrail {
+		keyArn := names.kmsKey
+		if strings.HasPrefix(names.kmsKey, "alias/") {
+			// Setup creates the key, whose ID is not known yet
+			keyArn = fmt.Sprintf("arn:aws:kms:%s:%s:key/*", region, accountID)
+			required = append(required,
+				Permission{Action: "kms:CreateKey", Resource: "*"},
+				Permission{Action: "kms:CreateAlias", Resource: fmt.Sprintf("arn:aws:kms:%s:%s:%s", region, accountID, names.kmsKey)},
+				Permission{Action: "kms:CreateAlias", Resource: keyArn},
+				Permission{Action: "kms:EnableKeyRotation", Resource: keyArn},
+				Permission{Action: "kms:TagResource", Resource: keyArn},
+			)
+		}
+		required = append(required,
+			Permission{Action: "kms:DescribeKey", Resource: keyArn},
+			Permission{Action: "kms:GetKeyPolicy", Resource: keyArn},
+			Permission{Action: "kms:PutKeyPolicy", Resource: keyArn},
+		)
+		if !names.existingBucket {
+			required = append(required, Permission{Action: "s3:PutEncryptionConfiguration", Resource: bucketArn})
+		}
+	}
+	return required
+}
+
+// remediationPermissions lists what the auto-apply fix playbooks and remediation actions may do
+// in any part of the customer account, which only the auto-apply fix tier's role grants
+func remediationPermissions(accountID string) []Permission {
+	required := keyRotationPermissions(accountID, "", KeyRotationRequest{UserName: "*"})
+	return append(required, DefaultRemediationEngine().Permissions(accountID)...)
+}
+
+// configPermissions lists what creating and managing the AWS Config recorder and delivery
+// channel does in the customer account
+func configPermissions(accountID string) []Permission {
+	configRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/CloudLoom-Config-ServiceRole", accountID)
+	return []Permission{
+		{Action: "config:DescribeConfigurationRecorders", Resource: "*"},
+		{Action: "config:PutConfigurationRecorder", Resource: "*"},
+		{Action: "config:PutDeliveryChannel", Resource: "*"},
+		{Action: "config:StartConfigurationRecorder", Resource: "*"},
+		{Action: "config:DescribeConfigRules", Resource: "*"},
+		{Action: "config:PutConfigRule", Resource: "*"},
+		{Action: "config:TagResource", Resource: "*"},
+		{Action: "config:PutConfigurationAggregator", Resource: "*"},
+		{Action: "organizations:DescribeOrganization", Resource: "*"},
+		{Action: "iam:GetRole", Resource: configRoleArn},
+		{Action: "iam:CreateRole", Resource: configRoleArn},
+		{Action: "iam:AttachRolePolicy", Resource: configRoleArn},
+		{Action: "iam:ListAttachedRolePolicies", Resource: configRoleArn},
+		{Action: "iam:DetachRolePolicy", Resource: configRoleArn},
+		{Action: "iam:PutRolePolicy", Resource: configRoleArn},
+		{Action: "iam:TagRole", Resource: configRoleArn},
+		{Action: "iam:PassRole", Resource: configRoleArn},
+	}
+}
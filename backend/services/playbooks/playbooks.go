@@ -0,0 +1,444 @@
+package playbooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+const collectionName = config.CollectionPlaybooks
+
+// MaxSourceSize caps the size of a playbook's YAML
+const MaxSourceSize = 64 * 1024
+
+var (
+	// ErrNotFound is returned when a playbook does not exist for the tenant
+	ErrNotFound = errors.New("playbook not found")
+	// ErrExists is returned when the tenant already has a playbook with the name
+	ErrExists = errors.New("playbook already exists")
+	// ErrInvalid is returned for YAML that is not a valid playbook
+	ErrInvalid = errors.New("invalid playbook")
+)
+
+var (
+	namePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+	clockPattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+)
+
+// severities are the finding severities a playbook may match
+var severities = []string{"informational", "low", "medium", "high", "critical"}
+
+// weekdays are the day names business hours accept, in time.Weekday order
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Playbook maps findings that match its conditions to ordered remediation and notification
+// steps. Tenants write playbooks in YAML; the parsed form is stored with the source.
+type Playbook struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id" yaml:"-"`
+	TenantID    string             `bson:"tenantId" json:"tenantId" yaml:"-"`
+	Name        string             `bson:"name" json:"name" yaml:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty" yaml:"description"`
+	// Enabled playbooks run for new and reopened findings; it defaults to true
+	Enabled *bool `bson:"enabled" json:"enabled" yaml:"enabled"`
+	// Priority orders the playbooks, lowest first. Only the first playbook that matches a
+	// finding runs.
+	Priority int    `bson:"priority" json:"priority" yaml:"priority"`
+	Match    Match  `bson:"match" json:"match" yaml:"match"`
+	Guards   Guards `bson:"guards" json:"guards" yaml:"guards"`
+	Steps    []Step `bson:"steps" json:"steps" yaml:"steps"`
+	// Source is the YAML the playbook was parsed from
+	Source    string    `bson:"source" json:"source" yaml:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt" yaml:"-"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt" yaml:"-"`
+}
+
+// Match is the findings a playbook runs for. Every condition that is set must hold; a value
+// matches case-insensitively.
+type Match struct {
+	// Sources are finding sources such as exposure, securityhub or guardduty
+	Sources []string `bson:"sources,omitempty" json:"sources,omitempty" yaml:"sources"`
+	// Types are finding types, the rule IDs the remediation actions are chosen by
+	Types      []string `bson:"types,omitempty" json:"types,omitempty" yaml:"types"`
+	Severities []string `bson:"severities,omitempty" json:"severities,omitempty" yaml:"severities"`
+	// Tags the finding's resource must have; a value of * matches any value
+	Tags map[string]string `bson:"tags,omitempty" json:"tags,omitempty" yaml:"tags"`
+}
+
+// Guards decide whether a matching playbook may change anything without approval. When a
+// guard does not hold, the playbook's remediation steps are proposed for approval instead.
+type Guards struct {
+	BusinessHours *BusinessHours `bson:"businessHours,omitempty" json:"businessHours,omitempty" yaml:"businessHours"`
+	// ExcludeTags keeps resources with any of these tags, such as env: prod, from automatic
+	// changes; a value of * matches any value
+	ExcludeTags map[string]string `bson:"excludeTags,omitempty" json:"excludeTags,omitempty" yaml:"excludeTags"`
+}
+
+// BusinessHours limits automatic changes to working hours, when someone is around to notice
+// a fix that breaks something
+type BusinessHours struct {
+	// Timezone is an IANA time zone name; it defaults to UTC
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty" yaml:"timezone"`
+	// Start and End are HH:MM in the time zone; they default to 09:00 and 17:00
+	Start string `bson:"start,omitempty" json:"start,omitempty" yaml:"start"`
+	End   string `bson:"end,omitempty" json:"end,omitempty" yaml:"end"`
+	// Days are mon, tue, ...; they default to Monday to Friday
+	Days []string `bson:"days,omitempty" json:"days,omitempty" yaml:"days"`
+
+	location *time.Location
+}
+
+// Step is one remediation action or notification. Steps run in order, and a failed step
+// stops the playbook unless it continues on failure.
+type Step struct {
+	Name string `bson:"name,omitempty" json:"name,omitempty" yaml:"name"`
+	// Action is the remediation action to run on the finding's resource
+	Action string `bson:"action,omitempty" json:"action,omitempty" yaml:"action"`
+	// Parameters are passed to the action; each action lists the ones it accepts
+	Parameters        map[string]string `bson:"parameters,omitempty" json:"parameters,omitempty" yaml:"parameters"`
+	Notify            *Notify           `bson:"notify,omitempty" json:"notify,omitempty" yaml:"notify"`
+	ContinueOnFailure bool              `bson:"continueOnFailure,omitempty" json:"continueOnFailure,omitempty" yaml:"continueOnFailure"`
+}
+
+// Notify sends a message about the finding and the steps before it. Subject and message are
+// Go templates.
+type Notify struct {
+	Subject string `bson:"subject" json:"subject" yaml:"subject"`
+	Message string `bson:"message" json:"message" yaml:"message"`
+	// Emails are sent the message directly; without any it is published to the tenant's
+	// notification topic
+	Emails []string `bson:"emails,omitempty" json:"emails,omitempty" yaml:"emails"`
+}
+
+// Parse reads and validates a playbook's YAML. Unknown fields are rejected so a misspelt
+// guard does not silently let everything through.
+func Parse(source []byte) (*Playbook, error) {
+	if len(source) > MaxSourceSize {
+		return nil, fmt.Errorf("%w: playbooks are limited to %d bytes", ErrInvalid, MaxSourceSize)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	decoder.KnownFields(true)
+	var playbook Playbook
+	if err := decoder.Decode(&playbook); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	playbook.Source = string(source)
+	if err := playbook.Normalize(); err != nil {
+		return nil, err
+	}
+	return &playbook, nil
+}
+
+// Normalize validates the playbook and fills in its defaults
+func (p *Playbook) Normalize() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("%w: name must be lowercase letters, digits and dashes", ErrInvalid)
+	}
+	if p.Enabled == nil {
+		enabled := true
+		p.Enabled = &enabled
+	}
+	for i, severity := range p.Match.Severities {
+		p.Match.Severities[i] = strings.ToLower(severity)
+		if !containsString(severities, p.Match.Severities[i]) {
+			return fmt.Errorf("%w: unknown severity '%s'", ErrInvalid, severity)
+		}
+	}
+	if len(p.Match.Sources) == 0 && len(p.Match.Types) == 0 && len(p.Match.Severities) == 0 && len(p.Match.Tags) == 0 {
+		return fmt.Errorf("%w: match needs at least one condition", ErrInvalid)
+	}
+	if hours := p.Guards.BusinessHours; hours != nil {
+		if err := hours.normalize(); err != nil {
+			return err
+		}
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("%w: at least one step is required", ErrInvalid)
+	}
+	for i := range p.Steps {
+		if err := p.Steps[i].validate(); err != nil {
+			return fmt.Errorf("%w: step %d: %v", ErrInvalid, i+1, err)
+		}
+	}
+	return nil
+}
+
+// IsEnabled reports whether the playbook runs for new and reopened findings
+func (p *Playbook) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+func (h *BusinessHours) normalize() error {
+	if h.Timezone == "" {
+		h.Timezone = "UTC"
+	}
+	location, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: unknown time zone '%s'", ErrInvalid, h.Timezone)
+	}
+	h.location = location
+	if h.Start == "" {
+		h.Start = "09:00"
+	}
+	if h.End == "" {
+		h.End = "17:00"
+	}
+	if !clockPattern.MatchString(h.Start) || !clockPattern.MatchString(h.End) || h.Start >= h.End {
+		return fmt.Errorf("%w: business hours must be HH:MM with start before end", ErrInvalid)
+	}
+	if len(h.Days) == 0 {
+		h.Days = []string{"mon", "tue", "wed", "thu", "fri"}
+	}
+	for i, day := range h.Days {
+		h.Days[i] = strings.ToLower(day)
+		if !containsString(weekdays, h.Days[i]) {
+			return fmt.Errorf("%w: unknown day '%s'", ErrInvalid, day)
+		}
+	}
+	return nil
+}
+
+// contains reports whether t falls within the business hours
+func (h *BusinessHours) contains(t time.Time) bool {
+	location := h.location
+	if location == nil {
+		location = time.UTC
+	}
+	local := t.In(location)
+	clock := local.Format("15:04")
+	return containsString(h.Days, weekdays[local.Weekday()]) && clock >= h.Start && clock < h.End
+}
+
+func (s *Step) validate() error {
+	switch {
+	case s.Action != "" && s.Notify != nil:
+		return errors.New("a step either runs an action or notifies, not both")
+	case s.Action != "":
+		return nil
+	case s.Notify == nil:
+		return errors.New("a step needs an action or notify")
+	case len(s.Parameters) > 0:
+		return errors.New("notify steps take no parameters")
+	}
+	if strings.TrimSpace(s.Notify.Message) == "" {
+		return errors.New("notify needs a message")
+	}
+	for _, text := range []string{s.Notify.Subject, s.Notify.Message} {
+		if _, err := template.New("notify").Parse(text); err != nil {
+			return fmt.Errorf("notify template: %v", err)
+		}
+	}
+	for _, address := range s.Notify.Emails {
+		if !strings.Contains(address, "@") {
+			return fmt.Errorf("'%s' is not an email address", address)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the playbook runs for the finding
+func (p *Playbook) Matches(f *findings.Finding) bool {
+	if len(p.Match.Sources) > 0 && !containsFold(p.Match.Sources, f.Source) {
+		return false
+	}
+	if len(p.Match.Types) > 0 && !containsFold(p.Match.Types, f.RuleID) {
+		return false
+	}
+	if len(p.Match.Severities) > 0 && !containsFold(p.Match.Severities, f.Severity) {
+		return false
+	}
+	tags := resourceTags(f)
+	for key, value := range p.Match.Tags {
+		if !tagMatches(tags, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns why the guards keep the playbook from changing the finding's resource
+// without approval at now, or "" if they allow it
+func (g *Guards) Check(f *findings.Finding, now time.Time) string {
+	tags := resourceTags(f)
+	for key, value := range g.ExcludeTags {
+		if tagMatches(tags, key, value) {
+			return fmt.Sprintf("resource is tagged %s=%s", key, tags[key])
+		}
+	}
+	if g.BusinessHours != nil && !g.BusinessHours.contains(now) {
+		return fmt.Sprintf("outside business hours (%s-%s %s)", g.BusinessHours.Start, g.BusinessHours.End, g.BusinessHours.Timezone)
+	}
+	return ""
+}
+
+// Render fills in the notification's subject and message with data
+func (n *Notify) Render(data interface{}) (string, string, error) {
+	var rendered [2]string
+	for i, text := range []string{n.Subject, n.Message} {
+		tmpl, err := template.New("notify").Parse(text)
+		if err != nil {
+			return "", "", err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return "", "", err
+		}
+		rendered[i] = out.String()
+	}
+	return rendered[0], rendered[1], nil
+}
+
+func resourceTags(f *findings.Finding) map[string]string {
+	if f.Context == nil {
+		return nil
+	}
+	return f.Context.Tags
+}
+
+func tagMatches(tags map[string]string, key, value string) bool {
+	actual, ok := tags[key]
+	return ok && (value == "*" || strings.EqualFold(actual, value))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists per-tenant playbooks in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide playbook store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide playbook store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the playbooks collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create stores a new parsed playbook for the tenant
+func (s *Store) Create(ctx context.Context, playbook *Playbook) error {
+	now := time.Now()
+	playbook.ID, playbook.CreatedAt, playbook.UpdatedAt = primitive.NewObjectID(), now, now
+	_, err := s.collection.InsertOne(ctx, playbook)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, playbook.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create playbook: %w", err)
+	}
+	return nil
+}
+
+// Replace saves a parsed playbook over the tenant's playbook with the same ID
+func (s *Store) Replace(ctx context.Context, playbook *Playbook) error {
+	playbook.UpdatedAt = time.Now()
+	res, err := s.collection.ReplaceOne(ctx, bson.M{"_id": playbook.ID, "tenantId": playbook.TenantID}, playbook)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, playbook.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save playbook: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Get returns one of the tenant's playbooks, ready to match
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Playbook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var playbook Playbook
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&playbook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playbook: %w", err)
+	}
+	if err := playbook.Normalize(); err != nil {
+		return nil, err
+	}
+	return &playbook, nil
+}
+
+// List returns the tenant's playbooks in the order they are tried, ready to match. With
+// enabledOnly the disabled ones are left out.
+func (s *Store) List(ctx context.Context, tenantID string, enabledOnly bool) ([]Playbook, error) {
+	filter := bson.M{"tenantId": tenantID}
+	if enabledOnly {
+		filter["enabled"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playbooks: %w", err)
+	}
+	result := []Playbook{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode playbooks: %w", err)
+	}
+	for i := range result {
+		if err := result[i].Normalize(); err != nil {
+			return nil, fmt.Errorf("playbook %s: %w", result[i].Name, err)
+		}
+	}
+	return result, nil
+}
+
+// Delete removes one of the tenant's playbooks
+func (s *Store) Delete(ctx context.Context, tenantID, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": oid, "tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete playbook: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
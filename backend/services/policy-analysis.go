@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// policyStatement is the part of an IAM policy statement needed to judge who it grants access to.
+// Statement, Principal and its values may each be a single value or a list.
+type policyStatement struct {
+	Sid       string          `json:"Sid"`
+	Effect    string          `json:"Effect"`
+	Principal json.RawMessage `json:"Principal"`
+	Condition json.RawMessage `json:"Condition"`
+}
+
+// ExternalGrant describes a policy statement that allows access from outside the account
+type ExternalGrant struct {
+	Sid       string `json:"sid,omitempty"`
+	Principal string `json:"principal"`
+	// Conditional is set when the statement has a Condition that may narrow the grant
+	Conditional bool `json:"conditional"`
+	// Statement is the offending statement as it appears in the policy
+	Statement string `json:"statement,omitempty"`
+}
+
+func (g ExternalGrant) String() string {
+	s := "allows " + g.Principal
+	if g.Sid != "" {
+		s = g.Sid + " " + s
+	}
+	if g.Conditional {
+		s += " (with conditions)"
+	}
+	return s
+}
+
+// ExternalGrants returns the Allow statements of a resource policy whose principals are
+// anyone ("*") or AWS accounts other than accountID. Service principals are not reported.
+func ExternalGrants(document, accountID string) ([]ExternalGrant, error) {
+	if document == "" {
+		return nil, nil
+	}
+	if decoded, err := url.QueryUnescape(document); err == nil && strings.HasPrefix(strings.TrimSpace(decoded), "{") {
+		document = decoded
+	}
+
+	var policy struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	var statements []json.RawMessage
+	if err := unmarshalOneOrMany(policy.Statement, &statements); err != nil {
+		return nil, fmt.Errorf("failed to parse policy statements: %w", err)
+	}
+
+	var grants []ExternalGrant
+	for _, raw := range statements {
+		var st policyStatement
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statement: %w", err)
+		}
+		if !strings.EqualFold(st.Effect, "Allow") {
+			continue
+		}
+		conditional := len(st.Condition) > 0 && string(st.Condition) != "null" && string(st.Condition) != "{}"
+		for _, principal := range awsPrincipals(st.Principal) {
+			if principal != "*" && principalAccount(principal) == accountID {
+				continue
+			}
+			grants = append(grants, ExternalGrant{Sid: st.Sid, Principal: principal, Conditional: conditional, Statement: compactJSON(raw)})
+		}
+	}
+	return grants, nil
+}
+
+// compactJSON strips insignificant whitespace from a JSON value
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+// awsPrincipals returns the AWS principals of a statement: "*" for a wildcard principal,
+// otherwise the entries under "AWS"
+func awsPrincipals(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var wildcard string
+	if json.Unmarshal(raw, &wildcard) == nil {
+		return []string{wildcard}
+	}
+
+	var byType map[string]json.RawMessage
+	if json.Unmarshal(raw, &byType) != nil {
+		return nil
+	}
+	var principals []string
+	unmarshalOneOrMany(byType["AWS"], &principals)
+	return principals
+}
+
+// principalAccount returns the account of an AWS principal given as an ARN or an account ID
+func principalAccount(principal string) string {
+	if parts := strings.Split(principal, ":"); len(parts) >= 5 && parts[0] == "arn" {
+		return parts[4]
+	}
+	return principal
+}
+
+// unmarshalOneOrMany decodes a JSON value that is either a single element or a list of them
+func unmarshalOneOrMany[T any](raw json.RawMessage, out *[]T) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err == nil {
+		return nil
+	}
+	var single T
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return err
+	}
+	*out = []T{single}
+	return nil
+}
+
+// permissionStatement is the part of an IAM policy statement needed to judge what it grants.
+// Action and Resource may each be a single value or a list.
+type permissionStatement struct {
+	Sid         string          `json:"Sid"`
+	Effect      string          `json:"Effect"`
+	Action      json.RawMessage `json:"Action"`
+	NotAction   json.RawMessage `json:"NotAction"`
+	Resource    json.RawMessage `json:"Resource"`
+	NotResource json.RawMessage `json:"NotResource"`
+}
+
+// BroadGrant describes a policy statement that allows more than named actions on named resources
+type BroadGrant struct {
+	Sid    string `json:"sid,omitempty"`
+	Reason string `json:"reason"`
+	// Statement is the offending statement as it appears in the policy
+	Statement string `json:"statement,omitempty"`
+}
+
+// BroadGrants returns the Allow statements of an identity policy with a wildcard action, a
+// NotAction, a "*" resource or a NotResource
+func BroadGrants(document string) ([]BroadGrant, error) {
+	if document == "" {
+		return nil, nil
+	}
+	if decoded, err := url.QueryUnescape(document); err == nil && strings.HasPrefix(strings.TrimSpace(decoded), "{") {
+		document = decoded
+	}
+
+	var policy struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	var statements []json.RawMessage
+	if err := unmarshalOneOrMany(policy.Statement, &statements); err != nil {
+		return nil, fmt.Errorf("failed to parse policy statements: %w", err)
+	}
+
+	var grants []BroadGrant
+	for _, raw := range statements {
+		var st permissionStatement
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statement: %w", err)
+		}
+		if !strings.EqualFold(st.Effect, "Allow") {
+			continue
+		}
+
+		var reasons []string
+		var actions, resources []string
+		unmarshalOneOrMany(st.Action, &actions)
+		unmarshalOneOrMany(st.Resource, &resources)
+		for _, action := range actions {
+			if strings.Contains(action, "*") {
+				reasons = append(reasons, "wildcard action "+action)
+			}
+		}
+		if len(st.NotAction) > 0 {
+			reasons = append(reasons, "allows every action but those in NotAction")
+		}
+		if containsString(resources, "*") {
+			reasons = append(reasons, "applies to every resource")
+		}
+		if len(st.NotResource) > 0 {
+			reasons = append(reasons, "applies to every resource but those in NotResource")
+		}
+		if len(reasons) > 0 {
+			grants = append(grants, BroadGrant{Sid: st.Sid, Reason: strings.Join(reasons, "; "), Statement: compactJSON(raw)})
+		}
+	}
+	return grants, nil
+}
@@ -0,0 +1,164 @@
+package pollers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrShuttingDown is returned when a poller is started after Shutdown
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// RunFunc polls a queue until ctx is cancelled. It should finish the batch in hand before
+// returning, so cancelling drains rather than drops in-flight messages.
+type RunFunc func(ctx context.Context)
+
+// Poller is a queue poller running for a tenant
+type Poller struct {
+	TenantID  string    `json:"tenantId"`
+	QueueURL  string    `json:"queueUrl"`
+	StartedAt time.Time `json:"startedAt"`
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// stop cancels the poller and waits until it returns
+func (p *Poller) stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Manager runs at most one queue poller per tenant, each under the server's context, so every
+// poller stops when the server shuts down
+type Manager struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	pollers map[string]*Poller
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+var defaultManager = New(context.Background())
+
+// Init replaces the process-wide manager with one whose pollers run under ctx
+func Init(ctx context.Context) *Manager {
+	defaultManager = New(ctx)
+	return defaultManager
+}
+
+// Default returns the process-wide manager
+func Default() *Manager {
+	return defaultManager
+}
+
+// New creates a Manager whose pollers are cancelled along with ctx
+func New(ctx context.Context) *Manager {
+	return &Manager{ctx: ctx, pollers: map[string]*Poller{}}
+}
+
+// Start runs a poller for the tenant's queue, first stopping the tenant's running poller and
+// waiting for it to drain, so a tenant is never polled twice
+func (m *Manager) Start(tenantID, queueURL string, run RunFunc) (*Poller, error) {
+	m.Stop(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrShuttingDown
+	}
+	// Another Start may have won the race while the previous poller drained
+	if previous, ok := m.pollers[tenantID]; ok {
+		previous.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	poller := &Poller{TenantID: tenantID, QueueURL: queueURL, StartedAt: time.Now(), cancel: cancel, done: make(chan struct{})}
+	m.pollers[tenantID] = poller
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(poller.done)
+		defer m.remove(poller)
+		run(ctx)
+	}()
+	log.Printf("[Pollers] Started poller of tenant %s on %s", tenantID, queueURL)
+	return poller, nil
+}
+
+// remove forgets a poller that returned, unless it was already replaced
+func (m *Manager) remove(poller *Poller) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pollers[poller.TenantID] == poller {
+		delete(m.pollers, poller.TenantID)
+	}
+	poller.cancel()
+}
+
+// Stop stops the tenant's poller, waiting for it to drain, and reports whether one was running
+func (m *Manager) Stop(tenantID string) bool {
+	m.mu.Lock()
+	poller, ok := m.pollers[tenantID]
+	if ok {
+		delete(m.pollers, tenantID)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	poller.stop()
+	log.Printf("[Pollers] Stopped poller of tenant %s", tenantID)
+	return true
+}
+
+// Get returns a copy of the tenant's running poller
+func (m *Manager) Get(tenantID string) (Poller, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	poller, ok := m.pollers[tenantID]
+	if !ok {
+		return Poller{}, false
+	}
+	return *poller, true
+}
+
+// List returns copies of the running pollers, sorted by tenant
+func (m *Manager) List() []Poller {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Poller, 0, len(m.pollers))
+	for _, poller := range m.pollers {
+		result = append(result, *poller)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].TenantID < result[j].TenantID })
+	return result
+}
+
+// Shutdown stops every poller and refuses new ones, then waits for the pollers to drain their
+// in-flight messages or for ctx to end, whichever comes first
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	count := len(m.pollers)
+	for _, poller := range m.pollers {
+		poller.cancel()
+	}
+	m.mu.Unlock()
+
+	log.Printf("[Pollers] Draining %d pollers", count)
+	drained := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Println("[Pollers] All pollers stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/rishichirchi/cloudloom/services/pollers"
+)
+
+// ErrNoEventQueue is returned when polling is restarted for an account whose access tier does
+// not analyze its events, so setup created no queue
+var ErrNoEventQueue = errors.New("the account's access tier does not analyze events, so it has no event queue")
+
+// startPolling runs the account's SQS poller under the server's poller manager, replacing the
+// account's running poller
+func (s *CloudTrailService) startPolling(cfg aws.Config, queueURL, queueArn, accountID string) error {
+	_, err := pollers.Default().Start(accountID, queueURL, func(ctx context.Context) {
+		s.startSQSPollingWithEventBridgeCheck(ctx, cfg, queueURL, queueArn, accountID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start SQS polling: %w", err)
+	}
+	return nil
+}
+
+// RestartPolling stops the tenant's SQS poller, if one runs, and starts a new one with fresh
+// credentials. It also starts polling for a tenant no poller runs for, such as after the
+// server restarted.
+func RestartPolling(ctx context.Context, tenantID string) (*pollers.Poller, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.tier().Analyzes() {
+		return nil, ErrNoEventQueue
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+	queue, err := sqs.NewFromConfig(cfg).GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(names.queue)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find queue %s: %w", names.queue, err)
+	}
+	queueArn := fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, names.queue)
+
+	if err := s.startPolling(cfg, aws.ToString(queue.QueueUrl), queueArn, accountID); err != nil {
+		return nil, err
+	}
+	poller, _ := pollers.Default().Get(accountID)
+	return &poller, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// PermissionReport is the simulated decision for every permission setup and AWS Config
+// management need from a tenant's role
+type PermissionReport struct {
+	AccountID string            `json:"accountId"`
+	RoleArn   string            `json:"roleArn"`
+	Passed    bool              `json:"passed"`
+	Checks    []PermissionCheck `json:"checks"`
+}
+
+// ValidateTenantPermissions assumes the tenant's role and simulates each permission setup
+// needs, without changing anything. A role that may not simulate its own policies fails with
+// a single failed iam:SimulatePrincipalPolicy check, since nothing else can be verified.
+func ValidateTenantPermissions(ctx context.Context, tenant *tenants.Tenant) (*PermissionReport, error) {
+	s := NewTenantCloudTrailService(tenant)
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+	required := append(setupPermissions(accountID, cfg.Region, names, s.tier()), configPermissions(accountID)...)
+	report := &PermissionReport{AccountID: accountID, RoleArn: s.roleArn()}
+
+	report.Checks, err = EvaluateRolePermissions(ctx, cfg, s.roleArn(), required)
+	if errors.Is(err, ErrSimulationNotAllowed) {
+		report.Checks = []PermissionCheck{{
+			Permission: Permission{Action: "iam:SimulatePrincipalPolicy", Resource: s.roleArn()},
+			Decision:   string(iamtypes.PolicyEvaluationDecisionTypeImplicitDeny),
+		}}
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.Passed = true
+	failed := 0
+	for _, check := range report.Checks {
+		if !check.Allowed {
+			report.Passed = false
+			failed++
+		}
+	}
+	log.Printf("[Permissions] Validated %d permissions of %s: %d failed", len(report.Checks), s.roleArn(), failed)
+	return report, nil
+}
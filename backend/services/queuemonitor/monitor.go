@@ -0,0 +1,332 @@
+package queuemonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// QueueStats holds the latest depth and lag readings for a single queue
+type QueueStats struct {
+	QueueURL                string    `json:"queueUrl"`
+	AccountID               string    `json:"accountId"`
+	MessagesVisible         int       `json:"approximateNumberOfMessages"`
+	MessagesInFlight        int       `json:"approximateNumberOfMessagesNotVisible"`
+	MessagesDelayed         int       `json:"approximateNumberOfMessagesDelayed"`
+	OldestMessageAgeSeconds float64   `json:"oldestMessageAgeSeconds"`
+	ProcessingLagSeconds    float64   `json:"processingLagSeconds"`
+	MessagesProcessed       int64     `json:"messagesProcessed"`
+	LastSampledAt           time.Time `json:"lastSampledAt"`
+	LastMessageAt           time.Time `json:"lastMessageAt,omitempty"`
+	DepthThresholdExceeded  bool      `json:"depthThresholdExceeded"`
+	LagThresholdExceeded    bool      `json:"lagThresholdExceeded"`
+}
+
+// Alert describes a queue that crossed one of the configured thresholds
+type Alert struct {
+	QueueURL  string    `json:"queueUrl"`
+	AccountID string    `json:"accountId"`
+	Kind      string    `json:"kind"` // depth or lag
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	RaisedAt  time.Time `json:"raisedAt"`
+}
+
+// Thresholds controls when alerts fire and low-priority work is paused
+type Thresholds struct {
+	MaxDepth      int     `json:"maxDepth" binding:"min=0"`
+	MaxLagSeconds float64 `json:"maxLagSeconds" binding:"min=0"`
+}
+
+// Monitor tracks queue metrics for every polled queue in the process
+type Monitor struct {
+	mu            sync.RWMutex
+	queues        map[string]*QueueStats
+	alerts        map[string]Alert
+	thresholds    Thresholds
+	alertHandlers []func(Alert)
+}
+
+var defaultMonitor = NewMonitor(thresholdsFromEnv())
+
+// Default returns the process-wide monitor used by the SQS pollers
+func Default() *Monitor {
+	return defaultMonitor
+}
+
+// NewMonitor creates a Monitor with the given thresholds
+func NewMonitor(thresholds Thresholds) *Monitor {
+	return &Monitor{
+		queues:     make(map[string]*QueueStats),
+		alerts:     make(map[string]Alert),
+		thresholds: thresholds,
+	}
+}
+
+// thresholdsFromEnv reads QUEUE_DEPTH_ALERT_THRESHOLD and QUEUE_LAG_ALERT_SECONDS
+func thresholdsFromEnv() Thresholds {
+	thresholds := Thresholds{
+		MaxDepth:      1000,
+		MaxLagSeconds: 300,
+	}
+	if v, err := strconv.Atoi(os.Getenv("QUEUE_DEPTH_ALERT_THRESHOLD")); err == nil && v > 0 {
+		thresholds.MaxDepth = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("QUEUE_LAG_ALERT_SECONDS"), 64); err == nil && v > 0 {
+		thresholds.MaxLagSeconds = v
+	}
+	return thresholds
+}
+
+// OnAlert registers a callback invoked whenever a new alert is raised
+func (m *Monitor) OnAlert(handler func(Alert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alertHandlers = append(m.alertHandlers, handler)
+}
+
+// Thresholds returns the current alert thresholds
+func (m *Monitor) Thresholds() Thresholds {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.thresholds
+}
+
+// SetThresholds replaces the alert thresholds and re-evaluates every queue
+func (m *Monitor) SetThresholds(thresholds Thresholds) {
+	m.mu.Lock()
+	m.thresholds = thresholds
+	var raised []Alert
+	for _, stats := range m.queues {
+		raised = append(raised, m.evaluateLocked(stats)...)
+	}
+	handlers := m.alertHandlers
+	m.mu.Unlock()
+
+	notify(handlers, raised)
+}
+
+// RecordDepth stores a depth sample taken from GetQueueAttributes
+func (m *Monitor) RecordDepth(accountID, queueURL string, visible, inFlight, delayed int) {
+	m.mu.Lock()
+	stats := m.statsLocked(accountID, queueURL)
+	stats.MessagesVisible = visible
+	stats.MessagesInFlight = inFlight
+	stats.MessagesDelayed = delayed
+	stats.LastSampledAt = time.Now()
+	if visible == 0 && delayed == 0 {
+		// An empty queue has no backlog, so the last batch's lag no longer applies
+		stats.ProcessingLagSeconds = 0
+		stats.OldestMessageAgeSeconds = 0
+	}
+	raised := m.evaluateLocked(stats)
+	handlers := m.alertHandlers
+	m.mu.Unlock()
+
+	notify(handlers, raised)
+}
+
+// RecordBatch stores the age of the messages in a received batch.
+// The oldest message in the batch is used as the queue's processing lag.
+func (m *Monitor) RecordBatch(accountID, queueURL string, sentAt []time.Time) {
+	if len(sentAt) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var oldest float64
+	for _, t := range sentAt {
+		if age := now.Sub(t).Seconds(); age > oldest {
+			oldest = age
+		}
+	}
+
+	m.mu.Lock()
+	stats := m.statsLocked(accountID, queueURL)
+	stats.ProcessingLagSeconds = oldest
+	stats.OldestMessageAgeSeconds = oldest
+	stats.MessagesProcessed += int64(len(sentAt))
+	stats.LastMessageAt = now
+	raised := m.evaluateLocked(stats)
+	handlers := m.alertHandlers
+	m.mu.Unlock()
+
+	notify(handlers, raised)
+}
+
+// Snapshot returns a copy of the stats for every tracked queue
+func (m *Monitor) Snapshot() []QueueStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]QueueStats, 0, len(m.queues))
+	for _, stats := range m.queues {
+		result = append(result, *stats)
+	}
+	return result
+}
+
+// ActiveAlerts returns the alerts that are currently raised
+func (m *Monitor) ActiveAlerts() []Alert {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Alert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		result = append(result, alert)
+	}
+	return result
+}
+
+// IsBackedUp reports whether any tracked queue is over its depth or lag threshold
+func (m *Monitor) IsBackedUp() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.alerts) > 0
+}
+
+// ShouldPauseLowPriority reports whether low-priority work such as scheduled
+// scans should be skipped because the findings pipeline is backed up
+func ShouldPauseLowPriority() bool {
+	return defaultMonitor.IsBackedUp()
+}
+
+// Forget stops tracking a queue, e.g. after its poller is stopped
+func (m *Monitor) Forget(queueURL string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, queueURL)
+	delete(m.alerts, alertKey(queueURL, "depth"))
+	delete(m.alerts, alertKey(queueURL, "lag"))
+}
+
+func (m *Monitor) statsLocked(accountID, queueURL string) *QueueStats {
+	stats, ok := m.queues[queueURL]
+	if !ok {
+		stats = &QueueStats{QueueURL: queueURL, AccountID: accountID}
+		m.queues[queueURL] = stats
+	}
+	return stats
+}
+
+// evaluateLocked updates threshold flags and returns any newly raised alerts
+func (m *Monitor) evaluateLocked(stats *QueueStats) []Alert {
+	var raised []Alert
+
+	depth := stats.MessagesVisible + stats.MessagesDelayed
+	stats.DepthThresholdExceeded = m.thresholds.MaxDepth > 0 && depth > m.thresholds.MaxDepth
+	if alert, ok := m.updateAlertLocked(stats, "depth", stats.DepthThresholdExceeded, float64(depth), float64(m.thresholds.MaxDepth)); ok {
+		raised = append(raised, alert)
+	}
+
+	stats.LagThresholdExceeded = m.thresholds.MaxLagSeconds > 0 && stats.ProcessingLagSeconds > m.thresholds.MaxLagSeconds
+	if alert, ok := m.updateAlertLocked(stats, "lag", stats.LagThresholdExceeded, stats.ProcessingLagSeconds, m.thresholds.MaxLagSeconds); ok {
+		raised = append(raised, alert)
+	}
+
+	return raised
+}
+
+func (m *Monitor) updateAlertLocked(stats *QueueStats, kind string, exceeded bool, value, threshold float64) (Alert, bool) {
+	key := alertKey(stats.QueueURL, kind)
+	_, active := m.alerts[key]
+
+	if !exceeded {
+		if active {
+			log.Printf("[QueueMonitor] ✅ %s back under %s threshold (%.0f <= %.0f)", stats.QueueURL, kind, value, threshold)
+			delete(m.alerts, key)
+		}
+		return Alert{}, false
+	}
+
+	if active {
+		return Alert{}, false
+	}
+
+	alert := Alert{
+		QueueURL:  stats.QueueURL,
+		AccountID: stats.AccountID,
+		Kind:      kind,
+		Value:     value,
+		Threshold: threshold,
+		RaisedAt:  time.Now(),
+	}
+	m.alerts[key] = alert
+	log.Printf("[QueueMonitor] ⚠️ %s exceeded %s threshold (%.0f > %.0f), pausing low-priority work", stats.QueueURL, kind, value, threshold)
+	return alert, true
+}
+
+func notify(handlers []func(Alert), alerts []Alert) {
+	for _, alert := range alerts {
+		for _, handler := range handlers {
+			handler(alert)
+		}
+	}
+}
+
+func alertKey(queueURL, kind string) string {
+	return fmt.Sprintf("%s#%s", queueURL, kind)
+}
+
+// SampleQueue reads the approximate queue depth attributes and records them
+func (m *Monitor) SampleQueue(ctx context.Context, client *sqs.Client, accountID, queueURL string) error {
+	result, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get queue depth attributes: %w", err)
+	}
+
+	visible, _ := strconv.Atoi(result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+	inFlight, _ := strconv.Atoi(result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)])
+	delayed, _ := strconv.Atoi(result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesDelayed)])
+
+	m.RecordDepth(accountID, queueURL, visible, inFlight, delayed)
+	return nil
+}
+
+// StartSampling samples queue depth on an interval until ctx is cancelled
+func (m *Monitor) StartSampling(ctx context.Context, client *sqs.Client, accountID, queueURL string, interval time.Duration) {
+	log.Printf("[QueueMonitor] Sampling %s every %s", queueURL, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.SampleQueue(ctx, client, accountID, queueURL); err != nil {
+			log.Printf("[QueueMonitor] Warning: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("[QueueMonitor] Stopped sampling %s", queueURL)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SentTimestamp parses the SentTimestamp system attribute of a received message
+func SentTimestamp(message types.Message) (time.Time, bool) {
+	raw, ok := message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)]
+	if !ok {
+		return time.Time{}, false
+	}
+	millis, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(millis), true
+}
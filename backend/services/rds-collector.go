@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// collectRDS reads DB instances, clusters and their manual snapshots in every enabled region.
+// Snapshots carry their sharing attributes as supplementary configuration, as Config records
+// them, so snapshots restorable by everyone are reported as exposed.
+func (cs *ConfigService) collectRDS(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+	accountID, _ := getAccountID(ctx, &cfg)
+	return cs.collectPerRegion(ctx, cfg, "RDS", func(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+		return (&rdsCollector{client: rds.NewFromConfig(cfg), region: cfg.Region, accountID: accountID}).collect(ctx)
+	})
+}
+
+// rdsCollector reads the RDS resources of one region
+type rdsCollector struct {
+	client    *rds.Client
+	region    string
+	accountID string
+}
+
+func (c *rdsCollector) collect(ctx context.Context) ([]ConfigurationItem, error) {
+	return describeAll(ctx, c.region, []resourceDescriber{
+		{"DB instances", c.instances},
+		{"DB clusters", c.clusters},
+		{"DB snapshots", c.snapshots},
+		{"DB cluster snapshots", c.clusterSnapshots},
+	})
+}
+
+func rdsTags(tags []rdstypes.Tag) FlexibleTags {
+	flexible := FlexibleTags{}
+	for _, tag := range tags {
+		flexible[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return flexible
+}
+
+func rdsSecurityGroups(memberships []rdstypes.VpcSecurityGroupMembership) []Relationship {
+	var relationships []Relationship
+	for _, membership := range memberships {
+		relationships = append(relationships, relatedTo("AWS::EC2::SecurityGroup", "Is associated with SecurityGroup", aws.ToString(membership.VpcSecurityGroupId))...)
+	}
+	return relationships
+}
+
+// relatedByName relates to an RDS resource by its identifier, which is its resource name;
+// descriptions of related resources do not carry their resource IDs
+func relatedByName(resourceType, relationship, name string) []Relationship {
+	if name == "" {
+		return nil
+	}
+	return []Relationship{{ResourceType: resourceType, ResourceName: name, RelationshipName: relationship}}
+}
+
+// instances reads DB instances with their encryption, public accessibility, backup retention
+// and deletion protection, which are all part of the instance description
+func (c *rdsCollector) instances(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := rds.NewDescribeDBInstancesPaginator(c.client, &rds.DescribeDBInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB instances: %w", err)
+		}
+		for _, instance := range page.DBInstances {
+			relationships := rdsSecurityGroups(instance.VpcSecurityGroups)
+			if instance.DBSubnetGroup != nil {
+				relationships = append(relationships, relatedTo("AWS::EC2::VPC", "Is contained in Vpc", aws.ToString(instance.DBSubnetGroup.VpcId))...)
+			}
+			relationships = append(relationships, relatedByName("AWS::RDS::DBCluster", "Is associated with DBCluster", aws.ToString(instance.DBClusterIdentifier))...)
+
+			// Config identifies instances by their resource ID, which survives renames
+			item := collectedItem("AWS::RDS::DBInstance", aws.ToString(instance.DbiResourceId), aws.ToString(instance.DBInstanceIdentifier),
+				c.region, c.accountID, instance, rdsTags(instance.TagList), instance.InstanceCreateTime, relationships...)
+			item.AvailabilityZone = aws.ToString(instance.AvailabilityZone)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *rdsCollector) clusters(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := rds.NewDescribeDBClustersPaginator(c.client, &rds.DescribeDBClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB clusters: %w", err)
+		}
+		for _, cluster := range page.DBClusters {
+			relationships := rdsSecurityGroups(cluster.VpcSecurityGroups)
+			for _, member := range cluster.DBClusterMembers {
+				relationships = append(relationships, relatedByName("AWS::RDS::DBInstance", "Contains DBInstance", aws.ToString(member.DBInstanceIdentifier))...)
+			}
+			items = append(items, collectedItem("AWS::RDS::DBCluster", aws.ToString(cluster.DbClusterResourceId), aws.ToString(cluster.DBClusterIdentifier),
+				c.region, c.accountID, cluster, rdsTags(cluster.TagList), cluster.ClusterCreateTime, relationships...))
+		}
+	}
+	return items, nil
+}
+
+// snapshots reads manual DB snapshots, the only kind that can be shared, with who may restore
+// them
+func (c *rdsCollector) snapshots(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := rds.NewDescribeDBSnapshotsPaginator(c.client, &rds.DescribeDBSnapshotsInput{SnapshotType: aws.String("manual")})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB snapshots: %w", err)
+		}
+		for _, snapshot := range page.DBSnapshots {
+			id := aws.ToString(snapshot.DBSnapshotIdentifier)
+			item := collectedItem("AWS::RDS::DBSnapshot", id, id, c.region, c.accountID, snapshot, rdsTags(snapshot.TagList), snapshot.SnapshotCreateTime,
+				relatedByName("AWS::RDS::DBInstance", "Is associated with DBInstance", aws.ToString(snapshot.DBInstanceIdentifier))...)
+
+			attributes, err := c.client.DescribeDBSnapshotAttributes(ctx, &rds.DescribeDBSnapshotAttributesInput{DBSnapshotIdentifier: snapshot.DBSnapshotIdentifier})
+			if err != nil {
+				log.Printf("[ConfigService] Warning: failed to read attributes of DB snapshot %s: %v", id, err)
+			} else if attributes.DBSnapshotAttributesResult != nil {
+				item.SupplementaryConfiguration = map[string]interface{}{
+					"DBSnapshotAttributes": toConfigValue(attributes.DBSnapshotAttributesResult.DBSnapshotAttributes),
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (c *rdsCollector) clusterSnapshots(ctx context.Context) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	paginator := rds.NewDescribeDBClusterSnapshotsPaginator(c.client, &rds.DescribeDBClusterSnapshotsInput{SnapshotType: aws.String("manual")})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe DB cluster snapshots: %w", err)
+		}
+		for _, snapshot := range page.DBClusterSnapshots {
+			id := aws.ToString(snapshot.DBClusterSnapshotIdentifier)
+			item := collectedItem("AWS::RDS::DBClusterSnapshot", id, id, c.region, c.accountID, snapshot, rdsTags(snapshot.TagList), snapshot.SnapshotCreateTime,
+				relatedByName("AWS::RDS::DBCluster", "Is associated with DBCluster", aws.ToString(snapshot.DBClusterIdentifier))...)
+
+			attributes, err := c.client.DescribeDBClusterSnapshotAttributes(ctx, &rds.DescribeDBClusterSnapshotAttributesInput{DBClusterSnapshotIdentifier: snapshot.DBClusterSnapshotIdentifier})
+			if err != nil {
+				log.Printf("[ConfigService] Warning: failed to read attributes of DB cluster snapshot %s: %v", id, err)
+			} else if attributes.DBClusterSnapshotAttributesResult != nil {
+				item.SupplementaryConfiguration = map[string]interface{}{
+					"DBClusterSnapshotAttributes": toConfigValue(attributes.DBClusterSnapshotAttributesResult.DBClusterSnapshotAttributes),
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
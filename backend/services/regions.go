@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	accounttypes "github.com/aws/aws-sdk-go-v2/service/account/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// globalEventsRegion is where EventBridge receives the events of global services such as IAM
+const globalEventsRegion = "us-east-1"
+
+// RegionsNotEnabledError is returned when setup is asked to use regions that are not enabled
+// in the customer account
+type RegionsNotEnabledError struct {
+	Regions []string `json:"regions"`
+}
+
+func (e *RegionsNotEnabledError) Error() string {
+	return fmt.Sprintf("regions not enabled in the account: %s", strings.Join(e.Regions, ", "))
+}
+
+// monitoredRegions returns the regions setup creates EventBridge rules in: the tenant's chosen
+// regions, or else its home region and us-east-1
+func (s *CloudTrailService) monitoredRegions() []string {
+	if s.tenant != nil && len(s.tenant.Regions) > 0 {
+		return s.tenant.Regions
+	}
+	if s.region() == globalEventsRegion {
+		return []string{globalEventsRegion}
+	}
+	return []string{s.region(), globalEventsRegion}
+}
+
+// MonitoredRegions are the regions setup created EventBridge rules in for a tenant
+type MonitoredRegions struct {
+	Regions []string `json:"regions"`
+	// AllRegions means Regions are every region enabled in the account when last resolved
+	AllRegions bool     `json:"allRegions"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+}
+
+func (s *CloudTrailService) allRegions() bool {
+	return s.tenant != nil && s.tenant.AllRegions
+}
+
+// resolveRegions returns the regions to monitor. For a tenant monitoring all regions they are
+// discovered from the account on every call, so regions enabled since the last setup are
+// picked up, and recorded on the tenant in memory.
+func (s *CloudTrailService) resolveRegions(ctx context.Context, cfg aws.Config) ([]string, error) {
+	if !s.allRegions() {
+		return s.monitoredRegions(), nil
+	}
+	regions, err := enabledRegions(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.tenant.Regions = regions
+	return regions, nil
+}
+
+// enabledRegions lists the regions enabled in the account, including opt-in regions the
+// customer has enabled, in name order
+func enabledRegions(ctx context.Context, cfg aws.Config) ([]string, error) {
+	paginator := account.NewListRegionsPaginator(account.NewFromConfig(cfg), &account.ListRegionsInput{
+		RegionOptStatusContains: []accounttypes.RegionOptStatus{
+			accounttypes.RegionOptStatusEnabled,
+			accounttypes.RegionOptStatusEnabledByDefault,
+		},
+	})
+	var regions []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list enabled regions: %w", err)
+		}
+		for _, region := range page.Regions {
+			regions = append(regions, aws.ToString(region.RegionName))
+		}
+	}
+	if len(regions) == 0 {
+		return nil, errors.New("no regions are enabled in the account")
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// UpdateMonitoredRegions changes the regions the tenant's account events are collected from
+// without running setup again: rules are created in regions that were added and deleted from
+// regions that were removed. Empty regions without all monitor the home region and us-east-1.
+func UpdateMonitoredRegions(ctx context.Context, tenantID string, regions []string, all bool) (*MonitoredRegions, error) {
+	manager := tenants.Default()
+	if manager == nil {
+		return nil, fmt.Errorf("tenant store is not initialized")
+	}
+	tenant, err := manager.Get(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewTenantCloudTrailService(tenant)
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := s.monitoredRegions()
+	tenant.Regions, tenant.AllRegions = regions, all
+	current, err := s.resolveRegions(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRegions(ctx, cfg, current); err != nil {
+		return nil, err
+	}
+
+	result := &MonitoredRegions{Regions: current, AllRegions: all}
+	for _, region := range current {
+		if !containsString(previous, region) {
+			result.Added = append(result.Added, region)
+		}
+	}
+	for _, region := range previous {
+		if !containsString(current, region) {
+			result.Removed = append(result.Removed, region)
+		}
+	}
+
+	names := s.resourceNames(ctx, cfg, accountID, append(append([]string{}, previous...), result.Added...))
+	tier := s.tier()
+	s.setupID = primitive.NewObjectID().Hex()
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic)
+	var queueArn, eventBridgeRoleArn string
+	if tier.Analyzes() {
+		queueArn = fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, names.queue)
+		eventBridgeRoleArn = fmt.Sprintf("arn:aws:iam::%s:role/CloudLoom-Events-Role-%s", accountID, accountID)
+	}
+	for _, region := range result.Added {
+		regionalCfg := inRegion(cfg, region)
+		ruleArn, err := s.createEventBridgeRule(ctx, regionalCfg, names.rules[region], topicArn, queueArn, eventBridgeRoleArn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create EventBridge rule in region %s: %w", region, err)
+		}
+		s.tagManaged(ctx, regionalCfg, ruleArn)
+	}
+	for _, region := range result.Removed {
+		ruleName := names.rules[region]
+		if err := deleteEventBridgeRule(ctx, eventbridge.NewFromConfig(inRegion(cfg, region)), ruleName); err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("failed to delete EventBridge rule in region %s: %w", region, err)
+		}
+	}
+
+	// The queue only accepts messages from the rules named in its policy
+	if tier.Analyzes() && (len(result.Added) > 0 || len(result.Removed) > 0) {
+		var ruleArns []string
+		for _, region := range current {
+			ruleArns = append(ruleArns, fmt.Sprintf("arn:aws:events:%s:%s:rule/%s", region, accountID, names.rules[region]))
+		}
+		queue, err := sqs.NewFromConfig(cfg).GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(names.queue)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find queue %s: %w", names.queue, err)
+		}
+		if err := s.setSQSQueuePolicy(ctx, cfg, aws.ToString(queue.QueueUrl), queueArn, ruleArns); err != nil {
+			return nil, err
+		}
+	}
+
+	// A tenant monitoring all regions keeps the flag, so the next setup resolves them afresh
+	if err := manager.SetRegions(ctx, tenantID, current, all); err != nil {
+		return nil, err
+	}
+	log.Printf("[Regions] ✅ Account %s is now monitored in %v (added %v, removed %v)", accountID, current, result.Added, result.Removed)
+	return result, nil
+}
+
+// validateRegions fails with a *RegionsNotEnabledError when any of the regions is not enabled
+// in the account. Opt-in regions count only once the customer has enabled them. The check is
+// skipped when the role may not list regions.
+func validateRegions(ctx context.Context, cfg aws.Config, regions []string) error {
+	out, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(false)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorCode(), "Unauthorized") {
+			log.Printf("[Regions] ⚠️ Role may not list enabled regions, skipping region check")
+			return nil
+		}
+		return fmt.Errorf("failed to list enabled regions: %w", err)
+	}
+
+	enabled := map[string]bool{}
+	for _, region := range out.Regions {
+		enabled[aws.ToString(region.RegionName)] = true
+	}
+	var disabled []string
+	for _, region := range regions {
+		if !enabled[region] {
+			disabled = appendUnique(disabled, region)
+		}
+	}
+	if len(disabled) > 0 {
+		return &RegionsNotEnabledError{Regions: disabled}
+	}
+	return nil
+}
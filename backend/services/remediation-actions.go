@@ -0,0 +1,753 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// Names of the built-in remediation actions
+const (
+	ActionBlockS3PublicAccess = "s3-block-public-access"
+	ActionRevokeOpenIngress   = "revoke-open-security-group-ingress"
+	ActionRotateAccessKey     = "rotate-access-key"
+	ActionEnableEBSEncryption = "enable-ebs-encryption-by-default"
+	ActionQuarantineIAMUser   = "quarantine-iam-user"
+	// The incident response actions, in remediation-incident-response.go
+	ActionDeactivateAccessKeys          = "deactivate-access-keys"
+	ActionQuarantineIAMRole             = "quarantine-iam-role"
+	ActionRevokeRoleSessions            = "revoke-role-sessions"
+	ActionSnapshotInstance              = "snapshot-instance"
+	ActionRespondToCredentialCompromise = "respond-to-credential-compromise"
+)
+
+// keyRotationGraceParameter is the parameter of the rotate-access-key action that sets the
+// old key's grace period
+const keyRotationGraceParameter = "gracePeriodHours"
+
+// quarantinePolicyArn is the managed policy that denies a quarantined user or role everything
+const quarantinePolicyArn = "arn:aws:iam::aws:policy/AWSDenyAll"
+
+// builtinRemediationActions are the actions registered with the default engine. Finding types
+// are listed for every source that reports the problem: the exposure analyzer, CloudTrail
+// anomalies, AWS Config rules setup creates or the managed rule catalog names, Security Hub
+// controls and GuardDuty.
+func builtinRemediationActions() []*RemediationAction {
+	return append([]*RemediationAction{
+		{
+			Name:        ActionBlockS3PublicAccess,
+			Description: "Turns on all four S3 Block Public Access settings of the bucket",
+			FindingTypes: []string{
+				ExposureS3PublicAccess,
+				"s3-bucket-public-access-prohibited",
+				"s3-bucket-public-read-prohibited",
+				"s3-bucket-public-write-prohibited",
+				"s3-bucket-level-public-access-prohibited",
+				"security-control/S3.2",
+				"security-control/S3.3",
+				"security-control/S3.8",
+				"Policy:S3/BucketBlockPublicAccessDisabled",
+				"Policy:S3/BucketAnonymousAccessGranted",
+				"Policy:S3/BucketPublicAccessGranted",
+			},
+			Permissions: func(accountID string) []Permission {
+				return []Permission{
+					{Action: "s3:GetBucketLocation", Resource: "arn:aws:s3:::*"},
+					{Action: "s3:GetBucketPublicAccessBlock", Resource: "arn:aws:s3:::*"},
+					{Action: "s3:GetBucketPolicy", Resource: "arn:aws:s3:::*"},
+					{Action: "s3:PutBucketPublicAccessBlock", Resource: "arn:aws:s3:::*"},
+				}
+			},
+			Reversibility:     remediations.Reversible,
+			ReversibilityNote: "The settings that were off can be turned off again with PutPublicAccessBlock",
+			Plan:              planBucketPublicAccessBlock,
+			Apply:             blockBucketPublicAccess,
+			Capture:           captureBucketPublicAccess,
+			Rollback:          restoreBucketPublicAccess,
+		},
+		{
+			Name:        ActionRevokeOpenIngress,
+			Description: "Revokes the security group's ingress from 0.0.0.0/0 and ::/0 on sensitive ports or all traffic",
+			FindingTypes: []string{
+				ExposureOpenSecurityGroup,
+				AnomalyOpenIngress,
+				"incoming-ssh-disabled",
+				"restricted-ssh",
+				"security-control/EC2.13",
+				"security-control/EC2.14",
+				"security-control/EC2.19",
+			},
+			Permissions: func(accountID string) []Permission {
+				return []Permission{
+					{Action: "ec2:DescribeSecurityGroups", Resource: "*"},
+					{Action: "ec2:RevokeSecurityGroupIngress", Resource: fmt.Sprintf("arn:aws:ec2:*:%s:security-group/*", accountID)},
+					{Action: "ec2:AuthorizeSecurityGroupIngress", Resource: fmt.Sprintf("arn:aws:ec2:*:%s:security-group/*", accountID)},
+				}
+			},
+			Reversibility:     remediations.Reversible,
+			ReversibilityNote: "The revoked rules can be authorized again with AuthorizeSecurityGroupIngress",
+			Plan:              planRevokeOpenIngress,
+			Apply:             revokeOpenIngress,
+			Capture:           captureOpenIngress,
+			Rollback:          restoreOpenIngress,
+		},
+		{
+			Name:             ActionRotateAccessKey,
+			Description:      "Rotates the user's access key, storing the new key in the account's Secrets Manager",
+			FindingTypes:     []string{"access-keys-rotated", "security-control/IAM.3"},
+			KeepsFindingOpen: true,
+			Parameters: map[string]string{
+				keyRotationGraceParameter: "Hours the old key keeps working before it is deactivated; defaults to 168",
+			},
+			Permissions: func(accountID string) []Permission {
+				return keyRotationPermissions(accountID, "*", KeyRotationRequest{UserName: "*", StoreInSecretsManager: true})
+			},
+			Reversibility:     remediations.Irreversible,
+			ReversibilityNote: "Issues new credentials for the user; the old key is deleted once the rotation is confirmed and cannot be restored",
+			Plan:              planAccessKeyRotation,
+			Apply:             rotateFlaggedAccessKey,
+		},
+		{
+			Name:         ActionEnableEBSEncryption,
+			Description:  "Turns on EBS encryption by default in the region",
+			FindingTypes: []string{"ec2-ebs-encryption-by-default", "security-control/EC2.7"},
+			Permissions: func(accountID string) []Permission {
+				return []Permission{
+					{Action: "ec2:GetEbsEncryptionByDefault", Resource: "*"},
+					{Action: "ec2:EnableEbsEncryptionByDefault", Resource: "*"},
+					{Action: "ec2:DisableEbsEncryptionByDefault", Resource: "*"},
+				}
+			},
+			Reversibility:     remediations.Reversible,
+			ReversibilityNote: "Encryption by default can be turned off again; volumes created in the meantime stay encrypted",
+			Plan:              planEBSEncryptionByDefault,
+			Apply:             enableEBSEncryptionByDefault,
+			Capture:           captureEBSEncryptionByDefault,
+			Rollback:          restoreEBSEncryptionByDefault,
+		},
+	}, incidentResponseActions()...)
+}
+
+// s3PublicAccessSettings names the public access block settings in the order S3 lists them
+var s3PublicAccessSettings = []string{"BlockPublicAcls", "IgnorePublicAcls", "BlockPublicPolicy", "RestrictPublicBuckets"}
+
+// bucketPublicAccessBlock returns a client in the bucket's own region and the settings of the
+// bucket's public access block that are off
+func bucketPublicAccessBlock(ctx context.Context, cfg aws.Config, bucket string) (*s3.Client, []string, error) {
+	location, err := s3.NewFromConfig(cfg).GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find region of bucket %s: %w", bucket, err)
+	}
+	// Buckets in us-east-1 have no location constraint, and EU is the old name of eu-west-1
+	region := string(location.LocationConstraint)
+	switch region {
+	case "":
+		region = "us-east-1"
+	case "EU":
+		region = "eu-west-1"
+	}
+	client := s3.NewFromConfig(inRegion(cfg, region))
+
+	current, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		// A bucket without a public access block has every setting off
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchPublicAccessBlockConfiguration" {
+			return client, s3PublicAccessSettings, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read public access block of bucket %s: %w", bucket, err)
+	}
+	block := current.PublicAccessBlockConfiguration
+	if block == nil {
+		return client, s3PublicAccessSettings, nil
+	}
+	on := []bool{aws.ToBool(block.BlockPublicAcls), aws.ToBool(block.IgnorePublicAcls), aws.ToBool(block.BlockPublicPolicy), aws.ToBool(block.RestrictPublicBuckets)}
+	var off []string
+	for i, setting := range s3PublicAccessSettings {
+		if !on[i] {
+			off = append(off, setting)
+		}
+	}
+	return client, off, nil
+}
+
+func planBucketPublicAccessBlock(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	bucket := target.ResourceName
+	_, off, err := bucketPublicAccessBlock(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	preview := &remediations.Preview{}
+	if len(off) == 0 {
+		return preview, nil
+	}
+	block := map[string]interface{}{}
+	for _, setting := range s3PublicAccessSettings {
+		block[setting] = true
+	}
+	for _, setting := range off {
+		preview.Diff = append(preview.Diff, fmt.Sprintf("~ %s of bucket %s: false -> true", setting, bucket))
+	}
+	preview.Calls = []remediations.APICall{{
+		Action:     "s3:PutPublicAccessBlock",
+		Resource:   "arn:aws:s3:::" + bucket,
+		Parameters: map[string]interface{}{"Bucket": bucket, "PublicAccessBlockConfiguration": block},
+	}}
+	return preview, nil
+}
+
+// blockBucketPublicAccess turns on every public access block setting of the bucket, in the
+// bucket's own region
+func blockBucketPublicAccess(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	bucket := target.ResourceName
+	client, off, err := bucketPublicAccessBlock(ctx, cfg, bucket)
+	if err != nil || len(off) == 0 {
+		return nil, err
+	}
+	_, err = client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to block public access to bucket %s: %w", bucket, err)
+	}
+	return []string{fmt.Sprintf("s3:PutPublicAccessBlock on %s: turned on %s", bucket, strings.Join(off, ", "))}, nil
+}
+
+// captureBucketPublicAccess records the bucket's public access block settings and its policy
+func captureBucketPublicAccess(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	bucket := target.ResourceName
+	client, off, err := bucketPublicAccessBlock(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	state := &remediations.PreState{PublicAccessBlock: map[string]bool{}}
+	for _, setting := range s3PublicAccessSettings {
+		state.PublicAccessBlock[setting] = !containsString(off, setting)
+	}
+	policy, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	var apiErr smithy.APIError
+	switch {
+	case err == nil:
+		state.BucketPolicy = aws.ToString(policy.Policy)
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchBucketPolicy":
+	default:
+		return nil, fmt.Errorf("failed to read policy of bucket %s: %w", bucket, err)
+	}
+	return state, nil
+}
+
+// restoreBucketPublicAccess turns off again the public access block settings that were off
+// before, which lets the bucket policy's public grants take effect again
+func restoreBucketPublicAccess(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	bucket := target.ResourceName
+	if state.PublicAccessBlock == nil {
+		return nil, nil
+	}
+	client, off, err := bucketPublicAccessBlock(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	var restored []string
+	for _, setting := range s3PublicAccessSettings {
+		if !state.PublicAccessBlock[setting] && !containsString(off, setting) {
+			restored = append(restored, setting)
+		}
+	}
+	if len(restored) == 0 {
+		return nil, nil
+	}
+	_, err = client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &s3types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(state.PublicAccessBlock["BlockPublicAcls"]),
+			IgnorePublicAcls:      aws.Bool(state.PublicAccessBlock["IgnorePublicAcls"]),
+			BlockPublicPolicy:     aws.Bool(state.PublicAccessBlock["BlockPublicPolicy"]),
+			RestrictPublicBuckets: aws.Bool(state.PublicAccessBlock["RestrictPublicBuckets"]),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore public access block of bucket %s: %w", bucket, err)
+	}
+	return []string{fmt.Sprintf("s3:PutPublicAccessBlock on %s: turned off %s", bucket, strings.Join(restored, ", "))}, nil
+}
+
+// describeOpenIngress returns the security group and the internet-wide ranges of its ingress rules
+// that reach a sensitive port or all traffic. Rules open only on other ports, or only to
+// narrower ranges, are left out.
+func describeOpenIngress(ctx context.Context, client *ec2.Client, groupRef string) (*ec2types.SecurityGroup, []ec2types.IpPermission, error) {
+	input := &ec2.DescribeSecurityGroupsInput{GroupIds: []string{groupRef}}
+	if !strings.HasPrefix(groupRef, "sg-") {
+		// CloudTrail names groups of the default VPC by name
+		input = &ec2.DescribeSecurityGroupsInput{GroupNames: []string{groupRef}}
+	}
+	described, err := client.DescribeSecurityGroups(ctx, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe security group %s: %w", groupRef, err)
+	}
+	if len(described.SecurityGroups) == 0 {
+		return nil, nil, fmt.Errorf("security group %s does not exist", groupRef)
+	}
+	group := described.SecurityGroups[0]
+
+	var open []ec2types.IpPermission
+	for _, permission := range group.IpPermissions {
+		if !reachesSensitivePort(permission) {
+			continue
+		}
+		internet := ec2types.IpPermission{IpProtocol: permission.IpProtocol, FromPort: permission.FromPort, ToPort: permission.ToPort}
+		for _, r := range permission.IpRanges {
+			if aws.ToString(r.CidrIp) == "0.0.0.0/0" {
+				internet.IpRanges = append(internet.IpRanges, ec2types.IpRange{CidrIp: r.CidrIp})
+			}
+		}
+		for _, r := range permission.Ipv6Ranges {
+			if aws.ToString(r.CidrIpv6) == "::/0" {
+				internet.Ipv6Ranges = append(internet.Ipv6Ranges, ec2types.Ipv6Range{CidrIpv6: r.CidrIpv6})
+			}
+		}
+		if len(internet.IpRanges) > 0 || len(internet.Ipv6Ranges) > 0 {
+			open = append(open, internet)
+		}
+	}
+	return &group, open, nil
+}
+
+func planRevokeOpenIngress(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	group, open, err := describeOpenIngress(ctx, ec2.NewFromConfig(cfg), target.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	preview := &remediations.Preview{}
+	if len(open) == 0 {
+		return preview, nil
+	}
+	groupID := aws.ToString(group.GroupId)
+	permissions := make([]map[string]interface{}, len(open))
+	for i, permission := range open {
+		for _, cidr := range ingressRanges(permission) {
+			preview.Diff = append(preview.Diff, fmt.Sprintf("- ingress %s from %s on %s", describeIngress(permission), cidr, groupID))
+		}
+		permissions[i] = map[string]interface{}{
+			"IpProtocol": aws.ToString(permission.IpProtocol),
+			"FromPort":   aws.ToInt32(permission.FromPort),
+			"ToPort":     aws.ToInt32(permission.ToPort),
+			"Ranges":     ingressRanges(permission),
+		}
+	}
+	preview.Calls = []remediations.APICall{{
+		Action:     "ec2:RevokeSecurityGroupIngress",
+		Resource:   fmt.Sprintf("arn:aws:ec2:%s:%s:security-group/%s", cfg.Region, target.AccountID, groupID),
+		Parameters: map[string]interface{}{"GroupId": groupID, "IpPermissions": permissions},
+	}}
+	return preview, nil
+}
+
+// revokeOpenIngress revokes the group's internet-wide ingress on sensitive ports
+func revokeOpenIngress(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	client := ec2.NewFromConfig(cfg)
+	group, open, err := describeOpenIngress(ctx, client, target.ResourceID)
+	if err != nil || len(open) == 0 {
+		return nil, err
+	}
+	_, err = client.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{
+		GroupId:       group.GroupId,
+		IpPermissions: open,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke ingress of security group %s: %w", aws.ToString(group.GroupId), err)
+	}
+	changes := make([]string, len(open))
+	for i, permission := range open {
+		changes[i] = fmt.Sprintf("ec2:RevokeSecurityGroupIngress on %s: %s from %s",
+			aws.ToString(group.GroupId), describeIngress(permission), strings.Join(ingressRanges(permission), ", "))
+	}
+	return changes, nil
+}
+
+// captureOpenIngress records the ingress rules revokeOpenIngress is about to revoke, with
+// their descriptions
+func captureOpenIngress(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	group, open, err := describeOpenIngress(ctx, ec2.NewFromConfig(cfg), target.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	state := &remediations.PreState{IngressRules: []remediations.IngressRule{}}
+	for _, permission := range open {
+		rule := remediations.IngressRule{
+			Protocol: aws.ToString(permission.IpProtocol),
+			FromPort: aws.ToInt32(permission.FromPort),
+			ToPort:   aws.ToInt32(permission.ToPort),
+		}
+		for _, r := range permission.IpRanges {
+			rule.CidrIP, rule.CidrIPv6 = aws.ToString(r.CidrIp), ""
+			rule.Description = ingressDescription(group, permission, rule.CidrIP)
+			state.IngressRules = append(state.IngressRules, rule)
+		}
+		for _, r := range permission.Ipv6Ranges {
+			rule.CidrIP, rule.CidrIPv6 = "", aws.ToString(r.CidrIpv6)
+			rule.Description = ingressDescription(group, permission, rule.CidrIPv6)
+			state.IngressRules = append(state.IngressRules, rule)
+		}
+	}
+	return state, nil
+}
+
+// ingressDescription returns the description the group's rule gives a range
+func ingressDescription(group *ec2types.SecurityGroup, permission ec2types.IpPermission, cidr string) string {
+	for _, existing := range group.IpPermissions {
+		if aws.ToString(existing.IpProtocol) != aws.ToString(permission.IpProtocol) ||
+			aws.ToInt32(existing.FromPort) != aws.ToInt32(permission.FromPort) || aws.ToInt32(existing.ToPort) != aws.ToInt32(permission.ToPort) {
+			continue
+		}
+		for _, r := range existing.IpRanges {
+			if aws.ToString(r.CidrIp) == cidr {
+				return aws.ToString(r.Description)
+			}
+		}
+		for _, r := range existing.Ipv6Ranges {
+			if aws.ToString(r.CidrIpv6) == cidr {
+				return aws.ToString(r.Description)
+			}
+		}
+	}
+	return ""
+}
+
+// restoreOpenIngress authorizes the revoked ingress rules again, one range at a time so a
+// rule someone already added back does not stop the others
+func restoreOpenIngress(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	client := ec2.NewFromConfig(cfg)
+	group, _, err := describeOpenIngress(ctx, client, target.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	groupID := aws.ToString(group.GroupId)
+	var changes []string
+	for _, rule := range state.IngressRules {
+		permission := ec2types.IpPermission{IpProtocol: aws.String(rule.Protocol)}
+		if rule.Protocol != "-1" {
+			permission.FromPort, permission.ToPort = aws.Int32(rule.FromPort), aws.Int32(rule.ToPort)
+		}
+		cidr := rule.CidrIP
+		if cidr != "" {
+			permission.IpRanges = []ec2types.IpRange{{CidrIp: aws.String(cidr), Description: optionalString(rule.Description)}}
+		} else {
+			cidr = rule.CidrIPv6
+			permission.Ipv6Ranges = []ec2types.Ipv6Range{{CidrIpv6: aws.String(cidr), Description: optionalString(rule.Description)}}
+		}
+		_, err := client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: []ec2types.IpPermission{permission},
+		})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidPermission.Duplicate" {
+			continue
+		}
+		if err != nil {
+			return changes, fmt.Errorf("failed to authorize ingress %s from %s on %s: %w", describeIngress(permission), cidr, groupID, err)
+		}
+		changes = append(changes, fmt.Sprintf("ec2:AuthorizeSecurityGroupIngress on %s: %s from %s", groupID, describeIngress(permission), cidr))
+	}
+	return changes, nil
+}
+
+// optionalString returns nil for an empty string, for optional API fields
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// reachesSensitivePort reports whether an ingress rule covers one of the ports the exposure
+// analyzer flags, or all traffic
+func reachesSensitivePort(permission ec2types.IpPermission) bool {
+	switch aws.ToString(permission.IpProtocol) {
+	case "-1":
+		return true
+	case "tcp", "6", "udp", "17":
+	default:
+		return false
+	}
+	if permission.FromPort == nil || permission.ToPort == nil {
+		return true
+	}
+	from, to := aws.ToInt32(permission.FromPort), aws.ToInt32(permission.ToPort)
+	for port := range defaultSensitivePorts {
+		if int32(port) >= from && int32(port) <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// describeIngress names an ingress rule's protocol and ports, such as "tcp 22" or "all traffic"
+func describeIngress(permission ec2types.IpPermission) string {
+	protocol := aws.ToString(permission.IpProtocol)
+	if protocol == "-1" {
+		return "all traffic"
+	}
+	from, to := aws.ToInt32(permission.FromPort), aws.ToInt32(permission.ToPort)
+	if from == to {
+		return fmt.Sprintf("%s %d", protocol, from)
+	}
+	return fmt.Sprintf("%s %d-%d", protocol, from, to)
+}
+
+// ingressRanges lists the IPv4 and IPv6 ranges of an ingress rule
+func ingressRanges(permission ec2types.IpPermission) []string {
+	var ranges []string
+	for _, r := range permission.IpRanges {
+		ranges = append(ranges, aws.ToString(r.CidrIp))
+	}
+	for _, r := range permission.Ipv6Ranges {
+		ranges = append(ranges, aws.ToString(r.CidrIpv6))
+	}
+	return ranges
+}
+
+func planAccessKeyRotation(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	userName := target.ResourceName
+	oldKeyID, err := keyToRotate(ctx, iam.NewFromConfig(cfg), KeyRotationRequest{UserName: userName})
+	if err != nil {
+		return nil, err
+	}
+	gracePeriod, err := keyRotationGracePeriod(target)
+	if err != nil {
+		return nil, err
+	}
+	userArn := fmt.Sprintf("arn:aws:iam::%s:user/%s", target.AccountID, userName)
+	secretName := "cloudloom/access-keys/" + userName
+	return &remediations.Preview{
+		Diff: []string{
+			fmt.Sprintf("+ access key for %s, stored in Secrets Manager as %s", userName, secretName),
+			fmt.Sprintf("~ access key %s of %s: Active -> Inactive after %s", oldKeyID, userName, gracePeriod),
+		},
+		Calls: []remediations.APICall{
+			{Action: "iam:CreateAccessKey", Resource: userArn, Parameters: map[string]interface{}{"UserName": userName}},
+			{
+				Action:     "secretsmanager:CreateSecret",
+				Resource:   fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s", cfg.Region, target.AccountID, secretName),
+				Parameters: map[string]interface{}{"Name": secretName},
+			},
+			{
+				Action:     "iam:UpdateAccessKey",
+				Resource:   userArn,
+				Parameters: map[string]interface{}{"UserName": userName, "AccessKeyId": oldKeyID, "Status": "Inactive"},
+			},
+		},
+	}, nil
+}
+
+// rotateFlaggedAccessKey starts the key rotation playbook for the finding's user. The finding
+// stays open until the rotation is confirmed.
+func rotateFlaggedAccessKey(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	gracePeriod, err := keyRotationGracePeriod(target)
+	if err != nil {
+		return nil, err
+	}
+	rotation, _, err := StartKeyRotation(ctx, target.TenantID, KeyRotationRequest{
+		UserName:              target.ResourceName,
+		FindingID:             target.Finding.ID.Hex(),
+		StoreInSecretsManager: true,
+		GracePeriod:           gracePeriod,
+		RequestedBy:           "remediation:" + target.RemediationID,
+		Approved:              target.Approved,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		fmt.Sprintf("iam:CreateAccessKey for %s: created %s, stored in Secrets Manager as %s", rotation.UserName, rotation.NewAccessKeyID, rotation.SecretName),
+		fmt.Sprintf("scheduled deactivation of %s at %s (rotation %s)", rotation.OldAccessKeyID, rotation.DeactivateAt.Format(time.RFC3339), rotation.ID.Hex()),
+	}, nil
+}
+
+// keyRotationGracePeriod is the grace period a playbook step gave the rotation, or the default
+func keyRotationGracePeriod(target *RemediationTarget) (time.Duration, error) {
+	value, ok := target.Parameters[keyRotationGraceParameter]
+	if !ok {
+		return DefaultKeyRotationGracePeriod, nil
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of hours, not %q", keyRotationGraceParameter, value)
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
+
+// ebsEncryptionByDefault reports whether new EBS volumes in the config's region are encrypted
+func ebsEncryptionByDefault(ctx context.Context, client *ec2.Client, region string) (bool, error) {
+	current, err := client.GetEbsEncryptionByDefault(ctx, &ec2.GetEbsEncryptionByDefaultInput{})
+	if err != nil {
+		return false, fmt.Errorf("failed to read EBS encryption default in %s: %w", region, err)
+	}
+	return aws.ToBool(current.EbsEncryptionByDefault), nil
+}
+
+func planEBSEncryptionByDefault(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	enabled, err := ebsEncryptionByDefault(ctx, ec2.NewFromConfig(cfg), cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return &remediations.Preview{}, nil
+	}
+	return &remediations.Preview{
+		Diff: []string{fmt.Sprintf("~ EBS encryption by default in %s: disabled -> enabled", cfg.Region)},
+		Calls: []remediations.APICall{{
+			Action:   "ec2:EnableEbsEncryptionByDefault",
+			Resource: fmt.Sprintf("arn:aws:ec2:%s:%s:volume/*", cfg.Region, target.AccountID),
+		}},
+	}, nil
+}
+
+// enableEBSEncryptionByDefault turns on default EBS encryption in the finding's region, with
+// the account's default KMS key
+func enableEBSEncryptionByDefault(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	client := ec2.NewFromConfig(cfg)
+	enabled, err := ebsEncryptionByDefault(ctx, client, cfg.Region)
+	if err != nil || enabled {
+		return nil, err
+	}
+	if _, err := client.EnableEbsEncryptionByDefault(ctx, &ec2.EnableEbsEncryptionByDefaultInput{}); err != nil {
+		return nil, fmt.Errorf("failed to enable EBS encryption by default in %s: %w", cfg.Region, err)
+	}
+	return []string{fmt.Sprintf("ec2:EnableEbsEncryptionByDefault in %s", cfg.Region)}, nil
+}
+
+// captureEBSEncryptionByDefault records whether EBS encryption by default was on
+func captureEBSEncryptionByDefault(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	enabled, err := ebsEncryptionByDefault(ctx, ec2.NewFromConfig(cfg), cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &remediations.PreState{EBSEncryptionByDefault: aws.Bool(enabled)}, nil
+}
+
+// restoreEBSEncryptionByDefault turns default EBS encryption off again if it was off before.
+// Volumes created while it was on stay encrypted.
+func restoreEBSEncryptionByDefault(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	if state.EBSEncryptionByDefault == nil || *state.EBSEncryptionByDefault {
+		return nil, nil
+	}
+	client := ec2.NewFromConfig(cfg)
+	enabled, err := ebsEncryptionByDefault(ctx, client, cfg.Region)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	if _, err := client.DisableEbsEncryptionByDefault(ctx, &ec2.DisableEbsEncryptionByDefaultInput{}); err != nil {
+		return nil, fmt.Errorf("failed to disable EBS encryption by default in %s: %w", cfg.Region, err)
+	}
+	return []string{fmt.Sprintf("ec2:DisableEbsEncryptionByDefault in %s", cfg.Region)}, nil
+}
+
+// quarantinedUser checks the user can be quarantined and reports whether it already is
+func quarantinedUser(ctx context.Context, client *iam.Client, target *RemediationTarget) (bool, error) {
+	userName, err := quarantinableUser(target)
+	if err != nil {
+		return false, err
+	}
+	attached, err := attachedPolicyArns(ctx, client, userName)
+	if err != nil {
+		return false, err
+	}
+	return containsString(attached, quarantinePolicyArn), nil
+}
+
+// attachedPolicyArns lists the managed policies attached to the user
+func attachedPolicyArns(ctx context.Context, client *iam.Client, userName string) ([]string, error) {
+	attached, err := client.ListAttachedUserPolicies(ctx, &iam.ListAttachedUserPoliciesInput{UserName: aws.String(userName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies of %s: %w", userName, err)
+	}
+	arns := make([]string, len(attached.AttachedPolicies))
+	for i, policy := range attached.AttachedPolicies {
+		arns[i] = aws.ToString(policy.PolicyArn)
+	}
+	return arns, nil
+}
+
+func planQuarantineIAMUser(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	quarantined, err := quarantinedUser(ctx, iam.NewFromConfig(cfg), target)
+	if err != nil {
+		return nil, err
+	}
+	if quarantined {
+		return &remediations.Preview{}, nil
+	}
+	return &remediations.Preview{
+		Diff: []string{fmt.Sprintf("+ policy %s attached to user %s", quarantinePolicyArn, target.ResourceName)},
+		Calls: []remediations.APICall{{
+			Action:     "iam:AttachUserPolicy",
+			Resource:   fmt.Sprintf("arn:aws:iam::%s:user/%s", target.AccountID, target.ResourceName),
+			Parameters: map[string]interface{}{"UserName": target.ResourceName, "PolicyArn": quarantinePolicyArn},
+		}},
+	}, nil
+}
+
+// quarantineIAMUser attaches AWSDenyAll to a user whose credentials GuardDuty saw misused
+func quarantineIAMUser(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	client := iam.NewFromConfig(cfg)
+	quarantined, err := quarantinedUser(ctx, client, target)
+	if err != nil || quarantined {
+		return nil, err
+	}
+	_, err = client.AttachUserPolicy(ctx, &iam.AttachUserPolicyInput{
+		UserName:  aws.String(target.ResourceName),
+		PolicyArn: aws.String(quarantinePolicyArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to quarantine %s: %w", target.ResourceName, err)
+	}
+	return []string{fmt.Sprintf("iam:AttachUserPolicy on %s: attached %s", target.ResourceName, quarantinePolicyArn)}, nil
+}
+
+// captureUserPolicies records the managed policies attached to the user before it is
+// quarantined
+func captureUserPolicies(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	attached, err := attachedPolicyArns(ctx, iam.NewFromConfig(cfg), target.ResourceName)
+	if err != nil {
+		return nil, err
+	}
+	return &remediations.PreState{AttachedPolicyArns: attached}, nil
+}
+
+// releaseIAMUser detaches AWSDenyAll from a quarantined user, unless the user already had it
+// before the quarantine
+func releaseIAMUser(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	if containsString(state.AttachedPolicyArns, quarantinePolicyArn) {
+		return nil, nil
+	}
+	client := iam.NewFromConfig(cfg)
+	quarantined, err := quarantinedUser(ctx, client, target)
+	if err != nil || !quarantined {
+		return nil, err
+	}
+	_, err = client.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{
+		UserName:  aws.String(target.ResourceName),
+		PolicyArn: aws.String(quarantinePolicyArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to release %s from quarantine: %w", target.ResourceName, err)
+	}
+	return []string{fmt.Sprintf("iam:DetachUserPolicy on %s: detached %s", target.ResourceName, quarantinePolicyArn)}, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestReachesSensitivePort(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission ec2types.IpPermission
+		want       bool
+	}{
+		{"all traffic", ec2types.IpPermission{IpProtocol: aws.String("-1")}, true},
+		{"ssh", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}, true},
+		{"range covering rdp", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(3000), ToPort: aws.Int32(4000)}, true},
+		{"numeric udp protocol", ec2types.IpPermission{IpProtocol: aws.String("17"), FromPort: aws.Int32(11211), ToPort: aws.Int32(11211)}, true},
+		{"tcp without ports", ec2types.IpPermission{IpProtocol: aws.String("tcp")}, true},
+		{"https", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443)}, false},
+		{"range between sensitive ports", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(8000), ToPort: aws.Int32(8100)}, false},
+		{"icmp", ec2types.IpPermission{IpProtocol: aws.String("icmp"), FromPort: aws.Int32(-1), ToPort: aws.Int32(-1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reachesSensitivePort(tt.permission); got != tt.want {
+				t.Errorf("reachesSensitivePort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeIngress(t *testing.T) {
+	tests := []struct {
+		permission ec2types.IpPermission
+		want       string
+	}{
+		{ec2types.IpPermission{IpProtocol: aws.String("-1")}, "all traffic"},
+		{ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}, "tcp 22"},
+		{ec2types.IpPermission{IpProtocol: aws.String("udp"), FromPort: aws.Int32(20), ToPort: aws.Int32(25)}, "udp 20-25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := describeIngress(tt.permission); got != tt.want {
+				t.Errorf("describeIngress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngressRanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission ec2types.IpPermission
+		want       []string
+	}{
+		{name: "none", permission: ec2types.IpPermission{IpProtocol: aws.String("-1")}},
+		{
+			name: "ipv4 then ipv6",
+			permission: ec2types.IpPermission{
+				IpRanges:   []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}, {CidrIp: aws.String("10.0.0.0/8")}},
+				Ipv6Ranges: []ec2types.Ipv6Range{{CidrIpv6: aws.String("::/0")}},
+			},
+			want: []string{"0.0.0.0/0", "10.0.0.0/8", "::/0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ingressRanges(tt.permission); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ingressRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngressDescription(t *testing.T) {
+	group := &ec2types.SecurityGroup{IpPermissions: []ec2types.IpPermission{
+		{
+			IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22),
+			IpRanges:   []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0"), Description: aws.String("temporary ssh")}},
+			Ipv6Ranges: []ec2types.Ipv6Range{{CidrIpv6: aws.String("::/0"), Description: aws.String("ssh over ipv6")}},
+		},
+		{
+			IpProtocol: aws.String("tcp"), FromPort: aws.Int32(3389), ToPort: aws.Int32(3389),
+			IpRanges: []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		},
+	}}
+	ssh := ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}
+	tests := []struct {
+		name       string
+		permission ec2types.IpPermission
+		cidr       string
+		want       string
+	}{
+		{"ipv4 range", ssh, "0.0.0.0/0", "temporary ssh"},
+		{"ipv6 range", ssh, "::/0", "ssh over ipv6"},
+		{"range without description", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(3389), ToPort: aws.Int32(3389)}, "0.0.0.0/0", ""},
+		{"other ports", ec2types.IpPermission{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(23)}, "0.0.0.0/0", ""},
+		{"other protocol", ec2types.IpPermission{IpProtocol: aws.String("udp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}, "0.0.0.0/0", ""},
+		{"other range", ssh, "10.0.0.0/8", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ingressDescription(group, tt.permission, tt.cidr); got != tt.want {
+				t.Errorf("ingressDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
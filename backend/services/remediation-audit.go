@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// systemActor is the actor of audit records for events nobody caused, such as a remediation
+// started by a new finding
+const systemActor = "cloudloom"
+
+// remediationEvent is what to record about one event of a remediation
+type remediationEvent struct {
+	event string
+	actor string
+	// changes are what the event changed in the account
+	changes []string
+	// before and after are the state of the resource around the event; before defaults to
+	// the state the remediation captured before it ran
+	before *remediations.PreState
+	after  *remediations.PreState
+	err    string
+}
+
+// recordRemediationEvent appends the event to the tenant's remediation audit trail and posts it
+// to the tenant's webhooks that subscribe to it. Failing to record it is logged and does not
+// undo what already happened in the account.
+func recordRemediationEvent(ctx context.Context, remediation *remediations.Remediation, ev remediationEvent) {
+	dispatchRemediationWebhooks(ctx, remediation, ev.event)
+	notifyRemediation(ctx, remediation, ev.event)
+	trail := audit.DefaultTrail()
+	if trail == nil {
+		return
+	}
+	if ev.actor == "" {
+		ev.actor = systemActor
+	}
+	if ev.before == nil {
+		ev.before = remediation.PreState
+	}
+	reason := remediation.RejectionReason
+	if reason == "" {
+		reason = remediation.GuardrailViolation
+	}
+
+	record := &audit.RemediationRecord{
+		TenantID:      remediation.TenantID,
+		Event:         ev.event,
+		RemediationID: remediation.ID.Hex(),
+		Trigger:       string(remediation.Trigger),
+		Actor:         ev.actor,
+		Playbook:      remediation.Playbook,
+		FindingID:     remediation.FindingID,
+		FindingType:   remediation.FindingType,
+		Action:        remediation.Action,
+		ResourceType:  remediation.ResourceType,
+		ResourceID:    remediation.ResourceID,
+		Region:        remediation.Region,
+		Changes:       ev.changes,
+		Outcome:       string(remediation.Status),
+		Reason:        reason,
+		Error:         ev.err,
+		OccurredAt:    time.Now(),
+	}
+	if remediation.Preview != nil && len(remediation.Preview.Calls) > 0 {
+		record.Calls = auditJSON(remediation.Preview.Calls)
+	}
+	if ev.before != nil {
+		record.Before = auditJSON(ev.before)
+	}
+	if ev.after != nil {
+		record.After = auditJSON(ev.after)
+	}
+	if err := trail.Append(ctx, record); err != nil {
+		log.Printf("[Remediation] Warning: failed to record %s of remediation %s in the audit trail: %v", ev.event, remediation.ID.Hex(), err)
+	}
+}
+
+// currentState captures the state of what the action changes as it is now, for the audit
+// trail, or nil if the action cannot capture it
+func currentState(ctx context.Context, cfg aws.Config, action *RemediationAction, target *RemediationTarget) *remediations.PreState {
+	if action.Capture == nil {
+		return nil
+	}
+	state, err := action.Capture(ctx, cfg, target)
+	if err != nil {
+		log.Printf("[Remediation] Warning: failed to capture the state of %s for the audit trail: %v", target.ResourceID, err)
+		return nil
+	}
+	state.CapturedAt = time.Now()
+	return state
+}
+
+func auditJSON(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// maxEvidenceRecords caps the records in one evidence export
+const maxEvidenceRecords = 50000
+
+// RemediationEvidence collects the tenant's remediation audit records that occurred in
+// [from, to), either of which may be zero, and verifies the whole chain they belong to
+func RemediationEvidence(ctx context.Context, tenantID string, from, to time.Time) (*audit.Evidence, error) {
+	trail := audit.DefaultTrail()
+	if trail == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	records, err := trail.List(ctx, audit.TrailFilter{TenantID: tenantID, From: from, To: to, Limit: maxEvidenceRecords})
+	if err != nil {
+		return nil, err
+	}
+	verification, err := trail.Verify(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &audit.Evidence{
+		TenantID:     tenantID,
+		From:         from,
+		To:           to,
+		Records:      records,
+		Verification: verification,
+		GeneratedAt:  time.Now(),
+	}, nil
+}
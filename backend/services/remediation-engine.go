@@ -0,0 +1,704 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+var (
+	// ErrNoRemediationAction is returned when no registered action fixes a finding's type
+	ErrNoRemediationAction = errors.New("no remediation action fixes this finding")
+	// ErrRemediationActive is returned when an action is already proposed, approved or being
+	// applied for a finding
+	ErrRemediationActive = errors.New("a remediation is already pending or running for this finding")
+	// ErrInvalidRemediation is returned for a review without the reason a rejection needs
+	ErrInvalidRemediation = errors.New("invalid remediation review")
+	// ErrConfirmationRequired is returned when an irreversible action is run without explicit
+	// confirmation
+	ErrConfirmationRequired = errors.New("the remediation is irreversible and must be explicitly confirmed")
+	// ErrRollbackUnavailable is returned for a remediation whose action cannot restore what it
+	// changed, or that captured no state to restore
+	ErrRollbackUnavailable = errors.New("the remediation cannot be rolled back")
+	// ErrRemediationsUnavailable is returned when the remediation or findings store is not
+	// initialized
+	ErrRemediationsUnavailable = errors.New("remediations are not available")
+)
+
+// RemediationTarget is the resource of a finding that an action fixes, resolved from the
+// finding's resource ID, ARN and recorded context
+type RemediationTarget struct {
+	TenantID  string
+	AccountID string
+	Finding   *findings.Finding
+	// ResourceType is the finding's resource type, in CloudFormation or ASFF form
+	ResourceType string
+	// ResourceID is the resource's own ID: the last part of an ARN, or the finding's ID as is
+	ResourceID string
+	// ResourceName is the resource's name when the inventory knows it, otherwise ResourceID
+	ResourceName string
+	Region       string
+	// RemediationID is the log entry of the run
+	RemediationID string
+	// Approved is set when someone approved the run, which lets an action run on a tier that
+	// only suggests fixes
+	Approved bool
+	// Parameters are the ones a playbook step gave the action
+	Parameters map[string]string
+}
+
+// remediationRequest is how a run of an action was asked for
+type remediationRequest struct {
+	trigger     remediations.Trigger
+	requestedBy string
+	confirmed   bool
+	playbook    string
+	parameters  map[string]string
+}
+
+// RemediationAction fixes one kind of finding in the customer account
+type RemediationAction struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parameters are the ones playbook steps may give the action, with what each does
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// FindingTypes are the rule IDs of the findings the action fixes, across all sources. An
+	// action without any is only run by playbooks.
+	FindingTypes []string `json:"findingTypes"`
+	// KeepsFindingOpen is set for actions that finish later, such as a key rotation waiting
+	// for its grace period, so the finding is resolved by whatever completes them
+	KeepsFindingOpen bool `json:"keepsFindingOpen,omitempty"`
+	// Permissions lists what the action may do anywhere in the account
+	Permissions func(accountID string) []Permission `json:"-"`
+	// Reversibility says whether the action's changes can be undone; irreversible actions only
+	// run once someone confirms them
+	Reversibility     remediations.Reversibility `json:"reversibility"`
+	ReversibilityNote string                     `json:"reversibilityNote,omitempty"`
+	// Plan reads the target and returns the diff and API calls Apply would make. It changes
+	// nothing; no calls means the resource is already fixed.
+	Plan func(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) `json:"-"`
+	// Apply fixes the target with the assumed-role credentials and describes each change it
+	// made. An action that finds the resource already fixed changes nothing and succeeds.
+	Apply func(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) `json:"-"`
+	// Capture reads the state Apply is about to change, so Rollback can restore it. A run whose
+	// state cannot be captured fails without changing anything.
+	Capture func(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) `json:"-"`
+	// Rollback restores the captured state and describes each change it made. Actions without
+	// it cannot be rolled back.
+	Rollback func(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) `json:"-"`
+}
+
+// RemediationEngine applies registered remediation actions to findings and records every run
+// in the remediation log
+type RemediationEngine struct {
+	mu      sync.RWMutex
+	actions map[string]*RemediationAction
+	byType  map[string]*RemediationAction
+}
+
+// NewRemediationEngine returns an engine with no actions registered
+func NewRemediationEngine() *RemediationEngine {
+	return &RemediationEngine{actions: map[string]*RemediationAction{}, byType: map[string]*RemediationAction{}}
+}
+
+var (
+	defaultRemediationEngine     *RemediationEngine
+	defaultRemediationEngineOnce sync.Once
+)
+
+// DefaultRemediationEngine returns the process-wide engine with the built-in actions registered
+func DefaultRemediationEngine() *RemediationEngine {
+	defaultRemediationEngineOnce.Do(func() {
+		defaultRemediationEngine = NewRemediationEngine()
+		for _, action := range builtinRemediationActions() {
+			if err := defaultRemediationEngine.Register(action); err != nil {
+				log.Printf("[Remediation] Warning: %v", err)
+			}
+		}
+	})
+	return defaultRemediationEngine
+}
+
+// Register adds an action. A finding type may be fixed by only one action; actions without
+// finding types only run as playbook steps.
+func (e *RemediationEngine) Register(action *RemediationAction) error {
+	if action.Name == "" || action.Apply == nil {
+		return fmt.Errorf("remediation action %q needs a name and an apply function", action.Name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.actions[action.Name]; exists {
+		return fmt.Errorf("remediation action %s is already registered", action.Name)
+	}
+	for _, findingType := range action.FindingTypes {
+		if other, taken := e.byType[findingType]; taken {
+			return fmt.Errorf("finding type %s is already fixed by remediation action %s", findingType, other.Name)
+		}
+	}
+	e.actions[action.Name] = action
+	for _, findingType := range action.FindingTypes {
+		e.byType[findingType] = action
+	}
+	return nil
+}
+
+// Actions returns the registered actions by name
+func (e *RemediationEngine) Actions() []*RemediationAction {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := make([]*RemediationAction, 0, len(e.actions))
+	for _, action := range e.actions {
+		result = append(result, action)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Action returns the action registered under the name, or nil
+func (e *RemediationEngine) Action(name string) *RemediationAction {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.actions[name]
+}
+
+// ActionFor returns the action that fixes the finding's type, or nil
+func (e *RemediationEngine) ActionFor(f *findings.Finding) *RemediationAction {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.byType[f.RuleID]
+}
+
+// Permissions lists what every registered action may do in the account
+func (e *RemediationEngine) Permissions(accountID string) []Permission {
+	var required []Permission
+	for _, action := range e.Actions() {
+		if action.Permissions != nil {
+			required = append(required, action.Permissions(accountID)...)
+		}
+	}
+	return required
+}
+
+// Remediate applies the action for the finding's type with the tenant's assumed role and
+// records the run, with the preview worked out right before it, in the remediation log. Only
+// tiers that apply fixes may remediate without approval, and an irreversible action needs
+// confirmed. When the tenant's guardrails protect the resource or the hourly cap is reached,
+// the remediation is proposed for approval instead, or blocked with ErrGuardrailViolation.
+// The run is returned even when the action failed.
+func (e *RemediationEngine) Remediate(ctx context.Context, tenantID string, f *findings.Finding, trigger remediations.Trigger, requestedBy string, confirmed bool) (*remediations.Remediation, error) {
+	return e.remediate(ctx, tenantID, f, e.ActionFor(f), remediationRequest{trigger: trigger, requestedBy: requestedBy, confirmed: confirmed})
+}
+
+func (e *RemediationEngine) remediate(ctx context.Context, tenantID string, f *findings.Finding, action *RemediationAction, req remediationRequest) (*remediations.Remediation, error) {
+	store, err := e.prepare(ctx, tenantID, f, action)
+	if err != nil {
+		return nil, err
+	}
+	if action.Reversibility == remediations.Irreversible && !req.confirmed {
+		return nil, fmt.Errorf("%w: %s", ErrConfirmationRequired, action.ReversibilityNote)
+	}
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tier := service.tier(); !tier.AppliesFixes() {
+		return nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	cfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	target := newRemediationTarget(ctx, tenantID, f, cfg.Region)
+	target.Parameters = req.parameters
+	remediation := newRemediation(f, action, target, req)
+	remediation.Preview = previewAction(ctx, inRegion(cfg, target.Region), action, target)
+	reason, policy, err := guardrailViolation(ctx, store, tenantID, f, target, remediation.Preview)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return remediation, holdForGuardrails(ctx, store, remediation, policy, reason)
+	}
+	now := time.Now()
+	remediation.Status, remediation.StartedAt = remediations.StatusRunning, &now
+	if err := store.Create(ctx, remediation); err != nil {
+		return nil, err
+	}
+	return remediation, e.apply(ctx, service, cfg, action, target, remediation)
+}
+
+// Propose records a pending remediation for the finding, with a preview of what the action
+// would change worked out from the resource as it is now, for someone to approve or reject.
+// Tiers that only suggest fixes get proposals instead of remediations.
+func (e *RemediationEngine) Propose(ctx context.Context, tenantID string, f *findings.Finding) (*remediations.Remediation, error) {
+	return e.propose(ctx, tenantID, f, e.ActionFor(f), remediationRequest{trigger: remediations.TriggerApproval})
+}
+
+func (e *RemediationEngine) propose(ctx context.Context, tenantID string, f *findings.Finding, action *RemediationAction, req remediationRequest) (*remediations.Remediation, error) {
+	store, err := e.prepare(ctx, tenantID, f, action)
+	if err != nil {
+		return nil, err
+	}
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tier := service.tier(); !tier.Analyzes() {
+		return nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	cfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	target := newRemediationTarget(ctx, tenantID, f, cfg.Region)
+	target.Parameters = req.parameters
+	remediation := newRemediation(f, action, target, req)
+	remediation.Status = remediations.StatusPending
+	remediation.Preview = previewAction(ctx, inRegion(cfg, target.Region), action, target)
+	if err := store.Create(ctx, remediation); err != nil {
+		return nil, err
+	}
+	recordRemediationEvent(ctx, remediation, remediationEvent{event: audit.EventProposed, actor: req.requestedBy})
+	log.Printf("[Remediation] 📝 Proposed %s for %s of tenant %s", action.Name, f.ResourceID, tenantID)
+	return remediation, nil
+}
+
+// Review approves or rejects a pending remediation. A rejection needs a reason.
+func (e *RemediationEngine) Review(ctx context.Context, tenantID, id string, approve bool, reviewer, reason string) (*remediations.Remediation, error) {
+	store := remediations.Default()
+	if store == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	if !approve && strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: a reason is required to reject a remediation", ErrInvalidRemediation)
+	}
+	remediation, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if remediation.Status != remediations.StatusPending {
+		return nil, fmt.Errorf("%w: only pending remediations can be reviewed (status is %s)", remediations.ErrConflict, remediation.Status)
+	}
+
+	now := time.Now()
+	remediation.Status, remediation.ReviewedBy, remediation.ReviewedAt = remediations.StatusApproved, reviewer, &now
+	if !approve {
+		remediation.Status, remediation.RejectionReason = remediations.StatusRejected, reason
+	}
+	if err := store.Transition(ctx, remediation, remediations.StatusPending); err != nil {
+		return nil, err
+	}
+	event := audit.EventApproved
+	if !approve {
+		event = audit.EventRejected
+	}
+	recordRemediationEvent(ctx, remediation, remediationEvent{event: event, actor: reviewer})
+	log.Printf("[Remediation] %s %s of tenant %s was %s by %s", remediation.Action, remediation.ResourceID, tenantID, remediation.Status, reviewer)
+	return remediation, nil
+}
+
+// Execute applies an approved remediation, after working its preview out again from the
+// resource's current state. Approval is what lets a tier that only suggests fixes have one
+// applied; the role must still grant the action's permissions, and an irreversible action needs
+// confirmed. The remediation is returned even when the action failed.
+func (e *RemediationEngine) Execute(ctx context.Context, tenantID, id, requestedBy string, confirmed bool) (*remediations.Remediation, error) {
+	store := remediations.Default()
+	if store == nil || findings.Default() == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	remediation, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if remediation.Status != remediations.StatusApproved {
+		return nil, fmt.Errorf("%w: only approved remediations can be executed (status is %s)", remediations.ErrConflict, remediation.Status)
+	}
+	action := e.Action(remediation.Action)
+	if action == nil {
+		return nil, fmt.Errorf("%w: action %s is no longer registered", ErrNoRemediationAction, remediation.Action)
+	}
+	if action.Reversibility == remediations.Irreversible && !confirmed {
+		return nil, fmt.Errorf("%w: %s", ErrConfirmationRequired, action.ReversibilityNote)
+	}
+	f, err := findings.Default().Get(ctx, tenantID, remediation.FindingID)
+	if err != nil {
+		return nil, err
+	}
+	if f.Status == findings.StatusResolved {
+		return nil, fmt.Errorf("%w: finding %s was resolved after the remediation was approved", remediations.ErrConflict, remediation.FindingID)
+	}
+
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tier := service.tier(); !tier.Analyzes() {
+		return nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	cfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	target := newRemediationTarget(ctx, tenantID, f, cfg.Region)
+	target.Approved, target.Parameters = true, remediation.Parameters
+	remediation.Preview = previewAction(ctx, inRegion(cfg, target.Region), action, target)
+	now := time.Now()
+	remediation.Status, remediation.RequestedBy, remediation.StartedAt = remediations.StatusRunning, requestedBy, &now
+	remediation.Confirmed = confirmed
+	if err := store.Transition(ctx, remediation, remediations.StatusApproved); err != nil {
+		return nil, err
+	}
+	return remediation, e.apply(ctx, service, cfg, action, target, remediation)
+}
+
+// Rollback restores the state a succeeded remediation captured before it ran, so a fix that
+// went too far can be undone, and reopens the finding the remediation resolved. Like Execute it
+// needs a tier that analyzes and a role that grants the action's permissions. The remediation
+// is returned even when the rollback failed, with RollbackError saying why.
+func (e *RemediationEngine) Rollback(ctx context.Context, tenantID, id, requestedBy string) (*remediations.Remediation, error) {
+	store := remediations.Default()
+	if store == nil || findings.Default() == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	remediation, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if remediation.Status != remediations.StatusSucceeded {
+		return nil, fmt.Errorf("%w: only succeeded remediations can be rolled back (status is %s)", remediations.ErrConflict, remediation.Status)
+	}
+	action := e.Action(remediation.Action)
+	if action == nil || action.Rollback == nil {
+		return nil, fmt.Errorf("%w: action %s does not support rollback", ErrRollbackUnavailable, remediation.Action)
+	}
+	if remediation.PreState == nil {
+		return nil, fmt.Errorf("%w: no state was captured before %s ran", ErrRollbackUnavailable, remediation.Action)
+	}
+	f, err := findings.Default().Get(ctx, tenantID, remediation.FindingID)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tier := service.tier(); !tier.Analyzes() {
+		return nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	cfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+
+	target := newRemediationTarget(ctx, tenantID, f, cfg.Region)
+	target.RemediationID, target.Parameters = remediation.ID.Hex(), remediation.Parameters
+	if action.Permissions != nil {
+		if err := SimulateRolePermissions(ctx, cfg, service.roleArn(), action.Permissions(target.AccountID)); err != nil {
+			return nil, err
+		}
+	}
+	remediation.Status = remediations.StatusRollingBack
+	if err := store.Transition(ctx, remediation, remediations.StatusSucceeded); err != nil {
+		return nil, err
+	}
+
+	before := currentState(ctx, inRegion(cfg, target.Region), action, target)
+	changes, rollbackErr := action.Rollback(ctx, inRegion(cfg, target.Region), target, remediation.PreState)
+	now := time.Now()
+	remediation.RollbackChanges, remediation.RolledBackBy = changes, requestedBy
+	if rollbackErr != nil {
+		remediation.Status, remediation.RollbackError = remediations.StatusSucceeded, rollbackErr.Error()
+	} else {
+		remediation.Status, remediation.RollbackError, remediation.RolledBackAt = remediations.StatusRolledBack, "", &now
+	}
+	if err := store.Transition(ctx, remediation, remediations.StatusRollingBack); err != nil {
+		return nil, err
+	}
+	rolledBack := remediationEvent{event: audit.EventRolledBack, actor: requestedBy, changes: changes, before: before, err: remediation.RollbackError}
+	if rollbackErr == nil {
+		rolledBack.after = currentState(ctx, inRegion(cfg, target.Region), action, target)
+	}
+	recordRemediationEvent(ctx, remediation, rolledBack)
+	if rollbackErr != nil {
+		log.Printf("[Remediation] ❌ Rollback of %s on %s of tenant %s failed: %v", action.Name, remediation.ResourceID, tenantID, rollbackErr)
+		return remediation, nil
+	}
+	log.Printf("[Remediation] ↩️ Rolled back %s on %s of tenant %s (%d changes)", action.Name, remediation.ResourceID, tenantID, len(changes))
+
+	if !action.KeepsFindingOpen && f.Status == findings.StatusResolved {
+		_, err := findings.Default().BulkUpdateStatus(ctx, tenantID, []string{remediation.FindingID}, findings.StatusUpdate{
+			Status: findings.StatusOpen,
+			Reason: "remediation " + action.Name + " rolled back",
+		})
+		if err != nil {
+			log.Printf("[Remediation] Warning: failed to reopen finding %s: %v", remediation.FindingID, err)
+		}
+	}
+	return remediation, nil
+}
+
+// prepare checks there is an action for the finding and that it is not already proposed or
+// running for it
+func (e *RemediationEngine) prepare(ctx context.Context, tenantID string, f *findings.Finding, action *RemediationAction) (*remediations.Store, error) {
+	store := remediations.Default()
+	if store == nil || findings.Default() == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	if action == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoRemediationAction, f.RuleID)
+	}
+	active, err := store.HasActive(ctx, tenantID, f.Fingerprint, action.Name)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		return nil, ErrRemediationActive
+	}
+	return store, nil
+}
+
+// apply runs a remediation already saved as running and records its outcome. A successful run
+// resolves the finding unless the action keeps it open. Only failing to check permissions or
+// to save the outcome is returned as an error; the action's own failure is in the remediation.
+func (e *RemediationEngine) apply(ctx context.Context, service *CloudTrailService, cfg aws.Config, action *RemediationAction, target *RemediationTarget, remediation *remediations.Remediation) error {
+	store := remediations.Default()
+	var changes []string
+	var applyErr error
+	if action.Permissions != nil {
+		applyErr = SimulateRolePermissions(ctx, cfg, service.roleArn(), action.Permissions(target.AccountID))
+	}
+	if applyErr == nil && action.Capture != nil {
+		remediation.PreState, applyErr = captureState(ctx, inRegion(cfg, target.Region), action, target)
+	}
+	if applyErr == nil {
+		target.RemediationID = remediation.ID.Hex()
+		changes, applyErr = action.Apply(ctx, inRegion(cfg, target.Region), target)
+	}
+	if err := store.Complete(ctx, remediation, changes, applyErr); err != nil {
+		return err
+	}
+	executed := remediationEvent{event: audit.EventExecuted, actor: remediation.RequestedBy, changes: changes, err: remediation.Error}
+	if applyErr == nil {
+		executed.after = currentState(ctx, inRegion(cfg, target.Region), action, target)
+	}
+	recordRemediationEvent(ctx, remediation, executed)
+	if applyErr != nil {
+		log.Printf("[Remediation] ❌ %s failed on %s of tenant %s: %v", action.Name, remediation.ResourceID, target.TenantID, applyErr)
+		return nil
+	}
+	log.Printf("[Remediation] ✅ %s fixed %s of tenant %s (%d changes)", action.Name, remediation.ResourceID, target.TenantID, len(changes))
+
+	if !action.KeepsFindingOpen {
+		if _, err := findings.Default().Close(ctx, target.TenantID, remediation.Fingerprint, findings.StatusResolved, "remediated by "+action.Name); err != nil {
+			log.Printf("[Remediation] Warning: failed to resolve finding %s: %v", remediation.FindingID, err)
+		}
+	}
+	return nil
+}
+
+// captureState reads the state the action is about to change
+func captureState(ctx context.Context, cfg aws.Config, action *RemediationAction, target *RemediationTarget) (*remediations.PreState, error) {
+	state, err := action.Capture(ctx, cfg, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture the state to roll back to: %w", err)
+	}
+	state.CapturedAt = time.Now()
+	return state, nil
+}
+
+// newRemediation starts the log entry of an action on a finding's resource
+func newRemediation(f *findings.Finding, action *RemediationAction, target *RemediationTarget, req remediationRequest) *remediations.Remediation {
+	return &remediations.Remediation{
+		TenantID:     target.TenantID,
+		FindingID:    f.ID.Hex(),
+		Fingerprint:  f.Fingerprint,
+		FindingType:  f.RuleID,
+		Action:       action.Name,
+		ResourceType: f.ResourceType,
+		ResourceID:   f.ResourceID,
+		Region:       target.Region,
+		Trigger:      req.trigger,
+		Playbook:     req.playbook,
+		Parameters:   req.parameters,
+		RequestedBy:  req.requestedBy,
+		Confirmed:    req.confirmed,
+	}
+}
+
+// previewAction works out what the action would do to the target. When the resource cannot be
+// read the preview says why and has only the action's description as its diff.
+func previewAction(ctx context.Context, cfg aws.Config, action *RemediationAction, target *RemediationTarget) *remediations.Preview {
+	preview := &remediations.Preview{Diff: []string{"~ " + action.Description}}
+	if action.Plan == nil {
+		preview.Error = "the action cannot preview its changes"
+	} else if planned, err := action.Plan(ctx, cfg, target); err != nil {
+		preview.Error = "current state could not be read: " + err.Error()
+	} else {
+		preview = planned
+		if preview.NoChanges() {
+			preview.Diff = []string{"  no changes: " + target.ResourceName + " is already fixed"}
+		}
+	}
+	if preview.Calls == nil {
+		preview.Calls = []remediations.APICall{}
+	}
+	preview.ResourceArns = []string{}
+	for _, call := range preview.Calls {
+		if call.Resource != "*" && !containsString(preview.ResourceArns, call.Resource) {
+			preview.ResourceArns = append(preview.ResourceArns, call.Resource)
+		}
+	}
+	preview.Reversibility, preview.ReversibilityNote = action.Reversibility, action.ReversibilityNote
+	preview.GeneratedAt = time.Now()
+	return preview
+}
+
+// PreviewFinding is a dry run of the action for one of the tenant's findings: it works out the
+// preview without recording or changing anything
+func PreviewFinding(ctx context.Context, tenantID, findingID string) (*remediations.Preview, error) {
+	store := findings.Default()
+	if store == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	f, err := store.Get(ctx, tenantID, findingID)
+	if err != nil {
+		return nil, err
+	}
+	action := DefaultRemediationEngine().ActionFor(f)
+	if action == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoRemediationAction, f.RuleID)
+	}
+	service, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tier := service.tier(); !tier.Analyzes() {
+		return nil, fmt.Errorf("%w: %s is on the %s tier", ErrFixesNotAllowed, tenantID, tier)
+	}
+	cfg, err := service.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	target := newRemediationTarget(ctx, tenantID, f, cfg.Region)
+	return previewAction(ctx, inRegion(cfg, target.Region), action, target), nil
+}
+
+// RemediateFinding applies the action for one of the tenant's findings on a user's request
+func RemediateFinding(ctx context.Context, tenantID, findingID, requestedBy string, confirmed bool) (*remediations.Remediation, error) {
+	store := findings.Default()
+	if store == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	f, err := store.Get(ctx, tenantID, findingID)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultRemediationEngine().Remediate(ctx, tenantID, f, remediations.TriggerManual, requestedBy, confirmed)
+}
+
+// processSecurityFinding handles a finding Upsert just opened or reopened when an action fixes
+// its type: tiers that apply fixes remediate it, tiers that only suggest them, and irreversible
+// actions on any tier, get a proposal to approve. A playbook of the tenant's that matches the
+// finding runs instead. Failures are logged and never fail the ingestion that recorded the
+// finding.
+func processSecurityFinding(ctx context.Context, f *findings.Finding) {
+	if f.ID.IsZero() || f.Status != findings.StatusOpen || f.Excluded || remediations.Default() == nil {
+		return
+	}
+	if runMatchingPlaybook(ctx, f) {
+		return
+	}
+	engine := DefaultRemediationEngine()
+	action := engine.ActionFor(f)
+	if action == nil {
+		return
+	}
+	service, err := cloudTrailServiceFor(ctx, f.TenantID)
+	if err != nil {
+		log.Printf("[Remediation] Warning: not remediating finding %s of tenant %s: %v", f.ID.Hex(), f.TenantID, err)
+		return
+	}
+	switch tier := service.tier(); {
+	case tier.AppliesFixes() && action.Reversibility != remediations.Irreversible:
+		_, err = engine.Remediate(ctx, f.TenantID, f, remediations.TriggerAutomatic, "", false)
+	case tier.Analyzes():
+		_, err = engine.Propose(ctx, f.TenantID, f)
+	}
+	if err != nil {
+		log.Printf("[Remediation] Warning: not remediating finding %s of tenant %s: %v", f.ID.Hex(), f.TenantID, err)
+	}
+}
+
+// upsertFinding records a finding and hands it to the remediation engine when it is new or
+// reopened, then tells the tenant's notifiers about it, with the fix proposed for it if any
+func upsertFinding(ctx context.Context, store *findings.Store, f *findings.Finding) error {
+	if err := store.Upsert(ctx, f, time.Now()); err != nil {
+		return err
+	}
+	processSecurityFinding(ctx, f)
+	notifyFinding(ctx, f)
+	return nil
+}
+
+// recordFinding records a finding that is not remediated and tells the tenant's notifiers
+// about it when it is new or reopened
+func recordFinding(ctx context.Context, store *findings.Store, f *findings.Finding) error {
+	if err := store.Upsert(ctx, f, time.Now()); err != nil {
+		return err
+	}
+	notifyFinding(ctx, f)
+	return nil
+}
+
+// newRemediationTarget resolves the resource a finding is about. The region is the one the
+// inventory recorded, else the one in the resource's ARN, else the tenant's home region.
+func newRemediationTarget(ctx context.Context, tenantID string, f *findings.Finding, homeRegion string) *RemediationTarget {
+	target := &RemediationTarget{
+		TenantID:     tenantID,
+		AccountID:    tenantID,
+		Finding:      f,
+		ResourceType: f.ResourceType,
+		ResourceID:   f.ResourceID,
+		Region:       homeRegion,
+	}
+	if strings.HasPrefix(f.ResourceID, "arn:") {
+		parts := strings.SplitN(f.ResourceID, ":", 6)
+		if len(parts) == 6 {
+			if parts[3] != "" {
+				target.Region = parts[3]
+			}
+			target.ResourceID = parts[5][strings.LastIndexAny(parts[5], "/:")+1:]
+		}
+	}
+	target.ResourceName = target.ResourceID
+
+	resource := f.Context
+	if resource == nil && strings.HasPrefix(f.ResourceType, "AWS::") {
+		if item := inventoryResource(ctx, tenantID, f.ResourceType, f.ResourceID); item != nil {
+			resource = resourceContext(item)
+		}
+	}
+	if resource != nil {
+		if resource.ResourceName != "" {
+			target.ResourceName = resource.ResourceName
+		}
+		if resource.Region != "" && resource.Region != "global" {
+			target.Region = resource.Region
+		}
+	}
+	return target
+}
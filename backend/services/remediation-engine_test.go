@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func noopApply(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	return nil, nil
+}
+
+func TestRemediationEngineRegister(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  *RemediationAction
+		wantErr bool
+	}{
+		{"new action", &RemediationAction{Name: "close-port", FindingTypes: []string{"port-open"}, Apply: noopApply}, false},
+		{"playbook-only action", &RemediationAction{Name: "notify", Apply: noopApply}, false},
+		{"no name", &RemediationAction{FindingTypes: []string{"other"}, Apply: noopApply}, true},
+		{"no apply", &RemediationAction{Name: "no-apply", FindingTypes: []string{"other"}}, true},
+		{"duplicate name", &RemediationAction{Name: "existing", Apply: noopApply}, true},
+		{"finding type taken", &RemediationAction{Name: "rival", FindingTypes: []string{"other", "bucket-public"}, Apply: noopApply}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewRemediationEngine()
+			existing := &RemediationAction{Name: "existing", FindingTypes: []string{"bucket-public"}, Apply: noopApply}
+			if err := engine.Register(existing); err != nil {
+				t.Fatal(err)
+			}
+			err := engine.Register(tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got := engine.ActionFor(&findings.Finding{RuleID: "other"}); got != nil {
+					t.Errorf("rejected action fixes %q", "other")
+				}
+				if got := engine.ActionFor(&findings.Finding{RuleID: "bucket-public"}); got != existing {
+					t.Errorf("ActionFor(bucket-public) = %v, want the existing action", got)
+				}
+				return
+			}
+			if got := engine.Action(tt.action.Name); got != tt.action {
+				t.Errorf("Action(%q) = %v, want the registered action", tt.action.Name, got)
+			}
+			for _, findingType := range tt.action.FindingTypes {
+				if got := engine.ActionFor(&findings.Finding{RuleID: findingType}); got != tt.action {
+					t.Errorf("ActionFor(%q) = %v, want the registered action", findingType, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRemediationEngineActions(t *testing.T) {
+	engine := NewRemediationEngine()
+	for _, name := range []string{"b", "c", "a"} {
+		if err := engine.Register(&RemediationAction{Name: name, Apply: noopApply}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var names []string
+	for _, action := range engine.Actions() {
+		names = append(names, action.Name)
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Errorf("Actions() = %v, want [a b c]", names)
+	}
+	if got := engine.ActionFor(&findings.Finding{RuleID: "unknown"}); got != nil {
+		t.Errorf("ActionFor(unknown) = %v, want nil", got)
+	}
+}
+
+func TestBuiltinRemediationActionsRegister(t *testing.T) {
+	engine := NewRemediationEngine()
+	for _, action := range builtinRemediationActions() {
+		if err := engine.Register(action); err != nil {
+			t.Errorf("Register(%s) error = %v", action.Name, err)
+		}
+		if action.Permissions == nil || len(action.Permissions("111122223333")) == 0 {
+			t.Errorf("%s lists no permissions", action.Name)
+		}
+	}
+	for _, findingType := range []string{ExposureS3PublicAccess, ExposureOpenSecurityGroup, AnomalyOpenIngress} {
+		if engine.ActionFor(&findings.Finding{RuleID: findingType}) == nil {
+			t.Errorf("no built-in action fixes %s", findingType)
+		}
+	}
+}
+
+func TestNewRemediationTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		finding    *findings.Finding
+		wantID     string
+		wantName   string
+		wantRegion string
+	}{
+		{
+			name:       "plain resource ID",
+			finding:    &findings.Finding{ResourceType: "AwsEc2SecurityGroup", ResourceID: "sg-0123"},
+			wantID:     "sg-0123",
+			wantName:   "sg-0123",
+			wantRegion: "us-east-1",
+		},
+		{
+			name:       "regional ARN",
+			finding:    &findings.Finding{ResourceType: "AwsEc2SecurityGroup", ResourceID: "arn:aws:ec2:eu-west-1:111122223333:security-group/sg-0123"},
+			wantID:     "sg-0123",
+			wantName:   "sg-0123",
+			wantRegion: "eu-west-1",
+		},
+		{
+			name:       "global ARN",
+			finding:    &findings.Finding{ResourceType: "AwsIamUser", ResourceID: "arn:aws:iam::111122223333:user/path/alice"},
+			wantID:     "alice",
+			wantName:   "alice",
+			wantRegion: "us-east-1",
+		},
+		{
+			name:       "bucket ARN",
+			finding:    &findings.Finding{ResourceType: "AwsS3Bucket", ResourceID: "arn:aws:s3:::logs-bucket"},
+			wantID:     "logs-bucket",
+			wantName:   "logs-bucket",
+			wantRegion: "us-east-1",
+		},
+		{
+			name: "recorded context",
+			finding: &findings.Finding{
+				ResourceType: "AWS::EC2::SecurityGroup",
+				ResourceID:   "sg-0123",
+				Context:      &findings.ResourceContext{ResourceName: "web", Region: "ap-south-1"},
+			},
+			wantID:     "sg-0123",
+			wantName:   "web",
+			wantRegion: "ap-south-1",
+		},
+		{
+			name: "global context keeps the home region",
+			finding: &findings.Finding{
+				ResourceType: "AWS::IAM::User",
+				ResourceID:   "AIDAEXAMPLE",
+				Context:      &findings.ResourceContext{ResourceName: "alice", Region: "global"},
+			},
+			wantID:     "AIDAEXAMPLE",
+			wantName:   "alice",
+			wantRegion: "us-east-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newRemediationTarget(context.Background(), "111122223333", tt.finding, "us-east-1")
+			if target.ResourceID != tt.wantID || target.ResourceName != tt.wantName || target.Region != tt.wantRegion {
+				t.Errorf("target = %s/%s/%s, want %s/%s/%s", target.ResourceID, target.ResourceName, target.Region, tt.wantID, tt.wantName, tt.wantRegion)
+			}
+			if target.AccountID != "111122223333" || target.Finding != tt.finding {
+				t.Errorf("target does not carry the tenant's account and finding")
+			}
+		})
+	}
+}
+
+func TestNewRemediation(t *testing.T) {
+	f := &findings.Finding{
+		ID:           primitive.NewObjectID(),
+		Fingerprint:  "fp-1",
+		RuleID:       ExposureOpenSecurityGroup,
+		ResourceType: "AWS::EC2::SecurityGroup",
+		ResourceID:   "arn:aws:ec2:eu-west-1:111122223333:security-group/sg-0123",
+	}
+	action := &RemediationAction{Name: ActionRevokeOpenIngress, Apply: noopApply}
+	target := &RemediationTarget{TenantID: "111122223333", Region: "eu-west-1"}
+	req := remediationRequest{trigger: remediations.TriggerPlaybook, requestedBy: "alice", confirmed: true, playbook: "lockdown", parameters: map[string]string{"k": "v"}}
+
+	got := newRemediation(f, action, target, req)
+	want := &remediations.Remediation{
+		TenantID:     "111122223333",
+		FindingID:    f.ID.Hex(),
+		Fingerprint:  "fp-1",
+		FindingType:  ExposureOpenSecurityGroup,
+		Action:       ActionRevokeOpenIngress,
+		ResourceType: "AWS::EC2::SecurityGroup",
+		ResourceID:   f.ResourceID,
+		Region:       "eu-west-1",
+		Trigger:      remediations.TriggerPlaybook,
+		Playbook:     "lockdown",
+		Parameters:   map[string]string{"k": "v"},
+		RequestedBy:  "alice",
+		Confirmed:    true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newRemediation() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuiltinRemediationActionsCanRollBack(t *testing.T) {
+	for _, action := range builtinRemediationActions() {
+		if action.Rollback != nil && action.Capture == nil {
+			t.Errorf("%s can roll back but captures no state to restore", action.Name)
+		}
+	}
+}
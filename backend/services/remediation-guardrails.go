@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/guardrails"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// ErrGuardrailViolation is returned when the tenant's guardrails refuse a remediation
+var ErrGuardrailViolation = errors.New("a guardrail refused the remediation")
+
+// RemediationEventGuardrail is the kind of event published when a guardrail stops a remediation
+const RemediationEventGuardrail = "remediation.guardrail"
+
+// GuardrailEvent is published to the tenant's notification topic when a guardrail queues or
+// refuses a remediation
+type GuardrailEvent struct {
+	Kind          string               `json:"kind"`
+	TenantID      string               `json:"tenantId"`
+	RemediationID string               `json:"remediationId"`
+	FindingID     string               `json:"findingId"`
+	Action        string               `json:"action"`
+	ResourceID    string               `json:"resourceId"`
+	Trigger       remediations.Trigger `json:"trigger"`
+	Reason        string               `json:"reason"`
+	// Outcome is queued when the remediation waits for approval, refused when it was blocked
+	Outcome    string    `json:"outcome"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// guardrailViolation returns why the tenant's guardrails stop an unreviewed remediation of the
+// finding from running now, with the guardrails, or "" if they let it run. The resource is
+// checked by the finding's resource ID and the ARNs the preview says the action changes, and
+// the hourly cap counts every remediation started in the last hour. Guardrails that cannot be
+// read stop the remediation.
+func guardrailViolation(ctx context.Context, store *remediations.Store, tenantID string, f *findings.Finding, target *RemediationTarget, preview *remediations.Preview) (string, *guardrails.Guardrails, error) {
+	if guardrails.Default() == nil {
+		return "", nil, nil
+	}
+	policy, err := guardrails.Default().Get(ctx, tenantID)
+	if errors.Is(err, guardrails.ErrNotFound) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	identifiers := []string{f.ResourceID, target.ResourceID}
+	if preview != nil {
+		identifiers = append(identifiers, preview.ResourceArns...)
+	}
+	var tags map[string]string
+	if f.Context != nil {
+		tags = f.Context.Tags
+	}
+	if reason := policy.Protects(identifiers, tags); reason != "" {
+		return reason, policy, nil
+	}
+
+	if policy.MaxActionsPerHour > 0 {
+		started, err := store.CountStartedSince(ctx, tenantID, time.Now().Add(-time.Hour))
+		if err != nil {
+			return "", nil, err
+		}
+		if started >= int64(policy.MaxActionsPerHour) {
+			return fmt.Sprintf("%d remediations already started in the last hour (limit %d)", started, policy.MaxActionsPerHour), policy, nil
+		}
+	}
+	return "", policy, nil
+}
+
+// holdForGuardrails records a remediation the guardrails stopped, as a proposal to approve or,
+// when they refuse violations, as blocked, and raises an alert. Only a refusal is an error.
+func holdForGuardrails(ctx context.Context, store *remediations.Store, remediation *remediations.Remediation, policy *guardrails.Guardrails, reason string) error {
+	remediation.GuardrailViolation = reason
+	remediation.Status = remediations.StatusPending
+	outcome := "queued"
+	if policy.OnViolation == guardrails.OnViolationRefuse {
+		remediation.Status, remediation.Error = remediations.StatusBlocked, reason
+		outcome = "refused"
+	}
+	if err := store.Create(ctx, remediation); err != nil {
+		return err
+	}
+	recorded := audit.EventProposed
+	if remediation.Status == remediations.StatusBlocked {
+		recorded = audit.EventBlocked
+	}
+	recordRemediationEvent(ctx, remediation, remediationEvent{event: recorded, actor: remediation.RequestedBy, err: remediation.Error})
+	log.Printf("[Remediation] 🛑 Guardrail %s %s on %s of tenant %s: %s", outcome, remediation.Action, remediation.ResourceID, remediation.TenantID, reason)
+
+	event := GuardrailEvent{
+		Kind:          RemediationEventGuardrail,
+		TenantID:      remediation.TenantID,
+		RemediationID: remediation.ID.Hex(),
+		FindingID:     remediation.FindingID,
+		Action:        remediation.Action,
+		ResourceID:    remediation.ResourceID,
+		Trigger:       remediation.Trigger,
+		Reason:        reason,
+		Outcome:       outcome,
+		OccurredAt:    remediation.CreatedAt,
+	}
+	if err := publishGuardrailEvent(ctx, event); err != nil {
+		log.Printf("[Remediation] Warning: failed to alert tenant %s of guardrail violation: %v", remediation.TenantID, err)
+	}
+
+	if remediation.Status == remediations.StatusBlocked {
+		return fmt.Errorf("%w: %s", ErrGuardrailViolation, reason)
+	}
+	return nil
+}
+
+// publishGuardrailEvent sends the event to the tenant's notification topic as JSON, under a
+// subject people can read in an email
+func publishGuardrailEvent(ctx context.Context, event GuardrailEvent) error {
+	subject := fmt.Sprintf("CloudLoom: guardrail %s %s on %s in account %s", event.Outcome, event.Action, event.ResourceID, event.TenantID)
+	message, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Kind, err)
+	}
+	if DemoModeEnabled() {
+		log.Printf("[Remediation] %s: %s", subject, message)
+		return nil
+	}
+	return PublishNotification(ctx, event.TenantID, subject, string(message))
+}
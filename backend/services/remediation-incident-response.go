@@ -0,0 +1,735 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// revokeSessionsPolicyName is the inline role policy that denies sessions issued before it was
+// written, named as the IAM console names it when revoking a role's sessions
+const revokeSessionsPolicyName = "AWSRevokeOlderSessions"
+
+// Tags put on the snapshots taken of a compromised instance, so they can be found as evidence
+// of the finding and the remediation that took them
+const (
+	TagFindingID     = "cloudloom:finding-id"
+	TagRemediationID = "cloudloom:remediation-id"
+)
+
+// credentialCompromiseFindingTypes are the GuardDuty findings that the credentials of an IAM
+// user or role are in someone else's hands: misused from known-bad addresses, used in ways the
+// principal never was, or taken from an instance's metadata service
+var credentialCompromiseFindingTypes = []string{
+	"UnauthorizedAccess:IAMUser/TorIPCaller",
+	"UnauthorizedAccess:IAMUser/MaliciousIPCaller",
+	"UnauthorizedAccess:IAMUser/MaliciousIPCaller.Custom",
+	"UnauthorizedAccess:IAMUser/ConsoleLoginSuccess.B",
+	"UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.OutsideAWS",
+	"UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration.InsideAWS",
+	"CredentialAccess:IAMUser/AnomalousBehavior",
+	"InitialAccess:IAMUser/AnomalousBehavior",
+	"Persistence:IAMUser/AnomalousBehavior",
+	"PrivilegeEscalation:IAMUser/AnomalousBehavior",
+	"Exfiltration:IAMUser/AnomalousBehavior",
+	"Impact:IAMUser/AnomalousBehavior",
+	"UnauthorizedAccess:EC2/MetadataDNSRebind",
+}
+
+// incidentResponseActions are the actions that contain compromised credentials. Each step is
+// an action of its own that playbooks can run; the incident response runs the ones for the
+// finding's resource in order when GuardDuty reports a compromise.
+func incidentResponseActions() []*RemediationAction {
+	quarantineUser := &RemediationAction{
+		Name:        ActionQuarantineIAMUser,
+		Description: "Attaches the AWSDenyAll managed policy to the user so its credentials can do nothing",
+		Permissions: func(accountID string) []Permission {
+			userArn := fmt.Sprintf("arn:aws:iam::%s:user/*", accountID)
+			return []Permission{
+				{Action: "iam:ListAttachedUserPolicies", Resource: userArn},
+				{Action: "iam:AttachUserPolicy", Resource: userArn},
+				{Action: "iam:DetachUserPolicy", Resource: userArn},
+			}
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "Detaching AWSDenyAll from the user gives its credentials back their access",
+		Plan:              planQuarantineIAMUser,
+		Apply:             quarantineIAMUser,
+		Capture:           captureUserPolicies,
+		Rollback:          releaseIAMUser,
+	}
+	deactivateKeys := &RemediationAction{
+		Name:        ActionDeactivateAccessKeys,
+		Description: "Deactivates every active access key of the user",
+		Permissions: func(accountID string) []Permission {
+			userArn := fmt.Sprintf("arn:aws:iam::%s:user/*", accountID)
+			return []Permission{
+				{Action: "iam:ListAccessKeys", Resource: userArn},
+				{Action: "iam:UpdateAccessKey", Resource: userArn},
+			}
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "The deactivated keys can be made active again with UpdateAccessKey",
+		Plan:              planDeactivateAccessKeys,
+		Apply:             deactivateAccessKeys,
+		Capture:           captureActiveAccessKeys,
+		Rollback:          reactivateAccessKeys,
+	}
+	quarantineRole := &RemediationAction{
+		Name:        ActionQuarantineIAMRole,
+		Description: "Attaches the AWSDenyAll managed policy to the role so its sessions can do nothing",
+		Permissions: func(accountID string) []Permission {
+			roleArn := fmt.Sprintf("arn:aws:iam::%s:role/*", accountID)
+			return []Permission{
+				{Action: "iam:ListAttachedRolePolicies", Resource: roleArn},
+				{Action: "iam:AttachRolePolicy", Resource: roleArn},
+				{Action: "iam:DetachRolePolicy", Resource: roleArn},
+			}
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "Detaching AWSDenyAll from the role gives its sessions back their access",
+		Plan:              planQuarantineIAMRole,
+		Apply:             quarantineIAMRole,
+		Capture:           captureRolePolicies,
+		Rollback:          releaseIAMRole,
+	}
+	revokeSessions := &RemediationAction{
+		Name:        ActionRevokeRoleSessions,
+		Description: "Denies everything to sessions of the role issued before now with the AWSRevokeOlderSessions inline policy",
+		Permissions: func(accountID string) []Permission {
+			roleArn := fmt.Sprintf("arn:aws:iam::%s:role/*", accountID)
+			return []Permission{
+				{Action: "iam:GetRolePolicy", Resource: roleArn},
+				{Action: "iam:PutRolePolicy", Resource: roleArn},
+				{Action: "iam:DeleteRolePolicy", Resource: roleArn},
+			}
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "Removing the AWSRevokeOlderSessions policy, or restoring the one it replaced, lets the revoked sessions work again",
+		Plan:              planRevokeRoleSessions,
+		Apply:             revokeRoleSessions,
+		Capture:           captureRoleSessionPolicy,
+		Rollback:          restoreRoleSessionPolicy,
+	}
+	snapshotInstance := &RemediationAction{
+		Name:        ActionSnapshotInstance,
+		Description: "Snapshots every EBS volume attached to the instance, tagged with the finding, for forensics",
+		Permissions: func(accountID string) []Permission {
+			return []Permission{
+				{Action: "ec2:DescribeInstances", Resource: "*"},
+				{Action: "ec2:DescribeSnapshots", Resource: "*"},
+				{Action: "ec2:CreateSnapshots", Resource: fmt.Sprintf("arn:aws:ec2:*:%s:instance/*", accountID)},
+				{Action: "ec2:CreateSnapshots", Resource: fmt.Sprintf("arn:aws:ec2:*:%s:volume/*", accountID)},
+				{Action: "ec2:CreateSnapshots", Resource: "arn:aws:ec2:*::snapshot/*"},
+				{Action: "ec2:CreateTags", Resource: "arn:aws:ec2:*::snapshot/*"},
+			}
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "Only adds snapshots and leaves the instance as it is; the snapshots are kept as evidence",
+		Plan:              planSnapshotInstance,
+		Apply:             snapshotCompromisedInstance,
+	}
+
+	response := incidentResponse{
+		"AWS::IAM::User":     {quarantineUser, deactivateKeys},
+		"AWS::IAM::Role":     {quarantineRole, revokeSessions},
+		"AWS::EC2::Instance": {snapshotInstance},
+	}
+	respond := &RemediationAction{
+		Name: ActionRespondToCredentialCompromise,
+		Description: "Contains compromised credentials: quarantines a user and deactivates its access keys, " +
+			"quarantines a role and revokes its sessions, or snapshots an instance",
+		FindingTypes: credentialCompromiseFindingTypes,
+		Permissions: func(accountID string) []Permission {
+			var required []Permission
+			for _, step := range []*RemediationAction{quarantineUser, deactivateKeys, quarantineRole, revokeSessions, snapshotInstance} {
+				required = append(required, step.Permissions(accountID)...)
+			}
+			return required
+		},
+		Reversibility:     remediations.Reversible,
+		ReversibilityNote: "Rolling back detaches AWSDenyAll, reactivates the keys and removes the session revocation; snapshots are kept as evidence",
+		Plan:              response.plan,
+		Apply:             response.apply,
+		Capture:           response.capture,
+		Rollback:          response.rollback,
+	}
+	return []*RemediationAction{quarantineUser, deactivateKeys, quarantineRole, revokeSessions, snapshotInstance, respond}
+}
+
+// incidentResponse maps each resource type a compromise finding can be about to the actions
+// that contain it, in the order they run
+type incidentResponse map[string][]*RemediationAction
+
+func (r incidentResponse) steps(target *RemediationTarget) ([]*RemediationAction, error) {
+	steps := r[target.ResourceType]
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("there is no incident response for %s resources", target.ResourceType)
+	}
+	return steps, nil
+}
+
+// plan joins the previews of the steps
+func (r incidentResponse) plan(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	steps, err := r.steps(target)
+	if err != nil {
+		return nil, err
+	}
+	preview := &remediations.Preview{}
+	for _, step := range steps {
+		planned, err := step.Plan(ctx, cfg, target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step.Name, err)
+		}
+		preview.Diff = append(preview.Diff, planned.Diff...)
+		preview.Calls = append(preview.Calls, planned.Calls...)
+	}
+	return preview, nil
+}
+
+// apply runs the steps in order and stops at the first that fails, returning the changes made
+// so far
+func (r incidentResponse) apply(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	steps, err := r.steps(target)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	for _, step := range steps {
+		made, err := step.Apply(ctx, cfg, target)
+		changes = append(changes, made...)
+		if err != nil {
+			return changes, fmt.Errorf("%s: %w", step.Name, err)
+		}
+	}
+	return changes, nil
+}
+
+// capture records the state of each step that can restore what it changes
+func (r incidentResponse) capture(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	steps, err := r.steps(target)
+	if err != nil {
+		return nil, err
+	}
+	state := &remediations.PreState{Steps: map[string]*remediations.PreState{}}
+	for _, step := range steps {
+		if step.Capture == nil {
+			continue
+		}
+		captured, err := step.Capture(ctx, cfg, target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step.Name, err)
+		}
+		state.Steps[step.Name] = captured
+	}
+	return state, nil
+}
+
+// rollback undoes the steps in reverse order, skipping those that cannot be undone
+func (r incidentResponse) rollback(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	steps, err := r.steps(target)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		captured := state.Steps[step.Name]
+		if step.Rollback == nil || captured == nil {
+			continue
+		}
+		made, err := step.Rollback(ctx, cfg, target, captured)
+		changes = append(changes, made...)
+		if err != nil {
+			return changes, fmt.Errorf("%s: %w", step.Name, err)
+		}
+	}
+	return changes, nil
+}
+
+// quarantinableUser returns the name of the user the target is about. The root user cannot be
+// quarantined or have its keys managed this way.
+func quarantinableUser(target *RemediationTarget) (string, error) {
+	userName := target.ResourceName
+	if userName == "" || userName == "Root" || userName == target.AccountID {
+		return "", fmt.Errorf("%q is not an IAM user that can be quarantined", userName)
+	}
+	return userName, nil
+}
+
+// activeAccessKeys lists the IDs of the user's active access keys
+func activeAccessKeys(ctx context.Context, client *iam.Client, userName string) ([]string, error) {
+	out, err := client.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: aws.String(userName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access keys of %s: %w", userName, err)
+	}
+	var active []string
+	for _, key := range out.AccessKeyMetadata {
+		if key.Status == iamtypes.StatusTypeActive {
+			active = append(active, aws.ToString(key.AccessKeyId))
+		}
+	}
+	return active, nil
+}
+
+func planDeactivateAccessKeys(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	userName, err := quarantinableUser(target)
+	if err != nil {
+		return nil, err
+	}
+	active, err := activeAccessKeys(ctx, iam.NewFromConfig(cfg), userName)
+	if err != nil {
+		return nil, err
+	}
+	preview := &remediations.Preview{}
+	userArn := fmt.Sprintf("arn:aws:iam::%s:user/%s", target.AccountID, userName)
+	for _, keyID := range active {
+		preview.Diff = append(preview.Diff, fmt.Sprintf("~ access key %s of %s: Active -> Inactive", keyID, userName))
+		preview.Calls = append(preview.Calls, remediations.APICall{
+			Action:     "iam:UpdateAccessKey",
+			Resource:   userArn,
+			Parameters: map[string]interface{}{"UserName": userName, "AccessKeyId": keyID, "Status": "Inactive"},
+		})
+	}
+	return preview, nil
+}
+
+// deactivateAccessKeys makes every active access key of the user inactive, so whoever holds
+// them can no longer sign requests
+func deactivateAccessKeys(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	userName, err := quarantinableUser(target)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg)
+	active, err := activeAccessKeys(ctx, client, userName)
+	if err != nil {
+		return nil, err
+	}
+	return setAccessKeyStatus(ctx, client, userName, active, iamtypes.StatusTypeInactive)
+}
+
+// captureActiveAccessKeys records which of the user's access keys are active
+func captureActiveAccessKeys(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	userName, err := quarantinableUser(target)
+	if err != nil {
+		return nil, err
+	}
+	active, err := activeAccessKeys(ctx, iam.NewFromConfig(cfg), userName)
+	if err != nil {
+		return nil, err
+	}
+	return &remediations.PreState{ActiveAccessKeyIDs: active}, nil
+}
+
+// reactivateAccessKeys makes the keys that were active before the remediation active again.
+// Keys deleted since are skipped.
+func reactivateAccessKeys(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	userName, err := quarantinableUser(target)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg)
+	active, err := activeAccessKeys(ctx, client, userName)
+	if err != nil {
+		return nil, err
+	}
+	var inactive []string
+	for _, keyID := range state.ActiveAccessKeyIDs {
+		if !containsString(active, keyID) {
+			inactive = append(inactive, keyID)
+		}
+	}
+	return setAccessKeyStatus(ctx, client, userName, inactive, iamtypes.StatusTypeActive)
+}
+
+func setAccessKeyStatus(ctx context.Context, client *iam.Client, userName string, keyIDs []string, status iamtypes.StatusType) ([]string, error) {
+	var changes []string
+	for _, keyID := range keyIDs {
+		_, err := client.UpdateAccessKey(ctx, &iam.UpdateAccessKeyInput{
+			UserName:    aws.String(userName),
+			AccessKeyId: aws.String(keyID),
+			Status:      status,
+		})
+		var missing *iamtypes.NoSuchEntityException
+		if errors.As(err, &missing) {
+			continue
+		}
+		if err != nil {
+			return changes, fmt.Errorf("failed to set access key %s of %s to %s: %w", keyID, userName, status, err)
+		}
+		changes = append(changes, fmt.Sprintf("iam:UpdateAccessKey on %s: %s is now %s", userName, keyID, status))
+	}
+	return changes, nil
+}
+
+// quarantinableRole returns the name of the role the target is about. The role CloudLoom
+// assumes in the account is never quarantined, since that would lock CloudLoom out of the
+// response and its rollback.
+func quarantinableRole(ctx context.Context, target *RemediationTarget) (string, error) {
+	roleName := target.ResourceName
+	if roleName == "" {
+		return "", fmt.Errorf("the finding names no IAM role to quarantine")
+	}
+	service, err := cloudTrailServiceFor(ctx, target.TenantID)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(service.roleArn(), "/"+roleName) {
+		return "", fmt.Errorf("%s is the role CloudLoom uses in the account and cannot be quarantined", roleName)
+	}
+	return roleName, nil
+}
+
+// attachedRolePolicyArns lists the managed policies attached to the role
+func attachedRolePolicyArns(ctx context.Context, client *iam.Client, roleName string) ([]string, error) {
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies of role %s: %w", roleName, err)
+	}
+	arns := make([]string, len(attached.AttachedPolicies))
+	for i, policy := range attached.AttachedPolicies {
+		arns[i] = aws.ToString(policy.PolicyArn)
+	}
+	return arns, nil
+}
+
+func planQuarantineIAMRole(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	attached, err := attachedRolePolicyArns(ctx, iam.NewFromConfig(cfg), roleName)
+	if err != nil {
+		return nil, err
+	}
+	if containsString(attached, quarantinePolicyArn) {
+		return &remediations.Preview{}, nil
+	}
+	return &remediations.Preview{
+		Diff: []string{fmt.Sprintf("+ policy %s attached to role %s", quarantinePolicyArn, roleName)},
+		Calls: []remediations.APICall{{
+			Action:     "iam:AttachRolePolicy",
+			Resource:   fmt.Sprintf("arn:aws:iam::%s:role/%s", target.AccountID, roleName),
+			Parameters: map[string]interface{}{"RoleName": roleName, "PolicyArn": quarantinePolicyArn},
+		}},
+	}, nil
+}
+
+// quarantineIAMRole attaches AWSDenyAll to a role whose credentials GuardDuty saw misused
+func quarantineIAMRole(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg)
+	attached, err := attachedRolePolicyArns(ctx, client, roleName)
+	if err != nil || containsString(attached, quarantinePolicyArn) {
+		return nil, err
+	}
+	_, err = client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+		RoleName:  aws.String(roleName),
+		PolicyArn: aws.String(quarantinePolicyArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to quarantine role %s: %w", roleName, err)
+	}
+	return []string{fmt.Sprintf("iam:AttachRolePolicy on %s: attached %s", roleName, quarantinePolicyArn)}, nil
+}
+
+// captureRolePolicies records the managed policies attached to the role before it is
+// quarantined
+func captureRolePolicies(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	attached, err := attachedRolePolicyArns(ctx, iam.NewFromConfig(cfg), roleName)
+	if err != nil {
+		return nil, err
+	}
+	return &remediations.PreState{AttachedPolicyArns: attached}, nil
+}
+
+// releaseIAMRole detaches AWSDenyAll from a quarantined role, unless the role already had it
+// before the quarantine
+func releaseIAMRole(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	if containsString(state.AttachedPolicyArns, quarantinePolicyArn) {
+		return nil, nil
+	}
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg)
+	attached, err := attachedRolePolicyArns(ctx, client, roleName)
+	if err != nil || !containsString(attached, quarantinePolicyArn) {
+		return nil, err
+	}
+	_, err = client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+		RoleName:  aws.String(roleName),
+		PolicyArn: aws.String(quarantinePolicyArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to release role %s from quarantine: %w", roleName, err)
+	}
+	return []string{fmt.Sprintf("iam:DetachRolePolicy on %s: detached %s", roleName, quarantinePolicyArn)}, nil
+}
+
+// revokeSessionsPolicy denies every action to sessions whose credentials were issued before
+// the given time. Sessions started after it, including the role's legitimate users assuming it
+// again, are unaffected.
+func revokeSessionsPolicy(issuedBefore time.Time) (string, error) {
+	document, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":   "Deny",
+			"Action":   []string{"*"},
+			"Resource": []string{"*"},
+			"Condition": map[string]interface{}{
+				"DateLessThan": map[string]string{"aws:TokenIssueTime": issuedBefore.UTC().Format(time.RFC3339)},
+			},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session revocation policy: %w", err)
+	}
+	return string(document), nil
+}
+
+// roleSessionPolicy returns the document of the role's AWSRevokeOlderSessions policy, or nil
+// if it has none
+func roleSessionPolicy(ctx context.Context, client *iam.Client, roleName string) (*string, error) {
+	out, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
+		RoleName:   aws.String(roleName),
+		PolicyName: aws.String(revokeSessionsPolicyName),
+	})
+	var missing *iamtypes.NoSuchEntityException
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s policy of role %s: %w", revokeSessionsPolicyName, roleName, err)
+	}
+	// IAM returns inline policy documents URL-encoded
+	document, err := url.QueryUnescape(aws.ToString(out.PolicyDocument))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s policy of role %s: %w", revokeSessionsPolicyName, roleName, err)
+	}
+	return &document, nil
+}
+
+func planRevokeRoleSessions(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := roleSessionPolicy(ctx, iam.NewFromConfig(cfg), roleName)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	document, err := revokeSessionsPolicy(now)
+	if err != nil {
+		return nil, err
+	}
+	change := "+"
+	if existing != nil {
+		change = "~"
+	}
+	return &remediations.Preview{
+		Diff: []string{fmt.Sprintf("%s inline policy %s of role %s: deny sessions issued before %s",
+			change, revokeSessionsPolicyName, roleName, now.UTC().Format(time.RFC3339))},
+		Calls: []remediations.APICall{{
+			Action:   "iam:PutRolePolicy",
+			Resource: fmt.Sprintf("arn:aws:iam::%s:role/%s", target.AccountID, roleName),
+			Parameters: map[string]interface{}{
+				"RoleName":       roleName,
+				"PolicyName":     revokeSessionsPolicyName,
+				"PolicyDocument": document,
+			},
+		}},
+	}, nil
+}
+
+// revokeRoleSessions denies everything to the role's sessions issued until now, so credentials
+// taken from it stop working before they expire
+func revokeRoleSessions(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	document, err := revokeSessionsPolicy(now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = iam.NewFromConfig(cfg).PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(revokeSessionsPolicyName),
+		PolicyDocument: aws.String(document),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions of role %s: %w", roleName, err)
+	}
+	return []string{fmt.Sprintf("iam:PutRolePolicy on %s: %s denies sessions issued before %s",
+		roleName, revokeSessionsPolicyName, now.UTC().Format(time.RFC3339))}, nil
+}
+
+// captureRoleSessionPolicy records the AWSRevokeOlderSessions policy the role already had, if
+// any, since revoking sessions replaces it
+func captureRoleSessionPolicy(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := roleSessionPolicy(ctx, iam.NewFromConfig(cfg), roleName)
+	if err != nil {
+		return nil, err
+	}
+	return &remediations.PreState{RoleSessionPolicy: existing}, nil
+}
+
+// restoreRoleSessionPolicy puts back the AWSRevokeOlderSessions policy the role had before, or
+// deletes it if the role had none
+func restoreRoleSessionPolicy(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+	roleName, err := quarantinableRole(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	client := iam.NewFromConfig(cfg)
+	if state.RoleSessionPolicy != nil {
+		_, err := client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+			RoleName:       aws.String(roleName),
+			PolicyName:     aws.String(revokeSessionsPolicyName),
+			PolicyDocument: state.RoleSessionPolicy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %s policy of role %s: %w", revokeSessionsPolicyName, roleName, err)
+		}
+		return []string{fmt.Sprintf("iam:PutRolePolicy on %s: restored the previous %s", roleName, revokeSessionsPolicyName)}, nil
+	}
+
+	_, err = client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(roleName),
+		PolicyName: aws.String(revokeSessionsPolicyName),
+	})
+	var missing *iamtypes.NoSuchEntityException
+	if errors.As(err, &missing) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove %s policy of role %s: %w", revokeSessionsPolicyName, roleName, err)
+	}
+	return []string{fmt.Sprintf("iam:DeleteRolePolicy on %s: removed %s", roleName, revokeSessionsPolicyName)}, nil
+}
+
+// instanceVolumes lists the EBS volumes attached to the instance
+func instanceVolumes(ctx context.Context, client *ec2.Client, instanceID string) ([]string, error) {
+	out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+	}
+	var volumes []string
+	for _, reservation := range out.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, mapping := range instance.BlockDeviceMappings {
+				if mapping.Ebs != nil {
+					volumes = append(volumes, aws.ToString(mapping.Ebs.VolumeId))
+				}
+			}
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("instance %s has no EBS volumes to snapshot", instanceID)
+	}
+	return volumes, nil
+}
+
+// findingSnapshotsTaken reports whether snapshots were already taken for the finding, so a
+// finding reopened or run again does not snapshot the instance twice
+func findingSnapshotsTaken(ctx context.Context, client *ec2.Client, target *RemediationTarget) (bool, error) {
+	out, err := client.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{
+		OwnerIds: []string{"self"},
+		Filters:  []ec2types.Filter{{Name: aws.String("tag:" + TagFindingID), Values: []string{target.Finding.ID.Hex()}}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list snapshots of finding %s: %w", target.Finding.ID.Hex(), err)
+	}
+	return len(out.Snapshots) > 0, nil
+}
+
+func planSnapshotInstance(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.Preview, error) {
+	client := ec2.NewFromConfig(cfg)
+	taken, err := findingSnapshotsTaken(ctx, client, target)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return &remediations.Preview{}, nil
+	}
+	volumes, err := instanceVolumes(ctx, client, target.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	preview := &remediations.Preview{
+		Calls: []remediations.APICall{{
+			Action:   "ec2:CreateSnapshots",
+			Resource: fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", cfg.Region, target.AccountID, target.ResourceID),
+			Parameters: map[string]interface{}{
+				"InstanceSpecification": map[string]interface{}{"InstanceId": target.ResourceID, "ExcludeBootVolume": false},
+				"CopyTagsFromSource":    "volume",
+			},
+		}},
+	}
+	for _, volume := range volumes {
+		preview.Diff = append(preview.Diff, fmt.Sprintf("+ snapshot of %s attached to %s", volume, target.ResourceName))
+	}
+	return preview, nil
+}
+
+// snapshotCompromisedInstance takes crash-consistent snapshots of all the instance's volumes at
+// once, tagged with the finding and the remediation, so the disks can be examined as they were
+// when GuardDuty reported the compromise
+func snapshotCompromisedInstance(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+	client := ec2.NewFromConfig(cfg)
+	taken, err := findingSnapshotsTaken(ctx, client, target)
+	if err != nil || taken {
+		return nil, err
+	}
+	out, err := client.CreateSnapshots(ctx, &ec2.CreateSnapshotsInput{
+		InstanceSpecification: &ec2types.InstanceSpecification{
+			InstanceId:        aws.String(target.ResourceID),
+			ExcludeBootVolume: aws.Bool(false),
+		},
+		Description:        aws.String(fmt.Sprintf("CloudLoom incident response for finding %s (%s)", target.Finding.ID.Hex(), target.Finding.RuleID)),
+		CopyTagsFromSource: ec2types.CopyTagsFromSourceVolume,
+		TagSpecifications: []ec2types.TagSpecification{{
+			ResourceType: ec2types.ResourceTypeSnapshot,
+			Tags: []ec2types.Tag{
+				{Key: aws.String(TagManaged), Value: aws.String("true")},
+				{Key: aws.String(TagFindingID), Value: aws.String(target.Finding.ID.Hex())},
+				{Key: aws.String(TagRemediationID), Value: aws.String(target.RemediationID)},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot instance %s: %w", target.ResourceID, err)
+	}
+	changes := make([]string, len(out.Snapshots))
+	for i, snapshot := range out.Snapshots {
+		changes[i] = fmt.Sprintf("ec2:CreateSnapshots on %s: %s of %s", target.ResourceID, aws.ToString(snapshot.SnapshotId), aws.ToString(snapshot.VolumeId))
+	}
+	return changes, nil
+}
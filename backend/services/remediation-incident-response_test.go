@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// fakeStep is an incident response step that records when it runs
+func fakeStep(name string, ran *[]string, applyErr error, reversible bool) *RemediationAction {
+	step := &RemediationAction{
+		Name: name,
+		Apply: func(ctx context.Context, cfg aws.Config, target *RemediationTarget) ([]string, error) {
+			*ran = append(*ran, "apply "+name)
+			if applyErr != nil {
+				return nil, applyErr
+			}
+			return []string{name + " applied"}, nil
+		},
+	}
+	if reversible {
+		step.Capture = func(ctx context.Context, cfg aws.Config, target *RemediationTarget) (*remediations.PreState, error) {
+			return &remediations.PreState{ActiveAccessKeyIDs: []string{name}}, nil
+		}
+		step.Rollback = func(ctx context.Context, cfg aws.Config, target *RemediationTarget, state *remediations.PreState) ([]string, error) {
+			*ran = append(*ran, "rollback "+state.ActiveAccessKeyIDs[0])
+			return []string{name + " restored"}, nil
+		}
+	}
+	return step
+}
+
+func TestIncidentResponseApply(t *testing.T) {
+	failed := errors.New("access denied")
+	tests := []struct {
+		name        string
+		failAt      string
+		wantRan     []string
+		wantChanges []string
+		wantErr     bool
+	}{
+		{
+			name:        "all steps succeed",
+			wantRan:     []string{"apply first", "apply second", "apply third"},
+			wantChanges: []string{"first applied", "second applied", "third applied"},
+		},
+		{
+			name:        "stops at the failed step",
+			failAt:      "second",
+			wantRan:     []string{"apply first", "apply second"},
+			wantChanges: []string{"first applied"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			var steps []*RemediationAction
+			for _, name := range []string{"first", "second", "third"} {
+				var err error
+				if name == tt.failAt {
+					err = failed
+				}
+				steps = append(steps, fakeStep(name, &ran, err, true))
+			}
+			response := incidentResponse{"AwsIamUser": steps}
+			changes, err := response.apply(context.Background(), aws.Config{}, &RemediationTarget{ResourceType: "AwsIamUser"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, failed) {
+				t.Errorf("apply() error = %v, want it to wrap %v", err, failed)
+			}
+			if !reflect.DeepEqual(ran, tt.wantRan) {
+				t.Errorf("ran %v, want %v", ran, tt.wantRan)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("apply() changes = %v, want %v", changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestIncidentResponseRollback(t *testing.T) {
+	var ran []string
+	response := incidentResponse{"AwsIamUser": {
+		fakeStep("first", &ran, nil, true),
+		fakeStep("irreversible", &ran, nil, false),
+		fakeStep("second", &ran, nil, true),
+		fakeStep("uncaptured", &ran, nil, true),
+	}}
+	target := &RemediationTarget{ResourceType: "AwsIamUser"}
+	state, err := response.capture(context.Background(), aws.Config{}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Steps["irreversible"]; ok {
+		t.Errorf("capture() recorded state for a step without Capture")
+	}
+	delete(state.Steps, "uncaptured")
+
+	changes, err := response.rollback(context.Background(), aws.Config{}, target, state)
+	if err != nil {
+		t.Fatalf("rollback() error = %v", err)
+	}
+	if want := []string{"rollback second", "rollback first"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if want := []string{"second restored", "first restored"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("rollback() changes = %v, want %v", changes, want)
+	}
+}
+
+func TestIncidentResponseUnknownResourceType(t *testing.T) {
+	var ran []string
+	response := incidentResponse{"AwsIamUser": {fakeStep("first", &ran, nil, true)}}
+	if _, err := response.apply(context.Background(), aws.Config{}, &RemediationTarget{ResourceType: "AwsS3Bucket"}); err == nil {
+		t.Error("apply() on a resource type without steps succeeded")
+	}
+	if len(ran) != 0 {
+		t.Errorf("ran %v, want nothing", ran)
+	}
+}
+
+func TestQuarantinableUser(t *testing.T) {
+	tests := []struct {
+		resourceName string
+		wantErr      bool
+	}{
+		{"alice", false},
+		{"", true},
+		{"Root", true},
+		{"111122223333", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resourceName, func(t *testing.T) {
+			target := &RemediationTarget{AccountID: "111122223333", ResourceName: tt.resourceName}
+			userName, err := quarantinableUser(target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("quarantinableUser(%q) error = %v, wantErr %v", tt.resourceName, err, tt.wantErr)
+			}
+			if !tt.wantErr && userName != tt.resourceName {
+				t.Errorf("quarantinableUser(%q) = %q", tt.resourceName, userName)
+			}
+		})
+	}
+}
+
+func TestRevokeSessionsPolicy(t *testing.T) {
+	issuedBefore := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("IST", 5*3600+1800))
+	document, err := revokeSessionsPolicy(issuedBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Version   string
+		Statement []struct {
+			Effect    string
+			Action    []string
+			Resource  []string
+			Condition map[string]map[string]string
+		}
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		t.Fatalf("policy is not valid JSON: %v", err)
+	}
+	if policy.Version != "2012-10-17" || len(policy.Statement) != 1 {
+		t.Fatalf("policy = %s", document)
+	}
+	statement := policy.Statement[0]
+	if statement.Effect != "Deny" || !reflect.DeepEqual(statement.Action, []string{"*"}) || !reflect.DeepEqual(statement.Resource, []string{"*"}) {
+		t.Errorf("statement = %+v, want a deny of everything", statement)
+	}
+	if got := statement.Condition["DateLessThan"]["aws:TokenIssueTime"]; got != "2024-03-01T07:00:00Z" {
+		t.Errorf("aws:TokenIssueTime = %q, want 2024-03-01T07:00:00Z", got)
+	}
+}
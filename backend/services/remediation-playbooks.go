@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/email"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/playbooks"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+)
+
+// ErrPlaybookMismatch is returned when a playbook is run for a finding it does not match
+var ErrPlaybookMismatch = errors.New("the playbook does not match the finding")
+
+// What a playbook step did
+const (
+	PlaybookStepApplied  = "applied"
+	PlaybookStepProposed = "proposed"
+	PlaybookStepNotified = "notified"
+	PlaybookStepSkipped  = "skipped"
+	PlaybookStepFailed   = "failed"
+)
+
+// PlaybookStepResult is what one step of a playbook run did
+type PlaybookStepResult struct {
+	Step   int    `json:"step"`
+	Name   string `json:"name,omitempty"`
+	Action string `json:"action,omitempty"`
+	// Outcome is applied, proposed, notified, skipped or failed
+	Outcome       string `json:"outcome"`
+	RemediationID string `json:"remediationId,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// PlaybookRun is the result of running a playbook for a finding
+type PlaybookRun struct {
+	Playbook  string `json:"playbook"`
+	FindingID string `json:"findingId"`
+	// GuardReason is why the guards had the remediation steps proposed for approval instead
+	// of applied
+	GuardReason string               `json:"guardReason,omitempty"`
+	Steps       []PlaybookStepResult `json:"steps"`
+}
+
+// playbookMessage is the data notify step templates are filled in with, e.g.
+// {{.Finding.Title}}, {{.Finding.ResourceID}} or {{range .Steps}}{{.Outcome}}{{end}}
+type playbookMessage struct {
+	Playbook    string
+	Finding     *findings.Finding
+	GuardReason string
+	Steps       []PlaybookStepResult
+}
+
+// ParsePlaybook parses a playbook's YAML and checks that every step's action is registered
+// and accepts the parameters the step gives it
+func ParsePlaybook(source []byte) (*playbooks.Playbook, error) {
+	playbook, err := playbooks.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	engine := DefaultRemediationEngine()
+	for i, step := range playbook.Steps {
+		if step.Action == "" {
+			continue
+		}
+		action := engine.Action(step.Action)
+		if action == nil {
+			return nil, fmt.Errorf("%w: step %d: unknown action '%s'", playbooks.ErrInvalid, i+1, step.Action)
+		}
+		for name := range step.Parameters {
+			if _, ok := action.Parameters[name]; !ok {
+				return nil, fmt.Errorf("%w: step %d: action %s takes no parameter '%s'", playbooks.ErrInvalid, i+1, step.Action, name)
+			}
+		}
+	}
+	return playbook, nil
+}
+
+// SavePlaybook parses a playbook's YAML and stores it for the tenant: as a new playbook when
+// id is empty, else over the playbook with the ID
+func SavePlaybook(ctx context.Context, tenantID, id string, source []byte) (*playbooks.Playbook, error) {
+	store := playbooks.Default()
+	if store == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	playbook, err := ParsePlaybook(source)
+	if err != nil {
+		return nil, err
+	}
+	playbook.TenantID = tenantID
+	if id == "" {
+		if err := store.Create(ctx, playbook); err != nil {
+			return nil, err
+		}
+		return playbook, nil
+	}
+	existing, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	playbook.ID, playbook.CreatedAt = existing.ID, existing.CreatedAt
+	if err := store.Replace(ctx, playbook); err != nil {
+		return nil, err
+	}
+	return playbook, nil
+}
+
+// RunPlaybook runs one of the tenant's playbooks for a finding it matches on a user's request,
+// whether or not the playbook is enabled
+func RunPlaybook(ctx context.Context, tenantID, playbookID, findingID, requestedBy string) (*PlaybookRun, error) {
+	store, findingStore := playbooks.Default(), findings.Default()
+	if store == nil || findingStore == nil || remediations.Default() == nil {
+		return nil, ErrRemediationsUnavailable
+	}
+	playbook, err := store.Get(ctx, tenantID, playbookID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := findingStore.Get(ctx, tenantID, findingID)
+	if err != nil {
+		return nil, err
+	}
+	if !playbook.Matches(f) {
+		return nil, fmt.Errorf("%w: %s does not match finding %s", ErrPlaybookMismatch, playbook.Name, findingID)
+	}
+	return runPlaybook(ctx, playbook, f, remediationRequest{trigger: remediations.TriggerPlaybook, requestedBy: requestedBy})
+}
+
+// runMatchingPlaybook runs the first of the tenant's enabled playbooks that matches a new or
+// reopened finding and reports whether one did
+func runMatchingPlaybook(ctx context.Context, f *findings.Finding) bool {
+	store := playbooks.Default()
+	if store == nil {
+		return false
+	}
+	list, err := store.List(ctx, f.TenantID, true)
+	if err != nil {
+		log.Printf("[Remediation] Warning: failed to load playbooks of tenant %s: %v", f.TenantID, err)
+		return false
+	}
+	for i := range list {
+		if list[i].Matches(f) {
+			if _, err := runPlaybook(ctx, &list[i], f, remediationRequest{trigger: remediations.TriggerPlaybook}); err != nil {
+				log.Printf("[Remediation] Warning: failed to run playbook %s for finding %s: %v", list[i].Name, f.ID.Hex(), err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// runPlaybook runs the playbook's steps in order. Remediation steps are applied when the
+// tier applies fixes, the guards allow it and the action is reversible; otherwise they are
+// proposed for approval, as long as the tier analyzes. A failed step stops the playbook unless
+// it continues on failure.
+func runPlaybook(ctx context.Context, playbook *playbooks.Playbook, f *findings.Finding, req remediationRequest) (*PlaybookRun, error) {
+	engine := DefaultRemediationEngine()
+	service, err := cloudTrailServiceFor(ctx, f.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	tier := service.tier()
+	run := &PlaybookRun{
+		Playbook:    playbook.Name,
+		FindingID:   f.ID.Hex(),
+		GuardReason: playbook.Guards.Check(f, time.Now()),
+		Steps:       []PlaybookStepResult{},
+	}
+	req.playbook = playbook.Name
+
+	for i, step := range playbook.Steps {
+		result := PlaybookStepResult{Step: i + 1, Name: step.Name, Action: step.Action}
+		var err error
+		if step.Notify != nil {
+			err = notifyPlaybookStep(ctx, step.Notify, run, f)
+			result.Outcome = PlaybookStepNotified
+		} else {
+			action := engine.Action(step.Action)
+			stepReq := req
+			stepReq.parameters = step.Parameters
+			var remediation *remediations.Remediation
+			switch {
+			case action == nil:
+				err = fmt.Errorf("%w: action %s is no longer registered", ErrNoRemediationAction, step.Action)
+			case tier.AppliesFixes() && run.GuardReason == "" && action.Reversibility != remediations.Irreversible:
+				remediation, err = engine.remediate(ctx, f.TenantID, f, action, stepReq)
+				result.Outcome = PlaybookStepApplied
+				if err == nil && remediation.Status == remediations.StatusFailed {
+					err = errors.New(remediation.Error)
+				}
+				if err == nil && remediation.Status == remediations.StatusPending {
+					// The tenant's guardrails queued it for approval
+					result.Outcome, result.Error = PlaybookStepProposed, remediation.GuardrailViolation
+				}
+			case tier.Analyzes():
+				remediation, err = engine.propose(ctx, f.TenantID, f, action, stepReq)
+				result.Outcome = PlaybookStepProposed
+			default:
+				result.Outcome, result.Error = PlaybookStepSkipped, fmt.Sprintf("%s tier does not remediate", tier)
+			}
+			if remediation != nil {
+				result.RemediationID = remediation.ID.Hex()
+			}
+			if errors.Is(err, ErrRemediationActive) {
+				result.Outcome, result.Error, err = PlaybookStepSkipped, err.Error(), nil
+			}
+		}
+		if err != nil {
+			result.Outcome, result.Error = PlaybookStepFailed, err.Error()
+		}
+		run.Steps = append(run.Steps, result)
+		if err != nil && !step.ContinueOnFailure {
+			break
+		}
+	}
+	log.Printf("[Remediation] 📘 Ran playbook %s for finding %s of tenant %s: %d of %d steps", playbook.Name, run.FindingID, f.TenantID, len(run.Steps), len(playbook.Steps))
+	return run, nil
+}
+
+// notifyPlaybookStep sends a notify step's message to its emails, or publishes it to the
+// tenant's notification topic
+func notifyPlaybookStep(ctx context.Context, notify *playbooks.Notify, run *PlaybookRun, f *findings.Finding) error {
+	subject, message, err := notify.Render(playbookMessage{
+		Playbook:    run.Playbook,
+		Finding:     f,
+		GuardReason: run.GuardReason,
+		Steps:       run.Steps,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render notification: %w", err)
+	}
+	if subject == "" {
+		subject = fmt.Sprintf("CloudLoom playbook %s: %s", run.Playbook, f.Title)
+	}
+	if len(notify.Emails) > 0 {
+		return email.Send(email.ConfigFromEnv(), notify.Emails, subject, message)
+	}
+	return PublishNotification(ctx, f.TenantID, subject, message)
+}
@@ -0,0 +1,330 @@
+package remediations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionRemediations
+
+var (
+	// ErrNotFound is returned when a remediation does not exist for the tenant
+	ErrNotFound = errors.New("remediation not found")
+	// ErrConflict is returned when a remediation cannot move on from its current status
+	ErrConflict = errors.New("remediation is in the wrong state")
+)
+
+// Status is how far a remediation got
+type Status string
+
+const (
+	// StatusPending means the action was proposed and waits for someone to approve or reject it
+	StatusPending Status = "pending"
+	// StatusApproved means the proposal was approved and can be executed
+	StatusApproved Status = "approved"
+	// StatusRejected means the proposal was rejected and will not be executed
+	StatusRejected Status = "rejected"
+	// StatusRunning means the action is being applied in the account
+	StatusRunning Status = "running"
+	// StatusSucceeded means the action changed the resource, or found it already fixed
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed means the action could not be applied; Error says why
+	StatusFailed Status = "failed"
+	// StatusRollingBack means the state captured before the action ran is being restored
+	StatusRollingBack Status = "rolling-back"
+	// StatusRolledBack means the resource was put back as it was before the action ran
+	StatusRolledBack Status = "rolled-back"
+	// StatusBlocked means a guardrail refused the action, which never ran; Error says which
+	StatusBlocked Status = "blocked"
+)
+
+// Active are the statuses of remediations that may still change the finding's resource
+var Active = []Status{StatusPending, StatusApproved, StatusRunning, StatusRollingBack}
+
+// Trigger is what started a remediation
+type Trigger string
+
+const (
+	// TriggerAutomatic remediations were started by a new or reopened finding
+	TriggerAutomatic Trigger = "automatic"
+	// TriggerManual remediations were started by a user for an existing finding
+	TriggerManual Trigger = "manual"
+	// TriggerApproval remediations were proposed for a new or reopened finding and ran once
+	// someone approved them
+	TriggerApproval Trigger = "approval"
+	// TriggerPlaybook remediations were started by a step of a tenant's playbook
+	TriggerPlaybook Trigger = "playbook"
+)
+
+// Reversibility is whether what an action changes can be put back as it was
+type Reversibility string
+
+const (
+	// Reversible actions change settings that can be restored exactly
+	Reversible Reversibility = "reversible"
+	// Irreversible actions delete or issue something that cannot be restored, and only run
+	// once someone explicitly confirms them
+	Irreversible Reversibility = "irreversible"
+)
+
+// APICall is one AWS API call an action makes, with the parameters it sends
+type APICall struct {
+	// Action is the IAM action of the call, such as s3:PutPublicAccessBlock
+	Action     string                 `bson:"action" json:"action"`
+	Resource   string                 `bson:"resource" json:"resource"`
+	Parameters map[string]interface{} `bson:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+// Preview is what running an action would do, worked out from the resource's current state
+// without changing anything
+type Preview struct {
+	// Diff describes the changes as lines starting with + (added), - (removed) or ~ (changed)
+	Diff []string `bson:"diff" json:"diff"`
+	// Calls are the AWS API calls the action would make, in order
+	Calls []APICall `bson:"calls" json:"calls"`
+	// ResourceArns are the resources the calls change
+	ResourceArns      []string      `bson:"resourceArns" json:"resourceArns"`
+	Reversibility     Reversibility `bson:"reversibility" json:"reversibility"`
+	ReversibilityNote string        `bson:"reversibilityNote,omitempty" json:"reversibilityNote,omitempty"`
+	// Error is set when the resource's state could not be read, so the calls are not known
+	Error       string    `bson:"error,omitempty" json:"error,omitempty"`
+	GeneratedAt time.Time `bson:"generatedAt" json:"generatedAt"`
+}
+
+// NoChanges reports whether the resource is already fixed, so the action would call nothing
+func (p *Preview) NoChanges() bool {
+	return p.Error == "" && len(p.Calls) == 0
+}
+
+// IngressRule is one range of a security group ingress rule
+type IngressRule struct {
+	Protocol    string `bson:"protocol" json:"protocol"`
+	FromPort    int32  `bson:"fromPort" json:"fromPort"`
+	ToPort      int32  `bson:"toPort" json:"toPort"`
+	CidrIP      string `bson:"cidrIp,omitempty" json:"cidrIp,omitempty"`
+	CidrIPv6    string `bson:"cidrIpv6,omitempty" json:"cidrIpv6,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+// PreState is the state of what an action changes, captured right before it ran so a rollback
+// can restore it. Only the fields of the action's resource are set.
+type PreState struct {
+	// PublicAccessBlock holds the bucket's public access block settings by name
+	PublicAccessBlock map[string]bool `bson:"publicAccessBlock,omitempty" json:"publicAccessBlock,omitempty"`
+	// BucketPolicy is the bucket's policy when its public access was blocked. The action leaves
+	// it as it is, but S3 ignores its public grants until the block settings are restored.
+	BucketPolicy string `bson:"bucketPolicy,omitempty" json:"bucketPolicy,omitempty"`
+	// IngressRules are the security group rules the action revoked
+	IngressRules           []IngressRule `bson:"ingressRules,omitempty" json:"ingressRules,omitempty"`
+	EBSEncryptionByDefault *bool         `bson:"ebsEncryptionByDefault,omitempty" json:"ebsEncryptionByDefault,omitempty"`
+	// AttachedPolicyArns are the managed policies that were attached to the user or role
+	AttachedPolicyArns []string `bson:"attachedPolicyArns,omitempty" json:"attachedPolicyArns,omitempty"`
+	// ActiveAccessKeyIDs are the user's access keys that were active
+	ActiveAccessKeyIDs []string `bson:"activeAccessKeyIds,omitempty" json:"activeAccessKeyIds,omitempty"`
+	// RoleSessionPolicy is the role's AWSRevokeOlderSessions inline policy, nil if it had none
+	RoleSessionPolicy *string `bson:"roleSessionPolicy,omitempty" json:"roleSessionPolicy,omitempty"`
+	// Steps are the states the steps of an action made of other actions captured, by action name
+	Steps      map[string]*PreState `bson:"steps,omitempty" json:"steps,omitempty"`
+	CapturedAt time.Time            `bson:"capturedAt" json:"capturedAt"`
+}
+
+// Remediation is one proposal or run of a remediation action against a finding's resource,
+// kept as the remediation log
+type Remediation struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenantId" json:"tenantId"`
+	FindingID   string             `bson:"findingId" json:"findingId"`
+	Fingerprint string             `bson:"fingerprint" json:"fingerprint"`
+	// FindingType is the rule ID of the finding the action was chosen for
+	FindingType  string  `bson:"findingType" json:"findingType"`
+	Action       string  `bson:"action" json:"action"`
+	ResourceType string  `bson:"resourceType" json:"resourceType"`
+	ResourceID   string  `bson:"resourceId" json:"resourceId"`
+	Region       string  `bson:"region,omitempty" json:"region,omitempty"`
+	Trigger      Trigger `bson:"trigger" json:"trigger"`
+	// Playbook is the name of the playbook whose step chose the action
+	Playbook    string            `bson:"playbook,omitempty" json:"playbook,omitempty"`
+	Parameters  map[string]string `bson:"parameters,omitempty" json:"parameters,omitempty"`
+	RequestedBy string            `bson:"requestedBy,omitempty" json:"requestedBy,omitempty"`
+	Status      Status            `bson:"status" json:"status"`
+	// Preview is what the action will change, worked out when it was proposed and again right
+	// before it ran
+	Preview *Preview `bson:"preview,omitempty" json:"preview,omitempty"`
+	// GuardrailViolation is why the tenant's guardrails queued or blocked the action instead
+	// of letting it run
+	GuardrailViolation string `bson:"guardrailViolation,omitempty" json:"guardrailViolation,omitempty"`
+	// Confirmed is set when someone explicitly confirmed an irreversible action
+	Confirmed bool `bson:"confirmed,omitempty" json:"confirmed,omitempty"`
+	// Changes describes what the action changed in the account, one entry per API call
+	Changes []string `bson:"changes,omitempty" json:"changes,omitempty"`
+	Error   string   `bson:"error,omitempty" json:"error,omitempty"`
+	// PreState is what the resource was like right before the action changed it
+	PreState *PreState `bson:"preState,omitempty" json:"preState,omitempty"`
+	// RollbackChanges describes what restoring PreState changed, and RollbackError why the last
+	// rollback failed
+	RollbackChanges []string   `bson:"rollbackChanges,omitempty" json:"rollbackChanges,omitempty"`
+	RollbackError   string     `bson:"rollbackError,omitempty" json:"rollbackError,omitempty"`
+	RolledBackBy    string     `bson:"rolledBackBy,omitempty" json:"rolledBackBy,omitempty"`
+	RolledBackAt    *time.Time `bson:"rolledBackAt,omitempty" json:"rolledBackAt,omitempty"`
+	ReviewedBy      string     `bson:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt      *time.Time `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	// RejectionReason is why a reviewer rejected the proposal
+	RejectionReason string     `bson:"rejectionReason,omitempty" json:"rejectionReason,omitempty"`
+	StartedAt       *time.Time `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	CompletedAt     *time.Time `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	CreatedAt       time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ListFilter narrows the remediations returned by List
+type ListFilter struct {
+	TenantID  string
+	FindingID string
+	Action    string
+	Status    Status
+	Limit     int64
+}
+
+// Store persists the remediation log in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide remediation store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide remediation store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the remediations collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create saves a new remediation
+func (s *Store) Create(ctx context.Context, remediation *Remediation) error {
+	now := time.Now()
+	remediation.CreatedAt = now
+	remediation.UpdatedAt = now
+	res, err := s.collection.InsertOne(ctx, remediation)
+	if err != nil {
+		return fmt.Errorf("failed to create remediation: %w", err)
+	}
+	remediation.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Transition saves the remediation if it is still in the from status, so two reviewers or
+// executions cannot both act on it. It returns ErrConflict if the status has moved on.
+func (s *Store) Transition(ctx context.Context, remediation *Remediation, from Status) error {
+	remediation.UpdatedAt = time.Now()
+	res, err := s.collection.ReplaceOne(ctx, bson.M{"_id": remediation.ID, "status": from}, remediation)
+	if err != nil {
+		return fmt.Errorf("failed to save remediation: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Complete records the outcome of a running remediation. A nil applyErr marks it succeeded.
+func (s *Store) Complete(ctx context.Context, remediation *Remediation, changes []string, applyErr error) error {
+	now := time.Now()
+	remediation.Status, remediation.Changes, remediation.CompletedAt = StatusSucceeded, changes, &now
+	if applyErr != nil {
+		remediation.Status, remediation.Error = StatusFailed, applyErr.Error()
+	}
+	return s.Transition(ctx, remediation, StatusRunning)
+}
+
+// Get returns one of the tenant's remediations
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Remediation, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var remediation Remediation
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&remediation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load remediation: %w", err)
+	}
+	return &remediation, nil
+}
+
+// List returns the tenant's remediations, newest first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]Remediation, error) {
+	query := bson.M{"tenantId": filter.TenantID}
+	if filter.FindingID != "" {
+		query["findingId"] = filter.FindingID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remediations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Remediation{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode remediations: %w", err)
+	}
+	return result, nil
+}
+
+// HasActive reports whether the action is already proposed, approved or being applied for
+// the finding
+func (s *Store) HasActive(ctx context.Context, tenantID, fingerprint, action string) (bool, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId":    tenantID,
+		"fingerprint": fingerprint,
+		"action":      action,
+		"status":      bson.M{"$in": Active},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check remediations: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CountStartedSince counts the tenant's remediations that started running at or after since
+func (s *Store) CountStartedSince(ctx context.Context, tenantID string, since time.Time) (int64, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"tenantId":  tenantID,
+		"startedAt": bson.M{"$gte": since},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count remediations: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// resourceCollector reads one service's resources straight from its API, as the
+// configuration items AWS Config would record for them
+type resourceCollector struct {
+	name    string
+	collect func(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error)
+}
+
+// resourceCollectors lists the services inventory scans can read without AWS Config
+func (cs *ConfigService) resourceCollectors() []resourceCollector {
+	return []resourceCollector{
+		{name: "S3", collect: cs.collectS3Buckets},
+		{name: "EC2", collect: cs.collectEC2},
+		{name: "RDS", collect: cs.collectRDS},
+		{name: "Lambda", collect: cs.collectLambda},
+	}
+}
+
+// CollectResourcesDirectly reads resources from each service's own API, for when AWS Config is
+// not recording yet or has not recorded anything. A collector that fails is logged and
+// skipped; an error is returned only when every one fails.
+func (cs *ConfigService) CollectResourcesDirectly(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+	collectors := cs.resourceCollectors()
+	resources := []ConfigurationItem{}
+	var lastErr error
+	failed := 0
+	for _, collector := range collectors {
+		items, err := collector.collect(ctx, cfg)
+		if err != nil {
+			log.Printf("[ConfigService] Warning: failed to collect %s resources directly: %v", collector.name, err)
+			lastErr = err
+			failed++
+			continue
+		}
+		log.Printf("[ConfigService] Collected %d %s resources directly", len(items), collector.name)
+		resources = append(resources, items...)
+	}
+	if failed == len(collectors) && lastErr != nil {
+		return nil, fmt.Errorf("direct resource collection failed: %w", lastErr)
+	}
+	return resources, nil
+}
+
+// collectPerRegion runs collect in every region enabled in the account, or only the home region
+// if they cannot be listed. A region that fails is logged and skipped; an error is returned
+// only when every one fails.
+func (cs *ConfigService) collectPerRegion(ctx context.Context, cfg aws.Config, name string, collect func(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error)) ([]ConfigurationItem, error) {
+	regions, err := enabledRegions(ctx, cfg)
+	if err != nil {
+		log.Printf("[ConfigService] Warning: collecting %s resources in %s only: %v", name, cfg.Region, err)
+		regions = []string{cfg.Region}
+	}
+
+	found := make([][]ConfigurationItem, len(regions))
+	errs := cs.pool.run(ctx, len(regions), func(ctx context.Context, i int) error {
+		var err error
+		found[i], err = collect(ctx, inRegion(cfg, regions[i]))
+		return err
+	})
+
+	resources := []ConfigurationItem{}
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[ConfigService] Warning: failed to collect %s resources in %s: %v", name, regions[i], err)
+			lastErr = err
+			continue
+		}
+		resources = append(resources, found[i]...)
+	}
+	if len(resources) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return resources, nil
+}
+
+// resourceDescriber reads one kind of resource of a region
+type resourceDescriber struct {
+	name     string
+	describe func(ctx context.Context) ([]ConfigurationItem, error)
+}
+
+// describeAll runs every describer of a region. A describer that fails, usually for lack of
+// permission, is logged and skipped; an error is returned only when every one fails.
+func describeAll(ctx context.Context, region string, describers []resourceDescriber) ([]ConfigurationItem, error) {
+	var items []ConfigurationItem
+	var errs []error
+	for _, describer := range describers {
+		found, err := describer.describe(ctx)
+		if err != nil {
+			log.Printf("[ConfigService] Warning: failed to describe %s in %s: %v", describer.name, region, err)
+			errs = append(errs, err)
+			continue
+		}
+		items = append(items, found...)
+	}
+	if len(errs) == len(describers) {
+		return nil, errors.Join(errs...)
+	}
+	return items, nil
+}
+
+// collectedItem builds the configuration item of a resource read from its service, with the
+// SDK's description of it as the configuration
+func collectedItem(resourceType, id, name, region, accountID string, description interface{}, tags FlexibleTags, created *time.Time, relationships ...Relationship) ConfigurationItem {
+	now := time.Now()
+	configuration, _ := toConfigValue(description).(map[string]interface{})
+	if tags == nil {
+		tags = FlexibleTags{}
+	}
+	if relationships == nil {
+		relationships = []Relationship{}
+	}
+	return ConfigurationItem{
+		ResourceID:           id,
+		AccountID:            accountID,
+		ResourceType:         resourceType,
+		ResourceName:         name,
+		Region:               region,
+		ConfigurationStatus:  "OK",
+		CaptureTime:          &now,
+		ResourceCreationTime: created,
+		Tags:                 tags,
+		Relationships:        relationships,
+		Configuration:        configuration,
+	}
+}
+
+// relatedTo returns a relationship to each non-empty id
+func relatedTo(resourceType, name string, ids ...string) []Relationship {
+	var relationships []Relationship
+	for _, id := range ids {
+		if id != "" {
+			relationships = append(relationships, relatesTo(resourceType, id, name))
+		}
+	}
+	return relationships
+}
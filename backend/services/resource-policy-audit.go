@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Compliance rules evaluated against the resource policies of SNS topics, SQS queues, Lambda
+// functions and KMS keys
+const (
+	RuleSNSNoPublicAccess    = "cloudloom-sns-topic-policy-no-external-access"
+	RuleSQSNoPublicAccess    = "cloudloom-sqs-queue-policy-no-external-access"
+	RuleLambdaNoPublicAccess = "cloudloom-lambda-policy-no-external-access"
+	RuleKMSNoPublicAccess    = "cloudloom-kms-key-policy-no-external-access"
+)
+
+// ResourcePolicy is a resource whose policy grants access to anyone or to other accounts
+// without conditions
+type ResourcePolicy struct {
+	ResourceType   string          `json:"resourceType"`
+	ResourceID     string          `json:"resourceId"`
+	ExternalGrants []ExternalGrant `json:"externalGrants"`
+}
+
+// policyTarget is one resource and its policy document, as read from its service
+type policyTarget struct {
+	resourceID string
+	accountID  string
+	policy     string
+}
+
+// AuditResourcePolicies reads the resource policies of SNS topics, SQS queues, Lambda functions
+// and customer managed KMS keys, and flags statements that allow "*" or another account without
+// a Condition. Each failing evaluation quotes the offending statements.
+func (cs *ConfigService) AuditResourcePolicies(ctx context.Context, cfg aws.Config) ([]ResourcePolicy, []ComplianceRule, error) {
+	log.Println("[ResourcePolicies] Auditing SNS, SQS, Lambda and KMS resource policies...")
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	exposed := []ResourcePolicy{}
+	var rules []ComplianceRule
+	for _, audit := range []struct {
+		rule         string
+		resourceType string
+		list         func() ([]policyTarget, error)
+	}{
+		{RuleSNSNoPublicAccess, "AWS::SNS::Topic", func() ([]policyTarget, error) { return topicPolicies(ctx, sns.NewFromConfig(cfg)) }},
+		{RuleSQSNoPublicAccess, "AWS::SQS::Queue", func() ([]policyTarget, error) { return queuePolicies(ctx, sqs.NewFromConfig(cfg)) }},
+		{RuleLambdaNoPublicAccess, "AWS::Lambda::Function", func() ([]policyTarget, error) { return functionPolicies(ctx, lambda.NewFromConfig(cfg)) }},
+		{RuleKMSNoPublicAccess, "AWS::KMS::Key", func() ([]policyTarget, error) { return keyPolicies(ctx, kms.NewFromConfig(cfg)) }},
+	} {
+		targets, err := audit.list()
+		if err != nil {
+			// One service failing should not hide the others, so the rule is left out instead
+			log.Printf("[ResourcePolicies] Warning: %v", err)
+			continue
+		}
+
+		rule := newAuditRule(audit.rule, audit.resourceType)
+		for _, target := range targets {
+			if target.accountID == "" {
+				target.accountID = accountID
+			}
+			grants, err := ExternalGrants(target.policy, target.accountID)
+			if err != nil {
+				log.Printf("[ResourcePolicies] Warning: %s: %v", target.resourceID, err)
+				continue
+			}
+
+			var offending []ExternalGrant
+			var statements []string
+			for _, grant := range grants {
+				if grant.Conditional {
+					continue
+				}
+				offending = append(offending, grant)
+				statements = appendUnique(statements, grant.Statement)
+			}
+			rule.evaluate(target.resourceID, len(offending) == 0,
+				"Policy allows access outside the account without conditions: "+strings.Join(statements, "; "), now)
+			if len(offending) > 0 {
+				exposed = append(exposed, ResourcePolicy{ResourceType: audit.resourceType, ResourceID: target.resourceID, ExternalGrants: offending})
+			}
+		}
+		rules = append(rules, rule.rule())
+	}
+
+	log.Printf("[ResourcePolicies] ✅ Found %d resources with policies open outside the account", len(exposed))
+	return exposed, rules, nil
+}
+
+func topicPolicies(ctx context.Context, client *sns.Client) ([]policyTarget, error) {
+	var targets []policyTarget
+	paginator := sns.NewListTopicsPaginator(client, &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list SNS topics: %w", err)
+		}
+		for _, topic := range page.Topics {
+			arn := aws.ToString(topic.TopicArn)
+			attrs, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: topic.TopicArn})
+			if err != nil {
+				log.Printf("[ResourcePolicies] Warning: failed to get attributes of topic %s: %v", arn, err)
+				continue
+			}
+			targets = append(targets, policyTarget{resourceID: arn, accountID: principalAccount(arn), policy: attrs.Attributes["Policy"]})
+		}
+	}
+	return targets, nil
+}
+
+func queuePolicies(ctx context.Context, client *sqs.Client) ([]policyTarget, error) {
+	var targets []policyTarget
+	paginator := sqs.NewListQueuesPaginator(client, &sqs.ListQueuesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list SQS queues: %w", err)
+		}
+		for _, url := range page.QueueUrls {
+			attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+				QueueUrl:       aws.String(url),
+				AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy, sqstypes.QueueAttributeNameQueueArn},
+			})
+			if err != nil {
+				log.Printf("[ResourcePolicies] Warning: failed to get attributes of queue %s: %v", url, err)
+				continue
+			}
+			arn := attrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+			targets = append(targets, policyTarget{
+				resourceID: url,
+				accountID:  principalAccount(arn),
+				policy:     attrs.Attributes[string(sqstypes.QueueAttributeNamePolicy)],
+			})
+		}
+	}
+	return targets, nil
+}
+
+func functionPolicies(ctx context.Context, client *lambda.Client) ([]policyTarget, error) {
+	var targets []policyTarget
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Lambda functions: %w", err)
+		}
+		for _, fn := range page.Functions {
+			name := aws.ToString(fn.FunctionName)
+			target := policyTarget{resourceID: name, accountID: principalAccount(aws.ToString(fn.FunctionArn))}
+			out, err := client.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: fn.FunctionName})
+			var noPolicy *lambdatypes.ResourceNotFoundException
+			switch {
+			case errors.As(err, &noPolicy):
+			case err != nil:
+				log.Printf("[ResourcePolicies] Warning: failed to get policy of function %s: %v", name, err)
+				continue
+			default:
+				target.policy = aws.ToString(out.Policy)
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// keyPolicies returns the default policy of every customer managed key. AWS managed keys are
+// skipped as their policies cannot be changed.
+func keyPolicies(ctx context.Context, client *kms.Client) ([]policyTarget, error) {
+	var targets []policyTarget
+	paginator := kms.NewListKeysPaginator(client, &kms.ListKeysInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list KMS keys: %w", err)
+		}
+		for _, key := range page.Keys {
+			id := aws.ToString(key.KeyId)
+			described, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: key.KeyId})
+			if err != nil {
+				log.Printf("[ResourcePolicies] Warning: failed to describe key %s: %v", id, err)
+				continue
+			}
+			if described.KeyMetadata == nil || described.KeyMetadata.KeyManager != kmstypes.KeyManagerTypeCustomer {
+				continue
+			}
+
+			out, err := client.GetKeyPolicy(ctx, &kms.GetKeyPolicyInput{KeyId: key.KeyId, PolicyName: aws.String("default")})
+			if err != nil {
+				log.Printf("[ResourcePolicies] Warning: failed to get policy of key %s: %v", id, err)
+				continue
+			}
+			targets = append(targets, policyTarget{resourceID: id, accountID: principalAccount(aws.ToString(key.KeyArn)), policy: aws.ToString(out.Policy)})
+		}
+	}
+	return targets, nil
+}
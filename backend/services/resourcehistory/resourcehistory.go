@@ -0,0 +1,114 @@
+package resourcehistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionResourceHistory
+
+// duplicateKeyCode is the MongoDB error code for a unique index violation
+const duplicateKeyCode = 11000
+
+// Change is one configuration of a resource as AWS Config recorded it
+type Change struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID     string             `bson:"tenantId" json:"tenantId"`
+	ResourceType string             `bson:"resourceType" json:"resourceType"`
+	ResourceID   string             `bson:"resourceId" json:"resourceId"`
+	ResourceName string             `bson:"resourceName,omitempty" json:"resourceName,omitempty"`
+	Region       string             `bson:"region,omitempty" json:"region,omitempty"`
+	// Status is the configuration item status, e.g. ResourceDiscovered, OK or ResourceDeleted
+	Status        string                 `bson:"status" json:"status"`
+	StateID       string                 `bson:"stateId" json:"stateId"`
+	CapturedAt    time.Time              `bson:"capturedAt" json:"capturedAt"`
+	Configuration map[string]interface{} `bson:"configuration,omitempty" json:"configuration,omitempty"`
+	Tags          map[string]string      `bson:"tags,omitempty" json:"tags,omitempty"`
+	RecordedAt    time.Time              `bson:"recordedAt" json:"recordedAt"`
+}
+
+// Store persists the configuration history of tenants' resources in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide history store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide history store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the resource_history collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Record stores changes and returns how many were new. A change already recorded for the
+// same configuration state is skipped, so the same delivery file can be applied twice.
+func (s *Store) Record(ctx context.Context, changes []Change) (int, error) {
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(changes))
+	for i := range changes {
+		changes[i].RecordedAt = now
+		docs = append(docs, changes[i])
+	}
+
+	// Unordered so one duplicate doesn't stop the rest
+	_, err := s.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		for _, we := range bulkErr.WriteErrors {
+			if we.Code != duplicateKeyCode {
+				return 0, fmt.Errorf("failed to record resource history: %s", we.Message)
+			}
+		}
+		return len(changes) - len(bulkErr.WriteErrors), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record resource history: %w", err)
+	}
+	return len(changes), nil
+}
+
+// List returns the recorded configurations of one of the tenant's resources, newest first.
+// resourceType may be empty when the ID alone identifies the resource.
+func (s *Store) List(ctx context.Context, tenantID, resourceType, resourceID string, limit int64) ([]Change, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	filter := bson.M{"tenantId": tenantID, "resourceId": resourceID}
+	if resourceType != "" {
+		filter["resourceType"] = resourceType
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "capturedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []Change{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode resource history: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionRetention
+
+// DefaultDays is how many days each dataset is kept when a tenant has not overridden it.
+// Only datasets listed here are subject to retention. Tag policies are the tenant's settings
+// rather than records, so they are only archived once the tenant opts in.
+var DefaultDays = map[string]int{
+	"events":              90,
+	"findings":            365,
+	"inventory_snapshots": 730,
+	"tag_policies":        0,
+}
+
+// ErrInvalid is returned when a policy update names an unknown dataset or a negative period
+var ErrInvalid = errors.New("invalid retention policy")
+
+// Policy is a tenant's retention period per dataset, in days. Zero keeps data indefinitely.
+type Policy struct {
+	TenantID  string         `bson:"tenantId" json:"tenantId"`
+	Days      map[string]int `bson:"days" json:"days"`
+	UpdatedAt *time.Time     `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// Cutoff returns the time before which the dataset's documents expire, or false if they never do
+func (p *Policy) Cutoff(dataset string, now time.Time) (time.Time, bool) {
+	days := p.Days[dataset]
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -days), true
+}
+
+// Datasets returns the names of the datasets the policy covers, sorted
+func (p *Policy) Datasets() []string {
+	names := make([]string, 0, len(p.Days))
+	for name := range p.Days {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store persists per-tenant retention policies in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide retention policy store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide retention policy store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the retention_policies collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Get returns the tenant's effective policy: its overrides on top of DefaultDays
+func (s *Store) Get(ctx context.Context, tenantID string) (*Policy, error) {
+	policy := &Policy{TenantID: tenantID, Days: make(map[string]int, len(DefaultDays))}
+	for name, days := range DefaultDays {
+		policy.Days[name] = days
+	}
+
+	var stored Policy
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return policy, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention policy: %w", err)
+	}
+
+	for name, days := range stored.Days {
+		if _, ok := DefaultDays[name]; ok {
+			policy.Days[name] = days
+		}
+	}
+	policy.UpdatedAt = stored.UpdatedAt
+	return policy, nil
+}
+
+// Update overrides the retention period of the given datasets and returns the effective policy
+func (s *Store) Update(ctx context.Context, tenantID string, days map[string]int) (*Policy, error) {
+	if len(days) == 0 {
+		return nil, fmt.Errorf("%w: no datasets given", ErrInvalid)
+	}
+	set := bson.M{"updatedAt": time.Now()}
+	for name, d := range days {
+		if _, ok := DefaultDays[name]; !ok {
+			return nil, fmt.Errorf("%w: dataset '%s' does not support retention", ErrInvalid, name)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%w: days for '%s' must not be negative", ErrInvalid, name)
+		}
+		set["days."+name] = d
+	}
+
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"tenantId": tenantID},
+		bson.M{"$set": set, "$setOnInsert": bson.M{"tenantId": tenantID}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update retention policy: %w", err)
+	}
+	return s.Get(ctx, tenantID)
+}
+
+// Reset removes the tenant's overrides so DefaultDays apply again
+func (s *Store) Reset(ctx context.Context, tenantID string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"tenantId": tenantID}); err != nil {
+		return fmt.Errorf("failed to reset retention policy: %w", err)
+	}
+	return nil
+}
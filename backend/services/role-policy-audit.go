@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// managedRolePrefix starts the name of every role CloudLoom creates in a customer account. The
+// role the customer deploys for CloudLoom to assume is named CloudLoom<Tier>Role instead.
+const managedRolePrefix = "CloudLoom-"
+
+// allowedManagedPolicies are the AWS managed policies CloudLoom roles may have attached, with
+// the role they are needed by. Every other permission is granted by a scoped inline policy.
+var allowedManagedPolicies = map[string]string{
+	configRecordingPolicy: "CloudLoom-Config-ServiceRole",
+}
+
+// RolePolicyFinding is a CloudLoom role that is granted more than it needs
+type RolePolicyFinding struct {
+	RoleName string `json:"roleName"`
+	// Policy is the managed policy ARN or inline policy name granting too much
+	Policy string `json:"policy"`
+	// Managed is set when Policy is a managed policy CloudLoom no longer attaches
+	Managed bool         `json:"managed"`
+	Grants  []BroadGrant `json:"grants,omitempty"`
+}
+
+// RolePolicyAudit is the result of checking the policies of every CloudLoom role in an account
+type RolePolicyAudit struct {
+	AccountID string   `json:"accountId"`
+	Roles     []string `json:"roles"`
+	// LeastPrivilege is set when no role is granted more than it needs
+	LeastPrivilege bool                `json:"leastPrivilege"`
+	Findings       []RolePolicyFinding `json:"findings"`
+	CheckedAt      time.Time           `json:"checkedAt"`
+}
+
+// AuditRolePolicies reports every role CloudLoom created in the tenant's account that has a
+// managed policy other than those in allowedManagedPolicies, or an inline policy statement
+// with wildcard actions or resources. Running setup again replaces such policies.
+func AuditRolePolicies(ctx context.Context, tenantID string) (*RolePolicyAudit, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := iam.NewFromConfig(cfg)
+	audit := &RolePolicyAudit{AccountID: accountID, Roles: []string{}, Findings: []RolePolicyFinding{}, CheckedAt: time.Now()}
+	paginator := iam.NewListRolesPaginator(client, &iam.ListRolesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
+		}
+		for _, role := range page.Roles {
+			roleName := aws.ToString(role.RoleName)
+			if !strings.HasPrefix(roleName, managedRolePrefix) {
+				continue
+			}
+			findings, err := auditRole(ctx, client, roleName)
+			if err != nil {
+				return nil, err
+			}
+			audit.Roles = append(audit.Roles, roleName)
+			audit.Findings = append(audit.Findings, findings...)
+		}
+	}
+
+	audit.LeastPrivilege = len(audit.Findings) == 0
+	log.Printf("[RolePolicies] Audited %d CloudLoom roles in account %s, %d over-broad policies", len(audit.Roles), accountID, len(audit.Findings))
+	return audit, nil
+}
+
+// auditRole returns the managed and inline policies of a role that grant more than it needs
+func auditRole(ctx context.Context, client *iam.Client, roleName string) ([]RolePolicyFinding, error) {
+	var findings []RolePolicyFinding
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies attached to %s: %w", roleName, err)
+	}
+	for _, policy := range attached.AttachedPolicies {
+		policyArn := aws.ToString(policy.PolicyArn)
+		if allowedManagedPolicies[policyArn] != roleName {
+			findings = append(findings, RolePolicyFinding{RoleName: roleName, Policy: policyArn, Managed: true})
+		}
+	}
+
+	inline, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inline policies of %s: %w", roleName, err)
+	}
+	for _, policyName := range inline.PolicyNames {
+		policy, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{RoleName: aws.String(roleName), PolicyName: aws.String(policyName)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy %s of %s: %w", policyName, roleName, err)
+		}
+		grants, err := BroadGrants(aws.ToString(policy.PolicyDocument))
+		if err != nil {
+			return nil, fmt.Errorf("policy %s of %s: %w", policyName, roleName, err)
+		}
+		if len(grants) > 0 {
+			findings = append(findings, RolePolicyFinding{RoleName: roleName, Policy: policyName, Grants: grants})
+		}
+	}
+	return findings, nil
+}
+
+// detachManagedPolicies detaches every managed policy from the role except those in keep
+func detachManagedPolicies(ctx context.Context, client *iam.Client, roleName string, keep ...string) error {
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return fmt.Errorf("failed to list policies attached to %s: %w", roleName, err)
+	}
+	for _, policy := range attached.AttachedPolicies {
+		if containsString(keep, aws.ToString(policy.PolicyArn)) {
+			continue
+		}
+		log.Printf("[IAM] Detaching %s from %s", aws.ToString(policy.PolicyArn), roleName)
+		if _, err := client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{RoleName: aws.String(roleName), PolicyArn: policy.PolicyArn}); err != nil {
+			return fmt.Errorf("failed to detach %s from %s: %w", aws.ToString(policy.PolicyArn), roleName, err)
+		}
+	}
+	return nil
+}
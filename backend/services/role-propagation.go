@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+)
+
+// rolePropagation paces waits for new IAM roles and policies to reach every AWS service.
+// Most roles are usable within seconds; the timeout covers IAM's slowest propagation.
+var rolePropagation = awsconfig.Waiter{InitialDelay: time.Second, MaxDelay: 8 * time.Second, Timeout: 2 * time.Minute}
+
+// waitForRole waits until the role exists and a simulation of its policies allows action on
+// resource. When the caller may not simulate the role's policies, the role existing is
+// taken as enough.
+func waitForRole(ctx context.Context, client *iam.Client, roleName, action, resource string) error {
+	start := time.Now()
+	err := rolePropagation.Wait(ctx, func(ctx context.Context) (bool, error) {
+		role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return false, ignoreNotFound(err)
+		}
+
+		out, err := client.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: role.Role.Arn,
+			ActionNames:     []string{action},
+			ResourceArns:    []string{resource},
+		})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+			return true, nil
+		}
+		if err != nil {
+			return false, ignoreNotFound(err)
+		}
+		for _, result := range out.EvaluationResults {
+			if result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("role %s did not become usable: %w", roleName, err)
+	}
+	log.Printf("[IAM] ✅ Role %s usable after %s", roleName, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// retryWhilePropagating retries call while it fails with one of the error codes AWS services
+// return for a role they cannot assume yet
+func retryWhilePropagating(ctx context.Context, call func() error, codes ...string) error {
+	var last error
+	err := rolePropagation.Wait(ctx, func(ctx context.Context) (bool, error) {
+		last = call()
+		var apiErr smithy.APIError
+		if last != nil && errors.As(last, &apiErr) {
+			for _, code := range codes {
+				if apiErr.ErrorCode() == code {
+					log.Printf("[IAM] Role not usable yet (%s), retrying", code)
+					return false, nil
+				}
+			}
+		}
+		return true, last
+	})
+	if errors.Is(err, awsconfig.ErrWaitTimeout) && last != nil {
+		return last
+	}
+	return err
+}
+
+// ignoreNotFound turns a not-found error into nil, so a waiter keeps polling
+func ignoreNotFound(err error) error {
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
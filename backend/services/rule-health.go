@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindingSourceRuleHealth marks findings of EventBridge rules that drifted from what setup
+// created
+const FindingSourceRuleHealth = "rule_health"
+
+// RuleDrift is the rule ID of rule health findings
+const RuleDrift = "eventbridge-rule-drift"
+
+// RuleHealth is whether one regional EventBridge rule still delivers the account's events
+type RuleHealth struct {
+	Region   string `json:"region"`
+	RuleName string `json:"ruleName"`
+	RuleArn  string `json:"ruleArn"`
+	// Status is one of the component statuses: healthy, degraded, missing or unknown
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+	// Healed is set when the rule was recreated or the queue policy restored
+	Healed    bool   `json:"healed,omitempty"`
+	HealError string `json:"healError,omitempty"`
+}
+
+// RuleHealthReport is the health of every regional rule of a tenant
+type RuleHealthReport struct {
+	AccountID string `json:"accountId"`
+	// Healthy is set when every rule is healthy, or was healed
+	Healthy   bool         `json:"healthy"`
+	Rules     []RuleHealth `json:"rules"`
+	CheckedAt time.Time    `json:"checkedAt"`
+}
+
+// ruleHealthSelfHeal reports whether the background check heals the drift it finds. Set
+// RULE_HEALTH_SELF_HEAL to enable it.
+func ruleHealthSelfHeal() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("RULE_HEALTH_SELF_HEAL"))
+	return enabled
+}
+
+// CheckRuleHealth verifies that each of the tenant's regional rules exists, is enabled and
+// targets the notification topic and, for tiers that analyze events, the queue, and that the
+// queue policy still admits the rule. Drift is recorded as a high-severity finding, resolved
+// once the rule is healthy again. With heal, drifted rules are put back as setup made them.
+func CheckRuleHealth(ctx context.Context, tenantID string, heal bool) (*RuleHealthReport, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic)
+	var queueArn, queueURL, eventBridgeRoleArn string
+	var admitted map[string]bool
+	analyzes := s.tier().Analyzes()
+	if analyzes {
+		queueArn = fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, names.queue)
+		eventBridgeRoleArn = fmt.Sprintf("arn:aws:iam::%s:role/CloudLoom-Events-Role-%s", accountID, accountID)
+		queueURL, admitted, err = queuePolicySources(ctx, cfg, names.queue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &RuleHealthReport{AccountID: accountID, Healthy: true, Rules: []RuleHealth{}}
+	var ruleArns []string
+	policyDrifted := false
+	for _, region := range names.regions {
+		ruleArn := fmt.Sprintf("arn:aws:events:%s:%s:rule/%s", region, accountID, names.rules[region])
+		ruleArns = append(ruleArns, ruleArn)
+		health := checkRuleDrift(ctx, inRegion(cfg, region), names.rules[region], topicArn, queueArn)
+		health.Region, health.RuleArn = region, ruleArn
+		if analyzes && !admitted[ruleArn] {
+			health.Problems = append(health.Problems, "queue policy no longer admits the rule")
+			if health.Status == ComponentHealthy {
+				health.Status = ComponentDegraded
+			}
+			policyDrifted = true
+		}
+		report.Rules = append(report.Rules, health)
+	}
+
+	if heal {
+		s.setupID = primitive.NewObjectID().Hex()
+		for i := range report.Rules {
+			health := &report.Rules[i]
+			if health.Status == ComponentHealthy || health.Status == ComponentUnknown {
+				continue
+			}
+			regionalCfg := inRegion(cfg, health.Region)
+			ruleArn, err := s.createEventBridgeRule(ctx, regionalCfg, health.RuleName, topicArn, queueArn, eventBridgeRoleArn)
+			if err != nil {
+				health.HealError = err.Error()
+				continue
+			}
+			s.tagManaged(ctx, regionalCfg, ruleArn)
+			health.Healed = true
+		}
+		if policyDrifted {
+			if err := s.setSQSQueuePolicy(ctx, cfg, queueURL, queueArn, ruleArns); err != nil {
+				for i := range report.Rules {
+					if !admitted[report.Rules[i].RuleArn] {
+						report.Rules[i].Healed, report.Rules[i].HealError = false, err.Error()
+					}
+				}
+			}
+		}
+	}
+
+	for _, health := range report.Rules {
+		if health.Status != ComponentHealthy && !health.Healed {
+			report.Healthy = false
+		}
+		recordRuleDrift(ctx, tenantID, health)
+	}
+	report.CheckedAt = time.Now()
+	log.Printf("[RuleHealth] Checked %d rules of account %s (healthy=%t, heal=%t)", len(report.Rules), accountID, report.Healthy, heal)
+	return report, nil
+}
+
+// checkRuleDrift compares one rule with what setup created. queueArn is empty for tiers
+// without a queue.
+func checkRuleDrift(ctx context.Context, cfg aws.Config, ruleName, topicArn, queueArn string) RuleHealth {
+	health := RuleHealth{RuleName: ruleName, Status: ComponentHealthy}
+	client := eventbridge.NewFromConfig(cfg)
+	rule, err := client.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ruleName)})
+	if isNotFound(err) {
+		health.Status, health.Problems = ComponentMissing, []string{"rule was deleted"}
+		return health
+	}
+	if err != nil {
+		health.Status, health.Problems = ComponentUnknown, []string{"cannot describe rule: " + err.Error()}
+		return health
+	}
+	if rule.State != ebtypes.RuleStateEnabled {
+		health.Problems = append(health.Problems, "rule is "+string(rule.State))
+	}
+
+	targets, err := client.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(ruleName)})
+	if err != nil {
+		health.Status = ComponentUnknown
+		health.Problems = append(health.Problems, "cannot list targets: "+err.Error())
+		return health
+	}
+	wanted := map[string]string{notificationTargetID: topicArn}
+	if queueArn != "" {
+		wanted[autoApplyFixTargetID] = queueArn
+	}
+	for _, target := range targets.Targets {
+		if arn, ok := wanted[aws.ToString(target.Id)]; ok && aws.ToString(target.Arn) == arn {
+			delete(wanted, aws.ToString(target.Id))
+		}
+	}
+	for _, arn := range wanted {
+		health.Problems = append(health.Problems, "rule no longer targets "+arn)
+	}
+	if len(health.Problems) > 0 {
+		health.Status = ComponentDegraded
+	}
+	return health
+}
+
+// queuePolicySources returns the queue's URL and the rule ARNs its policy lets send messages
+func queuePolicySources(ctx context.Context, cfg aws.Config, queueName string) (string, map[string]bool, error) {
+	client := sqs.NewFromConfig(cfg)
+	queue, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find queue %s: %w", queueName, err)
+	}
+	attributes, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get policy of queue %s: %w", queueName, err)
+	}
+
+	admitted := map[string]bool{}
+	policy := attributes.Attributes[string(sqstypes.QueueAttributeNamePolicy)]
+	if policy == "" {
+		return aws.ToString(queue.QueueUrl), admitted, nil
+	}
+	var document struct {
+		Statement []struct {
+			Effect    string                            `json:"Effect"`
+			Condition map[string]map[string]interface{} `json:"Condition"`
+		} `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		// An unreadable policy admits no rule as far as the check can tell
+		return aws.ToString(queue.QueueUrl), admitted, nil
+	}
+	for _, statement := range document.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, values := range statement.Condition {
+			switch arns := values["aws:SourceArn"].(type) {
+			case string:
+				admitted[arns] = true
+			case []interface{}:
+				for _, arn := range arns {
+					admitted[stringValue(arn)] = true
+				}
+			}
+		}
+	}
+	return aws.ToString(queue.QueueUrl), admitted, nil
+}
+
+// recordRuleDrift records a finding for a drifted rule, or resolves the rule's finding once it
+// is healthy or healed. Rules that could not be checked leave their finding as it is.
+func recordRuleDrift(ctx context.Context, tenantID string, health RuleHealth) {
+	store := findings.Default()
+	if store == nil || health.Status == ComponentUnknown {
+		return
+	}
+	if health.Status != ComponentHealthy {
+		err := recordFinding(ctx, store, &findings.Finding{
+			TenantID:     tenantID,
+			Source:       FindingSourceRuleHealth,
+			RuleID:       RuleDrift,
+			Title:        fmt.Sprintf("EventBridge rule %s in %s no longer delivers events to CloudLoom", health.RuleName, health.Region),
+			Description:  strings.Join(health.Problems, "; "),
+			Remediation:  "Run setup again, or enable self-healing, to restore the rule, its targets and the queue policy. Find out who changed the rule in CloudTrail, since events were missed while it drifted.",
+			Severity:     "high",
+			ResourceType: "AWS::Events::Rule",
+			ResourceID:   health.RuleArn,
+			Context:      &findings.ResourceContext{ResourceName: health.RuleName, Region: health.Region},
+		})
+		if err != nil {
+			log.Printf("[RuleHealth] Warning: %v", err)
+			return
+		}
+	}
+	if health.Status == ComponentHealthy || health.Healed {
+		reason := "rule is healthy again"
+		if health.Healed {
+			reason = "rule was healed"
+		}
+		fingerprint := findings.Fingerprint(FindingSourceRuleHealth, RuleDrift, "AWS::Events::Rule", health.RuleArn)
+		if _, err := store.Close(ctx, tenantID, fingerprint, findings.StatusResolved, reason); err != nil {
+			log.Printf("[RuleHealth] Warning: %v", err)
+		}
+	}
+}
+
+// StartRuleHealthSchedule checks the rules of every set-up tenant every interval until ctx is
+// cancelled, healing drift when RULE_HEALTH_SELF_HEAL is set
+func StartRuleHealthSchedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			manager := tenants.Default()
+			if manager == nil || DemoModeEnabled() {
+				continue
+			}
+			list, err := manager.List(ctx)
+			if err != nil {
+				log.Printf("[RuleHealth] Warning: %v", err)
+				continue
+			}
+			heal := ruleHealthSelfHeal()
+			for _, tenant := range list {
+				if tenant.SetupStatus != tenants.StatusCompleted {
+					continue
+				}
+				if _, err := CheckRuleHealth(ctx, tenant.AccountID, heal); err != nil {
+					log.Printf("[RuleHealth] Warning: checking rules of tenant %s: %v", tenant.AccountID, err)
+				}
+			}
+		}
+	}
+}
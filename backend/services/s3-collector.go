@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// s3AbsentCodes are the errors S3 returns when a bucket has no configuration of a kind, which
+// the collector records as absent rather than as a failure
+var s3AbsentCodes = map[string]bool{
+	"NoSuchPublicAccessBlockConfiguration":           true,
+	"ServerSideEncryptionConfigurationNotFoundError": true,
+	"NoSuchBucketPolicy":                             true,
+	"ReplicationConfigurationNotFoundError":          true,
+	"NoSuchTagSet":                                   true,
+}
+
+func isS3Absent(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && s3AbsentCodes[apiErr.ErrorCode()]
+}
+
+// collectS3Buckets reads every bucket's encryption, public access block, versioning, policy,
+// ACL, logging, replication and tags straight from S3, and returns each bucket as the
+// configuration item AWS Config would record for it, so the checks that read supplementary
+// configuration work before Config has recorded anything
+func (cs *ConfigService) collectS3Buckets(ctx context.Context, cfg aws.Config) ([]ConfigurationItem, error) {
+	client := s3.NewFromConfig(cfg)
+	out, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 buckets: %w", err)
+	}
+	accountID, _ := getAccountID(ctx, &cfg)
+
+	items := make([]ConfigurationItem, len(out.Buckets))
+	errs := cs.pool.run(ctx, len(out.Buckets), func(ctx context.Context, i int) error {
+		var err error
+		items[i], err = describeBucket(ctx, cfg, client, out.Buckets[i], accountID)
+		return err
+	})
+
+	buckets := make([]ConfigurationItem, 0, len(items))
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[S3Collector] Warning: failed to describe bucket %s: %v", aws.ToString(out.Buckets[i].Name), err)
+			continue
+		}
+		buckets = append(buckets, items[i])
+	}
+	log.Printf("[S3Collector] Collected %d of %d buckets", len(buckets), len(out.Buckets))
+	return buckets, nil
+}
+
+// describeBucket builds a bucket's configuration item. Configuration that cannot be read, for
+// lack of permission or otherwise, is left out and logged; only failing to locate the bucket
+// fails it.
+func describeBucket(ctx context.Context, cfg aws.Config, client *s3.Client, bucket s3types.Bucket, accountID string) (ConfigurationItem, error) {
+	name := aws.String(aws.ToString(bucket.Name))
+	location, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: name})
+	if err != nil {
+		return ConfigurationItem{}, fmt.Errorf("failed to get location: %w", err)
+	}
+	// Buckets in us-east-1 report no location constraint
+	region := string(location.LocationConstraint)
+	if region == "" {
+		region = "us-east-1"
+	}
+	if region != cfg.Region {
+		client = s3.NewFromConfig(inRegion(cfg, region))
+	}
+
+	item := collectedItem("AWS::S3::Bucket", *name, *name, region, accountID,
+		map[string]interface{}{"name": *name, "creationDate": bucket.CreationDate}, nil, bucket.CreationDate)
+	item.SupplementaryConfiguration = map[string]interface{}{}
+	supplementary := item.SupplementaryConfiguration
+	read := func(key string, get func() (interface{}, error)) {
+		value, err := get()
+		switch {
+		case err == nil:
+			supplementary[key] = toConfigValue(value)
+		case !isS3Absent(err):
+			log.Printf("[S3Collector] Warning: failed to read %s of %s: %v", key, *name, err)
+		}
+	}
+
+	read("PublicAccessBlockConfiguration", func() (interface{}, error) {
+		out, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		return out.PublicAccessBlockConfiguration, nil
+	})
+	read("ServerSideEncryptionConfiguration", func() (interface{}, error) {
+		out, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		return out.ServerSideEncryptionConfiguration, nil
+	})
+	read("BucketVersioningConfiguration", func() (interface{}, error) {
+		out, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		// Versioning that was never enabled has no status, which Config records as Off
+		status := string(out.Status)
+		if status == "" {
+			status = "Off"
+		}
+		return map[string]interface{}{"status": status, "isMfaDeleteEnabled": out.MFADelete == s3types.MFADeleteStatusEnabled}, nil
+	})
+	read("BucketPolicy", func() (interface{}, error) {
+		out, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"policyText": aws.ToString(out.Policy)}, nil
+	})
+	read("AccessControlList", func() (interface{}, error) {
+		out, err := client.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"owner": out.Owner, "grantList": out.Grants}, nil
+	})
+	read("BucketLoggingConfiguration", func() (interface{}, error) {
+		out, err := client.GetBucketLogging(ctx, &s3.GetBucketLoggingInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		if out.LoggingEnabled == nil {
+			return map[string]interface{}{}, nil
+		}
+		return map[string]interface{}{
+			"destinationBucketName": aws.ToString(out.LoggingEnabled.TargetBucket),
+			"logFilePrefix":         aws.ToString(out.LoggingEnabled.TargetPrefix),
+		}, nil
+	})
+	read("BucketReplicationConfiguration", func() (interface{}, error) {
+		out, err := client.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: name})
+		if err != nil {
+			return nil, err
+		}
+		return out.ReplicationConfiguration, nil
+	})
+
+	tags, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: name})
+	if err == nil {
+		for _, tag := range tags.TagSet {
+			item.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	} else if !isS3Absent(err) {
+		log.Printf("[S3Collector] Warning: failed to read tags of %s: %v", *name, err)
+	}
+	return item, nil
+}
+
+// toConfigValue converts an SDK struct to the generic JSON form configuration items hold, with
+// field names in the lower camel case AWS Config uses
+func toConfigValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	return lowerCamelKeys(decoded)
+}
+
+func lowerCamelKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			converted[lowerCamel(key)] = lowerCamelKeys(nested)
+		}
+		return converted
+	case []interface{}:
+		for i := range v {
+			v[i] = lowerCamelKeys(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+// lowerCamel lowercases a key's leading capitals, keeping the last of a run that starts the
+// next word: BlockPublicAcls becomes blockPublicAcls and SSEAlgorithm sseAlgorithm
+func lowerCamel(key string) string {
+	runes := []rune(key)
+	for i := 0; i < len(runes) && runes[i] >= 'A' && runes[i] <= 'Z'; i++ {
+		if i > 0 && i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z' {
+			break
+		}
+		runes[i] += 'a' - 'A'
+	}
+	return string(runes)
+}
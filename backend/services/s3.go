@@ -9,7 +9,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func (s *CloudTrailService) createS3BucketAndPolicy(ctx context.Context, cfg aws.Config, bucketName, accountID, region string) error {
+// createS3BucketAndPolicy creates the log bucket and lets CloudTrail and AWS Config deliver to
+// it. With a KMS key, new objects are encrypted with it by default.
+func (s *CloudTrailService) createS3BucketAndPolicy(ctx context.Context, cfg aws.Config, bucketName, accountID, region, kmsKeyArn string) error {
 	fmt.Printf("[S3] Setting up bucket '%s' in region '%s'\n", bucketName, region)
 
 	// Validate bucket name
@@ -34,9 +36,12 @@ func (s *CloudTrailService) createS3BucketAndPolicy(ctx context.Context, cfg aws
 
 		createBucketInput := &s3.CreateBucketInput{
 			Bucket: aws.String(bucketName),
-			CreateBucketConfiguration: &types.CreateBucketConfiguration{
-				LocationConstraint: types.BucketLocationConstraint("ap-south-1"),
-			},
+		}
+		// us-east-1 is the default location and may not be named as a constraint
+		if region != "us-east-1" {
+			createBucketInput.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(region),
+			}
 		}
 
 		_, err := s3Client.CreateBucket(ctx, createBucketInput)
@@ -107,6 +112,28 @@ func (s *CloudTrailService) createS3BucketAndPolicy(ctx context.Context, cfg aws
 		return err
 	}
 	fmt.Printf("[S3] ✅ Bucket policy set successfully\n")
+
+	if kmsKeyArn != "" {
+		fmt.Printf("[S3] Enabling SSE-KMS default encryption with %s...\n", kmsKeyArn)
+		_, err = s3Client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucketName),
+			ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+				Rules: []types.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+						SSEAlgorithm:   types.ServerSideEncryptionAwsKms,
+						KMSMasterKeyID: aws.String(kmsKeyArn),
+					},
+					// Bucket keys cut the KMS requests made for AWS Config's deliveries
+					BucketKeyEnabled: aws.Bool(true),
+				}},
+			},
+		})
+		if err != nil {
+			fmt.Printf("[S3] ❌ Failed to enable bucket encryption: %v\n", err)
+			return err
+		}
+		fmt.Printf("[S3] ✅ Bucket encryption enabled\n")
+	}
 	return nil
 }
 
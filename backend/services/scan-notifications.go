@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/jobs"
+)
+
+// Kinds of event a scheduled inventory scan emits
+const (
+	ScanEventInventoryChanged   = "inventory.changed"
+	ScanEventComplianceDegraded = "compliance.degraded"
+)
+
+// scanEventTimeout bounds comparing a scheduled scan with the one before it and publishing
+// what changed
+const scanEventTimeout = 2 * time.Minute
+
+// maxScanEventResources is how many resources an event lists; the counts are always complete
+const maxScanEventResources = 20
+
+// ScanEvent is what a scheduled inventory scan found changed since the snapshot before it
+type ScanEvent struct {
+	Kind               string `json:"kind"`
+	TenantID           string `json:"tenantId"`
+	ScheduleID         string `json:"scheduleId"`
+	SnapshotID         string `json:"snapshotId"`
+	PreviousSnapshotID string `json:"previousSnapshotId"`
+
+	Added   int             `json:"added,omitempty"`
+	Removed int             `json:"removed,omitempty"`
+	Changed int             `json:"changed,omitempty"`
+	Sample  []DriftResource `json:"sample,omitempty"`
+
+	// NewlyNonCompliant are "type/ID" of resources that are non-compliant now but were not before
+	NewlyNonCompliant      []string `json:"newlyNonCompliant,omitempty"`
+	NewlyNonCompliantCount int      `json:"newlyNonCompliantCount,omitempty"`
+	NonCompliantCount      int      `json:"nonCompliantCount,omitempty"`
+	ScoreBefore            *float64 `json:"scoreBefore,omitempty"`
+	ScoreAfter             *float64 `json:"scoreAfter,omitempty"`
+}
+
+// NotifyOnScheduledScans publishes an event to the tenant's notification topic whenever an
+// inventory scan run by a schedule finds resources added, removed or changed, or resources
+// that have become non-compliant, since the snapshot before it. Scans run on request are
+// left out, since whoever started them sees the result.
+func NotifyOnScheduledScans(m *jobs.Manager) {
+	m.OnSuccess(func(ctx context.Context, job *jobs.Job) {
+		scheduleID, _ := job.Payload["scheduleId"].(string)
+		if job.Type != JobTypeInventoryScan || scheduleID == "" {
+			return
+		}
+
+		// Comparing snapshots and assuming the tenant's role outlasts the job's own write
+		go func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), scanEventTimeout)
+			defer cancel()
+
+			events, err := ScheduledScanEvents(ctx, job.TenantID, scheduleID, job.ID.Hex())
+			if err != nil {
+				log.Printf("[Scheduler] Warning: failed to compare scheduled scan %s: %v", job.ID.Hex(), err)
+				return
+			}
+			for _, event := range events {
+				if err := publishScanEvent(ctx, event); err != nil {
+					log.Printf("[Scheduler] Warning: failed to publish %s event of tenant %s: %v", event.Kind, job.TenantID, err)
+				}
+			}
+		}()
+	})
+}
+
+// ScheduledScanEvents compares snapshot snapshotID with the tenant's snapshot before it and
+// returns an inventory.changed event if any resource was added, removed or changed, and a
+// compliance.degraded event if any resource became non-compliant. A tenant's first snapshot
+// yields none.
+func ScheduledScanEvents(ctx context.Context, tenantID, scheduleID, snapshotID string) ([]ScanEvent, error) {
+	diff, err := DiffInventorySnapshots(ctx, tenantID, snapshotID, "")
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	base := ScanEvent{TenantID: tenantID, ScheduleID: scheduleID, SnapshotID: snapshotID, PreviousSnapshotID: diff.From.ID}
+	var events []ScanEvent
+
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0 {
+		changed := base
+		changed.Kind = ScanEventInventoryChanged
+		changed.Added, changed.Removed, changed.Changed = len(diff.Added), len(diff.Removed), len(diff.Changed)
+		for _, group := range [][]DriftResource{diff.Added, diff.Removed, diff.Changed} {
+			for _, resource := range group {
+				if len(changed.Sample) < maxScanEventResources {
+					changed.Sample = append(changed.Sample, resource)
+				}
+			}
+		}
+		events = append(events, changed)
+	}
+
+	previousRules, err := snapshotComplianceRules(ctx, diff.From.ID)
+	if err != nil {
+		return nil, err
+	}
+	currentRules, err := snapshotComplianceRules(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	previous := resourceCompliance(previousRules)
+	var newlyNonCompliant []string
+	nonCompliant := 0
+	for key, status := range resourceCompliance(currentRules) {
+		if status != ComplianceNonCompliant {
+			continue
+		}
+		nonCompliant++
+		if previous[key] != ComplianceNonCompliant {
+			newlyNonCompliant = append(newlyNonCompliant, key)
+		}
+	}
+	if len(newlyNonCompliant) > 0 {
+		sort.Strings(newlyNonCompliant)
+		degraded := base
+		degraded.Kind = ScanEventComplianceDegraded
+		degraded.NewlyNonCompliantCount = len(newlyNonCompliant)
+		degraded.NonCompliantCount = nonCompliant
+		degraded.NewlyNonCompliant = newlyNonCompliant[:min(len(newlyNonCompliant), maxScanEventResources)]
+		degraded.ScoreBefore = overallCompliance(previousRules).Score
+		degraded.ScoreAfter = overallCompliance(currentRules).Score
+		events = append(events, degraded)
+	}
+	return events, nil
+}
+
+// publishScanEvent sends an event to the tenant's notification topic as JSON, so subscribed
+// queues and functions can act on it, under a subject people can read in an email
+func publishScanEvent(ctx context.Context, event ScanEvent) error {
+	var subject string
+	switch event.Kind {
+	case ScanEventInventoryChanged:
+		subject = fmt.Sprintf("CloudLoom: %d added, %d removed, %d changed in account %s", event.Added, event.Removed, event.Changed, event.TenantID)
+	case ScanEventComplianceDegraded:
+		subject = fmt.Sprintf("CloudLoom: %d resources became non-compliant in account %s", event.NewlyNonCompliantCount, event.TenantID)
+	}
+
+	message, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Kind, err)
+	}
+	// Demo tenants have no account to publish to
+	if DemoModeEnabled() {
+		log.Printf("[Scheduler] %s: %s", subject, message)
+		return nil
+	}
+	if err := PublishNotification(ctx, event.TenantID, subject, string(message)); err != nil {
+		return err
+	}
+	log.Printf("[Scheduler] 📣 Published %s event for snapshot %s of tenant %s", event.Kind, event.SnapshotID, event.TenantID)
+	return nil
+}
@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpression is a parsed standard 5-field cron expression
+// (minute hour day-of-month month day-of-week)
+type CronExpression struct {
+	raw     string
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	weekday uint64
+
+	// Cron semantics: when both day fields are restricted, a time matches if either does
+	daysRestricted    bool
+	weekdayRestricted bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField  = cronField{name: "minute", min: 0, max: 59}
+	hourField    = cronField{name: "hour", min: 0, max: 23}
+	dayField     = cronField{name: "day-of-month", min: 1, max: 31}
+	monthField   = cronField{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	weekdayField = cronField{name: "day-of-week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a 5-field cron expression or one of the @hourly/@daily/... descriptors
+func ParseCron(expr string) (*CronExpression, error) {
+	raw := strings.TrimSpace(expr)
+	spec := raw
+	if descriptor, ok := cronDescriptors[strings.ToLower(raw)]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	cron := &CronExpression{raw: raw}
+	var err error
+	if cron.minutes, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if cron.hours, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if cron.days, err = dayField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if cron.months, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if cron.weekday, err = weekdayField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// 7 is an alias for Sunday
+	if cron.weekday&(1<<7) != 0 {
+		cron.weekday |= 1
+	}
+	cron.daysRestricted = fields[2] != "*" && fields[2] != "?"
+	cron.weekdayRestricted = fields[4] != "*" && fields[4] != "?"
+	return cron, nil
+}
+
+// String returns the expression as it was written
+func (c *CronExpression) String() string {
+	return c.raw
+}
+
+// Next returns the first matching time strictly after t, in t's location.
+// It returns the zero time if nothing matches within five years (e.g. Feb 30).
+func (c *CronExpression) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *CronExpression) dayMatches(t time.Time) bool {
+	dayMatch := c.days&(1<<uint(t.Day())) != 0
+	weekdayMatch := c.weekday&(1<<uint(t.Weekday())) != 0
+
+	if c.daysRestricted && c.weekdayRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
+
+// parse converts one cron field (e.g. "*/15", "1-5", "mon,wed,fri") into a bitset
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, fmt.Errorf("invalid %s field %q", f.name, field)
+		}
+
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, part)
+			}
+			step = s
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s field %q", f.name, part)
+			}
+		default:
+			v, err := f.value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/10" means starting at 5 every 10; a bare value is just that value
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
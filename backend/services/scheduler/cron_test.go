@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 0-6,22 1 jan-jun mon,wed,fri", false},
+		{"0 0 ? * 7", false},
+		{"@hourly", false},
+		{"@Weekly", false},
+		{"", true},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+		{"1,,2 * * * *", true},
+		{"* * * foo *", true},
+		{"@fortnightly", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronExpressionString(t *testing.T) {
+	cron, err := ParseCron("  @daily ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cron.String(); got != "@daily" {
+		t.Errorf("String() = %q, want %q", got, "@daily")
+	}
+}
+
+func TestCronExpressionNext(t *testing.T) {
+	// 2024-03-01 is a Friday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every 15 minutes", "*/15 * * * *", at(3, 1, 10, 7).Add(30 * time.Second), at(3, 1, 10, 15)},
+		{"strictly after", "0 10 * * *", at(3, 1, 10, 0), at(3, 2, 10, 0)},
+		{"start and step", "5/20 * * * *", at(3, 1, 10, 6), at(3, 1, 10, 25)},
+		{"weekdays skip the weekend", "0 9 * * mon-fri", at(3, 1, 9, 0), at(3, 4, 9, 0)},
+		{"descriptor", "@daily", at(3, 1, 23, 59), at(3, 2, 0, 0)},
+		{"next month", "30 2 1 * *", at(3, 1, 3, 0), at(4, 1, 2, 30)},
+		{"7 is sunday", "0 0 * * 7", at(3, 1, 0, 0), at(3, 3, 0, 0)},
+		{"day of month or weekday", "0 0 13 * fri", at(3, 1, 0, 0), at(3, 8, 0, 0)},
+		{"month name", "0 0 1 jan *", at(3, 1, 0, 0), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 12 29 2 *", at(3, 1, 0, 0), time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", at(3, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cron.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
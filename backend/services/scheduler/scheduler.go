@@ -0,0 +1,414 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/queuemonitor"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionSchedules
+
+// maxJitterSeconds bounds the random delay added to each scheduled run
+const maxJitterSeconds = 3600
+
+// ErrNotFound is returned when a schedule does not exist for the tenant
+var ErrNotFound = errors.New("schedule not found")
+
+// ErrInvalid is wrapped by every schedule validation error
+var ErrInvalid = errors.New("invalid schedule")
+
+// Schedule runs a background job for a tenant whenever its cron expression matches
+type Schedule struct {
+	ID            primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	TenantID      string                 `bson:"tenantId" json:"tenantId"`
+	Name          string                 `bson:"name" json:"name"`
+	JobType       string                 `bson:"jobType" json:"jobType"`
+	Cron          string                 `bson:"cron" json:"cron"`
+	Timezone      string                 `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Payload       map[string]interface{} `bson:"payload,omitempty" json:"payload,omitempty"`
+	Enabled       bool                   `bson:"enabled" json:"enabled"`
+	JitterSeconds int                    `bson:"jitterSeconds" json:"jitterSeconds"`
+	AllowOverlap  bool                   `bson:"allowOverlap" json:"allowOverlap"`
+
+	NextRunAt      *time.Time `bson:"nextRunAt,omitempty" json:"nextRunAt,omitempty"`
+	LastRunAt      *time.Time `bson:"lastRunAt,omitempty" json:"lastRunAt,omitempty"`
+	LastJobID      string     `bson:"lastJobId,omitempty" json:"lastJobId,omitempty"`
+	LastSkippedAt  *time.Time `bson:"lastSkippedAt,omitempty" json:"lastSkippedAt,omitempty"`
+	LastSkipReason string     `bson:"lastSkipReason,omitempty" json:"lastSkipReason,omitempty"`
+	CreatedAt      time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Scheduler stores tenant schedules and enqueues their jobs when they are due
+type Scheduler struct {
+	collection *mongo.Collection
+	jobs       *jobs.Manager
+	interval   time.Duration
+
+	mu          sync.RWMutex
+	lowPriority map[string]bool
+}
+
+var defaultScheduler *Scheduler
+
+// Init creates the process-wide scheduler backed by the given database
+func Init(db *mongo.Database, manager *jobs.Manager) *Scheduler {
+	defaultScheduler = NewScheduler(db, manager)
+	return defaultScheduler
+}
+
+// Default returns the process-wide scheduler created by Init
+func Default() *Scheduler {
+	return defaultScheduler
+}
+
+// NewScheduler creates a Scheduler using the schedules collection
+func NewScheduler(db *mongo.Database, manager *jobs.Manager) *Scheduler {
+	return &Scheduler{
+		collection:  db.Collection(collectionName),
+		jobs:        manager,
+		interval:    30 * time.Second,
+		lowPriority: make(map[string]bool),
+	}
+}
+
+// SetLowPriority marks job types whose scheduled runs are skipped while the
+// findings queues are backed up
+func (s *Scheduler) SetLowPriority(jobTypes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, jobType := range jobTypes {
+		s.lowPriority[jobType] = true
+	}
+}
+
+func (s *Scheduler) isLowPriority(jobType string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lowPriority[jobType]
+}
+
+// Validate checks the schedule's cron expression, timezone, job type and jitter
+func (s *Scheduler) Validate(schedule *Schedule) error {
+	if strings.TrimSpace(schedule.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if !s.jobs.HasHandler(schedule.JobType) {
+		return fmt.Errorf("%w: unknown job type '%s'", ErrInvalid, schedule.JobType)
+	}
+	if _, err := ParseCron(schedule.Cron); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("%w: invalid timezone '%s'", ErrInvalid, schedule.Timezone)
+	}
+	if schedule.JitterSeconds < 0 || schedule.JitterSeconds > maxJitterSeconds {
+		return fmt.Errorf("%w: jitterSeconds must be between 0 and %d", ErrInvalid, maxJitterSeconds)
+	}
+	return nil
+}
+
+// nextRun returns the first time after t at which the schedule fires
+func nextRun(schedule *Schedule, after time.Time) (time.Time, error) {
+	expr, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := expr.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression '%s' never matches", schedule.Cron)
+	}
+	return next.UTC(), nil
+}
+
+// Create validates and stores a new schedule for the tenant
+func (s *Scheduler) Create(ctx context.Context, schedule *Schedule) error {
+	if err := s.Validate(schedule); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	schedule.ID = primitive.NilObjectID
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	schedule.LastRunAt, schedule.LastJobID = nil, ""
+	schedule.LastSkippedAt, schedule.LastSkipReason = nil, ""
+	if err := s.refreshNextRun(schedule, now); err != nil {
+		return err
+	}
+
+	res, err := s.collection.InsertOne(ctx, schedule)
+	if err != nil {
+		return fmt.Errorf("failed to create schedule: %w", err)
+	}
+	schedule.ID = res.InsertedID.(primitive.ObjectID)
+	log.Printf("[Scheduler] ✅ Created schedule %s (%s '%s') for tenant %s", schedule.ID.Hex(), schedule.JobType, schedule.Cron, schedule.TenantID)
+	return nil
+}
+
+// refreshNextRun recomputes NextRunAt, clearing it for disabled schedules
+func (s *Scheduler) refreshNextRun(schedule *Schedule, after time.Time) error {
+	if !schedule.Enabled {
+		schedule.NextRunAt = nil
+		return nil
+	}
+	next, err := nextRun(schedule, after)
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = &next
+	return nil
+}
+
+// Get returns a single schedule belonging to the tenant
+func (s *Scheduler) Get(ctx context.Context, tenantID, id string) (*Schedule, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var schedule Schedule
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&schedule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// List returns every schedule belonging to the tenant
+func (s *Scheduler) List(ctx context.Context, tenantID string) ([]Schedule, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"tenantId": tenantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	schedules := []Schedule{}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to decode schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// Update replaces the editable fields of a schedule and recomputes its next run
+func (s *Scheduler) Update(ctx context.Context, tenantID, id string, changes *Schedule) (*Schedule, error) {
+	existing, err := s.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Name = changes.Name
+	existing.JobType = changes.JobType
+	existing.Cron = changes.Cron
+	existing.Timezone = changes.Timezone
+	existing.Payload = changes.Payload
+	existing.Enabled = changes.Enabled
+	existing.JitterSeconds = changes.JitterSeconds
+	existing.AllowOverlap = changes.AllowOverlap
+	if err := s.Validate(existing); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	existing.UpdatedAt = now
+	if err := s.refreshNextRun(existing, now); err != nil {
+		return nil, err
+	}
+
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": existing.ID, "tenantId": tenantID}, existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return existing, nil
+}
+
+// SetEnabled pauses or resumes a schedule. Resuming computes the next run from now, so
+// occurrences missed while paused are not caught up.
+func (s *Scheduler) SetEnabled(ctx context.Context, tenantID, id string, enabled bool) (*Schedule, error) {
+	existing, err := s.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	existing.Enabled = enabled
+	existing.UpdatedAt = now
+	if err := s.refreshNextRun(existing, now); err != nil {
+		return nil, err
+	}
+
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": existing.ID, "tenantId": tenantID}, bson.M{"$set": bson.M{
+		"enabled":   existing.Enabled,
+		"nextRunAt": existing.NextRunAt,
+		"updatedAt": existing.UpdatedAt,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return existing, nil
+}
+
+// Delete removes a schedule belonging to the tenant
+func (s *Scheduler) Delete(ctx context.Context, tenantID, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": oid, "tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Start checks for due schedules on an interval until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	log.Printf("[Scheduler] Checking schedules every %s", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("[Scheduler] Stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick fires every enabled schedule whose next run time has passed
+func (s *Scheduler) tick(ctx context.Context) {
+	now := time.Now()
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"enabled":   true,
+		"nextRunAt": bson.M{"$lte": now},
+	})
+	if err != nil {
+		log.Printf("[Scheduler] Warning: failed to load due schedules: %v", err)
+		return
+	}
+
+	var due []Schedule
+	if err := cursor.All(ctx, &due); err != nil {
+		log.Printf("[Scheduler] Warning: failed to decode due schedules: %v", err)
+		return
+	}
+
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.fire(ctx, &due[i], now)
+	}
+}
+
+// fire claims a due schedule by advancing its next run time, then enqueues its
+// job unless the previous run is still in progress or the pipeline is backed up
+func (s *Scheduler) fire(ctx context.Context, schedule *Schedule, now time.Time) {
+	previousRunAt := *schedule.NextRunAt
+	if err := s.refreshNextRun(schedule, now); err != nil {
+		log.Printf("[Scheduler] Warning: schedule %s has an invalid cron expression: %v", schedule.ID.Hex(), err)
+		return
+	}
+
+	// Only the instance that moves nextRunAt forward gets to run this occurrence
+	res, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": schedule.ID, "nextRunAt": previousRunAt},
+		bson.M{"$set": bson.M{"nextRunAt": schedule.NextRunAt}},
+	)
+	if err != nil {
+		log.Printf("[Scheduler] Warning: failed to claim schedule %s: %v", schedule.ID.Hex(), err)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		return
+	}
+
+	if reason := s.skipReason(ctx, schedule); reason != "" {
+		log.Printf("[Scheduler] ⏭️ Skipping schedule %s (%s): %s", schedule.ID.Hex(), schedule.Name, reason)
+		s.recordSkip(ctx, schedule, reason, now)
+		return
+	}
+
+	payload := make(map[string]interface{}, len(schedule.Payload)+1)
+	for k, v := range schedule.Payload {
+		payload[k] = v
+	}
+	payload["scheduleId"] = schedule.ID.Hex()
+
+	runAt := now
+	if schedule.JitterSeconds > 0 {
+		runAt = runAt.Add(time.Duration(rand.Intn(schedule.JitterSeconds+1)) * time.Second)
+	}
+
+	job, err := s.jobs.EnqueueAt(ctx, schedule.JobType, schedule.TenantID, payload, runAt)
+	if err != nil {
+		log.Printf("[Scheduler] Warning: failed to enqueue %s for schedule %s: %v", schedule.JobType, schedule.ID.Hex(), err)
+		s.recordSkip(ctx, schedule, err.Error(), now)
+		return
+	}
+
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": schedule.ID}, bson.M{"$set": bson.M{
+		"lastRunAt": now,
+		"lastJobId": job.ID.Hex(),
+	}})
+	if err != nil {
+		log.Printf("[Scheduler] Warning: failed to record run for schedule %s: %v", schedule.ID.Hex(), err)
+	}
+	log.Printf("[Scheduler] ✅ Schedule %s (%s) enqueued job %s to run at %s", schedule.ID.Hex(), schedule.Name, job.ID.Hex(), runAt.Format(time.RFC3339))
+}
+
+// skipReason returns why this occurrence should not run, or "" if it should
+func (s *Scheduler) skipReason(ctx context.Context, schedule *Schedule) string {
+	if !schedule.AllowOverlap && schedule.LastJobID != "" {
+		active, err := s.jobs.IsActive(ctx, schedule.LastJobID)
+		if err != nil {
+			return fmt.Sprintf("failed to check previous run: %v", err)
+		}
+		if active {
+			return fmt.Sprintf("previous run %s is still in progress", schedule.LastJobID)
+		}
+	}
+	if s.isLowPriority(schedule.JobType) && queuemonitor.ShouldPauseLowPriority() {
+		return "findings queue is backed up"
+	}
+	return ""
+}
+
+func (s *Scheduler) recordSkip(ctx context.Context, schedule *Schedule, reason string, at time.Time) {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": schedule.ID}, bson.M{"$set": bson.M{
+		"lastSkippedAt":  at,
+		"lastSkipReason": reason,
+	}})
+	if err != nil {
+		log.Printf("[Scheduler] Warning: failed to record skip for schedule %s: %v", schedule.ID.Hex(), err)
+	}
+}
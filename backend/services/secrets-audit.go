@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Compliance rules produced by the secrets audit. They are reported next to the AWS Config
+// rules, so they show up in findings and compliance reports the same way.
+const (
+	RuleSecretRotationEnabled       = "cloudloom-secretsmanager-rotation-enabled"
+	RuleSecretNoCrossAccountAccess  = "cloudloom-secretsmanager-no-cross-account-access"
+	RuleSensitiveParameterEncrypted = "cloudloom-ssm-sensitive-parameter-securestring"
+	secretsAuditRuleSource          = "CLOUDLOOM"
+	secretResourceType              = "AWS::SecretsManager::Secret"
+	parameterResourceType           = "AWS::SSM::Parameter"
+)
+
+// sensitiveParameterName matches parameter names that suggest the value is a credential
+var sensitiveParameterName = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api[-_]?key|private[-_]?key|credential)`)
+
+// SecretItem is a Secrets Manager secret's metadata; values are never read
+type SecretItem struct {
+	Name            string          `json:"name"`
+	ARN             string          `json:"arn"`
+	KmsKeyID        string          `json:"kmsKeyId,omitempty"`
+	RotationEnabled bool            `json:"rotationEnabled"`
+	LastRotatedDate *time.Time      `json:"lastRotatedDate,omitempty"`
+	LastChangedDate *time.Time      `json:"lastChangedDate,omitempty"`
+	ExternalGrants  []ExternalGrant `json:"externalGrants,omitempty"`
+}
+
+// ParameterItem is an SSM Parameter Store parameter's metadata; values are never read
+type ParameterItem struct {
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	Tier             string     `json:"tier,omitempty"`
+	KeyID            string     `json:"keyId,omitempty"`
+	LastModifiedDate *time.Time `json:"lastModifiedDate,omitempty"`
+	// Sensitive is set when the name suggests the value is a credential
+	Sensitive bool `json:"sensitive"`
+}
+
+// SecretsAudit is the secrets and parameters inventory and the rules evaluated against it
+type SecretsAudit struct {
+	Secrets    []SecretItem
+	Parameters []ParameterItem
+	Rules      []ComplianceRule
+}
+
+// AuditSecrets inventories Secrets Manager secrets and SSM parameters and evaluates them for
+// missing rotation, resource policies granting access outside the account, and credentials
+// stored as plaintext String parameters instead of SecureString
+func (cs *ConfigService) AuditSecrets(ctx context.Context, cfg aws.Config) (*SecretsAudit, error) {
+	log.Println("[SecretsAudit] Auditing secrets and parameters...")
+	audit := &SecretsAudit{}
+	now := time.Now()
+
+	secrets, err := listSecrets(ctx, secretsmanager.NewFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	audit.Secrets = secrets
+
+	parameters, err := listParameters(ctx, ssm.NewFromConfig(cfg))
+	if err != nil {
+		// Parameter Store is audited on a best-effort basis so a missing permission does not hide secrets
+		log.Printf("[SecretsAudit] Warning: %v", err)
+	}
+	audit.Parameters = parameters
+
+	rotation := newAuditRule(RuleSecretRotationEnabled, secretResourceType)
+	crossAccount := newAuditRule(RuleSecretNoCrossAccountAccess, secretResourceType)
+	for _, secret := range secrets {
+		if secret.RotationEnabled {
+			rotation.evaluate(secret.Name, true, "", now)
+		} else {
+			rotation.evaluate(secret.Name, false, "Automatic rotation is not configured", now)
+		}
+
+		grants := make([]string, 0, len(secret.ExternalGrants))
+		for _, grant := range secret.ExternalGrants {
+			grants = append(grants, grant.String())
+		}
+		crossAccount.evaluate(secret.Name, len(grants) == 0,
+			"Resource policy grants access outside the account: "+strings.Join(grants, "; "), now)
+	}
+
+	plaintext := newAuditRule(RuleSensitiveParameterEncrypted, parameterResourceType)
+	for _, parameter := range parameters {
+		if !parameter.Sensitive {
+			continue
+		}
+		plaintext.evaluate(parameter.Name, parameter.Type == string(ssmtypes.ParameterTypeSecureString),
+			fmt.Sprintf("Parameter looks like a credential but is stored as a plaintext %s", parameter.Type), now)
+	}
+
+	audit.Rules = []ComplianceRule{rotation.rule(), crossAccount.rule(), plaintext.rule()}
+	log.Printf("[SecretsAudit] ✅ Audited %d secrets and %d parameters", len(secrets), len(parameters))
+	return audit, nil
+}
+
+func listSecrets(ctx context.Context, client *secretsmanager.Client) ([]SecretItem, error) {
+	var secrets []SecretItem
+	paginator := secretsmanager.NewListSecretsPaginator(client, &secretsmanager.ListSecretsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		for _, entry := range page.SecretList {
+			secret := SecretItem{
+				Name:            aws.ToString(entry.Name),
+				ARN:             aws.ToString(entry.ARN),
+				KmsKeyID:        aws.ToString(entry.KmsKeyId),
+				RotationEnabled: aws.ToBool(entry.RotationEnabled),
+				LastRotatedDate: entry.LastRotatedDate,
+				LastChangedDate: entry.LastChangedDate,
+			}
+
+			policy, err := client.GetResourcePolicy(ctx, &secretsmanager.GetResourcePolicyInput{SecretId: entry.ARN})
+			if err != nil {
+				log.Printf("[SecretsAudit] Warning: failed to get resource policy of %s: %v", secret.Name, err)
+			} else {
+				grants, err := ExternalGrants(aws.ToString(policy.ResourcePolicy), principalAccount(secret.ARN))
+				if err != nil {
+					log.Printf("[SecretsAudit] Warning: %s: %v", secret.Name, err)
+				}
+				secret.ExternalGrants = grants
+			}
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets, nil
+}
+
+func listParameters(ctx context.Context, client *ssm.Client) ([]ParameterItem, error) {
+	var parameters []ParameterItem
+	paginator := ssm.NewDescribeParametersPaginator(client, &ssm.DescribeParametersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return parameters, fmt.Errorf("failed to describe parameters: %w", err)
+		}
+		for _, p := range page.Parameters {
+			name := aws.ToString(p.Name)
+			parameters = append(parameters, ParameterItem{
+				Name:             name,
+				Type:             string(p.Type),
+				Tier:             string(p.Tier),
+				KeyID:            aws.ToString(p.KeyId),
+				LastModifiedDate: p.LastModifiedDate,
+				Sensitive:        sensitiveParameterName.MatchString(name),
+			})
+		}
+	}
+	return parameters, nil
+}
+
+// auditRule collects the evaluations of one CloudLoom-defined rule
+type auditRule struct {
+	name         string
+	resourceType string
+	results      []EvaluationResult
+	failed       bool
+}
+
+func newAuditRule(name, resourceType string) *auditRule {
+	return &auditRule{name: name, resourceType: resourceType, results: []EvaluationResult{}}
+}
+
+// evaluate records one resource's result; the annotation is kept only for failures
+func (r *auditRule) evaluate(resourceID string, compliant bool, annotation string, at time.Time) {
+	r.evaluateAs(r.resourceType, resourceID, compliant, annotation, at)
+}
+
+// evaluateAs records a result for a rule that covers several resource types
+func (r *auditRule) evaluateAs(resourceType, resourceID string, compliant bool, annotation string, at time.Time) {
+	result := EvaluationResult{
+		ResourceID:         resourceID,
+		ResourceType:       resourceType,
+		ComplianceType:     "COMPLIANT",
+		OrderingTimestamp:  at,
+		ResultRecordedTime: at,
+	}
+	if !compliant {
+		result.ComplianceType = "NON_COMPLIANT"
+		result.Annotation = annotation
+		r.failed = true
+	}
+	r.results = append(r.results, result)
+}
+
+func (r *auditRule) rule() ComplianceRule {
+	complianceType := "COMPLIANT"
+	switch {
+	case r.failed:
+		complianceType = "NON_COMPLIANT"
+	case len(r.results) == 0:
+		complianceType = "INSUFFICIENT_DATA"
+	}
+	return ComplianceRule{
+		ConfigRuleName:    r.name,
+		ComplianceType:    complianceType,
+		Source:            secretsAuditRuleSource,
+		ResourceType:      r.resourceType,
+		EvaluationResults: r.results,
+	}
+}
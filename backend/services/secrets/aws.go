@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// awsNamePrefix namespaces every secret the backend creates in Secrets Manager
+const awsNamePrefix = "cloudloom/"
+
+// AWS stores secrets in AWS Secrets Manager, encrypted with a KMS key
+type AWS struct {
+	client   *secretsmanager.Client
+	kmsKeyID string
+}
+
+// NewAWS creates a Secrets Manager store. An empty kmsKeyID uses the account's default key.
+func NewAWS(cfg aws.Config, kmsKeyID string) *AWS {
+	return &AWS{client: secretsmanager.NewFromConfig(cfg), kmsKeyID: kmsKeyID}
+}
+
+// Get returns the current value of the secret
+func (a *AWS) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(awsNamePrefix + name),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	if out.SecretBinary != nil {
+		return out.SecretBinary, nil
+	}
+	return []byte(aws.ToString(out.SecretString)), nil
+}
+
+// Put stores a new version of the secret, creating it on first use
+func (a *AWS) Put(ctx context.Context, name string, value []byte) error {
+	_, err := a.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(awsNamePrefix + name),
+		SecretBinary: value,
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		if err != nil {
+			return fmt.Errorf("failed to update secret %s: %w", name, err)
+		}
+		return nil
+	}
+
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(awsNamePrefix + name),
+		SecretBinary: value,
+	}
+	if a.kmsKeyID != "" {
+		input.KmsKeyId = aws.String(a.kmsKeyID)
+	}
+	if _, err := a.client.CreateSecret(ctx, input); err != nil {
+		return fmt.Errorf("failed to create secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes the secret without a recovery window, so a secret of the same name can be
+// stored again straight away and purged values cannot be restored
+func (a *AWS) Delete(ctx context.Context, name string) error {
+	_, err := a.client.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(awsNamePrefix + name),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionSecrets
+
+// localSecret is the stored form of a locally encrypted secret
+type localSecret struct {
+	Name       string    `bson:"_id"`
+	Nonce      []byte    `bson:"nonce"`
+	Ciphertext []byte    `bson:"ciphertext"`
+	UpdatedAt  time.Time `bson:"updatedAt"`
+}
+
+// Local stores secrets in MongoDB encrypted with AES-256-GCM. It is the fallback for
+// deployments without AWS Secrets Manager.
+type Local struct {
+	collection *mongo.Collection
+	aead       cipher.AEAD
+}
+
+// NewLocal creates a Local store using the given 32-byte key
+func NewLocal(db *mongo.Database, key []byte) (*Local, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{collection: db.Collection(collectionName), aead: aead}, nil
+}
+
+// Get decrypts and returns the secret
+func (l *Local) Get(ctx context.Context, name string) ([]byte, error) {
+	var stored localSecret
+	err := l.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	// The name is authenticated so a ciphertext cannot be moved to another secret
+	value, err := l.aead.Open(nil, stored.Nonce, stored.Ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// Put encrypts and stores the secret, replacing any previous value
+func (l *Local) Put(ctx context.Context, name string, value []byte) error {
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	stored := localSecret{
+		Name:       name,
+		Nonce:      nonce,
+		Ciphertext: l.aead.Seal(nil, nonce, value, []byte(name)),
+		UpdatedAt:  time.Now(),
+	}
+
+	_, err := l.collection.ReplaceOne(ctx, bson.M{"_id": name}, stored, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes the secret
+func (l *Local) Delete(ctx context.Context, name string) error {
+	result, err := l.collection.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", name, err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
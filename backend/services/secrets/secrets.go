@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Well-known secret names. Integration credentials are scoped per tenant with TenantName.
+const (
+	GitHubAppPrivateKey = "github/app-private-key"
+)
+
+// Integrations whose credentials may be stored per tenant
+var Integrations = []string{"github", "slack", "jira", "servicenow", "siem"}
+
+// WebhookSigningSecrets is the per-tenant secret holding the signing secret of each of the
+// tenant's webhooks, by webhook ID
+const WebhookSigningSecrets = "webhooks"
+
+// NotifierWebhookURLs is the per-tenant secret holding the incoming webhook URL of each of the
+// tenant's Slack and Teams notifiers, by notifier ID
+const NotifierWebhookURLs = "notifiers"
+
+// TenantSecrets are the names, for TenantName, of every secret that may be stored per tenant
+func TenantSecrets() []string {
+	return append(append([]string(nil), Integrations...), WebhookSigningSecrets, NotifierWebhookURLs)
+}
+
+// ErrNotFound is returned when a secret does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secret values encrypted at rest
+type Store interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, value []byte) error
+	Delete(ctx context.Context, name string) error
+}
+
+var defaultStore Store
+
+// Init selects the process-wide secret store: AWS Secrets Manager when SECRETS_BACKEND=aws,
+// otherwise MongoDB documents encrypted with the base64 AES-256 key in SECRETS_LOCAL_KEY.
+// Without either, no store is configured and callers fall back to their legacy sources.
+func Init(cfg aws.Config, db *mongo.Database) Store {
+	if os.Getenv("SECRETS_BACKEND") == "aws" {
+		log.Println("[Secrets] ✅ Using AWS Secrets Manager")
+		defaultStore = NewAWS(cfg, os.Getenv("SECRETS_KMS_KEY_ID"))
+		return defaultStore
+	}
+
+	encoded := os.Getenv("SECRETS_LOCAL_KEY")
+	if encoded == "" {
+		log.Println("[Secrets] Warning: no secret store configured; set SECRETS_BACKEND=aws or SECRETS_LOCAL_KEY")
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err == nil {
+		defaultStore, err = NewLocal(db, key)
+	}
+	if err != nil {
+		log.Printf("[Secrets] Warning: invalid SECRETS_LOCAL_KEY: %v", err)
+		return nil
+	}
+	log.Println("[Secrets] ✅ Using locally encrypted secret store")
+	return defaultStore
+}
+
+// Default returns the process-wide secret store, or nil if none is configured
+func Default() Store {
+	return defaultStore
+}
+
+// TenantName returns the secret name of an integration's credentials for a tenant
+func TenantName(tenantID, integration string) string {
+	return fmt.Sprintf("tenants/%s/%s", tenantID, integration)
+}
+
+// IsIntegration reports whether name is an integration that accepts stored credentials
+func IsIntegration(name string) bool {
+	for _, integration := range Integrations {
+		if integration == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJSON decodes a JSON secret into out
+func GetJSON(ctx context.Context, store Store, name string, out interface{}) error {
+	value, err := store.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(value, out); err != nil {
+		return fmt.Errorf("failed to decode secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// PutJSON stores value as a JSON secret
+func PutJSON(ctx context.Context, store Store, name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret %s: %w", name, err)
+	}
+	return store.Put(ctx, name, data)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	shtypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// FindingSourceSecurityHub marks findings imported from AWS Security Hub
+const FindingSourceSecurityHub = "securityhub"
+
+// SecurityHubService enables Security Hub in a customer account and turns the findings it
+// sends through EventBridge into CloudLoom findings
+type SecurityHubService struct {
+	client *securityhub.Client
+}
+
+// NewSecurityHubService creates a SecurityHubService for the account and region of cfg
+func NewSecurityHubService(cfg aws.Config) *SecurityHubService {
+	return &SecurityHubService{client: securityhub.NewFromConfig(cfg)}
+}
+
+// Enable turns Security Hub on with its default standards. An account that already has it
+// enabled is left as it is.
+func (s *SecurityHubService) Enable(ctx context.Context) error {
+	_, err := s.client.EnableSecurityHub(ctx, &securityhub.EnableSecurityHubInput{
+		EnableDefaultStandards: aws.Bool(true),
+	})
+	var conflict *shtypes.ResourceConflictException
+	if errors.As(err, &conflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to enable Security Hub: %w", err)
+	}
+	return nil
+}
+
+// EnableSecurityHub enables Security Hub in the tenant's account, in the region CloudLoom
+// operates in, so its findings reach the tenant's queue
+func EnableSecurityHub(ctx context.Context, tenantID string) error {
+	if DemoModeEnabled() {
+		return nil
+	}
+	cfg, err := assumeTenantRole(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	if err := NewSecurityHubService(cfg).Enable(ctx); err != nil {
+		return err
+	}
+	log.Printf("[Security Hub] ✅ Enabled for tenant %s", tenantID)
+	return nil
+}
+
+// asffFinding is the part of an AWS Security Finding Format finding CloudLoom keeps
+type asffFinding struct {
+	ID           string   `json:"Id"`
+	ProductArn   string   `json:"ProductArn"`
+	GeneratorID  string   `json:"GeneratorId"`
+	AwsAccountID string   `json:"AwsAccountId"`
+	Types        []string `json:"Types"`
+	Title        string   `json:"Title"`
+	Description  string   `json:"Description"`
+	Severity     struct {
+		Label string `json:"Label"`
+	} `json:"Severity"`
+	Resources []struct {
+		Type string `json:"Type"`
+		ID   string `json:"Id"`
+	} `json:"Resources"`
+	Workflow struct {
+		Status string `json:"Status"`
+	} `json:"Workflow"`
+	RecordState string `json:"RecordState"`
+	Compliance  struct {
+		Status string `json:"Status"`
+	} `json:"Compliance"`
+}
+
+// IngestSecurityHubEvent records the findings of a "Security Hub Findings - Imported" event
+// received on the tenant's queue and returns how many it recorded or closed. Findings of
+// other accounts, which an administrator account may forward, are left out, since their
+// tenant is not the queue's.
+func IngestSecurityHubEvent(ctx context.Context, event *eventpipeline.Event) (int, error) {
+	store := findings.Default()
+	if store == nil {
+		return 0, nil
+	}
+
+	var detail struct {
+		Findings []asffFinding `json:"findings"`
+	}
+	if err := event.DecodeDetail(&detail); err != nil {
+		return 0, err
+	}
+
+	tenantID := event.TenantID
+	ingested := 0
+	for _, raw := range detail.Findings {
+		if raw.AwsAccountID != "" && raw.AwsAccountID != tenantID {
+			continue
+		}
+		finding := normalizeSecurityHubFinding(tenantID, raw)
+		if finding == nil {
+			continue
+		}
+
+		// Security Hub reports when a finding is resolved or suppressed rather than dropping it
+		if status, reason, closed := securityHubStatus(raw); closed {
+			fingerprint := findings.Fingerprint(finding.Source, finding.RuleID, finding.ResourceType, finding.ResourceID)
+			if _, err := store.Close(ctx, tenantID, fingerprint, status, reason); err != nil {
+				return ingested, err
+			}
+			ingested++
+			continue
+		}
+		if err := upsertFinding(ctx, store, finding); err != nil {
+			return ingested, err
+		}
+		ingested++
+	}
+	return ingested, nil
+}
+
+// normalizeSecurityHubFinding maps an ASFF finding onto a CloudLoom finding of its first
+// resource. Resources keep their ASFF type and ID, which for most resources is their ARN.
+// It returns nil for a finding without a resource.
+func normalizeSecurityHubFinding(tenantID string, raw asffFinding) *findings.Finding {
+	if len(raw.Resources) == 0 {
+		return nil
+	}
+	ruleID := raw.GeneratorID
+	if ruleID == "" && len(raw.Types) > 0 {
+		ruleID = raw.Types[0]
+	}
+	if ruleID == "" {
+		ruleID = raw.ID
+	}
+	severity := strings.ToLower(raw.Severity.Label)
+	if severity == "" {
+		severity = "informational"
+	}
+	return &findings.Finding{
+		TenantID:     tenantID,
+		Source:       FindingSourceSecurityHub,
+		RuleID:       ruleID,
+		Title:        raw.Title,
+		Description:  raw.Description,
+		Severity:     severity,
+		ResourceType: raw.Resources[0].Type,
+		ResourceID:   raw.Resources[0].ID,
+	}
+}
+
+// securityHubStatus returns the status a finding Security Hub no longer considers active
+// should have, and false for findings that are still active
+func securityHubStatus(raw asffFinding) (findings.Status, string, bool) {
+	switch {
+	case raw.Workflow.Status == "SUPPRESSED":
+		return findings.StatusSuppressed, "suppressed in Security Hub", true
+	case raw.Workflow.Status == "RESOLVED":
+		return findings.StatusResolved, "resolved in Security Hub", true
+	case raw.RecordState == "ARCHIVED":
+		return findings.StatusResolved, "archived by Security Hub", true
+	case raw.Compliance.Status == "PASSED":
+		return findings.StatusResolved, "passed in Security Hub", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,510 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// What setup would do to each resource
+const (
+	PlanCreate   = "create"
+	PlanUpdate   = "update"
+	PlanNoChange = "no_change"
+)
+
+// PlannedChange is what setup would do to one resource
+type PlannedChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SetupPlan is what setting an account up would create or modify, worked out without calling
+// any mutating AWS API. MissingPermissions and DisabledRegions list what would make setup fail.
+type SetupPlan struct {
+	AccountID          string          `json:"accountId"`
+	Region             string          `json:"region"`
+	Regions            []string        `json:"regions"`
+	Changes            []PlannedChange `json:"changes"`
+	MissingPermissions []Permission    `json:"missingPermissions,omitempty"`
+	DisabledRegions    []string        `json:"disabledRegions,omitempty"`
+}
+
+func (p *SetupPlan) add(kind, name, region, action, detail string) {
+	p.Changes = append(p.Changes, PlannedChange{Kind: kind, Name: name, Region: region, Action: action, Detail: detail})
+}
+
+// PlanTenantSetup returns what setting the tenant's account up would change. The tenant is not
+// registered, so a plan leaves no trace in CloudLoom either.
+func PlanTenantSetup(ctx context.Context, tenant *tenants.Tenant) (*SetupPlan, error) {
+	return NewTenantCloudTrailService(tenant).PlanSetup(ctx)
+}
+
+// PlanSetup evaluates each step of SetupCloudTrail against the account using only read calls
+func (s *CloudTrailService) PlanSetup(ctx context.Context) (*SetupPlan, error) {
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[SetupPlan] Planning setup of account %s", accountID)
+
+	regions, err := s.resolveRegions(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, regions)
+	plan := &SetupPlan{AccountID: accountID, Region: cfg.Region, Regions: regions, Changes: []PlannedChange{}}
+
+	var regionsErr *RegionsNotEnabledError
+	if err := validateRegions(ctx, cfg, append([]string{cfg.Region}, regions...)); errors.As(err, &regionsErr) {
+		plan.DisabledRegions = regionsErr.Regions
+	} else if err != nil {
+		return nil, err
+	}
+	var missingErr *MissingPermissionsError
+	tier := s.tier()
+	if err := SimulateRolePermissions(ctx, cfg, s.roleArn(), setupPermissions(accountID, cfg.Region, names, tier)); errors.As(err, &missingErr) {
+		plan.MissingPermissions = missingErr.Missing
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case names.existingTrail:
+		// The customer's trail keeps its own bucket, log group, role and encryption
+		if names.existingBucket {
+			planExistingBucket(ctx, plan, cfg, names.bucket)
+		}
+		planExistingTrail(ctx, plan, cfg, accountID, names.trail)
+	case names.existingBucket:
+		planLogKey(ctx, plan, cfg, names.kmsKey)
+		planExistingBucket(ctx, plan, cfg, names.bucket)
+		logGroupArn := planLogGroup(ctx, plan, cfg, accountID, names.logGroup)
+		planLogRetention(ctx, plan, cfg, "", names.logGroup, s.logRetentionDays())
+		planRole(ctx, plan, cfg, fmt.Sprintf("CloudLoom-CloudTrail-Role-%s", accountID))
+		planTrail(ctx, plan, cfg, names.trail, names.bucket, logGroupArn, names.kmsKey, s.trailEvents())
+	default:
+		planLogKey(ctx, plan, cfg, names.kmsKey)
+		planBucket(ctx, plan, cfg, names.bucket, names.kmsKey)
+		logGroupArn := planLogGroup(ctx, plan, cfg, accountID, names.logGroup)
+		planLogRetention(ctx, plan, cfg, names.bucket, names.logGroup, s.logRetentionDays())
+		if names.replicationRegion != "" {
+			planReplication(ctx, plan, cfg, accountID, names.bucket, names.replicationRegion)
+		}
+		planRole(ctx, plan, cfg, fmt.Sprintf("CloudLoom-CloudTrail-Role-%s", accountID))
+		planTrail(ctx, plan, cfg, names.trail, names.bucket, logGroupArn, names.kmsKey, s.trailEvents())
+	}
+	topicArn := planTopic(ctx, plan, cfg, accountID, names.topic)
+	pattern, err := s.eventPattern(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Only tiers that have CloudLoom analyze events get the queue and its role
+	var queueArn string
+	if tier.Analyzes() {
+		queueArn = planQueue(ctx, plan, cfg, accountID, names.queue)
+		planRole(ctx, plan, cfg, fmt.Sprintf("CloudLoom-Events-Role-%s", accountID))
+	}
+	for _, region := range regions {
+		planRule(ctx, plan, inRegion(cfg, region), names.rules[region], pattern, topicArn, queueArn)
+	}
+	planRecorder(ctx, plan, cfg)
+
+	log.Printf("[SetupPlan] ✅ Planned %d resources for account %s", len(plan.Changes), accountID)
+	return plan, nil
+}
+
+// planLogKey adds the KMS key logs would be encrypted with, if the tenant asked for one
+func planLogKey(ctx context.Context, plan *SetupPlan, cfg aws.Config, keyID string) {
+	if keyID == "" {
+		return
+	}
+	action, detail := PlanNoChange, ""
+	client := kms.NewFromConfig(cfg)
+	if _, err := client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)}); err != nil {
+		if isNotFound(err) && strings.HasPrefix(keyID, "alias/") {
+			action, detail = PlanCreate, "customer managed key with automatic rotation"
+		} else {
+			detail = fmt.Sprintf("setup would fail: %v", err)
+		}
+	}
+	plan.add("kms_key", keyID, cfg.Region, action, detail)
+	plan.add("kms_key_policy", keyID, cfg.Region, PlanUpdate, "allow CloudTrail and AWS Config to encrypt logs")
+}
+
+func planBucket(ctx context.Context, plan *SetupPlan, cfg aws.Config, bucketName, keyID string) {
+	client := s3.NewFromConfig(cfg)
+	exists := true
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err != nil {
+		exists = false
+		plan.add("s3_bucket", bucketName, cfg.Region, PlanCreate, "")
+		plan.add("s3_bucket_policy", bucketName, cfg.Region, PlanCreate, "allow CloudTrail and AWS Config to deliver logs")
+	} else {
+		plan.add("s3_bucket", bucketName, cfg.Region, PlanNoChange, "")
+		plan.add("s3_bucket_policy", bucketName, cfg.Region, PlanUpdate, "replaced with the CloudTrail and AWS Config delivery policy")
+	}
+	if keyID == "" {
+		return
+	}
+	action := PlanCreate
+	if exists {
+		action = PlanUpdate
+	}
+	plan.add("s3_bucket_encryption", bucketName, cfg.Region, action, "SSE-KMS with "+keyID)
+}
+
+// planLogGroup returns the log group's ARN, as it is or as setup would create it
+func planLogGroup(ctx context.Context, plan *SetupPlan, cfg aws.Config, accountID, logGroupName string) string {
+	client := cloudwatchlogs.NewFromConfig(cfg)
+	logGroupArn := fmt.Sprintf("arn:aws:logs:%s:%s:log-group:%s", cfg.Region, accountID, logGroupName)
+
+	action := PlanCreate
+	groups, err := client.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(logGroupName)})
+	if err == nil {
+		for _, group := range groups.LogGroups {
+			if aws.ToString(group.LogGroupName) == logGroupName {
+				action = PlanNoChange
+			}
+		}
+	}
+	plan.add("log_group", logGroupName, cfg.Region, action, "")
+
+	action = PlanCreate
+	policies, err := client.DescribeResourcePolicies(ctx, &cloudwatchlogs.DescribeResourcePoliciesInput{})
+	if err == nil {
+		for _, policy := range policies.ResourcePolicies {
+			if aws.ToString(policy.PolicyName) == "CloudLoom-CloudTrail-Access-Policy" {
+				action = PlanUpdate
+			}
+		}
+	}
+	plan.add("log_resource_policy", "CloudLoom-CloudTrail-Access-Policy", cfg.Region, action, "allow CloudTrail to write to the log group")
+	return logGroupArn
+}
+
+// planExistingBucket reports the statements setup would add to the policy of a customer's
+// existing bucket, which is otherwise left as it is
+func planExistingBucket(ctx context.Context, plan *SetupPlan, cfg aws.Config, bucketName string) {
+	if _, err := s3.NewFromConfig(cfg).HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)}); err != nil {
+		plan.add("s3_bucket", bucketName, cfg.Region, PlanNoChange, fmt.Sprintf("setup would fail: %v", err))
+		return
+	}
+	plan.add("s3_bucket", bucketName, cfg.Region, PlanNoChange, "customer's existing bucket")
+	plan.add("s3_bucket_policy", bucketName, cfg.Region, PlanUpdate, "add CloudLoom statements allowing CloudTrail and AWS Config to deliver logs")
+}
+
+// planExistingTrail reports the customer's trail setup would reuse
+func planExistingTrail(ctx context.Context, plan *SetupPlan, cfg aws.Config, accountID, trailArn string) {
+	client := cloudtrail.NewFromConfig(cfg)
+	described, err := client.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{TrailNameList: []string{trailArn}, IncludeShadowTrails: aws.Bool(true)})
+	switch {
+	case err != nil:
+		plan.add("cloudtrail_trail", trailArn, cfg.Region, PlanNoChange, fmt.Sprintf("setup would fail: %v", err))
+	case len(described.TrailList) == 0:
+		plan.add("cloudtrail_trail", trailArn, cfg.Region, PlanNoChange, "setup would fail: trail not found")
+	case !aws.ToBool(described.TrailList[0].IsMultiRegionTrail):
+		plan.add("cloudtrail_trail", trailArn, cfg.Region, PlanNoChange, "setup would fail: not a multi-region trail")
+	case principalAccount(trailArn) != accountID:
+		plan.add("cloudtrail_trail", trailArn, cfg.Region, PlanNoChange, "reuse trail of account "+principalAccount(trailArn))
+	default:
+		plan.add("cloudtrail_trail", trailArn, cfg.Region, PlanUpdate, "reuse existing trail, adding the requested event selectors")
+	}
+}
+
+// planLogRetention adds the bucket lifecycle rule and log group retention setup would set.
+// An empty bucket name leaves the bucket out, as setup does for a customer's own bucket.
+func planLogRetention(ctx context.Context, plan *SetupPlan, cfg aws.Config, bucketName, logGroupName string, days int) {
+	if bucketName != "" {
+		var current int32
+		if lifecycle, err := s3.NewFromConfig(cfg).GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucketName)}); err == nil {
+			for _, rule := range lifecycle.Rules {
+				if aws.ToString(rule.ID) == logRetentionRuleID && rule.Expiration != nil {
+					current = aws.ToInt32(rule.Expiration.Days)
+				}
+			}
+		}
+		switch {
+		case int(current) == days:
+			plan.add("s3_lifecycle_rule", logRetentionRuleID, cfg.Region, PlanNoChange, "")
+		case days == 0:
+			plan.add("s3_lifecycle_rule", logRetentionRuleID, cfg.Region, PlanUpdate, "removed, logs kept indefinitely")
+		case current == 0:
+			plan.add("s3_lifecycle_rule", logRetentionRuleID, cfg.Region, PlanCreate, fmt.Sprintf("expire logs after %d days", days))
+		default:
+			plan.add("s3_lifecycle_rule", logRetentionRuleID, cfg.Region, PlanUpdate, fmt.Sprintf("expire logs after %d days instead of %d", days, current))
+		}
+	}
+
+	var want, have int32
+	if days > 0 {
+		want = logGroupRetention(days)
+	}
+	groups, err := cloudwatchlogs.NewFromConfig(cfg).DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(logGroupName)})
+	if err == nil {
+		for _, group := range groups.LogGroups {
+			if aws.ToString(group.LogGroupName) == logGroupName {
+				have = aws.ToInt32(group.RetentionInDays)
+			}
+		}
+	}
+	switch {
+	case want == have:
+		plan.add("log_group_retention", logGroupName, cfg.Region, PlanNoChange, "")
+	case want == 0:
+		plan.add("log_group_retention", logGroupName, cfg.Region, PlanUpdate, "never expire")
+	default:
+		plan.add("log_group_retention", logGroupName, cfg.Region, PlanUpdate, fmt.Sprintf("expire after %d days", want))
+	}
+}
+
+// planReplication reports the replica bucket, the role S3 replicates with and the log
+// bucket's replication rule
+func planReplication(ctx context.Context, plan *SetupPlan, cfg aws.Config, accountID, bucketName, region string) {
+	replicaName := replicaBucketName(accountID, region)
+	if _, err := s3.NewFromConfig(inRegion(cfg, region)).HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(replicaName)}); err != nil {
+		plan.add("s3_bucket", replicaName, region, PlanCreate, "versioned replica of "+bucketName)
+	} else {
+		plan.add("s3_bucket", replicaName, region, PlanUpdate, "enable versioning, block public access and default encryption")
+	}
+	planRole(ctx, plan, cfg, replicationRoleName(accountID))
+
+	configured := false
+	if out, err := s3.NewFromConfig(cfg).GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: aws.String(bucketName)}); err == nil {
+		for _, rule := range out.ReplicationConfiguration.Rules {
+			if aws.ToString(rule.ID) == logReplicationRuleID && rule.Destination != nil &&
+				aws.ToString(rule.Destination.Bucket) == "arn:aws:s3:::"+replicaName {
+				configured = true
+			}
+		}
+	}
+	if configured {
+		plan.add("s3_replication_rule", logReplicationRuleID, cfg.Region, PlanNoChange, "")
+		return
+	}
+	plan.add("s3_replication_rule", logReplicationRuleID, cfg.Region, PlanCreate, "enable versioning and replicate new logs to "+replicaName)
+}
+
+// planRole plans a role setup creates or updates. Setup replaces the role's inline policy and
+// detaches its managed policies.
+func planRole(ctx context.Context, plan *SetupPlan, cfg aws.Config, roleName string) {
+	client := iam.NewFromConfig(cfg)
+	if _, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)}); err != nil {
+		plan.add("iam_role", roleName, "", PlanCreate, "")
+		return
+	}
+
+	// Setup scopes its roles with inline policies and detaches any managed policy
+	detail := "inline policy is replaced"
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err == nil {
+		for _, policy := range attached.AttachedPolicies {
+			detail += ", detach " + aws.ToString(policy.PolicyArn)
+		}
+	}
+	plan.add("iam_role", roleName, "", PlanUpdate, detail)
+}
+
+func planTrail(ctx context.Context, plan *SetupPlan, cfg aws.Config, trailName, bucketName, logGroupArn, keyID string, events tenants.TrailEvents) {
+	client := cloudtrail.NewFromConfig(cfg)
+	trails, err := client.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{TrailNameList: []string{trailName}})
+	if err != nil || len(trails.TrailList) == 0 {
+		plan.add("cloudtrail_trail", trailName, cfg.Region, PlanCreate, "multi-region trail delivering to "+bucketName)
+		return
+	}
+
+	trail := trails.TrailList[0]
+	var differences []string
+	if aws.ToString(trail.S3BucketName) != bucketName {
+		differences = append(differences, fmt.Sprintf("bucket %s -> %s", aws.ToString(trail.S3BucketName), bucketName))
+	}
+	if !strings.HasPrefix(aws.ToString(trail.CloudWatchLogsLogGroupArn), logGroupArn) {
+		differences = append(differences, "log group -> "+logGroupArn)
+	}
+	if !aws.ToBool(trail.IsMultiRegionTrail) {
+		differences = append(differences, "made multi-region")
+	}
+	if !aws.ToBool(trail.IncludeGlobalServiceEvents) {
+		differences = append(differences, "include global service events")
+	}
+	if !aws.ToBool(trail.LogFileValidationEnabled) {
+		differences = append(differences, "enable log file validation")
+	}
+	// The trail reports its key by ARN, so a key setup creates is only known by its alias
+	if current := aws.ToString(trail.KmsKeyId); keyID != "" && current != keyID && (current == "" || !strings.HasPrefix(keyID, "alias/")) {
+		differences = append(differences, "encrypt with "+keyID)
+	}
+	differences = append(differences, selectorDifferences(ctx, client, trailName, bucketName, events)...)
+	if status, err := client.GetTrailStatus(ctx, &cloudtrail.GetTrailStatusInput{Name: aws.String(trailName)}); err == nil && !aws.ToBool(status.IsLogging) {
+		differences = append(differences, "start logging")
+	}
+
+	if len(differences) == 0 {
+		plan.add("cloudtrail_trail", trailName, cfg.Region, PlanNoChange, "")
+		return
+	}
+	plan.add("cloudtrail_trail", trailName, cfg.Region, PlanUpdate, strings.Join(differences, "; "))
+}
+
+// selectorDifferences describes how the trail's event and Insights selectors differ from the
+// ones setup would set. Selectors are compared by name, the way setup names them.
+func selectorDifferences(ctx context.Context, client *cloudtrail.Client, trailName, bucketName string, events tenants.TrailEvents) []string {
+	var differences []string
+	if current, err := client.GetEventSelectors(ctx, &cloudtrail.GetEventSelectorsInput{TrailName: aws.String(trailName)}); err == nil {
+		have := map[string]bool{}
+		for _, selector := range current.AdvancedEventSelectors {
+			have[aws.ToString(selector.Name)] = true
+		}
+		want := trailEventSelectors(bucketName, events)
+		for _, selector := range want {
+			if name := aws.ToString(selector.Name); !have[name] {
+				differences = append(differences, "record "+strings.ToLower(name))
+			}
+		}
+		if len(differences) == 0 && (len(current.AdvancedEventSelectors) != len(want) || len(current.EventSelectors) > 0) {
+			differences = append(differences, "replace event selectors")
+		}
+	}
+	if current, err := client.GetInsightSelectors(ctx, &cloudtrail.GetInsightSelectorsInput{TrailName: aws.String(trailName)}); err == nil {
+		if enabled := len(current.InsightSelectors) > 0; enabled != events.Insights {
+			differences = append(differences, fmt.Sprintf("Insights enabled: %t", events.Insights))
+		}
+	} else if events.Insights {
+		// Trails without Insights may return InsightNotEnabledException
+		differences = append(differences, "Insights enabled: true")
+	}
+	return differences
+}
+
+// planQueue returns the queue's ARN, as it is or as setup would create it
+// planTopic reports the notification topic, which CreateTopic reuses when it exists
+func planTopic(ctx context.Context, plan *SetupPlan, cfg aws.Config, accountID, topicName string) string {
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, topicName)
+	_, err := sns.NewFromConfig(cfg).GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+	if err != nil {
+		plan.add("sns_topic", topicName, cfg.Region, PlanCreate, "")
+	} else {
+		plan.add("sns_topic", topicName, cfg.Region, PlanNoChange, "")
+	}
+	plan.add("sns_topic_policy", topicName, cfg.Region, PlanUpdate, "allow the EventBridge rules to publish")
+	return topicArn
+}
+
+func planQueue(ctx context.Context, plan *SetupPlan, cfg aws.Config, accountID, queueName string) string {
+	client := sqs.NewFromConfig(cfg)
+	queueArn := fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, queueName)
+
+	queue, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		plan.add("sqs_queue", queueName, cfg.Region, PlanCreate, "")
+		plan.add("sqs_queue_policy", queueName, cfg.Region, PlanCreate, "allow the EventBridge rules to send messages")
+		return queueArn
+	}
+	plan.add("sqs_queue", queueName, cfg.Region, PlanNoChange, "")
+
+	action := PlanCreate
+	attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+	})
+	if err == nil && attrs.Attributes[string(sqstypes.QueueAttributeNamePolicy)] != "" {
+		action = PlanUpdate
+	}
+	plan.add("sqs_queue_policy", queueName, cfg.Region, action, "allow the EventBridge rules to send messages")
+	return queueArn
+}
+
+// planRule reports the changes to one region's rule, which matches pattern and targets the
+// topic and, when queueArn is set, the queue
+func planRule(ctx context.Context, plan *SetupPlan, cfg aws.Config, ruleName, pattern, topicArn, queueArn string) {
+	client := eventbridge.NewFromConfig(cfg)
+	rule, err := client.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ruleName)})
+	if err != nil {
+		detail := "send API calls to " + topicArn
+		if queueArn != "" {
+			detail += " and " + queueArn
+		}
+		plan.add("eventbridge_rule", ruleName, cfg.Region, PlanCreate, detail)
+		return
+	}
+
+	var differences []string
+	if !sameJSON(aws.ToString(rule.EventPattern), pattern) {
+		differences = append(differences, "event pattern")
+	}
+	if rule.State != ebtypes.RuleStateEnabled {
+		differences = append(differences, "enable")
+	}
+	topicTargeted, queueTargeted := false, false
+	if targets, err := client.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(ruleName)}); err == nil {
+		for _, target := range targets.Targets {
+			switch aws.ToString(target.Id) {
+			case notificationTargetID:
+				topicTargeted = aws.ToString(target.Arn) == topicArn
+			case autoApplyFixTargetID:
+				queueTargeted = true
+				if queueArn == "" {
+					differences = append(differences, "remove target "+aws.ToString(target.Arn))
+				} else if aws.ToString(target.Arn) != queueArn {
+					queueTargeted = false
+				}
+			}
+		}
+	}
+	if !topicTargeted {
+		differences = append(differences, "target "+topicArn)
+	}
+	if queueArn != "" && !queueTargeted {
+		differences = append(differences, "target "+queueArn)
+	}
+
+	if len(differences) == 0 {
+		plan.add("eventbridge_rule", ruleName, cfg.Region, PlanNoChange, "")
+		return
+	}
+	plan.add("eventbridge_rule", ruleName, cfg.Region, PlanUpdate, strings.Join(differences, "; "))
+}
+
+// planRecorder reports the account's AWS Config recorder. Enabling AWS Config is disabled in
+// SetupCloudTrail, so setup never changes the recorder.
+func planRecorder(ctx context.Context, plan *SetupPlan, cfg aws.Config) {
+	out, err := configservice.NewFromConfig(cfg).DescribeConfigurationRecorders(ctx, &configservice.DescribeConfigurationRecordersInput{})
+	if err != nil || len(out.ConfigurationRecorders) == 0 {
+		plan.add("config_recorder", "", cfg.Region, PlanNoChange, "AWS Config is not enabled; setup does not enable it")
+		return
+	}
+	plan.add("config_recorder", aws.ToString(out.ConfigurationRecorders[0].Name), cfg.Region, PlanNoChange, "")
+}
+
+// sameJSON reports whether two JSON documents are equal, ignoring formatting and key order
+func sameJSON(a, b string) bool {
+	var left, right interface{}
+	if json.Unmarshal([]byte(a), &left) != nil || json.Unmarshal([]byte(b), &right) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(left, right)
+}
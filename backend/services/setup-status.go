@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	cfgtypes "github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// How a CloudLoom component in the customer account is doing
+const (
+	ComponentHealthy  = "healthy"
+	ComponentDegraded = "degraded"
+	ComponentMissing  = "missing"
+	// ComponentUnknown means the component could not be checked, e.g. the role may not read it
+	ComponentUnknown = "unknown"
+)
+
+// ComponentStatus is whether one CloudLoom component is working right now
+type ComponentStatus struct {
+	Component string `json:"component"`
+	Name      string `json:"name"`
+	Region    string `json:"region,omitempty"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// SetupStatus is the health of every component setup created, checked against AWS
+type SetupStatus struct {
+	AccountID string `json:"accountId"`
+	// Healthy is set when every component is healthy
+	Healthy    bool              `json:"healthy"`
+	Components []ComponentStatus `json:"components"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+func (s *SetupStatus) add(component, name, region, status, detail string) {
+	s.Components = append(s.Components, ComponentStatus{Component: component, Name: name, Region: region, Status: status, Detail: detail})
+}
+
+// addErr records a component whose check failed: missing if AWS says it does not exist,
+// unknown otherwise
+func (s *SetupStatus) addErr(component, name, region string, err error) {
+	if isNotFound(err) {
+		s.add(component, name, region, ComponentMissing, "")
+		return
+	}
+	s.add(component, name, region, ComponentUnknown, err.Error())
+}
+
+// GetSetupStatus checks with live AWS calls whether each component setup created in the
+// tenant's account is working: the trail is logging, the Config recorder is recording, the
+// delivery channel is delivering, the topic and, for tiers that analyze events, the queue are
+// reachable, the EventBridge rules are enabled and the bucket policy still lets CloudTrail
+// deliver. Nothing is changed.
+func GetSetupStatus(ctx context.Context, tenantID string) (*SetupStatus, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+
+	status := &SetupStatus{AccountID: accountID, Components: []ComponentStatus{}}
+	checkTrail(ctx, status, cfg, names.trail)
+	checkRecorder(ctx, status, cfg)
+	checkDeliveryChannel(ctx, status, cfg)
+	checkTopic(ctx, status, cfg, accountID, names.topic)
+	analyzes := s.tier().Analyzes()
+	if analyzes {
+		checkQueue(ctx, status, cfg, names.queue)
+	}
+	for _, region := range names.regions {
+		checkRule(ctx, status, inRegion(cfg, region), names.rules[region], analyzes)
+	}
+	switch {
+	case names.existingBucket:
+		checkBucketPolicy(ctx, status, cfg, names.bucket, existingBucketRequiredStatements)
+	case !names.existingTrail:
+		// A customer's trail delivers to a bucket CloudLoom does not manage
+		checkBucketPolicy(ctx, status, cfg, names.bucket, requiredBucketStatements)
+	}
+	if names.replicationRegion != "" && !names.existingBucket && !names.existingTrail {
+		checkReplication(ctx, status, cfg, names.bucket, replicaBucketName(accountID, names.replicationRegion))
+	}
+
+	status.Healthy = true
+	for _, component := range status.Components {
+		if component.Status != ComponentHealthy {
+			status.Healthy = false
+		}
+	}
+	status.CheckedAt = time.Now()
+	log.Printf("[SetupStatus] Checked %d components of account %s (healthy=%t)", len(status.Components), accountID, status.Healthy)
+	return status, nil
+}
+
+func checkTrail(ctx context.Context, status *SetupStatus, cfg aws.Config, trailName string) {
+	out, err := cloudtrail.NewFromConfig(cfg).GetTrailStatus(ctx, &cloudtrail.GetTrailStatusInput{Name: aws.String(trailName)})
+	switch {
+	case err != nil:
+		status.addErr("cloudtrail_trail", trailName, cfg.Region, err)
+	case !aws.ToBool(out.IsLogging):
+		status.add("cloudtrail_trail", trailName, cfg.Region, ComponentDegraded, "logging is stopped")
+	case aws.ToString(out.LatestDeliveryError) != "":
+		status.add("cloudtrail_trail", trailName, cfg.Region, ComponentDegraded, "delivery failing: "+aws.ToString(out.LatestDeliveryError))
+	case aws.ToString(out.LatestCloudWatchLogsDeliveryError) != "":
+		status.add("cloudtrail_trail", trailName, cfg.Region, ComponentDegraded, "CloudWatch Logs delivery failing: "+aws.ToString(out.LatestCloudWatchLogsDeliveryError))
+	default:
+		status.add("cloudtrail_trail", trailName, cfg.Region, ComponentHealthy, "")
+	}
+}
+
+func checkRecorder(ctx context.Context, status *SetupStatus, cfg aws.Config) {
+	out, err := configservice.NewFromConfig(cfg).DescribeConfigurationRecorderStatus(ctx, &configservice.DescribeConfigurationRecorderStatusInput{})
+	if err != nil {
+		status.addErr("config_recorder", "", cfg.Region, err)
+		return
+	}
+	if len(out.ConfigurationRecordersStatus) == 0 {
+		status.add("config_recorder", "", cfg.Region, ComponentMissing, "AWS Config is not enabled")
+		return
+	}
+	recorder := out.ConfigurationRecordersStatus[0]
+	name := aws.ToString(recorder.Name)
+	switch {
+	case !recorder.Recording:
+		status.add("config_recorder", name, cfg.Region, ComponentDegraded, "not recording")
+	case recorder.LastStatus == cfgtypes.RecorderStatusFailure:
+		status.add("config_recorder", name, cfg.Region, ComponentDegraded, "last recording failed: "+aws.ToString(recorder.LastErrorMessage))
+	default:
+		status.add("config_recorder", name, cfg.Region, ComponentHealthy, "")
+	}
+}
+
+func checkDeliveryChannel(ctx context.Context, status *SetupStatus, cfg aws.Config) {
+	out, err := configservice.NewFromConfig(cfg).DescribeDeliveryChannelStatus(ctx, &configservice.DescribeDeliveryChannelStatusInput{})
+	if err != nil {
+		status.addErr("config_delivery_channel", "", cfg.Region, err)
+		return
+	}
+	if len(out.DeliveryChannelsStatus) == 0 {
+		status.add("config_delivery_channel", "", cfg.Region, ComponentMissing, "AWS Config has no delivery channel")
+		return
+	}
+	channel := out.DeliveryChannelsStatus[0]
+	var failures []string
+	deliveries := []struct {
+		kind string
+		info *cfgtypes.ConfigExportDeliveryInfo
+	}{{"history", channel.ConfigHistoryDeliveryInfo}, {"snapshot", channel.ConfigSnapshotDeliveryInfo}}
+	for _, delivery := range deliveries {
+		if delivery.info != nil && delivery.info.LastStatus == cfgtypes.DeliveryStatusFailure {
+			failures = append(failures, fmt.Sprintf("%s delivery failed: %s", delivery.kind, aws.ToString(delivery.info.LastErrorMessage)))
+		}
+	}
+	if len(failures) > 0 {
+		status.add("config_delivery_channel", aws.ToString(channel.Name), cfg.Region, ComponentDegraded, strings.Join(failures, "; "))
+		return
+	}
+	status.add("config_delivery_channel", aws.ToString(channel.Name), cfg.Region, ComponentHealthy, "")
+}
+
+func checkTopic(ctx context.Context, status *SetupStatus, cfg aws.Config, accountID, topicName string) {
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, topicName)
+	out, err := sns.NewFromConfig(cfg).GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+	if err != nil {
+		status.addErr("sns_topic", topicName, cfg.Region, err)
+		return
+	}
+	status.add("sns_topic", topicName, cfg.Region, ComponentHealthy,
+		fmt.Sprintf("%s confirmed subscriptions", out.Attributes["SubscriptionsConfirmed"]))
+}
+
+func checkQueue(ctx context.Context, status *SetupStatus, cfg aws.Config, queueName string) {
+	client := sqs.NewFromConfig(cfg)
+	queue, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		status.addErr("sqs_queue", queueName, cfg.Region, err)
+		return
+	}
+	attributes, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		status.add("sqs_queue", queueName, cfg.Region, ComponentDegraded, "not reachable: "+err.Error())
+		return
+	}
+	status.add("sqs_queue", queueName, cfg.Region, ComponentHealthy,
+		fmt.Sprintf("%s messages waiting", attributes.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)]))
+}
+
+// checkRule checks the rule is enabled and still targets the queue, or the topic when the
+// tenant's tier has no queue
+func checkRule(ctx context.Context, status *SetupStatus, cfg aws.Config, ruleName string, toQueue bool) {
+	client := eventbridge.NewFromConfig(cfg)
+	rule, err := client.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ruleName)})
+	if err != nil {
+		status.addErr("eventbridge_rule", ruleName, cfg.Region, err)
+		return
+	}
+	if rule.State != ebtypes.RuleStateEnabled {
+		status.add("eventbridge_rule", ruleName, cfg.Region, ComponentDegraded, "rule is "+string(rule.State))
+		return
+	}
+	targets, err := client.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(ruleName)})
+	if err != nil {
+		status.add("eventbridge_rule", ruleName, cfg.Region, ComponentUnknown, "cannot list targets: "+err.Error())
+		return
+	}
+	targetID, targetName := notificationTargetID, "topic"
+	if toQueue {
+		targetID, targetName = autoApplyFixTargetID, "queue"
+	}
+	for _, target := range targets.Targets {
+		if aws.ToString(target.Id) == targetID {
+			status.add("eventbridge_rule", ruleName, cfg.Region, ComponentHealthy, "")
+			return
+		}
+	}
+	status.add("eventbridge_rule", ruleName, cfg.Region, ComponentDegraded, "rule no longer targets the CloudLoom "+targetName)
+}
+
+// requiredBucketStatements are the bucket policy statements CloudTrail needs to deliver logs
+var requiredBucketStatements = []string{"AWSCloudTrailAclCheck20150319", "AWSCloudTrailWrite20150319"}
+
+// existingBucketRequiredStatements are those setup adds to a customer's existing bucket
+var existingBucketRequiredStatements = []string{existingBucketStatementPrefix + "CloudTrailAclCheck", existingBucketStatementPrefix + "CloudTrailWrite"}
+
+func checkBucketPolicy(ctx context.Context, status *SetupStatus, cfg aws.Config, bucketName string, required []string) {
+	out, err := s3.NewFromConfig(cfg).GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		// A bucket without a policy reports NoSuchBucketPolicy
+		if strings.Contains(err.Error(), "NoSuchBucketPolicy") {
+			status.add("s3_bucket_policy", bucketName, cfg.Region, ComponentMissing, "bucket has no policy")
+			return
+		}
+		status.addErr("s3_bucket_policy", bucketName, cfg.Region, err)
+		return
+	}
+
+	var policy struct {
+		Statement []struct {
+			Sid string `json:"Sid"`
+		} `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(out.Policy)), &policy); err != nil {
+		status.add("s3_bucket_policy", bucketName, cfg.Region, ComponentDegraded, "policy cannot be parsed")
+		return
+	}
+	present := map[string]bool{}
+	for _, statement := range policy.Statement {
+		present[statement.Sid] = true
+	}
+	var missing []string
+	for _, sid := range required {
+		if !present[sid] {
+			missing = append(missing, sid)
+		}
+	}
+	if len(missing) > 0 {
+		status.add("s3_bucket_policy", bucketName, cfg.Region, ComponentDegraded, "missing statements "+strings.Join(missing, ", "))
+		return
+	}
+	status.add("s3_bucket_policy", bucketName, cfg.Region, ComponentHealthy, "")
+}
+
+// checkReplication checks the log bucket still replicates to the replica bucket and how the
+// replication role is doing
+func checkReplication(ctx context.Context, status *SetupStatus, cfg aws.Config, bucketName, replicaName string) {
+	out, err := s3.NewFromConfig(cfg).GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		if strings.Contains(err.Error(), "ReplicationConfigurationNotFoundError") {
+			status.add("s3_replication", replicaName, cfg.Region, ComponentMissing, "bucket is not replicated")
+			return
+		}
+		status.addErr("s3_replication", replicaName, cfg.Region, err)
+		return
+	}
+	for _, rule := range out.ReplicationConfiguration.Rules {
+		if aws.ToString(rule.ID) != logReplicationRuleID {
+			continue
+		}
+		if rule.Status != s3types.ReplicationRuleStatusEnabled {
+			status.add("s3_replication", replicaName, cfg.Region, ComponentDegraded, "replication rule is "+string(rule.Status))
+			return
+		}
+		status.add("s3_replication", replicaName, cfg.Region, ComponentHealthy, "")
+		return
+	}
+	status.add("s3_replication", replicaName, cfg.Region, ComponentMissing, "replication rule was removed")
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	taggingtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+)
+
+// Tags put on every resource setup creates. cloudloom:setup-id names the setup run that last
+// created or updated the resource.
+const (
+	TagManaged = "cloudloom:managed"
+	TagSetupID = "cloudloom:setup-id"
+)
+
+// managedResources are the resources an earlier setup created, found by their
+// cloudloom:managed tag rather than by name
+type managedResources struct {
+	bucket   string
+	logGroup string
+	trail    string
+	queue    string
+	topic    string
+	// rules maps each region to the name of the EventBridge rule in it
+	rules map[string]string
+}
+
+// discoverManagedResources looks up resources tagged cloudloom:managed in the home region and
+// the monitored regions, so setup updates them instead of creating duplicates when the naming
+// convention has changed. Discovery is best effort: on error, setup falls back to names.
+func (s *CloudTrailService) discoverManagedResources(ctx context.Context, cfg aws.Config, regions []string) *managedResources {
+	found := &managedResources{rules: map[string]string{}}
+	searched := map[string]bool{}
+	for _, region := range append([]string{cfg.Region}, regions...) {
+		if searched[region] {
+			continue
+		}
+		searched[region] = true
+
+		client := resourcegroupstaggingapi.NewFromConfig(inRegion(cfg, region))
+		paginator := resourcegroupstaggingapi.NewGetResourcesPaginator(client, &resourcegroupstaggingapi.GetResourcesInput{
+			TagFilters: []taggingtypes.TagFilter{{Key: aws.String(TagManaged), Values: []string{"true"}}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				log.Printf("[Discovery] Warning: failed to list tagged resources in %s: %v", region, err)
+				break
+			}
+			for _, mapping := range page.ResourceTagMappingList {
+				found.add(region, cfg.Region, aws.ToString(mapping.ResourceARN))
+			}
+		}
+	}
+	return found
+}
+
+// add records a tagged resource by its ARN. Only the first resource of each kind is kept, and
+// only resources in the home region except for EventBridge rules.
+func (m *managedResources) add(region, homeRegion, arn string) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return
+	}
+	service, resource := parts[2], parts[5]
+
+	keep := func(field *string, name string) {
+		if *field == "" && region == homeRegion && name != "" {
+			*field = name
+			log.Printf("[Discovery] Found existing %s %s", service, name)
+		}
+	}
+	switch service {
+	case "s3":
+		keep(&m.bucket, resource)
+	case "logs":
+		keep(&m.logGroup, strings.TrimSuffix(strings.TrimPrefix(resource, "log-group:"), ":*"))
+	case "cloudtrail":
+		keep(&m.trail, strings.TrimPrefix(resource, "trail/"))
+	case "sqs":
+		keep(&m.queue, resource)
+	case "sns":
+		keep(&m.topic, resource)
+	case "events":
+		// Rules on custom event buses are named rule/<bus>/<name> and are not setup's
+		name := strings.TrimPrefix(resource, "rule/")
+		if _, ok := m.rules[region]; !ok && !strings.Contains(name, "/") {
+			m.rules[region] = name
+			log.Printf("[Discovery] Found existing EventBridge rule %s in %s", name, region)
+		}
+	}
+}
+
+// setupNames are the names of the resources setup creates in an account
+type setupNames struct {
+	bucket   string
+	logGroup string
+	trail    string
+	queue    string
+	topic    string
+	// regions are the monitored regions, and rules maps each to the name of its EventBridge rule
+	regions []string
+	rules   map[string]string
+	// allRegions is set when regions were discovered from the account's enabled regions
+	allRegions bool
+	// kmsKey is the tenant's KMS key ARN or the alias of the key setup creates, empty when
+	// logs use S3-managed encryption
+	kmsKey string
+	// replicationRegion is where the log bucket is replicated to, empty when it is not
+	replicationRegion string
+	// existingBucket and existingTrail are set when bucket and trail are the customer's own,
+	// which setup only adds to and teardown leaves in place. trail is then the trail's ARN.
+	existingBucket bool
+	existingTrail  bool
+}
+
+// resourceNames returns the names of the account's CloudLoom resources: those of resources an
+// earlier setup tagged, or else the conventional names derived from the account ID
+func (s *CloudTrailService) resourceNames(ctx context.Context, cfg aws.Config, accountID string, regions []string) setupNames {
+	existing := s.discoverManagedResources(ctx, cfg, regions)
+	// S3 bucket names must be DNS-compliant: lowercase, no underscores, 3-63 characters
+	names := setupNames{
+		bucket:            discoveredOr(existing.bucket, fmt.Sprintf("cloudloom-logs-%s", accountID)),
+		logGroup:          discoveredOr(existing.logGroup, fmt.Sprintf("/aws/cloudtrail/cloudloom-agent-%s", accountID)),
+		trail:             discoveredOr(existing.trail, fmt.Sprintf("CloudLoom-Agent-Trail-%s", accountID)),
+		queue:             s.queueName(existing.queue, accountID),
+		topic:             discoveredOr(existing.topic, fmt.Sprintf("CloudLoom-Notifications-%s", accountID)),
+		regions:           regions,
+		rules:             map[string]string{},
+		kmsKey:            s.logKey(accountID),
+		replicationRegion: s.replicationRegion(),
+		allRegions:        s.allRegions(),
+	}
+	if bucket := s.existingBucketName(); bucket != "" {
+		names.bucket, names.existingBucket = bucket, true
+	}
+	if trail := s.existingTrailArn(); trail != "" {
+		names.trail, names.existingTrail = trail, true
+	}
+	for _, region := range regions {
+		names.rules[region] = discoveredOr(existing.rules[region], fmt.Sprintf("CloudLoom-AutoApplyFix-Rule-%s", accountID))
+	}
+	return names
+}
+
+// queueName returns the name of the discovered queue, or else the conventional name of a queue
+// of the tenant's type. A discovered queue of the other type is ignored, so switching queue
+// types creates a new queue; the old one is left in the account.
+func (s *CloudTrailService) queueName(discovered, accountID string) string {
+	if discovered != "" && isFIFOQueue(discovered) == s.fifoQueue() {
+		return discovered
+	}
+	name := fmt.Sprintf("cloudloom-autoapplyfix-%s", accountID)
+	if s.fifoQueue() {
+		name += fifoQueueSuffix
+	}
+	return name
+}
+
+// discoveredOr returns the discovered name, or name when nothing was discovered
+func discoveredOr(discovered, name string) string {
+	if discovered != "" {
+		return discovered
+	}
+	return name
+}
+
+// managedTags are the tags setup puts on the resources it creates
+func (s *CloudTrailService) managedTags() map[string]string {
+	return map[string]string{TagManaged: "true", TagSetupID: s.setupID}
+}
+
+// tagManaged tags regional resources with the CloudLoom tags. Tagging is best effort, since
+// setup still finds its resources by name when the tags are missing.
+func (s *CloudTrailService) tagManaged(ctx context.Context, cfg aws.Config, arns ...string) {
+	client := resourcegroupstaggingapi.NewFromConfig(cfg)
+	out, err := client.TagResources(ctx, &resourcegroupstaggingapi.TagResourcesInput{
+		ResourceARNList: arns,
+		Tags:            s.managedTags(),
+	})
+	if err != nil {
+		log.Printf("[Tagging] Warning: failed to tag %v: %v", arns, err)
+		return
+	}
+	for arn, failure := range out.FailedResourcesMap {
+		log.Printf("[Tagging] Warning: failed to tag %s: %s", arn, aws.ToString(failure.ErrorMessage))
+	}
+}
+
+// tagRole tags an IAM role with the CloudLoom tags; IAM is not covered by the tagging API
+func (s *CloudTrailService) tagRole(ctx context.Context, client *iam.Client, roleName string) {
+	var tags []iamtypes.Tag
+	for key, value := range s.managedTags() {
+		tags = append(tags, iamtypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := client.TagRole(ctx, &iam.TagRoleInput{RoleName: aws.String(roleName), Tags: tags}); err != nil {
+		log.Printf("[Tagging] Warning: failed to tag role %s: %v", roleName, err)
+	}
+}
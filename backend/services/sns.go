@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// notificationTargetID is the ID of the SNS target on each EventBridge rule
+const notificationTargetID = "CloudLoom-SNS-Target"
+
+// notificationTopicPolicy lets EventBridge rules of the account publish to the topic
+func notificationTopicPolicy(topicArn, accountID string) string {
+	return fmt.Sprintf(`{
+        "Version": "2012-10-17",
+        "Statement": [{
+            "Sid": "CloudLoomEventBridgePublish",
+            "Effect": "Allow",
+            "Principal": {"Service": "events.amazonaws.com"},
+            "Action": "sns:Publish",
+            "Resource": "%s",
+            "Condition": {"StringEquals": {"aws:SourceAccount": "%s"}}
+        }]
+    }`, topicArn, accountID)
+}
+
+// createNotificationTopic creates the SNS topic the EventBridge rules publish the account's API
+// calls to, or reuses it if it exists, and returns its ARN. The customer subscribes to it.
+func (s *CloudTrailService) createNotificationTopic(ctx context.Context, cfg aws.Config, topicName, accountID string) (string, error) {
+	client := sns.NewFromConfig(cfg)
+
+	// CreateTopic returns the existing topic when one has the name
+	fmt.Printf("[SNS] Creating/checking topic '%s'...\n", topicName)
+	created, err := client.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String(topicName)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create SNS topic: %w", err)
+	}
+	topicArn := aws.ToString(created.TopicArn)
+
+	_, err = client.SetTopicAttributes(ctx, &sns.SetTopicAttributesInput{
+		TopicArn:       aws.String(topicArn),
+		AttributeName:  aws.String("Policy"),
+		AttributeValue: aws.String(notificationTopicPolicy(topicArn, accountID)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to set SNS topic policy: %w", err)
+	}
+	fmt.Printf("[SNS] ✅ Topic ready: %s\n", topicArn)
+	return topicArn, nil
+}
+
+var (
+	// ErrInvalidEndpoint is returned for a notification endpoint that is neither an email
+	// address nor an HTTPS URL
+	ErrInvalidEndpoint = errors.New("notification endpoint must be an email address or an HTTPS URL")
+	// ErrSubscriptionNotFound is returned for a subscription that is not to the tenant's topic
+	ErrSubscriptionNotFound = errors.New("notification subscription not found")
+)
+
+// NotificationSubscription is one endpoint subscribed to a tenant's notification topic
+type NotificationSubscription struct {
+	// SubscriptionArn is not an ARN until the endpoint confirms the subscription
+	SubscriptionArn string `json:"subscriptionArn"`
+	Protocol        string `json:"protocol"`
+	Endpoint        string `json:"endpoint"`
+	Pending         bool   `json:"pending"`
+}
+
+// endpointProtocol returns the SNS protocol an endpoint is subscribed with
+func endpointProtocol(endpoint string) (string, error) {
+	if strings.HasPrefix(endpoint, "https://") {
+		return "https", nil
+	}
+	if addr, err := mail.ParseAddress(endpoint); err == nil && addr.Address == endpoint {
+		return "email", nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidEndpoint, endpoint)
+}
+
+// ValidateNotificationEndpoints checks every endpoint can be subscribed to a topic
+func ValidateNotificationEndpoints(endpoints []string) error {
+	for _, endpoint := range endpoints {
+		if _, err := endpointProtocol(endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeEndpoints subscribes each endpoint to the topic. SNS returns the existing
+// subscription for an endpoint that is already subscribed, so this is safe to repeat.
+// Email and HTTPS endpoints stay pending until the recipient confirms.
+func subscribeEndpoints(ctx context.Context, client *sns.Client, topicArn string, endpoints []string) ([]NotificationSubscription, error) {
+	subscriptions := make([]NotificationSubscription, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		protocol, err := endpointProtocol(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn: aws.String(topicArn),
+			Protocol: aws.String(protocol),
+			Endpoint: aws.String(endpoint),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe %s: %w", endpoint, err)
+		}
+		subscriptions = append(subscriptions, newSubscription(aws.ToString(out.SubscriptionArn), protocol, endpoint))
+		log.Printf("[SNS] ✅ Subscribed %s to %s", endpoint, topicArn)
+	}
+	return subscriptions, nil
+}
+
+func newSubscription(arn, protocol, endpoint string) NotificationSubscription {
+	// A subscription awaiting confirmation has "pending confirmation" instead of an ARN
+	pending := !strings.HasPrefix(arn, "arn:")
+	return NotificationSubscription{SubscriptionArn: arn, Protocol: protocol, Endpoint: endpoint, Pending: pending}
+}
+
+// notificationTopic assumes the tenant's role and returns an SNS client for the home region
+// and the ARN of the tenant's notification topic
+func notificationTopic(ctx context.Context, tenantID string) (*sns.Client, string, error) {
+	s, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := s.assumeRole(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	names := s.resourceNames(ctx, cfg, accountID, s.monitoredRegions())
+	return sns.NewFromConfig(cfg), fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic), nil
+}
+
+// ListNotificationSubscriptions returns the endpoints subscribed to the tenant's topic
+func ListNotificationSubscriptions(ctx context.Context, tenantID string) ([]NotificationSubscription, error) {
+	client, topicArn, err := notificationTopic(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return listSubscriptions(ctx, client, topicArn)
+}
+
+func listSubscriptions(ctx context.Context, client *sns.Client, topicArn string) ([]NotificationSubscription, error) {
+	subscriptions := []NotificationSubscription{}
+	paginator := sns.NewListSubscriptionsByTopicPaginator(client, &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicArn)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subscriptions of %s: %w", topicArn, err)
+		}
+		for _, sub := range page.Subscriptions {
+			// EventBridge publishing to the topic is a policy, not a subscription, so only
+			// customer endpoints are listed
+			subscriptions = append(subscriptions, newSubscription(aws.ToString(sub.SubscriptionArn), aws.ToString(sub.Protocol), aws.ToString(sub.Endpoint)))
+		}
+	}
+	return subscriptions, nil
+}
+
+// SubscribeNotificationEndpoint subscribes an email address or HTTPS URL to the tenant's
+// topic and keeps it among the endpoints later setups subscribe
+func SubscribeNotificationEndpoint(ctx context.Context, tenantID, endpoint string) (*NotificationSubscription, error) {
+	if _, err := endpointProtocol(endpoint); err != nil {
+		return nil, err
+	}
+	client, topicArn, err := notificationTopic(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := subscribeEndpoints(ctx, client, topicArn, []string{endpoint})
+	if err != nil {
+		return nil, err
+	}
+	updateNotificationEndpoints(ctx, tenantID, func(endpoints []string) []string {
+		for _, existing := range endpoints {
+			if existing == endpoint {
+				return endpoints
+			}
+		}
+		return append(endpoints, endpoint)
+	})
+	return &subscriptions[0], nil
+}
+
+// UnsubscribeNotificationEndpoint removes a subscription from the tenant's topic. Only
+// confirmed subscriptions have an ARN and can be removed; pending ones expire after 3 days.
+func UnsubscribeNotificationEndpoint(ctx context.Context, tenantID, subscriptionArn string) error {
+	client, topicArn, err := notificationTopic(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := listSubscriptions(ctx, client, topicArn)
+	if err != nil {
+		return err
+	}
+
+	var found *NotificationSubscription
+	for i := range subscriptions {
+		if subscriptions[i].SubscriptionArn == subscriptionArn {
+			found = &subscriptions[i]
+		}
+	}
+	if found == nil || found.Pending {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, subscriptionArn)
+	}
+
+	if _, err := client.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(subscriptionArn)}); err != nil {
+		return fmt.Errorf("failed to unsubscribe %s: %w", found.Endpoint, err)
+	}
+	updateNotificationEndpoints(ctx, tenantID, func(endpoints []string) []string {
+		kept := []string{}
+		for _, existing := range endpoints {
+			if existing != found.Endpoint {
+				kept = append(kept, existing)
+			}
+		}
+		return kept
+	})
+	log.Printf("[SNS] ✅ Unsubscribed %s from %s", found.Endpoint, topicArn)
+	return nil
+}
+
+// updateNotificationEndpoints changes the tenant's recorded endpoints. The subscription has
+// already changed in SNS, so failing to record it is only logged.
+func updateNotificationEndpoints(ctx context.Context, tenantID string, update func([]string) []string) {
+	manager := tenants.Default()
+	if manager == nil {
+		return
+	}
+	tenant, err := manager.Get(ctx, tenantID)
+	if err == nil {
+		err = manager.SetNotificationEndpoints(ctx, tenantID, update(tenant.NotificationEndpoints))
+	}
+	if err != nil {
+		log.Printf("[SNS] Warning: failed to record notification endpoints of %s: %v", tenantID, err)
+	}
+}
+
+// PublishNotification sends a message to every endpoint subscribed to the tenant's topic, for
+// findings and remediation reports. While the topic cannot be reached the message waits in the
+// delivery buffer.
+func PublishNotification(ctx context.Context, tenantID, subject, message string) error {
+	// Email subjects are limited to 100 characters
+	if len(subject) > 100 {
+		subject = subject[:97] + "..."
+	}
+	buf := buffer.Default()
+	if buf == nil {
+		return publishNotification(ctx, tenantID, subject, message)
+	}
+	payload, err := json.Marshal(bufferedNotification{Subject: subject, Message: message})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	buffered, err := buf.Deliver(ctx, NotificationDeliverySink, tenantID, tenantID, payload)
+	if buffered {
+		log.Printf("[SNS] ⏳ Topic of %s unavailable, notification buffered until it recovers", tenantID)
+	}
+	return err
+}
+
+// publishNotification publishes a message to the tenant's topic
+func publishNotification(ctx context.Context, tenantID, subject, message string) error {
+	client, topicArn, err := notificationTopic(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(topicArn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topicArn, err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+)
+
+const (
+	// defaultMessageConcurrency is how many messages of a received batch a poller processes at
+	// once. Override with SQS_MESSAGE_CONCURRENCY.
+	defaultMessageConcurrency = 4
+	// messageVisibilityTimeout is how long a received message is hidden from other receivers.
+	// It is extended every visibilityExtendInterval while the message is processed, so a long
+	// remediation does not have the message received and handled a second time.
+	messageVisibilityTimeout = 60 * time.Second
+	visibilityExtendInterval = 20 * time.Second
+	// maxDeleteBatch is the most entries SQS accepts in one DeleteMessageBatch call
+	maxDeleteBatch = 10
+)
+
+func messageConcurrencyFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("SQS_MESSAGE_CONCURRENCY")); err == nil && v > 0 {
+		return v
+	}
+	return defaultMessageConcurrency
+}
+
+// processBatch processes a received batch on a bounded worker pool, then deletes the messages
+// that were handled, or skipped as redeliveries, with batched deletes. Messages whose
+// processing failed are left to be received again; after maxReceiveCount failures SQS moves
+// them to the dead-letter queue. The messages of a FIFO queue's group are processed one after
+// another, and a failure leaves the rest of the group to be received again after it, so none
+// is handled out of order.
+func (s *CloudTrailService) processBatch(ctx context.Context, sqsClient *sqs.Client, cfg aws.Config, queueURL, accountID string, messages []types.Message) {
+	handled := make([]bool, len(messages))
+	groups := messageGroups(messages, isFIFOQueue(queueURL))
+	newWorkerPool(messageConcurrencyFromEnv()).run(ctx, len(groups), func(ctx context.Context, g int) error {
+		// Messages waiting behind others of their group stay hidden too
+		for _, i := range groups[g] {
+			if handled[i] {
+				continue
+			}
+			stopExtending := keepInvisible(ctx, sqsClient, queueURL, messages[i])
+			defer stopExtending()
+		}
+		for _, i := range groups[g] {
+			if handled[i] {
+				// Processed before the group was retried after throttling
+				continue
+			}
+			if err := s.processReceived(ctx, cfg, accountID, messages[i]); err != nil {
+				return err
+			}
+			handled[i] = true
+		}
+		return nil
+	})
+
+	var done []types.Message
+	for i, message := range messages {
+		if handled[i] {
+			done = append(done, message)
+		}
+	}
+	deleteMessages(ctx, sqsClient, queueURL, done)
+}
+
+// processReceived processes a message unless its message or its event was already processed
+func (s *CloudTrailService) processReceived(ctx context.Context, cfg aws.Config, accountID string, message types.Message) error {
+	if isDuplicateMessage(ctx, message.MessageId) {
+		log.Printf("[SQS Polling] Skipping redelivered message %s", aws.ToString(message.MessageId))
+		return nil
+	}
+	eventKey, duplicate := claimEvent(ctx, accountID, message.Body)
+	if duplicate {
+		log.Printf("[SQS Polling] Skipping message %s, its event %s was already processed", aws.ToString(message.MessageId), aws.ToString(eventKey))
+		return nil
+	}
+
+	if err := s.processMessage(ctx, cfg, accountID, message.Body); err != nil {
+		log.Printf("[SQS Polling] Warning: failed to process message %s of tenant %s, leaving it for retry: %v", aws.ToString(message.MessageId), accountID, err)
+		clearProcessed(ctx, message.MessageId)
+		clearProcessed(ctx, eventKey)
+		return err
+	}
+	return nil
+}
+
+// claimEvent marks the message's EventBridge event processed and reports whether it already
+// was. EventBridge delivers at least once, and a standard queue may hold one event in several
+// messages with their own IDs, which only the event ID tells apart. The key of the mark is
+// returned so a failed message can clear it; it is nil for a body that is not an event.
+func claimEvent(ctx context.Context, accountID string, body *string) (*string, bool) {
+	if body == nil {
+		return nil, false
+	}
+	envelope, err := eventpipeline.Parse(*body)
+	if err != nil || envelope.ID == "" {
+		return nil, false
+	}
+	key := events.EventKey(accountID, envelope.ID)
+	return &key, isDuplicateMessage(ctx, &key)
+}
+
+// isDuplicateMessage reports whether an SQS message was already processed, so redeliveries are
+// deleted without being handled twice
+func isDuplicateMessage(ctx context.Context, messageID *string) bool {
+	store := events.Default()
+	if store == nil || messageID == nil {
+		return false
+	}
+	first, err := store.MarkProcessed(ctx, *messageID)
+	if err != nil {
+		log.Printf("[SQS Polling] Warning: %v", err)
+		return false
+	}
+	return !first
+}
+
+// clearProcessed forgets a message whose processing failed, so its redelivery is handled again
+func clearProcessed(ctx context.Context, messageID *string) {
+	store := events.Default()
+	if store == nil || messageID == nil {
+		return
+	}
+	if err := store.ClearProcessed(ctx, *messageID); err != nil {
+		log.Printf("[SQS Polling] Warning: %v", err)
+	}
+}
+
+// messageGroups splits a batch into the indexes of each FIFO message group, in the order
+// received. Messages of a standard queue are each their own group.
+func messageGroups(messages []types.Message, fifo bool) [][]int {
+	groups := [][]int{}
+	index := map[string]int{}
+	for i, message := range messages {
+		group, ok := message.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+		if !fifo || !ok {
+			groups = append(groups, []int{i})
+			continue
+		}
+		if g, seen := index[group]; seen {
+			groups[g] = append(groups[g], i)
+			continue
+		}
+		index[group] = len(groups)
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+// messageGroup returns the FIFO message group of a body sent to the queue by CloudLoom: the
+// event's region, as the EventBridge rules use, or defaultMessageGroup
+func messageGroup(body string) string {
+	if envelope, err := eventpipeline.Parse(body); err == nil && envelope.Region != "" {
+		return envelope.Region
+	}
+	return defaultMessageGroup
+}
+
+// keepInvisible extends the message's visibility timeout until the returned function is called
+func keepInvisible(ctx context.Context, sqsClient *sqs.Client, queueURL string, message types.Message) func() {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(visibilityExtendInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(queueURL),
+					ReceiptHandle:     message.ReceiptHandle,
+					VisibilityTimeout: int32(messageVisibilityTimeout.Seconds()),
+				})
+				if err != nil {
+					log.Printf("[SQS Polling] Warning: failed to extend visibility of message %s: %v", aws.ToString(message.MessageId), err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// deleteMessages deletes the messages from the queue, up to maxDeleteBatch per call. Messages
+// that fail to delete are received again and skipped as redeliveries.
+func deleteMessages(ctx context.Context, sqsClient *sqs.Client, queueURL string, messages []types.Message) {
+	for start := 0; start < len(messages); start += maxDeleteBatch {
+		batch := messages[start:min(start+maxDeleteBatch, len(messages))]
+		entries := make([]types.DeleteMessageBatchRequestEntry, len(batch))
+		for i, message := range batch {
+			entries[i] = types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: message.ReceiptHandle,
+			}
+		}
+		result, err := sqsClient.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			log.Printf("[SQS Polling] Error deleting %d messages: %v", len(batch), err)
+			continue
+		}
+		for _, failed := range result.Failed {
+			messageID := aws.ToString(failed.Id)
+			if i, err := strconv.Atoi(messageID); err == nil && i < len(batch) {
+				messageID = aws.ToString(batch[i].MessageId)
+			}
+			log.Printf("[SQS Polling] Error deleting message %s: %s", messageID, aws.ToString(failed.Message))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func TestMessageGroups(t *testing.T) {
+	message := func(group string) types.Message {
+		if group == "" {
+			return types.Message{}
+		}
+		return types.Message{Attributes: map[string]string{string(types.MessageSystemAttributeNameMessageGroupId): group}}
+	}
+	tests := []struct {
+		name     string
+		messages []types.Message
+		fifo     bool
+		want     [][]int
+	}{
+		{name: "empty batch", fifo: true, want: [][]int{}},
+		{
+			name:     "standard queue",
+			messages: []types.Message{message("eu-west-1"), message("eu-west-1"), message("")},
+			want:     [][]int{{0}, {1}, {2}},
+		},
+		{
+			name:     "one group keeps its order",
+			messages: []types.Message{message("eu-west-1"), message("eu-west-1"), message("eu-west-1")},
+			fifo:     true,
+			want:     [][]int{{0, 1, 2}},
+		},
+		{
+			name:     "interleaved groups",
+			messages: []types.Message{message("eu-west-1"), message("us-east-1"), message("eu-west-1"), message("cloudloom"), message("us-east-1")},
+			fifo:     true,
+			want:     [][]int{{0, 2}, {1, 4}, {3}},
+		},
+		{
+			name:     "message without a group",
+			messages: []types.Message{message("eu-west-1"), message(""), message("eu-west-1")},
+			fifo:     true,
+			want:     [][]int{{0, 2}, {1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageGroups(tt.messages, tt.fifo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messageGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageGroup(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"event", `{"id":"e1","source":"aws.s3","detail-type":"AWS API Call via CloudTrail","region":"eu-west-1"}`, "eu-west-1"},
+		{"event without region", `{"id":"e1","source":"aws.s3","detail-type":"AWS API Call via CloudTrail"}`, defaultMessageGroup},
+		{"not an event", `{"message":"test"}`, defaultMessageGroup},
+		{"not JSON", "hello", defaultMessageGroup},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageGroup(tt.body); got != tt.want {
+				t.Errorf("messageGroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,20 +6,71 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/eventpipeline"
+	"github.com/rishichirchi/cloudloom/services/events"
+	"github.com/rishichirchi/cloudloom/services/queuemonitor"
 )
 
 type QueueInfo struct {
-	AccountID string
-	QueueURL  string
-	QueueArn  string
-	RuleArn   string
-	CreatedAt time.Time
+	AccountID          string
+	QueueURL           string
+	QueueArn           string
+	DeadLetterQueueURL string
+	DeadLetterQueueArn string
+	RuleArn            string
+	CreatedAt          time.Time
+}
+
+const (
+	// deadLetterQueueSuffix names a queue's dead-letter queue after it
+	deadLetterQueueSuffix = "-dlq"
+	// fifoQueueSuffix ends the name of every FIFO queue
+	fifoQueueSuffix = ".fifo"
+	// defaultMessageGroup is the FIFO message group of messages that are not regional events
+	defaultMessageGroup = "cloudloom"
+	// maxReceiveCount is how many times a message is received, and fails, before SQS moves it
+	// to the dead-letter queue
+	maxReceiveCount = 5
+	// deadLetterRetention keeps dead letters for the SQS maximum of 14 days
+	deadLetterRetention = 14 * 24 * time.Hour
+)
+
+// deadLetterQueueURL returns the URL of the dead-letter queue paired with a queue
+func deadLetterQueueURL(queueURL string) string {
+	return deadLetterQueueName(queueURL)
+}
+
+// deadLetterQueueName returns the name, URL or ARN of the dead-letter queue paired with the
+// queue of the given name, URL or ARN. The dead-letter queue of a FIFO queue is a FIFO queue.
+func deadLetterQueueName(queue string) string {
+	if isFIFOQueue(queue) {
+		return strings.TrimSuffix(queue, fifoQueueSuffix) + deadLetterQueueSuffix + fifoQueueSuffix
+	}
+	return queue + deadLetterQueueSuffix
+}
+
+// isFIFOQueue reports whether the queue of the given name, URL or ARN is a FIFO queue
+func isFIFOQueue(queue string) bool {
+	return strings.HasSuffix(queue, fifoQueueSuffix)
+}
+
+// queueAttributes are the attributes a queue is created with. A FIFO queue deduplicates
+// messages by their content, since EventBridge sends no deduplication ID.
+func queueAttributes(queueName string) map[string]string {
+	attributes := map[string]string{}
+	if isFIFOQueue(queueName) {
+		attributes[string(types.QueueAttributeNameFifoQueue)] = "true"
+		attributes[string(types.QueueAttributeNameContentBasedDeduplication)] = "true"
+	}
+	return attributes
 }
 
 func (s *CloudTrailService) createSQSQueue(ctx context.Context, cfg aws.Config, queueName, accountID string) (*QueueInfo, error) {
@@ -41,7 +92,8 @@ func (s *CloudTrailService) createSQSQueue(ctx context.Context, cfg aws.Config,
 		// Queue doesn't exist, create it
 		fmt.Printf("[SQS] Creating new SQS queue...\n")
 		createQueueInput := &sqs.CreateQueueInput{
-			QueueName: aws.String(queueName),
+			QueueName:  aws.String(queueName),
+			Attributes: queueAttributes(queueName),
 		}
 		result, err := sqsClient.CreateQueue(ctx, createQueueInput)
 		if err != nil {
@@ -65,16 +117,63 @@ func (s *CloudTrailService) createSQSQueue(ctx context.Context, cfg aws.Config,
 	}
 	queueArn := attributes.Attributes["QueueArn"]
 
+	// Messages the handlers keep failing on are moved aside instead of being retried forever
+	deadLetterURL, deadLetterArn, err := s.createDeadLetterQueue(ctx, sqsClient, deadLetterQueueName(queueName))
+	if err != nil {
+		return nil, err
+	}
+	redrivePolicy, err := json.Marshal(map[string]string{
+		"deadLetterTargetArn": deadLetterArn,
+		"maxReceiveCount":     fmt.Sprint(maxReceiveCount),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal redrive policy: %w", err)
+	}
+	// Set on existing queues too, so queues created before dead-lettering get it
+	_, err = sqsClient.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(queueUrl),
+		Attributes: map[string]string{string(types.QueueAttributeNameRedrivePolicy): string(redrivePolicy)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set queue redrive policy: %w", err)
+	}
+	fmt.Printf("[SQS] ✅ Messages failing %d times move to '%s'\n", maxReceiveCount, deadLetterQueueName(queueName))
+
 	queueInfo := &QueueInfo{
-		AccountID: accountID,
-		QueueURL:  queueUrl,
-		QueueArn:  queueArn,
-		CreatedAt: time.Now(),
+		AccountID:          accountID,
+		QueueURL:           queueUrl,
+		QueueArn:           queueArn,
+		DeadLetterQueueURL: deadLetterURL,
+		DeadLetterQueueArn: deadLetterArn,
+		CreatedAt:          time.Now(),
 	}
 
 	return queueInfo, nil
 }
 
+// createDeadLetterQueue creates the dead-letter queue of the auto-fix queue, or returns the
+// existing one, with its URL and ARN
+func (s *CloudTrailService) createDeadLetterQueue(ctx context.Context, sqsClient *sqs.Client, name string) (string, string, error) {
+	// CreateQueue returns the existing queue when its attributes match
+	attributes := queueAttributes(name)
+	attributes[string(types.QueueAttributeNameMessageRetentionPeriod)] = fmt.Sprint(int(deadLetterRetention.Seconds()))
+	result, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create dead-letter queue: %w", err)
+	}
+	described, err := sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       result.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get dead-letter queue attributes: %w", err)
+	}
+	return aws.ToString(result.QueueUrl), described.Attributes["QueueArn"], nil
+}
+
 func (s *CloudTrailService) setSQSQueuePolicy(ctx context.Context, cfg aws.Config, queueURL, queueArn string, ruleArns []string) error {
 	sqsClient := sqs.NewFromConfig(cfg)
 	fmt.Printf("[SQS] Setting queue policy to allow access from %d rules...\n", len(ruleArns))
@@ -137,7 +236,7 @@ func (s *CloudTrailService) setSQSQueuePolicy(ctx context.Context, cfg aws.Confi
 	return nil
 }
 
-func (s *CloudTrailService) startSQSPolling(ctx context.Context, cfg aws.Config, queueURL string) {
+func (s *CloudTrailService) startSQSPolling(ctx context.Context, cfg aws.Config, queueURL, accountID string) {
 	sqsClient := sqs.NewFromConfig(cfg)
 	fmt.Printf("[SQS Polling] Starting continuous polling for queue: %s\n", queueURL)
 
@@ -154,9 +253,6 @@ func (s *CloudTrailService) startSQSPolling(ctx context.Context, cfg aws.Config,
 		log.Printf("[SQS Polling] Error checking for existing messages: %v", err)
 	} else if len(initialResult.Messages) > 0 {
 		fmt.Printf("[SQS Polling] Found %d existing messages in queue\n", len(initialResult.Messages))
-		for i, message := range initialResult.Messages {
-			fmt.Printf("[SQS Polling][Existing Message %d] %s\n", i+1, aws.ToString(message.Body))
-		}
 	} else {
 		fmt.Printf("[SQS Polling] No existing messages found in queue\n")
 	}
@@ -185,43 +281,66 @@ func (s *CloudTrailService) startSQSPolling(ctx context.Context, cfg aws.Config,
 				QueueUrl:            aws.String(queueURL),
 				MaxNumberOfMessages: 10,
 				WaitTimeSeconds:     5, // Shorter polling interval
+				VisibilityTimeout:   int32(messageVisibilityTimeout.Seconds()),
+				// SentTimestamp lets the queue monitor compute processing lag, and the group
+				// of FIFO messages keeps each group in order
+				MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+					types.MessageSystemAttributeNameSentTimestamp,
+					types.MessageSystemAttributeNameMessageGroupId,
+				},
 			}
 
 			result, err := sqsClient.ReceiveMessage(ctx, receiveMessageInput)
+			if ctx.Err() != nil {
+				fmt.Println("[SQS Polling] Context cancelled, stopping polling")
+				return
+			}
 			if err != nil {
 				log.Printf("[SQS Polling] Error receiving messages: %v", err)
-				time.Sleep(5 * time.Second) // Wait before retrying
+				// Wait before retrying, but stop promptly if polling is cancelled
+				if awsconfig.SleepContext(ctx, 5*time.Second) != nil {
+					fmt.Println("[SQS Polling] Context cancelled, stopping polling")
+					return
+				}
 				continue
 			}
 
 			if len(result.Messages) > 0 {
 				fmt.Printf("[SQS Polling] 🎉 Received %d new messages!\n", len(result.Messages))
-				for i, message := range result.Messages {
-					fmt.Printf("[SQS Polling][New Message %d] %s\n", i+1, aws.ToString(message.Body))
-					s.processSecurityFinding(ctx, message.Body)
-
-					// Delete the message after successful processing
-					deleteMessageInput := &sqs.DeleteMessageInput{
-						QueueUrl:      aws.String(queueURL),
-						ReceiptHandle: message.ReceiptHandle,
-					}
-					_, err := sqsClient.DeleteMessage(ctx, deleteMessageInput)
-					if err != nil {
-						log.Printf("[SQS Polling] Error deleting message: %v", err)
-					}
-				}
+				recordBatchLag(accountID, queueURL, result.Messages)
+				// A received batch is finished even if polling is stopped meanwhile, so stopping
+				// drains in-flight messages instead of leaving them to time out
+				s.processBatch(context.WithoutCancel(ctx), sqsClient, cfg, queueURL, accountID, result.Messages)
 			}
 		}
 	}
 }
 
-func (s *CloudTrailService) processSecurityFinding(ctx context.Context, messageBody *string) {
+// processMessage keeps a received message in the event store, dispatches it to the handlers
+// of its source and detail type and stores the outcome with the event. Handler failures are
+// counted per handler and returned, as is a body that is not an event.
+func (s *CloudTrailService) processMessage(ctx context.Context, cfg aws.Config, accountID string, messageBody *string) error {
 	if messageBody == nil {
-		return
+		return nil
 	}
 
-	fmt.Printf("[Security Finding] Processing security finding: %s\n", *messageBody)
-	// TODO: Implement security finding processing logic
+	// Keep the raw event so it can be queried, exported and replayed later
+	store := events.Default()
+	var stored *events.Event
+	if store != nil {
+		var err error
+		if stored, err = store.Record(ctx, *messageBody); err != nil {
+			log.Printf("[SQS Polling] Warning: %v", err)
+		}
+	}
+
+	err := eventpipeline.Default().DispatchBody(ctx, accountID, cfg, *messageBody)
+	if stored != nil {
+		if recordErr := store.RecordResult(ctx, stored.TenantID, stored.ID, err, false); recordErr != nil {
+			log.Printf("[SQS Polling] Warning: %v", recordErr)
+		}
+	}
+	return err
 }
 
 // checkEventBridgeConnection verifies that EventBridge is properly connected to the SQS queue
@@ -280,8 +399,30 @@ func (s *CloudTrailService) startSQSPollingWithEventBridgeCheck(ctx context.Cont
 	fmt.Printf("[CloudTrail Logs] Expected events: S3 operations, EC2 operations, IAM operations\n")
 	fmt.Printf("[CloudTrail Logs] These events should trigger EventBridge → SQS messages\n")
 
+	// Sample queue depth in the background so lag and backlog are visible via /metrics/queues
+	go queuemonitor.Default().StartSampling(ctx, sqs.NewFromConfig(cfg), accountID, queueURL, 30*time.Second)
+
+	// Keep what reaches the dead-letter queue where /events/dead-letters can show it
+	deadLettersDone := make(chan struct{})
+	go func() {
+		defer close(deadLettersDone)
+		consumeDeadLetters(ctx, cfg, queueURL, accountID)
+	}()
+
 	// Start the actual polling
-	s.startSQSPolling(ctx, cfg, queueURL)
+	s.startSQSPolling(ctx, cfg, queueURL, accountID)
+	<-deadLettersDone
+}
+
+// recordBatchLag reports the age of a received batch to the queue monitor
+func recordBatchLag(accountID, queueURL string, messages []types.Message) {
+	var sentAt []time.Time
+	for _, message := range messages {
+		if t, ok := queuemonitor.SentTimestamp(message); ok {
+			sentAt = append(sentAt, t)
+		}
+	}
+	queuemonitor.Default().RecordBatch(accountID, queueURL, sentAt)
 }
 
 // sendTestMessage sends a test message to the SQS queue for verification
@@ -293,6 +434,9 @@ func (s *CloudTrailService) sendTestMessage(ctx context.Context, cfg aws.Config,
 		QueueUrl:    aws.String(queueURL),
 		MessageBody: aws.String(testMessage),
 	}
+	if isFIFOQueue(queueURL) {
+		sendMessageInput.MessageGroupId = aws.String(defaultMessageGroup)
+	}
 
 	result, err := sqsClient.SendMessage(ctx, sendMessageInput)
 	if err != nil {
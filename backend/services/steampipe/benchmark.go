@@ -0,0 +1,36 @@
+package steampipe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// RunBenchmark runs a Steampipe compliance benchmark (e.g. "benchmark.cis_v300")
+// against the given connection and returns the parsed JSON report
+func RunBenchmark(ctx context.Context, benchmark, connection string) (map[string]interface{}, error) {
+	args := []string{"check", benchmark, "--output", "json", "--progress=false"}
+	if connection != "" {
+		args = append(args, "--search-path-prefix", connection)
+	}
+
+	cmd := exec.CommandContext(ctx, "steampipe", args...)
+	output, runErr := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("steampipe benchmark %s cancelled: %w", benchmark, ctx.Err())
+	}
+
+	// steampipe check exits non-zero when controls are in alarm, so a parsable report wins over the exit code
+	var report map[string]interface{}
+	if err := json.Unmarshal(output, &report); err != nil {
+		if runErr != nil {
+			if exitErr, ok := runErr.(*exec.ExitError); ok {
+				return nil, fmt.Errorf("steampipe benchmark %s failed: %s: %w", benchmark, string(exitErr.Stderr), runErr)
+			}
+			return nil, fmt.Errorf("steampipe benchmark %s failed: %w", benchmark, runErr)
+		}
+		return nil, fmt.Errorf("failed to parse steampipe benchmark output: %w", err)
+	}
+	return report, nil
+}
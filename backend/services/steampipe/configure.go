@@ -11,8 +11,10 @@ import (
 	"github.com/go-ini/ini"
 )
 
-func ConfigureSteampipe(profileName, roleARN, externalID, sourceProfile string) error {
-	if err := addAWSProfile(profileName, roleARN, externalID, sourceProfile); err != nil {
+// ConfigureSteampipe adds an AWS profile that assumes roleARN in region and a Steampipe
+// connection using it, then restarts the Steampipe service
+func ConfigureSteampipe(profileName, roleARN, externalID, sourceProfile, region string) error {
+	if err := addAWSProfile(profileName, roleARN, externalID, sourceProfile, region); err != nil {
 		return fmt.Errorf("failed to add AWS profile: %v", err)
 	}
 
@@ -27,7 +29,7 @@ func ConfigureSteampipe(profileName, roleARN, externalID, sourceProfile string)
 	return nil
 }
 
-func addAWSProfile(profileName string, roleARN string, externalID string, sourceProfile string) error {
+func addAWSProfile(profileName string, roleARN string, externalID string, sourceProfile string, region string) error {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -62,7 +64,7 @@ func addAWSProfile(profileName string, roleARN string, externalID string, source
 	section.Key("role_arn").SetValue(roleARN)
 	section.Key("external_id").SetValue(externalID)
 	section.Key("source_profile").SetValue(sourceProfile)
-	section.Key("region").SetValue("ap-south-1")
+	section.Key("region").SetValue(region)
 
 	return cfg.SaveTo(awsConfigPath)
 }
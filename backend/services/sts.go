@@ -3,54 +3,58 @@ package services
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/rishichirchi/cloudloom/common"
 	awsconfig "github.com/rishichirchi/cloudloom/config"
 )
 
+// assumeRoleSessionName names the sessions CloudLoom opens in customer accounts
+const assumeRoleSessionName = "CloudLoomSession"
+
+// assumeRole returns a config for the customer account whose credentials assume the tenant's
+// role again shortly before they expire, so long-lived users of the config such as SQS pollers
+// and background scans keep working past the one-hour STS session. The role is assumed once
+// up front so a role that cannot be assumed fails here.
 func (s *CloudTrailService) assumeRole(ctx context.Context) (aws.Config, error) {
+	if DemoModeEnabled() {
+		return aws.Config{}, ErrDemoMode
+	}
 	fmt.Println("[AssumeRole] Starting AssumeRole handler")
 
 	stsClient := sts.NewFromConfig(awsconfig.AWSConfig)
-	fmt.Println("[AssumeRole] Created STS client")
-
-	assumeRoleInput := &sts.AssumeRoleInput{
-		RoleArn:         aws.String(common.ARNNumber),
-		RoleSessionName: aws.String("CloudLoomSession"),
-		ExternalId:      aws.String(common.ExternalID),
-	}
+	roleArn, externalID := s.roleArn(), s.externalID()
 	fmt.Printf("[AssumeRole] AssumeRoleInput: RoleArn=%s, RoleSessionName=%s, ExternalId=%s\n",
-		common.ARNNumber, "CloudLoomSession", common.ExternalID)
+		roleArn, assumeRoleSessionName, externalID)
+
+	provider := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, roleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = assumeRoleSessionName
+		o.ExternalID = aws.String(externalID)
+	}), func(o *aws.CredentialsCacheOptions) {
+		// Refresh early so a request signed just before expiry is not rejected
+		o.ExpiryWindow = 5 * time.Minute
+	})
 
-	result, err := stsClient.AssumeRole(ctx, assumeRoleInput)
+	creds, err := provider.Retrieve(ctx)
 	if err != nil {
 		fmt.Printf("[AssumeRole] Failed to assume role: %v\n", err)
 		return aws.Config{}, fmt.Errorf("failed to assume role: %w", err)
 	}
-	fmt.Println("[AssumeRole] Successfully assumed role")
-
-	if result.Credentials == nil {
-		fmt.Println("[AssumeRole] Credentials are nil in AssumeRole result")
-		return aws.Config{}, fmt.Errorf("assume role succeeded but credentials are nil")
-	}
+	fmt.Printf("[AssumeRole] Successfully assumed role: AccessKeyId=%s, expires %s\n", creds.AccessKeyID, creds.Expires.Format(time.RFC3339))
 
-	fmt.Printf("[AssumeRole] Received credentials: AccessKeyId=%s\n", *result.Credentials.AccessKeyId)
+	loadCtx, cancel := awsconfig.WithAWSTimeout(ctx)
+	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-		*result.Credentials.AccessKeyId,
-		*result.Credentials.SecretAccessKey,
-		*result.Credentials.SessionToken,
-	)), config.WithRegion("ap-south-1"))
+	cfg, err := config.LoadDefaultConfig(loadCtx, config.WithCredentialsProvider(provider),
+		config.WithRegion(s.region()), config.WithAPIOptions(awsconfig.AWSAPIOptions()))
 	if err != nil {
 		fmt.Printf("[AssumeRole] Failed to load AWS config: %v\n", err)
 		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
 	}
-	fmt.Println("[AssumeRole] Successfully loaded AWS config with assumed role credentials")
+	fmt.Println("[AssumeRole] Successfully loaded AWS config with refreshing assumed role credentials")
 
 	return cfg, nil
 }
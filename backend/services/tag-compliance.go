@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/tagpolicy"
+)
+
+// FindingSourceTagPolicy marks findings produced by evaluating the tenant's tag policy
+const FindingSourceTagPolicy = "tag_policy"
+
+// TagViolation is a resource that lacks a required tag or has a value the policy does not allow
+type TagViolation struct {
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Key          string `json:"key"`
+	// Value is the tag's value when it does not match the rule's pattern
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// TagCompliance is the result of evaluating the tenant's tag policy against a snapshot
+type TagCompliance struct {
+	Snapshot InventorySnapshot `json:"snapshot"`
+	Policy   *tagpolicy.Policy `json:"policy"`
+	// Evaluated counts the resources at least one rule applies to; Compliant those of them
+	// that violate none
+	Evaluated  int            `json:"evaluated"`
+	Compliant  int            `json:"compliant"`
+	Violations []TagViolation `json:"violations"`
+}
+
+// EvaluateTagPolicy checks every resource against the rules of the policy that apply to its
+// type and returns the violations and how many resources were evaluated
+func EvaluateTagPolicy(policy *tagpolicy.Policy, resources []ConfigurationItem) ([]TagViolation, int, int) {
+	violations := []TagViolation{}
+	evaluated, compliant := 0, 0
+	for _, resource := range resources {
+		applied, violated := false, false
+		for i := range policy.Rules {
+			rule := &policy.Rules[i]
+			if !policy.AppliesTo(rule, resource.ResourceType) {
+				continue
+			}
+			applied = true
+			reason := rule.Check(resource.Tags)
+			if reason == "" {
+				continue
+			}
+			violated = true
+			violation := TagViolation{
+				ResourceType: resource.ResourceType,
+				ResourceID:   resource.ResourceID,
+				ResourceName: resource.ResourceName,
+				Region:       resource.Region,
+				Key:          rule.Key,
+				Reason:       reason,
+			}
+			if reason == tagpolicy.ReasonInvalidValue {
+				violation.Value = resource.Tags[rule.Key]
+			}
+			violations = append(violations, violation)
+		}
+		if applied {
+			evaluated++
+			if !violated {
+				compliant++
+			}
+		}
+	}
+	return violations, evaluated, compliant
+}
+
+// EvaluateTagCompliance evaluates the tenant's tag policy against snapshot snapshotID, or the
+// latest snapshot if that is empty, so policy changes apply without waiting for a scan. It
+// returns tagpolicy.ErrNotFound if the tenant has no policy and jobs.ErrNotFound if there is
+// no such snapshot.
+func EvaluateTagCompliance(ctx context.Context, tenantID, snapshotID string) (*TagCompliance, error) {
+	store := tagpolicy.Default()
+	if store == nil {
+		return nil, errors.New("tag policy store is not initialized")
+	}
+	policy, err := store.Get(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, inventory, err := LoadInventory(ctx, tenantID, snapshotID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TagCompliance{Snapshot: *snapshot, Policy: policy}
+	result.Violations, result.Evaluated, result.Compliant = EvaluateTagPolicy(policy, inventory.Resources)
+	return result, nil
+}
+
+// syncTagFindings evaluates the tenant's tag policy against a scan and, if the policy emits
+// findings, records one per violation. Findings from earlier scans that are no longer reported,
+// including all of them once the policy stops emitting findings, are resolved.
+func syncTagFindings(ctx context.Context, tenantID string, resources []ConfigurationItem, scanStartedAt time.Time) error {
+	store, policies := findings.Default(), tagpolicy.Default()
+	if store == nil || policies == nil {
+		return nil
+	}
+	policy, err := policies.Get(ctx, tenantID)
+	if err != nil && !errors.Is(err, tagpolicy.ErrNotFound) {
+		return err
+	}
+
+	recorded := 0
+	if policy != nil {
+		violations, evaluated, compliant := EvaluateTagPolicy(policy, resources)
+		log.Printf("[TagPolicy] %d of %d resources comply with the tag policy of tenant %s", compliant, evaluated, tenantID)
+		if policy.EmitFindings {
+			for _, violation := range violations {
+				finding := &findings.Finding{
+					TenantID:     tenantID,
+					Source:       FindingSourceTagPolicy,
+					RuleID:       "tag:" + violation.Key,
+					Title:        tagViolationTitle(violation),
+					Severity:     "low",
+					ResourceType: violation.ResourceType,
+					ResourceID:   violation.ResourceID,
+				}
+				if err := recordFinding(ctx, store, finding); err != nil {
+					return err
+				}
+				recorded++
+			}
+		}
+	}
+
+	resolved, err := store.ResolveStale(ctx, tenantID, FindingSourceTagPolicy, scanStartedAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Findings] ✅ Recorded %d tag policy findings, resolved %d for tenant %s", recorded, resolved, tenantID)
+	return nil
+}
+
+func tagViolationTitle(violation TagViolation) string {
+	if violation.Reason == tagpolicy.ReasonMissing {
+		return fmt.Sprintf("%s is missing required tag %s", violation.ResourceID, violation.Key)
+	}
+	return fmt.Sprintf("%s has tag %s with a value the tag policy does not allow", violation.ResourceID, violation.Key)
+}
@@ -0,0 +1,200 @@
+package tagpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionTagPolicies
+
+var (
+	// ErrInvalid is returned when a policy has no rules, a duplicate key or a bad pattern
+	ErrInvalid = errors.New("invalid tag policy")
+	// ErrNotFound is returned when a tenant has not defined a tag policy
+	ErrNotFound = errors.New("tag policy not found")
+)
+
+var resourceTypePattern = regexp.MustCompile(`^AWS::[A-Za-z0-9]+::[A-Za-z0-9]+$`)
+
+// Reasons a resource violates a tag rule
+const (
+	ReasonMissing      = "missing"
+	ReasonInvalidValue = "invalid_value"
+)
+
+// Rule requires resources to have a tag, optionally with a value matching a pattern
+type Rule struct {
+	Key string `bson:"key" json:"key" binding:"required,max=128"`
+	// Pattern is a regular expression the whole value must match; empty allows any value
+	Pattern string `bson:"pattern,omitempty" json:"pattern,omitempty"`
+	// ResourceTypes limits the rule to these types; empty applies it to the policy's scope
+	ResourceTypes []string `bson:"resourceTypes,omitempty" json:"resourceTypes,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Policy is the tags a tenant requires on its resources
+type Policy struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	Rules    []Rule `bson:"rules" json:"rules" binding:"required,min=1,dive"`
+	// ResourceTypes limits the policy to these types; empty applies it to every resource
+	ResourceTypes []string `bson:"resourceTypes,omitempty" json:"resourceTypes,omitempty"`
+	// EmitFindings records a finding for every violation found by an inventory scan
+	EmitFindings bool      `bson:"emitFindings" json:"emitFindings"`
+	UpdatedAt    time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Normalize validates the policy, compiles its patterns and sorts its rules by key
+func (p *Policy) Normalize() error {
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("%w: at least one rule is required", ErrInvalid)
+	}
+	if err := checkResourceTypes(p.ResourceTypes); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Key == "" {
+			return fmt.Errorf("%w: rule %d has no key", ErrInvalid, i)
+		}
+		if seen[rule.Key] {
+			return fmt.Errorf("%w: tag '%s' has more than one rule", ErrInvalid, rule.Key)
+		}
+		seen[rule.Key] = true
+		if err := checkResourceTypes(rule.ResourceTypes); err != nil {
+			return err
+		}
+		if err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	sort.Slice(p.Rules, func(i, j int) bool { return p.Rules[i].Key < p.Rules[j].Key })
+	return nil
+}
+
+func checkResourceTypes(resourceTypes []string) error {
+	for _, resourceType := range resourceTypes {
+		if !resourceTypePattern.MatchString(resourceType) {
+			return fmt.Errorf("%w: '%s' is not an AWS resource type", ErrInvalid, resourceType)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Pattern == "" {
+		r.pattern = nil
+		return nil
+	}
+	// Anchored so the pattern describes the whole value
+	pattern, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("%w: pattern for tag '%s': %v", ErrInvalid, r.Key, err)
+	}
+	r.pattern = pattern
+	return nil
+}
+
+// AppliesTo reports whether the rule covers resources of the type under the policy
+func (p *Policy) AppliesTo(rule *Rule, resourceType string) bool {
+	scope := rule.ResourceTypes
+	if len(scope) == 0 {
+		scope = p.ResourceTypes
+	}
+	if len(scope) == 0 {
+		return true
+	}
+	for _, t := range scope {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns why tags violate the rule, or "" if they satisfy it
+func (r *Rule) Check(tags map[string]string) string {
+	value, ok := tags[r.Key]
+	switch {
+	case !ok:
+		return ReasonMissing
+	case r.pattern != nil && !r.pattern.MatchString(value):
+		return ReasonInvalidValue
+	}
+	return ""
+}
+
+// Store persists per-tenant tag policies in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide tag policy store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide tag policy store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the tag_policies collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Get returns the tenant's policy, ready to evaluate
+func (s *Store) Get(ctx context.Context, tenantID string) (*Policy, error) {
+	var policy Policy
+	err := s.collection.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tag policy: %w", err)
+	}
+	if err := policy.Normalize(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Put validates the policy and replaces the tenant's policy with it
+func (s *Store) Put(ctx context.Context, tenantID string, policy *Policy) error {
+	if err := policy.Normalize(); err != nil {
+		return err
+	}
+	policy.TenantID = tenantID
+	policy.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"tenantId": tenantID}, policy, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save tag policy: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the tenant's policy
+func (s *Store) Delete(ctx context.Context, tenantID string) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete tag policy: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
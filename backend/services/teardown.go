@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/rishichirchi/cloudloom/services/tenants"
+)
+
+// What teardown did with each resource
+const (
+	TeardownRemoved  = "removed"
+	TeardownSkipped  = "skipped"
+	TeardownRetained = "retained"
+	TeardownFailed   = "failed"
+)
+
+// notFoundCodes are the error codes AWS returns for a resource that does not exist, which
+// teardown reports as skipped
+var notFoundCodes = map[string]bool{
+	"NoSuchEntity":              true,
+	"NoSuchBucket":              true,
+	"NoSuchKey":                 true,
+	"ResourceNotFoundException": true,
+	"TrailNotFoundException":    true,
+	"AWS.SimpleQueueService.NonExistentQueue": true,
+	"QueueDoesNotExist":                       true,
+	"NoSuchConfigurationRecorderException":    true,
+	"NoSuchDeliveryChannelException":          true,
+	"NoSuchConfigurationAggregatorException":  true,
+	"NotFoundException":                       true,
+}
+
+// TeardownResource is the outcome of removing one CloudLoom-created resource
+type TeardownResource struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TeardownReport lists what teardown removed, skipped because it did not exist, retained or
+// failed to remove
+type TeardownReport struct {
+	AccountID string             `json:"accountId"`
+	Resources []TeardownResource `json:"resources"`
+	// Complete is set when nothing failed, so running teardown again would change nothing
+	Complete   bool      `json:"complete"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+func (r *TeardownReport) record(kind, name, region string, err error) {
+	resource := TeardownResource{Kind: kind, Name: name, Region: region, Action: TeardownRemoved}
+	switch {
+	case err == nil:
+	case isNotFound(err):
+		resource.Action = TeardownSkipped
+		resource.Detail = "not found"
+	default:
+		resource.Action, resource.Detail = TeardownFailed, err.Error()
+	}
+	r.Resources = append(r.Resources, resource)
+}
+
+// TeardownOptions controls what teardown keeps
+type TeardownOptions struct {
+	// RetainLogs keeps the CloudTrail log bucket and its contents, and the key encrypting them
+	RetainLogs bool
+}
+
+// TeardownService removes the resources account setup created in a customer account. It does
+// not touch the CloudLoom role the customer created, since teardown runs through it.
+type TeardownService struct {
+	cloudTrail *CloudTrailService
+	tenantID   string
+}
+
+// NewTeardownService returns a teardown service for the tenant's account
+func NewTeardownService(ctx context.Context, tenantID string) (*TeardownService, error) {
+	cloudTrail, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &TeardownService{cloudTrail: cloudTrail, tenantID: tenantID}, nil
+}
+
+// Teardown removes the trail, EventBridge rules, GuardDuty detectors, SNS topic, SQS queue and its
+// dead-letter queue, log group, IAM roles, Config recorder, delivery channel and aggregator, log bucket and its replica,
+// and KMS key that setup created. A customer's existing trail and bucket are kept, less the statements setup added to
+// the bucket's policy. Missing resources are skipped and failures are reported per resource,
+// so it is safe to run again.
+func (t *TeardownService) Teardown(ctx context.Context, opts TeardownOptions) (*TeardownReport, error) {
+	cfg, err := t.cloudTrail.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Teardown] Removing CloudLoom resources from account %s", accountID)
+
+	// Names match the ones SetupCloudTrail and enableAWSConfig create, unless setup tagged
+	// resources under other names
+	names := t.cloudTrail.resourceNames(ctx, cfg, accountID, t.cloudTrail.monitoredRegions())
+	bucketName, logGroupName, trailName, queueName := names.bucket, names.logGroup, names.trail, names.queue
+	recorderName := fmt.Sprintf("CloudLoom-Config-Recorder-%s", accountID)
+	channelName := fmt.Sprintf("CloudLoom-Config-Channel-%s", accountID)
+	roleNames := []string{
+		fmt.Sprintf("CloudLoom-CloudTrail-Role-%s", accountID),
+		fmt.Sprintf("CloudLoom-Events-Role-%s", accountID),
+		"CloudLoom-Config-ServiceRole",
+		configAggregatorRoleName,
+	}
+	if names.replicationRegion != "" {
+		roleNames = append(roleNames, replicationRoleName(accountID))
+	}
+
+	report := &TeardownReport{AccountID: accountID, Resources: []TeardownResource{}}
+
+	// Stop consuming the queue before it disappears
+	if stopPolling(accountID) {
+		report.record("sqs_poller", queueName, "", nil)
+	} else {
+		report.Resources = append(report.Resources, TeardownResource{Kind: "sqs_poller", Name: queueName, Action: TeardownSkipped, Detail: "not running on this server"})
+	}
+
+	for _, region := range names.regions {
+		ruleName := names.rules[region]
+		err := deleteEventBridgeRule(ctx, eventbridge.NewFromConfig(inRegion(cfg, region)), ruleName)
+		report.record("eventbridge_rule", ruleName, region, err)
+	}
+	removeGuardDutyDetectors(ctx, cfg, names.regions, report)
+
+	if names.existingTrail {
+		report.Resources = append(report.Resources, TeardownResource{Kind: "cloudtrail_trail", Name: trailName, Region: cfg.Region, Action: TeardownRetained, Detail: "customer's existing trail"})
+	} else {
+		trails := cloudtrail.NewFromConfig(cfg)
+		if _, err := trails.StopLogging(ctx, &cloudtrail.StopLoggingInput{Name: aws.String(trailName)}); err != nil && !isNotFound(err) {
+			log.Printf("[Teardown] Warning: failed to stop logging on %s: %v", trailName, err)
+		}
+		_, err = trails.DeleteTrail(ctx, &cloudtrail.DeleteTrailInput{Name: aws.String(trailName)})
+		report.record("cloudtrail_trail", trailName, cfg.Region, err)
+	}
+
+	// The delivery channel can only be deleted once its recorder has stopped
+	recorders := configservice.NewFromConfig(cfg)
+	if _, err := recorders.StopConfigurationRecorder(ctx, &configservice.StopConfigurationRecorderInput{ConfigurationRecorderName: aws.String(recorderName)}); err != nil && !isNotFound(err) {
+		log.Printf("[Teardown] Warning: failed to stop %s: %v", recorderName, err)
+	}
+	_, err = recorders.DeleteDeliveryChannel(ctx, &configservice.DeleteDeliveryChannelInput{DeliveryChannelName: aws.String(channelName)})
+	report.record("config_delivery_channel", channelName, cfg.Region, err)
+	_, err = recorders.DeleteConfigurationRecorder(ctx, &configservice.DeleteConfigurationRecorderInput{ConfigurationRecorderName: aws.String(recorderName)})
+	report.record("config_recorder", recorderName, cfg.Region, err)
+	_, err = recorders.DeleteConfigurationAggregator(ctx, &configservice.DeleteConfigurationAggregatorInput{ConfigurationAggregatorName: aws.String(ConfigAggregatorName)})
+	report.record("config_aggregator", ConfigAggregatorName, cfg.Region, err)
+
+	queues := sqs.NewFromConfig(cfg)
+	queue, err := queues.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err == nil {
+		_, err = queues.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: queue.QueueUrl})
+	}
+	report.record("sqs_queue", queueName, cfg.Region, err)
+	deadLetterQueue, err := queues.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(deadLetterQueueName(queueName))})
+	if err == nil {
+		_, err = queues.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: deadLetterQueue.QueueUrl})
+	}
+	report.record("sqs_queue", deadLetterQueueName(queueName), cfg.Region, err)
+
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:%s", cfg.Region, accountID, names.topic)
+	_, err = sns.NewFromConfig(cfg).DeleteTopic(ctx, &sns.DeleteTopicInput{TopicArn: aws.String(topicArn)})
+	report.record("sns_topic", names.topic, cfg.Region, err)
+
+	logs := cloudwatchlogs.NewFromConfig(cfg)
+	_, err = logs.DeleteLogGroup(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: aws.String(logGroupName)})
+	report.record("log_group", logGroupName, cfg.Region, err)
+	_, err = logs.DeleteResourcePolicy(ctx, &cloudwatchlogs.DeleteResourcePolicyInput{PolicyName: aws.String("CloudLoom-CloudTrail-Access-Policy")})
+	report.record("log_resource_policy", "CloudLoom-CloudTrail-Access-Policy", cfg.Region, err)
+
+	roles := iam.NewFromConfig(cfg)
+	for _, roleName := range roleNames {
+		report.record("iam_role", roleName, "", deleteRole(ctx, roles, roleName))
+	}
+
+	switch {
+	case names.existingBucket:
+		// Only the statements setup added to the customer's bucket are removed
+		report.record("s3_bucket_policy", bucketName, cfg.Region, removeBucketPolicyStatements(ctx, cfg, bucketName))
+		report.Resources = append(report.Resources, TeardownResource{Kind: "s3_bucket", Name: bucketName, Region: cfg.Region, Action: TeardownRetained, Detail: "customer's existing bucket"})
+	case names.existingTrail:
+		// The customer's trail delivers to its own bucket, which setup did not touch
+	case opts.RetainLogs:
+		report.Resources = append(report.Resources, TeardownResource{Kind: "s3_bucket", Name: bucketName, Action: TeardownRetained, Detail: "retainLogs was set"})
+	default:
+		buckets := s3.NewFromConfig(cfg)
+		err := emptyBucket(ctx, buckets, bucketName)
+		if err == nil {
+			_, err = buckets.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
+		}
+		report.record("s3_bucket", bucketName, cfg.Region, err)
+	}
+	if names.replicationRegion != "" && !names.existingBucket && !names.existingTrail {
+		removeReplicaBucket(ctx, cfg, replicaBucketName(accountID, names.replicationRegion), names.replicationRegion, opts.RetainLogs, report)
+	}
+	if names.kmsKey != "" && !names.existingTrail {
+		removeLogKey(ctx, cfg, names.kmsKey, opts.RetainLogs, report)
+	}
+
+	report.Complete = true
+	for _, resource := range report.Resources {
+		if resource.Action == TeardownFailed {
+			report.Complete = false
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	if manager := tenants.Default(); manager != nil && report.Complete {
+		if err := manager.MarkRemoved(ctx, t.tenantID); err != nil && !errors.Is(err, tenants.ErrNotFound) {
+			log.Printf("[Teardown] Warning: failed to update tenant %s: %v", t.tenantID, err)
+		}
+	}
+	log.Printf("[Teardown] ✅ Finished teardown of account %s (complete=%t)", accountID, report.Complete)
+	return report, nil
+}
+
+// removeReplicaBucket empties and deletes the bucket the log bucket replicated to, or keeps it
+// with the logs
+func removeReplicaBucket(ctx context.Context, cfg aws.Config, bucketName, region string, retainLogs bool, report *TeardownReport) {
+	if retainLogs {
+		report.Resources = append(report.Resources, TeardownResource{Kind: "s3_replica_bucket", Name: bucketName, Action: TeardownRetained, Detail: "retainLogs was set"})
+		return
+	}
+	buckets := s3.NewFromConfig(inRegion(cfg, region))
+	err := emptyBucket(ctx, buckets, bucketName)
+	if err == nil {
+		_, err = buckets.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
+	}
+	report.record("s3_replica_bucket", bucketName, region, err)
+}
+
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && notFoundCodes[apiErr.ErrorCode()]
+}
+
+// deleteRole detaches and deletes the role's policies, then the role itself
+func deleteRole(ctx context.Context, client *iam.Client, roleName string) error {
+	attached, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return err
+	}
+	for _, policy := range attached.AttachedPolicies {
+		if _, err := client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{RoleName: aws.String(roleName), PolicyArn: policy.PolicyArn}); err != nil {
+			return err
+		}
+	}
+
+	inline, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return err
+	}
+	for _, name := range inline.PolicyNames {
+		if _, err := client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{RoleName: aws.String(roleName), PolicyName: aws.String(name)}); err != nil {
+			return err
+		}
+	}
+
+	_, err = client.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: aws.String(roleName)})
+	return err
+}
+
+// emptyBucket deletes every object version and delete marker so the bucket can be deleted
+func emptyBucket(ctx context.Context, client *s3.Client, bucketName string) error {
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucketName)}
+	for {
+		page, err := client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return err
+		}
+
+		var objects []s3types.ObjectIdentifier
+		for _, version := range page.Versions {
+			objects = append(objects, s3types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, s3types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) > 0 {
+			out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucketName),
+				Delete: &s3types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return err
+			}
+			if len(out.Errors) > 0 {
+				return fmt.Errorf("failed to delete %d objects, e.g. %s: %s", len(out.Errors),
+					aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+			}
+		}
+
+		if !aws.ToBool(page.IsTruncated) {
+			return nil
+		}
+		input.KeyMarker, input.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+	}
+}
@@ -0,0 +1,78 @@
+package tenantdata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deleteBatchSize bounds the number of IDs in a single archival delete
+const deleteBatchSize = 1000
+
+// ArchiveResult describes the documents one retention pass archived and removed
+type ArchiveResult struct {
+	TenantID string    `json:"tenantId" bson:"tenantId"`
+	Dataset  string    `json:"dataset" bson:"dataset"`
+	Cutoff   time.Time `json:"cutoff" bson:"cutoff"`
+	Key      string    `json:"key" bson:"key"`
+	Archived int64     `json:"archived" bson:"archived"`
+	Deleted  int64     `json:"deleted" bson:"deleted"`
+}
+
+// ArchiveOlderThan writes the tenant's documents in the dataset that are older than cutoff to the
+// bucket as gzip NDJSON and then deletes exactly those documents. Nothing is deleted unless the
+// upload succeeded. It returns nil when there is nothing to archive.
+func ArchiveOlderThan(ctx context.Context, db *mongo.Database, cfg aws.Config, bucket, tenantID string, dataset Dataset, cutoff time.Time) (*ArchiveResult, error) {
+	filter := dataset.OlderThan(tenantID, cutoff)
+	collection := db.Collection(dataset.Collection)
+
+	pending, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count expired %s: %w", dataset.Name, err)
+	}
+	if pending == 0 {
+		return nil, nil
+	}
+
+	result := &ArchiveResult{
+		TenantID: tenantID,
+		Dataset:  dataset.Name,
+		Cutoff:   cutoff,
+		Key: fmt.Sprintf("cloudloom-archive/%s/%s/%s.ndjson.gz",
+			tenantID, dataset.Name, time.Now().UTC().Format("20060102T150405Z")),
+	}
+
+	// Only the documents that made it into the archive are deleted, so anything that starts
+	// matching the filter while the upload runs is left for the next pass
+	var ids []interface{}
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg))
+	result.Archived, err = uploadStream(ctx, uploader, bucket, result.Key, func(w io.Writer) (int64, error) {
+		return writeDataset(ctx, db, dataset, filter, tenantID, FormatJSON, w, func(doc bson.M) {
+			ids = append(ids, doc["_id"])
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive %s: %w", dataset.Name, err)
+	}
+
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(ids))
+		deleted, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids[start:end]}})
+		if err != nil {
+			return result, fmt.Errorf("failed to delete archived %s: %w", dataset.Name, err)
+		}
+		result.Deleted += deleted.DeletedCount
+	}
+
+	log.Printf("[Retention] ✅ Archived %d %s documents to s3://%s/%s and deleted %d",
+		result.Archived, dataset.Name, bucket, result.Key, result.Deleted)
+	return result, nil
+}
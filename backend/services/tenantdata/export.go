@@ -0,0 +1,285 @@
+package tenantdata
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/rishichirchi/cloudloom/services/buffer"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Export formats
+const (
+	FormatJSON    = "json"
+	FormatParquet = "parquet"
+)
+
+// ExportDeliverySink is the buffer sink name for export objects written to customer buckets
+const ExportDeliverySink = "s3"
+
+// parquetBatchSize is how many rows are buffered before being handed to the Parquet writer
+const parquetBatchSize = 1000
+
+// ExportOptions selects where and how a tenant export is written
+type ExportOptions struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Format   string
+	Datasets []string
+}
+
+// Validate checks the export options and fills in defaults
+func (o *ExportOptions) Validate() error {
+	if o.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if o.Format == "" {
+		o.Format = FormatJSON
+	}
+	if o.Format != FormatJSON && o.Format != FormatParquet {
+		return fmt.Errorf("format must be '%s' or '%s'", FormatJSON, FormatParquet)
+	}
+	if _, ok := Lookup(o.Datasets); !ok {
+		return fmt.Errorf("unknown dataset in %v", o.Datasets)
+	}
+	o.Prefix = strings.Trim(o.Prefix, "/")
+	return nil
+}
+
+// ExportedFile describes one object written by an export
+type ExportedFile struct {
+	Dataset   string `json:"dataset" bson:"dataset"`
+	Key       string `json:"key" bson:"key"`
+	Documents int64  `json:"documents" bson:"documents"`
+}
+
+// Manifest is written alongside the data files and returned as the export job result
+type Manifest struct {
+	TenantID    string         `json:"tenantId" bson:"tenantId"`
+	Bucket      string         `json:"bucket" bson:"bucket"`
+	Format      string         `json:"format" bson:"format"`
+	StartedAt   time.Time      `json:"startedAt" bson:"startedAt"`
+	CompletedAt time.Time      `json:"completedAt" bson:"completedAt"`
+	Files       []ExportedFile `json:"files" bson:"files"`
+}
+
+// parquetRow is the warehouse-friendly flattening of a document: common columns plus the full JSON
+type parquetRow struct {
+	ID          string `parquet:"id"`
+	TenantID    string `parquet:"tenant_id"`
+	Dataset     string `parquet:"dataset"`
+	TimestampMs int64  `parquet:"timestamp_ms"`
+	Document    string `parquet:"document"`
+}
+
+// Export streams every selected dataset of the tenant to the customer's bucket, one compressed
+// object per dataset plus a manifest.json. cfg must have write access to the bucket.
+func Export(ctx context.Context, db *mongo.Database, cfg aws.Config, tenantID string, opts ExportOptions) (*Manifest, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	selected, _ := Lookup(opts.Datasets)
+
+	if opts.Region != "" {
+		cfg = cfg.Copy()
+		cfg.Region = opts.Region
+	}
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg))
+
+	manifest := &Manifest{
+		TenantID:  tenantID,
+		Bucket:    opts.Bucket,
+		Format:    opts.Format,
+		StartedAt: time.Now().UTC(),
+		Files:     []ExportedFile{},
+	}
+	base := fmt.Sprintf("cloudloom-export/%s/%s", tenantID, manifest.StartedAt.Format("20060102T150405Z"))
+	if opts.Prefix != "" {
+		base = opts.Prefix + "/" + base
+	}
+
+	for _, dataset := range selected {
+		ext := "ndjson.gz"
+		if opts.Format == FormatParquet {
+			ext = "parquet"
+		}
+		key := fmt.Sprintf("%s/%s.%s", base, dataset.Name, ext)
+
+		count, err := uploadStream(ctx, uploader, opts.Bucket, key, func(w io.Writer) (int64, error) {
+			return writeDataset(ctx, db, dataset, dataset.TenantFilter(tenantID), tenantID, opts.Format, w, nil)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", dataset.Name, err)
+		}
+		log.Printf("[Export] ✅ Wrote %d %s documents to s3://%s/%s", count, dataset.Name, opts.Bucket, key)
+		manifest.Files = append(manifest.Files, ExportedFile{Dataset: dataset.Name, Key: key, Documents: count})
+	}
+
+	manifest.CompletedAt = time.Now().UTC()
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestKey := base + "/manifest.json"
+	if buf := buffer.Default(); buf != nil {
+		// The data files are written by now, so the manifest waits in the delivery buffer
+		// rather than failing the export if the bucket is briefly unavailable
+		buffered, err := buf.Deliver(ctx, ExportDeliverySink, fmt.Sprintf("s3://%s/%s", opts.Bucket, manifestKey), tenantID, manifestJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write manifest: %w", err)
+		}
+		if buffered {
+			log.Printf("[Export] ⏳ Buffered manifest s3://%s/%s until the bucket recovers", opts.Bucket, manifestKey)
+		}
+		return manifest, nil
+	}
+	_, err = uploadStream(ctx, uploader, opts.Bucket, manifestKey, func(w io.Writer) (int64, error) {
+		_, err := w.Write(manifestJSON)
+		return 1, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// uploadStream pipes the output of write into a multipart upload so the export never sits in memory
+func uploadStream(ctx context.Context, uploader *manager.Uploader, bucket, key string, write func(io.Writer) (int64, error)) (int64, error) {
+	pr, pw := io.Pipe()
+	type outcome struct {
+		count int64
+		err   error
+	}
+	done := make(chan outcome, 1)
+
+	go func() {
+		count, err := write(pw)
+		pw.CloseWithError(err)
+		done <- outcome{count, err}
+	}()
+
+	_, uploadErr := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 pr,
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	// Unblock the writer if the upload stopped reading early
+	pr.CloseWithError(uploadErr)
+
+	result := <-done
+	if result.err != nil {
+		return 0, result.err
+	}
+	if uploadErr != nil {
+		return 0, fmt.Errorf("failed to upload s3://%s/%s: %w", bucket, key, uploadErr)
+	}
+	return result.count, nil
+}
+
+// writeDataset writes the dataset documents matching filter to w in the requested format.
+// seen, if set, is called with every document written.
+func writeDataset(ctx context.Context, db *mongo.Database, dataset Dataset, filter bson.M, tenantID, format string, w io.Writer, seen func(bson.M)) (int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: dataset.TimeField, Value: 1}})
+	cursor, err := db.Collection(dataset.Collection).Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if format == FormatParquet {
+		return writeParquet(ctx, cursor, dataset, tenantID, w, seen)
+	}
+	return writeNDJSON(ctx, cursor, w, seen)
+}
+
+func writeNDJSON(ctx context.Context, cursor *mongo.Cursor, w io.Writer, seen func(bson.M)) (int64, error) {
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+
+	var count int64
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return count, err
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return count, err
+		}
+		if seen != nil {
+			seen(doc)
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, gz.Close()
+}
+
+func writeParquet(ctx context.Context, cursor *mongo.Cursor, dataset Dataset, tenantID string, w io.Writer, seen func(bson.M)) (int64, error) {
+	writer := parquet.NewGenericWriter[parquetRow](w, parquet.Compression(&parquet.Snappy))
+
+	var count int64
+	batch := make([]parquetRow, 0, parquetBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := writer.Write(batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return count, err
+		}
+		document, err := json.Marshal(doc)
+		if err != nil {
+			return count, err
+		}
+
+		row := parquetRow{TenantID: tenantID, Dataset: dataset.Name, Document: string(document)}
+		if oid, ok := doc["_id"].(primitive.ObjectID); ok {
+			row.ID = oid.Hex()
+		}
+		if ts, ok := doc[dataset.TimeField].(primitive.DateTime); ok {
+			row.TimestampMs = int64(ts)
+		}
+		batch = append(batch, row)
+		if seen != nil {
+			seen(doc)
+		}
+		count++
+
+		if len(batch) == parquetBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
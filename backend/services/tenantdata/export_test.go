@@ -0,0 +1,186 @@
+package tenantdata
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestExportOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ExportOptions
+		want    ExportOptions
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			opts: ExportOptions{Bucket: "exports", Prefix: "/cloudloom/"},
+			want: ExportOptions{Bucket: "exports", Prefix: "cloudloom", Format: FormatJSON},
+		},
+		{
+			name: "parquet datasets",
+			opts: ExportOptions{Bucket: "exports", Format: FormatParquet, Datasets: []string{"findings", "events"}},
+			want: ExportOptions{Bucket: "exports", Format: FormatParquet, Datasets: []string{"findings", "events"}},
+		},
+		{name: "no bucket", opts: ExportOptions{Format: FormatJSON}, wantErr: true},
+		{name: "unknown format", opts: ExportOptions{Bucket: "exports", Format: "csv"}, wantErr: true},
+		{name: "unknown dataset", opts: ExportOptions{Bucket: "exports", Datasets: []string{"findings", "secrets"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.opts, tt.want) {
+				t.Errorf("Validate() options = %+v, want %+v", tt.opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		names  []string
+		want   []string
+		wantOK bool
+	}{
+		{name: "every dataset", wantOK: true},
+		{name: "in the order asked", names: []string{"events", "findings"}, want: []string{"events", "findings"}, wantOK: true},
+		{name: "unknown", names: []string{"events", "secrets"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Lookup(tt.names)
+			if ok != tt.wantOK {
+				t.Fatalf("Lookup(%v) ok = %v, want %v", tt.names, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if tt.names == nil {
+				if len(got) != len(datasets) {
+					t.Errorf("Lookup() returned %d datasets, want %d", len(got), len(datasets))
+				}
+				return
+			}
+			var names []string
+			for _, d := range got {
+				names = append(names, d.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Lookup(%v) = %v, want %v", tt.names, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatasetTenantFilter(t *testing.T) {
+	snapshots, _ := Lookup([]string{"inventory_snapshots"})
+	d := snapshots[0]
+	cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	want := bson.M{"tenantId": "111122223333", "type": "inventory_scan", "status": "succeeded", "finishedAt": bson.M{"$lt": cutoff}}
+	if got := d.OlderThan("111122223333", cutoff); !reflect.DeepEqual(got, want) {
+		t.Errorf("OlderThan() = %v, want %v", got, want)
+	}
+	if _, changed := d.Filter["finishedAt"]; changed {
+		t.Error("OlderThan() changed the dataset's filter")
+	}
+}
+
+// exportDocuments are the documents the writers are tested with, as Find returns them
+func exportDocuments(t *testing.T) (*mongo.Cursor, []primitive.ObjectID) {
+	t.Helper()
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	cursor, err := mongo.NewCursorFromDocuments([]interface{}{
+		bson.D{{Key: "_id", Value: ids[0]}, {Key: "tenantId", Value: "111122223333"}, {Key: "eventTime", Value: primitive.DateTime(1709251200000)}},
+		bson.D{{Key: "_id", Value: ids[1]}, {Key: "tenantId", Value: "111122223333"}, {Key: "eventName", Value: "PutObject"}},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor, ids
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	cursor, _ := exportDocuments(t)
+	var out bytes.Buffer
+	var seen int
+	count, err := writeNDJSON(context.Background(), cursor, &out, func(bson.M) { seen++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || seen != 2 {
+		t.Errorf("writeNDJSON() wrote %d documents and saw %d, want 2", count, seen)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("output is not gzipped: %v", err)
+	}
+	var lines int
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("line %d is not JSON: %v", lines+1, err)
+		}
+		if doc["tenantId"] != "111122223333" {
+			t.Errorf("line %d = %v, want the tenant's document", lines+1, doc)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("output has %d lines, want 2", lines)
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	cursor, ids := exportDocuments(t)
+	events, _ := Lookup([]string{"events"})
+	var out bytes.Buffer
+	count, err := writeParquet(context.Background(), cursor, events[0], "111122223333", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("writeParquet() wrote %d documents, want 2", count)
+	}
+
+	rows, err := parquet.Read[parquetRow](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not Parquet: %v", err)
+	}
+	want := []struct {
+		id          string
+		timestampMs int64
+	}{
+		{ids[0].Hex(), 1709251200000},
+		// Documents without the dataset's time field have no timestamp
+		{ids[1].Hex(), 0},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.ID != want[i].id || row.TimestampMs != want[i].timestampMs || row.TenantID != "111122223333" || row.Dataset != "events" {
+			t.Errorf("row %d = %+v, want ID %s and timestamp %d", i, row, want[i].id, want[i].timestampMs)
+		}
+		if !json.Valid([]byte(row.Document)) {
+			t.Errorf("row %d document is not JSON: %s", i, row.Document)
+		}
+	}
+}
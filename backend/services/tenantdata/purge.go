@@ -0,0 +1,190 @@
+package tenantdata
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/cache"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Purge actions recorded in a deletion report
+const (
+	ActionDeleted    = "deleted"
+	ActionAnonymized = "anonymized"
+	ActionNotStored  = "not_stored"
+)
+
+// SignatureAlgorithm identifies how deletion reports are signed
+const SignatureAlgorithm = "HMAC-SHA256"
+
+// ErrSigningKeyMissing is returned when PURGE_REPORT_SIGNING_KEY is not set. Purges are refused
+// rather than run without a verifiable report.
+var ErrSigningKeyMissing = errors.New("PURGE_REPORT_SIGNING_KEY is not set")
+
+// PurgedItem records what happened to one kind of tenant data
+type PurgedItem struct {
+	Dataset string `json:"dataset"`
+	Action  string `json:"action"`
+	Count   int64  `json:"count"`
+}
+
+// DeletionReport is the signed record of a tenant purge
+type DeletionReport struct {
+	ReportID    string       `json:"reportId"`
+	TenantID    string       `json:"tenantId"`
+	StartedAt   time.Time    `json:"startedAt"`
+	CompletedAt time.Time    `json:"completedAt"`
+	Items       []PurgedItem `json:"items"`
+}
+
+// SignedDeletionReport pairs a deletion report with a signature over its JSON encoding
+type SignedDeletionReport struct {
+	Report    DeletionReport `json:"report"`
+	Algorithm string         `json:"algorithm"`
+	Signature string         `json:"signature"`
+}
+
+// purgeTargets are deleted outright. Jobs are removed for every type, not just inventory snapshots,
+// because job payloads and results also hold tenant data.
+var purgeTargets = []Dataset{
+	{Name: "findings", Collection: config.CollectionFindings, TenantField: "tenantId"},
+	{Name: "exclusions", Collection: config.CollectionExclusions, TenantField: "tenantId"},
+	{Name: "events", Collection: config.CollectionEvents, TenantField: "tenantId"},
+	{Name: "dead_letters", Collection: config.CollectionDeadLetters, TenantField: "tenantId"},
+	{Name: "delivery_buffer", Collection: config.CollectionDeliveryBuffer, TenantField: "tenantId"},
+	{Name: "jobs_and_inventory", Collection: config.CollectionJobs, TenantField: "tenantId"},
+	{Name: "schedules", Collection: config.CollectionSchedules, TenantField: "tenantId"},
+	{Name: "retention_policies", Collection: config.CollectionRetention, TenantField: "tenantId"},
+	{Name: "event_subscriptions", Collection: config.CollectionEventSubscriptions, TenantField: "tenantId"},
+	{Name: "notification_targets", Collection: config.CollectionNotificationTargets, TenantField: "tenantId"},
+	{Name: "saved_views", Collection: config.CollectionSavedViews, TenantField: "tenantId"},
+	{Name: "account_config", Collection: config.CollectionAccountConfig, TenantField: "tenantId"},
+	{Name: "access_key_rotations", Collection: config.CollectionKeyRotations, TenantField: "tenantId"},
+	{Name: "remediations", Collection: config.CollectionRemediations, TenantField: "tenantId"},
+	{Name: "remediation_audit", Collection: config.CollectionRemediationAudit, TenantField: "tenantId"},
+	{Name: "playbooks", Collection: config.CollectionPlaybooks, TenantField: "tenantId"},
+	{Name: "guardrails", Collection: config.CollectionGuardrails, TenantField: "tenantId"},
+	{Name: "webhooks", Collection: config.CollectionWebhooks, TenantField: "tenantId"},
+	{Name: "ticketing_settings", Collection: config.CollectionTicketingSettings, TenantField: "tenantId"},
+	{Name: "tickets", Collection: config.CollectionTickets, TenantField: "tenantId"},
+	{Name: "notifiers", Collection: config.CollectionNotifiers, TenantField: "tenantId"},
+	{Name: "org_onboardings", Collection: config.CollectionOrgOnboardings, TenantField: "tenantId"},
+	{Name: "resource_history", Collection: config.CollectionResourceHistory, TenantField: "tenantId"},
+	{Name: "tag_policies", Collection: config.CollectionTagPolicies, TenantField: "tenantId"},
+	{Name: "tenants", Collection: config.CollectionTenants, TenantField: "tenantId"},
+}
+
+// Purge deletes all of the tenant's stored data and cached values, anonymizes its audit log
+// entries and returns a signed report of what was removed
+func Purge(ctx context.Context, db *mongo.Database, tenantID string) (*SignedDeletionReport, error) {
+	key := os.Getenv("PURGE_REPORT_SIGNING_KEY")
+	if key == "" {
+		return nil, ErrSigningKeyMissing
+	}
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID is required")
+	}
+
+	report := DeletionReport{
+		ReportID:  uuid.New().String(),
+		TenantID:  tenantID,
+		StartedAt: time.Now().UTC(),
+		Items:     []PurgedItem{},
+	}
+
+	for _, target := range purgeTargets {
+		result, err := db.Collection(target.Collection).DeleteMany(ctx, target.TenantFilter(tenantID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge %s: %w", target.Name, err)
+		}
+		report.Items = append(report.Items, PurgedItem{Dataset: target.Name, Action: ActionDeleted, Count: result.DeletedCount})
+	}
+
+	// Audit entries are kept as a record of activity but no longer identify the tenant or its users
+	result, err := db.Collection(config.CollectionAuditLogs).UpdateMany(ctx,
+		bson.M{"tenantId": tenantID},
+		bson.M{
+			"$set":   bson.M{"tenantId": pseudonym(key, tenantID)},
+			"$unset": bson.M{"clientIp": "", "userAgent": ""},
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to anonymize audit logs: %w", err)
+	}
+	report.Items = append(report.Items, PurgedItem{Dataset: "audit_logs", Action: ActionAnonymized, Count: result.ModifiedCount})
+
+	// GitHub tokens, other integration credentials and webhook signing secrets live in the
+	// secret store
+	credentials := PurgedItem{Dataset: "integration_credentials", Action: ActionNotStored}
+	if store := secrets.Default(); store != nil {
+		credentials.Action = ActionDeleted
+		for _, integration := range secrets.TenantSecrets() {
+			err := store.Delete(ctx, secrets.TenantName(tenantID, integration))
+			if errors.Is(err, secrets.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to purge %s credentials: %w", integration, err)
+			}
+			credentials.Count++
+		}
+	}
+	report.Items = append(report.Items, credentials)
+
+	// Cached findings and inventory would otherwise be served until they expire
+	cache.InvalidateTenant(ctx, tenantID)
+
+	report.CompletedAt = time.Now().UTC()
+	signed, err := signReport(key, report)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Purge] ✅ Purged tenant %s (report %s)", tenantID, report.ReportID)
+	return signed, nil
+}
+
+// VerifyReport reports whether the signature matches the report under the configured signing key
+func VerifyReport(signed *SignedDeletionReport) (bool, error) {
+	key := os.Getenv("PURGE_REPORT_SIGNING_KEY")
+	if key == "" {
+		return false, ErrSigningKeyMissing
+	}
+	expected, err := signReport(key, signed.Report)
+	if err != nil {
+		return false, err
+	}
+	return signed.Algorithm == SignatureAlgorithm && hmac.Equal([]byte(expected.Signature), []byte(signed.Signature)), nil
+}
+
+func signReport(key string, report DeletionReport) (*SignedDeletionReport, error) {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode deletion report: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return &SignedDeletionReport{
+		Report:    report,
+		Algorithm: SignatureAlgorithm,
+		Signature: hex.EncodeToString(mac.Sum(nil)),
+	}, nil
+}
+
+// pseudonym replaces a tenant ID with a keyed hash so anonymized records cannot be linked back to it
+func pseudonym(key, tenantID string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(tenantID))
+	return "purged-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,81 @@
+package tenantdata
+
+import (
+	"testing"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"github.com/rishichirchi/cloudloom/services/events"
+)
+
+func TestPurgeTargetsCoverTenantData(t *testing.T) {
+	purged := map[string]bool{}
+	for _, target := range purgeTargets {
+		if purged[target.Collection] {
+			t.Errorf("%s is purged twice", target.Collection)
+		}
+		purged[target.Collection] = true
+		if len(target.Filter) > 0 {
+			t.Errorf("%s purge is narrowed by %v; every tenant document must be deleted", target.Name, target.Filter)
+		}
+	}
+
+	// Every collection and whether Purge deletes the tenant's documents from it. The others
+	// are handled apart from purgeTargets or hold no tenant data.
+	tests := []struct {
+		collection string
+		deleted    bool
+	}{
+		{config.CollectionJobs, true},
+		{config.CollectionSchedules, true},
+		{config.CollectionDeliveryBuffer, true},
+		{config.CollectionEvents, true},
+		{events.ProcessedCollection, false}, // SQS message IDs only
+		{config.CollectionFindings, true},
+		{config.CollectionExclusions, true},
+		{config.CollectionAuditLogs, false}, // anonymized
+		{config.CollectionRemediationAudit, true},
+		{config.CollectionRetention, true},
+		{config.CollectionSecrets, false}, // deleted through the secret store
+		{config.CollectionSavedViews, true},
+		{config.CollectionAccountConfig, true},
+		{config.CollectionKeyRotations, true},
+		{config.CollectionRemediations, true},
+		{config.CollectionTenants, true},
+		{config.CollectionOrgOnboardings, true},
+		{config.CollectionResourceHistory, true},
+		{config.CollectionTagPolicies, true},
+		{config.CollectionCacheEntries, false}, // invalidated through the cache
+		{config.CollectionDeadLetters, true},
+		{config.CollectionEventSubscriptions, true},
+		{config.CollectionNotificationTargets, true},
+		{config.CollectionPlaybooks, true},
+		{config.CollectionGuardrails, true},
+		{config.CollectionWebhooks, true},
+		{config.CollectionTicketingSettings, true},
+		{config.CollectionTickets, true},
+		{config.CollectionNotifiers, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			if purged[tt.collection] != tt.deleted {
+				t.Errorf("%s purged = %v, want %v", tt.collection, purged[tt.collection], tt.deleted)
+			}
+			delete(purged, tt.collection)
+		})
+	}
+	for collection := range purged {
+		t.Errorf("%s is purged but missing from this test", collection)
+	}
+}
+
+func TestPurgeTargetsCoverExportedDatasets(t *testing.T) {
+	purged := map[string]bool{config.CollectionAuditLogs: true}
+	for _, target := range purgeTargets {
+		purged[target.Collection] = true
+	}
+	for _, d := range Datasets() {
+		if !purged[d.Collection] {
+			t.Errorf("dataset %s is exported but not purged", d.Name)
+		}
+	}
+}
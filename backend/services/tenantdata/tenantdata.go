@@ -0,0 +1,119 @@
+package tenantdata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dataset describes a tenant-scoped MongoDB collection that exports, retention and purges operate on
+type Dataset struct {
+	Name        string
+	Collection  string
+	TenantField string
+	// TimeField is the document timestamp used for ordering and age-based policies
+	TimeField string
+	// Filter narrows the collection further, e.g. to one job type
+	Filter bson.M
+}
+
+// TenantFilter returns the query selecting the tenant's documents in the dataset
+func (d Dataset) TenantFilter(tenantID string) bson.M {
+	filter := bson.M{d.TenantField: tenantID}
+	for k, v := range d.Filter {
+		filter[k] = v
+	}
+	return filter
+}
+
+// OlderThan returns the query selecting the tenant's documents whose timestamp is before cutoff
+func (d Dataset) OlderThan(tenantID string, cutoff time.Time) bson.M {
+	filter := d.TenantFilter(tenantID)
+	filter[d.TimeField] = bson.M{"$lt": cutoff}
+	return filter
+}
+
+var datasets = []Dataset{
+	{Name: "findings", Collection: config.CollectionFindings, TenantField: "tenantId", TimeField: "lastSeenAt"},
+	{Name: "exclusions", Collection: config.CollectionExclusions, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "inventory_snapshots", Collection: config.CollectionJobs, TenantField: "tenantId", TimeField: "finishedAt",
+		Filter: bson.M{"type": "inventory_scan", "status": "succeeded"}},
+	{Name: "events", Collection: config.CollectionEvents, TenantField: "tenantId", TimeField: "eventTime"},
+	{Name: "dead_letters", Collection: config.CollectionDeadLetters, TenantField: "tenantId", TimeField: "deadLetteredAt"},
+	{Name: "audit_logs", Collection: config.CollectionAuditLogs, TenantField: "tenantId", TimeField: "timestamp"},
+	{Name: "remediation_audit", Collection: config.CollectionRemediationAudit, TenantField: "tenantId", TimeField: "occurredAt"},
+	{Name: "schedules", Collection: config.CollectionSchedules, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "retention_policies", Collection: config.CollectionRetention, TenantField: "tenantId", TimeField: "updatedAt"},
+	{Name: "event_subscriptions", Collection: config.CollectionEventSubscriptions, TenantField: "tenantId", TimeField: "updatedAt"},
+	{Name: "notification_targets", Collection: config.CollectionNotificationTargets, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "saved_views", Collection: config.CollectionSavedViews, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "account_config", Collection: config.CollectionAccountConfig, TenantField: "tenantId", TimeField: "appliedAt"},
+	{Name: "access_key_rotations", Collection: config.CollectionKeyRotations, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "remediations", Collection: config.CollectionRemediations, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "playbooks", Collection: config.CollectionPlaybooks, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "guardrails", Collection: config.CollectionGuardrails, TenantField: "tenantId", TimeField: "updatedAt"},
+	{Name: "webhooks", Collection: config.CollectionWebhooks, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "ticketing_settings", Collection: config.CollectionTicketingSettings, TenantField: "tenantId", TimeField: "updatedAt"},
+	{Name: "tickets", Collection: config.CollectionTickets, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "notifiers", Collection: config.CollectionNotifiers, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "org_onboardings", Collection: config.CollectionOrgOnboardings, TenantField: "tenantId", TimeField: "createdAt"},
+	{Name: "resource_history", Collection: config.CollectionResourceHistory, TenantField: "tenantId", TimeField: "capturedAt"},
+	{Name: "tag_policies", Collection: config.CollectionTagPolicies, TenantField: "tenantId", TimeField: "updatedAt"},
+}
+
+// Datasets returns every tenant-scoped dataset
+func Datasets() []Dataset {
+	return append([]Dataset(nil), datasets...)
+}
+
+// Lookup returns the datasets with the given names, or all datasets if names is empty
+func Lookup(names []string) ([]Dataset, bool) {
+	if len(names) == 0 {
+		return Datasets(), true
+	}
+	byName := make(map[string]Dataset, len(datasets))
+	for _, d := range datasets {
+		byName[d.Name] = d
+	}
+	result := make([]Dataset, 0, len(names))
+	for _, name := range names {
+		d, ok := byName[name]
+		if !ok {
+			return nil, false
+		}
+		result = append(result, d)
+	}
+	return result, true
+}
+
+// Tenants returns every tenant ID that has data in at least one dataset
+func Tenants(ctx context.Context, db *mongo.Database) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, d := range datasets {
+		filter := bson.M{}
+		for k, v := range d.Filter {
+			filter[k] = v
+		}
+		values, err := db.Collection(d.Collection).Distinct(ctx, d.TenantField, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tenants in %s: %w", d.Name, err)
+		}
+		for _, v := range values {
+			if tenantID, ok := v.(string); ok && tenantID != "" {
+				seen[tenantID] = true
+			}
+		}
+	}
+
+	tenants := make([]string, 0, len(seen))
+	for tenantID := range seen {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
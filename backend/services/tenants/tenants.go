@@ -0,0 +1,402 @@
+package tenants
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionTenants
+
+// DefaultRegion is the home region used for a tenant that does not name one
+const DefaultRegion = "ap-south-1"
+
+// staleSetupAfter is how long an in-progress setup may go without finishing before another
+// setup of the account is allowed, e.g. after the server restarted mid-setup
+const staleSetupAfter = time.Hour
+
+var (
+	// ErrNotFound is returned when an account has never been onboarded
+	ErrNotFound = errors.New("tenant not found")
+	// ErrInvalid is returned when a tenant is missing its account ID or role ARN
+	ErrInvalid = errors.New("invalid tenant")
+	// ErrSetupInProgress is returned when setup is started for an account that is already being set up
+	ErrSetupInProgress = errors.New("setup is already in progress for this account")
+)
+
+// Status is where a tenant's account setup stands
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusInProgress Status = "in_progress"
+	StatusCompleted  Status = "completed"
+	StatusFailed     Status = "failed"
+	// StatusRemoved means teardown removed everything setup created in the account
+	StatusRemoved Status = "removed"
+)
+
+// AccessTier is how much CloudLoom may do in an account, matching the CloudFormation template
+// the customer deployed its role with. Each tier includes everything the tier before it does.
+type AccessTier string
+
+const (
+	// TierNotification records the account's API calls and publishes them to an SNS topic
+	TierNotification AccessTier = "CloudLoomNotificationTier"
+	// TierSuggestFix also queues the calls for CloudLoom to analyze and suggest fixes
+	TierSuggestFix AccessTier = "CloudLoomSuggestFixTier"
+	// TierAutoApplyFix also lets CloudLoom apply fixes in the account
+	TierAutoApplyFix AccessTier = "CloudLoomAutoApplyFixTier"
+)
+
+// Analyzes reports whether CloudLoom consumes the account's events to suggest fixes
+func (t AccessTier) Analyzes() bool {
+	return t == TierSuggestFix || t == TierAutoApplyFix
+}
+
+// AppliesFixes reports whether CloudLoom may change the account to fix what it finds
+func (t AccessTier) AppliesFixes() bool {
+	return t == TierAutoApplyFix
+}
+
+// TrailEvents are the optional events the account's trail records
+type TrailEvents struct {
+	// S3DataEvents records object-level S3 API calls, other than those on the log bucket
+	S3DataEvents bool `bson:"s3DataEvents,omitempty" json:"s3DataEvents,omitempty"`
+	// LambdaDataEvents records Lambda function invocations
+	LambdaDataEvents bool `bson:"lambdaDataEvents,omitempty" json:"lambdaDataEvents,omitempty"`
+	// Insights records unusual API call volumes and error rates
+	Insights bool `bson:"insights,omitempty" json:"insights,omitempty"`
+}
+
+// SetupCheckpoint is how far the tenant's last unfinished setup got, so the next setup can
+// resume from the step that failed
+type SetupCheckpoint struct {
+	// Fingerprint is the SetupFingerprint of the tenant the steps were completed for
+	Fingerprint string `bson:"fingerprint" json:"fingerprint"`
+	// Outputs maps each completed step to what later steps need from it, such as an ARN
+	Outputs   map[string]string `bson:"outputs" json:"outputs"`
+	UpdatedAt time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Tenant is an onboarded customer AWS account and the role CloudLoom assumes into it
+type Tenant struct {
+	AccountID  string `bson:"tenantId" json:"accountId"`
+	RoleArn    string `bson:"roleArn" json:"roleArn"`
+	ExternalID string `bson:"externalId" json:"externalId"`
+	Region     string `bson:"region" json:"region"`
+	// Regions are where account events are collected; empty means the home region and us-east-1
+	Regions []string `bson:"regions,omitempty" json:"regions,omitempty"`
+	// AllRegions collects events from every region enabled in the account. Setup resolves them
+	// into Regions each time it runs, so regions enabled later are picked up.
+	AllRegions bool `bson:"allRegions,omitempty" json:"allRegions,omitempty"`
+	// KMSKeyArn is a customer managed key to encrypt the log bucket and trail with. Without
+	// one, CreateKMSKey has setup create a key; otherwise logs use S3-managed encryption.
+	KMSKeyArn    string `bson:"kmsKeyArn,omitempty" json:"kmsKeyArn,omitempty"`
+	CreateKMSKey bool   `bson:"createKmsKey,omitempty" json:"createKmsKey,omitempty"`
+	// LogRetentionDays is how long CloudTrail and AWS Config logs are kept in the account;
+	// zero keeps them indefinitely
+	LogRetentionDays int `bson:"logRetentionDays,omitempty" json:"logRetentionDays,omitempty"`
+	// ReplicationRegion is where the log bucket is replicated to for disaster recovery; empty
+	// means it is not replicated
+	ReplicationRegion string `bson:"replicationRegion,omitempty" json:"replicationRegion,omitempty"`
+	// ExistingTrailArn and ExistingBucketName are a trail and log bucket the customer already
+	// has, such as an organization trail, which setup reuses instead of creating its own
+	ExistingTrailArn   string `bson:"existingTrailArn,omitempty" json:"existingTrailArn,omitempty"`
+	ExistingBucketName string `bson:"existingBucketName,omitempty" json:"existingBucketName,omitempty"`
+	// TrailEvents are what the trail records besides management events
+	TrailEvents TrailEvents `bson:"trailEvents" json:"trailEvents"`
+	// NotificationEndpoints are the email addresses and HTTPS URLs subscribed to the account's
+	// notification topic
+	NotificationEndpoints []string `bson:"notificationEndpoints,omitempty" json:"notificationEndpoints,omitempty"`
+	// FifoQueue queues the account's events on a FIFO queue, processed in order within each
+	// region, instead of a standard queue
+	FifoQueue bool `bson:"fifoQueue,omitempty" json:"fifoQueue,omitempty"`
+	// AccessTier is empty for tenants onboarded before tiers, which were set up for auto-apply fix
+	AccessTier AccessTier `bson:"accessTier,omitempty" json:"accessTier,omitempty"`
+	// SetupStatus and SetupError describe the last account setup run
+	SetupStatus     Status     `bson:"setupStatus" json:"setupStatus"`
+	SetupError      string     `bson:"setupError,omitempty" json:"setupError,omitempty"`
+	SetupFinishedAt *time.Time `bson:"setupFinishedAt,omitempty" json:"setupFinishedAt,omitempty"`
+	// SetupCheckpoint is set while a setup has completed some steps but not all of them
+	SetupCheckpoint *SetupCheckpoint `bson:"setupCheckpoint,omitempty" json:"setupCheckpoint,omitempty"`
+	CreatedAt       time.Time        `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time        `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SetupActive reports whether the tenant's setup is still running. A setup that has not
+// reported for staleSetupAfter is presumed dead.
+func (t *Tenant) SetupActive() bool {
+	return t.SetupStatus == StatusInProgress && time.Since(t.UpdatedAt) < staleSetupAfter
+}
+
+// Tier returns the tenant's access tier
+func (t *Tenant) Tier() AccessTier {
+	if t.AccessTier == "" {
+		return TierAutoApplyFix
+	}
+	return t.AccessTier
+}
+
+// SetupFingerprint identifies the setup options the tenant was set up with. A checkpoint
+// left by a setup with other options is not resumed, since its steps would differ.
+func (t *Tenant) SetupFingerprint() string {
+	options, _ := json.Marshal([]interface{}{
+		t.RoleArn, t.Region, t.Regions, t.KMSKeyArn, t.CreateKMSKey, t.LogRetentionDays,
+		t.ReplicationRegion, t.ExistingTrailArn, t.ExistingBucketName, t.TrailEvents, t.Tier(),
+		t.NotificationEndpoints, t.FifoQueue,
+	})
+	sum := sha256.Sum256(options)
+	return hex.EncodeToString(sum[:])
+}
+
+// AccountFromRoleARN returns the account ID of a role ARN such as
+// arn:aws:iam::123456789012:role/CloudLoomAutoApplyFixRole, or "" if it is not an ARN
+func AccountFromRoleARN(roleArn string) string {
+	parts := strings.Split(roleArn, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// Manager persists per-account onboarding state in MongoDB, so any number of customer
+// accounts can be onboarded and operated on at once
+type Manager struct {
+	collection *mongo.Collection
+}
+
+var defaultManager *Manager
+
+// Init creates the process-wide tenant manager backed by the given database
+func Init(db *mongo.Database) *Manager {
+	defaultManager = NewManager(db)
+	return defaultManager
+}
+
+// Default returns the process-wide tenant manager created by Init
+func Default() *Manager {
+	return defaultManager
+}
+
+// NewManager creates a Manager using the tenants collection
+func NewManager(db *mongo.Database) *Manager {
+	return &Manager{collection: db.Collection(collectionName)}
+}
+
+// Register creates the tenant or updates its role, external ID, regions, log settings, log
+// replication, existing trail and bucket, trail events, notification endpoints, access tier
+// and queue type, leaving its setup status alone. A new tenant starts out pending.
+func (m *Manager) Register(ctx context.Context, tenant *Tenant) error {
+	if tenant.AccountID == "" || tenant.RoleArn == "" {
+		return fmt.Errorf("%w: account ID and role ARN are required", ErrInvalid)
+	}
+	if tenant.Region == "" {
+		tenant.Region = DefaultRegion
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"roleArn":               tenant.RoleArn,
+			"externalId":            tenant.ExternalID,
+			"region":                tenant.Region,
+			"regions":               tenant.Regions,
+			"allRegions":            tenant.AllRegions,
+			"kmsKeyArn":             tenant.KMSKeyArn,
+			"createKmsKey":          tenant.CreateKMSKey,
+			"logRetentionDays":      tenant.LogRetentionDays,
+			"replicationRegion":     tenant.ReplicationRegion,
+			"existingTrailArn":      tenant.ExistingTrailArn,
+			"existingBucketName":    tenant.ExistingBucketName,
+			"trailEvents":           tenant.TrailEvents,
+			"accessTier":            tenant.AccessTier,
+			"notificationEndpoints": tenant.NotificationEndpoints,
+			"fifoQueue":             tenant.FifoQueue,
+			"updatedAt":             now,
+		},
+		"$setOnInsert": bson.M{"setupStatus": StatusPending, "createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := m.collection.FindOneAndUpdate(ctx, bson.M{"tenantId": tenant.AccountID}, update, opts).Decode(tenant)
+	if err != nil {
+		return fmt.Errorf("failed to register tenant: %w", err)
+	}
+	return nil
+}
+
+// Get returns the tenant for an account ID
+func (m *Manager) Get(ctx context.Context, accountID string) (*Tenant, error) {
+	var tenant Tenant
+	err := m.collection.FindOne(ctx, bson.M{"tenantId": accountID}).Decode(&tenant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant: %w", err)
+	}
+	return &tenant, nil
+}
+
+// List returns every onboarded tenant, oldest first
+func (m *Manager) List(ctx context.Context) ([]Tenant, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	result := []Tenant{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode tenants: %w", err)
+	}
+	return result, nil
+}
+
+// BeginSetup marks the tenant's setup as in progress. It fails with ErrSetupInProgress when
+// another setup of the same account has not finished, so one account is never set up twice
+// at once while different accounts proceed independently.
+func (m *Manager) BeginSetup(ctx context.Context, accountID string) error {
+	now := time.Now()
+	filter := bson.M{"tenantId": accountID, "$or": bson.A{
+		bson.M{"setupStatus": bson.M{"$ne": StatusInProgress}},
+		bson.M{"updatedAt": bson.M{"$lt": now.Add(-staleSetupAfter)}},
+	}}
+	update := bson.M{
+		"$set":   bson.M{"setupStatus": StatusInProgress, "updatedAt": now},
+		"$unset": bson.M{"setupError": "", "setupFinishedAt": ""},
+	}
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		if _, err := m.Get(ctx, accountID); err != nil {
+			return err
+		}
+		return ErrSetupInProgress
+	}
+	return nil
+}
+
+// FinishSetup records the outcome of the tenant's setup; a nil setupErr means it completed
+func (m *Manager) FinishSetup(ctx context.Context, accountID string, setupErr error) error {
+	now := time.Now()
+	set := bson.M{"setupStatus": StatusCompleted, "setupFinishedAt": now, "updatedAt": now}
+	update := bson.M{"$set": set, "$unset": bson.M{"setupCheckpoint": ""}}
+	if setupErr != nil {
+		// Keep the checkpoint so the next setup resumes where this one failed
+		set["setupStatus"] = StatusFailed
+		set["setupError"] = setupErr.Error()
+		delete(update, "$unset")
+	}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveCheckpoint records that setup completed step with the given output. A checkpoint left
+// by a setup with a different fingerprint is replaced rather than added to.
+func (m *Manager) SaveCheckpoint(ctx context.Context, accountID, fingerprint, step, output string) error {
+	now := time.Now()
+	filter := bson.M{"tenantId": accountID, "setupCheckpoint.fingerprint": fingerprint}
+	update := bson.M{"$set": bson.M{"setupCheckpoint.outputs." + step: output, "setupCheckpoint.updatedAt": now}}
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to save setup checkpoint: %w", err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	checkpoint := SetupCheckpoint{Fingerprint: fingerprint, Outputs: map[string]string{step: output}, UpdatedAt: now}
+	result, err = m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, bson.M{"$set": bson.M{"setupCheckpoint": checkpoint}})
+	if err != nil {
+		return fmt.Errorf("failed to save setup checkpoint: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClearCheckpoint discards the tenant's setup checkpoint, so its next setup runs every step
+func (m *Manager) ClearCheckpoint(ctx context.Context, accountID string) error {
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, bson.M{"$unset": bson.M{"setupCheckpoint": ""}})
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetLogRetention records how long the account's CloudTrail and AWS Config logs are kept
+func (m *Manager) SetLogRetention(ctx context.Context, accountID string, days int) error {
+	update := bson.M{"$set": bson.M{"logRetentionDays": days, "updatedAt": time.Now()}}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetRegions records the regions the account's events are collected from, and whether they
+// are every region enabled in the account
+func (m *Manager) SetRegions(ctx context.Context, accountID string, regions []string, all bool) error {
+	update := bson.M{"$set": bson.M{"regions": regions, "allRegions": all, "updatedAt": time.Now()}}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetNotificationEndpoints records the endpoints subscribed to the account's notification topic
+func (m *Manager) SetNotificationEndpoints(ctx context.Context, accountID string, endpoints []string) error {
+	update := bson.M{"$set": bson.M{"notificationEndpoints": endpoints, "updatedAt": time.Now()}}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkRemoved records that the resources setup created in the account have been torn down
+func (m *Manager) MarkRemoved(ctx context.Context, accountID string) error {
+	update := bson.M{
+		"$set":   bson.M{"setupStatus": StatusRemoved, "updatedAt": time.Now()},
+		"$unset": bson.M{"setupError": "", "setupFinishedAt": "", "setupCheckpoint": ""},
+	}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"tenantId": accountID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
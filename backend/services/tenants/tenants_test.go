@@ -0,0 +1,25 @@
+package tenants
+
+import "testing"
+
+func TestAccountFromRoleARN(t *testing.T) {
+	tests := []struct {
+		roleArn string
+		want    string
+	}{
+		{"arn:aws:iam::123456789012:role/CloudLoomAutoApplyFixRole", "123456789012"},
+		{"arn:aws:iam::123456789012:role/path/to/Role", "123456789012"},
+		{"arn:aws-us-gov:iam::123456789012:role/Role", "123456789012"},
+		{"arn:aws:iam::123456789012", ""},
+		{"aws:iam::123456789012:role/Role:x", ""},
+		{"123456789012", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.roleArn, func(t *testing.T) {
+			if got := AccountFromRoleARN(tt.roleArn); got != tt.want {
+				t.Errorf("AccountFromRoleARN(%q) = %q, want %q", tt.roleArn, got, tt.want)
+			}
+		})
+	}
+}
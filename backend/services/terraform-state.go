@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TerraformStatePath is where the infrastructure-as-code state for the account is read from
+const TerraformStatePath = "infra/iac/terraform.tfstate"
+
+// TerraformMapping links a deployed resource to the Terraform resource that manages it
+type TerraformMapping struct {
+	Address string `json:"address"`
+	Module  string `json:"module,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+}
+
+type terraformState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// LoadTerraformMappings reads a Terraform state file and indexes its managed resources by
+// the IDs AWS reports for them (id, arn and name attributes)
+func LoadTerraformMappings(path string) (map[string]TerraformMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terraform state: %w", err)
+	}
+	var state terraformState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse terraform state: %w", err)
+	}
+
+	mappings := make(map[string]TerraformMapping)
+	for _, resource := range state.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			address := resource.Type + "." + resource.Name
+			if resource.Module != "" {
+				address = resource.Module + "." + address
+			}
+			if instance.IndexKey != nil {
+				key, _ := json.Marshal(instance.IndexKey)
+				address = fmt.Sprintf("%s[%s]", address, key)
+			}
+
+			mapping := TerraformMapping{Address: address, Module: resource.Module, Type: resource.Type, Name: resource.Name}
+			for _, attr := range []string{"id", "arn", "name"} {
+				if v, ok := instance.Attributes[attr].(string); ok && v != "" {
+					if _, taken := mappings[v]; !taken {
+						mappings[v] = mapping
+					}
+				}
+			}
+		}
+	}
+	return mappings, nil
+}
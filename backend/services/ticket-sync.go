@@ -0,0 +1,582 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/findings"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+	"github.com/rishichirchi/cloudloom/services/ticketing"
+)
+
+// JobTypeTicketSync raises tickets for the tenant's new findings and reconciles the state of
+// the tickets already raised with their findings, both ways
+const JobTypeTicketSync = "ticket_sync"
+
+// ticketingTimeout bounds one request to Jira or ServiceNow
+const ticketingTimeout = 15 * time.Second
+
+// staleReservation is how long a ticket may stay reserved without having been raised before
+// a sync assumes the one that reserved it died and releases it
+const staleReservation = 10 * time.Minute
+
+// ticketingClient only connects to public addresses, wherever the tenant's Jira or ServiceNow
+// name resolves to
+var ticketingClient = common.PublicHTTPClient(ticketingTimeout)
+
+// ErrTicketingUnavailable is returned when the ticketing store or the secret store holding
+// the provider credentials is not configured
+var ErrTicketingUnavailable = errors.New("ticketing is not available")
+
+// ticketProvider raises, inspects and closes tickets in Jira or ServiceNow
+type ticketProvider interface {
+	// Name is how the provider is shown to people
+	Name() string
+	// Raise creates a ticket for the finding, setting its key, number and URL
+	Raise(ctx context.Context, finding *findings.Finding, ticket *ticketing.Ticket) error
+	// Closed reports whether the ticket has been closed in the provider
+	Closed(ctx context.Context, ticket *ticketing.Ticket) (bool, error)
+	// Close closes the ticket, leaving reason on it
+	Close(ctx context.Context, ticket *ticketing.Ticket, reason string) error
+}
+
+// TicketSyncResult counts what one sync did
+type TicketSyncResult struct {
+	Raised           int `json:"raised"`
+	Closed           int `json:"closed"`
+	FindingsResolved int `json:"findingsResolved"`
+}
+
+// GetTicketingSettings returns the tenant's ticketing settings
+func GetTicketingSettings(ctx context.Context, tenantID string) (*ticketing.Settings, error) {
+	store := ticketing.Default()
+	if store == nil {
+		return nil, ErrTicketingUnavailable
+	}
+	return store.GetSettings(ctx, tenantID)
+}
+
+// PutTicketingSettings stores the tenant's ticketing settings and, when ticketing is enabled,
+// queues a sync so findings above the threshold are ticketed right away. The provider's
+// credentials must already be stored.
+func PutTicketingSettings(ctx context.Context, tenantID string, settings *ticketing.Settings) (*ticketing.Settings, *jobs.Job, error) {
+	store, secretStore := ticketing.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, nil, ErrTicketingUnavailable
+	}
+	settings.TenantID = tenantID
+	if err := settings.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := ticketProviderFor(ctx, secretStore, settings); err != nil {
+		return nil, nil, err
+	}
+	if err := store.PutSettings(ctx, settings); err != nil {
+		return nil, nil, err
+	}
+
+	saved, err := store.GetSettings(ctx, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !saved.Enabled {
+		return saved, nil, nil
+	}
+	job, err := jobs.Default().Enqueue(ctx, JobTypeTicketSync, tenantID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return saved, job, nil
+}
+
+// DeleteTicketingSettings stops ticketing the tenant's findings. Open tickets are left as they
+// are in the provider.
+func DeleteTicketingSettings(ctx context.Context, tenantID string) error {
+	store := ticketing.Default()
+	if store == nil {
+		return ErrTicketingUnavailable
+	}
+	return store.DeleteSettings(ctx, tenantID)
+}
+
+// ListTickets returns the tickets raised for the tenant's findings, newest first
+func ListTickets(ctx context.Context, filter ticketing.ListFilter) ([]ticketing.Ticket, error) {
+	store := ticketing.Default()
+	if store == nil {
+		return nil, ErrTicketingUnavailable
+	}
+	return store.List(ctx, filter)
+}
+
+// SyncTickets queues a ticket sync for the tenant
+func SyncTickets(ctx context.Context, tenantID string) (*jobs.Job, error) {
+	settings, err := GetTicketingSettings(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, fmt.Errorf("%w: ticketing is disabled", ticketing.ErrInvalid)
+	}
+	return jobs.Default().Enqueue(ctx, JobTypeTicketSync, tenantID, nil)
+}
+
+// StartTicketSyncSchedule enqueues a ticket sync for every tenant with ticketing enabled every
+// interval until ctx is cancelled
+func StartTicketSyncSchedule(ctx context.Context, m *jobs.Manager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store := ticketing.Default()
+			if store == nil || DemoModeEnabled() {
+				continue
+			}
+			tenants, err := store.EnabledTenants(ctx)
+			if err != nil {
+				log.Printf("[Ticketing] Warning: %v", err)
+				continue
+			}
+			for _, tenantID := range tenants {
+				if _, err := m.Enqueue(ctx, JobTypeTicketSync, tenantID, nil); err != nil {
+					log.Printf("[Ticketing] Warning: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// runTicketSyncJob closes the tickets of findings that were resolved, suppressed or deleted,
+// resolves the findings whose tickets were closed in the provider, then raises tickets for open
+// findings at or above the tenant's severity threshold that have none. A failure on one ticket
+// does not stop the others; the job fails with all of them once the rest are done.
+func runTicketSyncJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	store, findingStore, secretStore := ticketing.Default(), findings.Default(), secrets.Default()
+	if store == nil || findingStore == nil || secretStore == nil {
+		return nil, ErrTicketingUnavailable
+	}
+	settings, err := store.GetSettings(ctx, job.TenantID)
+	if errors.Is(err, ticketing.ErrNotFound) {
+		return map[string]interface{}{"skipped": true, "reason": "ticketing is not configured"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return map[string]interface{}{"skipped": true, "reason": "ticketing is disabled"}, nil
+	}
+	provider, err := ticketProviderFor(ctx, secretStore, settings)
+	if err != nil {
+		if recordErr := store.RecordSync(ctx, job.TenantID, time.Now(), err); recordErr != nil {
+			log.Printf("[Ticketing] Warning: %v", recordErr)
+		}
+		return nil, jobs.Permanent(err)
+	}
+
+	result := &TicketSyncResult{}
+	var failures []error
+	fail := func(err error) {
+		failures = append(failures, err)
+	}
+
+	open, err := store.List(ctx, ticketing.ListFilter{TenantID: job.TenantID, State: ticketing.StateOpen})
+	if err != nil {
+		return nil, err
+	}
+	ticketed := make(map[string]bool, len(open))
+	for i := range open {
+		ticket := &open[i]
+		if ticket.Provider != settings.Provider {
+			// Tickets raised before the tenant switched provider are left to people
+			ticketed[ticket.FindingID] = true
+			continue
+		}
+		if ticket.Key == "" {
+			if time.Since(ticket.CreatedAt) > staleReservation {
+				if err := store.Release(ctx, ticket); err != nil {
+					fail(err)
+				}
+			} else {
+				ticketed[ticket.FindingID] = true
+			}
+			continue
+		}
+		ticketed[ticket.FindingID] = true
+		if err := reconcileTicket(ctx, store, findingStore, provider, ticket, result); err != nil {
+			fail(fmt.Errorf("ticket %s: %w", ticket.Number, err))
+		}
+	}
+
+	for _, status := range []findings.Status{findings.StatusOpen, findings.StatusAcknowledged} {
+		for _, severity := range ticketing.SeveritiesFrom(settings.MinSeverity) {
+			candidates, err := findingStore.List(ctx, findings.ListFilter{TenantID: job.TenantID, Status: status, Severity: severity, Limit: 500})
+			if err != nil {
+				fail(err)
+				continue
+			}
+			for i := range candidates {
+				finding := &candidates[i]
+				if ticketed[finding.ID.Hex()] {
+					continue
+				}
+				ticketed[finding.ID.Hex()] = true
+				if err := raiseTicket(ctx, store, provider, settings.Provider, finding); err != nil {
+					fail(fmt.Errorf("finding %s: %w", finding.ID.Hex(), err))
+					continue
+				}
+				result.Raised++
+			}
+		}
+	}
+
+	syncErr := errors.Join(failures...)
+	if err := store.RecordSync(ctx, job.TenantID, time.Now(), syncErr); err != nil {
+		log.Printf("[Ticketing] Warning: %v", err)
+	}
+	log.Printf("[Ticketing] Raised %d, closed %d tickets and resolved %d findings for tenant %s",
+		result.Raised, result.Closed, result.FindingsResolved, job.TenantID)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+	return result, nil
+}
+
+// reconcileTicket closes the ticket when its finding is no longer open, or resolves the finding
+// when the ticket was closed in the provider
+func reconcileTicket(ctx context.Context, store *ticketing.Store, findingStore *findings.Store, provider ticketProvider, ticket *ticketing.Ticket, result *TicketSyncResult) error {
+	finding, err := findingStore.Get(ctx, ticket.TenantID, ticket.FindingID)
+	if err != nil && !errors.Is(err, findings.ErrNotFound) {
+		return err
+	}
+
+	if finding == nil || finding.Status == findings.StatusResolved || finding.Status == findings.StatusSuppressed {
+		reason := "The finding no longer exists in CloudLoom."
+		if finding != nil {
+			reason = fmt.Sprintf("The finding was %s in CloudLoom.", finding.Status)
+			if finding.StatusReason != "" {
+				reason += " " + finding.StatusReason
+			}
+		}
+		if err := provider.Close(ctx, ticket, reason); err != nil {
+			return err
+		}
+		result.Closed++
+		return store.MarkClosed(ctx, ticket, ticketing.ClosedByCloudLoom)
+	}
+
+	closed, err := provider.Closed(ctx, ticket)
+	if err != nil || !closed {
+		return err
+	}
+	reason := fmt.Sprintf("Ticket %s was closed in %s", ticket.Number, provider.Name())
+	updated, err := findingStore.BulkUpdateStatus(ctx, ticket.TenantID, []string{ticket.FindingID}, findings.StatusUpdate{
+		Status: findings.StatusResolved,
+		Reason: reason,
+	})
+	if err != nil {
+		return err
+	}
+	if len(updated.Failed) > 0 {
+		return errors.New(updated.Failed[0].Error)
+	}
+	result.FindingsResolved++
+	return store.MarkClosed(ctx, ticket, ticketing.ClosedByProvider)
+}
+
+// raiseTicket reserves a ticket for the finding, raises it in the provider and records it
+func raiseTicket(ctx context.Context, store *ticketing.Store, provider ticketProvider, providerName string, finding *findings.Finding) error {
+	ticket, err := store.Reserve(ctx, finding.TenantID, finding.ID.Hex(), providerName)
+	if errors.Is(err, ticketing.ErrTicketed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := provider.Raise(ctx, finding, ticket); err != nil {
+		if releaseErr := store.Release(ctx, ticket); releaseErr != nil {
+			log.Printf("[Ticketing] Warning: %v", releaseErr)
+		}
+		return err
+	}
+	return store.Raised(ctx, ticket)
+}
+
+// ticketProviderFor builds the client of the tenant's provider from its stored credentials
+func ticketProviderFor(ctx context.Context, secretStore secrets.Store, settings *ticketing.Settings) (ticketProvider, error) {
+	var credentials map[string]string
+	err := secrets.GetJSON(ctx, secretStore, secrets.TenantName(settings.TenantID, settings.Provider), &credentials)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return nil, fmt.Errorf("%w: store the %s credentials first", ticketing.ErrInvalid, settings.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch settings.Provider {
+	case ticketing.ProviderJira:
+		if credentials["email"] == "" || credentials["apiToken"] == "" {
+			return nil, fmt.Errorf("%w: the jira credentials need an email and apiToken", ticketing.ErrInvalid)
+		}
+		return &jiraProvider{settings: settings.Jira, email: credentials["email"], token: credentials["apiToken"]}, nil
+	case ticketing.ProviderServiceNow:
+		if credentials["username"] == "" || credentials["password"] == "" {
+			return nil, fmt.Errorf("%w: the servicenow credentials need a username and password", ticketing.ErrInvalid)
+		}
+		return &serviceNowProvider{settings: settings.ServiceNow, username: credentials["username"], password: credentials["password"]}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown provider '%s'", ticketing.ErrInvalid, settings.Provider)
+}
+
+// ticketSummary is the one-line title of a finding's ticket
+func ticketSummary(finding *findings.Finding) string {
+	summary := fmt.Sprintf("[CloudLoom][%s] %s", strings.ToUpper(finding.Severity), finding.Title)
+	if len(summary) > 250 {
+		summary = summary[:250]
+	}
+	return summary
+}
+
+// ticketDescription is the plain-text body of a finding's ticket
+func ticketDescription(finding *findings.Finding) string {
+	var b strings.Builder
+	if finding.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", finding.Description)
+	}
+	fmt.Fprintf(&b, "Severity: %s\n", finding.Severity)
+	fmt.Fprintf(&b, "Resource: %s %s\n", finding.ResourceType, finding.ResourceID)
+	if finding.Context != nil && finding.Context.Region != "" {
+		fmt.Fprintf(&b, "Region: %s\n", finding.Context.Region)
+	}
+	fmt.Fprintf(&b, "Rule: %s (%s)\n", finding.RuleID, finding.Source)
+	fmt.Fprintf(&b, "First seen: %s\n", finding.FirstSeenAt.UTC().Format(time.RFC1123))
+	if finding.Remediation != "" {
+		fmt.Fprintf(&b, "\nRemediation:\n%s\n", finding.Remediation)
+	}
+	fmt.Fprintf(&b, "\nCloudLoom finding %s. Closing this ticket resolves the finding; resolving the finding closes this ticket.\n", finding.ID.Hex())
+	return b.String()
+}
+
+// jiraProvider raises Jira issues through the REST API, authenticating with an API token
+type jiraProvider struct {
+	settings *ticketing.JiraSettings
+	email    string
+	token    string
+}
+
+func (j *jiraProvider) Name() string { return "Jira" }
+
+func (j *jiraProvider) Raise(ctx context.Context, finding *findings.Finding, ticket *ticketing.Ticket) error {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": j.settings.ProjectKey},
+		"issuetype":   map[string]string{"name": j.settings.IssueType},
+		"summary":     ticketSummary(finding),
+		"description": ticketDescription(finding),
+	}
+	if len(j.settings.Labels) > 0 {
+		fields["labels"] = j.settings.Labels
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(ctx, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{"fields": fields}, &created); err != nil {
+		return err
+	}
+	ticket.Key, ticket.Number = created.Key, created.Key
+	ticket.URL = strings.TrimRight(j.settings.BaseURL, "/") + "/browse/" + url.PathEscape(created.Key)
+	return nil
+}
+
+func (j *jiraProvider) Closed(ctx context.Context, ticket *ticketing.Ticket) (bool, error) {
+	var issue struct {
+		Fields struct {
+			Status jiraStatus `json:"status"`
+		} `json:"fields"`
+	}
+	if err := j.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(ticket.Key)+"?fields=status", nil, &issue); err != nil {
+		return false, err
+	}
+	return issue.Fields.Status.done(), nil
+}
+
+func (j *jiraProvider) Close(ctx context.Context, ticket *ticketing.Ticket, reason string) error {
+	issuePath := "/rest/api/2/issue/" + url.PathEscape(ticket.Key)
+	if closed, err := j.Closed(ctx, ticket); err != nil || closed {
+		return err
+	}
+
+	var available struct {
+		Transitions []struct {
+			ID string     `json:"id"`
+			To jiraStatus `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := j.do(ctx, http.MethodGet, issuePath+"/transitions", nil, &available); err != nil {
+		return err
+	}
+	for _, transition := range available.Transitions {
+		if !transition.To.done() {
+			continue
+		}
+		if err := j.do(ctx, http.MethodPost, issuePath+"/comment", map[string]string{"body": reason}, nil); err != nil {
+			return err
+		}
+		return j.do(ctx, http.MethodPost, issuePath+"/transitions", map[string]interface{}{
+			"transition": map[string]string{"id": transition.ID},
+		}, nil)
+	}
+	return fmt.Errorf("issue %s has no transition to a done status", ticket.Key)
+}
+
+// jiraStatus is an issue status and the category it belongs to
+type jiraStatus struct {
+	Name           string `json:"name"`
+	StatusCategory struct {
+		Key string `json:"key"`
+	} `json:"statusCategory"`
+}
+
+func (s jiraStatus) done() bool {
+	return s.StatusCategory.Key == "done"
+}
+
+func (j *jiraProvider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	return ticketingRequest(ctx, method, strings.TrimRight(j.settings.BaseURL, "/")+path, j.email, j.token, body, out)
+}
+
+// serviceNowProvider raises ServiceNow records through the Table API with basic authentication
+type serviceNowProvider struct {
+	settings *ticketing.ServiceNowSettings
+	username string
+	password string
+}
+
+func (s *serviceNowProvider) Name() string { return "ServiceNow" }
+
+func (s *serviceNowProvider) Raise(ctx context.Context, finding *findings.Finding, ticket *ticketing.Ticket) error {
+	record := map[string]string{
+		"short_description": ticketSummary(finding),
+		"description":       ticketDescription(finding),
+		"urgency":           serviceNowUrgency(finding.Severity),
+		"impact":            serviceNowUrgency(finding.Severity),
+	}
+	if s.settings.AssignmentGroup != "" {
+		record["assignment_group"] = s.settings.AssignmentGroup
+	}
+	var created struct {
+		Result struct {
+			SysID  string `json:"sys_id"`
+			Number string `json:"number"`
+		} `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodPost, s.tablePath(""), record, &created); err != nil {
+		return err
+	}
+	ticket.Key, ticket.Number = created.Result.SysID, created.Result.Number
+	ticket.URL = fmt.Sprintf("%s/nav_to.do?uri=%s", strings.TrimRight(s.settings.InstanceURL, "/"),
+		url.QueryEscape(fmt.Sprintf("%s.do?sys_id=%s", s.settings.Table, created.Result.SysID)))
+	return nil
+}
+
+func (s *serviceNowProvider) Closed(ctx context.Context, ticket *ticketing.Ticket) (bool, error) {
+	var record struct {
+		Result struct {
+			State string `json:"state"`
+		} `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodGet, s.tablePath(ticket.Key)+"?sysparm_fields=state", nil, &record); err != nil {
+		return false, err
+	}
+	for _, state := range s.settings.ClosedStates {
+		if record.Result.State == state {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *serviceNowProvider) Close(ctx context.Context, ticket *ticketing.Ticket, reason string) error {
+	if closed, err := s.Closed(ctx, ticket); err != nil || closed {
+		return err
+	}
+	return s.do(ctx, http.MethodPatch, s.tablePath(ticket.Key), map[string]string{
+		"state":       s.settings.ResolvedState,
+		"close_notes": reason,
+		"work_notes":  reason,
+	}, nil)
+}
+
+func (s *serviceNowProvider) tablePath(sysID string) string {
+	path := "/api/now/table/" + url.PathEscape(s.settings.Table)
+	if sysID != "" {
+		path += "/" + url.PathEscape(sysID)
+	}
+	return path
+}
+
+func (s *serviceNowProvider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	return ticketingRequest(ctx, method, strings.TrimRight(s.settings.InstanceURL, "/")+path, s.username, s.password, body, out)
+}
+
+// serviceNowUrgency maps a finding severity to ServiceNow's 1 (high) to 3 (low) scale
+func serviceNowUrgency(severity string) string {
+	switch severity {
+	case "critical":
+		return "1"
+	case "high":
+		return "2"
+	}
+	return "3"
+}
+
+// ticketingRequest sends a JSON request with basic authentication and decodes the JSON
+// response into out, when given
+func ticketingRequest(ctx context.Context, method, endpoint, username, password string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request to %s: %w", endpoint, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request to %s: %w", endpoint, err)
+	}
+	request.SetBasicAuth(username, password)
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := ticketingClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, endpoint, err)
+	}
+	defer response.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s %s answered %s: %s", method, endpoint, response.Status, strings.TrimSpace(string(payload[:min(len(payload), 512)])))
+	}
+	if out == nil || len(payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(payload, out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package ticketing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	settingsCollectionName = config.CollectionTicketingSettings
+	ticketsCollectionName  = config.CollectionTickets
+)
+
+var (
+	// ErrNotFound is returned when the tenant has no ticketing settings
+	ErrNotFound = errors.New("ticketing is not configured")
+	// ErrInvalid is returned for settings with an unknown provider, severity or instance URL
+	ErrInvalid = errors.New("invalid ticketing settings")
+	// ErrTicketed is returned when reserving a ticket for a finding that already has an open one
+	ErrTicketed = errors.New("finding already has an open ticket")
+)
+
+// Providers tickets can be raised in. Each reads its credentials from the integration secret of
+// the same name.
+const (
+	ProviderJira       = "jira"
+	ProviderServiceNow = "servicenow"
+)
+
+// Providers are the supported ticketing providers
+var Providers = []string{ProviderJira, ProviderServiceNow}
+
+// severities are the finding severities, lowest first
+var severities = []string{"informational", "low", "medium", "high", "critical"}
+
+// Defaults applied by Validate
+const (
+	DefaultMinSeverity       = "high"
+	DefaultJiraIssueType     = "Task"
+	DefaultServiceNowTable   = "incident"
+	DefaultServiceNowResolve = "6"
+)
+
+// Settings configure which of a tenant's findings are ticketed and where
+type Settings struct {
+	TenantID string `bson:"tenantId" json:"tenantId"`
+	Provider string `bson:"provider" json:"provider"`
+	// MinSeverity is the lowest severity a finding must have to be ticketed
+	MinSeverity string `bson:"minSeverity" json:"minSeverity"`
+	Enabled     bool   `bson:"enabled" json:"enabled"`
+
+	Jira       *JiraSettings       `bson:"jira,omitempty" json:"jira,omitempty"`
+	ServiceNow *ServiceNowSettings `bson:"serviceNow,omitempty" json:"serviceNow,omitempty"`
+
+	// LastSyncAt and LastSyncError describe the last time tickets and findings were reconciled
+	LastSyncAt    *time.Time `bson:"lastSyncAt,omitempty" json:"lastSyncAt,omitempty"`
+	LastSyncError string     `bson:"lastSyncError,omitempty" json:"lastSyncError,omitempty"`
+	UpdatedAt     time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// JiraSettings pick the site, project and issue type of the issues raised. An issue counts as
+// closed once its status is in Jira's "done" category; closing one moves it through the first
+// transition into that category.
+type JiraSettings struct {
+	BaseURL    string   `bson:"baseUrl" json:"baseUrl"`
+	ProjectKey string   `bson:"projectKey" json:"projectKey"`
+	IssueType  string   `bson:"issueType" json:"issueType"`
+	Labels     []string `bson:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// ServiceNowSettings pick the instance and table records are created in. A record counts as
+// closed once its state is one of ClosedStates; closing one sets ResolvedState.
+type ServiceNowSettings struct {
+	InstanceURL     string   `bson:"instanceUrl" json:"instanceUrl"`
+	Table           string   `bson:"table" json:"table"`
+	AssignmentGroup string   `bson:"assignmentGroup,omitempty" json:"assignmentGroup,omitempty"`
+	ResolvedState   string   `bson:"resolvedState" json:"resolvedState"`
+	ClosedStates    []string `bson:"closedStates" json:"closedStates"`
+}
+
+// Validate checks the provider, severity and provider settings, filling in their defaults
+func (s *Settings) Validate() error {
+	if s.MinSeverity == "" {
+		s.MinSeverity = DefaultMinSeverity
+	}
+	if SeverityRank(s.MinSeverity) < 0 {
+		return fmt.Errorf("%w: unknown severity '%s'", ErrInvalid, s.MinSeverity)
+	}
+
+	switch s.Provider {
+	case ProviderJira:
+		if s.Jira == nil || s.Jira.ProjectKey == "" {
+			return fmt.Errorf("%w: a Jira project key is required", ErrInvalid)
+		}
+		if err := checkBaseURL(s.Jira.BaseURL); err != nil {
+			return err
+		}
+		if s.Jira.IssueType == "" {
+			s.Jira.IssueType = DefaultJiraIssueType
+		}
+		s.ServiceNow = nil
+	case ProviderServiceNow:
+		if s.ServiceNow == nil {
+			return fmt.Errorf("%w: a ServiceNow instance URL is required", ErrInvalid)
+		}
+		if err := checkBaseURL(s.ServiceNow.InstanceURL); err != nil {
+			return err
+		}
+		if s.ServiceNow.Table == "" {
+			s.ServiceNow.Table = DefaultServiceNowTable
+		}
+		if s.ServiceNow.ResolvedState == "" {
+			s.ServiceNow.ResolvedState = DefaultServiceNowResolve
+		}
+		if len(s.ServiceNow.ClosedStates) == 0 {
+			// Resolved and Closed, for the incident table
+			s.ServiceNow.ClosedStates = []string{"6", "7"}
+		}
+		s.Jira = nil
+	default:
+		return fmt.Errorf("%w: unknown provider '%s'", ErrInvalid, s.Provider)
+	}
+	return nil
+}
+
+// checkBaseURL checks raw is an absolute HTTPS URL outside CloudLoom's network
+func checkBaseURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%w: '%s' is not an HTTPS URL", ErrInvalid, raw)
+	}
+	if err := common.CheckPublicHost(parsed.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// Ticketed reports whether a finding of the given severity is ticketed
+func (s *Settings) Ticketed(severity string) bool {
+	return s.Enabled && SeverityRank(severity) >= SeverityRank(s.MinSeverity)
+}
+
+// SeverityRank orders finding severities from informational (0) to critical, -1 when unknown
+func SeverityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// SeveritiesFrom returns the severities at or above minimum
+func SeveritiesFrom(minimum string) []string {
+	rank := SeverityRank(minimum)
+	if rank < 0 {
+		return nil
+	}
+	return append([]string(nil), severities[rank:]...)
+}
+
+// Ticket states
+const (
+	StateOpen   = "open"
+	StateClosed = "closed"
+)
+
+// Who closed a ticket
+const (
+	ClosedByCloudLoom = "cloudloom"
+	ClosedByProvider  = "provider"
+)
+
+// Ticket links a finding to the issue or record raised for it. A ticket is reserved before it
+// is raised, so its Key is empty until the provider has created it.
+type Ticket struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID  string             `bson:"tenantId" json:"tenantId"`
+	FindingID string             `bson:"findingId" json:"findingId"`
+	Provider  string             `bson:"provider" json:"provider"`
+	// Key identifies the ticket to the provider: a Jira issue key or a ServiceNow sys_id
+	Key string `bson:"key,omitempty" json:"key,omitempty"`
+	// Number is the ticket's human-readable name, the Jira issue key or the ServiceNow number
+	Number    string     `bson:"number,omitempty" json:"number,omitempty"`
+	URL       string     `bson:"url,omitempty" json:"url,omitempty"`
+	State     string     `bson:"state" json:"state"`
+	ClosedBy  string     `bson:"closedBy,omitempty" json:"closedBy,omitempty"`
+	ClosedAt  *time.Time `bson:"closedAt,omitempty" json:"closedAt,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ListFilter narrows the tickets returned by List
+type ListFilter struct {
+	TenantID  string
+	FindingID string
+	State     string
+	Limit     int64
+}
+
+// Store persists per-tenant ticketing settings and the tickets raised for findings in MongoDB
+type Store struct {
+	settings *mongo.Collection
+	tickets  *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide ticketing store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide ticketing store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the ticketing settings and tickets collections
+func NewStore(db *mongo.Database) *Store {
+	return &Store{
+		settings: db.Collection(settingsCollectionName),
+		tickets:  db.Collection(ticketsCollectionName),
+	}
+}
+
+// GetSettings returns the tenant's ticketing settings
+func (s *Store) GetSettings(ctx context.Context, tenantID string) (*Settings, error) {
+	var settings Settings
+	err := s.settings.FindOne(ctx, bson.M{"tenantId": tenantID}).Decode(&settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ticketing settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// PutSettings validates and stores the tenant's ticketing settings, keeping the outcome of
+// the last sync
+func (s *Store) PutSettings(ctx context.Context, settings *Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	settings.UpdatedAt = time.Now()
+	_, err := s.settings.UpdateOne(ctx,
+		bson.M{"tenantId": settings.TenantID},
+		bson.M{"$set": bson.M{
+			"provider":    settings.Provider,
+			"minSeverity": settings.MinSeverity,
+			"enabled":     settings.Enabled,
+			"jira":        settings.Jira,
+			"serviceNow":  settings.ServiceNow,
+			"updatedAt":   settings.UpdatedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save ticketing settings: %w", err)
+	}
+	return nil
+}
+
+// DeleteSettings stops ticketing the tenant's findings. Tickets already raised are kept.
+func (s *Store) DeleteSettings(ctx context.Context, tenantID string) error {
+	result, err := s.settings.DeleteOne(ctx, bson.M{"tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete ticketing settings: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnabledTenants returns the tenants whose findings are being ticketed
+func (s *Store) EnabledTenants(ctx context.Context) ([]string, error) {
+	values, err := s.settings.Distinct(ctx, "tenantId", bson.M{"enabled": true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ticketing tenants: %w", err)
+	}
+	tenants := make([]string, 0, len(values))
+	for _, v := range values {
+		if tenantID, ok := v.(string); ok {
+			tenants = append(tenants, tenantID)
+		}
+	}
+	return tenants, nil
+}
+
+// RecordSync saves the outcome of reconciling the tenant's tickets and findings. A nil syncErr
+// records it as successful.
+func (s *Store) RecordSync(ctx context.Context, tenantID string, at time.Time, syncErr error) error {
+	set := bson.M{"lastSyncAt": at, "lastSyncError": ""}
+	if syncErr != nil {
+		set["lastSyncError"] = syncErr.Error()
+	}
+	if _, err := s.settings.UpdateOne(ctx, bson.M{"tenantId": tenantID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to record ticket sync: %w", err)
+	}
+	return nil
+}
+
+// Reserve records that a ticket is about to be raised for the finding, so a concurrent sync
+// does not raise a second one. It returns ErrTicketed when the finding has an open ticket.
+func (s *Store) Reserve(ctx context.Context, tenantID, findingID, provider string) (*Ticket, error) {
+	now := time.Now()
+	ticket := &Ticket{
+		ID:        primitive.NewObjectID(),
+		TenantID:  tenantID,
+		FindingID: findingID,
+		Provider:  provider,
+		State:     StateOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	_, err := s.tickets.InsertOne(ctx, ticket)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrTicketed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// Release drops a reservation whose ticket could not be raised
+func (s *Store) Release(ctx context.Context, ticket *Ticket) error {
+	if _, err := s.tickets.DeleteOne(ctx, bson.M{"_id": ticket.ID, "tenantId": ticket.TenantID, "key": bson.M{"$exists": false}}); err != nil {
+		return fmt.Errorf("failed to release ticket: %w", err)
+	}
+	return nil
+}
+
+// Raised records the key, number and URL the provider gave a reserved ticket
+func (s *Store) Raised(ctx context.Context, ticket *Ticket) error {
+	ticket.UpdatedAt = time.Now()
+	_, err := s.tickets.UpdateOne(ctx,
+		bson.M{"_id": ticket.ID, "tenantId": ticket.TenantID},
+		bson.M{"$set": bson.M{"key": ticket.Key, "number": ticket.Number, "url": ticket.URL, "updatedAt": ticket.UpdatedAt}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record ticket %s: %w", ticket.Number, err)
+	}
+	return nil
+}
+
+// MarkClosed records that the ticket was closed, by CloudLoom or in the provider
+func (s *Store) MarkClosed(ctx context.Context, ticket *Ticket, closedBy string) error {
+	now := time.Now()
+	_, err := s.tickets.UpdateOne(ctx,
+		bson.M{"_id": ticket.ID, "tenantId": ticket.TenantID},
+		bson.M{"$set": bson.M{"state": StateClosed, "closedBy": closedBy, "closedAt": now, "updatedAt": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to close ticket %s: %w", ticket.Number, err)
+	}
+	ticket.State, ticket.ClosedBy, ticket.ClosedAt, ticket.UpdatedAt = StateClosed, closedBy, &now, now
+	return nil
+}
+
+// List returns tickets matching the filter, newest first
+func (s *Store) List(ctx context.Context, filter ListFilter) ([]Ticket, error) {
+	query := bson.M{"tenantId": filter.TenantID}
+	if filter.FindingID != "" {
+		query["findingId"] = filter.FindingID
+	}
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+
+	cursor, err := s.tickets.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tickets: %w", err)
+	}
+	result := []Ticket{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+	return result, nil
+}
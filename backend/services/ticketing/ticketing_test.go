@@ -0,0 +1,154 @@
+package ticketing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     Settings
+		wantErr  bool
+	}{
+		{
+			name:     "jira defaults",
+			settings: Settings{Provider: ProviderJira, Jira: &JiraSettings{BaseURL: "https://acme.atlassian.net", ProjectKey: "SEC"}},
+			want: Settings{
+				Provider:    ProviderJira,
+				MinSeverity: DefaultMinSeverity,
+				Jira:        &JiraSettings{BaseURL: "https://acme.atlassian.net", ProjectKey: "SEC", IssueType: DefaultJiraIssueType},
+			},
+		},
+		{
+			name: "jira drops servicenow settings",
+			settings: Settings{
+				Provider:    ProviderJira,
+				MinSeverity: "medium",
+				Jira:        &JiraSettings{BaseURL: "https://acme.atlassian.net", ProjectKey: "SEC", IssueType: "Bug"},
+				ServiceNow:  &ServiceNowSettings{InstanceURL: "https://acme.service-now.com"},
+			},
+			want: Settings{
+				Provider:    ProviderJira,
+				MinSeverity: "medium",
+				Jira:        &JiraSettings{BaseURL: "https://acme.atlassian.net", ProjectKey: "SEC", IssueType: "Bug"},
+			},
+		},
+		{
+			name:     "servicenow defaults",
+			settings: Settings{Provider: ProviderServiceNow, ServiceNow: &ServiceNowSettings{InstanceURL: "https://acme.service-now.com"}},
+			want: Settings{
+				Provider:    ProviderServiceNow,
+				MinSeverity: DefaultMinSeverity,
+				ServiceNow: &ServiceNowSettings{
+					InstanceURL:   "https://acme.service-now.com",
+					Table:         DefaultServiceNowTable,
+					ResolvedState: DefaultServiceNowResolve,
+					ClosedStates:  []string{"6", "7"},
+				},
+			},
+		},
+		{name: "unknown provider", settings: Settings{Provider: "github"}, wantErr: true},
+		{name: "unknown severity", settings: Settings{Provider: ProviderJira, MinSeverity: "urgent"}, wantErr: true},
+		{name: "jira without project", settings: Settings{Provider: ProviderJira, Jira: &JiraSettings{BaseURL: "https://acme.atlassian.net"}}, wantErr: true},
+		{name: "jira over http", settings: Settings{Provider: ProviderJira, Jira: &JiraSettings{BaseURL: "http://acme.atlassian.net", ProjectKey: "SEC"}}, wantErr: true},
+		{name: "servicenow without settings", settings: Settings{Provider: ProviderServiceNow}, wantErr: true},
+		{name: "servicenow without host", settings: Settings{Provider: ProviderServiceNow, ServiceNow: &ServiceNowSettings{InstanceURL: "https://"}}, wantErr: true},
+		{name: "jira on a private address", settings: Settings{Provider: ProviderJira, Jira: &JiraSettings{BaseURL: "https://10.1.2.3", ProjectKey: "SEC"}}, wantErr: true},
+		{name: "jira on localhost", settings: Settings{Provider: ProviderJira, Jira: &JiraSettings{BaseURL: "https://localhost:8080", ProjectKey: "SEC"}}, wantErr: true},
+		{name: "servicenow on a link-local address", settings: Settings{Provider: ProviderServiceNow, ServiceNow: &ServiceNowSettings{InstanceURL: "https://169.254.169.254"}}, wantErr: true},
+		{name: "servicenow on loopback", settings: Settings{Provider: ProviderServiceNow, ServiceNow: &ServiceNowSettings{InstanceURL: "https://[::1]:8443"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Validate() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(tt.settings, tt.want) {
+				t.Errorf("Validate() settings = %+v, want %+v", tt.settings, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsTicketed(t *testing.T) {
+	settings := Settings{MinSeverity: "high", Enabled: true}
+	tests := []struct {
+		severity string
+		want     bool
+	}{
+		{"critical", true},
+		{"high", true},
+		{"medium", false},
+		{"informational", false},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			if got := settings.Ticketed(tt.severity); got != tt.want {
+				t.Errorf("Ticketed(%s) = %v, want %v", tt.severity, got, tt.want)
+			}
+		})
+	}
+	settings.Enabled = false
+	if settings.Ticketed("critical") {
+		t.Error("disabled settings ticket critical findings")
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     int
+	}{
+		{"informational", 0},
+		{"low", 1},
+		{"medium", 2},
+		{"high", 3},
+		{"critical", 4},
+		{"Critical", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			if got := SeverityRank(tt.severity); got != tt.want {
+				t.Errorf("SeverityRank(%q) = %d, want %d", tt.severity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeveritiesFrom(t *testing.T) {
+	tests := []struct {
+		minimum string
+		want    []string
+	}{
+		{"informational", []string{"informational", "low", "medium", "high", "critical"}},
+		{"high", []string{"high", "critical"}},
+		{"critical", []string{"critical"}},
+		{"urgent", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.minimum, func(t *testing.T) {
+			got := SeveritiesFrom(tt.minimum)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SeveritiesFrom(%s) = %v, want %v", tt.minimum, got, tt.want)
+			}
+			if len(got) > 0 {
+				got[0] = "changed"
+				if SeverityRank(tt.minimum) < 0 {
+					t.Errorf("SeveritiesFrom(%s) shares the severity list", tt.minimum)
+				}
+			}
+		})
+	}
+}
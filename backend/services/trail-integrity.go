@@ -0,0 +1,374 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// MaxIntegrityRange is the longest time range one integrity check covers, since every log
+// file in the range is downloaded and hashed
+const MaxIntegrityRange = 7 * 24 * time.Hour
+
+// ErrInvalidIntegrityRange is returned for a range that is empty, reversed or too long
+var ErrInvalidIntegrityRange = errors.New("invalid integrity check range")
+
+// Kinds of file an integrity issue is about
+const (
+	IntegrityDigest  = "digest"
+	IntegrityLogFile = "log_file"
+)
+
+// IntegrityIssue is a digest or log file that is missing or does not match what CloudTrail
+// delivered
+type IntegrityIssue struct {
+	Kind   string `json:"kind"`
+	Region string `json:"region,omitempty"`
+	Object string `json:"object"`
+	Detail string `json:"detail"`
+}
+
+// IntegrityReport is the outcome of validating a trail's digest and log files over a range
+type IntegrityReport struct {
+	AccountID string    `json:"accountId"`
+	Trail     string    `json:"trail"`
+	Bucket    string    `json:"bucket"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	// ValidationEnabled is false when the trail delivers no digest files to validate against
+	ValidationEnabled bool             `json:"validationEnabled"`
+	DigestsChecked    int              `json:"digestsChecked"`
+	LogFilesChecked   int              `json:"logFilesChecked"`
+	Valid             bool             `json:"valid"`
+	Tampered          []IntegrityIssue `json:"tampered"`
+	Missing           []IntegrityIssue `json:"missing"`
+}
+
+// digestFile is the part of a CloudTrail digest file that validation reads
+type digestFile struct {
+	DigestEndTime              string `json:"digestEndTime"`
+	DigestS3Bucket             string `json:"digestS3Bucket"`
+	DigestS3Object             string `json:"digestS3Object"`
+	DigestPublicKeyFingerprint string `json:"digestPublicKeyFingerprint"`
+	PreviousDigestS3Object     string `json:"previousDigestS3Object"`
+	PreviousDigestSignature    string `json:"previousDigestSignature"`
+	LogFiles                   []struct {
+		S3Bucket  string `json:"s3Bucket"`
+		S3Object  string `json:"s3Object"`
+		HashValue string `json:"hashValue"`
+	} `json:"logFiles"`
+}
+
+// TrailIntegrityService turns on CloudTrail log file validation for a tenant's trail and
+// checks the delivered log files against their signed digest files
+type TrailIntegrityService struct {
+	cloudTrail *CloudTrailService
+}
+
+// NewTrailIntegrityService returns an integrity service for the tenant's account
+func NewTrailIntegrityService(ctx context.Context, tenantID string) (*TrailIntegrityService, error) {
+	cloudTrail, err := cloudTrailServiceFor(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &TrailIntegrityService{cloudTrail: cloudTrail}, nil
+}
+
+// EnableValidation turns on log file validation for the account's trail, for accounts set up
+// before setup enabled it. CloudTrail delivers the first digest file about an hour later.
+func (t *TrailIntegrityService) EnableValidation(ctx context.Context) error {
+	cfg, err := t.cloudTrail.assumeRole(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	names := t.cloudTrail.resourceNames(ctx, cfg, accountID, t.cloudTrail.monitoredRegions())
+
+	_, err = cloudtrail.NewFromConfig(cfg).UpdateTrail(ctx, &cloudtrail.UpdateTrailInput{
+		Name:                    aws.String(names.trail),
+		EnableLogFileValidation: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable log file validation on %s: %w", names.trail, err)
+	}
+	log.Printf("[Integrity] ✅ Log file validation enabled on %s", names.trail)
+	return nil
+}
+
+// Validate checks every digest file the trail delivered between from and to, in every region:
+// its signature, that it chains to the previous digest, and the hash of each log file it
+// lists. Deleted files are reported as missing and altered ones as tampered.
+func (t *TrailIntegrityService) Validate(ctx context.Context, from, to time.Time) (*IntegrityReport, error) {
+	if !to.After(from) || to.Sub(from) > MaxIntegrityRange {
+		return nil, fmt.Errorf("%w: to must be after from and at most %s later", ErrInvalidIntegrityRange, MaxIntegrityRange)
+	}
+
+	cfg, err := t.cloudTrail.assumeRole(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume customer role: %w", err)
+	}
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := t.cloudTrail.resourceNames(ctx, cfg, accountID, t.cloudTrail.monitoredRegions())
+
+	trails := cloudtrail.NewFromConfig(cfg)
+	described, err := trails.DescribeTrails(ctx, &cloudtrail.DescribeTrailsInput{TrailNameList: []string{names.trail}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trail %s: %w", names.trail, err)
+	}
+	if len(described.TrailList) == 0 {
+		return nil, fmt.Errorf("trail %s not found", names.trail)
+	}
+	trail := described.TrailList[0]
+
+	report := &IntegrityReport{
+		AccountID:         accountID,
+		Trail:             names.trail,
+		Bucket:            aws.ToString(trail.S3BucketName),
+		From:              from,
+		To:                to,
+		ValidationEnabled: aws.ToBool(trail.LogFileValidationEnabled),
+		Tampered:          []IntegrityIssue{},
+		Missing:           []IntegrityIssue{},
+	}
+	if !report.ValidationEnabled {
+		return report, nil
+	}
+
+	keys, err := digestPublicKeys(ctx, trails, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	validator := &digestValidator{s3: s3.NewFromConfig(cfg), keys: keys, report: report}
+	digestPrefix := path.Join(aws.ToString(trail.S3KeyPrefix), "AWSLogs", accountID, "CloudTrail-Digest") + "/"
+	regions, err := validator.digestRegions(ctx, report.Bucket, digestPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range regions {
+		digests, err := validator.listDigests(ctx, report.Bucket, digestPrefix+region+"/", region, names.trail, from, to)
+		if err != nil {
+			return nil, err
+		}
+		validator.validateChain(ctx, report.Bucket, region, digests)
+	}
+
+	report.Valid = len(report.Tampered) == 0 && len(report.Missing) == 0
+	log.Printf("[Integrity] Checked %d digests and %d log files of %s: %d tampered, %d missing",
+		report.DigestsChecked, report.LogFilesChecked, names.trail, len(report.Tampered), len(report.Missing))
+	return report, nil
+}
+
+// digestPublicKeys returns CloudTrail's public keys valid during the range by fingerprint
+func digestPublicKeys(ctx context.Context, client *cloudtrail.Client, from, to time.Time) (map[string]*rsa.PublicKey, error) {
+	keys := map[string]*rsa.PublicKey{}
+	input := &cloudtrail.ListPublicKeysInput{StartTime: aws.Time(from), EndTime: aws.Time(to)}
+	for {
+		out, err := client.ListPublicKeys(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list CloudTrail public keys: %w", err)
+		}
+		for _, key := range out.PublicKeyList {
+			// Keys are DER-encoded PKCS#1 RSA public keys
+			parsed, err := x509.ParsePKCS1PublicKey(key.Value)
+			if err != nil {
+				log.Printf("[Integrity] Warning: skipping public key %s: %v", aws.ToString(key.Fingerprint), err)
+				continue
+			}
+			keys[aws.ToString(key.Fingerprint)] = parsed
+		}
+		if out.NextToken == nil {
+			return keys, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// digestValidator validates the digests of one trail and records issues on the report
+type digestValidator struct {
+	s3     *s3.Client
+	keys   map[string]*rsa.PublicKey
+	report *IntegrityReport
+}
+
+// digestRegions returns the regions the trail delivered digest files for
+func (v *digestValidator) digestRegions(ctx context.Context, bucket, prefix string) ([]string, error) {
+	out, err := v.s3.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest files in %s: %w", bucket, err)
+	}
+	var regions []string
+	for _, folder := range out.CommonPrefixes {
+		regions = append(regions, strings.TrimSuffix(strings.TrimPrefix(aws.ToString(folder.Prefix), prefix), "/"))
+	}
+	return regions, nil
+}
+
+// listDigests returns the keys of the trail's digest files in the region delivered during the
+// range, oldest first. Digest files are named ..._<trail>_<region>_<yyyymmddThhmmssZ>.json.gz.
+func (v *digestValidator) listDigests(ctx context.Context, bucket, prefix, region, trailName string, from, to time.Time) ([]string, error) {
+	marker := fmt.Sprintf("_CloudTrail-Digest_%s_%s_%s_", region, trailName, region)
+	var keys []string
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		paginator := s3.NewListObjectsV2Paginator(v.s3, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix + day.Format("2006/01/02/")),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list digest files in %s: %w", region, err)
+			}
+			for _, object := range page.Contents {
+				key := aws.ToString(object.Key)
+				i := strings.Index(key, marker)
+				if i < 0 {
+					continue
+				}
+				delivered, err := time.Parse("20060102T150405Z", strings.TrimSuffix(key[i+len(marker):], ".json.gz"))
+				if err != nil || delivered.Before(from) || delivered.After(to) {
+					continue
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// validateChain validates the region's digests in delivery order. Each digest names the one
+// before it, so a digest deleted from the middle of the range is reported as missing.
+func (v *digestValidator) validateChain(ctx context.Context, bucket, region string, keys []string) {
+	previous := ""
+	for _, key := range keys {
+		digest, ok := v.validateDigest(ctx, bucket, region, key)
+		if !ok {
+			previous = key
+			continue
+		}
+		if previous != "" && digest.PreviousDigestS3Object != previous {
+			v.report.Missing = append(v.report.Missing, IntegrityIssue{
+				Kind:   IntegrityDigest,
+				Region: region,
+				Object: digest.PreviousDigestS3Object,
+				Detail: "referenced by " + key + " but not delivered",
+			})
+		}
+		previous = key
+
+		for _, logFile := range digest.LogFiles {
+			v.validateLogFile(ctx, region, logFile.S3Bucket, logFile.S3Object, logFile.HashValue)
+		}
+	}
+}
+
+// validateDigest checks a digest file's signature and returns its contents. A digest that
+// cannot be read or verified is recorded as an issue.
+func (v *digestValidator) validateDigest(ctx context.Context, bucket, region, key string) (*digestFile, bool) {
+	v.report.DigestsChecked++
+	issue := func(detail string) {
+		v.report.Tampered = append(v.report.Tampered, IntegrityIssue{Kind: IntegrityDigest, Region: region, Object: key, Detail: detail})
+	}
+
+	object, err := v.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		v.report.Missing = append(v.report.Missing, IntegrityIssue{Kind: IntegrityDigest, Region: region, Object: key, Detail: err.Error()})
+		return nil, false
+	}
+	content, err := gunzipAll(object.Body)
+	if err != nil {
+		issue("cannot be decompressed: " + err.Error())
+		return nil, false
+	}
+
+	var digest digestFile
+	if err := json.Unmarshal(content, &digest); err != nil {
+		issue("cannot be parsed: " + err.Error())
+		return nil, false
+	}
+	publicKey, ok := v.keys[digest.DigestPublicKeyFingerprint]
+	if !ok {
+		issue("signed with unknown public key " + digest.DigestPublicKeyFingerprint)
+		return nil, false
+	}
+	signature, err := hex.DecodeString(object.Metadata["signature"])
+	if err != nil || len(signature) == 0 {
+		issue("has no valid signature")
+		return nil, false
+	}
+
+	// The signing string CloudTrail signs, as documented for custom validation
+	previousSignature := digest.PreviousDigestSignature
+	if previousSignature == "" {
+		previousSignature = "null"
+	}
+	contentHash := sha256.Sum256(content)
+	signingString := fmt.Sprintf("%s\n%s/%s\n%s\n%s", digest.DigestEndTime, digest.DigestS3Bucket, digest.DigestS3Object, hex.EncodeToString(contentHash[:]), previousSignature)
+	signed := sha256.Sum256([]byte(signingString))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, signed[:], signature); err != nil {
+		issue("signature does not match its contents")
+		return nil, false
+	}
+	return &digest, true
+}
+
+// validateLogFile compares the hash of a log file with the one its digest recorded
+func (v *digestValidator) validateLogFile(ctx context.Context, region, bucket, key, hashValue string) {
+	v.report.LogFilesChecked++
+	object, err := v.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		v.report.Missing = append(v.report.Missing, IntegrityIssue{Kind: IntegrityLogFile, Region: region, Object: key, Detail: err.Error()})
+		return
+	}
+	content, err := gunzipAll(object.Body)
+	if err != nil {
+		v.report.Tampered = append(v.report.Tampered, IntegrityIssue{Kind: IntegrityLogFile, Region: region, Object: key, Detail: "cannot be decompressed: " + err.Error()})
+		return
+	}
+	if hash := sha256.Sum256(content); !strings.EqualFold(hex.EncodeToString(hash[:]), hashValue) {
+		v.report.Tampered = append(v.report.Tampered, IntegrityIssue{Kind: IntegrityLogFile, Region: region, Object: key, Detail: "hash does not match the digest"})
+	}
+}
+
+// gunzipAll reads and closes a gzip-compressed body
+func gunzipAll(body io.ReadCloser) ([]byte, error) {
+	defer body.Close()
+	compressed, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/services/findings"
+)
+
+// FindingSourceUnused marks findings produced by the unused resource analyzer
+const FindingSourceUnused = "unused"
+
+// Kinds of unused resource, also the rule IDs of their findings
+const (
+	UnusedVolume       = "ebs-volume-unattached"
+	UnusedElasticIP    = "elastic-ip-unassociated"
+	UnusedLoadBalancer = "load-balancer-idle"
+	UnusedSnapshot     = "snapshot-stale"
+	UnusedIAMUser      = "iam-user-inactive"
+)
+
+// Ages after which the analyzer reports snapshots and IAM users by default, in days
+const (
+	DefaultStaleSnapshotDays = 180
+	DefaultInactiveUserDays  = 90
+)
+
+// UnusedResource is a resource that likely costs money or widens access without being used
+type UnusedResource struct {
+	Kind         string `json:"kind"`
+	Severity     string `json:"severity"`
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Title        string `json:"title"`
+	Detail       string `json:"detail,omitempty"`
+	// Since is when the resource was created or last used, when that is known
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// UnusedReport is the unused resources of a snapshot
+type UnusedReport struct {
+	Snapshot InventorySnapshot `json:"snapshot"`
+	ByKind   map[string]int    `json:"byKind"`
+	Findings []UnusedResource  `json:"findings"`
+}
+
+// UnusedAnalyzer post-processes an inventory to find likely waste: unattached EBS volumes,
+// unassociated elastic IPs, load balancers with nothing behind them, old snapshots and IAM
+// users that have not signed in or used an access key for a long time
+type UnusedAnalyzer struct {
+	// StaleSnapshotAge is how old an EBS or RDS snapshot must be to be reported
+	StaleSnapshotAge time.Duration
+	// InactiveUserAge is how long an IAM user must have been inactive to be reported
+	InactiveUserAge time.Duration
+}
+
+// NewUnusedAnalyzer returns an analyzer with the default ages
+func NewUnusedAnalyzer() *UnusedAnalyzer {
+	return &UnusedAnalyzer{
+		StaleSnapshotAge: DefaultStaleSnapshotDays * 24 * time.Hour,
+		InactiveUserAge:  DefaultInactiveUserDays * 24 * time.Hour,
+	}
+}
+
+// Analyze returns the unused resources of an inventory as of now, grouped by kind
+func (a *UnusedAnalyzer) Analyze(inventory *ResourceInventory, now time.Time) []UnusedResource {
+	result := []UnusedResource{}
+
+	// Application and network load balancers are idle without a listener. Listeners are only
+	// looked for when the inventory recorded some, so a recorder that skips them does not make
+	// every load balancer look idle.
+	listened := map[string]bool{}
+	recordsListeners := false
+	for _, item := range inventory.Resources {
+		if item.ResourceType == "AWS::ElasticLoadBalancingV2::Listener" {
+			recordsListeners = true
+			listened[stringValue(configValue(item.Configuration, "loadBalancerArn"))] = true
+		}
+	}
+
+	for _, item := range inventory.Resources {
+		config := normalizedConfig(item.Configuration)
+		switch item.ResourceType {
+		case "AWS::EC2::Volume":
+			if stringValue(configValue(config, "state")) == "available" && len(configList(config, "attachments")) == 0 {
+				result = append(result, unusedResource(item, UnusedVolume, "low",
+					fmt.Sprintf("EBS volume %s is not attached to any instance", displayName(item)),
+					"Unattached volumes are billed for their provisioned size.", item.ResourceCreationTime))
+			}
+		case "AWS::EC2::EIP":
+			if stringValue(configValue(config, "associationId")) == "" && stringValue(configValue(config, "instanceId")) == "" &&
+				stringValue(configValue(config, "networkInterfaceId")) == "" {
+				result = append(result, unusedResource(item, UnusedElasticIP, "low",
+					fmt.Sprintf("Elastic IP %s is not associated", displayName(item)),
+					"Public IPv4 addresses are billed whether or not they are in use.", nil))
+			}
+		case "AWS::ElasticLoadBalancing::LoadBalancer":
+			if len(configList(config, "instances")) == 0 {
+				result = append(result, unusedResource(item, UnusedLoadBalancer, "low",
+					fmt.Sprintf("Load balancer %s has no registered instances", displayName(item)), "", item.ResourceCreationTime))
+			}
+		case "AWS::ElasticLoadBalancingV2::LoadBalancer":
+			if recordsListeners && !listened[item.ResourceID] && !listened[stringValue(configValue(config, "loadBalancerArn"))] {
+				result = append(result, unusedResource(item, UnusedLoadBalancer, "low",
+					fmt.Sprintf("Load balancer %s has no listeners", displayName(item)), "", item.ResourceCreationTime))
+			}
+		case "AWS::EC2::Snapshot", "AWS::RDS::DBSnapshot", "AWS::RDS::DBClusterSnapshot":
+			created := snapshotCreated(item, config)
+			if created != nil && now.Sub(*created) > a.StaleSnapshotAge {
+				result = append(result, unusedResource(item, UnusedSnapshot, "low",
+					fmt.Sprintf("Snapshot %s is %d days old", displayName(item), int(now.Sub(*created).Hours()/24)), "", created))
+			}
+		}
+	}
+
+	for _, user := range inventory.UserActivity {
+		last := user.LastActivity()
+		detail := "Has never signed in or used an access key."
+		if last != nil {
+			detail = "Last signed in or used an access key on " + last.Format("2006-01-02") + "."
+		} else {
+			last = user.CreatedAt
+		}
+		if last == nil || now.Sub(*last) <= a.InactiveUserAge {
+			continue
+		}
+		item := iamUserItem(inventory.Resources, user)
+		result = append(result, unusedResource(item, UnusedIAMUser, "medium",
+			fmt.Sprintf("IAM user %s has been inactive for %d days", user.UserName, int(now.Sub(*last).Hours()/24)), detail, last))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Kind < result[j].Kind })
+	return result
+}
+
+func unusedResource(item ConfigurationItem, kind, severity, title, detail string, since *time.Time) UnusedResource {
+	return UnusedResource{
+		Kind:         kind,
+		Severity:     severity,
+		ResourceType: item.ResourceType,
+		ResourceID:   item.ResourceID,
+		ResourceName: item.ResourceName,
+		Region:       item.Region,
+		Title:        title,
+		Detail:       detail,
+		Since:        since,
+	}
+}
+
+// snapshotCreated returns when a snapshot was taken, from the item or its configuration
+func snapshotCreated(item ConfigurationItem, config map[string]interface{}) *time.Time {
+	if item.ResourceCreationTime != nil {
+		return item.ResourceCreationTime
+	}
+	for _, field := range []string{"snapshotCreateTime", "startTime"} {
+		if t, err := time.Parse(time.RFC3339, stringValue(configValue(config, field))); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// iamUserItem finds a user's configuration item by name, since the credential report does not
+// carry the user ID Config identifies users by. Users Config has not recorded get their ARN.
+func iamUserItem(resources []ConfigurationItem, user IAMUserActivity) ConfigurationItem {
+	for _, item := range resources {
+		if item.ResourceType == "AWS::IAM::User" && item.ResourceName == user.UserName {
+			return item
+		}
+	}
+	return ConfigurationItem{ResourceType: "AWS::IAM::User", ResourceID: user.Arn, ResourceName: user.UserName, Region: "global"}
+}
+
+// AnalyzeUnused runs the analyzer over the tenant's snapshot snapshotID, or its latest snapshot
+// if that is empty. It returns jobs.ErrNotFound if there is no such snapshot.
+func AnalyzeUnused(ctx context.Context, tenantID, snapshotID string, analyzer *UnusedAnalyzer) (*UnusedReport, error) {
+	snapshot, inventory, err := LoadInventory(ctx, tenantID, snapshotID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UnusedReport{
+		Snapshot: *snapshot,
+		ByKind:   map[string]int{},
+		Findings: analyzer.Analyze(inventory, time.Now()),
+	}
+	for _, finding := range report.Findings {
+		report.ByKind[finding.Kind]++
+	}
+	return report, nil
+}
+
+// syncUnusedFindings records a finding for every unused resource of a scan and resolves
+// findings from earlier scans for resources that are now used or gone
+func syncUnusedFindings(ctx context.Context, tenantID string, inventory *ResourceInventory, scanStartedAt time.Time) error {
+	store := findings.Default()
+	if store == nil {
+		return nil
+	}
+
+	recorded := 0
+	for _, unused := range NewUnusedAnalyzer().Analyze(inventory, scanStartedAt) {
+		finding := &findings.Finding{
+			TenantID:     tenantID,
+			Source:       FindingSourceUnused,
+			RuleID:       unused.Kind,
+			Title:        unused.Title,
+			Description:  unused.Detail,
+			Severity:     unused.Severity,
+			ResourceType: unused.ResourceType,
+			ResourceID:   unused.ResourceID,
+		}
+		if err := recordFinding(ctx, store, finding); err != nil {
+			return err
+		}
+		recorded++
+	}
+
+	resolved, err := store.ResolveStale(ctx, tenantID, FindingSourceUnused, scanStartedAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Findings] ✅ Recorded %d unused resource findings, resolved %d for tenant %s", recorded, resolved, tenantID)
+	return nil
+}
@@ -0,0 +1,264 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionSavedViews
+
+var (
+	// ErrNotFound is returned when a view does not exist or is not visible to the user
+	ErrNotFound = errors.New("saved view not found")
+	// ErrInvalid is returned when a view names an unknown target or filter parameter
+	ErrInvalid = errors.New("invalid saved view")
+	// ErrForbidden is returned when a user changes a teammate's shared view
+	ErrForbidden = errors.New("only the owner can change a saved view")
+	// ErrConflict is returned when the user already has a view with the same name
+	ErrConflict = errors.New("a saved view with this name already exists")
+)
+
+// Target is a list endpoint a view filters
+type Target struct {
+	Path   string
+	Params []string
+}
+
+// Targets lists the endpoints views can be saved for and the query parameters each accepts
+var Targets = map[string]Target{
+	"findings":  {Path: "/api/v1/findings", Params: []string{"status", "resourceId", "includeExcluded", "limit", "fields"}},
+	"inventory": {Path: "/api/v1/exports/inventory", Params: []string{"snapshotId", "limit", "offset", "fields"}},
+}
+
+// View is a named filter over findings or inventory. Private views are only visible to
+// their owner; shared views are visible to everyone in the tenant.
+type View struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID  string             `bson:"tenantId" json:"tenantId"`
+	OwnerID   string             `bson:"ownerId" json:"ownerId"`
+	Name      string             `bson:"name" json:"name"`
+	Target    string             `bson:"target" json:"target"`
+	Query     string             `bson:"query" json:"query"`
+	Shared    bool               `bson:"shared" json:"shared"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// Path is the endpoint URL the view expands to, filled in on read
+	Path string `bson:"-" json:"path"`
+}
+
+// Definition is the user-editable part of a view
+type Definition struct {
+	Name   string
+	Target string
+	Params map[string]string
+	Shared bool
+}
+
+// encode validates the definition and serializes its parameters into a query string
+func (d Definition) encode() (string, error) {
+	name := strings.TrimSpace(d.Name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	target, ok := Targets[d.Target]
+	if !ok {
+		names := make([]string, 0, len(Targets))
+		for t := range Targets {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("%w: target must be one of %v", ErrInvalid, names)
+	}
+
+	query := url.Values{}
+	for key, value := range d.Params {
+		if !contains(target.Params, key) {
+			return "", fmt.Errorf("%w: '%s' is not a %s filter (allowed: %v)", ErrInvalid, key, d.Target, target.Params)
+		}
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	return query.Encode(), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *View) expand() {
+	v.Path = Targets[v.Target].Path
+	if v.Query != "" {
+		v.Path += "?" + v.Query
+	}
+}
+
+// Store persists saved views in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide saved view store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide saved view store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the saved_views collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// visibleTo matches the user's own views and the views shared in the tenant
+func visibleTo(tenantID, userID string) bson.M {
+	return bson.M{
+		"tenantId": tenantID,
+		"$or":      []bson.M{{"ownerId": userID}, {"shared": true}},
+	}
+}
+
+// List returns the views visible to the user, optionally for a single target, by name
+func (s *Store) List(ctx context.Context, tenantID, userID, target string) ([]View, error) {
+	filter := visibleTo(tenantID, userID)
+	if target != "" {
+		filter["target"] = target
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved views: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := []View{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode saved views: %w", err)
+	}
+	for i := range result {
+		result[i].expand()
+	}
+	return result, nil
+}
+
+// Get returns a view visible to the user
+func (s *Store) Get(ctx context.Context, tenantID, userID, id string) (*View, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	filter := visibleTo(tenantID, userID)
+	filter["_id"] = oid
+	var view View
+	err = s.collection.FindOne(ctx, filter).Decode(&view)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved view: %w", err)
+	}
+	view.expand()
+	return &view, nil
+}
+
+// Create saves a new view owned by the user
+func (s *Store) Create(ctx context.Context, tenantID, userID string, def Definition) (*View, error) {
+	query, err := def.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	view := &View{
+		TenantID:  tenantID,
+		OwnerID:   userID,
+		Name:      strings.TrimSpace(def.Name),
+		Target:    def.Target,
+		Query:     query,
+		Shared:    def.Shared,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	res, err := s.collection.InsertOne(ctx, view)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create saved view: %w", err)
+	}
+	view.ID = res.InsertedID.(primitive.ObjectID)
+	view.expand()
+	return view, nil
+}
+
+// Update replaces the definition of a view the user owns
+func (s *Store) Update(ctx context.Context, tenantID, userID, id string, def Definition) (*View, error) {
+	existing, err := s.Get(ctx, tenantID, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.OwnerID != userID {
+		return nil, ErrForbidden
+	}
+	query, err := def.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Name = strings.TrimSpace(def.Name)
+	existing.Target = def.Target
+	existing.Query = query
+	existing.Shared = def.Shared
+	existing.UpdatedAt = time.Now()
+
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": existing.ID, "tenantId": tenantID, "ownerId": userID}, existing)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update saved view: %w", err)
+	}
+	existing.expand()
+	return existing, nil
+}
+
+// Delete removes a view the user owns
+func (s *Store) Delete(ctx context.Context, tenantID, userID, id string) error {
+	existing, err := s.Get(ctx, tenantID, userID, id)
+	if err != nil {
+		return err
+	}
+	if existing.OwnerID != userID {
+		return ErrForbidden
+	}
+
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": existing.ID, "tenantId": tenantID, "ownerId": userID}); err != nil {
+		return fmt.Errorf("failed to delete saved view: %w", err)
+	}
+	return nil
+}
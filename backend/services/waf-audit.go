@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/shield"
+	shieldtypes "github.com/aws/aws-sdk-go-v2/service/shield/types"
+	"github.com/aws/aws-sdk-go-v2/service/wafv2"
+	waftypes "github.com/aws/aws-sdk-go-v2/service/wafv2/types"
+)
+
+// Compliance rules evaluated against internet-facing resources
+const (
+	RuleWebACLAttached          = "cloudloom-waf-webacl-attached"
+	RuleShieldAdvancedProtected = "cloudloom-shield-advanced-protection"
+)
+
+// Shield Advanced coverage of an edge resource
+const (
+	ShieldProtected     = "protected"
+	ShieldUnprotected   = "unprotected"
+	ShieldNotSubscribed = "not_subscribed"
+)
+
+// WebACL is a WAF web ACL and the resources it is associated with
+type WebACL struct {
+	Name          string   `json:"name"`
+	ARN           string   `json:"arn"`
+	Scope         string   `json:"scope"`
+	DefaultAction string   `json:"defaultAction"`
+	RuleCount     int      `json:"ruleCount"`
+	Resources     []string `json:"resources"`
+}
+
+// EdgeProtection is the WAF and Shield coverage of one internet-facing load balancer,
+// CloudFront distribution or API Gateway stage
+type EdgeProtection struct {
+	ResourceType string `json:"resourceType"`
+	ResourceID   string `json:"resourceId"`
+	ResourceArn  string `json:"resourceArn"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Region       string `json:"region,omitempty"`
+	WebACLArn    string `json:"webAclArn,omitempty"`
+	Shield       string `json:"shield"`
+}
+
+// WAFAudit is the web ACL inventory and edge coverage of an account
+type WAFAudit struct {
+	WebACLs        []WebACL
+	EdgeProtection []EdgeProtection
+	Rules          []ComplianceRule
+}
+
+// AuditWAF inventories WAF web ACLs and their associations, and checks every internet-facing
+// ALB, CloudFront distribution and API Gateway stage in the inventory for a web ACL and for
+// Shield Advanced protection. CloudFront ACLs and Shield are read from us-east-1.
+func (cs *ConfigService) AuditWAF(ctx context.Context, cfg aws.Config, resources []ConfigurationItem) (*WAFAudit, error) {
+	log.Println("[WAF] Auditing web ACLs and Shield coverage...")
+	accountID, err := getAccountID(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	globalCfg := cfg
+	globalCfg.Region = "us-east-1"
+
+	regional, err := listWebACLs(ctx, wafv2.NewFromConfig(cfg), waftypes.ScopeRegional)
+	if err != nil {
+		return nil, err
+	}
+	cloudFront, err := listWebACLs(ctx, wafv2.NewFromConfig(globalCfg), waftypes.ScopeCloudfront)
+	if err != nil {
+		// Only CloudFront coverage is lost, so carry on with the regional ACLs
+		log.Printf("[WAF] Warning: %v", err)
+	}
+	audit := &WAFAudit{WebACLs: append(regional, cloudFront...)}
+
+	aclByResource := map[string]string{}
+	for _, acl := range audit.WebACLs {
+		for _, arn := range acl.Resources {
+			aclByResource[arn] = acl.ARN
+		}
+	}
+
+	shieldCoverage, err := shieldProtections(ctx, shield.NewFromConfig(globalCfg))
+	if err != nil {
+		log.Printf("[WAF] Warning: %v", err)
+	}
+
+	audit.EdgeProtection = edgeResources(resources, accountID)
+	for i := range audit.EdgeProtection {
+		edge := &audit.EdgeProtection[i]
+		if arn, ok := aclByResource[edge.ResourceArn]; ok {
+			edge.WebACLArn = arn
+		}
+		switch {
+		case shieldCoverage == nil:
+			edge.Shield = ShieldNotSubscribed
+		case shieldCoverage[edge.ResourceArn]:
+			edge.Shield = ShieldProtected
+		default:
+			edge.Shield = ShieldUnprotected
+		}
+	}
+
+	now := time.Now()
+	attached := newAuditRule(RuleWebACLAttached, "")
+	protected := newAuditRule(RuleShieldAdvancedProtected, "")
+	for _, edge := range audit.EdgeProtection {
+		attached.evaluateAs(edge.ResourceType, edge.ResourceID, edge.WebACLArn != "", "Internet-facing resource has no WAF web ACL", now)
+		if edge.Shield != ShieldNotSubscribed {
+			protected.evaluateAs(edge.ResourceType, edge.ResourceID, edge.Shield == ShieldProtected, "Internet-facing resource is not protected by Shield Advanced", now)
+		}
+	}
+	audit.Rules = []ComplianceRule{attached.rule()}
+	if shieldCoverage != nil {
+		audit.Rules = append(audit.Rules, protected.rule())
+	}
+
+	log.Printf("[WAF] ✅ Found %d web ACLs and %d internet-facing resources", len(audit.WebACLs), len(audit.EdgeProtection))
+	return audit, nil
+}
+
+// listWebACLs returns the web ACLs of one scope with their rule counts and associated resources
+func listWebACLs(ctx context.Context, client *wafv2.Client, scope waftypes.Scope) ([]WebACL, error) {
+	var acls []WebACL
+	input := &wafv2.ListWebACLsInput{Scope: scope}
+	for {
+		page, err := client.ListWebACLs(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s web ACLs: %w", scope, err)
+		}
+		for _, summary := range page.WebACLs {
+			acl := WebACL{Name: aws.ToString(summary.Name), ARN: aws.ToString(summary.ARN), Scope: string(scope), Resources: []string{}}
+
+			detail, err := client.GetWebACL(ctx, &wafv2.GetWebACLInput{Id: summary.Id, Name: summary.Name, Scope: scope})
+			if err != nil {
+				log.Printf("[WAF] Warning: failed to get web ACL %s: %v", acl.Name, err)
+			} else if detail.WebACL != nil {
+				acl.RuleCount = len(detail.WebACL.Rules)
+				if action := detail.WebACL.DefaultAction; action != nil && action.Block != nil {
+					acl.DefaultAction = "BLOCK"
+				} else {
+					acl.DefaultAction = "ALLOW"
+				}
+			}
+
+			// CloudFront associations are recorded on the distributions instead
+			if scope == waftypes.ScopeRegional {
+				for _, resourceType := range []waftypes.ResourceType{waftypes.ResourceTypeApplicationLoadBalancer, waftypes.ResourceTypeApiGateway} {
+					out, err := client.ListResourcesForWebACL(ctx, &wafv2.ListResourcesForWebACLInput{
+						WebACLArn:    summary.ARN,
+						ResourceType: resourceType,
+					})
+					if err != nil {
+						log.Printf("[WAF] Warning: failed to list %s resources of %s: %v", resourceType, acl.Name, err)
+						continue
+					}
+					acl.Resources = append(acl.Resources, out.ResourceArns...)
+				}
+			}
+			acls = append(acls, acl)
+		}
+		if page.NextMarker == nil || aws.ToString(page.NextMarker) == "" {
+			return acls, nil
+		}
+		input.NextMarker = page.NextMarker
+	}
+}
+
+// shieldProtections returns the ARNs of resources protected by Shield Advanced, or nil when
+// the account has no Shield Advanced subscription
+func shieldProtections(ctx context.Context, client *shield.Client) (map[string]bool, error) {
+	_, err := client.DescribeSubscription(ctx, &shield.DescribeSubscriptionInput{})
+	var notSubscribed *shieldtypes.ResourceNotFoundException
+	if errors.As(err, &notSubscribed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe Shield subscription: %w", err)
+	}
+
+	protected := map[string]bool{}
+	paginator := shield.NewListProtectionsPaginator(client, &shield.ListProtectionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return protected, fmt.Errorf("failed to list Shield protections: %w", err)
+		}
+		for _, p := range page.Protections {
+			protected[aws.ToString(p.ResourceArn)] = true
+		}
+	}
+	return protected, nil
+}
+
+// edgeResources picks the internet-facing resources out of the inventory. Associations that
+// AWS Config records on the resource itself (CloudFront, API Gateway stages) are filled in here.
+func edgeResources(resources []ConfigurationItem, accountID string) []EdgeProtection {
+	edges := []EdgeProtection{}
+	for _, item := range resources {
+		edge := EdgeProtection{
+			ResourceType: item.ResourceType,
+			ResourceID:   item.ResourceID,
+			ResourceName: item.ResourceName,
+			Region:       item.Region,
+		}
+		switch item.ResourceType {
+		case "AWS::ElasticLoadBalancingV2::LoadBalancer":
+			if stringValue(configValue(item.Configuration, "scheme")) != "internet-facing" ||
+				!strings.EqualFold(stringValue(configValue(item.Configuration, "type")), "application") {
+				continue
+			}
+			edge.ResourceArn = item.ResourceID
+		case "AWS::CloudFront::Distribution":
+			edge.ResourceArn = fmt.Sprintf("arn:aws:cloudfront::%s:distribution/%s", accountID, item.ResourceID)
+			if dist, ok := configValue(item.Configuration, "distributionConfig").(map[string]interface{}); ok {
+				edge.WebACLArn = stringValue(configValue(dist, "webACLId"))
+			}
+		case "AWS::ApiGateway::Stage":
+			apiID := stringValue(configValue(item.Configuration, "restApiId"))
+			stage := stringValue(configValue(item.Configuration, "stageName"))
+			if apiID == "" || stage == "" {
+				continue
+			}
+			edge.ResourceArn = fmt.Sprintf("arn:aws:apigateway:%s::/restapis/%s/stages/%s", item.Region, apiID, stage)
+			edge.WebACLArn = stringValue(configValue(item.Configuration, "webAclArn"))
+		default:
+			continue
+		}
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ResourceArn < edges[j].ResourceArn })
+	return edges
+}
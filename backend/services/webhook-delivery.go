@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/jobs"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+	"github.com/rishichirchi/cloudloom/services/secrets"
+	"github.com/rishichirchi/cloudloom/services/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobTypeWebhookDelivery posts one event to one of the tenant's webhooks
+const JobTypeWebhookDelivery = "webhook_delivery"
+
+// webhookRetryPolicy retries a failed delivery for about three hours, backing off from 30
+// seconds to an hour between attempts
+var webhookRetryPolicy = jobs.RetryPolicy{
+	MaxAttempts:    8,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     time.Hour,
+	Multiplier:     3,
+}
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256, keyed with the
+// webhook's secret, of the timestamp, a dot and the body, so a receiver can reject replays of
+// old requests as well as forged ones.
+const (
+	WebhookEventHeader     = "X-CloudLoom-Event"
+	WebhookDeliveryHeader  = "X-CloudLoom-Delivery"
+	WebhookTimestampHeader = "X-CloudLoom-Timestamp"
+	WebhookSignatureHeader = "X-CloudLoom-Signature"
+)
+
+// webhookTimeout bounds one attempt to post an event
+const webhookTimeout = 10 * time.Second
+
+// webhookClient only connects to public addresses, wherever the webhook's name resolves to
+var webhookClient = common.PublicHTTPClient(webhookTimeout)
+
+// ErrWebhooksUnavailable is returned when the webhook store or the secret store that keeps
+// their signing secrets is not configured
+var ErrWebhooksUnavailable = errors.New("webhooks are not available")
+
+// WebhookEvent is the body posted to a webhook
+type WebhookEvent struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	TenantID   string    `json:"tenantId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// Remediation is the remediation as it is after the event; a ping has none
+	Remediation *remediations.Remediation `json:"remediation,omitempty"`
+}
+
+// ListWebhooks returns the tenant's webhooks
+func ListWebhooks(ctx context.Context, tenantID string) ([]webhooks.Webhook, error) {
+	store := webhooks.Default()
+	if store == nil {
+		return nil, ErrWebhooksUnavailable
+	}
+	return store.List(ctx, tenantID)
+}
+
+// CreateWebhook stores a webhook for the tenant, enabled, and returns it with its new signing
+// secret, which is not shown again
+func CreateWebhook(ctx context.Context, tenantID string, webhook *webhooks.Webhook) (*webhooks.Webhook, string, error) {
+	store, secretStore := webhooks.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, "", ErrWebhooksUnavailable
+	}
+	webhook.TenantID, webhook.Enabled = tenantID, true
+	if err := store.Create(ctx, webhook); err != nil {
+		return nil, "", err
+	}
+	secret, err := setWebhookSecret(ctx, secretStore, tenantID, webhook.ID.Hex())
+	if err != nil {
+		if deleteErr := store.Delete(ctx, tenantID, webhook.ID); deleteErr != nil {
+			log.Printf("[Webhooks] Warning: %v", deleteErr)
+		}
+		return nil, "", err
+	}
+	log.Printf("[Webhooks] ✅ Tenant %s posts %v to %s", tenantID, webhook.Events, webhook.URL)
+	return webhook, secret, nil
+}
+
+// UpdateWebhook changes the URL, events, description or enabled state of one of the tenant's
+// webhooks. Its signing secret stays the same.
+func UpdateWebhook(ctx context.Context, tenantID string, webhook *webhooks.Webhook) (*webhooks.Webhook, error) {
+	store := webhooks.Default()
+	if store == nil {
+		return nil, ErrWebhooksUnavailable
+	}
+	webhook.TenantID = tenantID
+	if err := store.Update(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, tenantID, webhook.ID.Hex())
+}
+
+// RotateWebhookSecret replaces the signing secret of one of the tenant's webhooks and returns
+// the new one. Deliveries still waiting to be retried are signed with the new secret.
+func RotateWebhookSecret(ctx context.Context, tenantID, id string) (string, error) {
+	store, secretStore := webhooks.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return "", ErrWebhooksUnavailable
+	}
+	webhook, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return "", err
+	}
+	return setWebhookSecret(ctx, secretStore, tenantID, webhook.ID.Hex())
+}
+
+// DeleteWebhook removes one of the tenant's webhooks and its signing secret. Deliveries still
+// waiting to be retried are dropped.
+func DeleteWebhook(ctx context.Context, tenantID, id string) error {
+	store, secretStore := webhooks.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return ErrWebhooksUnavailable
+	}
+	webhook, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, tenantID, webhook.ID); err != nil {
+		return err
+	}
+	name := secrets.TenantName(tenantID, secrets.WebhookSigningSecrets)
+	signing, err := webhookSecrets(ctx, secretStore, tenantID)
+	if err == nil {
+		delete(signing, id)
+		err = secrets.PutJSON(ctx, secretStore, name, signing)
+	}
+	if err != nil {
+		log.Printf("[Webhooks] Warning: failed to remove the signing secret of webhook %s: %v", id, err)
+	}
+	log.Printf("[Webhooks] ✅ Removed webhook %s of tenant %s", webhook.URL, tenantID)
+	return nil
+}
+
+// PingWebhook posts a ping event to one of the tenant's webhooks, even a disabled one, so the
+// receiver can check the signature
+func PingWebhook(ctx context.Context, tenantID, id string) (*jobs.Job, error) {
+	store := webhooks.Default()
+	if store == nil || jobs.Default() == nil {
+		return nil, ErrWebhooksUnavailable
+	}
+	webhook, err := store.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(WebhookEvent{
+		ID:         primitive.NewObjectID().Hex(),
+		Event:      webhooks.EventPing,
+		TenantID:   tenantID,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return enqueueWebhookDelivery(ctx, webhook, webhooks.EventPing, body)
+}
+
+// webhookSecrets returns the signing secrets of the tenant's webhooks by webhook ID
+func webhookSecrets(ctx context.Context, store secrets.Store, tenantID string) (map[string]string, error) {
+	signing := map[string]string{}
+	err := secrets.GetJSON(ctx, store, secrets.TenantName(tenantID, secrets.WebhookSigningSecrets), &signing)
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		return nil, err
+	}
+	return signing, nil
+}
+
+// setWebhookSecret generates a new signing secret for the webhook and stores it
+func setWebhookSecret(ctx context.Context, store secrets.Store, tenantID, id string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	secret := "whsec_" + hex.EncodeToString(random)
+
+	signing, err := webhookSecrets(ctx, store, tenantID)
+	if err != nil {
+		return "", err
+	}
+	signing[id] = secret
+	if err := secrets.PutJSON(ctx, store, secrets.TenantName(tenantID, secrets.WebhookSigningSecrets), signing); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// signWebhook returns the signature of a request body sent at the Unix timestamp
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookEventFor returns the webhook event for an event of the remediation's audit trail,
+// or "" if webhooks are not told about it
+func webhookEventFor(event string, remediation *remediations.Remediation) string {
+	switch event {
+	case audit.EventProposed:
+		return webhooks.EventRemediationProposed
+	case audit.EventApproved:
+		return webhooks.EventRemediationApproved
+	case audit.EventExecuted:
+		if remediation.Status == remediations.StatusFailed {
+			return webhooks.EventRemediationFailed
+		}
+		return webhooks.EventRemediationExecuted
+	}
+	return ""
+}
+
+// dispatchRemediationWebhooks queues a delivery of the event to each of the tenant's webhooks
+// that subscribes to it. Failing to queue is logged and does not affect the remediation.
+func dispatchRemediationWebhooks(ctx context.Context, remediation *remediations.Remediation, event string) {
+	kind := webhookEventFor(event, remediation)
+	store := webhooks.Default()
+	if kind == "" || store == nil || jobs.Default() == nil || DemoModeEnabled() {
+		return
+	}
+	registered, err := store.List(ctx, remediation.TenantID)
+	if err != nil {
+		log.Printf("[Webhooks] Warning: not posting %s of remediation %s: %v", kind, remediation.ID.Hex(), err)
+		return
+	}
+
+	var body []byte
+	for i := range registered {
+		webhook := &registered[i]
+		if !webhook.Subscribes(kind) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(WebhookEvent{
+				ID:          primitive.NewObjectID().Hex(),
+				Event:       kind,
+				TenantID:    remediation.TenantID,
+				OccurredAt:  time.Now(),
+				Remediation: remediation,
+			})
+			if err != nil {
+				log.Printf("[Webhooks] Warning: failed to encode %s of remediation %s: %v", kind, remediation.ID.Hex(), err)
+				return
+			}
+		}
+		if _, err := enqueueWebhookDelivery(ctx, webhook, kind, body); err != nil {
+			log.Printf("[Webhooks] Warning: failed to queue %s for %s: %v", kind, webhook.URL, err)
+		}
+	}
+}
+
+func enqueueWebhookDelivery(ctx context.Context, webhook *webhooks.Webhook, event string, body []byte) (*jobs.Job, error) {
+	return jobs.Default().Enqueue(ctx, JobTypeWebhookDelivery, webhook.TenantID, map[string]interface{}{
+		"webhookId": webhook.ID.Hex(),
+		"event":     event,
+		"body":      string(body),
+	})
+}
+
+// runWebhookDeliveryJob posts a queued event to its webhook, signed with the webhook's current
+// secret. Server errors, timeouts and rate limiting are retried with backoff; other client
+// errors and deleted webhooks are not.
+func runWebhookDeliveryJob(ctx context.Context, job *jobs.Job) (interface{}, error) {
+	store, secretStore := webhooks.Default(), secrets.Default()
+	if store == nil || secretStore == nil {
+		return nil, ErrWebhooksUnavailable
+	}
+	webhookID, _ := job.Payload["webhookId"].(string)
+	event, _ := job.Payload["event"].(string)
+	body, _ := job.Payload["body"].(string)
+	webhook, err := store.Get(ctx, job.TenantID, webhookID)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if event != webhooks.EventPing && !webhook.Enabled {
+		return map[string]interface{}{"skipped": true, "reason": "webhook is disabled"}, nil
+	}
+	signing, err := webhookSecrets(ctx, secretStore, job.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := signing[webhookID]
+	if !ok {
+		return nil, jobs.Permanent(fmt.Errorf("webhook %s has no signing secret", webhookID))
+	}
+
+	status, deliveryErr := postWebhook(ctx, webhook.URL, job.ID.Hex(), event, secret, []byte(body))
+	if err := store.RecordDelivery(ctx, job.TenantID, webhook.ID, time.Now(), deliveryErr); err != nil {
+		log.Printf("[Webhooks] Warning: %v", err)
+	}
+	if deliveryErr != nil {
+		retryable := status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+		if !retryable {
+			return nil, jobs.Permanent(deliveryErr)
+		}
+		return nil, deliveryErr
+	}
+	return map[string]interface{}{"webhookId": webhookID, "event": event, "status": status}, nil
+}
+
+// postWebhook sends one signed request and returns the response status, 0 when there was no
+// response
+func postWebhook(ctx context.Context, url, deliveryID, event, secret string, body []byte) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request to %s: %w", url, err)
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "CloudLoom-Webhooks/1.0")
+	request.Header.Set(WebhookEventHeader, event)
+	request.Header.Set(WebhookDeliveryHeader, deliveryID)
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookSignatureHeader, signWebhook(secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post %s to %s: %w", event, url, err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("%s answered %s to %s", url, response.Status, event)
+	}
+	return response.StatusCode, nil
+}
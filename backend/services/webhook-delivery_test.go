@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/services/audit"
+	"github.com/rishichirchi/cloudloom/services/remediations"
+	"github.com/rishichirchi/cloudloom/services/webhooks"
+)
+
+func TestSignWebhook(t *testing.T) {
+	const want = "sha256=aa8efe37b751e71157c508c5ac4acb1e9fe5225db98355dfc00f4b680afbc447"
+	body := []byte(`{"event":"ping"}`)
+	if got := signWebhook("whsec_test", 1700000000, body); got != want {
+		t.Fatalf("signWebhook() = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{"other secret", "whsec_other", 1700000000, `{"event":"ping"}`},
+		{"replayed with a new timestamp", "whsec_test", 1700000001, `{"event":"ping"}`},
+		{"tampered body", "whsec_test", 1700000000, `{"event":"pong"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got == want {
+				t.Errorf("signWebhook() matches the original signature")
+			}
+		})
+	}
+}
+
+func TestWebhookEventFor(t *testing.T) {
+	tests := []struct {
+		event  string
+		status remediations.Status
+		want   string
+	}{
+		{audit.EventProposed, remediations.StatusPending, webhooks.EventRemediationProposed},
+		{audit.EventApproved, remediations.StatusApproved, webhooks.EventRemediationApproved},
+		{audit.EventExecuted, remediations.StatusSucceeded, webhooks.EventRemediationExecuted},
+		{audit.EventExecuted, remediations.StatusFailed, webhooks.EventRemediationFailed},
+		{audit.EventRejected, remediations.StatusRejected, ""},
+		{audit.EventRolledBack, remediations.StatusRolledBack, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event+"/"+string(tt.status), func(t *testing.T) {
+			if got := webhookEventFor(tt.event, &remediations.Remediation{Status: tt.status}); got != tt.want {
+				t.Errorf("webhookEventFor(%s) = %q, want %q", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostWebhookRefusesBlockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the webhook was posted to a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := postWebhook(context.Background(), server.URL, "delivery-1", webhooks.EventPing, "whsec_test", []byte(`{}`))
+	if !errors.Is(err, common.ErrBlockedAddress) {
+		t.Errorf("postWebhook() error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	// The test server listens on loopback
+	isBlocked := common.IsBlockedAddress
+	common.IsBlockedAddress = func(net.IP) bool { return false }
+	defer func() { common.IsBlockedAddress = isBlocked }()
+
+	body := []byte(`{"event":"remediation.executed"}`)
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"accepted", http.StatusOK, false},
+		{"no content", http.StatusNoContent, false},
+		{"server error", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := io.ReadAll(r.Body)
+				timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+				if err != nil {
+					t.Errorf("timestamp header = %q", r.Header.Get(WebhookTimestampHeader))
+				}
+				if got, want := r.Header.Get(WebhookSignatureHeader), signWebhook("whsec_test", timestamp, received); got != want {
+					t.Errorf("signature header = %s, want %s", got, want)
+				}
+				if r.Header.Get(WebhookEventHeader) != webhooks.EventRemediationExecuted || r.Header.Get(WebhookDeliveryHeader) != "delivery-1" {
+					t.Errorf("event and delivery headers = %q, %q", r.Header.Get(WebhookEventHeader), r.Header.Get(WebhookDeliveryHeader))
+				}
+				if string(received) != string(body) {
+					t.Errorf("body = %s, want %s", received, body)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			status, err := postWebhook(context.Background(), server.URL, "delivery-1", webhooks.EventRemediationExecuted, "whsec_test", body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("postWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.status {
+				t.Errorf("postWebhook() status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
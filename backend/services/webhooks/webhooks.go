@@ -0,0 +1,231 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rishichirchi/cloudloom/common"
+	"github.com/rishichirchi/cloudloom/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = config.CollectionWebhooks
+
+var (
+	// ErrNotFound is returned when a webhook does not exist for the tenant
+	ErrNotFound = errors.New("webhook not found")
+	// ErrExists is returned when the tenant already has a webhook for the URL
+	ErrExists = errors.New("webhook already exists")
+	// ErrInvalid is returned for a webhook without an HTTPS URL or with an unknown event
+	ErrInvalid = errors.New("invalid webhook")
+)
+
+// Events a webhook can subscribe to
+const (
+	EventRemediationProposed = "remediation.proposed"
+	EventRemediationApproved = "remediation.approved"
+	EventRemediationExecuted = "remediation.executed"
+	EventRemediationFailed   = "remediation.failed"
+	// EventPing is sent when someone tests the webhook, whatever it subscribes to
+	EventPing = "ping"
+)
+
+// Events are the events a webhook can subscribe to, in the order a remediation goes through them
+var Events = []string{EventRemediationProposed, EventRemediationApproved, EventRemediationExecuted, EventRemediationFailed}
+
+// Outcome of the last delivery to a webhook
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a customer endpoint CloudLoom posts remediation events to, signed with a secret
+// only the tenant and CloudLoom know. The secret itself is kept in the secret store.
+type Webhook struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID string             `bson:"tenantId" json:"tenantId"`
+	URL      string             `bson:"url" json:"url"`
+	// Events are the events posted to the webhook; none means all of them
+	Events      []string `bson:"events" json:"events"`
+	Description string   `bson:"description,omitempty" json:"description,omitempty"`
+	Enabled     bool     `bson:"enabled" json:"enabled"`
+	// LastDeliveryAt, LastDelivery and LastError describe the last attempt to post an event
+	LastDeliveryAt *time.Time `bson:"lastDeliveryAt,omitempty" json:"lastDeliveryAt,omitempty"`
+	LastDelivery   string     `bson:"lastDelivery,omitempty" json:"lastDelivery,omitempty"`
+	LastError      string     `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt      time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Validate checks the URL is an absolute HTTPS URL outside CloudLoom's network and the events
+// are known, subscribing a webhook without events to all of them
+func (w *Webhook) Validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%w: '%s' is not an HTTPS URL", ErrInvalid, w.URL)
+	}
+	if err := common.CheckPublicHost(parsed.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(w.Events) == 0 {
+		w.Events = append([]string(nil), Events...)
+	}
+	for _, event := range w.Events {
+		if !known(event) {
+			return fmt.Errorf("%w: unknown event '%s'", ErrInvalid, event)
+		}
+	}
+	return nil
+}
+
+// Subscribes reports whether the webhook is enabled and takes the event
+func (w *Webhook) Subscribes(event string) bool {
+	if !w.Enabled {
+		return false
+	}
+	for _, subscribed := range w.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists per-tenant webhooks in MongoDB
+type Store struct {
+	collection *mongo.Collection
+}
+
+var defaultStore *Store
+
+// Init creates the process-wide webhook store backed by the given database
+func Init(db *mongo.Database) *Store {
+	defaultStore = NewStore(db)
+	return defaultStore
+}
+
+// Default returns the process-wide webhook store created by Init
+func Default() *Store {
+	return defaultStore
+}
+
+// NewStore creates a Store using the webhooks collection
+func NewStore(db *mongo.Database) *Store {
+	return &Store{collection: db.Collection(collectionName)}
+}
+
+// Create validates and stores a new webhook for the tenant
+func (s *Store) Create(ctx context.Context, webhook *Webhook) error {
+	if err := webhook.Validate(); err != nil {
+		return err
+	}
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	_, err := s.collection.InsertOne(ctx, webhook)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, webhook.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// List returns the tenant's webhooks, oldest first
+func (s *Store) List(ctx context.Context, tenantID string) ([]Webhook, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"tenantId": tenantID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	result := []Webhook{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+	return result, nil
+}
+
+// Get returns one of the tenant's webhooks
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Webhook, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var webhook Webhook
+	err = s.collection.FindOne(ctx, bson.M{"_id": oid, "tenantId": tenantID}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+// Update validates and saves the webhook's URL, events, description and whether it is enabled
+func (s *Store) Update(ctx context.Context, webhook *Webhook) error {
+	if err := webhook.Validate(); err != nil {
+		return err
+	}
+	webhook.UpdatedAt = time.Now()
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": webhook.ID, "tenantId": webhook.TenantID},
+		bson.M{"$set": bson.M{
+			"url":         webhook.URL,
+			"events":      webhook.Events,
+			"description": webhook.Description,
+			"enabled":     webhook.Enabled,
+			"updatedAt":   webhook.UpdatedAt,
+		}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, webhook.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordDelivery saves the outcome of an attempt to post an event to the webhook. A nil
+// deliveryErr records it as delivered.
+func (s *Store) RecordDelivery(ctx context.Context, tenantID string, id primitive.ObjectID, at time.Time, deliveryErr error) error {
+	set := bson.M{"lastDeliveryAt": at, "lastDelivery": DeliveryDelivered, "lastError": ""}
+	if deliveryErr != nil {
+		set["lastDelivery"], set["lastError"] = DeliveryFailed, deliveryErr.Error()
+	}
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "tenantId": tenantID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Delete removes one of the tenant's webhooks
+func (s *Store) Delete(ctx context.Context, tenantID string, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "tenantId": tenantID})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		webhook    Webhook
+		wantEvents []string
+		wantErr    bool
+	}{
+		{
+			name:       "no events subscribes to all",
+			webhook:    Webhook{URL: "https://hooks.example.com/cloudloom"},
+			wantEvents: Events,
+		},
+		{
+			name:       "listed events",
+			webhook:    Webhook{URL: "https://hooks.example.com/cloudloom", Events: []string{EventRemediationFailed}},
+			wantEvents: []string{EventRemediationFailed},
+		},
+		{name: "plain http", webhook: Webhook{URL: "http://hooks.example.com/cloudloom"}, wantErr: true},
+		{name: "relative url", webhook: Webhook{URL: "/cloudloom"}, wantErr: true},
+		{name: "no host", webhook: Webhook{URL: "https:///cloudloom"}, wantErr: true},
+		{name: "loopback", webhook: Webhook{URL: "https://127.0.0.1/cloudloom"}, wantErr: true},
+		{name: "localhost", webhook: Webhook{URL: "https://localhost:8443/cloudloom"}, wantErr: true},
+		{name: "private network", webhook: Webhook{URL: "https://10.0.12.7/cloudloom"}, wantErr: true},
+		{name: "instance metadata", webhook: Webhook{URL: "https://169.254.169.254/latest/meta-data"}, wantErr: true},
+		{name: "ipv6 loopback", webhook: Webhook{URL: "https://[::1]/cloudloom"}, wantErr: true},
+		{name: "ipv4-mapped private address", webhook: Webhook{URL: "https://[::ffff:192.168.1.1]/cloudloom"}, wantErr: true},
+		{name: "unspecified address", webhook: Webhook{URL: "https://0.0.0.0/cloudloom"}, wantErr: true},
+		{name: "unknown event", webhook: Webhook{URL: "https://hooks.example.com", Events: []string{"finding.created"}}, wantErr: true},
+		{name: "ping is not subscribable", webhook: Webhook{URL: "https://hooks.example.com", Events: []string{EventPing}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.webhook.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Validate() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(tt.webhook.Events, tt.wantEvents) {
+				t.Errorf("Events = %v, want %v", tt.webhook.Events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestWebhookSubscribes(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook Webhook
+		event   string
+		want    bool
+	}{
+		{"subscribed", Webhook{Enabled: true, Events: []string{EventRemediationExecuted}}, EventRemediationExecuted, true},
+		{"not subscribed", Webhook{Enabled: true, Events: []string{EventRemediationExecuted}}, EventRemediationFailed, false},
+		{"disabled", Webhook{Events: []string{EventRemediationExecuted}}, EventRemediationExecuted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.webhook.Subscribes(tt.event); got != tt.want {
+				t.Errorf("Subscribes(%s) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	awsconfig "github.com/rishichirchi/cloudloom/config"
+)
+
+const (
+	// defaultInventoryConcurrency is how many AWS calls an inventory scan makes at once.
+	// Override with INVENTORY_CONCURRENCY.
+	defaultInventoryConcurrency = 8
+	// Throttled calls are retried up to throttleRetries times, waiting twice as long each time
+	throttleRetries   = 4
+	throttleBaseDelay = time.Second
+)
+
+// throttlingCodes are the error codes AWS services return when a caller exceeds a rate limit
+var throttlingCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"TooManyRequestsException":               true,
+	"RequestLimitExceeded":                   true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"SlowDown":                               true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+func inventoryConcurrencyFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("INVENTORY_CONCURRENCY")); err == nil && v > 0 {
+		return v
+	}
+	return defaultInventoryConcurrency
+}
+
+func isThrottling(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && throttlingCodes[apiErr.ErrorCode()]
+}
+
+// workerPool runs tasks on a bounded number of goroutines. When AWS throttles any task, every
+// worker holds off before its next call, and the throttled task is retried with backoff.
+type workerPool struct {
+	concurrency int
+
+	mu         sync.Mutex
+	pauseUntil time.Time
+}
+
+func newWorkerPool(concurrency int) *workerPool {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &workerPool{concurrency: concurrency}
+}
+
+// run calls task for each index below n and returns the error of each call, nil for those that
+// succeeded. Once ctx is cancelled no further task starts, and those not started report ctx.Err().
+func (p *workerPool) run(ctx context.Context, n int, task func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.concurrency, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = p.call(ctx, func() error { return task(ctx, i) })
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+// call runs one task, waiting out any pause and retrying while it is throttled
+func (p *workerPool) call(ctx context.Context, task func() error) error {
+	delay := throttleBaseDelay
+	for attempt := 0; ; attempt++ {
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+		err := task()
+		if err == nil || !isThrottling(err) || attempt == throttleRetries {
+			return err
+		}
+		log.Printf("[WorkerPool] Throttled, pausing calls for %s: %v", delay, err)
+		p.pause(delay)
+		delay *= 2
+	}
+}
+
+func (p *workerPool) wait(ctx context.Context) error {
+	p.mu.Lock()
+	remaining := time.Until(p.pauseUntil)
+	p.mu.Unlock()
+	if remaining <= 0 {
+		return ctx.Err()
+	}
+	return awsconfig.SleepContext(ctx, remaining)
+}
+
+func (p *workerPool) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := time.Now().Add(d); until.After(p.pauseUntil) {
+		p.pauseUntil = until
+	}
+}